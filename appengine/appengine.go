@@ -22,6 +22,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/config"
 	"github.com/google/cayley/db"
 	"github.com/google/cayley/http"
@@ -56,7 +57,7 @@ func configFrom(file string) (*config.Config, error) {
 		file = "/cayley_appengine.cfg"
 	}
 	if file == "" {
-		glog.Infoln("Couldn't find a config file appengine.cfg. Going by flag defaults only.")
+		clog.Infoln("Couldn't find a config file appengine.cfg. Going by flag defaults only.")
 	}
 	cfg, err := config.Load(file)
 	if err != nil {
@@ -100,12 +101,12 @@ func init() {
 	glog.SetToStderr(true)
 	cfg, err := configFrom("cayley_appengine.cfg")
 	if err != nil {
-		glog.Fatalln("Error loading config:", err)
+		clog.Fatalln("Error loading config:", err)
 	}
 
 	handle, err := db.Open(cfg)
 	if err != nil {
-		glog.Fatalln("Error opening database:", err)
+		clog.Fatalln("Error opening database:", err)
 	}
 	http.SetupRoutes(handle, cfg)
 }
@@ -0,0 +1,268 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client is a Go client of the HTTP API of a Cayley server.
+//
+// For example:
+//  c := client.New("http://localhost:64210")
+//  err := c.WriteQuads(ctx, []quad.Quad{{"A", "follows", "B", ""}})
+//  results, err := c.QueryPath(ctx, client.V("A").Out("follows").Tag("b"), 0)
+//
+// Clients of the gRPC API, served by binaries built with the grpc tag, use
+// the client generated in package rpc instead.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+const (
+	// DefaultRetries is how many times a Client made by New retries a
+	// request that failed to reach the server.
+	DefaultRetries = 3
+
+	// DefaultRetryDelay is how long a Client made by New first waits to
+	// retry a request. The delay doubles with each retry.
+	DefaultRetryDelay = 100 * time.Millisecond
+
+	// DefaultMaxIdleConns is how many connections to the server a Client
+	// made by New keeps open for reuse.
+	DefaultMaxIdleConns = 8
+)
+
+// Client makes requests to a Cayley server. It is safe for concurrent use.
+type Client struct {
+	// Addr is the base URL of the server, such as
+	// "http://localhost:64210".
+	Addr string
+
+	// HTTPClient makes the requests, pooling connections in its
+	// transport.
+	HTTPClient *http.Client
+
+	// Retries is how many times a request is retried if it could not
+	// connect to the server, or found it unavailable, with a status of
+	// 502, 503 or 504. Such requests were not applied, so writes are
+	// retried too.
+	Retries int
+
+	// RetryDelay is how long to wait before the first retry. The delay
+	// doubles with each retry.
+	RetryDelay time.Duration
+
+	// Token, if set, is sent as a bearer token with each request, for a
+	// server configured with credentials. Otherwise, if User is set, it
+	// and Password are sent for basic authentication.
+	Token    string
+	User     string
+	Password string
+}
+
+// New returns a Client of the server at addr, with the default retries and
+// connection pool.
+func New(addr string) *Client {
+	return &Client{
+		Addr: addr,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				MaxIdleConnsPerHost: DefaultMaxIdleConns,
+			},
+		},
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// Error is an error returned by the server.
+type Error struct {
+	// Status is the HTTP status of the response.
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cayley: %d %s", e.Status, e.Message)
+}
+
+// retriable returns whether a request that got resp and err was not applied
+// by the server, and may be retried.
+func retriable(resp *http.Response, err error) bool {
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		oe, ok := err.(*net.OpError)
+		return ok && oe.Op == "dial"
+	}
+	switch resp.StatusCode {
+	case 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// do sends a request, retrying it as configured, and returns the response
+// if its status is 200, or the error the server returned otherwise.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	delay := c.RetryDelay
+	for try := 0; ; try++ {
+		req, err := http.NewRequest(method, c.Addr+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		} else if c.User != "" {
+			req.SetBasicAuth(c.User, c.Password)
+		}
+		resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+		if try < c.Retries && retriable(resp, err) {
+			if resp != nil {
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			defer resp.Body.Close()
+			return nil, readError(resp)
+		}
+		return resp, nil
+	}
+}
+
+// readError returns the error in the body of a response.
+func readError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(resp.Body)
+	var msg struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(b, &msg) == nil && msg.Error != "" {
+		return &Error{Status: resp.StatusCode, Message: msg.Error}
+	}
+	return &Error{Status: resp.StatusCode, Message: string(bytes.TrimSpace(b))}
+}
+
+// Query runs a query in the given language, "gremlin" or "mql", and returns
+// its results as JSON.
+func (c *Client) Query(ctx context.Context, lang, query string) (json.RawMessage, error) {
+	resp, err := c.do(ctx, "POST", "/api/v1/query/"+lang, []byte(query))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Result json.RawMessage `json:"result"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	return out.Result, err
+}
+
+// QueryPath runs the Gremlin query for p, and returns the names of the nodes
+// tagged in each result, with the nodes the path ends at tagged "id". If
+// limit is positive, at most that many results are returned.
+func (c *Client) QueryPath(ctx context.Context, p *Path, limit int) ([]map[string]string, error) {
+	q := p.String() + ".All()"
+	if limit > 0 {
+		q = fmt.Sprintf("%s.GetLimit(%d)", p, limit)
+	}
+	raw, err := c.Query(ctx, "gremlin", q)
+	if err != nil {
+		return nil, err
+	}
+	var results []map[string]string
+	err = json.Unmarshal(raw, &results)
+	return results, err
+}
+
+func (c *Client) writeQuads(ctx context.Context, path string, quads []quad.Quad) error {
+	body, err := json.Marshal(quads)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, "POST", path, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// WriteQuads adds quads to the database.
+func (c *Client) WriteQuads(ctx context.Context, quads []quad.Quad) error {
+	return c.writeQuads(ctx, "/api/v1/write", quads)
+}
+
+// DeleteQuads deletes quads from the database.
+func (c *Client) DeleteQuads(ctx context.Context, quads []quad.Quad) error {
+	return c.writeQuads(ctx, "/api/v1/delete", quads)
+}
+
+// Watch calls fn with each delta applied to the quads matching pattern,
+// whose empty fields match any value, until ctx is done, the connection
+// fails, or fn returns an error, which Watch then returns.
+func (c *Client) Watch(ctx context.Context, pattern quad.Quad, fn func(*graph.Delta) error) error {
+	v := url.Values{}
+	for d, name := range map[quad.Direction]string{
+		quad.Subject:   "subject",
+		quad.Predicate: "predicate",
+		quad.Object:    "object",
+		quad.Label:     "label",
+	} {
+		if s := pattern.Get(d); s != "" {
+			v.Set(name, s)
+		}
+	}
+	resp, err := c.do(ctx, "GET", "/api/v1/watch?"+v.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var d graph.Delta
+		if err := dec.Decode(&d); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := fn(&d); err != nil {
+			return err
+		}
+	}
+}
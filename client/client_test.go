@@ -0,0 +1,208 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	cayleyhttp "github.com/google/cayley/http"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	r := httprouter.New()
+	cayleyhttp.NewAPI(
+		&graph.Handle{QuadStore: qs, QuadWriter: qw},
+		&config.Config{ReplicationType: "single", Timeout: time.Minute},
+	).APIv1(r)
+	return httptest.NewServer(r)
+}
+
+func TestWriteAndQuery(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	err := c.WriteQuads(ctx, []quad.Quad{
+		{"A", "follows", "B", ""},
+		{"A", "follows", "C", ""},
+	})
+	if err != nil {
+		t.Fatalf("Could not write: %v", err)
+	}
+	if err := c.DeleteQuads(ctx, []quad.Quad{{"A", "follows", "C", ""}}); err != nil {
+		t.Fatalf("Could not delete: %v", err)
+	}
+	raw, err := c.Query(ctx, "mql", `[{"id": "A", "follows": null}]`)
+	if err != nil {
+		t.Fatalf("Could not query: %v", err)
+	}
+	var got []map[string]string
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("Could not decode results %s: %v", raw, err)
+	}
+	if len(got) != 1 || got[0]["follows"] != "B" {
+		t.Errorf("Unexpected results, got:%s expect:[{\"follows\":\"B\",\"id\":\"A\"}]", raw)
+	}
+
+	err = c.DeleteQuads(ctx, []quad.Quad{{"A", "follows", "C", ""}})
+	if e, ok := err.(*Error); !ok || e.Status != 409 {
+		t.Errorf("Unexpected error deleting a missing quad: %v", err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	r := httprouter.New()
+	cayleyhttp.NewAPI(&graph.Handle{QuadStore: qs, QuadWriter: qw}, &config.Config{
+		ReplicationType: "single",
+		Timeout:         time.Minute,
+		Credentials: []config.Credential{
+			{Token: "secret", Role: "write"},
+			{User: "reader", Password: "hunter2", Role: "read"},
+		},
+	}).APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	ctx := context.Background()
+	write := []quad.Quad{{"A", "follows", "B", ""}}
+
+	c := New(server.URL)
+	if err, ok := c.WriteQuads(ctx, write).(*Error); !ok || err.Status != 401 {
+		t.Errorf("Unexpected error writing without credentials: %v", err)
+	}
+	c.Token = "secret"
+	if err := c.WriteQuads(ctx, write); err != nil {
+		t.Errorf("Could not write with a token: %v", err)
+	}
+	c.Token, c.User, c.Password = "", "reader", "hunter2"
+	if _, err := c.Query(ctx, "gremlin", `g.V().All()`); err != nil {
+		t.Errorf("Could not query with a user: %v", err)
+	}
+	if err, ok := c.WriteQuads(ctx, write).(*Error); !ok || err.Status != 403 {
+		t.Errorf("Unexpected error writing as a reader: %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+	var tries int
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tries++
+		if tries < 3 {
+			http.Error(w, "busy", 503)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	c := New(flaky.URL)
+	c.RetryDelay = time.Millisecond
+	if err := c.WriteQuads(context.Background(), []quad.Quad{{"A", "follows", "B", ""}}); err != nil {
+		t.Errorf("Could not write after retrying: %v", err)
+	}
+	if tries != 3 {
+		t.Errorf("Unexpected number of tries, got:%d expect:3", tries)
+	}
+
+	tries = 0
+	c.Retries = 1
+	err := c.WriteQuads(context.Background(), []quad.Quad{{"A", "follows", "C", ""}})
+	if e, ok := err.(*Error); !ok || e.Status != 503 {
+		t.Errorf("Unexpected error running out of retries: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+	c := New(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := errors.New("done")
+	errc := make(chan error, 1)
+	var got []quad.Quad
+	go func() {
+		errc <- c.Watch(ctx, quad.Quad{Predicate: "follows"}, func(d *graph.Delta) error {
+			got = append(got, d.Quad)
+			return done
+		})
+	}()
+	// Write until the watch has subscribed and seen a delta.
+	for i := 0; ; i++ {
+		q := quad.Quad{"A", "likes", "B", ""}
+		if i%2 == 1 {
+			q.Predicate = "follows"
+		}
+		q.Label = string(rune('a' + i%26))
+		if err := c.WriteQuads(ctx, []quad.Quad{q}); err != nil {
+			t.Fatalf("Could not write: %v", err)
+		}
+		select {
+		case err := <-errc:
+			if err != done {
+				t.Fatalf("Unexpected error watching: %v", err)
+			}
+			if len(got) != 1 || got[0].Predicate != "follows" {
+				t.Errorf("Unexpected deltas: %v", got)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestPathString(t *testing.T) {
+	for _, test := range []struct {
+		path   *Path
+		expect string
+	}{
+		{V(), `g.V()`},
+		{V("A", "B").Out("follows").Tag("b"), `g.V("A", "B").Out("follows").Tag("b")`},
+		{M().In("follows", "source"), `g.M().In("follows", "source")`},
+		{V("A").Follow(M().Out("follows").Out("status")), `g.V("A").Follow(g.M().Out("follows").Out("status"))`},
+		{V("A").Has("status", "cool").Back("x"), `g.V("A").Has("status", "cool").Back("x")`},
+	} {
+		if got := test.path.String(); got != test.expect {
+			t.Errorf("Unexpected path, got:%s expect:%s", got, test.expect)
+		}
+	}
+}
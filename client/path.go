@@ -0,0 +1,137 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+// Defines Path, which builds a Gremlin query for a remote database the way
+// graph/path.Path builds an iterator for a local one.
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Path is a query built step by step, like graph/path.Path, which serializes
+// to the Gremlin expression with the same morphisms. Paths started with V
+// run as queries; those started with M are morphisms, to use as arguments of
+// Follow and of the set operations.
+type Path struct {
+	start string
+	steps []step
+}
+
+type step struct {
+	name string
+	args []interface{}
+}
+
+// V starts a path at the given nodes, or at every node if none are given.
+func V(nodes ...string) *Path {
+	return &Path{start: "g.V", steps: []step{{"", stringArgs(nodes)}}}
+}
+
+// M starts a morphism, a path without a start to be followed from others.
+func M() *Path {
+	return &Path{start: "g.M", steps: []step{{"", nil}}}
+}
+
+func stringArgs(s []string) []interface{} {
+	args := make([]interface{}, len(s))
+	for i, v := range s {
+		args[i] = v
+	}
+	return args
+}
+
+func (p *Path) add(name string, args ...interface{}) *Path {
+	p.steps = append(p.steps, step{name, args})
+	return p
+}
+
+// Out follows the quads with the given predicates, from their subjects to
+// their objects. The predicates may be names, lists of names or paths; with
+// none, every predicate is followed.
+func (p *Path) Out(via ...interface{}) *Path { return p.add("Out", via...) }
+
+// In follows the quads with the given predicates from their objects to
+// their subjects.
+func (p *Path) In(via ...interface{}) *Path { return p.add("In", via...) }
+
+// Both follows the quads with the given predicates either way.
+func (p *Path) Both(via ...interface{}) *Path { return p.add("Both", via...) }
+
+// Is keeps the current nodes that are among the given ones.
+func (p *Path) Is(nodes ...string) *Path { return p.add("Is", stringArgs(nodes)...) }
+
+// Tag names the current nodes in the results.
+func (p *Path) Tag(tags ...string) *Path { return p.add("Tag", stringArgs(tags)...) }
+
+// Back returns to the nodes tagged with the given name, keeping only those
+// the path since led somewhere.
+func (p *Path) Back(tag string) *Path { return p.add("Back", tag) }
+
+// Has keeps the current nodes with an outgoing quad of the given predicate
+// and object.
+func (p *Path) Has(predicate, object string) *Path { return p.add("Has", predicate, object) }
+
+// Save tags the current nodes with the objects of their quads with the given
+// predicate.
+func (p *Path) Save(predicate, tag string) *Path { return p.add("Save", predicate, tag) }
+
+// SaveR tags the current nodes with the subjects of their quads with the
+// given predicate, as their object.
+func (p *Path) SaveR(predicate, tag string) *Path { return p.add("SaveR", predicate, tag) }
+
+// Follow follows a morphism from the current nodes.
+func (p *Path) Follow(m *Path) *Path { return p.add("Follow", m) }
+
+// FollowR follows a morphism backwards to the current nodes.
+func (p *Path) FollowR(m *Path) *Path { return p.add("FollowR", m) }
+
+// And keeps the current nodes that are also reached by another path.
+func (p *Path) And(other *Path) *Path { return p.add("And", other) }
+
+// Or adds the nodes reached by another path to the current ones.
+func (p *Path) Or(other *Path) *Path { return p.add("Or", other) }
+
+// Except removes the nodes reached by another path from the current ones.
+func (p *Path) Except(other *Path) *Path { return p.add("Except", other) }
+
+// String returns the Gremlin expression for the path, without a final step
+// such as All.
+func (p *Path) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(p.start)
+	for i, s := range p.steps {
+		if i > 0 {
+			buf.WriteString("." + s.name)
+		}
+		buf.WriteString("(")
+		for j, arg := range s.args {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			if m, ok := arg.(*Path); ok {
+				buf.WriteString(m.String())
+				continue
+			}
+			// Names, and lists of them as Out and In accept, are
+			// written as JSON, which is also valid Javascript.
+			b, _ := json.Marshal(arg)
+			buf.Write(b)
+		}
+		buf.WriteString(")")
+	}
+	return buf.String()
+}
@@ -0,0 +1,197 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package clog is the logging of Cayley. Messages are sent to a Logger, which
+// by default writes them with glog, and which programs embedding Cayley may
+// replace with SetLogger to route them into their own logging.
+//
+// Besides the glog-style functions, messages can carry structured fields:
+//
+//	clog.With(clog.Fields{"request_id": id}).Infof("completed in %v", d)
+package clog
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a message.
+type Level int
+
+const (
+	InfoLevel Level = iota
+	WarningLevel
+	ErrorLevel
+	FatalLevel
+)
+
+var levelNames = []string{"INFO", "WARNING", "ERROR", "FATAL"}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// Fields are the structured data of a message, by name.
+type Fields map[string]interface{}
+
+// Entry is a message to log.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  Fields
+}
+
+// Logger writes messages to a log.
+type Logger interface {
+	// Log writes an entry. The program exits after a fatal entry is
+	// logged, so Log should not buffer it.
+	Log(e *Entry)
+
+	// V returns whether messages of the given verbosity, as given to
+	// the V function, are logged.
+	V(level int) bool
+}
+
+// Flusher is implemented by Loggers that buffer messages.
+type Flusher interface {
+	// Flush writes the messages buffered.
+	Flush()
+}
+
+// logger receives the messages. It is only changed by SetLogger, before any
+// messages are logged.
+var logger Logger = glogLogger{}
+
+// SetLogger sets the Logger the messages are sent to, or restores the glog
+// Logger if l is nil. It must be called before Cayley logs anything, as when
+// the program starts.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = glogLogger{}
+	}
+	logger = l
+}
+
+// Flush writes the messages the Logger buffers, if it does, as a program
+// should before it exits.
+func Flush() {
+	if f, ok := logger.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+func output(level Level, fields Fields, msg string) {
+	logger.Log(&Entry{Time: time.Now(), Level: level, Message: msg, Fields: fields})
+	if level == FatalLevel {
+		os.Exit(255)
+	}
+}
+
+// sprintln formats its arguments like fmt.Sprintln, without the final
+// newline.
+func sprintln(args []interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
+
+func Info(args ...interface{})                 { output(InfoLevel, nil, fmt.Sprint(args...)) }
+func Infof(format string, args ...interface{}) { output(InfoLevel, nil, fmt.Sprintf(format, args...)) }
+func Infoln(args ...interface{})               { output(InfoLevel, nil, sprintln(args)) }
+func Warning(args ...interface{})              { output(WarningLevel, nil, fmt.Sprint(args...)) }
+func Warningf(format string, args ...interface{}) {
+	output(WarningLevel, nil, fmt.Sprintf(format, args...))
+}
+func Warningln(args ...interface{}) { output(WarningLevel, nil, sprintln(args)) }
+func Error(args ...interface{})     { output(ErrorLevel, nil, fmt.Sprint(args...)) }
+func Errorf(format string, args ...interface{}) {
+	output(ErrorLevel, nil, fmt.Sprintf(format, args...))
+}
+func Errorln(args ...interface{}) { output(ErrorLevel, nil, sprintln(args)) }
+func Fatal(args ...interface{})   { output(FatalLevel, nil, fmt.Sprint(args...)) }
+func Fatalf(format string, args ...interface{}) {
+	output(FatalLevel, nil, fmt.Sprintf(format, args...))
+}
+func Fatalln(args ...interface{}) { output(FatalLevel, nil, sprintln(args)) }
+
+// Verbose logs informational messages if they are of a logged verbosity.
+type Verbose bool
+
+// V returns whether messages of the given verbosity are logged, as a Verbose
+// that logs them only if so:
+//
+//	clog.V(2).Infof("optimized %v", it)
+func V(level int) Verbose {
+	return Verbose(logger.V(level))
+}
+
+func (v Verbose) Info(args ...interface{}) {
+	if v {
+		Info(args...)
+	}
+}
+
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v {
+		Infof(format, args...)
+	}
+}
+
+func (v Verbose) Infoln(args ...interface{}) {
+	if v {
+		Infoln(args...)
+	}
+}
+
+// Scope logs messages with a set of fields.
+type Scope struct {
+	fields Fields
+}
+
+// With returns a Scope logging messages with the given fields.
+func With(fields Fields) *Scope {
+	return &Scope{fields: fields}
+}
+
+// With returns a Scope logging messages with the fields of s and the given
+// ones, which replace those of s with the same names.
+func (s *Scope) With(fields Fields) *Scope {
+	f := make(Fields, len(s.fields)+len(fields))
+	for k, v := range s.fields {
+		f[k] = v
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	return &Scope{fields: f}
+}
+
+func (s *Scope) Infof(format string, args ...interface{}) {
+	output(InfoLevel, s.fields, fmt.Sprintf(format, args...))
+}
+
+func (s *Scope) Warningf(format string, args ...interface{}) {
+	output(WarningLevel, s.fields, fmt.Sprintf(format, args...))
+}
+
+func (s *Scope) Errorf(format string, args ...interface{}) {
+	output(ErrorLevel, s.fields, fmt.Sprintf(format, args...))
+}
+
+func (s *Scope) Fatalf(format string, args ...interface{}) {
+	output(FatalLevel, s.fields, fmt.Sprintf(format, args...))
+}
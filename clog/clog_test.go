@@ -0,0 +1,82 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package clog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type recorder struct {
+	entries []*Entry
+}
+
+func (r *recorder) Log(e *Entry)     { r.entries = append(r.entries, e) }
+func (r *recorder) V(level int) bool { return level <= 1 }
+
+func TestLogger(t *testing.T) {
+	r := &recorder{}
+	SetLogger(r)
+	defer SetLogger(nil)
+
+	Infoln("loaded", 3, "quads")
+	Warningf("slow %s", "query")
+	V(1).Infof("optimized")
+	V(2).Infof("left out")
+	log := With(Fields{"request_id": "abc"})
+	log.With(Fields{"status": 200}).Errorf("failed")
+	log.Infof("done")
+
+	var got []string
+	for _, e := range r.entries {
+		got = append(got, e.Level.String()+" "+e.Message)
+	}
+	expect := []string{"INFO loaded 3 quads", "WARNING slow query", "INFO optimized", "ERROR failed", "INFO done"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected messages, got:%q expect:%q", got, expect)
+	}
+	if f := r.entries[3].Fields; !reflect.DeepEqual(f, Fields{"request_id": "abc", "status": 200}) {
+		t.Errorf("Unexpected fields, got:%v", f)
+	}
+	if f := r.entries[4].Fields; !reflect.DeepEqual(f, Fields{"request_id": "abc"}) {
+		t.Errorf("Scope changed by With, got:%v", f)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(NewJSONLogger(&buf, 0))
+	defer SetLogger(nil)
+
+	With(Fields{"err": errors.New("no such quad"), "n": 2}).Errorf("could not delete")
+	V(1).Infof("left out")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Could not decode %q: %v", buf.String(), err)
+	}
+	delete(got, "time")
+	expect := map[string]interface{}{
+		"level": "ERROR",
+		"msg":   "could not delete",
+		"err":   "no such quad",
+		"n":     float64(2),
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected entry, got:%v expect:%v", got, expect)
+	}
+}
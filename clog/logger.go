@@ -0,0 +1,113 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package clog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/barakmich/glog"
+)
+
+// glogLogger writes messages with glog, with their fields appended to them as
+// key=value pairs, and is configured by the glog flags.
+type glogLogger struct{}
+
+func (glogLogger) Log(e *Entry) {
+	msg := e.Message
+	if len(e.Fields) > 0 {
+		msg += " " + formatFields(e.Fields)
+	}
+	switch e.Level {
+	case InfoLevel:
+		glog.Infoln(msg)
+	case WarningLevel:
+		glog.Warningln(msg)
+	case ErrorLevel:
+		glog.Errorln(msg)
+	case FatalLevel:
+		glog.Fatalln(msg)
+	}
+}
+
+func (glogLogger) V(level int) bool {
+	return bool(glog.V(glog.Level(level)))
+}
+
+func (glogLogger) Flush() {
+	glog.Flush()
+}
+
+// formatFields formats fields as key=value pairs, sorted by key.
+func formatFields(fields Fields) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%s=%v", k, fields[k])
+	}
+	return buf.String()
+}
+
+type jsonLogger struct {
+	mu        sync.Mutex
+	enc       *json.Encoder
+	verbosity int
+}
+
+// NewJSONLogger returns a Logger that writes each message to w as a JSON
+// object on a line of its own, with the "time", "level" and "msg" of the
+// message, and its fields. Messages of a verbosity higher than the given one
+// are left out.
+func NewJSONLogger(w io.Writer, verbosity int) Logger {
+	return &jsonLogger{enc: json.NewEncoder(w), verbosity: verbosity}
+}
+
+func (l *jsonLogger) Log(e *Entry) {
+	m := make(map[string]interface{}, len(e.Fields)+3)
+	for k, v := range e.Fields {
+		if err, ok := v.(error); ok {
+			// Errors are mostly structs without exported fields.
+			v = err.Error()
+		}
+		m[k] = v
+	}
+	m["time"] = e.Time.Format(time.RFC3339Nano)
+	m["level"] = e.Level.String()
+	m["msg"] = e.Message
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(m); err != nil {
+		l.enc.Encode(map[string]string{
+			"time":  m["time"].(string),
+			"level": m["level"].(string),
+			"msg":   fmt.Sprintf("%s %s", e.Message, formatFields(e.Fields)),
+		})
+	}
+}
+
+func (l *jsonLogger) V(level int) bool {
+	return level <= l.verbosity
+}
@@ -17,46 +17,140 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/config"
 	"github.com/google/cayley/db"
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/http"
 	"github.com/google/cayley/internal"
+	"github.com/google/cayley/internal/auth"
+	"github.com/google/cayley/memory"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/trace"
 
 	// Load all supported backends.
 	_ "github.com/google/cayley/graph/bolt"
+	_ "github.com/google/cayley/graph/cache"
 	_ "github.com/google/cayley/graph/leveldb"
 	_ "github.com/google/cayley/graph/memstore"
 	_ "github.com/google/cayley/graph/mongo"
+	_ "github.com/google/cayley/graph/replica"
+	_ "github.com/google/cayley/graph/shard"
+
+	// Load the text indexes.
+	_ "github.com/google/cayley/graph/fulltext"
 
 	// Load writer registry
 	_ "github.com/google/cayley/writer"
 )
 
 var (
-	quadFile           = flag.String("quads", "", "Quad file to load before going to REPL.")
-	quadType           = flag.String("format", "cquad", `Quad format to use for loading ("cquad" or "nquad").`)
+	quadFile           = flag.String("quads", "", "Comma-separated quad files, directories or glob patterns to load.")
+	quadType           = flag.String("format", "cquad", `Quad format to load, or to dump ("cquad", "nquad" or "turtle"); by default, that of each file's extension.`)
+	renameFrom         = flag.String("from", "", "Predicate to rename, or quad file to diff from; the database by default.")
+	renameTo           = flag.String("to", "", "New name of the renamed predicate, or quad file to diff to; the database by default.")
+	patchFile          = flag.String("patch", "", "Patch file to apply.")
+	purgeRetention     = flag.Duration("retention", 0, "Only purge or compact quads deleted longer ago than this.")
+	verifyRepair       = flag.Bool("repair", false, "Rebuild the damaged indexes found by verify.")
+	runDaemon          = flag.Bool("daemon", false, "Run the http server in the background, detached from the terminal.")
+	pidFile            = flag.String("pidfile", "", "File to write the process ID of the http server to while it runs.")
+	dedupeDryRun       = flag.Bool("dry_run", false, "Only report the duplicate quads dedupe finds, without removing them.")
+	statsSample        = flag.Int64("stats_sample", db.DefaultStatsSample, "Number of quads stats reads to count the quads of each predicate; all of them if 0.")
+	extractSeeds       = flag.String("seeds", "", "Comma separated nodes to extract a subgraph around.")
+	extractVia         = flag.String("via", "", "Comma separated predicates to follow when extracting a subgraph; all by default.")
+	extractDepth       = flag.Int("depth", 1, "Number of hops from the seeds to extract.")
+	dumpFile           = flag.String("dump", "", `File to dump the database, or export a query's quads, to, compressed if it ends in ".gz"; standard output by default.`)
+	dumpCompress       = flag.Bool("compress", false, "Compress the dump with gzip.")
+	dumpLabel          = flag.String("label", "", "Only dump the quads with this label.")
+	dumpPattern        = flag.String("pattern", "", `Only dump the quads matching this JSON quad pattern, such as {"predicate": "follows"}.`)
+	benchSize          = flag.Int("bench_size", 100000, "Number of synthetic quads to benchmark an empty database with.")
+	benchRuns          = flag.Int("bench_runs", 100, "Number of times to run each benchmark query.")
+	migrateDB          = flag.String("to_db", "", "Database backend to migrate to.")
+	migrateDBPath      = flag.String("to_dbpath", "", "Path to the database to migrate to.")
+	migrateConfig      = flag.String("to_config", "", "Configuration file of the database to migrate to, for its db_options.")
+	migrateCheckpoint  = flag.String("checkpoint", "", "File recording the progress of a migration, to resume it from if interrupted.")
+	backupFile         = flag.String("backup", "", "Backup file to write, or to restore from. Backups are written to standard output by default.")
 	cpuprofile         = flag.String("prof", "", "Output profiling file.")
 	queryLanguage      = flag.String("query_lang", "gremlin", "Use this parser as the query language.")
+	queryScript        = flag.String("script", "", "File holding the query to run; the query argument, or standard input by default.")
 	configFile         = flag.String("config", "", "Path to an explicit configuration file.")
 	databasePath       = flag.String("dbpath", "/tmp/testdb", "Path to the database.")
 	databaseBackend    = flag.String("db", "memstore", "Database Backend.")
 	replicationBackend = flag.String("replication", "single", "Replication method.")
 	host               = flag.String("host", "127.0.0.1", "Host to listen on (defaults to all).")
 	loadSize           = flag.Int("load_size", 10000, "Size of quadsets to load")
+	loadWorkers        = flag.Int("load_workers", 1, "Number of quadsets to queue for the writer while loading, so that parsing runs alongside writing")
+	loadProgress       = flag.Duration("load_progress", internal.ProgressInterval, "How often to log the progress of loads; 0 for only a summary at the end.")
+	loadAuthor         = flag.String("load_author", "", "Record this author and the source file as the provenance of loaded quads.")
+	loadDedupe         = flag.Bool("load_dedupe", false, "Skip the loaded quads the database already holds.")
 	port               = flag.String("port", "64210", "Port to listen on.")
 	readOnly           = flag.Bool("read_only", false, "Disable writing via HTTP.")
 	timeout            = flag.Duration("timeout", 30*time.Second, "Elapsed time until an individual query times out.")
+	tracer             = flag.String("tracer", "", "Tracer to send the spans of requests to, such as \"log\"; none by default.")
+	logFormat          = flag.String("log_format", "glog", `Format of the log ("glog" or "json").`)
+	debugEndpoints     = flag.Bool("debug_endpoints", false, "Serve profiles and running queries under /debug.")
+	queryMemoryBudget  = flag.Int("query_memory_budget_mb", 0, "MiB of results all running queries may hold; no limit by default.")
+	queryMemoryQuota   = flag.Int("query_memory_quota_mb", 0, "MiB of results a single query may hold; no limit by default.")
+	queryMaxDepth      = flag.Int("query_max_depth", 0, "Deepest iterator tree a query may build; no limit by default.")
+	queryMaxExpansion  = flag.Int("query_max_expansion", 0, "Most steps a query may expand to as it follows morphisms; no limit by default.")
+	queryMaxInter      = flag.Int("query_max_intermediate", 0, "Most intermediate values a query may hold; no limit by default.")
 )
 
+// configOverrides are the configuration keys set with --set, which override
+// all other sources.
+var configOverrides config.Overrides
+
+// givenFlags are the flags given on the command line, rather than set since.
+var givenFlags = make(map[string]bool)
+
+// configFlags maps the flags that set a configuration key to the key. Flags
+// given on the command line override the file and the environment, and the
+// defaults of the others fill in the keys still unset.
+var configFlags = map[string]string{
+	"dbpath":                 "db_path",
+	"db":                     "database",
+	"replication":            "replication",
+	"host":                   "listen_host",
+	"port":                   "listen_port",
+	"timeout":                "timeout",
+	"load_size":              "load_size",
+	"load_workers":           "load_workers",
+	"load_author":            "load_author",
+	"load_dedupe":            "load_dedupe",
+	"tracer":                 "tracer",
+	"log_format":             "log_format",
+	"v":                      "log_verbosity",
+	"read_only":              "read_only",
+	"debug_endpoints":        "debug_endpoints",
+	"query_memory_budget_mb": "query_memory_budget_mb",
+	"query_memory_quota_mb":  "query_memory_quota_mb",
+	"query_max_depth":        "query_max_depth",
+	"query_max_expansion":    "query_max_expansion",
+	"query_max_intermediate": "query_max_intermediate",
+}
+
+// services are served alongside the HTTP endpoint by the http command, until
+// they fail. Files built with optional features add to them.
+var services []func(*graph.Handle, *config.Config) error
+
 // Filled in by `go build ldflags="-X main.Version `ver`"`.
 var (
 	BuildDate string
@@ -70,9 +164,40 @@ Usage:
 
 Commands:
   init      Create an empty database.
-  load      Bulk-load a quad file into the database.
-  http      Serve an HTTP endpoint on the given host and port.
+  load      Bulk-load quad files, directories or glob patterns, given by
+            --quads or as arguments, into the database.
+  http      Serve an HTTP endpoint on the given host and port, until
+            interrupted or terminated, in the background with --daemon.
   repl      Drop into a REPL of the given query language.
+  query     Run a query, given as an argument, by --script or on standard
+            input, and write its results to standard output as JSON lines.
+  backup    Write a consistent copy of the database to a backup file.
+  restore   Load a backup file into an empty database.
+  extract   Write the quads within some hops of seed nodes to standard output.
+  dump      Write the quads of the database, or those matching a label or
+            pattern, to a file in any format.
+  export    Write the quads a query, given as an argument, by --script or on
+            standard input, matches to a file in any format, as dump does.
+  rename_predicate
+            Rewrite the quads with one predicate to use another, in batches.
+  diff      Write the quads added and removed between two quad files, or a
+            quad file and the database, to standard output as a patch.
+  apply_patch
+            Apply a patch written by diff to the database.
+  purge     Permanently remove the quads deleted before the retention window.
+  gc        Remove the values of nodes no quad references any more.
+  compact   Purge the quads deleted before the retention window, rewrite
+            the node values and reclaim the space they took up on disk.
+  verify    Check the indexes of the database against its quads, rebuilding
+            the damaged ones if --repair is given.
+  dedupe    Find the quads the database holds more than once, and keep one
+            copy of each, or only count them with --dry_run.
+  stats     Print the number of quads, of nodes and of quads of each
+            predicate, the size on disk and the horizon of the database.
+  migrate   Copy the quads of the database into another, such as of another
+            backend, resuming from a checkpoint if given.
+  bench     Load a quad file, or synthetic quads into an empty database, and
+            print the latency of a standard suite of queries.
   version   Version information.
 
 Flags:`)
@@ -81,13 +206,25 @@ Flags:`)
 
 func init() {
 	flag.Usage = usage
+	flag.StringVar(queryLanguage, "lang", "gremlin", "Same as --query_lang.")
+	flag.Var(&configOverrides, "set", `Set a configuration key, as in --set=db_path=/var/cayley or --set=db_options.cache_size_mb=64; may be repeated.`)
 }
 
 func configFrom(file string) *config.Config {
+	cfg, err := loadConfig(file)
+	if err != nil {
+		clog.Fatalln(err)
+	}
+	return cfg
+}
+
+// loadConfig reads the configuration from the file, the environment and the
+// flags, in order of increasing precedence.
+func loadConfig(file string) (*config.Config, error) {
 	// Find the file...
 	if file != "" {
 		if _, err := os.Stat(file); os.IsNotExist(err) {
-			glog.Fatalln("Cannot find specified configuration file", file, ", aborting.")
+			return nil, fmt.Errorf("cannot find specified configuration file %s", file)
 		}
 	} else if _, err := os.Stat(os.Getenv("CAYLEY_CFG")); err == nil {
 		file = os.Getenv("CAYLEY_CFG")
@@ -95,11 +232,27 @@ func configFrom(file string) *config.Config {
 		file = "/etc/cayley.cfg"
 	}
 	if file == "" {
-		glog.Infoln("Couldn't find a config file in either $CAYLEY_CFG or /etc/cayley.cfg. Going by flag defaults only.")
+		clog.Infoln("Couldn't find a config file in either $CAYLEY_CFG or /etc/cayley.cfg. Going by flag defaults only.")
 	}
 	cfg, err := config.Load(file)
 	if err != nil {
-		glog.Fatalln(err)
+		return nil, err
+	}
+	err = cfg.LoadEnv(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	for name := range givenFlags {
+		if key, ok := configFlags[name]; ok {
+			err = cfg.Set(key, flag.Lookup(name).Value.String())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = configOverrides.Apply(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	if cfg.DatabasePath == "" {
@@ -130,9 +283,117 @@ func configFrom(file string) *config.Config {
 		cfg.LoadSize = *loadSize
 	}
 
+	if cfg.LoadWorkers == 0 {
+		cfg.LoadWorkers = *loadWorkers
+	}
+
+	if cfg.LoadAuthor == "" {
+		cfg.LoadAuthor = *loadAuthor
+	}
+
+	if !cfg.LoadDedupe {
+		cfg.LoadDedupe = *loadDedupe
+	}
+
+	if cfg.Tracer == "" {
+		cfg.Tracer = *tracer
+	}
+
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = *logFormat
+	}
+
+	if cfg.QueryMemoryBudgetMB == 0 {
+		cfg.QueryMemoryBudgetMB = *queryMemoryBudget
+	}
+
+	if cfg.QueryMemoryQuotaMB == 0 {
+		cfg.QueryMemoryQuotaMB = *queryMemoryQuota
+	}
+
+	if cfg.QueryMaxDepth == 0 {
+		cfg.QueryMaxDepth = *queryMaxDepth
+	}
+
+	if cfg.QueryMaxExpansion == 0 {
+		cfg.QueryMaxExpansion = *queryMaxExpansion
+	}
+
+	if cfg.QueryMaxIntermediate == 0 {
+		cfg.QueryMaxIntermediate = *queryMaxInter
+	}
+
 	cfg.ReadOnly = cfg.ReadOnly || *readOnly
+	cfg.DebugEndpoints = cfg.DebugEndpoints || *debugEndpoints
 
-	return cfg
+	return cfg, nil
+}
+
+// setLogging sets the verbosity and format of the log.
+func setLogging(cfg *config.Config) error {
+	err := flag.Set("v", strconv.Itoa(cfg.LogVerbosity))
+	if err != nil {
+		return err
+	}
+	return setLogFormat(cfg.LogFormat)
+}
+
+// guardsOf returns the guards of queries set by cfg.
+func guardsOf(cfg *config.Config) iterator.Guards {
+	return iterator.Guards{
+		MaxDepth:        cfg.QueryMaxDepth,
+		MaxExpansion:    cfg.QueryMaxExpansion,
+		MaxIntermediate: cfg.QueryMaxIntermediate,
+	}
+}
+
+// reload rereads the configuration, and applies the keys that can be changed
+// while the server runs.
+func reload(api *http.API) error {
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	err = setLogging(cfg)
+	if err != nil {
+		return err
+	}
+	memory.SetLimits(int64(cfg.QueryMemoryBudgetMB)<<20, int64(cfg.QueryMemoryQuotaMB)<<20)
+	iterator.SetGuards(guardsOf(cfg))
+	err = api.Reload(cfg)
+	if err != nil {
+		return err
+	}
+	clog.Infoln("Reloaded the configuration")
+	return nil
+}
+
+// reloadOnHangup reloads the configuration whenever the process receives
+// SIGHUP.
+func reloadOnHangup(api *http.API) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		if err := reload(api); err != nil {
+			clog.Errorf("could not reload the configuration: %v", err)
+		}
+	}
+}
+
+// setLogFormat sets the format of the log: "glog", which is configured by
+// the glog flags, or "json", which writes JSON objects to standard error, and
+// leaves out messages more verbose than the -v flag.
+func setLogFormat(format string) error {
+	switch format {
+	case "glog":
+		clog.SetLogger(nil)
+	case "json":
+		v, _ := strconv.Atoi(flag.Lookup("v").Value.String())
+		clog.SetLogger(clog.NewJSONLogger(os.Stderr, v))
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
 }
 
 func main() {
@@ -146,20 +407,42 @@ func main() {
 	cmd := os.Args[1]
 	os.Args = append(os.Args[:1], os.Args[2:]...)
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		givenFlags[f.Name] = true
+	})
 
 	var buildString string
 	if Version != "" {
 		buildString = fmt.Sprint("Cayley ", Version, " built ", BuildDate)
-		glog.Infoln(buildString)
+		clog.Infoln(buildString)
 	}
 
+	internal.ProgressInterval = *loadProgress
+
+	if err := setLogFormat(*logFormat); err != nil {
+		clog.Fatalln(err)
+	}
 	cfg := configFrom(*configFile)
+	if err := setLogging(cfg); err != nil {
+		clog.Fatalln(err)
+	}
+	if cfg.Tracer != "" {
+		if err := trace.Open(cfg.Tracer, cfg.TracerOptions); err != nil {
+			clog.Fatalln(err)
+		}
+	}
+	if _, err := auth.New(cfg); err != nil {
+		clog.Fatalln(err)
+	}
+
+	memory.SetLimits(int64(cfg.QueryMemoryBudgetMB)<<20, int64(cfg.QueryMemoryQuotaMB)<<20)
+	iterator.SetGuards(guardsOf(cfg))
 
 	if os.Getenv("GOMAXPROCS") == "" {
 		runtime.GOMAXPROCS(runtime.NumCPU())
-		glog.Infoln("Setting GOMAXPROCS to", runtime.NumCPU())
+		clog.Infoln("Setting GOMAXPROCS to", runtime.NumCPU())
 	} else {
-		glog.Infoln("GOMAXPROCS currently", os.Getenv("GOMAXPROCS"), " -- not adjusting")
+		clog.Infoln("GOMAXPROCS currently", os.Getenv("GOMAXPROCS"), " -- not adjusting")
 	}
 
 	var (
@@ -185,7 +468,7 @@ func main() {
 			if err != nil {
 				break
 			}
-			err = internal.Load(handle.QuadWriter, cfg, *quadFile, *quadType)
+			err = loadAll(handle, cfg, quadPaths(nil))
 			if err != nil {
 				break
 			}
@@ -197,11 +480,237 @@ func main() {
 		if err != nil {
 			break
 		}
-		err = internal.Load(handle.QuadWriter, cfg, *quadFile, *quadType)
+		paths := quadPaths(flag.Args())
+		if len(paths) == 0 {
+			err = errors.New("no quad files to load")
+			handle.Close()
+			break
+		}
+		err = loadAll(handle, cfg, paths)
+		if err != nil {
+			break
+		}
+
+		handle.Close()
+
+	case "backup":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		err = backup(handle, *backupFile)
+		handle.Close()
+
+	case "restore":
+		if *backupFile == "" {
+			err = errors.New("no backup file to restore from")
+			break
+		}
+		if !graph.IsPersistent(cfg.DatabaseType) {
+			err = db.ErrNotPersistent
+			break
+		}
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		err = restore(handle, cfg, *backupFile)
+		handle.Close()
+
+	case "extract":
+		if *extractSeeds == "" {
+			err = errors.New("no seeds to extract a subgraph around")
+			break
+		}
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		var via []string
+		if *extractVia != "" {
+			via = strings.Split(*extractVia, ",")
+		}
+		var quads []quad.Quad
+		quads, err = handle.ExtractSubgraph(strings.Split(*extractSeeds, ","), via, *extractDepth)
+		if err == nil {
+			err = db.WriteQuads(os.Stdout, quads)
+		}
+		handle.Close()
+
+	case "dump":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		err = dump(handle, *dumpFile, *dumpLabel, *dumpPattern)
+		handle.Close()
+
+	case "export":
+		var code string
+		code, err = queryText(*queryScript, flag.Args())
+		if err != nil {
+			break
+		}
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		if !graph.IsPersistent(cfg.DatabaseType) {
+			err = internal.LoadAll(handle.QuadWriter, cfg, quadPaths(nil), quadFormat())
+			if err != nil {
+				break
+			}
+		}
+		err = export(handle, cfg, code, *dumpFile)
+		handle.Close()
+
+	case "rename_predicate":
+		if *renameFrom == "" || *renameTo == "" {
+			err = errors.New("both the predicate to rename and its new name are required")
+			break
+		}
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		var n int
+		n, err = graph.RenamePredicate(handle.QuadStore, handle.QuadWriter, *renameFrom, *renameTo, cfg.LoadSize, func(n int) {
+			clog.Infof("Rewrote %d quads", n)
+		})
+		if err == nil {
+			clog.Infof("Renamed predicate %q to %q in %d quads", *renameFrom, *renameTo, n)
+		}
+		handle.Close()
+
+	case "diff":
+		if *renameFrom == "" && *renameTo == "" {
+			err = errors.New("at least one quad file to diff is required")
+			break
+		}
+		err = diff(cfg, *renameFrom, *renameTo)
+
+	case "apply_patch":
+		if *patchFile == "" {
+			err = errors.New("no patch file to apply")
+			break
+		}
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		err = applyPatch(handle, *patchFile)
+		handle.Close()
+
+	case "purge":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		var n int
+		n, err = handle.Purge(*purgeRetention)
+		if err == nil {
+			clog.Infof("Purged %d deleted quads", n)
+		}
+		handle.Close()
+
+	case "gc":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		var stats graph.GCStats
+		stats, err = handle.CollectGarbage()
+		if err == nil {
+			clog.Infof("Collected %d unreferenced nodes, reclaiming %d bytes", stats.Nodes, stats.Bytes)
+		}
+		handle.Close()
+
+	case "compact":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		var stats graph.CompactStats
+		stats, err = handle.Compact(*purgeRetention)
+		if err == nil {
+			clog.Infof("Purged %d deleted quads and %d unreferenced nodes, recounted %d nodes, from %d to %d bytes",
+				stats.Quads, stats.Nodes, stats.Values, stats.Before, stats.After)
+		}
+		handle.Close()
+
+	case "verify":
+		handle, err = db.Open(cfg)
 		if err != nil {
 			break
 		}
+		err = verify(handle, *verifyRepair)
+		handle.Close()
 
+	case "dedupe":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		err = dedupe(handle, *dedupeDryRun)
+		handle.Close()
+
+	case "stats":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		if !graph.IsPersistent(cfg.DatabaseType) {
+			err = internal.LoadAll(handle.QuadWriter, cfg, quadPaths(nil), quadFormat())
+			if err != nil {
+				break
+			}
+		}
+		err = stats(handle, cfg, *statsSample)
+		handle.Close()
+
+	case "migrate":
+		if *migrateDB == "" && *migrateConfig == "" {
+			err = errors.New("no database to migrate to")
+			break
+		}
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		if !graph.IsPersistent(cfg.DatabaseType) {
+			err = internal.LoadAll(handle.QuadWriter, cfg, quadPaths(nil), quadFormat())
+			if err != nil {
+				break
+			}
+		}
+		err = migrate(handle, cfg)
+		handle.Close()
+
+	case "bench":
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		err = bench(handle, cfg)
+		handle.Close()
+
+	case "query":
+		var code string
+		code, err = queryText(*queryScript, flag.Args())
+		if err != nil {
+			break
+		}
+		handle, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		if !graph.IsPersistent(cfg.DatabaseType) {
+			err = internal.LoadAll(handle.QuadWriter, cfg, quadPaths(nil), quadFormat())
+			if err != nil {
+				break
+			}
+		}
+		_, err = db.RunQuery(handle, *queryLanguage, code, cfg, os.Stdout)
 		handle.Close()
 
 	case "repl":
@@ -210,7 +719,7 @@ func main() {
 			break
 		}
 		if !graph.IsPersistent(cfg.DatabaseType) {
-			err = internal.Load(handle.QuadWriter, cfg, "", *quadType)
+			err = internal.LoadAll(handle.QuadWriter, cfg, nil, quadFormat())
 			if err != nil {
 				break
 			}
@@ -221,26 +730,395 @@ func main() {
 		handle.Close()
 
 	case "http":
+		if *runDaemon {
+			err = startDaemon()
+			break
+		}
 		handle, err = db.Open(cfg)
 		if err != nil {
 			break
 		}
 		if !graph.IsPersistent(cfg.DatabaseType) {
-			err = internal.Load(handle.QuadWriter, cfg, "", *quadType)
+			err = internal.LoadAll(handle.QuadWriter, cfg, nil, quadFormat())
 			if err != nil {
 				break
 			}
 		}
 
-		http.Serve(handle, cfg)
-
+		if *pidFile != "" {
+			err = writePidfile(*pidFile)
+			if err != nil {
+				handle.Close()
+				break
+			}
+		}
+		err = serveHTTP(handle, cfg)
 		handle.Close()
+		if *pidFile != "" {
+			os.Remove(*pidFile)
+		}
 
 	default:
 		fmt.Println("No command", cmd)
 		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		clog.Errorln(err)
+		clog.Flush()
+		os.Exit(1)
+	}
+	clog.Flush()
+}
+
+// queryText returns the query to run: the arguments, the content of the
+// script file, or standard input, in that order.
+func queryText(script string, args []string) (string, error) {
+	if len(args) > 0 {
+		return strings.Join(args, " "), nil
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if script != "" {
+		b, err = ioutil.ReadFile(script)
+	} else {
+		b, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return "", errors.New("no query to run")
+	}
+	return string(b), nil
+}
+
+func verify(h *graph.Handle, repair bool) error {
+	rep, err := h.Verify(repair)
+	if err != nil {
+		return err
+	}
+	for _, p := range rep.Problems {
+		clog.Warningf("%s", p)
+	}
+	clog.Infof("Verified %d quads: %d problems, %d repaired", rep.Quads, len(rep.Problems), rep.Repaired)
+	if rep.Repaired < len(rep.Problems) {
+		return fmt.Errorf("%d problems were not repaired", len(rep.Problems)-rep.Repaired)
+	}
+	return nil
+}
+
+// loadAll loads the quad files into the database, skipping the quads it
+// already holds if cfg.LoadDedupe is set.
+func loadAll(h *graph.Handle, cfg *config.Config, paths []string) error {
+	if !cfg.LoadDedupe {
+		return internal.LoadAll(h.QuadWriter, cfg, paths, quadFormat())
+	}
+	w, err := db.Deduplicating(h.QuadStore, h.QuadWriter, cfg.LoadSize)
+	if err != nil {
+		return err
+	}
+	err = internal.LoadAll(w, cfg, paths, quadFormat())
+	clog.Infof("Skipped %d quads already in the database", w.Skipped())
+	return err
+}
+
+func dedupe(h *graph.Handle, dryRun bool) error {
+	rep, err := h.Dedupe(dryRun)
+	if err != nil {
+		return err
+	}
+	clog.Infof("Read %d quads: %d held more than once, with %d extra copies, %d removed", rep.Quads, rep.Duplicated, rep.Copies, rep.Removed)
+	return nil
+}
+
+func stats(h *graph.Handle, cfg *config.Config, sample int64) error {
+	st, err := db.Stats(h, cfg, sample)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", b)
+	return nil
+}
+
+func backup(h *graph.Handle, path string) error {
+	w := os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	horizon, n, err := db.Backup(h.QuadStore, w)
+	if err != nil {
+		return err
+	}
+	clog.Infof("Backed up %d quads at horizon %d", n, horizon)
+	return nil
+}
+
+// dump writes the quads of the database matching the label and JSON pattern
+// to path, in the format of the --format flag, or of the extension of path
+// if the flag is not given.
+func dump(h *graph.Handle, path, label, pattern string) error {
+	var p quad.Quad
+	if pattern != "" {
+		if err := json.Unmarshal([]byte(pattern), &p); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+	if label != "" {
+		p.Label = label
+	}
+	n, format, err := dumpTo(path, func(w quad.Writer) (int, error) {
+		return db.Dump(h.QuadStore, w, p)
+	})
+	if err != nil {
+		return err
+	}
+	clog.Infof("Dumped %d quads as %s", n, format)
+	return nil
+}
+
+// export writes the subgraph the query matches to the file at path, as dump
+// writes the database.
+func export(h *graph.Handle, cfg *config.Config, code, path string) error {
+	n, format, err := dumpTo(path, func(w quad.Writer) (int, error) {
+		return db.Export(h.QuadStore, *queryLanguage, code, cfg, w)
+	})
+	if err != nil {
+		return err
+	}
+	clog.Infof("Exported %d quads as %s", n, format)
+	return nil
+}
+
+// dumpTo calls write with a writer of quads to the file at path, or standard
+// output if it is empty, in the format of --format or else of its extension,
+// compressed if --compress is given or it ends in ".gz". It returns the
+// number of quads written and the name of the format.
+func dumpTo(path string, write func(quad.Writer) (int, error)) (int, string, error) {
+	format := quad.FormatByName(*quadType)
+	compress := *dumpCompress || strings.HasSuffix(path, ".gz")
+	if !flagSet("format") {
+		if f := quad.FormatByExt(filepath.Ext(strings.TrimSuffix(path, ".gz"))); f != nil {
+			format = f
+		}
+	}
+	if format == nil || format.Writer == nil {
+		return 0, "", fmt.Errorf("unknown quad format %q", *quadType)
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return 0, "", err
+		}
+		defer f.Close()
+		w = f
+	}
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	n, err := write(format.Writer(w))
+	if gz != nil {
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return n, format.Name, err
+}
+
+// migrate copies the quads of h into the database given by the --to_config,
+// --to_db and --to_dbpath flags.
+func migrate(h *graph.Handle, cfg *config.Config) error {
+	to := *cfg
+	if *migrateConfig != "" {
+		c, err := config.Load(*migrateConfig)
+		if err != nil {
+			return err
+		}
+		to = *c
+	} else {
+		// The options of the source do not apply to another backend.
+		to.DatabaseOptions = nil
+	}
+	if *migrateDB != "" {
+		to.DatabaseType = *migrateDB
+	}
+	if *migrateDBPath != "" {
+		to.DatabasePath = *migrateDBPath
+	}
+	qs, err := db.OpenQuadStore(&to)
+	if err != nil {
+		return err
+	}
+	defer qs.Close()
+	start := time.Now()
+	n, err := db.Migrate(h.QuadStore, qs, db.Migration{
+		BatchSize:  cfg.LoadSize,
+		Workers:    cfg.LoadWorkers,
+		Checkpoint: *migrateCheckpoint,
+		Progress: func(done, total int64) {
+			clog.Infof("Migrated %d of %d quads", done, total)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	d := time.Since(start)
+	clog.Infof("Migrated %d quads to %s in %v (%.0f quads/s)", n, to.DatabaseType, d, float64(n)/d.Seconds())
+	return nil
+}
+
+// quadPaths returns the quad files, directories and patterns given by the
+// comma-separated --quads flag, followed by args.
+func quadPaths(args []string) []string {
+	var paths []string
+	for _, p := range strings.Split(*quadFile, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return append(paths, args...)
+}
+
+// quadFormat returns the format of the quad files to load, or "" for the
+// format of each file to be told by its name, if --format is not given.
+func quadFormat() string {
+	if flagSet("format") {
+		return *quadType
+	}
+	return ""
+}
+
+// bench loads the quad file, or synthetic quads if it is not given and the
+// database is empty, then runs the benchmark queries and prints their
+// latencies.
+func bench(h *graph.Handle, cfg *config.Config) error {
+	start := time.Now()
+	before := h.QuadStore.Size()
+	switch {
+	case *quadFile != "":
+		if err := internal.LoadAll(h.QuadWriter, cfg, quadPaths(nil), quadFormat()); err != nil {
+			return err
+		}
+	case before == 0:
+		quads := db.SyntheticQuads(*benchSize)
+		for len(quads) > 0 {
+			n := cfg.LoadSize
+			if n > len(quads) {
+				n = len(quads)
+			}
+			if err := h.QuadWriter.AddQuadSet(quads[:n]); err != nil {
+				return err
+			}
+			quads = quads[n:]
+		}
+	}
+	if n := h.QuadStore.Size() - before; n > 0 {
+		d := time.Since(start)
+		fmt.Printf("Loaded %d quads in %v (%.0f quads/s)\n", n, d, float64(n)/d.Seconds())
+	}
+	results, err := db.Bench(h.QuadStore, db.BenchQueries, *benchRuns, cfg.Timeout)
+	for _, r := range results {
+		fmt.Println(r)
+	}
+	return err
+}
+
+// flagSet returns whether the flag was given on the command line.
+func flagSet(name string) bool {
+	return givenFlags[name]
+}
+
+func restore(h *graph.Handle, cfg *config.Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := internal.Decompressor(f)
+	if err != nil {
+		return err
+	}
+	err = db.Restore(h, cfg, r)
+	if err != nil {
+		return err
+	}
+	clog.Infof("Restored %d quads", h.QuadStore.Size())
+	return nil
+}
+
+// openDiffSide opens the database, or a memstore loaded with the quad file
+// at path if path is not empty.
+func openDiffSide(cfg *config.Config, path string) (*graph.Handle, error) {
+	if path == "" {
+		return db.Open(cfg)
+	}
+	mem := *cfg
+	mem.DatabaseType = "memstore"
+	mem.DatabasePath = ""
+	mem.ReplicationType = "single"
+	h, err := db.Open(&mem)
+	if err != nil {
+		return nil, err
+	}
+	err = internal.LoadAll(h.QuadWriter, &mem, []string{path}, quadFormat())
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func diff(cfg *config.Config, from, to string) error {
+	a, err := openDiffSide(cfg, from)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := openDiffSide(cfg, to)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	tx, err := db.Diff(a.QuadStore, b.QuadStore)
+	if err != nil {
+		return err
+	}
+	return db.WritePatch(os.Stdout, tx)
+}
+
+func applyPatch(h *graph.Handle, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := internal.Decompressor(f)
+	if err != nil {
+		return err
+	}
+	tx, err := db.ReadPatch(r)
+	if err != nil {
+		return err
 	}
+	err = h.QuadWriter.ApplyTransaction(tx)
 	if err != nil {
-		glog.Errorln(err)
+		return err
 	}
+	clog.Infof("Applied %d changes", len(tx.Deltas))
+	return nil
 }
@@ -0,0 +1,88 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !appengine
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/http"
+)
+
+// serveHTTP serves the database over HTTP, and the other services, until the
+// process is interrupted or terminated, then finishes the requests being
+// served and returns nil; a second signal exits at once. SIGHUP reloads the
+// configuration, and SIGUSR1 logs the queries being run.
+func serveHTTP(h *graph.Handle, cfg *config.Config) error {
+	for _, serve := range services {
+		go func(serve func(*graph.Handle, *config.Config) error) {
+			if err := serve(h, cfg); err != nil {
+				clog.Errorln(err)
+			}
+		}(serve)
+	}
+	api := http.SetupRoutes(h, cfg)
+	api.SetReloader(func() error { return reload(api) })
+	go reloadOnHangup(api)
+	go logQueriesOnSignal(api)
+
+	stop := make(chan struct{})
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		clog.Infof("Received %v, shutting down", <-c)
+		close(stop)
+		clog.Errorf("Received %v again, exiting at once", <-c)
+		clog.Flush()
+		os.Exit(1)
+	}()
+	return http.ListenAndServeUntil(cfg, stop)
+}
+
+// writePidfile writes the ID of the process to the file at path, unless it
+// holds the ID of another process still running.
+func writePidfile(path string) error {
+	if b, err := ioutil.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("cayley is already running as process %d, according to %s", pid, path)
+		}
+	}
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// daemonArgs returns the arguments to run the daemon with: those given, but
+// for --daemon.
+func daemonArgs(args []string) []string {
+	var out []string
+	for _, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(arg, "-") && (name == "daemon" || strings.HasPrefix(name, "daemon=")) {
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !appengine,!windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/http"
+)
+
+// daemonStartup is how long startDaemon waits for the daemon to fail, such
+// as on a port in use, before taking it to be running.
+const daemonStartup = time.Second
+
+// startDaemon runs the http command again in a session of its own, detached
+// from the terminal, and returns once it has started. Its output is discarded,
+// so it logs only to the log files.
+func startDaemon() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, append([]string{"http"}, daemonArgs(os.Args[1:])...)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		if err == nil {
+			err = fmt.Errorf("exited at once")
+		}
+		return fmt.Errorf("daemon failed to start: %v", err)
+	case <-time.After(daemonStartup):
+	}
+	fmt.Printf("Cayley started as process %d\n", cmd.Process.Pid)
+	return nil
+}
+
+// processRunning returns whether a process with the given ID is running.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// logQueriesOnSignal logs the queries being run whenever the process
+// receives SIGUSR1.
+func logQueriesOnSignal(api *http.API) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	for range c {
+		var buf bytes.Buffer
+		api.WriteQueries(&buf)
+		clog.Infof("Running queries: %s", buf.Bytes())
+	}
+}
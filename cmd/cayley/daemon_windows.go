@@ -0,0 +1,37 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !appengine
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/google/cayley/http"
+)
+
+func startDaemon() error {
+	return errors.New("--daemon is not supported on Windows; run cayley as a service instead")
+}
+
+// processRunning returns whether a process with the given ID is running.
+func processRunning(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
+
+// logQueriesOnSignal does nothing, as Windows has no SIGUSR1.
+func logQueriesOnSignal(api *http.API) {}
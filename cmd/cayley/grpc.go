@@ -0,0 +1,42 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build grpc,!appengine
+
+package main
+
+import (
+	"flag"
+	"net"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/rpc"
+)
+
+var grpcPort = flag.String("grpc_port", "", "Port to serve the gRPC API on alongside HTTP, if any.")
+
+func init() {
+	configFlags["grpc_port"] = "grpc_port"
+	services = append(services, func(h *graph.Handle, cfg *config.Config) error {
+		port := cfg.GRPCPort
+		if port == "" {
+			port = *grpcPort
+		}
+		if port == "" {
+			return nil
+		}
+		return rpc.Serve(h, cfg, net.JoinHostPort(cfg.ListenHost, port))
+	})
+}
@@ -31,12 +31,44 @@ type Config struct {
 	ReplicationOptions         map[string]interface{}
 	ListenHost                 string
 	ListenPort                 string
+	GRPCPort                   string
+	GremlinServerPort          string
 	ReadOnly                   bool
 	Timeout                    time.Duration
 	LoadSize                   int
+	LoadWorkers                int
+	LoadAuthor                 string
+	LoadDedupe                 bool
+	Tracer                     string
+	TracerOptions              map[string]interface{}
+	LogFormat                  string
+	LogVerbosity               int
+	DebugEndpoints             bool
+	DebugToken                 string
+	Credentials                []Credential
+	AnonymousRole              string
+	JWTIssuer                  string
+	JWTAudience                string
+	JWTKeysURL                 string
+	JWTRoleClaim               string
+	JWTRoles                   map[string]interface{}
+	QueryMemoryBudgetMB        int
+	QueryMemoryQuotaMB         int
+	QueryMaxDepth              int
+	QueryMaxExpansion          int
+	QueryMaxIntermediate       int
 	RequiresHTTPRequestContext bool
 }
 
+// Credential grants a role to the clients of the HTTP and gRPC APIs that
+// present it: either a bearer token, or a user name and password.
+type Credential struct {
+	Token    string `json:"token,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role"`
+}
+
 type config struct {
 	DatabaseType               string                 `json:"database"`
 	DatabasePath               string                 `json:"db_path"`
@@ -45,9 +77,32 @@ type config struct {
 	ReplicationOptions         map[string]interface{} `json:"replication_options"`
 	ListenHost                 string                 `json:"listen_host"`
 	ListenPort                 string                 `json:"listen_port"`
+	GRPCPort                   string                 `json:"grpc_port"`
+	GremlinServerPort          string                 `json:"gremlin_server_port"`
 	ReadOnly                   bool                   `json:"read_only"`
 	Timeout                    duration               `json:"timeout"`
 	LoadSize                   int                    `json:"load_size"`
+	LoadWorkers                int                    `json:"load_workers"`
+	LoadAuthor                 string                 `json:"load_author"`
+	LoadDedupe                 bool                   `json:"load_dedupe"`
+	Tracer                     string                 `json:"tracer"`
+	TracerOptions              map[string]interface{} `json:"tracer_options"`
+	LogFormat                  string                 `json:"log_format"`
+	LogVerbosity               int                    `json:"log_verbosity"`
+	DebugEndpoints             bool                   `json:"debug_endpoints"`
+	DebugToken                 string                 `json:"debug_token"`
+	Credentials                []Credential           `json:"credentials"`
+	AnonymousRole              string                 `json:"anonymous_role"`
+	JWTIssuer                  string                 `json:"jwt_issuer"`
+	JWTAudience                string                 `json:"jwt_audience"`
+	JWTKeysURL                 string                 `json:"jwt_jwks_url"`
+	JWTRoleClaim               string                 `json:"jwt_role_claim"`
+	JWTRoles                   map[string]interface{} `json:"jwt_roles"`
+	QueryMemoryBudgetMB        int                    `json:"query_memory_budget_mb"`
+	QueryMemoryQuotaMB         int                    `json:"query_memory_quota_mb"`
+	QueryMaxDepth              int                    `json:"query_max_depth"`
+	QueryMaxExpansion          int                    `json:"query_max_expansion"`
+	QueryMaxIntermediate       int                    `json:"query_max_intermediate"`
 	RequiresHTTPRequestContext bool                   `json:"http_request_context"`
 }
 
@@ -65,9 +120,32 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		ReplicationOptions:         t.ReplicationOptions,
 		ListenHost:                 t.ListenHost,
 		ListenPort:                 t.ListenPort,
+		GRPCPort:                   t.GRPCPort,
+		GremlinServerPort:          t.GremlinServerPort,
 		ReadOnly:                   t.ReadOnly,
 		Timeout:                    time.Duration(t.Timeout),
 		LoadSize:                   t.LoadSize,
+		LoadWorkers:                t.LoadWorkers,
+		LoadAuthor:                 t.LoadAuthor,
+		LoadDedupe:                 t.LoadDedupe,
+		Tracer:                     t.Tracer,
+		TracerOptions:              t.TracerOptions,
+		LogFormat:                  t.LogFormat,
+		LogVerbosity:               t.LogVerbosity,
+		DebugEndpoints:             t.DebugEndpoints,
+		DebugToken:                 t.DebugToken,
+		Credentials:                t.Credentials,
+		AnonymousRole:              t.AnonymousRole,
+		JWTIssuer:                  t.JWTIssuer,
+		JWTAudience:                t.JWTAudience,
+		JWTKeysURL:                 t.JWTKeysURL,
+		JWTRoleClaim:               t.JWTRoleClaim,
+		JWTRoles:                   t.JWTRoles,
+		QueryMemoryBudgetMB:        t.QueryMemoryBudgetMB,
+		QueryMemoryQuotaMB:         t.QueryMemoryQuotaMB,
+		QueryMaxDepth:              t.QueryMaxDepth,
+		QueryMaxExpansion:          t.QueryMaxExpansion,
+		QueryMaxIntermediate:       t.QueryMaxIntermediate,
 		RequiresHTTPRequestContext: t.RequiresHTTPRequestContext,
 	}
 	return nil
@@ -75,27 +153,68 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 
 func (c *Config) MarshalJSON() ([]byte, error) {
 	return json.Marshal(config{
-		DatabaseType:       c.DatabaseType,
-		DatabasePath:       c.DatabasePath,
-		DatabaseOptions:    c.DatabaseOptions,
-		ReplicationType:    c.ReplicationType,
-		ReplicationOptions: c.ReplicationOptions,
-		ListenHost:         c.ListenHost,
-		ListenPort:         c.ListenPort,
-		ReadOnly:           c.ReadOnly,
-		Timeout:            duration(c.Timeout),
-		LoadSize:           c.LoadSize,
+		DatabaseType:         c.DatabaseType,
+		DatabasePath:         c.DatabasePath,
+		DatabaseOptions:      c.DatabaseOptions,
+		ReplicationType:      c.ReplicationType,
+		ReplicationOptions:   c.ReplicationOptions,
+		ListenHost:           c.ListenHost,
+		ListenPort:           c.ListenPort,
+		GRPCPort:             c.GRPCPort,
+		GremlinServerPort:    c.GremlinServerPort,
+		ReadOnly:             c.ReadOnly,
+		Timeout:              duration(c.Timeout),
+		LoadSize:             c.LoadSize,
+		LoadWorkers:          c.LoadWorkers,
+		LoadAuthor:           c.LoadAuthor,
+		LoadDedupe:           c.LoadDedupe,
+		Tracer:               c.Tracer,
+		TracerOptions:        c.TracerOptions,
+		LogFormat:            c.LogFormat,
+		LogVerbosity:         c.LogVerbosity,
+		DebugEndpoints:       c.DebugEndpoints,
+		DebugToken:           c.DebugToken,
+		Credentials:          c.Credentials,
+		AnonymousRole:        c.AnonymousRole,
+		JWTIssuer:            c.JWTIssuer,
+		JWTAudience:          c.JWTAudience,
+		JWTKeysURL:           c.JWTKeysURL,
+		JWTRoleClaim:         c.JWTRoleClaim,
+		JWTRoles:             c.JWTRoles,
+		QueryMemoryBudgetMB:  c.QueryMemoryBudgetMB,
+		QueryMemoryQuotaMB:   c.QueryMemoryQuotaMB,
+		QueryMaxDepth:        c.QueryMaxDepth,
+		QueryMaxExpansion:    c.QueryMaxExpansion,
+		QueryMaxIntermediate: c.QueryMaxIntermediate,
 	})
 }
 
+// Reloaded returns a copy of c with the keys that can be changed while the
+// database is open taken from n: the timeout, load size, log format and
+// verbosity, and the memory limits and guards of queries. Options of the database that
+// can be changed are applied by the store, if it is a graph.Tuner.
+func (c *Config) Reloaded(n *Config) *Config {
+	r := *c
+	r.Timeout = n.Timeout
+	r.LoadSize = n.LoadSize
+	r.LogFormat = n.LogFormat
+	r.LogVerbosity = n.LogVerbosity
+	r.QueryMemoryBudgetMB = n.QueryMemoryBudgetMB
+	r.QueryMemoryQuotaMB = n.QueryMemoryQuotaMB
+	r.QueryMaxDepth = n.QueryMaxDepth
+	r.QueryMaxExpansion = n.QueryMaxExpansion
+	r.QueryMaxIntermediate = n.QueryMaxIntermediate
+	return &r
+}
+
 // duration is a time.Duration that satisfies the
 // json.UnMarshaler and json.Marshaler interfaces.
 type duration time.Duration
 
 // UnmarshalJSON unmarshals a duration according to the following scheme:
-//  * If the element is absent the duration is zero.
-//  * If the element is parsable as a time.Duration, the parsed value is kept.
-//  * If the element is parsable as a number, that number of seconds is kept.
+//   - If the element is absent the duration is zero.
+//   - If the element is parsable as a time.Duration, the parsed value is kept.
+//   - If the element is parsable as a number, that number of seconds is kept.
 func (d *duration) UnmarshalJSON(data []byte) error {
 	if len(data) == 0 {
 		*d = 0
@@ -0,0 +1,189 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the names of the environment variables that override
+// configuration keys. The rest of the name is the key in upper case, such as
+// CAYLEY_DB_PATH for db_path, and an option of a map key, such as
+// cache_size_mb of db_options, is set by CAYLEY_DB_OPTIONS_CACHE_SIZE_MB.
+const EnvPrefix = "CAYLEY_"
+
+// fields maps each configuration key to the name of its Config field.
+var fields = func() map[string]string {
+	m := make(map[string]string)
+	t := reflect.TypeOf(config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		m[f.Tag.Get("json")] = f.Name
+	}
+	return m
+}()
+
+// Keys returns the configuration keys, in order.
+func Keys() []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set sets the configuration key to the value given as text, as it would be
+// in a flag: numbers, booleans and durations are parsed, and maps and
+// credentials are given as JSON objects and arrays. A single option of a map
+// is set with a key such as "db_options.cache_size_mb", and its value is
+// parsed as JSON if it can be, or kept as a string otherwise.
+func (c *Config) Set(key, value string) error {
+	if i := strings.Index(key, "."); i >= 0 {
+		return c.setOption(key[:i], key[i+1:], value)
+	}
+	name, ok := fields[key]
+	if !ok {
+		return fmt.Errorf("unknown configuration key %q", key)
+	}
+	f := reflect.ValueOf(c).Elem().FieldByName(name)
+	switch p := f.Addr().Interface().(type) {
+	case *string:
+		*p = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+		}
+		*p = b
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+		}
+		*p = n
+	case *time.Duration:
+		var d duration
+		if err := d.UnmarshalJSON([]byte(value)); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+		}
+		*p = time.Duration(d)
+	case *map[string]interface{}:
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &m); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+		}
+		*p = m
+	case *[]Credential:
+		var l []Credential
+		if err := json.Unmarshal([]byte(value), &l); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+		}
+		*p = l
+	default:
+		return fmt.Errorf("configuration key %q cannot be set", key)
+	}
+	return nil
+}
+
+// setOption sets an option of the map with the given key.
+func (c *Config) setOption(key, option, value string) error {
+	name, ok := fields[key]
+	if !ok {
+		return fmt.Errorf("unknown configuration key %q", key)
+	}
+	p, ok := reflect.ValueOf(c).Elem().FieldByName(name).Addr().Interface().(*map[string]interface{})
+	if !ok || option == "" {
+		return fmt.Errorf("configuration key %q has no options", key)
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		v = value
+	}
+	if *p == nil {
+		*p = make(map[string]interface{})
+	}
+	(*p)[option] = v
+	return nil
+}
+
+// LoadEnv sets the configuration keys named by the environment variables
+// starting with EnvPrefix, given as in os.Environ. Variables that name no key,
+// such as CAYLEY_CFG, are ignored.
+func (c *Config) LoadEnv(environ []string) error {
+	var maps []string
+	for _, k := range Keys() {
+		if reflect.ValueOf(c).Elem().FieldByName(fields[k]).Kind() == reflect.Map {
+			maps = append(maps, k)
+		}
+	}
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv, EnvPrefix) {
+			continue
+		}
+		key := strings.ToLower(kv[len(EnvPrefix):i])
+		value := kv[i+1:]
+		if _, ok := fields[key]; ok {
+			if err := c.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %v", kv[:i], err)
+			}
+			continue
+		}
+		for _, m := range maps {
+			if strings.HasPrefix(key, m+"_") {
+				if err := c.setOption(m, key[len(m)+1:], value); err != nil {
+					return fmt.Errorf("%s: %v", kv[:i], err)
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Overrides is a flag.Value collecting key=value settings of configuration
+// keys, given by repeating a flag.
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+// Set checks the syntax of a setting, and adds it.
+func (o *Overrides) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("setting %q is not of the form key=value", s)
+	}
+	*o = append(*o, s)
+	return nil
+}
+
+// Apply sets the keys of the settings, in order.
+func (o Overrides) Apply(c *Config) error {
+	for _, s := range o {
+		i := strings.Index(s, "=")
+		if err := c.Set(s[:i], s[i+1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
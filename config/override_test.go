@@ -0,0 +1,103 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	var c Config
+	for _, kv := range [][2]string{
+		{"db_path", "/var/cayley"},
+		{"listen_port", "8080"},
+		{"read_only", "true"},
+		{"load_size", "500"},
+		{"timeout", "45s"},
+		{"db_options", `{"nosync": true}`},
+		{"db_options.cache_size_mb", "64"},
+		{"tracer_options.service", "cayley"},
+	} {
+		if err := c.Set(kv[0], kv[1]); err != nil {
+			t.Fatalf("Failed to set %s: %v", kv[0], err)
+		}
+	}
+	want := Config{
+		DatabasePath:    "/var/cayley",
+		ListenPort:      "8080",
+		ReadOnly:        true,
+		LoadSize:        500,
+		Timeout:         45 * time.Second,
+		DatabaseOptions: map[string]interface{}{"nosync": true, "cache_size_mb": 64.0},
+		TracerOptions:   map[string]interface{}{"service": "cayley"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Unexpected config, got:%#v expect:%#v", c, want)
+	}
+	for _, kv := range [][2]string{
+		{"no_such_key", "1"},
+		{"load_size", "many"},
+		{"db_path.option", "1"},
+		{"db_options", "not json"},
+	} {
+		if err := c.Set(kv[0], kv[1]); err == nil {
+			t.Errorf("Expected an error setting %s to %q", kv[0], kv[1])
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	c := Config{DatabasePath: "/from/file", ListenHost: "0.0.0.0"}
+	err := c.LoadEnv([]string{
+		"CAYLEY_CFG=/etc/cayley.cfg",
+		"CAYLEY_DB_PATH=/from/env",
+		"CAYLEY_DB_OPTIONS_CACHE_SIZE_MB=16",
+		"CAYLEY_REPLICATION_OPTIONS_IGNORE_DUPLICATE=true",
+		"HOME=/root",
+	})
+	if err != nil {
+		t.Fatalf("Failed to load environment: %v", err)
+	}
+	want := Config{
+		DatabasePath:       "/from/env",
+		ListenHost:         "0.0.0.0",
+		DatabaseOptions:    map[string]interface{}{"cache_size_mb": 16.0},
+		ReplicationOptions: map[string]interface{}{"ignore_duplicate": true},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Unexpected config, got:%#v expect:%#v", c, want)
+	}
+	if err := c.LoadEnv([]string{"CAYLEY_READ_ONLY=maybe"}); err == nil {
+		t.Error("Expected an error for an invalid variable")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	var o Overrides
+	if err := o.Set("listen_port"); err == nil {
+		t.Error("Expected an error for a setting without a value")
+	}
+	o.Set("listen_port=1234")
+	o.Set("db_options.path=a=b")
+	var c Config
+	if err := o.Apply(&c); err != nil {
+		t.Fatalf("Failed to apply overrides: %v", err)
+	}
+	if c.ListenPort != "1234" || c.DatabaseOptions["path"] != "a=b" {
+		t.Errorf("Unexpected config: %#v", c)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/quad/cquads"
+)
+
+// ErrNotEmpty is returned when restoring a backup into a database that
+// already holds quads.
+var ErrNotEmpty = errors.New("database is not empty")
+
+// Backup writes the quads live in qs at its current horizon to w, in the
+// cquad format, and returns that horizon and the number of quads written.
+//
+// It reads the store at that revision, so writes may go on while it runs;
+// backends that do not keep revisions return graph.ErrNoRevisions.
+func Backup(qs graph.QuadStore, w io.Writer) (int64, int, error) {
+	horizon := qs.Horizon()
+	h := horizon.Int()
+	snap, err := graph.AtRevision(qs, h)
+	if err != nil {
+		return 0, 0, err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# cayley backup at horizon %d\n", h)
+	n := 0
+	it := snap.QuadsAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		q := snap.Quad(it.Result())
+		_, err = bw.WriteString(backupLine(q))
+		if err != nil {
+			return h, n, err
+		}
+		n++
+	}
+	if err = it.Err(); err != nil {
+		return h, n, err
+	}
+	return h, n, bw.Flush()
+}
+
+var backupEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// backupLine quotes every term of q, so that names holding spaces, quotes or
+// N-Quads syntax are read back unchanged.
+func backupLine(q quad.Quad) string {
+	terms := []string{q.Subject, q.Predicate, q.Object}
+	if q.Label != "" {
+		terms = append(terms, q.Label)
+	}
+	for i, t := range terms {
+		t = backupEscaper.Replace(t)
+		if strings.HasPrefix(t, "<") {
+			// The decoder strips the brackets of a quoted IRI.
+			t = `\u003c` + t[1:]
+		}
+		terms[i] = `"` + t + `"`
+	}
+	return strings.Join(terms, " ") + " .\n"
+}
+
+// WriteQuads writes quads to w in the format of Backup, so that they can be
+// restored or loaded as cquads.
+func WriteQuads(w io.Writer, quads []quad.Quad) error {
+	bw := bufio.NewWriter(w)
+	for _, q := range quads {
+		if _, err := bw.WriteString(backupLine(q)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore loads a backup written by Backup from r into h, which must be
+// empty.
+func Restore(h *graph.Handle, cfg *config.Config, r io.Reader) error {
+	if h.QuadStore.Size() != 0 {
+		return ErrNotEmpty
+	}
+	return Load(h.QuadWriter, cfg, cquads.NewDecoder(r))
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+var backupQuads = []quad.Quad{
+	{Subject: "alice", Predicate: "follows", Object: "bob"},
+	{Subject: "alice", Predicate: "name", Object: `"Alice \"Al\" Smith"@en`, Label: "<people>"},
+	{Subject: "_:b1", Predicate: "note", Object: "two\nlines\\ and a\ttab", Label: "notes"},
+}
+
+func allQuads(qs graph.QuadStore) []string {
+	var out []string
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		out = append(out, qs.Quad(it.Result()).NQuad())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestBackupRestore(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", LoadSize: 10}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	h.QuadWriter.AddQuadSet(backupQuads)
+	h.QuadWriter.AddQuad(quad.Quad{Subject: "bob", Predicate: "follows", Object: "carol"})
+	h.QuadWriter.RemoveQuad(quad.Quad{Subject: "bob", Predicate: "follows", Object: "carol"})
+
+	var buf bytes.Buffer
+	horizon, n, err := Backup(h.QuadStore, &buf)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if horizon != 5 || n != len(backupQuads) {
+		t.Errorf("Unexpected backup, got horizon:%d quads:%d expect horizon:5 quads:%d", horizon, n, len(backupQuads))
+	}
+	// Writes after the backup has started are not in it.
+	h.QuadWriter.AddQuad(quad.Quad{Subject: "carol", Predicate: "follows", Object: "dave"})
+	backup := buf.Bytes()
+
+	r, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer r.Close()
+	err = Restore(r, cfg, bytes.NewReader(backup))
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	var expect []string
+	for _, q := range backupQuads {
+		expect = append(expect, q.NQuad())
+	}
+	sort.Strings(expect)
+	if got := allQuads(r.QuadStore); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected restored quads, got:%q expect:%q", got, expect)
+	}
+	if err = Restore(r, cfg, bytes.NewReader(backup)); err != ErrNotEmpty {
+		t.Errorf("Unexpected error restoring into a non-empty store: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+// Defines the benchmark of a database: a standard suite of queries, run
+// against a synthetic or loaded graph, for comparing backends and options.
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query/gremlin"
+)
+
+// SyntheticQuads returns a graph of n distinct quads, the same for the same
+// n: people who follow each other, each with a name and a status.
+func SyntheticQuads(n int) []quad.Quad {
+	people := n/5 + 1
+	r := rand.New(rand.NewSource(int64(n)))
+	statuses := []string{"cool", "smart", "busy"}
+	quads := make([]quad.Quad, 0, n)
+	seen := make(map[quad.Quad]bool, n)
+	for i := 0; len(quads) < n; i++ {
+		p := "person" + strconv.Itoa(i%people)
+		switch {
+		case i < people:
+			quads = append(quads, quad.Quad{Subject: p, Predicate: "name", Object: "Person " + strconv.Itoa(i)})
+		case i < 2*people:
+			quads = append(quads, quad.Quad{Subject: p, Predicate: "status", Object: statuses[r.Intn(len(statuses))], Label: "status_graph"})
+		default:
+			// Followers are skewed towards the first people, so that
+			// some nodes are much larger than others.
+			f := "person" + strconv.Itoa(int(r.ExpFloat64()*float64(people)/8)%people)
+			q := quad.Quad{Subject: p, Predicate: "follows", Object: f}
+			if !seen[q] {
+				seen[q] = true
+				quads = append(quads, q)
+			}
+		}
+	}
+	return quads
+}
+
+// BenchQuery is a query of the benchmark suite. Its Gremlin source is a
+// format string, filled in with a node, a predicate and an object of a quad
+// of the graph, so that the suite runs against any dataset.
+type BenchQuery struct {
+	Name  string
+	Query string
+}
+
+// BenchQueries is the standard suite of queries.
+var BenchQueries = []BenchQuery{
+	{Name: "out", Query: `g.V(%[1]q).Out(%[2]q).All()`},
+	{Name: "in", Query: `g.V(%[3]q).In(%[2]q).All()`},
+	{Name: "out_out", Query: `g.V(%[1]q).Out().Out().All()`},
+	{Name: "has", Query: `g.V().Has(%[2]q, %[3]q).All()`},
+	{Name: "both_tags", Query: `g.V(%[1]q).Tag("a").Both().Tag("b").All()`},
+	{Name: "intersect", Query: `g.V(%[1]q).Out(%[2]q).Intersect(g.V().Has(%[2]q, %[3]q)).All()`},
+}
+
+// BenchResult is the outcome of running a query of the suite.
+type BenchResult struct {
+	Name    string
+	Runs    int
+	Results int // The number of results of a run.
+	Mean    time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	QPS     float64
+}
+
+func (r BenchResult) String() string {
+	return fmt.Sprintf("%-12s %6d runs %8d results  mean %-12v p50 %-12v p90 %-12v p99 %-12v %10.1f qps",
+		r.Name, r.Runs, r.Results, r.Mean, r.P50, r.P90, r.P99, r.QPS)
+}
+
+// Bench runs each of the queries runs times against qs, after filling them
+// in with the first quad of the store, and returns the latency of each.
+func Bench(qs graph.QuadStore, queries []BenchQuery, runs int, timeout time.Duration) ([]BenchResult, error) {
+	it := qs.QuadsAllIterator()
+	ok := graph.Next(it)
+	var seed quad.Quad
+	if ok {
+		seed = qs.Quad(it.Result())
+	}
+	it.Close()
+	if !ok {
+		return nil, errors.New("db: no quads to benchmark")
+	}
+	var out []BenchResult
+	for _, q := range queries {
+		src := fmt.Sprintf(q.Query, seed.Subject, seed.Predicate, seed.Object)
+		r, err := benchQuery(qs, src, runs, timeout)
+		if err != nil {
+			return out, fmt.Errorf("db: benchmark query %q failed: %v", q.Name, err)
+		}
+		r.Name = q.Name
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func benchQuery(qs graph.QuadStore, src string, runs int, timeout time.Duration) (BenchResult, error) {
+	times := make([]time.Duration, 0, runs)
+	var (
+		total   time.Duration
+		results int
+	)
+	for i := 0; i < runs; i++ {
+		ses := gremlin.NewSession(qs, timeout, false)
+		start := time.Now()
+		c := make(chan interface{}, 5)
+		go ses.Execute(src, c, -1)
+		for res := range c {
+			ses.Collate(res)
+		}
+		out, err := ses.Results()
+		d := time.Since(start)
+		if err != nil {
+			return BenchResult{}, err
+		}
+		if res, ok := out.([]interface{}); ok {
+			results = len(res)
+		}
+		times = append(times, d)
+		total += d
+	}
+	sort.Sort(durations(times))
+	r := BenchResult{Runs: runs, Results: results}
+	if runs > 0 {
+		r.Mean = total / time.Duration(runs)
+		r.P50 = percentile(times, 50)
+		r.P90 = percentile(times, 90)
+		r.P99 = percentile(times, 99)
+		r.QPS = float64(runs) / total.Seconds()
+	}
+	return r, nil
+}
+
+// percentile returns the pth percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i]
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
@@ -0,0 +1,68 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/quad"
+)
+
+func TestSyntheticQuads(t *testing.T) {
+	quads := SyntheticQuads(1000)
+	if len(quads) != 1000 {
+		t.Fatalf("Unexpected number of quads, got:%d expect:1000", len(quads))
+	}
+	if again := SyntheticQuads(1000); !reflect.DeepEqual(quads, again) {
+		t.Errorf("Synthetic quads differ between runs")
+	}
+	seen := make(map[quad.Quad]bool)
+	for _, q := range quads {
+		if !q.IsValid() || seen[q] {
+			t.Fatalf("Invalid or repeated synthetic quad %v", q)
+		}
+		seen[q] = true
+	}
+}
+
+func TestBench(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single"}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	if _, err := Bench(h.QuadStore, BenchQueries, 1, -1); err == nil {
+		t.Errorf("Expected an error benchmarking an empty store")
+	}
+	if err := h.QuadWriter.AddQuadSet(SyntheticQuads(500)); err != nil {
+		t.Fatalf("Failed to load synthetic quads: %v", err)
+	}
+
+	suite := []BenchQuery{{Name: "has", Query: `g.V().Has(%[2]q, %[3]q).All()`}}
+	results, err := Bench(h.QuadStore, suite, 5, -1)
+	if err != nil {
+		t.Fatalf("Failed to benchmark: %v", err)
+	}
+	r := results[0]
+	if r.Name != "has" || r.Runs != 5 || r.Results == 0 {
+		t.Errorf("Unexpected result, got:%+v", r)
+	}
+	if r.P50 > r.P90 || r.P90 > r.P99 || r.QPS <= 0 {
+		t.Errorf("Inconsistent latencies: %v", r)
+	}
+}
@@ -18,9 +18,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
 
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/config"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/quad"
@@ -49,7 +50,7 @@ func Open(cfg *config.Config) (*graph.Handle, error) {
 }
 
 func OpenQuadStore(cfg *config.Config) (graph.QuadStore, error) {
-	glog.Infof("Opening quad store %q at %s", cfg.DatabaseType, cfg.DatabasePath)
+	clog.Infof("Opening quad store %q at %s", cfg.DatabaseType, cfg.DatabasePath)
 	qs, err := graph.NewQuadStore(cfg.DatabaseType, cfg.DatabasePath, cfg.DatabaseOptions)
 	if err != nil {
 		return nil, err
@@ -59,7 +60,7 @@ func OpenQuadStore(cfg *config.Config) (graph.QuadStore, error) {
 }
 
 func OpenQuadWriter(qs graph.QuadStore, cfg *config.Config) (graph.QuadWriter, error) {
-	glog.Infof("Opening replication method %q", cfg.ReplicationType)
+	clog.Infof("Opening replication method %q", cfg.ReplicationType)
 	w, err := graph.NewQuadWriter(cfg.ReplicationType, qs, cfg.ReplicationOptions)
 	if err != nil {
 		return nil, err
@@ -68,7 +69,38 @@ func OpenQuadWriter(qs graph.QuadStore, cfg *config.Config) (graph.QuadWriter, e
 	return w, nil
 }
 
+// WithProvenance returns a QuadWriter that adds quads through qw, recording
+// the author and source of p as their provenance.
+func WithProvenance(qw graph.QuadWriter, p graph.Provenance) (graph.QuadWriter, error) {
+	pw, ok := qw.(graph.ProvenanceWriter)
+	if !ok {
+		return nil, graph.ErrNoProvenance
+	}
+	return &provenanceWriter{QuadWriter: qw, pw: pw, p: p}, nil
+}
+
+type provenanceWriter struct {
+	graph.QuadWriter
+	pw graph.ProvenanceWriter
+	p  graph.Provenance
+}
+
+func (w *provenanceWriter) AddQuad(q quad.Quad) error {
+	return w.pw.AddQuadSetWithProvenance([]quad.Quad{q}, w.p)
+}
+
+func (w *provenanceWriter) AddQuadSet(set []quad.Quad) error {
+	return w.pw.AddQuadSetWithProvenance(set, w.p)
+}
+
+// Load reads quads from dec and writes them to qw in blocks of cfg.LoadSize
+// quads. If cfg.LoadWorkers is more than one, decoding runs concurrently
+// with writing, and that many blocks may be queued for the writer, which
+// still applies them to the store one at a time.
 func Load(qw graph.QuadWriter, cfg *config.Config, dec quad.Unmarshaler) error {
+	if cfg.LoadWorkers > 1 {
+		return loadParallel(qw, cfg, dec)
+	}
 	block := make([]quad.Quad, 0, cfg.LoadSize)
 	count := 0
 	for {
@@ -87,8 +119,8 @@ func Load(qw graph.QuadWriter, cfg *config.Config, dec quad.Unmarshaler) error {
 				return fmt.Errorf("db: failed to load data: %v", err)
 			}
 			block = block[:0]
-			if glog.V(2) {
-				glog.V(2).Infof("Wrote %d quads.", count)
+			if clog.V(2) {
+				clog.V(2).Infof("Wrote %d quads.", count)
 			}
 		}
 	}
@@ -97,9 +129,82 @@ func Load(qw graph.QuadWriter, cfg *config.Config, dec quad.Unmarshaler) error {
 	if err != nil {
 		return fmt.Errorf("db: failed to load data: %v", err)
 	}
-	if glog.V(2) {
-		glog.V(2).Infof("Wrote %d quads.", count)
+	if clog.V(2) {
+		clog.V(2).Infof("Wrote %d quads.", count)
 	}
 
 	return nil
 }
+
+// loadParallel decodes blocks while cfg.LoadWorkers workers hand them to qw.
+// The writer applies one block at a time, so that the IDs of the deltas
+// follow the order of the writes, and the workers only overlap decoding with
+// writing.
+func loadParallel(qw graph.QuadWriter, cfg *config.Config, dec quad.Unmarshaler) error {
+	var (
+		blocks = make(chan []quad.Quad, cfg.LoadWorkers)
+		done   = make(chan struct{})
+		errs   = make(chan error, cfg.LoadWorkers)
+		wg     sync.WaitGroup
+		count  int64
+	)
+	for i := 0; i < cfg.LoadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for block := range blocks {
+				err := qw.AddQuadSet(block)
+				if err != nil {
+					errs <- fmt.Errorf("db: failed to load data: %v", err)
+					return
+				}
+				n := atomic.AddInt64(&count, int64(len(block)))
+				if clog.V(2) {
+					clog.V(2).Infof("Wrote %d quads.", n)
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Blocks are not reused, since a worker may still be writing one.
+	var err error
+	block := make([]quad.Quad, 0, cfg.LoadSize)
+decode:
+	for {
+		t, derr := dec.Unmarshal()
+		if derr != nil {
+			if derr != io.EOF {
+				err = derr
+			}
+			break
+		}
+		block = append(block, t)
+		if len(block) == cap(block) {
+			select {
+			case blocks <- block:
+			case err = <-errs:
+				break decode
+			}
+			block = make([]quad.Quad, 0, cfg.LoadSize)
+		}
+	}
+	if err == nil && len(block) > 0 {
+		select {
+		case blocks <- block:
+		case err = <-errs:
+		}
+	}
+	close(blocks)
+	<-done
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"sync/atomic"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/internal/bloom"
+	"github.com/google/cayley/quad"
+)
+
+// dedupFalsePositives is the rate at which the filter of a DedupWriter sends
+// a new quad to be looked up in the store.
+const dedupFalsePositives = 0.01
+
+// DedupWriter is a QuadWriter that skips the quads its store already holds,
+// or that it added before, so that a dump can be loaded again into the store
+// it was taken from, or an updated one on top of the old.
+//
+// Quads are first looked for in a Bloom filter of those of the store and of
+// those added since, which grows with them, and only the ones it may hold are
+// looked up in the store, a block at a time. Loading into an empty store
+// reads from it only for the few quads the filter wrongly takes for ones it
+// holds.
+type DedupWriter struct {
+	graph.QuadWriter
+	qs      graph.QuadStore
+	filter  *bloom.Scalable
+	skipped int64
+}
+
+// Deduplicating returns a DedupWriter adding quads through qw to qs. It reads
+// every quad of qs to fill its filter, which is sized at first for twice as
+// many, or for n if that is more, and grows as quads are added.
+//
+// Blocks written at once, as by a load with several workers, may share a quad
+// that neither holds yet. If qw is a graph.IgnoringWriter, such a quad is
+// ignored as a duplicate by the writer; otherwise the write may fail with
+// graph.ErrQuadExists.
+func Deduplicating(qs graph.QuadStore, qw graph.QuadWriter, n int) (*DedupWriter, error) {
+	if size := 2 * int(qs.Size()); size > n {
+		n = size
+	}
+	w := &DedupWriter{QuadWriter: qw, qs: qs, filter: bloom.NewScalable(n, dedupFalsePositives)}
+	if iw, ok := qw.(graph.IgnoringWriter); ok {
+		opts := iw.IgnoreOpts()
+		opts.IgnoreDup = true
+		w.QuadWriter = iw.WithIgnoreOpts(opts)
+	}
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		w.filter.Add(dedupKey(qs.Quad(it.Result())))
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Skipped returns the number of quads the writer skipped so far.
+func (w *DedupWriter) Skipped() int64 {
+	return atomic.LoadInt64(&w.skipped)
+}
+
+func (w *DedupWriter) AddQuad(q quad.Quad) error {
+	return w.AddQuadSet([]quad.Quad{q})
+}
+
+func (w *DedupWriter) AddQuadSet(set []quad.Quad) error {
+	set, err := w.filterNew(set)
+	if err != nil || len(set) == 0 {
+		return err
+	}
+	return w.QuadWriter.AddQuadSet(set)
+}
+
+// AddQuadSetWithProvenance adds the new quads of set, recording p as their
+// provenance, if the writer it writes through can.
+func (w *DedupWriter) AddQuadSetWithProvenance(set []quad.Quad, p graph.Provenance) error {
+	pw, ok := w.QuadWriter.(graph.ProvenanceWriter)
+	if !ok {
+		return graph.ErrNoProvenance
+	}
+	set, err := w.filterNew(set)
+	if err != nil || len(set) == 0 {
+		return err
+	}
+	return pw.AddQuadSetWithProvenance(set, p)
+}
+
+// filterNew returns the quads of set that are neither in the store nor
+// earlier in set, and adds them to the filter.
+func (w *DedupWriter) filterNew(set []quad.Quad) ([]quad.Quad, error) {
+	var check []quad.Quad
+	for _, q := range set {
+		if w.filter.MayContain(dedupKey(q)) {
+			check = append(check, q)
+		}
+	}
+	held, err := w.held(check)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]quad.Quad, 0, len(set))
+	seen := make(map[quad.Quad]bool)
+	for _, q := range set {
+		if seen[q] || held[q] {
+			continue
+		}
+		seen[q] = true
+		w.filter.Add(dedupKey(q))
+		out = append(out, q)
+	}
+	atomic.AddInt64(&w.skipped, int64(len(set)-len(out)))
+	return out, nil
+}
+
+// held returns which of the quads the store holds. The quads of a subject
+// are read once for all those that share it.
+func (w *DedupWriter) held(quads []quad.Quad) (map[quad.Quad]bool, error) {
+	held := make(map[quad.Quad]bool)
+	bySubject := make(map[string]map[quad.Quad]bool)
+	for _, q := range quads {
+		want, ok := bySubject[q.Subject]
+		if !ok {
+			want = make(map[quad.Quad]bool)
+			bySubject[q.Subject] = want
+		}
+		want[q] = true
+	}
+	for s, want := range bySubject {
+		if len(want) == 1 {
+			for q := range want {
+				ok, err := graph.HasQuad(w.qs, q)
+				if err != nil {
+					return nil, err
+				}
+				held[q] = ok
+			}
+			continue
+		}
+		v := w.qs.ValueOf(s)
+		if v == nil {
+			continue
+		}
+		it := w.qs.QuadIterator(quad.Subject, v)
+		for graph.Next(it) {
+			if q := w.qs.Quad(it.Result()); want[q] {
+				held[q] = true
+			}
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return held, nil
+}
+
+func dedupKey(q quad.Quad) []byte {
+	return []byte(q.Subject + "\x00" + q.Predicate + "\x00" + q.Object + "\x00" + q.Label)
+}
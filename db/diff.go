@@ -0,0 +1,136 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/quad/cquads"
+)
+
+// Diff returns the transaction turning the quads of from into those of to:
+// it removes the quads only in from, then adds those only in to, each in
+// sorted order.
+func Diff(from, to graph.QuadStore) (*graph.Transaction, error) {
+	have := make(map[quad.Quad]bool)
+	it := from.QuadsAllIterator()
+	for graph.Next(it) {
+		have[from.Quad(it.Result())] = true
+	}
+	err := it.Err()
+	it.Close()
+	if err != nil {
+		return nil, err
+	}
+	var added []quad.Quad
+	it = to.QuadsAllIterator()
+	for graph.Next(it) {
+		q := to.Quad(it.Result())
+		if have[q] {
+			delete(have, q)
+			continue
+		}
+		added = append(added, q)
+	}
+	err = it.Err()
+	it.Close()
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]quad.Quad, 0, len(have))
+	for q := range have {
+		removed = append(removed, q)
+	}
+	sort.Sort(byQuad(removed))
+	sort.Sort(byQuad(added))
+
+	tx := graph.NewTransaction()
+	for _, q := range removed {
+		tx.RemoveQuad(q)
+	}
+	for _, q := range added {
+		tx.AddQuad(q)
+	}
+	return tx, nil
+}
+
+type byQuad []quad.Quad
+
+func (b byQuad) Len() int      { return len(b) }
+func (b byQuad) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byQuad) Less(i, j int) bool {
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		if x, y := b[i].Get(d), b[j].Get(d); x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// WritePatch writes the changes of tx to w as a patch: one line for each,
+// starting with "A " for an addition or "D " for a deletion, followed by the
+// quad in the format of Backup.
+func WritePatch(w io.Writer, tx *graph.Transaction) error {
+	bw := bufio.NewWriter(w)
+	for i := range tx.Deltas {
+		d := &tx.Deltas[i]
+		op := "A "
+		if d.Action == graph.Delete {
+			op = "D "
+		}
+		if _, err := bw.WriteString(op + backupLine(d.Quad)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadPatch reads a patch written by WritePatch into a transaction. Empty
+// lines and lines starting with "#" are skipped.
+func ReadPatch(r io.Reader) (*graph.Transaction, error) {
+	tx := graph.NewTransaction()
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if len(line) < 2 || line[1] != ' ' || (line[0] != 'A' && line[0] != 'D') {
+			return nil, fmt.Errorf("patch line %d: expected \"A \" or \"D \"", n)
+		}
+		q, err := cquads.Parse(line[2:])
+		if err != nil {
+			return nil, fmt.Errorf("patch line %d: %v", n, err)
+		}
+		if line[0] == 'A' {
+			tx.AddQuad(q)
+		} else {
+			tx.RemoveQuad(q)
+		}
+	}
+	return tx, nil
+}
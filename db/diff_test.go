@@ -0,0 +1,80 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/quad"
+)
+
+func TestDiffPatch(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", LoadSize: 10}
+	from, _ := Open(cfg)
+	defer from.Close()
+	to, _ := Open(cfg)
+	defer to.Close()
+	from.QuadWriter.AddQuadSet([]quad.Quad{
+		{Subject: "alice", Predicate: "follows", Object: "bob"},
+		{Subject: "bob", Predicate: "follows", Object: "carol"},
+		{Subject: "bob", Predicate: "name", Object: "Bob Smith"},
+	})
+	to.QuadWriter.AddQuadSet([]quad.Quad{
+		{Subject: "alice", Predicate: "follows", Object: "bob"},
+		{Subject: "bob", Predicate: "name", Object: "Robert Smith", Label: "<people>"},
+		{Subject: "alice", Predicate: "follows", Object: "carol"},
+	})
+
+	tx, err := Diff(from.QuadStore, to.QuadStore)
+	if err != nil {
+		t.Fatalf("Failed to diff stores: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WritePatch(&buf, tx); err != nil {
+		t.Fatalf("Failed to write patch: %v", err)
+	}
+	expect := strings.Join([]string{
+		`D "bob" "follows" "carol" .`,
+		`D "bob" "name" "Bob Smith" .`,
+		`A "alice" "follows" "carol" .`,
+		`A "bob" "name" "Robert Smith" "\u003cpeople>" .`,
+	}, "\n") + "\n"
+	if got := buf.String(); got != expect {
+		t.Errorf("Unexpected patch, got:\n%s\nexpect:\n%s", got, expect)
+	}
+
+	patch, err := ReadPatch(strings.NewReader("# comment\n\n" + buf.String()))
+	if err != nil {
+		t.Fatalf("Failed to read patch: %v", err)
+	}
+	if err := from.QuadWriter.ApplyTransaction(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if got, expect := allQuads(from.QuadStore), allQuads(to.QuadStore); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after patch, got:%v expect:%v", got, expect)
+	}
+	tx, _ = Diff(from.QuadStore, to.QuadStore)
+	if len(tx.Deltas) != 0 {
+		t.Errorf("Unexpected changes between patched stores: %v", tx.Deltas)
+	}
+
+	if _, err := ReadPatch(strings.NewReader("X alice follows bob .\n")); err == nil {
+		t.Error("Expected an error reading an invalid patch")
+	}
+}
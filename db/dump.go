@@ -0,0 +1,38 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// Dump writes the quads of qs equal to pattern in each of its non-empty
+// fields, or all of them if pattern is empty, to w, then closes w. It returns
+// the number of quads written.
+//
+// It reads a snapshot of the store if the backend keeps revisions, so that
+// writes may go on while it runs.
+func Dump(qs graph.QuadStore, w quad.Writer, pattern quad.Quad) (int, error) {
+	n := 0
+	err := graph.EachMatchingQuad(graph.Snapshot(qs), pattern, func(q quad.Quad) error {
+		n++
+		return w.WriteQuad(q)
+	})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
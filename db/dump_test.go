@@ -0,0 +1,92 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/quad"
+)
+
+func TestDump(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single"}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	h.QuadWriter.AddQuadSet(rdfQuads)
+
+	var tests = []struct {
+		message string
+		format  string
+		pattern quad.Quad
+		expect  string
+	}{
+		{
+			message: "dump the quads with a label",
+			format:  "nquad",
+			pattern: quad.Quad{Label: "my graph"},
+			expect:  "<A> <http://schema.org/name> \"Alice\"@en <my\\u0020graph> .\n",
+		},
+		{
+			message: "dump the quads matching a pattern",
+			format:  "cquad",
+			pattern: quad.Quad{Subject: "_:b1", Predicate: "follows"},
+			expect:  "\"_:b1\" \"follows\" \"A\" .\n",
+		},
+		{
+			message: "dump nothing for an unknown node",
+			format:  "nquad",
+			pattern: quad.Quad{Subject: "Z"},
+			expect:  "",
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		f := quad.FormatByName(test.format)
+		if _, err := Dump(h.QuadStore, f.Writer(&buf), test.pattern); err != nil {
+			t.Fatalf("Failed to %s: %v", test.message, err)
+		}
+		if got := buf.String(); got != test.expect {
+			t.Errorf("Failed to %s, got:%q expect:%q", test.message, got, test.expect)
+		}
+	}
+
+	if f := quad.FormatByExt(".ttl"); f == nil || f.Name != "turtle" {
+		t.Errorf("Unexpected format for a .ttl file, got:%v expect:turtle", f)
+	}
+
+	// A full dump loads back the same quads.
+	var buf bytes.Buffer
+	n, err := Dump(h.QuadStore, quad.FormatByName("cquad").Writer(&buf), quad.Quad{})
+	if err != nil || n != len(rdfQuads) {
+		t.Fatalf("Unexpected full dump, got:%d quads, %v expect:%d quads", n, err, len(rdfQuads))
+	}
+	r, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer r.Close()
+	if err := Load(r.QuadWriter, cfg, quad.FormatByName("cquad").Reader(&buf)); err != nil {
+		t.Fatalf("Failed to load the dump: %v", err)
+	}
+	if got, expect := allQuads(r.QuadStore), allQuads(h.QuadStore); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads loaded from the dump, got:%v expect:%v", got, expect)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+// Registers the formats that quads can be loaded from and dumped to.
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/quad/cquads"
+	"github.com/google/cayley/quad/nquads"
+	"github.com/google/cayley/quad/turtle"
+)
+
+func init() {
+	quad.RegisterFormat(quad.Format{
+		Name:   "cquad",
+		Reader: func(r io.Reader) quad.Unmarshaler { return cquads.NewDecoder(r) },
+		Writer: func(w io.Writer) quad.Writer { return newLineWriter(w, backupLine) },
+	})
+	quad.RegisterFormat(quad.Format{
+		Name:   "nquad",
+		Ext:    []string{".nq", ".nt"},
+		Reader: func(r io.Reader) quad.Unmarshaler { return nquads.NewDecoder(r) },
+		Writer: func(w io.Writer) quad.Writer { return newLineWriter(w, nquadLine) },
+	})
+	quad.RegisterFormat(quad.Format{
+		Name:   "turtle",
+		Ext:    []string{".ttl"},
+		Reader: func(r io.Reader) quad.Unmarshaler { return turtle.NewDecoder(r) },
+		Writer: func(w io.Writer) quad.Writer { return &turtleWriter{w: w} },
+	})
+}
+
+// lineWriter writes each quad on a line of its own.
+type lineWriter struct {
+	w    *bufio.Writer
+	line func(quad.Quad) string
+}
+
+func newLineWriter(w io.Writer, line func(quad.Quad) string) *lineWriter {
+	return &lineWriter{w: bufio.NewWriter(w), line: line}
+}
+
+func (w *lineWriter) WriteQuad(q quad.Quad) error {
+	_, err := w.w.WriteString(w.line(q))
+	return err
+}
+
+func (w *lineWriter) Close() error {
+	return w.w.Flush()
+}
+
+// turtleWriter holds the quads until it is closed, to group the triples of
+// each subject as WriteTurtle does.
+type turtleWriter struct {
+	w     io.Writer
+	quads []quad.Quad
+}
+
+func (w *turtleWriter) WriteQuad(q quad.Quad) error {
+	w.quads = append(w.quads, q)
+	return nil
+}
+
+func (w *turtleWriter) Close() error {
+	err := WriteTurtle(w.w, w.quads)
+	w.quads = nil
+	return err
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/leveldb"
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+type sliceUnmarshaler struct {
+	quads []quad.Quad
+	err   error
+}
+
+func (s *sliceUnmarshaler) Unmarshal() (quad.Quad, error) {
+	if len(s.quads) == 0 {
+		if s.err != nil {
+			return quad.Quad{}, s.err
+		}
+		return quad.Quad{}, io.EOF
+	}
+	q := s.quads[0]
+	s.quads = s.quads[1:]
+	return q, nil
+}
+
+func loadQuads(n int) []quad.Quad {
+	quads := make([]quad.Quad, n)
+	for i := range quads {
+		quads[i] = quad.Quad{fmt.Sprintf("n%d", i), "follows", fmt.Sprintf("n%d", i+1), ""}
+	}
+	return quads
+}
+
+func TestLoad(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", LoadSize: 7, LoadWorkers: workers}
+		h, err := Open(cfg)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		err = Load(h.QuadWriter, cfg, &sliceUnmarshaler{quads: loadQuads(100)})
+		if err != nil {
+			t.Errorf("Unexpected error loading with %d workers: %v", workers, err)
+		}
+		if got := h.QuadStore.Size(); got != 100 {
+			t.Errorf("Unexpected store size with %d workers, got:%d expect:100", workers, got)
+		}
+		h.Close()
+	}
+}
+
+func TestLoadParallelHorizon(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{DatabaseType: "leveldb", DatabasePath: tmpDir, ReplicationType: "single", LoadSize: 10, LoadWorkers: 8}
+	if err := Init(cfg); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	err = Load(h.QuadWriter, cfg, &sliceUnmarshaler{quads: loadQuads(2000)})
+	if err != nil {
+		t.Fatalf("Failed to load quads: %v", err)
+	}
+	// Each quad is a delta, so the horizon is the last of their IDs, if
+	// the parallel writes were applied in the order of their IDs.
+	horizon := h.QuadStore.Horizon()
+	if got := horizon.Int(); got != 2000 {
+		t.Errorf("Unexpected horizon after parallel load, got:%d expect:2000", got)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	parseErr := errors.New("bad quad")
+	for _, workers := range []int{1, 4} {
+		cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", LoadSize: 7, LoadWorkers: workers}
+		h, err := Open(cfg)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		err = Load(h.QuadWriter, cfg, &sliceUnmarshaler{quads: loadQuads(20), err: parseErr})
+		if err != parseErr {
+			t.Errorf("Unexpected error loading with %d workers, got:%v expect:%v", workers, err, parseErr)
+		}
+		h.Close()
+	}
+}
+
+func TestLoadDedupe(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", LoadSize: 7, LoadWorkers: workers}
+		h, err := Open(cfg)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		err = Load(h.QuadWriter, cfg, &sliceUnmarshaler{quads: loadQuads(100)})
+		if err != nil {
+			t.Fatalf("Failed to load quads: %v", err)
+		}
+		w, err := Deduplicating(h.QuadStore, h.QuadWriter, cfg.LoadSize)
+		if err != nil {
+			t.Fatalf("Failed to create writer: %v", err)
+		}
+		quads := append(loadQuads(150), loadQuads(10)...)
+		err = Load(w, cfg, &sliceUnmarshaler{quads: quads})
+		if err != nil {
+			t.Errorf("Unexpected error reloading with %d workers: %v", workers, err)
+		}
+		if got := h.QuadStore.Size(); got != 150 {
+			t.Errorf("Unexpected store size with %d workers, got:%d expect:150", workers, got)
+		}
+		if got := w.Skipped(); got != 110 {
+			t.Errorf("Unexpected skipped quads with %d workers, got:%d expect:110", workers, got)
+		}
+		h.Close()
+	}
+}
+
+// lookupStore counts the nodes looked up in a QuadStore.
+type lookupStore struct {
+	graph.QuadStore
+	lookups int
+}
+
+func (qs *lookupStore) ValueOf(name string) graph.Value {
+	qs.lookups++
+	return qs.QuadStore.ValueOf(name)
+}
+
+func TestLoadDedupeEmpty(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", LoadSize: 7, LoadWorkers: 1}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	qs := &lookupStore{QuadStore: h.QuadStore}
+	w, err := Deduplicating(qs, h.QuadWriter, cfg.LoadSize)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	const n = 20000
+	err = Load(w, cfg, &sliceUnmarshaler{quads: loadQuads(n)})
+	if err != nil {
+		t.Fatalf("Failed to load quads: %v", err)
+	}
+	if got := h.QuadStore.Size(); got != n {
+		t.Errorf("Unexpected store size, got:%d expect:%d", got, n)
+	}
+	// Only the false positives of the filter are looked up.
+	if qs.lookups > n/20 {
+		t.Errorf("Unexpected lookups loading into an empty store, got:%d expect at most:%d", qs.lookups, n/20)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+)
+
+// Migration configures the copy of a database into another by Migrate.
+type Migration struct {
+	// BatchSize is the number of quads written to the destination at
+	// once.
+	BatchSize int
+
+	// Workers is the number of batches read from the source at once,
+	// while the previous ones are written.
+	Workers int
+
+	// Checkpoint is the file recording the progress of the migration
+	// after each batch. If it exists, the migration resumes from it; it
+	// is removed once the migration is done.
+	Checkpoint string
+
+	// Progress, if set, is called after each batch with the number of
+	// quads migrated so far and the number to migrate.
+	Progress func(done, total int64)
+}
+
+// checkpoint is the progress of a migration, as saved in its checkpoint
+// file.
+type checkpoint struct {
+	Horizon int64 `json:"horizon"` // The revision of the source migrated.
+	Total   int64 `json:"total"`   // The number of quads to migrate.
+	First   int64 `json:"first"`   // The ID of the delta of the first quad.
+	Done    int64 `json:"done"`    // The number of quads migrated so far.
+}
+
+// Migrate copies the quads of from into to, and returns the number copied.
+//
+// It reads from as of its current horizon, if the backend keeps revisions,
+// so that writes may go on while it runs. The quads are written straight to
+// the store to, bypassing its writer, with delta IDs that end at the horizon
+// of from, so that to ends up at the same horizon if it started empty.
+// Quads to already holds are skipped, and the provenance of quads is kept if
+// both backends record it.
+func Migrate(from, to graph.QuadStore, m Migration) (int64, error) {
+	if m.BatchSize <= 0 {
+		m.BatchSize = 10000
+	}
+	if m.Workers <= 0 {
+		m.Workers = 1
+	}
+	cp, err := readCheckpoint(m.Checkpoint)
+	if err != nil {
+		return 0, err
+	}
+	resumed := cp != nil
+	if !resumed {
+		horizon := from.Horizon()
+		cp = &checkpoint{Horizon: horizon.Int()}
+	}
+	src, err := graph.AtRevision(from, cp.Horizon)
+	if err == graph.ErrNoRevisions {
+		src = from
+	} else if err != nil {
+		return 0, err
+	}
+	if !resumed {
+		if cp.Total, err = countQuads(src); err != nil {
+			return 0, err
+		}
+		cp.First = cp.Horizon - cp.Total + 1
+		horizon := to.Horizon()
+		if h := horizon.Int(); cp.First <= h {
+			clog.Warningf("Destination is at horizon %d; migrated quads will not keep the horizon %d of the source", h, cp.Horizon)
+			cp.First = h + 1
+		}
+	}
+
+	it := src.QuadsAllIterator()
+	defer it.Close()
+	for i := int64(0); i < cp.Done && graph.Next(it); i++ {
+	}
+
+	// Batches of values are read by one goroutine, converted to deltas by
+	// the workers, and written in order by this one.
+	type batch struct {
+		id     int64
+		values []graph.Value
+		deltas chan []graph.Delta
+	}
+	batches := make(chan *batch, m.Workers)
+	todo := make(chan *batch, m.Workers)
+	stop := make(chan struct{})
+	read := make(chan struct{})
+	defer func() {
+		// Let the reader finish with the iterator before it is closed.
+		close(stop)
+		<-read
+	}()
+	go func() {
+		defer close(read)
+		defer close(batches)
+		defer close(todo)
+		id := cp.First + cp.Done
+		for {
+			b := &batch{id: id, deltas: make(chan []graph.Delta, 1)}
+			for len(b.values) < m.BatchSize && graph.Next(it) {
+				b.values = append(b.values, it.Result())
+			}
+			if len(b.values) == 0 {
+				return
+			}
+			id += int64(len(b.values))
+			select {
+			case todo <- b:
+			case <-stop:
+				return
+			}
+			select {
+			case batches <- b:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	pk, _ := src.(graph.ProvenanceKeeper)
+	now := time.Now()
+	for i := 0; i < m.Workers; i++ {
+		go func() {
+			for b := range todo {
+				deltas := make([]graph.Delta, len(b.values))
+				for j, v := range b.values {
+					d := graph.Delta{
+						ID:        graph.NewSequentialKey(b.id + int64(j)),
+						Quad:      src.Quad(v),
+						Action:    graph.Add,
+						Timestamp: now,
+					}
+					if pk != nil {
+						if p, ok := pk.Provenance(v); ok {
+							d.Author, d.Source = p.Author, p.Source
+						}
+					}
+					deltas[j] = d
+				}
+				b.deltas <- deltas
+			}
+		}()
+	}
+
+	n := int64(0)
+	for b := range batches {
+		deltas := <-b.deltas
+		if err := to.ApplyDeltas(deltas, graph.IgnoreOpts{IgnoreDup: true}); err != nil {
+			return n, err
+		}
+		n += int64(len(deltas))
+		cp.Done += int64(len(deltas))
+		if err := writeCheckpoint(m.Checkpoint, cp); err != nil {
+			return n, err
+		}
+		if m.Progress != nil {
+			m.Progress(cp.Done, cp.Total)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	if m.Checkpoint != "" {
+		if err := os.Remove(m.Checkpoint); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// countQuads returns the number of quads in qs.
+func countQuads(qs graph.QuadStore) (int64, error) {
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	n := int64(0)
+	for graph.Next(it) {
+		n++
+	}
+	return n, it.Err()
+}
+
+func readCheckpoint(path string) (*checkpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// writeCheckpoint saves cp to path, replacing it at once so that a crash
+// leaves either the old or the new checkpoint.
+func writeCheckpoint(path string, cp *checkpoint) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+)
+
+func TestMigrate(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single"}
+	from, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer from.Close()
+	quads := SyntheticQuads(100)
+	from.QuadWriter.AddQuadSet(quads)
+	from.QuadWriter.RemoveQuad(quads[0])
+
+	dir, err := ioutil.TempDir("", "cayley_migrate")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	m := Migration{BatchSize: 7, Workers: 3, Checkpoint: filepath.Join(dir, "checkpoint")}
+
+	// An interrupted migration leaves a checkpoint to resume from.
+	stopped := &failingStore{QuadStore: newStore(t, cfg), after: 3}
+	if _, err := Migrate(from.QuadStore, stopped, m); err != errStopped {
+		t.Fatalf("Unexpected error from an interrupted migration, got:%v expect:%v", err, errStopped)
+	}
+	cp, err := readCheckpoint(m.Checkpoint)
+	if err != nil || cp == nil || cp.Done != 21 || cp.Total != 99 {
+		t.Fatalf("Unexpected checkpoint, got:%+v, %v expect:21 of 99 quads done", cp, err)
+	}
+
+	n, err := Migrate(from.QuadStore, stopped.QuadStore, m)
+	if err != nil {
+		t.Fatalf("Failed to resume the migration: %v", err)
+	}
+	if n != 78 {
+		t.Errorf("Unexpected number of quads migrated on resuming, got:%d expect:78", n)
+	}
+	if got, expect := allQuads(stopped.QuadStore), allQuads(from.QuadStore); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after migrating, got:%v expect:%v", got, expect)
+	}
+	got, expect := stopped.Horizon(), from.Horizon()
+	if got.Int() != expect.Int() {
+		t.Errorf("Unexpected horizon after migrating, got:%d expect:%d", got.Int(), expect.Int())
+	}
+	if _, err := os.Stat(m.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("Checkpoint left after the migration: %v", err)
+	}
+}
+
+var errStopped = errors.New("stopped")
+
+// failingStore fails to apply deltas after a number of batches.
+type failingStore struct {
+	graph.QuadStore
+	after int
+}
+
+func (s *failingStore) ApplyDeltas(deltas []graph.Delta, opts graph.IgnoreOpts) error {
+	if s.after == 0 {
+		return errStopped
+	}
+	s.after--
+	return s.QuadStore.ApplyDeltas(deltas, opts)
+}
+
+func newStore(t *testing.T, cfg *config.Config) graph.QuadStore {
+	qs, err := OpenQuadStore(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	return qs
+}
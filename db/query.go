@@ -0,0 +1,177 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/memory"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+	"github.com/google/cayley/query/gremlin"
+	"github.com/google/cayley/query/mql"
+)
+
+// ErrIncompleteQuery is returned when running a query that ends before it is
+// complete, such as with a block left open.
+var ErrIncompleteQuery = errors.New("incomplete query")
+
+// RunQuery runs a query in the given language, "gremlin" or "mql", against
+// the handle's store, and writes each of its results to w as JSON on a line
+// of its own. It returns the number of results written.
+func RunQuery(h *graph.Handle, lang, code string, cfg *config.Config, w io.Writer) (int, error) {
+	out, err := Query(h, lang, code, cfg)
+	if err != nil {
+		return 0, err
+	}
+	results, ok := out.([]interface{})
+	if !ok {
+		results = []interface{}{out}
+	}
+	enc := json.NewEncoder(w)
+	for i, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return i, err
+		}
+	}
+	return len(results), nil
+}
+
+// Query runs a query in the given language, "gremlin" or "mql", against the
+// handle's store, letting it write through the handle unless cfg is
+// read-only, and returns its collated results. Each query runs in a session
+// of its own, so that queries may run against one handle from several
+// goroutines at once.
+func Query(h *graph.Handle, lang, code string, cfg *config.Config) (interface{}, error) {
+	var qw graph.QuadWriter
+	if !cfg.ReadOnly {
+		qw = h.QuadWriter
+	}
+	return runQuery(h.QuadStore, qw, lang, code, cfg, false)
+}
+
+// StreamResults runs a parsed query in ses, and writes each of its results to
+// w as RunQuery does, but as soon as they are found rather than once the query
+// is done, so that they need not all fit in memory. MQL results, which are
+// built from all the paths found, are still written at the end. It returns
+// the number of results written.
+func StreamResults(ses query.HTTP, code string, w io.Writer) (int, error) {
+	_, single := ses.(*mql.Session)
+	c := make(chan interface{}, 5)
+	go ses.Execute(code, c, -1)
+	enc := json.NewEncoder(w)
+	var (
+		n   int
+		err error
+	)
+	write := func() {
+		out, rerr := ses.Results()
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		results, ok := out.([]interface{})
+		if !ok {
+			results = []interface{}{out}
+		}
+		for _, r := range results {
+			if err = enc.Encode(r); err != nil {
+				return
+			}
+			n++
+		}
+	}
+	for res := range c {
+		// Drain the results on error, so that the query finishes.
+		if err != nil {
+			continue
+		}
+		ses.Collate(res)
+		if !single {
+			write()
+		}
+	}
+	if err == nil {
+		// The results collated last, and any error of the query.
+		write()
+	}
+	return n, err
+}
+
+// Export runs a read-only query, as RunQuery does, against a snapshot of the
+// store if the backend keeps revisions, and writes the quads its results were
+// reached by, the subgraph it matched, to w, then closes w. It returns the
+// number of quads written.
+func Export(qs graph.QuadStore, lang, code string, cfg *config.Config, w quad.Writer) (int, error) {
+	out, err := runQuery(graph.Snapshot(qs), nil, lang, code, cfg, true)
+	quads, _ := out.([]quad.Quad)
+	n := 0
+	for ; err == nil && n < len(quads); n++ {
+		err = w.WriteQuad(quads[n])
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// runQuery runs a query against qs, letting it write to qw if it is not nil,
+// and returns its collated results, or the quads of its subgraph if subgraph
+// is set.
+func runQuery(qs graph.QuadStore, qw graph.QuadWriter, lang, code string, cfg *config.Config, subgraph bool) (interface{}, error) {
+	var ses query.HTTP
+	switch lang {
+	case "gremlin":
+		gs := gremlin.NewSession(qs, cfg.Timeout, false)
+		if qw != nil {
+			gs.SetWriter(qw)
+		}
+		ses = gs
+	case "mql":
+		ses = mql.NewSession(qs)
+	default:
+		return nil, fmt.Errorf("unsupported query language %q", lang)
+	}
+	if subgraph {
+		sg, ok := ses.(query.Subgrapher)
+		if !ok {
+			return nil, fmt.Errorf("query language %q cannot return subgraphs", lang)
+		}
+		sg.Subgraph(true)
+	}
+	if bs, ok := ses.(query.Budgeted); ok {
+		quota := memory.NewQuota()
+		defer quota.Close()
+		bs.SetQuota(quota)
+	}
+	result, err := ses.Parse(code)
+	switch result {
+	case query.ParseFail:
+		return nil, err
+	case query.ParseMore:
+		return nil, ErrIncompleteQuery
+	}
+	c := make(chan interface{}, 5)
+	go ses.Execute(code, c, -1)
+	for res := range c {
+		ses.Collate(res)
+	}
+	return ses.Results()
+}
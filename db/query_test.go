@@ -0,0 +1,211 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+	"github.com/google/cayley/query/gremlin"
+	"github.com/google/cayley/query/mql"
+)
+
+func TestRunQuery(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", Timeout: time.Minute}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	h.QuadWriter.AddQuadSet([]quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "follows", "charlie", ""},
+	})
+
+	var tests = []struct {
+		message string
+		lang    string
+		code    string
+		expect  string
+		err     bool
+	}{
+		{
+			message: "write each gremlin result on a line",
+			lang:    "gremlin",
+			code:    `g.V().Has("follows", "charlie").All()`,
+			expect:  "{\"id\":\"bob\"}\n",
+		},
+		{
+			message: "write the mql result",
+			lang:    "mql",
+			code:    `[{"id": "alice", "follows": null}]`,
+			expect:  "{\"follows\":\"bob\",\"id\":\"alice\"}\n",
+		},
+		{
+			message: "fail an incomplete query",
+			lang:    "gremlin",
+			code:    `g.V().Has("follows", "charlie").All(`,
+			err:     true,
+		},
+		{
+			message: "fail an unsupported language",
+			lang:    "sexp",
+			code:    `($a (:follows "bob"))`,
+			err:     true,
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		_, err := RunQuery(h, test.lang, test.code, cfg, &buf)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected an error to %s", test.message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to %s: %v", test.message, err)
+		} else if got := buf.String(); got != test.expect {
+			t.Errorf("Failed to %s, got:%q expect:%q", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestConcurrentQueries(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", Timeout: time.Minute}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	h.QuadWriter.AddQuad(quad.Quad{"alice", "follows", "bob", ""})
+
+	// Write while the queries run.
+	done := make(chan struct{})
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; i < 1000; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			h.QuadWriter.AddQuad(quad.Quad{fmt.Sprint("user", i), "follows", "bob", ""})
+		}
+	}()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		lang, code := "gremlin", `g.V().Has("follows", "bob").All()`
+		if i%2 == 1 {
+			lang, code = "mql", `[{"id": null, "follows": "bob"}]`
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := Query(h, lang, code, cfg)
+			if err == nil && len(out.([]interface{})) == 0 {
+				err = fmt.Errorf("no followers of bob in %s", lang)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-written
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Failed to run queries at once: %v", err)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", Timeout: time.Minute}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	h.QuadWriter.AddQuadSet([]quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "follows", "charlie", ""},
+		{"charlie", "status", "cool", ""},
+	})
+
+	var buf bytes.Buffer
+	n, err := Export(h.QuadStore, "gremlin", `g.V().Has("follows", "charlie").All()`, cfg, quad.FormatByName("nquad").Writer(&buf))
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	expect := "<bob> <follows> <charlie> .\n"
+	if n != 1 || buf.String() != expect {
+		t.Errorf("Unexpected export, got:%d %q expect:1 %q", n, buf.String(), expect)
+	}
+
+	_, err = Export(h.QuadStore, "gremlin", `g.V().Has("follows", "charlie").All(`, cfg, quad.FormatByName("nquad").Writer(&buf))
+	if err != ErrIncompleteQuery {
+		t.Errorf("Unexpected error exporting an incomplete query, got:%v expect:%v", err, ErrIncompleteQuery)
+	}
+}
+
+func TestStreamResults(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single", Timeout: time.Minute}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	h.QuadWriter.AddQuadSet([]quad.Quad{
+		{"alice", "follows", "charlie", ""},
+		{"bob", "follows", "charlie", ""},
+	})
+
+	for _, test := range []struct {
+		ses    query.HTTP
+		code   string
+		expect string
+	}{
+		{
+			ses:    gremlin.NewSession(h.QuadStore, cfg.Timeout, false),
+			code:   `g.V().Has("follows", "charlie").All()`,
+			expect: "{\"id\":\"alice\"}\n{\"id\":\"bob\"}\n",
+		},
+		{
+			ses:    mql.NewSession(h.QuadStore),
+			code:   `[{"id": null, "follows": "charlie"}]`,
+			expect: "{\"follows\":\"charlie\",\"id\":\"alice\"}\n{\"follows\":\"charlie\",\"id\":\"bob\"}\n",
+		},
+	} {
+		if _, err := test.ses.Parse(test.code); err != nil {
+			t.Fatalf("Failed to parse %s: %v", test.code, err)
+		}
+		var buf bytes.Buffer
+		n, err := StreamResults(test.ses, test.code, &buf)
+		if err != nil {
+			t.Errorf("Failed to stream %s: %v", test.code, err)
+		} else if n != 2 || buf.String() != test.expect {
+			t.Errorf("Unexpected results of %s, got:%d %q expect:2 %q", test.code, n, buf.String(), test.expect)
+		}
+	}
+}
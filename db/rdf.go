@@ -0,0 +1,116 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+// Defines writers of quads in the standard RDF formats, for loading into
+// other stores.
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/google/cayley/quad"
+)
+
+var iriEscaper = strings.NewReplacer(
+	" ", `\u0020`,
+	"<", `\u003C`,
+	">", `\u003E`,
+	`"`, `\u0022`,
+	"{", `\u007B`,
+	"}", `\u007D`,
+	"|", `\u007C`,
+	"^", `\u005E`,
+	"`", `\u0060`,
+	`\`, `\u005C`,
+)
+
+// rdfTerm returns the RDF term for a node name. IRIs, blank nodes and
+// literals, as read from N-Quads, are kept as they are; other names are
+// written as IRIs, which the cquads decoder reads back as the bare name.
+func rdfTerm(name string) string {
+	switch {
+	case strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">"),
+		strings.HasPrefix(name, "_:"),
+		strings.HasPrefix(name, `"`):
+		return name
+	}
+	return "<" + iriEscaper.Replace(name) + ">"
+}
+
+// nquadLine returns q as a line of N-Quads.
+func nquadLine(q quad.Quad) string {
+	terms := []string{rdfTerm(q.Subject), rdfTerm(q.Predicate), rdfTerm(q.Object)}
+	if q.Label != "" {
+		terms = append(terms, rdfTerm(q.Label))
+	}
+	return strings.Join(terms, " ") + " .\n"
+}
+
+// WriteNQuads writes quads to w in the N-Quads format.
+func WriteNQuads(w io.Writer, quads []quad.Quad) error {
+	bw := bufio.NewWriter(w)
+	for _, q := range quads {
+		if _, err := bw.WriteString(nquadLine(q)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteTurtle writes quads to w in the Turtle format, grouping the triples
+// of each subject, in the order the subjects first appear. Turtle has no
+// named graphs, so the labels of the quads are dropped.
+func WriteTurtle(w io.Writer, quads []quad.Quad) error {
+	type triple struct{ s, p, o string }
+	var (
+		subjects []string
+		preds    = make(map[string][]string)
+		objects  = make(map[[2]string][]string)
+		seen     = make(map[triple]bool)
+	)
+	for _, q := range quads {
+		t := triple{q.Subject, q.Predicate, q.Object}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if _, ok := preds[t.s]; !ok {
+			subjects = append(subjects, t.s)
+		}
+		sp := [2]string{t.s, t.p}
+		if _, ok := objects[sp]; !ok {
+			preds[t.s] = append(preds[t.s], t.p)
+		}
+		objects[sp] = append(objects[sp], rdfTerm(t.o))
+	}
+	bw := bufio.NewWriter(w)
+	for _, s := range subjects {
+		bw.WriteString(rdfTerm(s))
+		for i, p := range preds[s] {
+			if i > 0 {
+				bw.WriteString(" ;\n\t")
+			} else {
+				bw.WriteString(" ")
+			}
+			bw.WriteString(rdfTerm(p) + " " + strings.Join(objects[[2]string{s, p}], ", "))
+		}
+		if _, err := bw.WriteString(" .\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/cayley/quad"
+)
+
+var rdfQuads = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"A", "follows", "C", ""},
+	{"A", "<http://schema.org/name>", `"Alice"@en`, "my graph"},
+	{"_:b1", "follows", "A", ""},
+}
+
+func TestWriteNQuads(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteNQuads(&buf, rdfQuads); err != nil {
+		t.Fatalf("Could not write N-Quads: %v", err)
+	}
+	expect := `<A> <follows> <B> .
+<A> <follows> <C> .
+<A> <http://schema.org/name> "Alice"@en <my\u0020graph> .
+_:b1 <follows> <A> .
+`
+	if got := buf.String(); got != expect {
+		t.Errorf("Unexpected N-Quads, got:\n%s\nexpect:\n%s", got, expect)
+	}
+}
+
+func TestWriteTurtle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteTurtle(&buf, rdfQuads); err != nil {
+		t.Fatalf("Could not write Turtle: %v", err)
+	}
+	expect := `<A> <follows> <B>, <C> ;
+	<http://schema.org/name> "Alice"@en .
+_:b1 <follows> <A> .
+`
+	if got := buf.String(); got != expect {
+		t.Errorf("Unexpected Turtle, got:\n%s\nexpect:\n%s", got, expect)
+	}
+}
@@ -15,18 +15,24 @@
 package db
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/peterh/liner"
 
 	"github.com/google/cayley/config"
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/memory"
 	"github.com/google/cayley/quad/cquads"
 	"github.com/google/cayley/query"
 	"github.com/google/cayley/query/gremlin"
@@ -38,30 +44,96 @@ func trace(s string) (string, time.Time) {
 	return s, time.Now()
 }
 
-func un(s string, startTime time.Time) {
+func un(w io.Writer, s string, startTime time.Time) {
 	endTime := time.Now()
 
-	fmt.Printf(s, float64(endTime.UnixNano()-startTime.UnixNano())/float64(1E6))
+	fmt.Fprintf(w, s, float64(endTime.UnixNano()-startTime.UnixNano())/float64(1E6))
 }
 
-func Run(query string, ses query.Session) {
+func Run(q string, ses query.Session) {
+	runTo(os.Stdout, q, ses)
+}
+
+// runTo is Run, writing the results to w.
+func runTo(w io.Writer, q string, ses query.Session) {
 	nResults := 0
 	startTrace, startTime := trace("Elapsed time: %g ms\n\n")
 	defer func() {
 		if nResults > 0 {
-			un(startTrace, startTime)
+			un(w, startTrace, startTime)
 		}
 	}()
-	fmt.Printf("\n")
+	if bs, ok := ses.(query.Budgeted); ok {
+		quota := memory.NewQuota()
+		defer quota.Close()
+		bs.SetQuota(quota)
+	}
+	fmt.Fprintf(w, "\n")
 	c := make(chan interface{}, 5)
-	go ses.Execute(query, c, 100)
+	go ses.Execute(q, c, -1)
 	for res := range c {
-		fmt.Print(ses.Format(res))
+		fmt.Fprint(w, ses.Format(res))
 		nResults++
 	}
 	if nResults > 0 {
-		fmt.Printf("-----------\n%d Results\n", nResults)
+		fmt.Fprintf(w, "-----------\n%d Results\n", nResults)
+	}
+}
+
+// jobs are the queries run in the background with :bg. Each runs in a
+// session of its own, alongside the queries typed at the prompt, and its
+// output is printed at the prompt once it is done.
+type jobs struct {
+	sync.Mutex
+	last    int
+	running map[int]string
+	done    []string
+}
+
+// start runs the query in the background in ses, which is its own.
+func (j *jobs) start(code string, ses query.Session) int {
+	j.Lock()
+	defer j.Unlock()
+	if j.running == nil {
+		j.running = make(map[int]string)
+	}
+	j.last++
+	id := j.last
+	j.running[id] = code
+	go func() {
+		var buf bytes.Buffer
+		runTo(&buf, code, ses)
+		j.Lock()
+		delete(j.running, id)
+		j.done = append(j.done, fmt.Sprintf("[%d] Done: %s\n%s", id, code, buf.String()))
+		j.Unlock()
+	}()
+	return id
+}
+
+// finished returns the output of the jobs done since it was last called.
+func (j *jobs) finished() []string {
+	j.Lock()
+	defer j.Unlock()
+	done := j.done
+	j.done = nil
+	return done
+}
+
+// list returns the jobs still running, in the order they were started.
+func (j *jobs) list() []string {
+	j.Lock()
+	defer j.Unlock()
+	ids := make([]int, 0, len(j.running))
+	for id := range j.running {
+		ids = append(ids, id)
 	}
+	sort.Ints(ids)
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = fmt.Sprintf("[%d] Running: %s", id, j.running[id])
+	}
+	return list
 }
 
 const (
@@ -69,26 +141,53 @@ const (
 	ps2 = "...     "
 
 	history = ".cayley_history"
+
+	// predicateScanLimit is the most quads scanned for the predicates
+	// to complete.
+	predicateScanLimit = 100000
 )
 
-func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
-	var ses query.Session
+// historyPath returns the path of the history file, in the home directory
+// if there is one.
+func historyPath() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, history)
+	}
+	return history
+}
+
+// newReplSession returns a session for the REPL in the given language, which
+// is Gremlin unless it is "sexp" or "mql". A persistent session keeps the
+// variables of Gremlin queries for those after.
+func newReplSession(h *graph.Handle, queryLanguage string, cfg *config.Config, persist bool) query.Session {
 	switch queryLanguage {
 	case "sexp":
-		ses = sexp.NewSession(h.QuadStore)
+		return sexp.NewSession(h.QuadStore)
 	case "mql":
-		ses = mql.NewSession(h.QuadStore)
-	case "gremlin":
-		fallthrough
-	default:
-		ses = gremlin.NewSession(h.QuadStore, cfg.Timeout, true)
+		return mql.NewSession(h.QuadStore)
+	}
+	gs := gremlin.NewSession(h.QuadStore, cfg.Timeout, persist)
+	if !cfg.ReadOnly {
+		gs.SetWriter(h.QuadWriter)
 	}
+	return gs
+}
+
+func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
+	if queryLanguage != "sexp" && queryLanguage != "mql" {
+		queryLanguage = "gremlin"
+	}
+	ses := newReplSession(h, queryLanguage, cfg, true)
+	var bg jobs
 
-	term, err := terminal(history)
+	path := historyPath()
+	term, err := terminal(path)
 	if os.IsNotExist(err) {
-		fmt.Printf("creating new history file: %q\n", history)
+		fmt.Printf("creating new history file: %q\n", path)
 	}
-	defer persist(term, history)
+	defer persist(term, path)
+	term.SetCtrlCAborts(true)
+	term.SetWordCompleter(newCompleter(ses, h.QuadStore).complete)
 
 	var (
 		prompt = ps1
@@ -97,12 +196,20 @@ func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
 	)
 
 	for {
+		for _, out := range bg.finished() {
+			fmt.Print(out)
+		}
 		if len(code) == 0 {
 			prompt = ps1
 		} else {
 			prompt = ps2
 		}
 		line, err := term.Prompt(prompt)
+		if err == liner.ErrPromptAborted {
+			// Abandon the query being typed.
+			code = ""
+			continue
+		}
 		if err != nil {
 			if err == io.EOF {
 				fmt.Println()
@@ -111,9 +218,13 @@ func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
 			return err
 		}
 
-		term.AppendHistory(line)
-
 		line = strings.TrimSpace(line)
+		if code != "" && len(line) == 0 {
+			fmt.Println("Error: incomplete query")
+			term.AppendHistory(strings.Replace(code, "\n", " ", -1))
+			code = ""
+			continue
+		}
 		if len(line) == 0 || line[0] == '#' {
 			continue
 		}
@@ -123,6 +234,7 @@ func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
 
 			switch cmd {
 			case ":debug":
+				term.AppendHistory(line)
 				args = strings.TrimSpace(args)
 				var debug bool
 				switch args {
@@ -142,6 +254,7 @@ func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
 				continue
 
 			case ":a":
+				term.AppendHistory(line)
 				quad, err := cquads.Parse(args)
 				if err != nil {
 					fmt.Printf("Error: not a valid quad: %v\n", err)
@@ -152,6 +265,7 @@ func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
 				continue
 
 			case ":d":
+				term.AppendHistory(line)
 				quad, err := cquads.Parse(args)
 				if err != nil {
 					fmt.Printf("Error: not a valid quad: %v\n", err)
@@ -160,17 +274,139 @@ func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
 				h.QuadWriter.RemoveQuad(quad)
 				continue
 
+			case ":save":
+				term.AppendHistory(line)
+				name, text := splitLine(args)
+				text = strings.TrimSpace(text)
+				if name == "" || text == "" {
+					fmt.Println("Error: usage is :save <name> <query>")
+					continue
+				}
+				if cfg.ReadOnly {
+					fmt.Println("Error: database is read-only")
+					continue
+				}
+				err := query.SaveQuery(h.QuadStore, h.QuadWriter, query.Saved{Name: name, Lang: queryLanguage, Query: text})
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
+
+			case ":run":
+				term.AppendHistory(line)
+				s, err := query.SavedQuery(h.QuadStore, strings.TrimSpace(args))
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				if s.Lang != queryLanguage {
+					fmt.Printf("Error: query %q is in %s, not %s\n", s.Name, s.Lang, queryLanguage)
+					continue
+				}
+				if result, err := ses.Parse(s.Query); result != query.Parsed {
+					fmt.Println("Error: ", err)
+					continue
+				}
+				Run(s.Query, ses)
+				continue
+
+			case ":export":
+				term.AppendHistory(line)
+				file, text := splitLine(args)
+				text = strings.TrimSpace(text)
+				if file == "" || text == "" {
+					fmt.Println("Error: usage is :export <file> <query>")
+					continue
+				}
+				hs, ok := ses.(query.HTTP)
+				if !ok {
+					fmt.Printf("Error: cannot export %s results\n", queryLanguage)
+					continue
+				}
+				if result, err := ses.Parse(text); result != query.Parsed {
+					if result == query.ParseMore {
+						err = ErrIncompleteQuery
+					}
+					fmt.Println("Error: ", err)
+					continue
+				}
+				n, err := exportResults(hs, text, file)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				fmt.Printf("Exported %d results to %s\n", n, file)
+				continue
+
+			case ":bg":
+				term.AppendHistory(line)
+				text := strings.TrimSpace(args)
+				if text == "" {
+					fmt.Println("Error: usage is :bg <query>")
+					continue
+				}
+				// A session of its own, without the variables of
+				// the prompt's.
+				bs := newReplSession(h, queryLanguage, cfg, false)
+				if result, err := bs.Parse(text); result != query.Parsed {
+					if result == query.ParseMore {
+						err = ErrIncompleteQuery
+					}
+					fmt.Println("Error: ", err)
+					continue
+				}
+				fmt.Printf("[%d] Started\n", bg.start(text, bs))
+				continue
+
+			case ":jobs":
+				term.AppendHistory(line)
+				for _, job := range bg.list() {
+					fmt.Println(job)
+				}
+				continue
+
+			case ":saved":
+				term.AppendHistory(line)
+				list, err := query.SavedQueries(h.QuadStore)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				for _, s := range list {
+					fmt.Printf("%s (%s): %s\n", s.Name, s.Lang, s.Query)
+				}
+				continue
+
+			case ":forget":
+				term.AppendHistory(line)
+				if cfg.ReadOnly {
+					fmt.Println("Error: database is read-only")
+					continue
+				}
+				err := query.DeleteSavedQuery(h.QuadStore, h.QuadWriter, strings.TrimSpace(args))
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
+
 			default:
 				if cmd[0] == ':' {
+					term.AppendHistory(line)
 					fmt.Printf("Unknown command: %q\n", cmd)
 					continue
 				}
 			}
 		}
 
+		if code != "" {
+			code += "\n"
+		}
 		code += line
 
 		result, err := ses.Parse(code)
+		if result != query.ParseMore {
+			// A query typed over several lines is recalled as one.
+			term.AppendHistory(strings.Replace(code, "\n", " ", -1))
+		}
 		switch result {
 		case query.Parsed:
 			Run(code, ses)
@@ -183,6 +419,120 @@ func Repl(h *graph.Handle, queryLanguage string, cfg *config.Config) error {
 	}
 }
 
+// exportResults runs a query, writing its results to the file as they are
+// found, and returns the number written.
+func exportResults(ses query.HTTP, code, path string) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	n, err := StreamResults(ses, code, w)
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// replCommands are the commands of the REPL, completed at the start of a
+// line.
+var replCommands = []string{":a", ":bg", ":d", ":debug", ":export", ":forget", ":jobs", ":run", ":save", ":saved"}
+
+// completer completes the word being typed in the REPL: the name of a
+// predicate within a string, a member after a dot and a global or a REPL
+// command otherwise, if the session is a query.Completer.
+type completer struct {
+	ses query.Session
+	qs  graph.QuadStore
+
+	// predicates are the predicates of the first quads of the store,
+	// listed on first use.
+	predicates []string
+}
+
+func newCompleter(ses query.Session, qs graph.QuadStore) *completer {
+	return &completer{ses: ses, qs: qs}
+}
+
+func (c *completer) complete(line string, pos int) (head string, completions []string, tail string) {
+	start := pos
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	head, word, tail := line[:start], line[start:pos], line[pos:]
+
+	var names []string
+	qc, _ := c.ses.(query.Completer)
+	switch {
+	case inString(head):
+		// A string may hold spaces, so complete all of it.
+		i := strings.LastIndexAny(head, `"'`)
+		head, word = line[:i+1], line[i+1:pos]
+		names = c.knownPredicates()
+	case strings.HasSuffix(head, "."):
+		if qc != nil {
+			names = qc.Members()
+		}
+	case strings.TrimSpace(head) == "" && strings.HasPrefix(word, ":"):
+		names = replCommands
+	default:
+		if qc != nil {
+			names = qc.Globals()
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			completions = append(completions, name)
+		}
+	}
+	return head, completions, tail
+}
+
+// knownPredicates returns the predicates of up to predicateScanLimit quads
+// of the store, sorted.
+func (c *completer) knownPredicates() []string {
+	if c.predicates != nil {
+		return c.predicates
+	}
+	c.predicates = []string{}
+	seen := make(map[string]bool)
+	it := c.qs.QuadsAllIterator()
+	defer it.Close()
+	for n := 0; n < predicateScanLimit && graph.Next(it); n++ {
+		p := c.qs.Quad(it.Result()).Predicate
+		if !seen[p] {
+			seen[p] = true
+			c.predicates = append(c.predicates, p)
+		}
+	}
+	sort.Strings(c.predicates)
+	return c.predicates
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '$' || b == ':' ||
+		'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// inString returns whether a line ends within a quoted string.
+func inString(line string) bool {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch b := line[i]; {
+		case quote != 0 && b == '\\':
+			i++
+		case quote != 0 && b == quote:
+			quote = 0
+		case quote == 0 && (b == '"' || b == '\''):
+			quote = b
+		}
+	}
+	return quote != 0
+}
+
 // Splits a line into a command and its arguments
 // e.g. ":a b c d ." will be split into ":a" and " b c d ."
 func splitLine(line string) (string, string) {
@@ -211,7 +561,7 @@ func terminal(path string) (*liner.State, error) {
 		signal.Notify(c, os.Interrupt, os.Kill)
 		<-c
 
-		err := persist(term, history)
+		err := persist(term, path)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to properly clean up terminal: %v\n", err)
 			os.Exit(1)
@@ -230,7 +580,9 @@ func terminal(path string) (*liner.State, error) {
 }
 
 func persist(term *liner.State, path string) error {
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	// The history read at the start is written back with the lines added
+	// since, up to the limit of the terminal.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
 	if err != nil {
 		return fmt.Errorf("could not open %q to append history: %v", path, err)
 	}
@@ -15,7 +15,15 @@
 package db
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query/gremlin"
 )
 
 var testSplitLines = []struct {
@@ -64,3 +72,71 @@ func TestSplitLines(t *testing.T) {
 		}
 	}
 }
+
+func TestCompleter(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	w.AddQuadSet([]quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "follows", "alice", ""},
+		{"bob", "status", "cool", ""},
+	})
+	c := newCompleter(gremlin.NewSession(qs, time.Second, false), qs)
+
+	for _, test := range []struct {
+		line        string
+		head        string
+		completions []string
+		tail        string
+	}{
+		{`g.V("alice").Ou`, `g.V("alice").`, []string{"Out"}, ""},
+		{`g.V("alice").Out("fo`, `g.V("alice").Out("`, []string{"follows"}, ""},
+		{`g.V("alice").Out('s`, `g.V("alice").Out('`, []string{"status"}, ""},
+		{`gr`, ``, []string{"graph"}, ""},
+		{`:de`, ``, []string{":debug"}, ""},
+	} {
+		head, completions, tail := c.complete(test.line, len(test.line))
+		if head != test.head || !reflect.DeepEqual(completions, test.completions) || tail != test.tail {
+			t.Errorf("Unexpected completion of %q, got:%q,%q,%q expect:%q,%q,%q",
+				test.line, head, completions, tail, test.head, test.completions, test.tail)
+		}
+	}
+}
+
+func TestJobs(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	w.AddQuad(quad.Quad{"alice", "follows", "bob", ""})
+
+	var bg jobs
+	code := `g.V().Has("follows", "bob").All()`
+	ses := gremlin.NewSession(qs, time.Second, false)
+	if id := bg.start(code, ses); id != 1 {
+		t.Errorf("Unexpected ID of the first job, got:%d expect:1", id)
+	}
+	var done []string
+	for i := 0; i < 100 && len(done) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		done = bg.finished()
+	}
+	if len(done) != 1 || !strings.HasPrefix(done[0], "[1] Done: "+code) || !strings.Contains(done[0], "id : alice") {
+		t.Errorf("Unexpected output of a background query, got:%q", done)
+	}
+	if list := bg.list(); len(list) != 0 {
+		t.Errorf("Unexpected jobs running, got:%q", list)
+	}
+}
+
+func TestInString(t *testing.T) {
+	for line, want := range map[string]bool{
+		`g.V("a`:       true,
+		`g.V("a")`:     false,
+		`g.V("a\"b`:    true,
+		`g.V('it"s`:    true,
+		`g.V("it's").`: false,
+	} {
+		if got := inString(line); got != want {
+			t.Errorf("Unexpected result for %q, got:%t expect:%t", line, got, want)
+		}
+	}
+}
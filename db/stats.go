@@ -0,0 +1,59 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+)
+
+// DefaultStatsSample is the number of quads read by default to count the
+// quads of each predicate.
+const DefaultStatsSample = 100000
+
+// Stats returns the statistics of the store of h, as graph.ReadStats does,
+// along with the size on disk of the database cfg names, if it is persisted
+// under a local path.
+func Stats(h *graph.Handle, cfg *config.Config, sample int64) (graph.Stats, error) {
+	st, err := h.Stats(sample)
+	if err != nil {
+		return st, err
+	}
+	if graph.IsPersistent(cfg.DatabaseType) && cfg.DatabasePath != "" {
+		st.DiskSize, err = diskSize(cfg.DatabasePath)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	return st, err
+}
+
+// diskSize returns the total size of the regular files at path.
+func diskSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
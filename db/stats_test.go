@@ -0,0 +1,72 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/cayley/config"
+)
+
+func TestStats(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", ReplicationType: "single"}
+	h, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer h.Close()
+	h.QuadWriter.AddQuadSet(SyntheticQuads(100))
+
+	st, err := Stats(h, cfg, 0)
+	if err != nil {
+		t.Fatalf("Failed to read the stats: %v", err)
+	}
+	if st.Quads != 100 || st.Horizon != 100 || st.Sampled != 0 || st.DiskSize != 0 {
+		t.Errorf("Unexpected stats: %+v", st)
+	}
+	if st.Predicates["name"] != 21 || st.Predicates["status"] != 21 || st.Predicates["follows"] != 58 {
+		t.Errorf("Unexpected predicate counts: %v", st.Predicates)
+	}
+	// 21 people with 21 names, 3 statuses, 3 predicates and a label.
+	if st.Nodes != 49 {
+		t.Errorf("Unexpected number of nodes, got:%d expect:49", st.Nodes)
+	}
+
+	// The first quads are all names, so the sample has only names.
+	st, err = Stats(h, cfg, 10)
+	if err != nil {
+		t.Fatalf("Failed to read the sampled stats: %v", err)
+	}
+	if st.Sampled != 10 || len(st.Predicates) != 1 || st.Predicates["name"] != 100 {
+		t.Errorf("Unexpected sampled stats: %+v", st)
+	}
+}
+
+func TestDiskSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_stats")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a"), make([]byte, 10), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 5), 0644)
+	if n, err := diskSize(dir); err != nil || n != 15 {
+		t.Errorf("Unexpected disk size, got:%d, %v expect:15", n, err)
+	}
+}
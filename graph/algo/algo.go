@@ -0,0 +1,149 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package algo runs graph algorithms over the links of any QuadStore: each
+// quad is an edge from its subject to its object.
+//
+// The algorithms read the edges into memory once, so they suit graphs whose
+// node names fit in memory. Their results may be written back to the store
+// as quads, to be queried like any other.
+package algo
+
+import (
+	"strconv"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// Options selects the edges an algorithm runs over. To restrict it to some
+// named graphs, run it over a store from labels.Restrict.
+type Options struct {
+	// Predicates, if set, are the only predicates whose quads are edges.
+	Predicates []string
+
+	// Undirected treats every edge as going both ways. Connected components
+	// are always computed this way.
+	Undirected bool
+}
+
+// adjacency is the edges of a graph, between nodes numbered in the order
+// they were first seen. A pair of nodes linked by several quads has a single
+// edge.
+type adjacency struct {
+	names []string
+	index map[string]int
+	out   [][]int
+	in    [][]int
+}
+
+func (a *adjacency) node(name string) int {
+	if i, ok := a.index[name]; ok {
+		return i
+	}
+	i := len(a.names)
+	a.index[name] = i
+	a.names = append(a.names, name)
+	a.out = append(a.out, nil)
+	a.in = append(a.in, nil)
+	return i
+}
+
+func load(qs graph.QuadStore, opts Options) (*adjacency, error) {
+	a := &adjacency{index: make(map[string]int)}
+	type edge struct{ from, to int }
+	seen := make(map[edge]bool)
+	add := func(it graph.Iterator) error {
+		defer it.Close()
+		for graph.Next(it) {
+			q := qs.Quad(it.Result())
+			e := edge{a.node(q.Subject), a.node(q.Object)}
+			if opts.Undirected && e.to < e.from {
+				e.from, e.to = e.to, e.from
+			}
+			if seen[e] {
+				continue
+			}
+			seen[e] = true
+			a.out[e.from] = append(a.out[e.from], e.to)
+			a.in[e.to] = append(a.in[e.to], e.from)
+			if opts.Undirected && e.from != e.to {
+				a.out[e.to] = append(a.out[e.to], e.from)
+				a.in[e.from] = append(a.in[e.from], e.to)
+			}
+		}
+		return it.Err()
+	}
+	if len(opts.Predicates) == 0 {
+		return a, add(qs.QuadsAllIterator())
+	}
+	for _, p := range opts.Predicates {
+		v := qs.ValueOf(p)
+		if v == nil {
+			continue
+		}
+		if err := add(qs.QuadIterator(quad.Predicate, v)); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Scores maps node names to the result of an algorithm for them.
+type Scores map[string]float64
+
+// Quads returns a quad for each node, linking it to its score through the
+// predicate, in the given label.
+func (s Scores) Quads(predicate, label string) []quad.Quad {
+	out := make([]quad.Quad, 0, len(s))
+	for n, v := range s {
+		out = append(out, quad.Quad{
+			Subject:   n,
+			Predicate: predicate,
+			Object:    strconv.FormatFloat(v, 'g', -1, 64),
+			Label:     label,
+		})
+	}
+	return out
+}
+
+// Write replaces the quads with the predicate in the given label of qs,
+// which qw writes to, with those of the scores.
+func (s Scores) Write(qs graph.QuadStore, qw graph.QuadWriter, predicate, label string) error {
+	have, err := graph.MatchingQuads(qs, quad.Quad{Predicate: predicate, Label: label})
+	if err != nil {
+		return err
+	}
+	current := make(map[quad.Quad]bool, len(have))
+	for _, q := range have {
+		if q.Label == label {
+			current[q] = true
+		}
+	}
+	tx := graph.NewTransaction()
+	for _, q := range s.Quads(predicate, label) {
+		if current[q] {
+			delete(current, q)
+			continue
+		}
+		tx.AddQuad(q)
+	}
+	for q := range current {
+		tx.RemoveQuad(q)
+	}
+	if len(tx.Deltas) == 0 {
+		return nil
+	}
+	return qw.ApplyTransaction(tx)
+}
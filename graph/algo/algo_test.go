@@ -0,0 +1,215 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package algo
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+// a -> b -> c -> a is a cycle, fed by d; e -> f is apart, and the status
+// quad only counts when every predicate does.
+var testGraph = []quad.Quad{
+	{Subject: "a", Predicate: "follows", Object: "b"},
+	{Subject: "b", Predicate: "follows", Object: "c"},
+	{Subject: "c", Predicate: "follows", Object: "a"},
+	{Subject: "c", Predicate: "follows", Object: "a", Label: "work"},
+	{Subject: "d", Predicate: "follows", Object: "a"},
+	{Subject: "e", Predicate: "follows", Object: "f"},
+	{Subject: "f", Predicate: "status", Object: "cool"},
+}
+
+var follows = Options{Predicates: []string{"follows"}}
+
+func makeTestStore(t *testing.T) (graph.QuadStore, graph.QuadWriter) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	if err := w.AddQuadSet(testGraph); err != nil {
+		t.Fatalf("Could not load quads: %v", err)
+	}
+	return qs, w
+}
+
+func TestPageRank(t *testing.T) {
+	qs, _ := makeTestStore(t)
+	ranks, err := PageRank(qs, PageRankOptions{Options: follows})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var sum float64
+	for _, r := range ranks {
+		sum += r
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		t.Errorf("Ranks do not sum to one, got:%v", sum)
+	}
+	if len(ranks) != 6 {
+		t.Errorf("Unexpected number of ranks, got:%d expect:6", len(ranks))
+	}
+	if !(ranks["a"] > ranks["b"] && ranks["b"] > ranks["f"] && ranks["f"] > ranks["d"]) {
+		t.Errorf("Unexpected order of ranks: %v", ranks)
+	}
+}
+
+func TestConnectedComponents(t *testing.T) {
+	qs, _ := makeTestStore(t)
+	got, err := ConnectedComponents(qs, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expect := Scores{"a": 0, "b": 0, "c": 0, "d": 0, "e": 1, "f": 1, "cool": 1}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected components, got:%v expect:%v", got, expect)
+	}
+}
+
+func TestDegreeCentrality(t *testing.T) {
+	qs, _ := makeTestStore(t)
+	for _, test := range []struct {
+		dir        quad.Direction
+		undirected bool
+		expect     Scores
+	}{
+		{quad.Subject, false, Scores{"a": 0.2, "b": 0.2, "c": 0.2, "d": 0.2, "e": 0.2, "f": 0}},
+		{quad.Object, false, Scores{"a": 0.4, "b": 0.2, "c": 0.2, "d": 0, "e": 0, "f": 0.2}},
+		{quad.Any, false, Scores{"a": 0.6, "b": 0.4, "c": 0.4, "d": 0.2, "e": 0.2, "f": 0.2}},
+		{quad.Any, true, Scores{"a": 0.6, "b": 0.4, "c": 0.4, "d": 0.2, "e": 0.2, "f": 0.2}},
+	} {
+		opts := follows
+		opts.Undirected = test.undirected
+		got, err := DegreeCentrality(qs, test.dir, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected degrees for %v (undirected:%v), got:%v expect:%v", test.dir, test.undirected, got, test.expect)
+		}
+	}
+	if _, err := DegreeCentrality(qs, quad.Label, follows); err == nil {
+		t.Error("Expected an error for the label direction")
+	}
+}
+
+func TestShortestPaths(t *testing.T) {
+	qs, _ := makeTestStore(t)
+	p, err := ShortestPaths(qs, "d", follows)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expect := (Scores{"d": 0, "a": 1, "b": 2, "c": 3}); !reflect.DeepEqual(p.Dist, expect) {
+		t.Errorf("Unexpected distances, got:%v expect:%v", p.Dist, expect)
+	}
+	if got, expect := p.To("c"), []string{"d", "a", "b", "c"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected path, got:%v expect:%v", got, expect)
+	}
+	if got := p.To("e"); got != nil {
+		t.Errorf("Unexpected path to an unreachable node: %v", got)
+	}
+
+	p, _ = ShortestPaths(qs, "c", Options{Predicates: follows.Predicates, Undirected: true})
+	if got, expect := p.To("d"), []string{"c", "a", "d"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected undirected path, got:%v expect:%v", got, expect)
+	}
+}
+
+func TestAllPaths(t *testing.T) {
+	qs, _ := makeTestStore(t)
+	undirected := Options{Predicates: follows.Predicates, Undirected: true}
+	var tests = []struct {
+		message string
+		opts    AllPathsOptions
+		expect  map[string][][]string
+	}{
+		{
+			message: "find every path",
+			opts:    AllPathsOptions{Options: undirected},
+			expect: map[string][][]string{
+				"a": {{"a"}},
+				"b": {{"a", "b"}, {"a", "c", "b"}},
+				"c": {{"a", "c"}, {"a", "b", "c"}},
+				"d": {{"a", "d"}},
+			},
+		},
+		{
+			message: "keep one path per node",
+			opts:    AllPathsOptions{Options: undirected, MaxPerNode: 1},
+			expect: map[string][][]string{
+				"a": {{"a"}},
+				"b": {{"a", "b"}},
+				"c": {{"a", "c"}},
+				"d": {{"a", "d"}},
+			},
+		},
+		{
+			message: "follow at most one edge",
+			opts:    AllPathsOptions{Options: undirected, MaxDepth: 1},
+			expect: map[string][][]string{
+				"a": {{"a"}},
+				"b": {{"a", "b"}},
+				"c": {{"a", "c"}},
+				"d": {{"a", "d"}},
+			},
+		},
+		{
+			message: "follow edges forward",
+			opts:    AllPathsOptions{Options: follows},
+			expect: map[string][][]string{
+				"a": {{"a"}},
+				"b": {{"a", "b"}},
+				"c": {{"a", "b", "c"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		got, err := AllPaths(qs, "a", test.opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	qs, w := makeTestStore(t)
+	scores, _ := ConnectedComponents(qs, follows)
+	if err := scores.Write(qs, w, "component", "algo"); err != nil {
+		t.Fatalf("Could not write scores: %v", err)
+	}
+	// Rewriting after the graph changes replaces the old results.
+	w.RemoveQuad(quad.Quad{Subject: "e", Predicate: "follows", Object: "f"})
+	scores, _ = ConnectedComponents(qs, follows)
+	if err := scores.Write(qs, w, "component", "algo"); err != nil {
+		t.Fatalf("Could not rewrite scores: %v", err)
+	}
+	have, _ := graph.MatchingQuads(qs, quad.Quad{Predicate: "component", Label: "algo"})
+	var got []string
+	for _, q := range have {
+		got = append(got, q.Subject+"="+q.Object)
+	}
+	sort.Strings(got)
+	if expect := []string{"a=0", "b=0", "c=0", "d=0"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected written scores, got:%v expect:%v", got, expect)
+	}
+}
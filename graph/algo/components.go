@@ -0,0 +1,76 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package algo
+
+import (
+	"sort"
+
+	"github.com/google/cayley/graph"
+)
+
+// ConnectedComponents numbers the connected components of the graph, not
+// minding the direction of edges, and returns the number of each node's
+// component. Components are numbered from zero, in the order of the
+// smallest node name in each.
+func ConnectedComponents(qs graph.QuadStore, opts Options) (Scores, error) {
+	opts.Undirected = true
+	a, err := load(qs, opts)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, len(a.names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Sort(byName{order, a.names})
+
+	component := make([]int, len(a.names))
+	for i := range component {
+		component[i] = -1
+	}
+	c := 0
+	for _, start := range order {
+		if component[start] >= 0 {
+			continue
+		}
+		component[start] = c
+		stack := []int{start}
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, j := range a.out[i] {
+				if component[j] < 0 {
+					component[j] = c
+					stack = append(stack, j)
+				}
+			}
+		}
+		c++
+	}
+	s := make(Scores, len(a.names))
+	for i, name := range a.names {
+		s[name] = float64(component[i])
+	}
+	return s, nil
+}
+
+type byName struct {
+	nodes []int
+	names []string
+}
+
+func (b byName) Len() int           { return len(b.nodes) }
+func (b byName) Less(i, j int) bool { return b.names[b.nodes[i]] < b.names[b.nodes[j]] }
+func (b byName) Swap(i, j int)      { b.nodes[i], b.nodes[j] = b.nodes[j], b.nodes[i] }
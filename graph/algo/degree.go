@@ -0,0 +1,53 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package algo
+
+import (
+	"fmt"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// DegreeCentrality returns the degree of each node divided by the number of
+// other nodes. The degree counts the edges leaving the node for
+// quad.Subject, those reaching it for quad.Object, and both for quad.Any.
+// With opts.Undirected, all three are the same.
+func DegreeCentrality(qs graph.QuadStore, d quad.Direction, opts Options) (Scores, error) {
+	if d != quad.Subject && d != quad.Object && d != quad.Any {
+		return nil, fmt.Errorf("algo: invalid direction for degree: %v", d)
+	}
+	a, err := load(qs, opts)
+	if err != nil {
+		return nil, err
+	}
+	s := make(Scores, len(a.names))
+	others := float64(len(a.names) - 1)
+	for i, name := range a.names {
+		var deg int
+		if d == quad.Subject || d == quad.Any || opts.Undirected {
+			deg += len(a.out[i])
+		}
+		if (d == quad.Object || d == quad.Any) && !opts.Undirected {
+			deg += len(a.in[i])
+		}
+		if others == 0 {
+			s[name] = 0
+			continue
+		}
+		s[name] = float64(deg) / others
+	}
+	return s, nil
+}
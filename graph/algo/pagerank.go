@@ -0,0 +1,95 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package algo
+
+import (
+	"math"
+
+	"github.com/google/cayley/graph"
+)
+
+// PageRankOptions tunes PageRank. Zero fields take the default values.
+type PageRankOptions struct {
+	Options
+
+	// Damping is the probability of following an edge rather than jumping
+	// to a random node. Defaults to 0.85.
+	Damping float64
+
+	// Iterations is the most rounds to run. Defaults to 100.
+	Iterations int
+
+	// Tolerance stops the rounds once the ranks change by less than it in
+	// total. Defaults to 1e-6.
+	Tolerance float64
+}
+
+// PageRank returns the PageRank of every node, which sum to one. The rank of
+// nodes without outgoing edges is spread over all nodes.
+func PageRank(qs graph.QuadStore, opts PageRankOptions) (Scores, error) {
+	if opts.Damping == 0 {
+		opts.Damping = 0.85
+	}
+	if opts.Iterations == 0 {
+		opts.Iterations = 100
+	}
+	if opts.Tolerance == 0 {
+		opts.Tolerance = 1e-6
+	}
+	a, err := load(qs, opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	n := len(a.names)
+	if n == 0 {
+		return Scores{}, nil
+	}
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for round := 0; round < opts.Iterations; round++ {
+		var dangling float64
+		for i, out := range a.out {
+			if len(out) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-opts.Damping)/float64(n) + opts.Damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, out := range a.out {
+			share := opts.Damping * rank[i] / float64(len(out))
+			for _, j := range out {
+				next[j] += share
+			}
+		}
+		var delta float64
+		for i := range rank {
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if delta < opts.Tolerance {
+			break
+		}
+	}
+	s := make(Scores, n)
+	for i, name := range a.names {
+		s[name] = rank[i]
+	}
+	return s, nil
+}
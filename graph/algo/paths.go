@@ -0,0 +1,150 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package algo
+
+import (
+	"github.com/google/cayley/graph"
+)
+
+// Paths holds the shortest paths from a source node to every node reachable
+// from it.
+type Paths struct {
+	Source string
+
+	// Dist is the number of edges on the shortest path to each reachable
+	// node, zero for the source itself.
+	Dist Scores
+
+	prev map[string]string
+}
+
+// ShortestPaths finds the shortest paths from source, following edges from
+// subject to object unless opts.Undirected is set. Every edge counts as one
+// step. A source that is not in the graph reaches only itself.
+func ShortestPaths(qs graph.QuadStore, source string, opts Options) (*Paths, error) {
+	a, err := load(qs, opts)
+	if err != nil {
+		return nil, err
+	}
+	p := &Paths{
+		Source: source,
+		Dist:   Scores{source: 0},
+		prev:   make(map[string]string),
+	}
+	start, ok := a.index[source]
+	if !ok {
+		return p, nil
+	}
+	dist := make([]int, len(a.names))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[start] = 0
+	queue := []int{start}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, j := range a.out[i] {
+			if dist[j] >= 0 {
+				continue
+			}
+			dist[j] = dist[i] + 1
+			p.Dist[a.names[j]] = float64(dist[j])
+			p.prev[a.names[j]] = a.names[i]
+			queue = append(queue, j)
+		}
+	}
+	return p, nil
+}
+
+// To returns the nodes on a shortest path from the source to node, both
+// included, or nil if node is not reachable.
+func (p *Paths) To(node string) []string {
+	if _, ok := p.Dist[node]; !ok {
+		return nil
+	}
+	out := []string{node}
+	for node != p.Source {
+		node = p.prev[node]
+		out = append(out, node)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// AllPathsOptions tunes AllPaths. Zero fields take the default values.
+type AllPathsOptions struct {
+	Options
+
+	// MaxPerNode is the most paths kept to each node. Defaults to 10.
+	MaxPerNode int
+
+	// MaxDepth, if positive, is the most edges on a path.
+	MaxDepth int
+}
+
+// AllPaths finds the paths from source to every node reachable from it, each
+// as the nodes on it from the source to the node, both included. Paths do
+// not visit a node twice. They are found shortest first, and only the paths
+// kept to a node are followed past it, so the paths kept are the shortest
+// ones.
+func AllPaths(qs graph.QuadStore, source string, opts AllPathsOptions) (map[string][][]string, error) {
+	if opts.MaxPerNode == 0 {
+		opts.MaxPerNode = 10
+	}
+	a, err := load(qs, opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][][]string{source: {{source}}}
+	start, ok := a.index[source]
+	if !ok {
+		return out, nil
+	}
+	kept := make([]int, len(a.names))
+	kept[start] = 1
+	queue := [][]int{{start}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if opts.MaxDepth > 0 && len(p) > opts.MaxDepth {
+			continue
+		}
+	next:
+		for _, j := range a.out[p[len(p)-1]] {
+			if kept[j] >= opts.MaxPerNode {
+				continue
+			}
+			for _, i := range p {
+				if i == j {
+					continue next
+				}
+			}
+			np := make([]int, len(p)+1)
+			copy(np, p)
+			np[len(p)] = j
+			kept[j]++
+			names := make([]string, len(np))
+			for k, i := range np {
+				names[k] = a.names[i]
+			}
+			out[a.names[j]] = append(out[a.names[j]], names)
+			queue = append(queue, np)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"sync"
+
+	"github.com/google/cayley/quad"
+)
+
+// DefaultBatchSize is the number of quads a BatchWriter adds at once if it is
+// not given a batch size, that of cayley load.
+const DefaultBatchSize = 10000
+
+// BatchWriter adds quads to a store in sets, which disk backends write far
+// faster than single quads. It may be used by several goroutines.
+type BatchWriter struct {
+	mu   sync.Mutex
+	qw   QuadWriter
+	size int
+	buf  []quad.Quad
+}
+
+// NewWriter returns a writer that collects the quads added to it and adds
+// them to the handle's store batchSize at a time, or DefaultBatchSize if it is
+// not positive. The last quads are only added when the writer is flushed or
+// closed.
+func (h *Handle) NewWriter(batchSize int) *BatchWriter {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &BatchWriter{
+		qw:   h.QuadWriter,
+		size: batchSize,
+		buf:  make([]quad.Quad, 0, batchSize),
+	}
+}
+
+// AddQuad adds q to the batch, adding the batch to the store if it is full.
+func (w *BatchWriter) AddQuad(q quad.Quad) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, q)
+	if len(w.buf) < w.size {
+		return nil
+	}
+	return w.flush()
+}
+
+// AddQuadSet adds each quad of set to the batch, as AddQuad does.
+func (w *BatchWriter) AddQuadSet(set []quad.Quad) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(set) > 0 {
+		n := w.size - len(w.buf)
+		if n > len(set) {
+			n = len(set)
+		}
+		w.buf = append(w.buf, set[:n]...)
+		set = set[n:]
+		if len(w.buf) < w.size {
+			break
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush adds the quads of the batch to the store. If they cannot be added,
+// they are dropped and the error is returned.
+func (w *BatchWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *BatchWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.qw.AddQuadSet(w.buf)
+	w.buf = make([]quad.Quad, 0, w.size)
+	return err
+}
+
+// Close flushes the writer. It does not close the store.
+func (w *BatchWriter) Close() error {
+	return w.Flush()
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"testing"
+
+	"github.com/google/cayley/quad"
+)
+
+type setRecorder struct {
+	QuadWriter
+	sets [][]quad.Quad
+}
+
+func (r *setRecorder) AddQuadSet(set []quad.Quad) error {
+	r.sets = append(r.sets, set)
+	return nil
+}
+
+func TestBatchWriter(t *testing.T) {
+	rec := &setRecorder{}
+	w := (&Handle{QuadWriter: rec}).NewWriter(3)
+	for i := 0; i < 4; i++ {
+		w.AddQuad(quad.Quad{Subject: string(rune('a' + i)), Predicate: "p", Object: "o"})
+	}
+	if len(rec.sets) != 1 || len(rec.sets[0]) != 3 {
+		t.Fatalf("Unexpected batches after four quads: %v", rec.sets)
+	}
+	w.AddQuadSet([]quad.Quad{
+		{Subject: "e", Predicate: "p", Object: "o"},
+		{Subject: "f", Predicate: "p", Object: "o"},
+		{Subject: "g", Predicate: "p", Object: "o"},
+	})
+	if len(rec.sets) != 2 || len(rec.sets[1]) != 3 || rec.sets[1][0].Subject != "d" {
+		t.Fatalf("Unexpected batches after a set: %v", rec.sets)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rec.sets) != 3 || len(rec.sets[2]) != 1 || rec.sets[2][0].Subject != "g" {
+		t.Errorf("Unexpected batches after closing: %v", rec.sets)
+	}
+	w.Flush()
+	if len(rec.sets) != 3 {
+		t.Errorf("Flushing an empty batch wrote %v", rec.sets[3:])
+	}
+}
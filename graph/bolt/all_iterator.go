@@ -18,9 +18,9 @@ import (
 	"bytes"
 	"fmt"
 
-	"github.com/barakmich/glog"
 	"github.com/boltdb/bolt"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
@@ -93,25 +93,25 @@ func (it *AllIterator) Next() bool {
 			i := 0
 			b := tx.Bucket(it.bucket)
 			cur := b.Cursor()
+			var k, v []byte
 			if last == nil {
-				k, _ := cur.First()
-				var out []byte
-				out = make([]byte, len(k))
-				copy(out, k)
-				it.buffer = append(it.buffer, out)
-				i++
+				k, v = cur.First()
 			} else {
-				k, _ := cur.Seek(last)
+				k, _ = cur.Seek(last)
 				if !bytes.Equal(k, last) {
 					return fmt.Errorf("could not pick up after %v", k)
 				}
+				k, v = cur.Next()
 			}
-			for i < bufferSize {
-				k, _ := cur.Next()
+			for ; i < bufferSize; k, v = cur.Next() {
 				if k == nil {
 					it.buffer = append(it.buffer, k)
 					break
 				}
+				// Deleted quads are kept in the indexes with their history.
+				if it.dir != quad.Any && !it.qs.isLiveValue(v) {
+					continue
+				}
 				var out []byte
 				out = make([]byte, len(k))
 				copy(out, k)
@@ -121,7 +121,7 @@ func (it *AllIterator) Next() bool {
 			return nil
 		})
 		if err != nil {
-			glog.Error("Error nexting in database: ", err)
+			clog.Error("Error nexting in database: ", err)
 			it.err = err
 			it.done = true
 			return false
@@ -0,0 +1,101 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/internal/bloom"
+	"github.com/google/cayley/quad"
+)
+
+const (
+	// DefaultBloomFilterSize is the least number of nodes the Bloom filters
+	// of an index are sized for.
+	DefaultBloomFilterSize = 1 << 20
+
+	bloomFalsePositive = 0.01
+)
+
+// blooms holds a Bloom filter over the nodes found in each direction of the
+// quads of a store, indexed by direction. QuadIterator consults it so that
+// looking for a node in a direction it has never been in, which is most of
+// the checks of a large intersection, reads nothing from the database.
+type blooms [4]*bloom.Filter
+
+// bloomsFromOptions returns whether the "bloom_filters" option is set, and
+// the number of nodes the filters should be sized for, as given by the
+// "bloom_filter_size" option, or zero to size them for the store.
+func bloomsFromOptions(options graph.Options) (bool, int, error) {
+	enabled, _, err := options.BoolKey("bloom_filters")
+	if err != nil || !enabled {
+		return false, 0, err
+	}
+	size, _, err := options.IntKey("bloom_filter_size")
+	if err != nil {
+		return false, 0, err
+	}
+	return true, size, nil
+}
+
+// buildBlooms fills the Bloom filters with the nodes of every quad in the
+// store, sizing them for twice its quads unless size is given. Deleted quads
+// are added too; they only cost false positives.
+func (qs *QuadStore) buildBlooms(size int) error {
+	if size <= 0 {
+		size = int(2 * qs.size)
+		if size < DefaultBloomFilterSize {
+			size = DefaultBloomFilterSize
+		}
+	}
+	qs.blooms = new(blooms)
+	for i := range qs.blooms {
+		qs.blooms[i] = bloom.New(size, bloomFalsePositive)
+	}
+	return qs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(spoBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			for i := range spo {
+				qs.blooms[spo[i]-1].Add(k[i*hashSize : (i+1)*hashSize])
+			}
+			return nil
+		})
+	})
+}
+
+// addToBlooms adds the nodes of a quad to the Bloom filters, if there are
+// any.
+func (qs *QuadStore) addToBlooms(q quad.Quad) {
+	if qs.blooms == nil {
+		return
+	}
+	for _, d := range spo {
+		qs.blooms[d-1].Add(hashOf(q.Get(d)))
+	}
+}
+
+// mayHave returns whether there may be quads with the node in the direction.
+func (qs *QuadStore) mayHave(d quad.Direction, tok *Token) bool {
+	if qs.blooms == nil || !bytes.Equal(tok.bucket, nodeBucket) {
+		return true
+	}
+	return qs.blooms[d-1].MayContain(tok.key)
+}
@@ -15,14 +15,19 @@
 package bolt
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/graphtest"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
 	"github.com/google/cayley/writer"
@@ -465,3 +470,317 @@ func TestOptimize(t *testing.T) {
 		t.Errorf("Discordant tag results, new:%v old:%v", newResults, oldResults)
 	}
 }
+
+func TestExpiry(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	err = createNewBolt(tmpFile.Name(), nil)
+	if err != nil {
+		t.Fatal("Failed to create Bolt database.", err)
+	}
+	qs, err := newQuadStore(tmpFile.Name(), nil)
+	if qs == nil || err != nil {
+		t.Fatal("Failed to create Bolt QuadStore.")
+	}
+	defer qs.Close()
+
+	w, _ := writer.NewSingleReplication(qs, graph.Options{"sweep_interval_ms": float64(0)})
+	defer w.Close()
+	quads := makeQuadSet()
+	now := time.Now()
+	w.AddQuadSet(quads[:5])
+	err = w.(graph.ExpiringWriter).AddQuadSetExpiring(quads[5:8], now.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("Failed to add expiring quads: %v", err)
+	}
+	err = w.(graph.ExpiringWriter).AddQuadSetExpiring(quads[8:], now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to add expiring quads: %v", err)
+	}
+
+	// Removing and re-adding a quad without expiry drops its expiry.
+	w.RemoveQuad(quads[7])
+	w.AddQuad(quads[7])
+
+	expired, err := qs.(graph.Expirer).ExpiredQuads(now)
+	if err != nil {
+		t.Fatalf("Failed to list expired quads: %v", err)
+	}
+	expect := []quad.Quad{quads[5], quads[6]}
+	sort.Sort(ordered(expired))
+	sort.Sort(ordered(expect))
+	if !reflect.DeepEqual(expired, expect) {
+		t.Errorf("Unexpected expired quads, got:%v expect:%v", expired, expect)
+	}
+
+	n, err := w.(*writer.Single).RemoveExpired()
+	if err != nil || n != 2 {
+		t.Errorf("Unexpected result removing expired quads, got:%d, %v expect:2", n, err)
+	}
+	if s := qs.Size(); s != 9 {
+		t.Errorf("Unexpected quadstore size after expiry, got:%d expect:9", s)
+	}
+	expired, _ = qs.(graph.Expirer).ExpiredQuads(now.Add(2 * time.Hour))
+	if len(expired) != 3 {
+		t.Errorf("Unexpected number of quads expiring later, got:%d expect:3", len(expired))
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	opts := graph.Options{"encryption_key": "000102030405060708090a0b0c0d0e0f"}
+	err = createNewBolt(tmpFile.Name(), opts)
+	if err != nil {
+		t.Fatal("Failed to create Bolt database.", err)
+	}
+	qs, err := newQuadStore(tmpFile.Name(), opts)
+	if qs == nil || err != nil {
+		t.Fatal("Failed to create Bolt QuadStore.", err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+	w.Close()
+	qs.Close()
+
+	data, err := ioutil.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Could not read database file: %v", err)
+	}
+	if bytes.Contains(data, []byte("status_graph")) {
+		t.Error("Database file contains plain text node names")
+	}
+
+	_, err = newQuadStore(tmpFile.Name(), nil)
+	if err == nil {
+		t.Error("Opened encrypted database without a key")
+	}
+
+	qs, err = newQuadStore(tmpFile.Name(), opts)
+	if err != nil {
+		t.Fatalf("Failed to reopen encrypted database: %v", err)
+	}
+	defer qs.Close()
+	if s := qs.Size(); s != 11 {
+		t.Errorf("Unexpected quadstore size, got:%d expect:11", s)
+	}
+	it := qs.QuadIterator(quad.Subject, qs.ValueOf("D"))
+	got := iteratedQuads(qs, it)
+	expect := []quad.Quad{
+		{"D", "follows", "B", ""},
+		{"D", "follows", "G", ""},
+		{"D", "status", "cool", "status_graph"},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads from encrypted database, got:%v expect:%v", got, expect)
+	}
+}
+
+func TestBloomFilters(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	err = createNewBolt(tmpFile.Name(), nil)
+	if err != nil {
+		t.Fatal("Failed to create Bolt database.", err)
+	}
+	opts := graph.Options{"bloom_filters": true}
+	qs, err := newQuadStore(tmpFile.Name(), opts)
+	if err != nil {
+		t.Fatalf("Failed to create Bolt QuadStore: %v", err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+
+	for i := 0; i < 2; i++ {
+		if it := qs.QuadIterator(quad.Subject, qs.ValueOf("cool")); it.Type() != graph.Null {
+			t.Errorf("Unexpected iterator for a node never in the direction, got:%v expect:%v", it.Type(), graph.Null)
+		}
+		got := iteratedQuads(qs, qs.QuadIterator(quad.Object, qs.ValueOf("cool")))
+		if len(got) != 3 {
+			t.Errorf("Unexpected quads for a node in the direction, got:%v", got)
+		}
+		// Reopen the store, building the filters from the quads on disk.
+		qs.Close()
+		qs, err = newQuadStore(tmpFile.Name(), opts)
+		if err != nil {
+			t.Fatalf("Failed to reopen Bolt QuadStore: %v", err)
+		}
+	}
+	qs.Close()
+}
+
+func TestReadOnly(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	err = createNewBolt(tmpFile.Name(), nil)
+	if err != nil {
+		t.Fatal("Failed to create Bolt database.", err)
+	}
+	qs, err := newQuadStore(tmpFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create Bolt QuadStore: %v", err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+
+	opts := graph.Options{"read_only": true}
+	if _, err := newQuadStore(tmpFile.Name(), opts); err != ErrLocked {
+		t.Errorf("Unexpected error opening a database being written, got:%v expect:%v", err, ErrLocked)
+	}
+	qs.Close()
+
+	// Readers share the database.
+	var readers []graph.QuadStore
+	for i := 0; i < 2; i++ {
+		r, err := newQuadStore(tmpFile.Name(), opts)
+		if err != nil {
+			t.Fatalf("Failed to open Bolt QuadStore read-only: %v", err)
+		}
+		defer r.Close()
+		readers = append(readers, r)
+	}
+	for _, r := range readers {
+		if s := r.Size(); s != 11 {
+			t.Errorf("Unexpected size read-only, got:%d expect:11", s)
+		}
+		got := iteratedQuads(r, r.QuadIterator(quad.Object, r.ValueOf("cool")))
+		if len(got) != 3 {
+			t.Errorf("Unexpected quads read-only, got:%v", got)
+		}
+	}
+	err = readers[0].ApplyDeltas([]graph.Delta{{Quad: quad.Quad{"A", "follows", "G", ""}, Action: graph.Add}}, graph.IgnoreOpts{})
+	if err != graph.ErrReadOnly {
+		t.Errorf("Unexpected error writing read-only, got:%v expect:%v", err, graph.ErrReadOnly)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s, closer := makeStore(t)
+	defer closer()
+	qs := s.(*QuadStore)
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+
+	rep, err := qs.Verify(false)
+	if err != nil {
+		t.Fatalf("Failed to verify store: %v", err)
+	}
+	if !rep.OK() || rep.Quads != int64(len(makeQuadSet())) {
+		t.Fatalf("Unexpected report for a sound store: %+v", rep)
+	}
+
+	// Lose an index entry, orphan another and miscount a node.
+	err = qs.update(true, func(tx *bolt.Tx) error {
+		q := quad.Quad{"A", "follows", "B", ""}
+		if err := tx.Bucket(posBucket).Delete(qs.createKeyFor(pos, q)); err != nil {
+			return err
+		}
+		q = quad.Quad{"X", "follows", "Y", ""}
+		if err := tx.Bucket(ospBucket).Put(qs.createKeyFor(osp, q), []byte("{}")); err != nil {
+			return err
+		}
+		return qs.UpdateValueKeyBy("B", 5, tx)
+	})
+	if err != nil {
+		t.Fatalf("Failed to damage store: %v", err)
+	}
+
+	rep, err = qs.Verify(false)
+	if err != nil {
+		t.Fatalf("Failed to verify store: %v", err)
+	}
+	if len(rep.Problems) != 3 || rep.Repaired != 0 {
+		t.Fatalf("Unexpected report for a damaged store: %+v", rep)
+	}
+	rep, err = qs.Verify(true)
+	if err != nil || rep.Repaired != 3 {
+		t.Fatalf("Unexpected repair of a damaged store: %+v, %v", rep, err)
+	}
+	rep, err = qs.Verify(false)
+	if err != nil || !rep.OK() {
+		t.Fatalf("Unexpected report for a repaired store: %+v, %v", rep, err)
+	}
+	if got := qs.SizeOf(qs.ValueOf("B")); got != 5 {
+		t.Errorf("Unexpected size of repaired node, got:%d expect:5", got)
+	}
+}
+
+func TestBackgroundCompact(t *testing.T) {
+	s, closer := makeStore(t)
+	defer closer()
+	qs := s.(*QuadStore)
+	w, _ := writer.NewSingleReplication(qs, graph.Options{"compact_interval_ms": 1.0})
+	defer w.Close()
+	w.AddQuadSet(makeQuadSet())
+	w.RemoveQuad(quad.Quad{"A", "follows", "B", ""})
+
+	expect := len(makeQuadSet()) - 1
+	for i := 0; i < 100; i++ {
+		var n int
+		qs.db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket(spoBucket).Stats().KeyN
+			return nil
+		})
+		if n == expect {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Deleted quads were not compacted in the background")
+}
+
+func makeStore(t testing.TB) (graph.QuadStore, func()) {
+	return makeStoreWith(t, nil)
+}
+
+func makeStoreWith(t testing.TB, opts graph.Options) (graph.QuadStore, func()) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	tmpFile.Close()
+	err = createNewBolt(tmpFile.Name(), nil)
+	if err != nil {
+		os.RemoveAll(tmpFile.Name())
+		t.Fatal("Failed to create Bolt database.", err)
+	}
+	qs, err := newQuadStore(tmpFile.Name(), opts)
+	if err != nil {
+		os.RemoveAll(tmpFile.Name())
+		t.Fatal("Failed to create Bolt QuadStore.", err)
+	}
+	return qs, func() {
+		qs.Close()
+		os.RemoveAll(tmpFile.Name())
+	}
+}
+
+func TestConformance(t *testing.T) {
+	graphtest.TestAll(t, makeStore)
+}
+
+func TestSortedConformance(t *testing.T) {
+	graphtest.TestAll(t, func(t testing.TB) (graph.QuadStore, func()) {
+		return makeStoreWith(t, graph.Options{"sorted_iteration": true})
+	})
+}
+
+func BenchmarkConformance(b *testing.B) {
+	graphtest.BenchmarkAll(b, makeStore)
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/google/cayley/graph"
+)
+
+// Compact purges the quads deleted before the given time, and rewrites the
+// node values from the spo bucket, removing those no quad refers to and
+// recounting the others.
+//
+// Bolt cannot shrink the file of an open database: the pages freed are kept
+// for later writes to reuse, so that the file stops growing until they are
+// used up, and After is the size of the file, which is unchanged.
+func (qs *QuadStore) Compact(before time.Time) (graph.CompactStats, error) {
+	var stats graph.CompactStats
+	if qs.snapshot {
+		return stats, graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return stats, graph.ErrReadOnly
+	}
+	stats.Before = qs.diskSize()
+	n, err := qs.Purge(before)
+	if err != nil {
+		return stats, err
+	}
+	stats.Quads = n
+	err = qs.update(true, func(tx *bolt.Tx) error {
+		return qs.rewriteValues(tx, &stats)
+	})
+	if err != nil {
+		return stats, err
+	}
+	stats.After = qs.diskSize()
+	return stats, nil
+}
+
+// rewriteValues removes the node values no spo entry refers to, and rewrites
+// those whose size is not their number of live quads.
+func (qs *QuadStore) rewriteValues(tx *bolt.Tx, stats *graph.CompactStats) error {
+	// The keys of the spo bucket are the hashes of the nodes of their
+	// quads, which are the keys of their values. Deleted quads keep their
+	// nodes referenced, at size 0.
+	noLabel := hashOf("")
+	sizes := make(map[string]int64)
+	c := tx.Bucket(spoBucket).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var entry IndexEntry
+		err := qs.unmarshal(v, &entry)
+		if err != nil {
+			return err
+		}
+		var n int64
+		if _, ok := qs.liveSince(entry.History); ok {
+			n = 1
+		}
+		for i := 0; i+hashSize <= len(k); i += hashSize {
+			h := k[i : i+hashSize]
+			if i == 3*hashSize && bytes.Equal(h, noLabel) {
+				continue
+			}
+			sizes[string(h)] += n
+		}
+	}
+
+	var writes []write
+	c = tx.Bucket(nodeBucket).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var value ValueData
+		err := qs.unmarshal(v, &value)
+		if err != nil {
+			return err
+		}
+		n, ok := sizes[string(k)]
+		if !ok {
+			writes = append(writes, write{nodeBucket, append([]byte(nil), k...), nil})
+			stats.Nodes++
+		} else if n != value.Size {
+			w, err := qs.valueWrite(value.Name, n)
+			if err != nil {
+				return err
+			}
+			writes = append(writes, *w)
+			stats.Values++
+		}
+	}
+	// Deleting while iterating would skip entries, so write afterwards.
+	b := tx.Bucket(nodeBucket)
+	b.FillPercent = localFillPercent
+	for _, w := range writes {
+		var err error
+		if w.value == nil {
+			err = b.Delete(w.key)
+		} else {
+			err = b.Put(w.key, w.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diskSize returns the size of the file of the database.
+func (qs *QuadStore) diskSize() int64 {
+	fi, err := os.Stat(qs.db.Path())
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
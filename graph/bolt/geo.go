@@ -0,0 +1,165 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// The geo bucket is keyed by the geohashes of the nodes that are geographic
+// points, followed by the hashes of their names. The geoIndexBuilt key of
+// the meta bucket records that the points held before the index was kept
+// have been added to it.
+//
+// Encrypted stores keep no index, as its keys would give away where the
+// points are.
+var geoBucket = []byte("geo")
+
+const geoIndexBuilt = "geo"
+
+// geoBatchSize is the number of entries written at once while building the
+// geohash index.
+const geoBatchSize = 10000
+
+func geoKey(geohash uint64) []byte {
+	key := make([]byte, 8, 8+hashSize)
+	binary.BigEndian.PutUint64(key, geohash)
+	return key
+}
+
+func createGeoKeyFor(name string, p quad.GeoPoint) []byte {
+	return append(geoKey(p.Geohash()), hashOf(name)...)
+}
+
+// indexGeo updates the geohash index once the deltas have been applied,
+// flushing it to disk if sync is set, as the deltas were.
+func (qs *QuadStore) indexGeo(deltas []graph.Delta, sync bool) error {
+	if qs.cipher != nil {
+		return nil
+	}
+	added, removed := graph.GeoChanges(qs, deltas)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return qs.update(sync, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(geoBucket)
+		if err != nil {
+			return err
+		}
+		for _, name := range added {
+			p, _ := quad.ParseGeoPoint(name)
+			if err := b.Put(createGeoKeyFor(name, p), []byte{}); err != nil {
+				return err
+			}
+		}
+		for _, name := range removed {
+			p, _ := quad.ParseGeoPoint(name)
+			if err := b.Delete(createGeoKeyFor(name, p)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// buildGeoIndex adds the points the store holds to the geohash index, unless
+// it has been done already.
+func (qs *QuadStore) buildGeoIndex() error {
+	if qs.cipher != nil {
+		return nil
+	}
+	var built bool
+	err := qs.db.View(func(tx *bolt.Tx) error {
+		built = tx.Bucket(metaBucket).Get([]byte(geoIndexBuilt)) != nil
+		return nil
+	})
+	if err != nil || built {
+		return err
+	}
+	if qs.readOnly {
+		clog.Warningln("The geohash index is not built; queries near points scan the store until it is opened writable")
+		qs.scanNear = true
+		return nil
+	}
+	if qs.size > 0 {
+		clog.Infof("Building the geohash index of %d quads", qs.size)
+	}
+	// The keys are gathered first, as the quads are read in transactions
+	// of their own, which must not be held while writing.
+	var keys [][]byte
+	err = graph.GeoObjects(qs, func(name string, p quad.GeoPoint) error {
+		keys = append(keys, createGeoKeyFor(name, p))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		n := len(keys)
+		if n > geoBatchSize {
+			n = geoBatchSize
+		}
+		err := qs.update(true, func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(geoBucket)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys[:n] {
+				if err := b.Put(key, []byte{}); err != nil {
+					return err
+				}
+			}
+			if n == len(keys) {
+				return tx.Bucket(metaBucket).Put([]byte(geoIndexBuilt), []byte{})
+			}
+			return nil
+		})
+		if err != nil || n == len(keys) {
+			return err
+		}
+		keys = keys[n:]
+	}
+}
+
+func (qs *QuadStore) NearIterator(center quad.GeoPoint, radius float64) graph.Iterator {
+	if qs.cipher != nil || qs.scanNear {
+		return graph.ScanNear(qs, center, radius)
+	}
+	var nodes []graph.Value
+	qs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(geoBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for _, r := range center.GeohashRanges(radius) {
+			limit := geoKey(r.To)
+			for k, _ := c.Seek(geoKey(r.From)); k != nil && bytes.Compare(k, limit) < 0; k, _ = c.Next() {
+				key := make([]byte, len(k)-8)
+				copy(key, k[8:])
+				nodes = append(nodes, &Token{bucket: nodeBucket, key: key})
+			}
+		}
+		return nil
+	})
+	return graph.NearIteratorOf(qs, center, radius, nodes)
+}
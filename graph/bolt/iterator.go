@@ -16,13 +16,12 @@ package bolt
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 
-	"github.com/barakmich/glog"
 	"github.com/boltdb/bolt"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
@@ -56,7 +55,7 @@ type Iterator struct {
 func NewIterator(bucket []byte, d quad.Direction, value graph.Value, qs *QuadStore) *Iterator {
 	tok := value.(*Token)
 	if !bytes.Equal(tok.bucket, nodeBucket) {
-		glog.Error("creating an iterator from a non-node value")
+		clog.Error("creating an iterator from a non-node value")
 		return &Iterator{done: true}
 	}
 
@@ -113,13 +112,9 @@ func (it *Iterator) Close() error {
 	return nil
 }
 
-func (it *Iterator) isLiveValue(val []byte) bool {
-	var entry IndexEntry
-	json.Unmarshal(val, &entry)
-	return len(entry.History)%2 != 0
-}
-
 func (it *Iterator) Next() bool {
+	// The result of Contains is only kept until the next call.
+	it.result = nil
 	if it.done {
 		return false
 	}
@@ -134,31 +129,26 @@ func (it *Iterator) Next() bool {
 			i := 0
 			b := tx.Bucket(it.bucket)
 			cur := b.Cursor()
+			var k, v []byte
 			if last == nil {
-				k, _ := cur.Seek(it.checkID)
-				if bytes.HasPrefix(k, it.checkID) {
-					var out []byte
-					out = make([]byte, len(k))
-					copy(out, k)
-					it.buffer = append(it.buffer, out)
-					i++
-				} else {
+				k, v = cur.Seek(it.checkID)
+				if !bytes.HasPrefix(k, it.checkID) {
 					it.buffer = append(it.buffer, nil)
 					return errNotExist
 				}
 			} else {
-				k, _ := cur.Seek(last)
+				k, _ = cur.Seek(last)
 				if !bytes.Equal(k, last) {
 					return fmt.Errorf("could not pick up after %v", k)
 				}
+				k, v = cur.Next()
 			}
-			for i < bufferSize {
-				k, v := cur.Next()
+			for ; i < bufferSize; k, v = cur.Next() {
 				if k == nil || !bytes.HasPrefix(k, it.checkID) {
 					it.buffer = append(it.buffer, nil)
 					break
 				}
-				if !it.isLiveValue(v) {
+				if !it.qs.isLiveValue(v) {
 					continue
 				}
 				var out []byte
@@ -171,7 +161,7 @@ func (it *Iterator) Next() bool {
 		})
 		if err != nil {
 			if err != errNotExist {
-				glog.Errorf("Error nexting in database: %v", err)
+				clog.Errorf("Error nexting in database: %v", err)
 				it.err = err
 			}
 			it.done = true
@@ -284,6 +274,7 @@ func (it *Iterator) Contains(v graph.Value) bool {
 		// However, if it ever starts coming from somewhere else, it'll be more
 		// efficient to change the interface of the graph.Value for LevelDB to a
 		// struct with a flag for isValid, to save another random read.
+		it.result = val
 		return true
 	}
 	return false
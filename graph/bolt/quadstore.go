@@ -23,12 +23,15 @@ import (
 	"fmt"
 	"hash"
 	"sync"
+	"time"
 
-	"github.com/barakmich/glog"
 	"github.com/boltdb/bolt"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/internal/crypt"
+	"github.com/google/cayley/internal/lru"
 	"github.com/google/cayley/quad"
 )
 
@@ -42,10 +45,18 @@ var (
 	}
 	hashSize         = sha1.Size
 	localFillPercent = 0.7
+
+	// ErrLocked is returned when opening a database read-only while a
+	// process writing it holds it locked.
+	ErrLocked = errors.New("bolt: database is locked by a process writing it")
 )
 
 const (
 	QuadStoreType = "bolt"
+
+	// lockTimeout is how long opening a database read-only waits for a
+	// process writing it to release it.
+	lockTimeout = time.Second
 )
 
 type Token struct {
@@ -63,17 +74,53 @@ type QuadStore struct {
 	open    bool
 	size    int64
 	horizon int64
+	cipher  *crypt.Cipher
+	watch   graph.Notifier
+
+	// names caches the names of node values, which never change as the
+	// values are hashes of them.
+	names *lru.Cache
+
+	// blooms, if set, filters the nodes looked for in each index.
+	blooms *blooms
+
+	// syncs decides which writes are flushed to disk.
+	syncs *graph.SyncBatcher
+
+	// sorted is whether every node and quad is listed in order.
+	sorted bool
+
+	// search is the text index of the store, if it keeps one.
+	search graph.FullTextIndexer
+
+	// readOnly is whether the database was opened with the "read_only"
+	// option, sharing its files with other processes reading them. The
+	// geohash and range indexes cannot be built then, so if they were not
+	// yet, scanNear and scanRanges make queries scan the store instead.
+	readOnly   bool
+	scanNear   bool
+	scanRanges bool
+
+	// If snapshot is set, the store is a read-only view of the quads live
+	// at the given revision.
+	snapshot bool
+	revision int64
 }
 
-func createNewBolt(path string, _ graph.Options) error {
+func createNewBolt(path string, options graph.Options) error {
+	cipher, err := crypt.FromOptions(options)
+	if err != nil {
+		return err
+	}
 	db, err := bolt.Open(path, 0600, nil)
 	if err != nil {
-		glog.Errorf("Error: couldn't create Bolt database: %v", err)
+		clog.Errorf("Error: couldn't create Bolt database: %v", err)
 		return err
 	}
 	defer db.Close()
 	qs := &QuadStore{}
 	qs.db = db
+	qs.cipher = cipher
 	err = qs.createBuckets()
 	if err != nil {
 		return err
@@ -85,19 +132,75 @@ func createNewBolt(path string, _ graph.Options) error {
 func newQuadStore(path string, options graph.Options) (graph.QuadStore, error) {
 	var qs QuadStore
 	var err error
-	db, err := bolt.Open(path, 0600, nil)
+	qs.cipher, err = crypt.FromOptions(options)
 	if err != nil {
-		glog.Errorln("Error, couldn't open! ", err)
+		return nil, err
+	}
+	if name, _, _ := options.StringKey("full_text_index"); name != "" && qs.cipher != nil {
+		return nil, crypt.ErrClearText
+	}
+	qs.names, err = lru.NameCacheFromOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	qs.sorted, _, err = options.BoolKey("sorted_iteration")
+	if err != nil {
+		return nil, err
+	}
+	qs.readOnly, _, err = options.BoolKey("read_only")
+	if err != nil {
+		return nil, err
+	}
+	var boltOpts *bolt.Options
+	if qs.readOnly {
+		// A process writing the database holds it locked; rather than
+		// wait for it to stop, fail.
+		boltOpts = &bolt.Options{ReadOnly: true, Timeout: lockTimeout}
+	}
+	db, err := bolt.Open(path, 0600, boltOpts)
+	if err == bolt.ErrTimeout {
+		err = ErrLocked
+	}
+	if err != nil {
+		clog.Errorln("Error, couldn't open! ", err)
 		return nil, err
 	}
 	qs.db = db
 	// BoolKey returns false on non-existence. IE, Sync by default.
-	qs.db.NoSync, _, err = options.BoolKey("nosync")
+	nosync, _, err := options.BoolKey("nosync")
 	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	policy := graph.SyncAlways
+	if nosync {
+		policy = graph.SyncNever
+	}
+	qs.syncs, err = graph.NewSyncBatcher(options, policy)
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 	err = qs.getMetadata()
 	if err != nil {
+		qs.db.Close()
+		return nil, err
+	}
+	useBlooms, bloomSize, err := bloomsFromOptions(options)
+	if err == nil && useBlooms {
+		err = qs.buildBlooms(bloomSize)
+	}
+	if err == nil {
+		err = qs.buildGeoIndex()
+	}
+	if err == nil {
+		err = qs.buildRangeIndex()
+	}
+	if err == nil {
+		qs.search, err = graph.OpenFullTextIndex(&qs, path, options)
+	}
+	if err != nil {
+		qs.db.Close()
 		return nil, err
 	}
 	return &qs, nil
@@ -124,6 +227,10 @@ func (qs *QuadStore) createBuckets() error {
 		if err != nil {
 			return fmt.Errorf("could not create bucket: %s", err)
 		}
+		_, err = tx.CreateBucket(expiryBucket)
+		if err != nil {
+			return fmt.Errorf("could not create bucket: %s", err)
+		}
 		return nil
 	})
 }
@@ -132,6 +239,22 @@ func (qs *QuadStore) Size() int64 {
 	return qs.size
 }
 
+// NodeCount returns the number of keys in the node bucket.
+func (qs *QuadStore) NodeCount() (int64, error) {
+	var n int64
+	err := qs.db.View(func(tx *bolt.Tx) error {
+		n = int64(tx.Bucket(nodeBucket).Stats().KeyN)
+		return nil
+	})
+	return n, err
+}
+
+// Tune resizes the cache of node names to the "name_cache_size" option,
+// if it is given. A cache disabled when the store was opened stays disabled.
+func (qs *QuadStore) Tune(options graph.Options) error {
+	return qs.names.ResizeFromOptions(options)
+}
+
 func (qs *QuadStore) Horizon() graph.PrimaryKey {
 	return graph.NewSequentialKey(qs.horizon)
 }
@@ -171,6 +294,7 @@ func (qs *QuadStore) createValueKeyFor(s string) []byte {
 
 type IndexEntry struct {
 	History []int64
+	Expires int64 `json:",omitempty"`
 }
 
 var (
@@ -188,12 +312,43 @@ var (
 	logBucket  = []byte("log")
 	nodeBucket = []byte("node")
 	metaBucket = []byte("meta")
+
+	// The expiry bucket is keyed by expiry time followed by the quad's spo
+	// key, and holds the quads to remove.
+	expiryBucket = []byte("expiry")
 )
 
+// update runs fn in a read-write transaction, which is flushed to disk as it
+// commits if sync is set.
+func (qs *QuadStore) update(sync bool, fn func(tx *bolt.Tx) error) error {
+	return qs.db.Update(func(tx *bolt.Tx) error {
+		// Commits read NoSync under the lock the transaction holds.
+		qs.db.NoSync = !sync
+		return fn(tx)
+	})
+}
+
 func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	return qs.ApplyDeltasSync(deltas, ignoreOpts, graph.SyncDefault)
+}
+
+// ApplyDeltasSync applies deltas like ApplyDeltas, flushing them to disk as
+// the given policy says.
+func (qs *QuadStore) ApplyDeltasSync(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts, policy graph.SyncPolicy) error {
+	if qs.snapshot {
+		return graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return graph.ErrReadOnly
+	}
 	oldSize := qs.size
 	oldHorizon := qs.horizon
-	err := qs.db.Update(func(tx *bolt.Tx) error {
+	flush := qs.syncs.Sync(policy, len(deltas))
+	// applied are the deltas that changed the store, leaving out those
+	// ignored.
+	var applied []graph.Delta
+	err := qs.update(flush, func(tx *bolt.Tx) error {
+		applied = nil
 		b := tx.Bucket(logBucket)
 		b.FillPercent = localFillPercent
 		resizeMap := make(map[string]int64)
@@ -202,7 +357,7 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 			if d.Action != graph.Add && d.Action != graph.Delete {
 				return errors.New("bolt: invalid action")
 			}
-			bytes, err := json.Marshal(d)
+			bytes, err := qs.marshal(d)
 			if err != nil {
 				return err
 			}
@@ -212,7 +367,7 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 			}
 		}
 		for _, d := range deltas {
-			err := qs.buildQuadWrite(tx, d.Quad, d.ID.Int(), d.Action == graph.Add)
+			err := qs.buildQuadWrite(tx, d.Quad, d.ID.Int(), d.Action == graph.Add, d.Expires)
 			if err != nil {
 				if err == graph.ErrQuadExists && ignoreOpts.IgnoreDup {
 					continue
@@ -225,6 +380,9 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 			delta := int64(1)
 			if d.Action == graph.Delete {
 				delta = int64(-1)
+			} else {
+				// Added before the commit, so that no reader misses the quad.
+				qs.addToBlooms(d.Quad)
 			}
 			resizeMap[d.Quad.Subject] += delta
 			resizeMap[d.Quad.Predicate] += delta
@@ -234,6 +392,7 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 			}
 			sizeChange += delta
 			qs.horizon = d.ID.Int()
+			applied = append(applied, d)
 		}
 		for k, v := range resizeMap {
 			if v != 0 {
@@ -248,41 +407,216 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 	})
 
 	if err != nil {
-		glog.Error("Couldn't write to DB for Delta set. Error: ", err)
+		clog.Error("Couldn't write to DB for Delta set. Error: ", err)
 		qs.horizon = oldHorizon
 		qs.size = oldSize
 		return err
 	}
+	deltas = applied
+	if qs.search != nil {
+		if err := graph.IndexDeltas(qs, qs.search, deltas); err != nil {
+			clog.Errorf("bolt: indexing text: %v", err)
+		}
+	}
+	if err := qs.indexGeo(deltas, flush); err != nil {
+		clog.Errorf("bolt: indexing points: %v", err)
+	}
+	if err := qs.indexValues(deltas, flush); err != nil {
+		clog.Errorf("bolt: indexing values: %v", err)
+	}
+	qs.watch.Notify(deltas)
 	return nil
 }
 
-func (qs *QuadStore) buildQuadWrite(tx *bolt.Tx, q quad.Quad, id int64, isAdd bool) error {
+// SearchIterator returns an iterator over the nodes whose names match the
+// text query, or over none if the store keeps no text index.
+func (qs *QuadStore) SearchIterator(text string) graph.Iterator {
+	if qs.search == nil {
+		return iterator.NewNull()
+	}
+	return graph.SearchIteratorOf(qs, qs.search, text)
+}
+
+func (qs *QuadStore) Subscribe(pattern quad.Quad) <-chan graph.Delta {
+	return qs.watch.Subscribe(pattern)
+}
+
+func (qs *QuadStore) Unsubscribe(c <-chan graph.Delta) {
+	qs.watch.Unsubscribe(c)
+}
+
+func (qs *QuadStore) AtRevision(horizon int64) (graph.QuadStore, error) {
+	if horizon < 0 || horizon > qs.horizon {
+		return nil, graph.ErrUnknownRevision
+	}
+	return &QuadStore{
+		db:       qs.db,
+		path:     qs.path,
+		open:     qs.open,
+		size:     qs.size,
+		horizon:  horizon,
+		cipher:   qs.cipher,
+		names:    qs.names,
+		blooms:   qs.blooms,
+		syncs:    qs.syncs,
+		sorted:   qs.sorted,
+		search:   qs.search,
+		snapshot: true,
+		revision: horizon,
+	}, nil
+}
+
+// Purge permanently removes the quads deleted before the given time, with
+// the deltas that added and deleted them.
+func (qs *QuadStore) Purge(before time.Time) (int, error) {
+	if qs.snapshot {
+		return 0, graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return 0, graph.ErrReadOnly
+	}
+	n := 0
+	err := qs.update(true, func(tx *bolt.Tx) error {
+		var (
+			quads   []quad.Quad
+			history [][]int64
+		)
+		log := tx.Bucket(logBucket)
+		c := tx.Bucket(spoBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var entry IndexEntry
+			err := qs.unmarshal(v, &entry)
+			if err != nil {
+				return err
+			}
+			if len(entry.History) == 0 || len(entry.History)%2 == 1 {
+				continue
+			}
+			data := log.Get(qs.createDeltaKeyFor(entry.History[len(entry.History)-1]))
+			if data == nil {
+				continue
+			}
+			var d graph.Delta
+			err = qs.unmarshal(data, &d)
+			if err != nil {
+				return err
+			}
+			if d.Timestamp.Before(before) {
+				quads = append(quads, d.Quad)
+				history = append(history, entry.History)
+			}
+		}
+		// Deleting while iterating would skip entries, so delete afterwards.
+		for i, q := range quads {
+			for _, index := range [][4]quad.Direction{spo, osp, pos, cps} {
+				if index == cps && q.Get(quad.Label) == "" {
+					continue
+				}
+				err := tx.Bucket(bucketFor(index)).Delete(qs.createKeyFor(index, q))
+				if err != nil {
+					return err
+				}
+			}
+			for _, id := range history[i] {
+				err := log.Delete(qs.createDeltaKeyFor(id))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		n = len(quads)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// CollectGarbage removes the values of the nodes no index entry refers to.
+func (qs *QuadStore) CollectGarbage() (graph.GCStats, error) {
+	var stats graph.GCStats
+	if qs.snapshot {
+		return stats, graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return stats, graph.ErrReadOnly
+	}
+	err := qs.update(true, func(tx *bolt.Tx) error {
+		var keys [][]byte
+		b := tx.Bucket(nodeBucket)
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var value ValueData
+			err := qs.unmarshal(v, &value)
+			if err != nil {
+				return err
+			}
+			if value.Size > 0 || isReferenced(tx, k) {
+				continue
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			stats.Bytes += int64(len(k) + len(v))
+		}
+		for _, k := range keys {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		stats.Nodes = len(keys)
+		return nil
+	})
+	if err != nil {
+		return graph.GCStats{}, err
+	}
+	return stats, nil
+}
+
+// isReferenced returns whether any quad, live or deleted, has the node with
+// the given hash in any direction.
+func isReferenced(tx *bolt.Tx, hash []byte) bool {
+	for _, index := range [][4]quad.Direction{spo, pos, osp, cps} {
+		k, _ := tx.Bucket(bucketFor(index)).Cursor().Seek(hash)
+		if k != nil && bytes.HasPrefix(k, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (qs *QuadStore) buildQuadWrite(tx *bolt.Tx, q quad.Quad, id int64, isAdd bool, expires time.Time) error {
 	var entry IndexEntry
 	b := tx.Bucket(spoBucket)
 	b.FillPercent = localFillPercent
 	data := b.Get(qs.createKeyFor(spo, q))
 	if data != nil {
 		// We got something.
-		err := json.Unmarshal(data, &entry)
+		err := qs.unmarshal(data, &entry)
 		if err != nil {
 			return err
 		}
 	}
 
 	if isAdd && len(entry.History)%2 == 1 {
-		glog.Errorf("attempt to add existing quad %v: %#v", entry, q)
+		clog.Errorf("attempt to add existing quad %v: %#v", entry, q)
 		return graph.ErrQuadExists
 	}
 	if !isAdd && len(entry.History)%2 == 0 {
-		glog.Errorf("attempt to delete non-existent quad %v: %#v", entry, q)
+		clog.Errorf("attempt to delete non-existent quad %v: %#v", entry, q)
 		return graph.ErrQuadNotExist
 	}
 
 	entry.History = append(entry.History, id)
 
-	jsonbytes, err := json.Marshal(entry)
+	err := qs.updateExpiry(tx, &entry, q, isAdd, expires)
 	if err != nil {
-		glog.Errorf("Couldn't write to buffer for entry %#v: %s", entry, err)
+		return err
+	}
+
+	jsonbytes, err := qs.marshal(entry)
+	if err != nil {
+		clog.Errorf("Couldn't write to buffer for entry %#v: %s", entry, err)
 		return err
 	}
 	for _, index := range [][4]quad.Direction{spo, osp, pos, cps} {
@@ -299,6 +633,112 @@ func (qs *QuadStore) buildQuadWrite(tx *bolt.Tx, q quad.Quad, id int64, isAdd bo
 	return nil
 }
 
+func expiryKeyFor(expires int64, spoKey []byte) []byte {
+	key := make([]byte, 8, 8+len(spoKey))
+	binary.BigEndian.PutUint64(key, uint64(expires))
+	return append(key, spoKey...)
+}
+
+// updateExpiry removes the previous expiry index entry of the quad, if any,
+// and adds a new one if it is being added with an expiry time.
+func (qs *QuadStore) updateExpiry(tx *bolt.Tx, entry *IndexEntry, q quad.Quad, isAdd bool, expires time.Time) error {
+	if entry.Expires == 0 && (!isAdd || expires.IsZero()) {
+		return nil
+	}
+	// Stores created before expiry was supported lack the bucket.
+	b, err := tx.CreateBucketIfNotExists(expiryBucket)
+	if err != nil {
+		return err
+	}
+	spoKey := qs.createKeyFor(spo, q)
+	if entry.Expires != 0 {
+		err = b.Delete(expiryKeyFor(entry.Expires, spoKey))
+		if err != nil {
+			return err
+		}
+		entry.Expires = 0
+	}
+	if isAdd && !expires.IsZero() {
+		entry.Expires = expires.UnixNano()
+		data, err := qs.marshal(q)
+		if err != nil {
+			return err
+		}
+		return b.Put(expiryKeyFor(entry.Expires, spoKey), data)
+	}
+	return nil
+}
+
+func (qs *QuadStore) ExpiredQuads(now time.Time) ([]quad.Quad, error) {
+	var quads []quad.Quad
+	limit := make([]byte, 8)
+	binary.BigEndian.PutUint64(limit, uint64(now.UnixNano()))
+	err := qs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(expiryBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && bytes.Compare(k[:8], limit) <= 0; k, v = c.Next() {
+			var q quad.Quad
+			err := qs.unmarshal(v, &q)
+			if err != nil {
+				return err
+			}
+			quads = append(quads, q)
+		}
+		return nil
+	})
+	return quads, err
+}
+
+// isLiveValue reports whether an index entry is for a quad that has not been
+// deleted, as of the store's revision if it is a snapshot.
+func (qs *QuadStore) isLiveValue(val []byte) bool {
+	var entry IndexEntry
+	qs.unmarshal(val, &entry)
+	_, ok := qs.liveSince(entry.History)
+	return ok
+}
+
+// liveSince returns the ID of the delta that added the quad with the given
+// history, if it is live as of the store's revision.
+func (qs *QuadStore) liveSince(history []int64) (int64, bool) {
+	n := len(history)
+	if qs.snapshot {
+		// The history alternates additions and removals, in order.
+		n = 0
+		for _, id := range history {
+			if id > qs.revision {
+				break
+			}
+			n++
+		}
+	}
+	if n%2 == 0 {
+		return 0, false
+	}
+	return history[n-1], true
+}
+
+// marshal encodes a value to store, encrypting it if the store has a key.
+func (qs *QuadStore) marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return qs.cipher.Seal(b), nil
+}
+
+// unmarshal decodes a stored value written by marshal.
+func (qs *QuadStore) unmarshal(data []byte, v interface{}) error {
+	b, err := qs.cipher.Open(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
 type ValueData struct {
 	Name string
 	Size int64
@@ -313,9 +753,9 @@ func (qs *QuadStore) UpdateValueKeyBy(name string, amount int64, tx *bolt.Tx) er
 
 	if data != nil {
 		// Node exists in the database -- unmarshal and update.
-		err := json.Unmarshal(data, &value)
+		err := qs.unmarshal(data, &value)
 		if err != nil {
-			glog.Errorf("Error: couldn't reconstruct value: %v", err)
+			clog.Errorf("Error: couldn't reconstruct value: %v", err)
 			return err
 		}
 		value.Size += amount
@@ -327,9 +767,9 @@ func (qs *QuadStore) UpdateValueKeyBy(name string, amount int64, tx *bolt.Tx) er
 	}
 
 	// Repackage and rewrite.
-	bytes, err := json.Marshal(&value)
+	bytes, err := qs.marshal(&value)
 	if err != nil {
-		glog.Errorf("Couldn't write to buffer for value %s: %s", name, err)
+		clog.Errorf("Couldn't write to buffer for value %s: %s", name, err)
 		return err
 	}
 	err = b.Put(key, bytes)
@@ -340,36 +780,46 @@ func (qs *QuadStore) WriteHorizonAndSize(tx *bolt.Tx) error {
 	buf := new(bytes.Buffer)
 	err := binary.Write(buf, binary.LittleEndian, qs.size)
 	if err != nil {
-		glog.Errorf("Couldn't convert size!")
+		clog.Errorf("Couldn't convert size!")
 		return err
 	}
 	b := tx.Bucket(metaBucket)
 	b.FillPercent = localFillPercent
-	werr := b.Put([]byte("size"), buf.Bytes())
+	werr := b.Put([]byte("size"), qs.cipher.Seal(buf.Bytes()))
 	if werr != nil {
-		glog.Error("Couldn't write size!")
+		clog.Error("Couldn't write size!")
 		return werr
 	}
 	buf.Reset()
 	err = binary.Write(buf, binary.LittleEndian, qs.horizon)
 
 	if err != nil {
-		glog.Errorf("Couldn't convert horizon!")
+		clog.Errorf("Couldn't convert horizon!")
 	}
 
-	werr = b.Put([]byte("horizon"), buf.Bytes())
+	werr = b.Put([]byte("horizon"), qs.cipher.Seal(buf.Bytes()))
 
 	if werr != nil {
-		glog.Error("Couldn't write horizon!")
+		clog.Error("Couldn't write horizon!")
 		return werr
 	}
 	return err
 }
 
 func (qs *QuadStore) Close() {
-	qs.db.Update(func(tx *bolt.Tx) error {
-		return qs.WriteHorizonAndSize(tx)
-	})
+	if qs.snapshot {
+		// The database belongs to the store the snapshot was taken from.
+		return
+	}
+	qs.watch.Close()
+	if qs.search != nil {
+		qs.search.Close()
+	}
+	if !qs.readOnly {
+		qs.update(true, func(tx *bolt.Tx) error {
+			return qs.WriteHorizonAndSize(tx)
+		})
+	}
 	qs.db.Close()
 	qs.open = false
 }
@@ -384,7 +834,7 @@ func (qs *QuadStore) Quad(k graph.Value) quad.Quad {
 			return nil
 		}
 		var in IndexEntry
-		err := json.Unmarshal(data, &in)
+		err := qs.unmarshal(data, &in)
 		if err != nil {
 			return err
 		}
@@ -397,15 +847,54 @@ func (qs *QuadStore) Quad(k graph.Value) quad.Quad {
 			// No harm, no foul.
 			return nil
 		}
-		return json.Unmarshal(data, &d)
+		return qs.unmarshal(data, &d)
 	})
 	if err != nil {
-		glog.Error("Error getting quad: ", err)
+		clog.Error("Error getting quad: ", err)
 		return quad.Quad{}
 	}
 	return d.Quad
 }
 
+// Provenance returns the provenance recorded in the delta that added a live
+// quad.
+func (qs *QuadStore) Provenance(k graph.Value) (graph.Provenance, bool) {
+	var (
+		d    graph.Delta
+		live bool
+	)
+	tok := k.(*Token)
+	err := qs.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(tok.bucket).Get(tok.key)
+		if data == nil {
+			return nil
+		}
+		var in IndexEntry
+		err := qs.unmarshal(data, &in)
+		if err != nil {
+			return err
+		}
+		id, ok := qs.liveSince(in.History)
+		if !ok {
+			return nil
+		}
+		data = tx.Bucket(logBucket).Get(qs.createDeltaKeyFor(id))
+		if data == nil {
+			return nil
+		}
+		live = true
+		return qs.unmarshal(data, &d)
+	})
+	if err != nil {
+		clog.Error("Error getting provenance: ", err)
+		return graph.Provenance{}, false
+	}
+	if !live || (d.Author == "" && d.Source == "") {
+		return graph.Provenance{}, false
+	}
+	return graph.Provenance{Created: d.Timestamp, Author: d.Author, Source: d.Source}, true
+}
+
 func (qs *QuadStore) ValueOf(s string) graph.Value {
 	return &Token{
 		bucket: nodeBucket,
@@ -415,19 +904,19 @@ func (qs *QuadStore) ValueOf(s string) graph.Value {
 
 func (qs *QuadStore) valueData(t *Token) ValueData {
 	var out ValueData
-	if glog.V(3) {
-		glog.V(3).Infof("%s %v", string(t.bucket), t.key)
+	if clog.V(3) {
+		clog.V(3).Infof("%s %v", string(t.bucket), t.key)
 	}
 	err := qs.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(t.bucket)
 		data := b.Get(t.key)
 		if data != nil {
-			return json.Unmarshal(data, &out)
+			return qs.unmarshal(data, &out)
 		}
 		return nil
 	})
 	if err != nil {
-		glog.Errorln("Error: couldn't get value")
+		clog.Errorln("Error: couldn't get value")
 		return ValueData{}
 	}
 	return out
@@ -435,10 +924,18 @@ func (qs *QuadStore) valueData(t *Token) ValueData {
 
 func (qs *QuadStore) NameOf(k graph.Value) string {
 	if k == nil {
-		glog.V(2).Info("k was nil")
+		clog.V(2).Info("k was nil")
 		return ""
 	}
-	return qs.valueData(k.(*Token)).Name
+	key := string(k.(*Token).key)
+	if name, ok := qs.names.Get(key); ok {
+		return name.(string)
+	}
+	name := qs.valueData(k.(*Token)).Name
+	if name != "" {
+		qs.names.Put(key, name)
+	}
+	return name
 }
 
 func (qs *QuadStore) SizeOf(k graph.Value) int64 {
@@ -455,8 +952,16 @@ func (qs *QuadStore) getInt64ForKey(tx *bolt.Tx, key string, empty int64) (int64
 	if data == nil {
 		return empty, nil
 	}
+	data, err := qs.cipher.Open(data)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		// Most likely an encrypted database opened without its key.
+		return 0, crypt.ErrDecrypt
+	}
 	buf := bytes.NewBuffer(data)
-	err := binary.Read(buf, binary.LittleEndian, &out)
+	err = binary.Read(buf, binary.LittleEndian, &out)
 	if err != nil {
 		return 0, err
 	}
@@ -490,15 +995,26 @@ func (qs *QuadStore) QuadIterator(d quad.Direction, val graph.Value) graph.Itera
 	default:
 		panic("unreachable " + d.String())
 	}
+	if !qs.mayHave(d, val.(*Token)) {
+		return iterator.NewNull()
+	}
 	return NewIterator(bucket, d, val, qs)
 }
 
 func (qs *QuadStore) NodesAllIterator() graph.Iterator {
-	return NewAllIterator(nodeBucket, quad.Any, qs)
+	it := NewAllIterator(nodeBucket, quad.Any, qs)
+	if qs.sorted {
+		return iterator.SortNodes(qs, it)
+	}
+	return it
 }
 
 func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
-	return NewAllIterator(posBucket, quad.Predicate, qs)
+	it := NewAllIterator(posBucket, quad.Predicate, qs)
+	if qs.sorted {
+		return iterator.SortQuads(qs, it)
+	}
+	return it
 }
 
 func (qs *QuadStore) QuadDirection(val graph.Value, d quad.Direction) graph.Value {
@@ -0,0 +1,168 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// The range bucket is keyed by the kinds of the values of the nodes that
+// hold numbers or times, their sort keys, and the hashes of their names. The
+// rangeIndexBuilt key of the meta bucket records that the values held before
+// the indexes were kept have been added to them.
+//
+// Encrypted stores keep no indexes, as their keys would give away the
+// values.
+var rangeBucket = []byte("range")
+
+const rangeIndexBuilt = "range"
+
+// rangeBatchSize is the number of entries written at once while building
+// the range indexes.
+const rangeBatchSize = 10000
+
+func rangeKey(kind quad.ValueKind, key uint64) []byte {
+	k := make([]byte, 9, 9+hashSize)
+	k[0] = byte(kind)
+	binary.BigEndian.PutUint64(k[1:], key)
+	return k
+}
+
+func createRangeKeyFor(name string) []byte {
+	return append(rangeKey(quad.SortKey(name)), hashOf(name)...)
+}
+
+// indexValues updates the range indexes once the deltas have been applied,
+// flushing them to disk if sync is set, as the deltas were.
+func (qs *QuadStore) indexValues(deltas []graph.Delta, sync bool) error {
+	if qs.cipher != nil {
+		return nil
+	}
+	added, removed := graph.ValueChanges(qs, deltas)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return qs.update(sync, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(rangeBucket)
+		if err != nil {
+			return err
+		}
+		for _, name := range added {
+			if err := b.Put(createRangeKeyFor(name), []byte{}); err != nil {
+				return err
+			}
+		}
+		for _, name := range removed {
+			if err := b.Delete(createRangeKeyFor(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// buildRangeIndex adds the values the store holds to the range indexes,
+// unless it has been done already.
+func (qs *QuadStore) buildRangeIndex() error {
+	if qs.cipher != nil {
+		return nil
+	}
+	var built bool
+	err := qs.db.View(func(tx *bolt.Tx) error {
+		built = tx.Bucket(metaBucket).Get([]byte(rangeIndexBuilt)) != nil
+		return nil
+	})
+	if err != nil || built {
+		return err
+	}
+	if qs.readOnly {
+		clog.Warningln("The range indexes are not built; queries over ranges scan the store until it is opened writable")
+		qs.scanRanges = true
+		return nil
+	}
+	if qs.size > 0 {
+		clog.Infof("Building the range indexes of %d quads", qs.size)
+	}
+	// The keys are gathered first, as the quads are read in transactions
+	// of their own, which must not be held while writing.
+	var keys [][]byte
+	err = graph.ValueObjects(qs, func(name string, kind quad.ValueKind, key uint64) error {
+		keys = append(keys, append(rangeKey(kind, key), hashOf(name)...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		n := len(keys)
+		if n > rangeBatchSize {
+			n = rangeBatchSize
+		}
+		err := qs.update(true, func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(rangeBucket)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys[:n] {
+				if err := b.Put(key, []byte{}); err != nil {
+					return err
+				}
+			}
+			if n == len(keys) {
+				return tx.Bucket(metaBucket).Put([]byte(rangeIndexBuilt), []byte{})
+			}
+			return nil
+		})
+		if err != nil || n == len(keys) {
+			return err
+		}
+		keys = keys[n:]
+	}
+}
+
+func (qs *QuadStore) ValueRangeIterator(r quad.ValueRange) graph.Iterator {
+	if qs.cipher != nil || qs.scanRanges {
+		return graph.ScanValueRange(qs, r)
+	}
+	fixed := qs.FixedIterator()
+	if r.From > r.To {
+		return fixed
+	}
+	qs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(rangeBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		kind := []byte{byte(r.Kind)}
+		for k, _ := c.Seek(rangeKey(r.Kind, r.From)); k != nil && bytes.HasPrefix(k, kind); k, _ = c.Next() {
+			if binary.BigEndian.Uint64(k[1:9]) > r.To {
+				break
+			}
+			key := make([]byte, len(k)-9)
+			copy(key, k[9:])
+			fixed.Add(&Token{bucket: nodeBucket, key: key})
+		}
+		return nil
+	})
+	return fixed
+}
@@ -0,0 +1,234 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// write is a change to a bucket found by Verify, made once the bucket is no
+// longer being iterated over. A nil value deletes the key.
+type write struct {
+	bucket, key, value []byte
+}
+
+// Verify checks the osp, pos and cps buckets and the node values against
+// the spo bucket and the log, which together hold the primary record of
+// each quad, and the size of the store against the number of live quads.
+// With repair, the entries of the secondary buckets are rewritten from their
+// spo entry, orphaned ones are removed, and node sizes are recounted.
+//
+// Entries of the spo bucket that cannot be decoded, whose quad is missing
+// from the log, or that do not match their quad are reported but cannot be
+// repaired.
+func (qs *QuadStore) Verify(repair bool) (graph.VerifyReport, error) {
+	var rep graph.VerifyReport
+	if qs.snapshot {
+		return rep, graph.ErrRevisionReadOnly
+	}
+	if repair && qs.readOnly {
+		return rep, graph.ErrReadOnly
+	}
+	var live int64
+	fn := func(tx *bolt.Tx) error {
+		var writes []write
+		problem := func(w *write, format string, args ...interface{}) {
+			rep.Problems = append(rep.Problems, fmt.Sprintf(format, args...))
+			if w != nil && repair {
+				writes = append(writes, *w)
+				rep.Repaired++
+			}
+		}
+
+		sizes := make(map[string]int64)
+		log := tx.Bucket(logBucket)
+		c := tx.Bucket(spoBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			rep.Quads++
+			var entry IndexEntry
+			err := qs.unmarshal(v, &entry)
+			if err != nil || len(entry.History) == 0 {
+				problem(nil, "spo entry %x cannot be decoded: %v", k, err)
+				continue
+			}
+			data := log.Get(qs.createDeltaKeyFor(entry.History[len(entry.History)-1]))
+			if data == nil {
+				problem(nil, "spo entry %x has no logged delta", k)
+				continue
+			}
+			var d graph.Delta
+			err = qs.unmarshal(data, &d)
+			if err != nil {
+				problem(nil, "delta %d cannot be decoded: %v", entry.History[len(entry.History)-1], err)
+				continue
+			}
+			q := d.Quad
+			if !bytes.Equal(k, qs.createKeyFor(spo, q)) {
+				problem(nil, "spo entry %x does not match its quad %v", k, q)
+				continue
+			}
+			for _, index := range [][4]quad.Direction{osp, pos, cps} {
+				if index == cps && q.Label == "" {
+					continue
+				}
+				key := qs.createKeyFor(index, q)
+				if !qs.hasEntry(tx.Bucket(bucketFor(index)).Get(key), entry) {
+					problem(&write{bucketFor(index), key, append([]byte(nil), v...)},
+						"%s entry for quad %v is missing or stale", bucketFor(index)[:3], q)
+				}
+			}
+			if _, ok := qs.liveSince(entry.History); ok {
+				live++
+				sizes[q.Subject]++
+				sizes[q.Predicate]++
+				sizes[q.Object]++
+				if q.Label != "" {
+					sizes[q.Label]++
+				}
+			}
+		}
+
+		spoB := tx.Bucket(spoBucket)
+		for _, index := range [][4]quad.Direction{osp, pos, cps} {
+			c := tx.Bucket(bucketFor(index)).Cursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				if spoB.Get(spoKeyOf(index, k)) == nil {
+					problem(&write{bucketFor(index), append([]byte(nil), k...), nil},
+						"%s entry %x has no spo entry", bucketFor(index)[:3], k)
+				}
+			}
+		}
+
+		seen := make(map[string]bool)
+		c = tx.Bucket(nodeBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var value ValueData
+			err := qs.unmarshal(v, &value)
+			if err != nil {
+				problem(nil, "node value %x cannot be decoded: %v", k, err)
+				continue
+			}
+			if !bytes.Equal(k, qs.createValueKeyFor(value.Name)) {
+				problem(nil, "node value %x does not match its name %q", k, value.Name)
+				continue
+			}
+			seen[value.Name] = true
+			if n := sizes[value.Name]; value.Size != n {
+				w, err := qs.valueWrite(value.Name, n)
+				if err != nil {
+					return err
+				}
+				problem(w, "node %q has size %d, but %d live quads", value.Name, value.Size, n)
+			}
+		}
+		for name, n := range sizes {
+			if seen[name] {
+				continue
+			}
+			w, err := qs.valueWrite(name, n)
+			if err != nil {
+				return err
+			}
+			problem(w, "node %q of %d live quads has no value", name, n)
+		}
+
+		if live != qs.size {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("store has size %d, but %d live quads", qs.size, live))
+			if repair {
+				rep.Repaired++
+			}
+		}
+		if !repair || rep.Repaired == 0 {
+			return nil
+		}
+		for _, w := range writes {
+			b := tx.Bucket(w.bucket)
+			b.FillPercent = localFillPercent
+			var err error
+			if w.value == nil {
+				err = b.Delete(w.key)
+			} else {
+				err = b.Put(w.key, w.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		oldSize := qs.size
+		qs.size = live
+		err := qs.WriteHorizonAndSize(tx)
+		if err != nil {
+			qs.size = oldSize
+		}
+		return err
+	}
+	var err error
+	if repair {
+		err = qs.update(true, fn)
+	} else {
+		err = qs.db.View(fn)
+	}
+	return rep, err
+}
+
+// hasEntry returns whether an index entry holds the same history as the
+// given spo entry.
+func (qs *QuadStore) hasEntry(data []byte, want IndexEntry) bool {
+	if data == nil {
+		return false
+	}
+	var entry IndexEntry
+	if qs.unmarshal(data, &entry) != nil {
+		return false
+	}
+	if entry.Expires != want.Expires || len(entry.History) != len(want.History) {
+		return false
+	}
+	for i, id := range entry.History {
+		if want.History[i] != id {
+			return false
+		}
+	}
+	return true
+}
+
+// valueWrite returns the write of a node value of the given size.
+func (qs *QuadStore) valueWrite(name string, size int64) (*write, error) {
+	b, err := qs.marshal(&ValueData{Name: name, Size: size})
+	if err != nil {
+		return nil, err
+	}
+	return &write{nodeBucket, qs.createValueKeyFor(name), b}, nil
+}
+
+// spoKeyOf returns the key of the spo entry for the quad of an entry of
+// another index, by reordering the hashes of its key.
+func spoKeyOf(index [4]quad.Direction, key []byte) []byte {
+	spoKey := make([]byte, 0, len(key))
+	for _, d := range spo {
+		for i, id := range index {
+			if id == d && len(key) >= (i+1)*hashSize {
+				spoKey = append(spoKey, key[i*hashSize:(i+1)*hashSize]...)
+			}
+		}
+	}
+	return spoKey
+}
@@ -0,0 +1,536 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache implements a QuadStore that keeps the lookups made in a slow
+// backend, such as a remote Mongo database, in local memory and optionally
+// on local disk.
+//
+// Node values and names, quads, and the quads linked to each node are cached.
+// Writes go to the backend, and drop the entries of the nodes they touch.
+// Writes made by others are seen through the backend's own notifications,
+// if it is a graph.Watcher, or by following the replication log of the
+// primary they are made on.
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/internal/lru"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/writer"
+)
+
+const QuadStoreType = "cache"
+
+func init() {
+	graph.RegisterQuadStore(QuadStoreType, true, newQuadStore, createNewCacheGraph, nil)
+	gob.Register(quad.Quad{})
+}
+
+var ErrNoBackend = errors.New("cache: no backend configured")
+
+const (
+	// DefaultSize is the number of entries kept in memory, unless set by
+	// the "cache_size" option.
+	DefaultSize = 10000
+
+	// DefaultMaxResults is the largest number of quads linked to a node
+	// that are cached, unless set by the "max_cached_results" option.
+	DefaultMaxResults = 1000
+
+	defaultPollInterval = time.Second
+)
+
+var diskBucket = []byte("cache")
+
+// The kinds of cached entries, which prefix their keys.
+const (
+	valueEntry = 'v' // the value of a name
+	nameEntry  = 'n' // the name of a value
+	quadEntry  = 'q' // the quad of a value
+	indexEntry = 'i' // the quads linked to a node in a direction
+)
+
+// entry is a cached lookup. Only the field of its kind is set.
+type entry struct {
+	Value  graph.Value
+	Name   string
+	Quad   quad.Quad
+	Values []graph.Value
+}
+
+type QuadStore struct {
+	backend    graph.QuadStore
+	maxResults int
+
+	mem  *lru.Cache
+	disk *bolt.DB
+
+	// gen counts invalidations, so that a lookup racing with a write does
+	// not cache what it read before the write.
+	gen uint64
+
+	feed      <-chan graph.Delta
+	logURL    string
+	client    *http.Client
+	auth      writer.PrimaryAuth
+	offset    int64
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	watch graph.Notifier
+}
+
+func createNewCacheGraph(_ string, options graph.Options) error {
+	c, ok, err := options.StoreConfigKey("backend")
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrNoBackend
+	}
+	return c.Init()
+}
+
+func newQuadStore(path string, options graph.Options) (graph.QuadStore, error) {
+	size := DefaultSize
+	n, ok, err := options.IntKey("cache_size")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		size = n
+	}
+	maxResults := DefaultMaxResults
+	n, ok, err = options.IntKey("max_cached_results")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		maxResults = n
+	}
+	primary, _, err := options.StringKey("primary")
+	if err != nil {
+		return nil, err
+	}
+	auth, err := writer.PrimaryAuthOf(options)
+	if err != nil {
+		return nil, err
+	}
+	interval := defaultPollInterval
+	ms, ok, err := options.IntKey("poll_interval_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		interval = time.Duration(ms) * time.Millisecond
+	}
+	c, ok, err := options.StoreConfigKey("backend")
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNoBackend
+	}
+
+	backend, err := c.Open()
+	if err != nil {
+		return nil, fmt.Errorf("backend: %v", err)
+	}
+	qs := New(backend, size, maxResults)
+	if path != "" {
+		err = qs.openDisk(path)
+		if err != nil {
+			qs.Close()
+			return nil, err
+		}
+	}
+	if primary != "" {
+		qs.auth = auth
+		qs.follow(primary, interval)
+	}
+	return qs, nil
+}
+
+// New returns a QuadStore caching up to size lookups in backend in memory,
+// and the quads linked to a node if there are at most maxResults of them.
+func New(backend graph.QuadStore, size, maxResults int) *QuadStore {
+	qs := &QuadStore{
+		backend:    backend,
+		maxResults: maxResults,
+		mem:        lru.New(size),
+		done:       make(chan struct{}),
+	}
+	if w, ok := backend.(graph.Watcher); ok {
+		qs.feed = w.Subscribe(quad.Quad{})
+		qs.wg.Add(1)
+		go qs.watchBackend()
+	}
+	return qs
+}
+
+// openDisk keeps the entries evicted from memory in the bolt file at path.
+// The file is emptied, as the writes made while it was closed are unknown.
+func (qs *QuadStore) openDisk(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(diskBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	qs.disk = db
+	return nil
+}
+
+// watchBackend invalidates the entries of the deltas the backend reports.
+func (qs *QuadStore) watchBackend() {
+	defer qs.wg.Done()
+	for d := range qs.feed {
+		qs.invalidate(d.Quad)
+	}
+}
+
+// follow polls the replication log of the primary at the given URL, such as
+// "http://primary:64210", and invalidates the entries of its deltas.
+func (qs *QuadStore) follow(primary string, interval time.Duration) {
+	qs.logURL = strings.TrimSuffix(primary, "/") + "/api/v1/replication/log"
+	qs.client = &http.Client{Timeout: time.Minute}
+	qs.wg.Add(1)
+	go func() {
+		defer qs.wg.Done()
+		for {
+			n, err := qs.syncLog()
+			if err != nil {
+				clog.Errorf("cache: could not follow %s: %v", qs.logURL, err)
+			}
+			if n > 0 && err == nil {
+				continue
+			}
+			select {
+			case <-qs.done:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// syncLog reads the batches the primary has logged since the last call, and
+// invalidates the entries of their deltas. It returns how many there were.
+func (qs *QuadStore) syncLog() (int, error) {
+	req, err := http.NewRequest("GET", qs.logURL+"?offset="+url.QueryEscape(strconv.FormatInt(qs.offset, 10)), nil)
+	if err != nil {
+		return 0, err
+	}
+	qs.auth.Set(req)
+	resp, err := qs.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return 0, fmt.Errorf("primary returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var log writer.LogBatches
+	err = json.NewDecoder(resp.Body).Decode(&log)
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range log.Batches {
+		for i := range b.Deltas {
+			qs.invalidate(b.Deltas[i].Quad)
+		}
+		qs.offset = b.Offset
+	}
+	return len(log.Batches), nil
+}
+
+// invalidate drops the entries that a write of q may change: the values of
+// its nodes, and the quads linked to them.
+func (qs *QuadStore) invalidate(q quad.Quad) {
+	var keys []string
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		name := q.Get(d)
+		if name == "" {
+			continue
+		}
+		keys = append(keys, string(valueEntry)+name)
+		for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+			keys = append(keys, indexKey(d, name))
+		}
+	}
+	atomic.AddUint64(&qs.gen, 1)
+	for _, k := range keys {
+		qs.mem.Remove(k)
+	}
+	if qs.disk != nil {
+		err := qs.disk.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(diskBucket)
+			for _, k := range keys {
+				if err := b.Delete([]byte(k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			clog.Errorf("cache: could not invalidate disk entries: %v", err)
+		}
+	}
+}
+
+func indexKey(d quad.Direction, name string) string {
+	return string([]byte{indexEntry, d.Prefix()}) + name
+}
+
+// valueKey returns a key for a backend value, which may not be comparable.
+func valueKey(kind byte, v graph.Value) string {
+	type keyer interface {
+		Key() interface{}
+	}
+	if k, ok := v.(keyer); ok {
+		v = k.Key()
+	}
+	return fmt.Sprintf("%c%T:%v", kind, v, v)
+}
+
+// get returns the entry cached for key, in memory or else on disk.
+func (qs *QuadStore) get(key string) (entry, bool) {
+	if e, ok := qs.mem.Get(key); ok {
+		return e.(entry), true
+	}
+	if qs.disk == nil {
+		return entry{}, false
+	}
+	var data []byte
+	qs.disk.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(diskBucket).Get([]byte(key)); b != nil {
+			data = append([]byte(nil), b...)
+		}
+		return nil
+	})
+	if data == nil {
+		return entry{}, false
+	}
+	var e entry
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e)
+	if err != nil {
+		clog.Errorf("cache: could not decode disk entry: %v", err)
+		return entry{}, false
+	}
+	qs.mem.Put(key, e)
+	return e, true
+}
+
+// put caches the entry for key, unless an invalidation happened since gen
+// was read.
+func (qs *QuadStore) put(key string, e entry, gen uint64) {
+	if atomic.LoadUint64(&qs.gen) != gen {
+		return
+	}
+	qs.mem.Put(key, e)
+	if qs.disk == nil {
+		return
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(e)
+	if err != nil {
+		// Only values of basic types can be written to disk.
+		clog.V(2).Infof("cache: not caching %q on disk: %v", key, err)
+		return
+	}
+	err = qs.disk.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Put([]byte(key), buf.Bytes())
+	})
+	if err != nil {
+		clog.Errorf("cache: could not write disk entry: %v", err)
+	}
+}
+
+func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	changes, err := graph.Changes(qs.backend, deltas, ignoreOpts)
+	if err != nil {
+		return err
+	}
+	err = qs.backend.ApplyDeltas(deltas, ignoreOpts)
+	// Even a failed write may have been partly applied.
+	for i := range deltas {
+		qs.invalidate(deltas[i].Quad)
+	}
+	if err != nil {
+		return err
+	}
+	qs.watch.Notify(changes)
+	return nil
+}
+
+func (qs *QuadStore) Subscribe(pattern quad.Quad) <-chan graph.Delta {
+	return qs.watch.Subscribe(pattern)
+}
+
+func (qs *QuadStore) Unsubscribe(c <-chan graph.Delta) {
+	qs.watch.Unsubscribe(c)
+}
+
+func (qs *QuadStore) Quad(v graph.Value) quad.Quad {
+	key := valueKey(quadEntry, v)
+	if e, ok := qs.get(key); ok {
+		return e.Quad
+	}
+	gen := atomic.LoadUint64(&qs.gen)
+	q := qs.backend.Quad(v)
+	// The quad of a value never changes.
+	qs.put(key, entry{Quad: q}, gen)
+	return q
+}
+
+// QuadIterator returns the quads linked to v in direction d, from the cache
+// if they have been looked up before.
+func (qs *QuadStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	name := qs.NameOf(v)
+	if name == "" {
+		return qs.backend.QuadIterator(d, v)
+	}
+	key := indexKey(d, name)
+	if e, ok := qs.get(key); ok {
+		return qs.fixed(e.Values)
+	}
+	gen := atomic.LoadUint64(&qs.gen)
+	it := qs.backend.QuadIterator(d, v)
+	if size, exact := it.Size(); exact && size > int64(qs.maxResults) {
+		return it
+	}
+	var vals []graph.Value
+	for graph.Next(it) {
+		if len(vals) == qs.maxResults {
+			// Too many to cache; start over rather than hold them.
+			it.Close()
+			return qs.backend.QuadIterator(d, v)
+		}
+		vals = append(vals, it.Result())
+	}
+	err := it.Err()
+	it.Close()
+	if err != nil {
+		return qs.backend.QuadIterator(d, v)
+	}
+	qs.put(key, entry{Values: vals}, gen)
+	return qs.fixed(vals)
+}
+
+func (qs *QuadStore) fixed(vals []graph.Value) graph.Iterator {
+	it := qs.backend.FixedIterator()
+	for _, v := range vals {
+		it.Add(v)
+	}
+	return it
+}
+
+func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	return qs.backend.NodesAllIterator()
+}
+
+func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
+	return qs.backend.QuadsAllIterator()
+}
+
+func (qs *QuadStore) ValueOf(name string) graph.Value {
+	key := string(valueEntry) + name
+	if e, ok := qs.get(key); ok {
+		return e.Value
+	}
+	gen := atomic.LoadUint64(&qs.gen)
+	v := qs.backend.ValueOf(name)
+	qs.put(key, entry{Value: v}, gen)
+	return v
+}
+
+func (qs *QuadStore) NameOf(v graph.Value) string {
+	if v == nil {
+		return ""
+	}
+	key := valueKey(nameEntry, v)
+	if e, ok := qs.get(key); ok {
+		return e.Name
+	}
+	gen := atomic.LoadUint64(&qs.gen)
+	name := qs.backend.NameOf(v)
+	if name != "" {
+		qs.put(key, entry{Name: name}, gen)
+	}
+	return name
+}
+
+func (qs *QuadStore) Size() int64 {
+	return qs.backend.Size()
+}
+
+func (qs *QuadStore) Horizon() graph.PrimaryKey {
+	return qs.backend.Horizon()
+}
+
+func (qs *QuadStore) FixedIterator() graph.FixedIterator {
+	return qs.backend.FixedIterator()
+}
+
+func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return qs.backend.OptimizeIterator(it)
+}
+
+func (qs *QuadStore) QuadDirection(v graph.Value, d quad.Direction) graph.Value {
+	return qs.backend.QuadDirection(v, d)
+}
+
+func (qs *QuadStore) Close() {
+	qs.closeOnce.Do(func() {
+		close(qs.done)
+		if qs.feed != nil {
+			qs.backend.(graph.Watcher).Unsubscribe(qs.feed)
+		}
+		qs.wg.Wait()
+		qs.watch.Close()
+		if qs.disk != nil {
+			qs.disk.Close()
+		}
+		qs.backend.Close()
+	})
+}
+
+func (qs *QuadStore) Type() string {
+	return QuadStoreType
+}
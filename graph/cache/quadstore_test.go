@@ -0,0 +1,204 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/writer"
+
+	_ "github.com/google/cayley/graph/memstore"
+)
+
+var simpleGraph = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"C", "follows", "B", ""},
+	{"C", "follows", "D", ""},
+}
+
+// countingStore counts the index lookups made in its store.
+type countingStore struct {
+	graph.QuadStore
+	lookups int
+}
+
+func (qs *countingStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	qs.lookups++
+	return qs.QuadStore.QuadIterator(d, v)
+}
+
+func newMemStore(t *testing.T) graph.QuadStore {
+	qs, err := graph.NewQuadStore("memstore", "", nil)
+	if err != nil {
+		t.Fatalf("Could not create memstore: %v", err)
+	}
+	return qs
+}
+
+func load(t *testing.T, qs graph.QuadStore, data []quad.Quad) {
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	for _, q := range data {
+		if err := w.AddQuad(q); err != nil {
+			t.Fatalf("Could not add %v: %v", q, err)
+		}
+	}
+}
+
+// subjects returns the sorted subjects of the quads linked to name.
+func subjects(qs graph.QuadStore, d quad.Direction, name string) []string {
+	var out []string
+	it := qs.QuadIterator(d, qs.ValueOf(name))
+	defer it.Close()
+	for graph.Next(it) {
+		out = append(out, qs.Quad(it.Result()).Subject)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCachedLookups(t *testing.T) {
+	backend := &countingStore{QuadStore: newMemStore(t)}
+	qs := New(backend, 100, DefaultMaxResults)
+	defer qs.Close()
+	load(t, qs, simpleGraph)
+
+	for i := 0; i < 3; i++ {
+		if got := subjects(qs, quad.Object, "B"); len(got) != 2 || got[0] != "A" || got[1] != "C" {
+			t.Fatalf("Unexpected subjects of B: %v", got)
+		}
+	}
+	if backend.lookups != 1 {
+		t.Errorf("Expected one lookup in the backend, got %d", backend.lookups)
+	}
+
+	// Writes through the cache are read at once.
+	load(t, qs, []quad.Quad{{"E", "follows", "B", ""}})
+	if got := subjects(qs, quad.Object, "B"); len(got) != 3 {
+		t.Errorf("Write not seen through the cache: %v", got)
+	}
+	if backend.lookups != 2 {
+		t.Errorf("Expected the write to invalidate the lookup, got %d lookups", backend.lookups)
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	backend := &countingStore{QuadStore: newMemStore(t)}
+	qs := New(backend, 100, 1)
+	defer qs.Close()
+	load(t, qs, simpleGraph)
+
+	for i := 0; i < 2; i++ {
+		if got := subjects(qs, quad.Object, "B"); len(got) != 2 {
+			t.Fatalf("Unexpected subjects of B: %v", got)
+		}
+	}
+	if backend.lookups < 2 {
+		t.Errorf("Expected a node with too many quads not to be cached, got %d lookups", backend.lookups)
+	}
+}
+
+func TestBackendWrites(t *testing.T) {
+	backend := newMemStore(t)
+	qs := New(backend, 100, DefaultMaxResults)
+	defer qs.Close()
+	load(t, qs, simpleGraph)
+	if got := subjects(qs, quad.Object, "D"); len(got) != 1 {
+		t.Fatalf("Unexpected subjects of D: %v", got)
+	}
+
+	// A write made directly to the backend is reported by it.
+	load(t, backend, []quad.Quad{{"A", "follows", "D", ""}})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(subjects(qs, quad.Object, "D")) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Backend write not seen through the cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	backend := &countingStore{QuadStore: newMemStore(t)}
+	qs := New(backend, 1, DefaultMaxResults)
+	defer qs.Close()
+	if err := qs.openDisk(filepath.Join(dir, "cache.db")); err != nil {
+		t.Fatalf("Could not open disk cache: %v", err)
+	}
+	load(t, qs, simpleGraph)
+
+	// With room for one entry in memory, the lookups of B are evicted to
+	// disk by those of D.
+	for i := 0; i < 2; i++ {
+		if got := subjects(qs, quad.Object, "B"); len(got) != 2 {
+			t.Fatalf("Unexpected subjects of B: %v", got)
+		}
+		if got := subjects(qs, quad.Object, "D"); len(got) != 1 {
+			t.Fatalf("Unexpected subjects of D: %v", got)
+		}
+	}
+	if backend.lookups != 2 {
+		t.Errorf("Expected lookups to be read from disk, got %d lookups", backend.lookups)
+	}
+}
+
+func TestFollowLog(t *testing.T) {
+	var batches []writer.LogBatch
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out := writer.LogBatches{Batches: []writer.LogBatch{}}
+		if r.URL.Query().Get("offset") == "0" {
+			out.Batches = batches
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	backend := &countingStore{QuadStore: newMemStore(t)}
+	qs := New(backend, 100, DefaultMaxResults)
+	defer qs.Close()
+	load(t, qs, simpleGraph)
+	subjects(qs, quad.Object, "B")
+
+	batches = []writer.LogBatch{{Offset: 1, Deltas: []graph.Delta{
+		{ID: graph.NewSequentialKey(1), Quad: quad.Quad{"E", "follows", "B", ""}, Action: graph.Add},
+	}}}
+	qs.logURL = srv.URL
+	qs.client = srv.Client()
+	if n, err := qs.syncLog(); err != nil || n != 1 {
+		t.Fatalf("Unexpected log sync, got %d batches: %v", n, err)
+	}
+	subjects(qs, quad.Object, "B")
+	if backend.lookups != 2 {
+		t.Errorf("Expected the logged write to invalidate the lookup, got %d lookups", backend.lookups)
+	}
+	if n, _ := qs.syncLog(); n != 0 || qs.offset != 1 {
+		t.Errorf("Expected the log to be read from offset 1, got %d batches at %d", n, qs.offset)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Defines the optional interfaces a QuadStore may implement on top of the
+// required QuadStore interface, and a helper to discover them.
+//
+// Callers should feature-detect through these interfaces (or Capabilities)
+// rather than type-asserting to a concrete backend, so that wrapping stores
+// and new backends get the same treatment as the built in ones.
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/cayley/quad"
+)
+
+// Counter is implemented by stores that keep an exact count of the live
+// quads referencing each node.
+type Counter interface {
+	// SizeOf returns the number of quads that have the given node in any
+	// direction.
+	SizeOf(Value) int64
+}
+
+// RangeIndexer is implemented by stores that keep node names in sorted
+// order and can enumerate a range of them without a full scan.
+type RangeIndexer interface {
+	// NodesRangeIterator returns an iterator over the nodes whose names sort
+	// within [from, to). An empty bound is unbounded on that side.
+	NodesRangeIterator(from, to string) Iterator
+}
+
+// FullTextSearcher is implemented by stores that maintain a text index over
+// node names.
+type FullTextSearcher interface {
+	// SearchIterator returns an iterator over the nodes whose names match the
+	// given text query.
+	SearchIterator(text string) Iterator
+}
+
+// Watcher is implemented by stores that can notify callers of the deltas
+// they apply.
+type Watcher interface {
+	// Subscribe returns a channel on which every successfully applied delta
+	// matching the pattern is sent. Empty fields of the pattern match any
+	// value.
+	Subscribe(pattern quad.Quad) <-chan Delta
+
+	// Unsubscribe stops and closes a channel returned by Subscribe.
+	Unsubscribe(<-chan Delta)
+}
+
+// Expirer is implemented by stores that record the expiry time of the quads
+// added with one.
+type Expirer interface {
+	// ExpiredQuads returns the live quads that expired at or before now.
+	ExpiredQuads(now time.Time) ([]quad.Quad, error)
+}
+
+// Evicter is implemented by stores that make room for the writes that would
+// take them over their limits by deleting quads, so that the writer can delete
+// them along with the write.
+type Evicter interface {
+	// Evictions returns the live quads to delete for the deltas to be
+	// applied within the limits of the store, or none if they need no room
+	// or deleting all the quads the store would evict does not make enough.
+	Evictions(deltas []Delta) ([]quad.Quad, error)
+}
+
+// QuadMatcher is implemented by stores that can find the quads matching a
+// pattern in a single lookup, rather than by iterating over an index.
+type QuadMatcher interface {
+	// MatchingQuads returns the live quads equal to pattern in each of its
+	// non-empty fields.
+	MatchingQuads(pattern quad.Quad) ([]quad.Quad, error)
+}
+
+// Reviser is implemented by stores that record the horizon at which each
+// quad was added and removed, and so can be read as of an earlier point.
+type Reviser interface {
+	// AtRevision returns a read-only view of the store holding the quads
+	// that were live once the delta with the given ID had been applied.
+	// Only quads are versioned: the view's nodes and Size are those of the
+	// live store.
+	AtRevision(horizon int64) (QuadStore, error)
+}
+
+// ProvenanceKeeper is implemented by stores that record the provenance of
+// the quads added with one.
+type ProvenanceKeeper interface {
+	// Provenance returns the provenance of a live quad, and whether one was
+	// recorded when it was added.
+	Provenance(q Value) (Provenance, bool)
+}
+
+// BulkResolver is implemented by stores that can convert many node names
+// to values, or values to names, at once, more cheaply than one at a time.
+type BulkResolver interface {
+	// ValuesOf returns the value of each name, like ValueOf, in order.
+	ValuesOf(names []string) []Value
+
+	// NamesOf returns the name of each value, like NameOf, in order.
+	NamesOf(values []Value) []string
+}
+
+// Purger is implemented by stores that keep deleted quads as tombstones,
+// hidden from queries but kept for reading earlier revisions, and can remove
+// them for good.
+type Purger interface {
+	// Purge permanently removes the quads deleted before the given time,
+	// and returns how many were removed. Revisions from before that time
+	// can no longer be read faithfully afterwards.
+	Purge(before time.Time) (int, error)
+}
+
+// GarbageCollector is implemented by stores that keep the values of nodes
+// after the last quad referencing them is gone, and can remove them.
+type GarbageCollector interface {
+	// CollectGarbage removes the values of the nodes no quad, live or
+	// deleted, references any more.
+	CollectGarbage() (GCStats, error)
+}
+
+// Compactor is implemented by stores whose deleted quads and node values
+// take up space on disk until they are removed and the files rewritten.
+type Compactor interface {
+	// Compact purges the quads deleted before the given time, recounts
+	// the live quads of each node value and removes the values no quad
+	// references, then reclaims the space they took up.
+	Compact(before time.Time) (CompactStats, error)
+}
+
+// Verifier is implemented by stores that keep redundant indexes of their
+// quads, and can check them against the primary records.
+type Verifier interface {
+	// Verify checks that every index entry and node value agrees with the
+	// primary quad records, and rewrites the ones that do not if repair is
+	// set.
+	Verify(repair bool) (VerifyReport, error)
+}
+
+// Tuner is implemented by stores with options that can be changed while
+// they are open.
+type Tuner interface {
+	// Tune applies the options it can change, such as the sizes of caches,
+	// and ignores the others.
+	Tune(opts Options) error
+}
+
+// NodeCounter is implemented by stores that can count their nodes without
+// reading their quads.
+type NodeCounter interface {
+	// NodeCount returns the number of node values the store holds,
+	// including those only deleted quads reference, until they are
+	// collected as garbage.
+	NodeCount() (int64, error)
+}
+
+// GeoIndexer is implemented by stores that keep their geographic point
+// literals in a geohash index.
+type GeoIndexer interface {
+	// NearIterator returns an iterator over the nodes that are points
+	// within radius metres of the given one.
+	NearIterator(center quad.GeoPoint, radius float64) Iterator
+}
+
+// ValueRangeIndexer is implemented by stores that keep the numbers and times
+// their literals hold in sorted indexes.
+type ValueRangeIndexer interface {
+	// ValueRangeIterator returns an iterator over the nodes holding values
+	// within the range.
+	ValueRangeIterator(r quad.ValueRange) Iterator
+}
+
+// QuadCounter is implemented by stores that can count the copies of a quad
+// they hold without reading its other quads.
+type QuadCounter interface {
+	// QuadCount returns the number of live copies of q the store holds.
+	QuadCount(q quad.Quad) int64
+
+	// Multiset returns whether the store holds a copy of a quad for each
+	// time it was added, removing one copy each time it is removed,
+	// rather than holding each quad at most once.
+	Multiset() bool
+}
+
+// Capability is a set of optional features supported by a QuadStore.
+type Capability uint
+
+// The optional features a QuadStore may support.
+const (
+	CanBulkLoad Capability = 1 << iota
+	CanCount
+	CanRangeIndex
+	CanSearch
+	CanWatch
+	CanExpire
+	CanMatch
+	CanRevision
+	CanResolve
+	CanProvenance
+	CanPurge
+	CanCollect
+	CanSync
+	CanVerify
+	CanTune
+	CanCountNodes
+	CanGeo
+	CanValueRange
+	CanCountQuads
+	CanCompact
+)
+
+var capabilityNames = []string{
+	"bulkload",
+	"count",
+	"rangeindex",
+	"search",
+	"watch",
+	"expire",
+	"match",
+	"revision",
+	"resolve",
+	"provenance",
+	"purge",
+	"gc",
+	"sync",
+	"verify",
+	"tune",
+	"countnodes",
+	"geo",
+	"valuerange",
+	"countquads",
+	"compact",
+}
+
+// Has returns whether all the features in o are present in c.
+func (c Capability) Has(o Capability) bool {
+	return c&o == o
+}
+
+// String returns a comma separated list of the features in c.
+func (c Capability) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c.Has(1 << uint(i)) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Capabilities returns the set of optional features the given QuadStore
+// implements.
+func Capabilities(qs QuadStore) Capability {
+	var c Capability
+	if _, ok := qs.(BulkLoader); ok {
+		c |= CanBulkLoad
+	}
+	if _, ok := qs.(Counter); ok {
+		c |= CanCount
+	}
+	if _, ok := qs.(RangeIndexer); ok {
+		c |= CanRangeIndex
+	}
+	if _, ok := qs.(FullTextSearcher); ok {
+		c |= CanSearch
+	}
+	if _, ok := qs.(Watcher); ok {
+		c |= CanWatch
+	}
+	if _, ok := qs.(Expirer); ok {
+		c |= CanExpire
+	}
+	if _, ok := qs.(QuadMatcher); ok {
+		c |= CanMatch
+	}
+	if _, ok := qs.(Reviser); ok {
+		c |= CanRevision
+	}
+	if _, ok := qs.(BulkResolver); ok {
+		c |= CanResolve
+	}
+	if _, ok := qs.(ProvenanceKeeper); ok {
+		c |= CanProvenance
+	}
+	if _, ok := qs.(Purger); ok {
+		c |= CanPurge
+	}
+	if _, ok := qs.(GarbageCollector); ok {
+		c |= CanCollect
+	}
+	if _, ok := qs.(Syncer); ok {
+		c |= CanSync
+	}
+	if _, ok := qs.(Verifier); ok {
+		c |= CanVerify
+	}
+	if _, ok := qs.(Tuner); ok {
+		c |= CanTune
+	}
+	if _, ok := qs.(NodeCounter); ok {
+		c |= CanCountNodes
+	}
+	if _, ok := qs.(GeoIndexer); ok {
+		c |= CanGeo
+	}
+	if _, ok := qs.(ValueRangeIndexer); ok {
+		c |= CanValueRange
+	}
+	if _, ok := qs.(QuadCounter); ok {
+		c |= CanCountQuads
+	}
+	if _, ok := qs.(Compactor); ok {
+		c |= CanCompact
+	}
+	return c
+}
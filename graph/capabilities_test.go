@@ -0,0 +1,57 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"testing"
+
+	"github.com/google/cayley/quad"
+)
+
+type plainStore struct {
+	QuadStore
+}
+
+type countingLoader struct {
+	QuadStore
+}
+
+func (countingLoader) SizeOf(Value) int64              { return 0 }
+func (countingLoader) BulkLoad(quad.Unmarshaler) error { return nil }
+
+func TestCapabilities(t *testing.T) {
+	for _, test := range []struct {
+		qs     QuadStore
+		expect Capability
+		name   string
+	}{
+		{qs: plainStore{}, expect: 0, name: ""},
+		{qs: countingLoader{}, expect: CanBulkLoad | CanCount, name: "bulkload,count"},
+	} {
+		c := Capabilities(test.qs)
+		if c != test.expect {
+			t.Errorf("Unexpected capabilities for %T, got:%v expect:%v", test.qs, c, test.expect)
+		}
+		if c.String() != test.name {
+			t.Errorf("Unexpected capability string for %T, got:%q expect:%q", test.qs, c, test.name)
+		}
+		if !c.Has(0) {
+			t.Errorf("Capability %v should contain the empty set", c)
+		}
+		if c.Has(CanWatch) {
+			t.Errorf("Capability %v should not contain watch", c)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoCompact is returned when compacting a store that does not support it.
+var ErrNoCompact = errors.New("quad store does not support compaction")
+
+// CompactStats reports what a compaction reclaimed.
+type CompactStats struct {
+	// Quads is the number of deleted quads purged.
+	Quads int
+
+	// Nodes is the number of node values removed, as no quad references
+	// them any more.
+	Nodes int
+
+	// Values is the number of node values rewritten, as their count of
+	// live quads was wrong.
+	Values int
+
+	// Before and After are the sizes of the store on disk, in bytes,
+	// before and after it was compacted.
+	Before, After int64
+}
+
+// Compact purges the quads of qs deleted more than retention ago, rewrites
+// its node values and reclaims the space they took up on disk, or returns
+// ErrNoCompact if qs is not a Compactor.
+//
+// Like garbage collection, it must not run concurrently with writes.
+func Compact(qs QuadStore, retention time.Duration) (CompactStats, error) {
+	c, ok := qs.(Compactor)
+	if !ok {
+		return CompactStats{}, ErrNoCompact
+	}
+	return c.Compact(time.Now().Add(-retention))
+}
+
+// Compact compacts the handle's store, purging the quads deleted more than
+// retention ago.
+func (h *Handle) Compact(retention time.Duration) (CompactStats, error) {
+	return Compact(h.QuadStore, retention)
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/google/cayley/quad"
+
+// DedupeReport describes the duplicate quads a deduplication pass found.
+type DedupeReport struct {
+	// Quads is the number of quads read.
+	Quads int64 `json:"quads"`
+
+	// Duplicated is the number of quads held more than once.
+	Duplicated int `json:"duplicated"`
+
+	// Copies is the number of copies beyond the first of those quads.
+	Copies int `json:"copies"`
+
+	// Removed is the number of copies removed.
+	Removed int `json:"removed"`
+}
+
+// Dedupe finds the quads qs holds more than once, as distinct values of the
+// same quad, reading the quads of one subject at a time, and unless dryRun is
+// set, rewrites each of them with qw, so that it is held once.
+//
+// The backends that key quads by their contents, as all those built in do
+// unless opened as multisets, never hold duplicates; those without unique
+// constraints may, and are expected to remove every copy of a quad when it is
+// removed. A duplicated quad is missing from the store between its removal
+// and its addition. The extra copies of a multiset, which removes one copy at
+// a time, are removed one by one.
+func Dedupe(qs QuadStore, qw QuadWriter, dryRun bool) (DedupeReport, error) {
+	var rep DedupeReport
+	copies := make(map[quad.Quad]int)
+	var dups []quad.Quad
+	nodes := qs.NodesAllIterator()
+	defer nodes.Close()
+	for Next(nodes) {
+		it := qs.QuadIterator(quad.Subject, nodes.Result())
+		seen := make(map[quad.Quad]int)
+		for Next(it) {
+			rep.Quads++
+			q := qs.Quad(it.Result())
+			seen[q]++
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return rep, err
+		}
+		for q, n := range seen {
+			if n > 1 {
+				dups = append(dups, q)
+				copies[q] = n - 1
+				rep.Duplicated++
+				rep.Copies += n - 1
+			}
+		}
+	}
+	if err := nodes.Err(); err != nil {
+		return rep, err
+	}
+	if dryRun {
+		return rep, nil
+	}
+	multiset := IsMultiset(qs)
+	for _, q := range dups {
+		if multiset {
+			for i := 0; i < copies[q]; i++ {
+				if err := qw.RemoveQuad(q); err != nil {
+					return rep, err
+				}
+				rep.Removed++
+			}
+			continue
+		}
+		if err := qw.RemoveQuad(q); err != nil {
+			return rep, err
+		}
+		if err := qw.AddQuad(q); err != nil {
+			return rep, err
+		}
+		rep.Removed += copies[q]
+	}
+	return rep, nil
+}
+
+// Dedupe finds and removes the duplicate quads of the handle's store.
+func (h *Handle) Dedupe(dryRun bool) (DedupeReport, error) {
+	return Dedupe(h.QuadStore, h.QuadWriter, dryRun)
+}
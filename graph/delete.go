@@ -0,0 +1,80 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+
+	"github.com/google/cayley/quad"
+)
+
+// QuadsTouching returns the quads of qs with any of the named nodes in any
+// direction, each once.
+func QuadsTouching(qs QuadStore, names []string) ([]quad.Quad, error) {
+	var (
+		out  []quad.Quad
+		seen = make(map[quad.Quad]bool)
+	)
+	for _, name := range names {
+		quads, err := quadsOn(qs, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range quads {
+			if !seen[q] {
+				seen[q] = true
+				out = append(out, q)
+			}
+		}
+	}
+	return out, nil
+}
+
+// DeleteQuads removes the quads through qw, in transactions of batchSize
+// quads each, and returns the number removed. Quads already removed are
+// skipped if qw is an IgnoringWriter. As with RenamePredicate, the store is
+// never locked for long, but a failure may leave some of the quads removed;
+// progress, if not nil, is called after each batch with the number of quads
+// removed so far.
+func DeleteQuads(qw QuadWriter, quads []quad.Quad, batchSize int, progress func(int)) (int, error) {
+	if batchSize <= 0 {
+		return 0, errors.New("invalid batch size")
+	}
+	if iw, ok := qw.(IgnoringWriter); ok {
+		opts := iw.IgnoreOpts()
+		opts.IgnoreMissing = true
+		qw = iw.WithIgnoreOpts(opts)
+	}
+	done := 0
+	for len(quads) > 0 {
+		n := batchSize
+		if n > len(quads) {
+			n = len(quads)
+		}
+		tx := NewTransaction()
+		for _, q := range quads[:n] {
+			tx.RemoveQuad(q)
+		}
+		if err := qw.ApplyTransaction(tx); err != nil {
+			return done, err
+		}
+		done += n
+		quads = quads[n:]
+		if progress != nil {
+			progress(done)
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Defines FullTextIndexer, the pluggable text index a QuadStore keeps to
+// implement FullTextSearcher, and the registry of its implementations.
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/quad"
+)
+
+// FullTextIndexSuffix is appended to the path of a persistent store to give
+// the path of its text index.
+const FullTextIndexSuffix = ".fulltext"
+
+// FullTextIndexer is a text index over the nodes quads have as objects, where
+// the literal values of the graph are. Stores that keep one update it with
+// IndexDeltas as they apply deltas, and search it with SearchIteratorOf.
+type FullTextIndexer interface {
+	// Index adds the named nodes to the index. Indexing a node already
+	// indexed is not an error.
+	Index(names []string) error
+
+	// Remove drops the named nodes from the index.
+	Remove(names []string) error
+
+	// Search returns the names of the nodes matching the text query, in
+	// the syntax of the indexer.
+	Search(text string) ([]string, error)
+
+	// Count returns the number of nodes indexed.
+	Count() (uint64, error)
+
+	Close() error
+}
+
+// NewFullTextIndexerFunc opens the text index at the given path, creating
+// it if needed. An empty path keeps the index in memory.
+type NewFullTextIndexerFunc func(path string, opts Options) (FullTextIndexer, error)
+
+var fullTextRegistry = make(map[string]NewFullTextIndexerFunc)
+
+func RegisterFullTextIndexer(name string, newFunc NewFullTextIndexerFunc) {
+	if _, found := fullTextRegistry[name]; found {
+		panic("already registered FullTextIndexer " + name)
+	}
+	fullTextRegistry[name] = newFunc
+}
+
+func NewFullTextIndexer(name, path string, opts Options) (FullTextIndexer, error) {
+	newFunc, ok := fullTextRegistry[name]
+	if !ok {
+		return nil, errors.New("fulltext: name '" + name + "' is not registered")
+	}
+	return newFunc(path, opts)
+}
+
+func FullTextIndexers() []string {
+	t := make([]string, 0, len(fullTextRegistry))
+	for n := range fullTextRegistry {
+		t = append(t, n)
+	}
+	return t
+}
+
+// OpenFullTextIndex opens the text index of qs given by the
+// "full_text_index" option, or returns nil if it is not given. The index of a
+// store kept at path is kept beside it, with FullTextIndexSuffix appended; an
+// empty path keeps it in memory. An empty index is built from the quads qs
+// holds already.
+func OpenFullTextIndex(qs QuadStore, path string, opts Options) (FullTextIndexer, error) {
+	name, ok, err := opts.StringKey("full_text_index")
+	if err != nil || !ok || name == "" {
+		return nil, err
+	}
+	if readOnly, _, _ := opts.BoolKey("read_only"); readOnly {
+		// The index cannot be shared with the process writing it.
+		return nil, fmt.Errorf("the %s text index cannot be opened read-only", name)
+	}
+	if path != "" {
+		path += FullTextIndexSuffix
+	}
+	idx, err := NewFullTextIndexer(name, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	n, err := idx.Count()
+	if err == nil && n == 0 && qs.Size() > 0 {
+		err = ReindexFullText(qs, idx)
+	}
+	if err != nil {
+		idx.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// reindexBatch is the number of nodes indexed at once by ReindexFullText.
+const reindexBatch = 1000
+
+// ReindexFullText adds the objects of every quad qs holds to idx.
+func ReindexFullText(qs QuadStore, idx FullTextIndexer) error {
+	clog.Infof("Building the text index of %d quads", qs.Size())
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	batch := make(map[string]struct{}, reindexBatch)
+	flush := func() error {
+		names := make([]string, 0, len(batch))
+		for name := range batch {
+			names = append(names, name)
+			delete(batch, name)
+		}
+		return idx.Index(names)
+	}
+	for Next(it) {
+		q := qs.Quad(it.Result())
+		batch[q.Object] = struct{}{}
+		if len(batch) == reindexBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// IndexDeltas updates idx once the deltas have been applied to qs: the
+// objects the deltas add are indexed, and those qs no longer has as the
+// object of any quad are removed.
+func IndexDeltas(qs QuadStore, idx FullTextIndexer, deltas []Delta) error {
+	index, remove := ObjectChanges(qs, deltas)
+	if len(index) > 0 {
+		if err := idx.Index(index); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		return idx.Remove(remove)
+	}
+	return nil
+}
+
+// ObjectChanges returns, once the deltas have been applied to qs, the objects
+// they add, and those they delete that qs no longer has as the object of any
+// quad, for stores to update the indexes they keep over objects.
+func ObjectChanges(qs QuadStore, deltas []Delta) (added, removed []string) {
+	return objectChanges(qs, deltas, nil)
+}
+
+// objectChanges is ObjectChanges for the objects keep returns true for, or
+// all of them if keep is nil.
+func objectChanges(qs QuadStore, deltas []Delta, keep func(string) bool) (added, removed []string) {
+	adds := make(map[string]bool)
+	for i := range deltas {
+		d := &deltas[i]
+		if keep != nil && !keep(d.Quad.Object) {
+			continue
+		}
+		adds[d.Quad.Object] = adds[d.Quad.Object] || d.Action == Add
+	}
+	for name, add := range adds {
+		switch {
+		case !hasObject(qs, name):
+			removed = append(removed, name)
+		case add:
+			added = append(added, name)
+		}
+	}
+	return added, removed
+}
+
+// hasObject returns whether any quad of qs has the named node as its object.
+func hasObject(qs QuadStore, name string) bool {
+	v := qs.ValueOf(name)
+	if v == nil {
+		return false
+	}
+	it := qs.QuadIterator(quad.Object, v)
+	defer it.Close()
+	return Next(it)
+}
+
+// SearchIteratorOf returns an iterator over the nodes of qs matching the text
+// query in idx. A query the index fails to run matches no nodes.
+func SearchIteratorOf(qs QuadStore, idx FullTextIndexer, text string) Iterator {
+	names, err := idx.Search(text)
+	if err != nil {
+		clog.Errorf("fulltext: searching %q: %v", text, err)
+		return qs.FixedIterator()
+	}
+	return FixedIteratorOf(qs, names...)
+}
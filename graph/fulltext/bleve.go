@@ -0,0 +1,106 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build bleve
+
+package fulltext
+
+import (
+	"github.com/blevesearch/bleve"
+
+	"github.com/google/cayley/graph"
+)
+
+const BleveIndexType = "bleve"
+
+func init() {
+	graph.RegisterFullTextIndexer(BleveIndexType, newBleveIndex)
+}
+
+// searchPage is the number of matches read from the index at once.
+const searchPage = 1000
+
+type bleveIndex struct {
+	index bleve.Index
+}
+
+// document is what is indexed for a node: its name, in a field of its own.
+type document struct {
+	Name string `json:"name"`
+}
+
+func newBleveIndex(path string, _ graph.Options) (graph.FullTextIndexer, error) {
+	var (
+		index bleve.Index
+		err   error
+	)
+	if path == "" {
+		index, err = bleve.NewMemOnly(bleve.NewIndexMapping())
+	} else {
+		index, err = bleve.Open(path)
+		if err == bleve.ErrorIndexPathDoesNotExist {
+			index, err = bleve.New(path, bleve.NewIndexMapping())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bleveIndex{index: index}, nil
+}
+
+func (b *bleveIndex) Index(names []string) error {
+	batch := b.index.NewBatch()
+	for _, name := range names {
+		if err := batch.Index(name, document{Name: name}); err != nil {
+			return err
+		}
+	}
+	return b.index.Batch(batch)
+}
+
+func (b *bleveIndex) Remove(names []string) error {
+	batch := b.index.NewBatch()
+	for _, name := range names {
+		batch.Delete(name)
+	}
+	return b.index.Batch(batch)
+}
+
+// Search runs text as a query string, and returns every node it matches,
+// best first.
+func (b *bleveIndex) Search(text string) ([]string, error) {
+	query := bleve.NewQueryStringQuery(text)
+	var names []string
+	for {
+		req := bleve.NewSearchRequestOptions(query, searchPage, len(names), false)
+		res, err := b.index.Search(req)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range res.Hits {
+			names = append(names, hit.ID)
+		}
+		if len(res.Hits) < searchPage || uint64(len(names)) >= res.Total {
+			return names, nil
+		}
+	}
+}
+
+func (b *bleveIndex) Count() (uint64, error) {
+	return b.index.DocCount()
+}
+
+func (b *bleveIndex) Close() error {
+	return b.index.Close()
+}
@@ -0,0 +1,22 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fulltext provides the text indexes stores may keep to implement
+// graph.FullTextSearcher.
+//
+// The "bleve" index is embedded: it is kept in memory, or in a directory
+// beside the database, and needs no service of its own. It is only built into
+// binaries built with the bleve tag, after fetching
+// github.com/blevesearch/bleve.
+package fulltext
@@ -18,12 +18,12 @@ package gaedatastore
 
 import (
 	"fmt"
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
 
 	"appengine/datastore"
-	"github.com/barakmich/glog"
 )
 
 type Iterator struct {
@@ -51,18 +51,18 @@ var (
 func NewIterator(qs *QuadStore, k string, d quad.Direction, val graph.Value) *Iterator {
 	t := val.(*Token)
 	if t == nil {
-		glog.Error("Token == nil")
+		clog.Error("Token == nil")
 	}
 	if t.Kind != nodeKind {
-		glog.Error("Cannot create an iterator from a non-node value")
+		clog.Error("Cannot create an iterator from a non-node value")
 		return &Iterator{done: true}
 	}
 	if k != nodeKind && k != quadKind {
-		glog.Error("Cannot create iterator for unknown kind")
+		clog.Error("Cannot create iterator for unknown kind")
 		return &Iterator{done: true}
 	}
 	if qs.context == nil {
-		glog.Error("Cannot create iterator without a valid context")
+		clog.Error("Cannot create iterator without a valid context")
 		return &Iterator{done: true}
 	}
 	name := qs.NameOf(t)
@@ -72,7 +72,7 @@ func NewIterator(qs *QuadStore, k string, d quad.Direction, val graph.Value) *It
 	foundNode := new(NodeEntry)
 	err := datastore.Get(qs.context, key, foundNode)
 	if err != nil && err != datastore.ErrNoSuchEntity {
-		glog.Errorf("Error: %v", err)
+		clog.Errorf("Error: %v", err)
 		return &Iterator{done: true}
 	}
 	size := foundNode.Size
@@ -92,11 +92,11 @@ func NewIterator(qs *QuadStore, k string, d quad.Direction, val graph.Value) *It
 
 func NewAllIterator(qs *QuadStore, kind string) *Iterator {
 	if kind != nodeKind && kind != quadKind {
-		glog.Error("Cannot create iterator for an unknown kind")
+		clog.Error("Cannot create iterator for an unknown kind")
 		return &Iterator{done: true}
 	}
 	if qs.context == nil {
-		glog.Error("Cannot create iterator without a valid context")
+		clog.Error("Cannot create iterator without a valid context")
 		return &Iterator{done: true}
 	}
 
@@ -151,11 +151,11 @@ func (it *Iterator) Contains(v graph.Value) bool {
 	}
 	t := v.(*Token)
 	if t == nil {
-		glog.Error("Could not cast to token")
+		clog.Error("Could not cast to token")
 		return graph.ContainsLogOut(it, v, false)
 	}
 	if t.Kind == nodeKind {
-		glog.Error("Contains does not work with node values")
+		clog.Error("Contains does not work with node values")
 		return graph.ContainsLogOut(it, v, false)
 	}
 	// Contains is for when you want to know that an iterator refers to a quad
@@ -264,7 +264,7 @@ func (it *Iterator) Next() bool {
 			break
 		}
 		if err != nil {
-			glog.Errorf("Error fetching next entry %v", err)
+			clog.Errorf("Error fetching next entry %v", err)
 			it.err = err
 			return false
 		}
@@ -279,7 +279,7 @@ func (it *Iterator) Next() bool {
 	}
 	// Protect against bad queries
 	if it.done && len(it.buffer) == 0 {
-		glog.Warningf("Query did not return any results")
+		clog.Warningf("Query did not return any results")
 		return false
 	}
 	// First result
@@ -0,0 +1,50 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "errors"
+
+// ErrNoGC is returned when collecting the garbage of a store that does not
+// support it.
+var ErrNoGC = errors.New("quad store does not support garbage collection")
+
+// GCStats reports what a garbage collection pass reclaimed.
+type GCStats struct {
+	// Nodes is the number of node values removed.
+	Nodes int
+
+	// Bytes is the approximate space they took up.
+	Bytes int64
+}
+
+// CollectGarbage removes the values of the nodes of qs that no quad
+// references, or returns ErrNoGC if qs is not a GarbageCollector.
+//
+// Nodes still referenced by deleted quads are kept until the quads are
+// purged. Concurrent writes may add a quad to a node being removed, so
+// the writer should be paused, or collect the garbage itself.
+func CollectGarbage(qs QuadStore) (GCStats, error) {
+	gc, ok := qs.(GarbageCollector)
+	if !ok {
+		return GCStats{}, ErrNoGC
+	}
+	return gc.CollectGarbage()
+}
+
+// CollectGarbage removes the values of the nodes of the handle's store that
+// no quad references.
+func (h *Handle) CollectGarbage() (GCStats, error) {
+	return CollectGarbage(h.QuadStore)
+}
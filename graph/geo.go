@@ -0,0 +1,84 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Defines the helpers QuadStores use to keep the geohash index of
+// GeoIndexer.
+
+import (
+	"github.com/google/cayley/quad"
+)
+
+func isGeoPoint(name string) bool {
+	_, ok := quad.ParseGeoPoint(name)
+	return ok
+}
+
+// GeoChanges is like ObjectChanges, for the objects that are geographic
+// points: it returns those a store should add to its geohash index once the
+// deltas have been applied, and those it should remove.
+func GeoChanges(qs QuadStore, deltas []Delta) (added, removed []string) {
+	return objectChanges(qs, deltas, isGeoPoint)
+}
+
+// GeoObjects calls fn with each geographic point qs has as the object of a
+// quad, at least once, for stores to build their geohash index.
+func GeoObjects(qs QuadStore, fn func(name string, p quad.GeoPoint) error) error {
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for Next(it) {
+		name := qs.Quad(it.Result()).Object
+		if p, ok := quad.ParseGeoPoint(name); ok {
+			if err := fn(name, p); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Err()
+}
+
+// NearIteratorOf returns an iterator over the nodes among those given that
+// are points within radius metres of center. Stores implementing GeoIndexer
+// pass it the nodes of their index in the ranges of center.GeohashRanges.
+func NearIteratorOf(qs QuadStore, center quad.GeoPoint, radius float64, nodes []Value) Iterator {
+	fixed := qs.FixedIterator()
+	for _, v := range nodes {
+		if p, ok := quad.ParseGeoPoint(qs.NameOf(v)); ok && center.Distance(p) <= radius {
+			fixed.Add(v)
+		}
+	}
+	return fixed
+}
+
+// NearIterator returns an iterator over the nodes of qs that are points within
+// radius metres of center, from the geohash index of qs if it keeps one.
+func NearIterator(qs QuadStore, center quad.GeoPoint, radius float64) Iterator {
+	if g, ok := qs.(GeoIndexer); ok {
+		return g.NearIterator(center, radius)
+	}
+	return ScanNear(qs, center, radius)
+}
+
+// ScanNear is NearIterator for stores without a geohash index: it reads the
+// names of all of their nodes.
+func ScanNear(qs QuadStore, center quad.GeoPoint, radius float64) Iterator {
+	all := qs.NodesAllIterator()
+	defer all.Close()
+	var nodes []Value
+	for Next(all) {
+		nodes = append(nodes, all.Result())
+	}
+	return NearIteratorOf(qs, center, radius, nodes)
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/graphtest/gen"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/quad"
+)
+
+// benchNodes is the number of nodes in the generated benchmark graph. Each
+// node follows the next three, and has one of ten statuses.
+const benchNodes = 1000
+
+func benchGraph() []quad.Quad {
+	var quads []quad.Quad
+	for i := 0; i < benchNodes; i++ {
+		node := fmt.Sprintf("node%d", i)
+		for j := 1; j <= 3; j++ {
+			quads = append(quads, quad.Quad{node, "follows", fmt.Sprintf("node%d", (i+j)%benchNodes), ""})
+		}
+		quads = append(quads, quad.Quad{node, "status", fmt.Sprintf("status%d", i%10), "status_graph"})
+	}
+	return quads
+}
+
+// BenchmarkAll runs every standard benchmark against stores made by gen.
+// Since the benchmarks share a *testing.B, each should be run on its own
+// when comparing numbers; BenchmarkAll is meant as a smoke test.
+func BenchmarkAll(b *testing.B, gen DatabaseFunc) {
+	BenchmarkLoad(b, gen)
+	BenchmarkQuadsAll(b, gen)
+	BenchmarkQuadIterator(b, gen)
+	BenchmarkQuery(b, gen)
+	BenchmarkSkewedQuery(b, gen)
+}
+
+// BenchmarkLoad measures loading the benchmark graph into an empty store, in
+// batches of a hundred quads.
+func BenchmarkLoad(b *testing.B, gen DatabaseFunc) {
+	data := benchGraph()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		qs, closer := gen(b)
+		w := newWriter(b, qs, nil)
+		b.StartTimer()
+		for j := 0; j < len(data); j += 100 {
+			end := j + 100
+			if end > len(data) {
+				end = len(data)
+			}
+			err := w.AddQuadSet(data[j:end])
+			if err != nil {
+				b.Fatalf("Could not load quads: %v", err)
+			}
+		}
+		b.StopTimer()
+		w.Close()
+		closer()
+		b.StartTimer()
+	}
+}
+
+func loadedStore(b *testing.B, gen DatabaseFunc) (graph.QuadStore, func()) {
+	qs, closer := gen(b)
+	w := loadGraph(b, qs, benchGraph())
+	w.Close()
+	return qs, closer
+}
+
+// BenchmarkQuadsAll measures iterating every quad in the store.
+func BenchmarkQuadsAll(b *testing.B, gen DatabaseFunc) {
+	qs, closer := loadedStore(b, gen)
+	defer closer()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it := qs.QuadsAllIterator()
+		for graph.Next(it) {
+			qs.Quad(it.Result())
+		}
+		it.Close()
+	}
+}
+
+// BenchmarkQuadIterator measures looking up the quads with a given subject.
+func BenchmarkQuadIterator(b *testing.B, gen DatabaseFunc) {
+	qs, closer := loadedStore(b, gen)
+	defer closer()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it := qs.QuadIterator(quad.Subject, qs.ValueOf(fmt.Sprintf("node%d", i%benchNodes)))
+		for graph.Next(it) {
+			qs.Quad(it.Result())
+		}
+		it.Close()
+	}
+}
+
+// BenchmarkQuery measures an optimized two hop traversal, followed by a
+// lookup of the status of the nodes reached.
+func BenchmarkQuery(b *testing.B, gen DatabaseFunc) {
+	qs, closer := loadedStore(b, gen)
+	defer closer()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it := path.StartPath(qs, fmt.Sprintf("node%d", i%benchNodes)).
+			Out("follows").Out("follows").
+			Out("status").Is("status0").
+			BuildIterator()
+		it, _ = it.Optimize()
+		for graph.Next(it) {
+			qs.NameOf(it.Result())
+		}
+		it.Close()
+	}
+}
+
+// skewedGraph is a generated graph in which a few nodes are the objects of
+// most quads.
+var skewedGraph = gen.Config{
+	Nodes:        benchNodes,
+	Degree:       4,
+	Distribution: gen.PowerLaw,
+	Predicates:   3,
+}
+
+// BenchmarkSkewedQuery measures a two hop traversal back from each node of a
+// graph with hubs, which reaches many nodes from the hubs and few from the
+// others.
+func BenchmarkSkewedQuery(b *testing.B, newStore DatabaseFunc) {
+	qs, closer := newStore(b)
+	defer closer()
+	w := newWriter(b, qs, nil)
+	if _, err := gen.Load(w, skewedGraph, 100); err != nil {
+		b.Fatalf("Could not load quads: %v", err)
+	}
+	w.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it := path.StartPath(qs, gen.NodeName(i%benchNodes)).
+			In(gen.PredicateName(0)).In(gen.PredicateName(1)).
+			BuildIterator()
+		it, _ = it.Optimize()
+		for graph.Next(it) {
+			qs.NameOf(it.Result())
+		}
+		it.Close()
+	}
+}
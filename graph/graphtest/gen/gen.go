@@ -0,0 +1,193 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package gen generates reproducible synthetic graphs, for tests, benchmarks
+// and capacity planning.
+//
+// A graph has a number of nodes, each the subject of the same number of
+// quads, whose predicates are drawn from a vocabulary and whose objects are
+// other nodes, chosen uniformly or, to model the hubs of real graphs, with a
+// power law. The same Config always generates the same quads.
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// Distribution is how the objects of quads are chosen among the nodes.
+type Distribution int
+
+const (
+	// Uniform makes every node equally likely to be an object, so
+	// in-degrees are all close to the mean.
+	Uniform Distribution = iota
+
+	// PowerLaw makes a few nodes the objects of most quads, following
+	// Zipf's law, as popular pages or people are in real graphs.
+	PowerLaw
+)
+
+// Config describes a graph to generate.
+type Config struct {
+	// Nodes is the number of nodes, named "n0", "n1" and so on.
+	Nodes int
+
+	// Degree is the number of quads each node is the subject of. It is
+	// capped by the number of distinct quads a node can have.
+	Degree int
+
+	// Distribution is how the objects of quads are chosen.
+	Distribution Distribution
+
+	// Predicates is the size of the vocabulary of predicates, named
+	// "p0", "p1" and so on, from which each quad's is chosen uniformly.
+	// Zero means one.
+	Predicates int
+
+	// Labels is the number of labels, named "l0", "l1" and so on, from
+	// which each quad's is chosen uniformly. Zero puts every quad in the
+	// default graph.
+	Labels int
+
+	// Seed seeds the choices. Graphs generated with different seeds
+	// differ.
+	Seed int64
+}
+
+// NodeName returns the name of the i'th node.
+func NodeName(i int) string {
+	return fmt.Sprintf("n%d", i)
+}
+
+// PredicateName returns the name of the i'th predicate.
+func PredicateName(i int) string {
+	return fmt.Sprintf("p%d", i)
+}
+
+// LabelName returns the name of the i'th label.
+func LabelName(i int) string {
+	return fmt.Sprintf("l%d", i)
+}
+
+// maxTries is how many times a quad that a node already has is drawn again.
+const maxTries = 10
+
+// Generate calls fn with each quad of the graph described by c, in order of
+// subject, and stops at the first error fn returns.
+func Generate(c Config, fn func(quad.Quad) error) error {
+	if c.Nodes < 2 {
+		return fmt.Errorf("gen: need at least 2 nodes, got %d", c.Nodes)
+	}
+	preds := c.Predicates
+	if preds < 1 {
+		preds = 1
+	}
+	degree := c.Degree
+	if max := (c.Nodes - 1) * preds; degree > max {
+		degree = max
+	}
+
+	r := rand.New(rand.NewSource(c.Seed))
+	object := func() int { return r.Intn(c.Nodes) }
+	if c.Distribution == PowerLaw {
+		// Zipf ranks nodes by popularity; the ranks are shuffled so
+		// that the hubs are not simply the first nodes.
+		z := rand.NewZipf(r, 1.1, 1, uint64(c.Nodes-1))
+		perm := r.Perm(c.Nodes)
+		object = func() int { return perm[z.Uint64()] }
+	}
+
+	type edge struct{ o, p int }
+	for s := 0; s < c.Nodes; s++ {
+		seen := make(map[edge]bool, degree)
+		for len(seen) < degree {
+			var e edge
+			for try := 0; ; try++ {
+				e = edge{o: object(), p: r.Intn(preds)}
+				if e.o != s && !seen[e] {
+					break
+				}
+				if try == maxTries {
+					// A hub that a power law keeps choosing;
+					// pick any other node instead.
+					e.o = (s + 1 + r.Intn(c.Nodes-1)) % c.Nodes
+					if !seen[e] {
+						break
+					}
+					try = 0
+				}
+			}
+			seen[e] = true
+			q := quad.Quad{
+				Subject:   NodeName(s),
+				Predicate: PredicateName(e.p),
+				Object:    NodeName(e.o),
+			}
+			if c.Labels > 0 {
+				q.Label = LabelName(r.Intn(c.Labels))
+			}
+			if err := fn(q); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Quads returns the quads of the graph described by c.
+func Quads(c Config) ([]quad.Quad, error) {
+	var quads []quad.Quad
+	err := Generate(c, func(q quad.Quad) error {
+		quads = append(quads, q)
+		return nil
+	})
+	return quads, err
+}
+
+// Load writes the graph described by c with qw, in blocks of batchSize quads,
+// and returns the number of quads written.
+func Load(qw graph.QuadWriter, c Config, batchSize int) (int, error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	var (
+		n     int
+		block = make([]quad.Quad, 0, batchSize)
+	)
+	flush := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		if err := qw.AddQuadSet(block); err != nil {
+			return err
+		}
+		n += len(block)
+		block = block[:0]
+		return nil
+	}
+	err := Generate(c, func(q quad.Quad) error {
+		block = append(block, q)
+		if len(block) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	return n, err
+}
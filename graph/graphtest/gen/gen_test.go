@@ -0,0 +1,105 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gen
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+	_ "github.com/google/cayley/writer"
+)
+
+func TestGenerate(t *testing.T) {
+	c := Config{Nodes: 100, Degree: 5, Predicates: 3, Labels: 2, Seed: 1}
+	quads, err := Quads(c)
+	if err != nil {
+		t.Fatalf("Could not generate: %v", err)
+	}
+	if len(quads) != 500 {
+		t.Errorf("Unexpected number of quads, got:%d expect:500", len(quads))
+	}
+	seen := make(map[quad.Quad]bool)
+	for _, q := range quads {
+		if seen[q] {
+			t.Errorf("Duplicate quad %v", q)
+		}
+		seen[q] = true
+		if q.Subject == q.Object {
+			t.Errorf("Loop %v", q)
+		}
+		if q.Label == "" {
+			t.Errorf("Unlabelled quad %v", q)
+		}
+	}
+
+	again, _ := Quads(c)
+	if !reflect.DeepEqual(quads, again) {
+		t.Errorf("Graph is not reproducible")
+	}
+	c.Seed = 2
+	other, _ := Quads(c)
+	if reflect.DeepEqual(quads, other) {
+		t.Errorf("Graphs with different seeds are the same")
+	}
+
+	c = Config{Nodes: 3, Degree: 10}
+	if quads, _ := Quads(c); len(quads) != 6 {
+		t.Errorf("Unexpected number of quads of a full graph, got:%d expect:6", len(quads))
+	}
+}
+
+func maxInDegree(t *testing.T, c Config) int {
+	quads, err := Quads(c)
+	if err != nil {
+		t.Fatalf("Could not generate: %v", err)
+	}
+	in := make(map[string]int)
+	var max int
+	for _, q := range quads {
+		in[q.Object]++
+		if in[q.Object] > max {
+			max = in[q.Object]
+		}
+	}
+	return max
+}
+
+func TestPowerLaw(t *testing.T) {
+	c := Config{Nodes: 1000, Degree: 10, Predicates: 5}
+	uniform := maxInDegree(t, c)
+	c.Distribution = PowerLaw
+	skewed := maxInDegree(t, c)
+	if skewed < 10*uniform {
+		t.Errorf("Power law graph has no hubs, max in-degree:%d uniform:%d", skewed, uniform)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer qw.Close()
+	n, err := Load(qw, Config{Nodes: 50, Degree: 4, Distribution: PowerLaw}, 30)
+	if err != nil {
+		t.Fatalf("Could not load: %v", err)
+	}
+	if n != 200 || qs.Size() != 200 {
+		t.Errorf("Unexpected number of quads loaded, got:%d/%d expect:200", n, qs.Size())
+	}
+}
@@ -0,0 +1,1236 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphtest is a conformance suite for QuadStore backends.
+//
+// A backend validates itself by calling TestAll, and measures itself with
+// BenchmarkAll, from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		graphtest.TestAll(t, makeStore)
+//	}
+package graphtest
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/writer"
+)
+
+// DatabaseFunc returns a new, empty QuadStore and a function that closes it
+// and removes any files it left behind.
+type DatabaseFunc func(t testing.TB) (graph.QuadStore, func())
+
+// This is a simple test graph.
+//
+//    +---+                        +---+
+//    | A |-------               ->| F |<--
+//    +---+       \------>+---+-/  +---+   \--+---+
+//                 ------>|#B#|      |        | E |
+//    +---+-------/      >+---+      |        +---+
+//    | C |             /            v
+//    +---+           -/           +---+
+//      ----    +---+/             |#G#|
+//          \-->|#D#|------------->+---+
+//              +---+
+//
+var simpleGraph = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"C", "follows", "B", ""},
+	{"C", "follows", "D", ""},
+	{"D", "follows", "B", ""},
+	{"B", "follows", "F", ""},
+	{"F", "follows", "G", ""},
+	{"D", "follows", "G", ""},
+	{"E", "follows", "F", ""},
+	{"B", "status", "cool", "status_graph"},
+	{"D", "status", "cool", "status_graph"},
+	{"G", "status", "cool", "status_graph"},
+}
+
+// SimpleGraph returns the quads of the graph loaded by the tests.
+func SimpleGraph() []quad.Quad {
+	return append([]quad.Quad(nil), simpleGraph...)
+}
+
+// TestAll runs every conformance test against stores made by gen.
+func TestAll(t *testing.T, gen DatabaseFunc) {
+	TestLoadOneQuad(t, gen)
+	TestHorizon(t, gen)
+	TestDuplicates(t, gen)
+	TestHasQuad(t, gen)
+	TestDelete(t, gen)
+	TestQuadsAllIterator(t, gen)
+	TestNodesAllIterator(t, gen)
+	TestQuadIterator(t, gen)
+	TestQuadsAllOn(t, gen)
+	TestMergeNodes(t, gen)
+	TestRenamePredicate(t, gen)
+	TestExtractSubgraph(t, gen)
+	TestIteratorReset(t, gen)
+	TestTransaction(t, gen)
+	TestDeleteQuadsMatching(t, gen)
+	TestWatch(t, gen)
+	TestWatchIgnored(t, gen)
+	TestRevision(t, gen)
+	TestSnapshot(t, gen)
+	TestProvenance(t, gen)
+	TestPurge(t, gen)
+	TestCollectGarbage(t, gen)
+	TestCompact(t, gen)
+	TestNear(t, gen)
+	TestValueRange(t, gen)
+}
+
+func newWriter(t testing.TB, qs graph.QuadStore, opts graph.Options) graph.QuadWriter {
+	w, err := writer.NewSingleReplication(qs, opts)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	return w
+}
+
+func loadGraph(t testing.TB, qs graph.QuadStore, data []quad.Quad) graph.QuadWriter {
+	w := newWriter(t, qs, nil)
+	err := w.AddQuadSet(data)
+	if err != nil {
+		t.Fatalf("Could not load quads: %v", err)
+	}
+	return w
+}
+
+// IteratedQuads returns the quads an iterator yields, in sorted order.
+func IteratedQuads(qs graph.QuadStore, it graph.Iterator) []quad.Quad {
+	var res ordered
+	for graph.Next(it) {
+		res = append(res, qs.Quad(it.Result()))
+	}
+	sort.Sort(res)
+	return res
+}
+
+// IteratedNames returns the names of the nodes an iterator yields, in sorted
+// order.
+func IteratedNames(qs graph.QuadStore, it graph.Iterator) []string {
+	var res []string
+	for graph.Next(it) {
+		res = append(res, qs.NameOf(it.Result()))
+	}
+	sort.Strings(res)
+	return res
+}
+
+type ordered []quad.Quad
+
+func (o ordered) Len() int { return len(o) }
+func (o ordered) Less(i, j int) bool {
+	a, b := o[i], o[j]
+	if a.Subject != b.Subject {
+		return a.Subject < b.Subject
+	}
+	if a.Predicate != b.Predicate {
+		return a.Predicate < b.Predicate
+	}
+	if a.Object != b.Object {
+		return a.Object < b.Object
+	}
+	return a.Label < b.Label
+}
+func (o ordered) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+
+func sortedQuads(quads []quad.Quad) []quad.Quad {
+	res := append(ordered(nil), quads...)
+	sort.Sort(res)
+	return res
+}
+
+// matching returns the quads of data with the given node in direction d.
+func matching(data []quad.Quad, d quad.Direction, name string) []quad.Quad {
+	var res []quad.Quad
+	for _, q := range data {
+		if q.Get(d) == name {
+			res = append(res, q)
+		}
+	}
+	return sortedQuads(res)
+}
+
+func nodeNames(data []quad.Quad) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, q := range data {
+		for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+			if n := q.Get(d); n != "" && !seen[n] {
+				seen[n] = true
+				res = append(res, n)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// TestLoadOneQuad checks that a single quad can be written and read back.
+func TestLoadOneQuad(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if s := qs.Size(); s != 0 {
+		t.Errorf("Unexpected size of new store, got:%d expect:0", s)
+	}
+	q := quad.Quad{"Something", "points_to", "Something Else", "context"}
+	w := loadGraph(t, qs, []quad.Quad{q})
+	defer w.Close()
+	for _, name := range []string{q.Subject, q.Predicate, q.Object, q.Label} {
+		if got := qs.NameOf(qs.ValueOf(name)); got != name {
+			t.Errorf("Failed to roundtrip %q, got:%q expect:%q", name, got, name)
+		}
+	}
+	if s := qs.Size(); s != 1 {
+		t.Errorf("Unexpected size, got:%d expect:1", s)
+	}
+	got := IteratedQuads(qs, qs.QuadsAllIterator())
+	if !reflect.DeepEqual(got, []quad.Quad{q}) {
+		t.Errorf("Failed to read back quad, got:%v expect:%v", got, q)
+	}
+}
+
+func horizon(qs graph.QuadStore) int64 {
+	h := qs.Horizon()
+	return h.Int()
+}
+
+// TestHorizon checks that the horizon starts at zero, advances with every
+// accepted write, adds and deletes alike, and does not move on a rejected
+// one.
+func TestHorizon(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if h := horizon(qs); h != 0 {
+		t.Errorf("Unexpected horizon of new store, got:%d expect:0", h)
+	}
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	h := horizon(qs)
+	if h != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected horizon after load, got:%d expect:%d", h, len(simpleGraph))
+	}
+
+	err := w.RemoveQuad(simpleGraph[0])
+	if err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	if next := horizon(qs); next <= h {
+		t.Errorf("Horizon did not advance on delete, got:%d previous:%d", next, h)
+	} else {
+		h = next
+	}
+
+	err = w.AddQuad(simpleGraph[1])
+	if err != graph.ErrQuadExists {
+		t.Fatalf("Unexpected error adding duplicate quad, got:%v expect:%v", err, graph.ErrQuadExists)
+	}
+	if next := horizon(qs); next != h {
+		t.Errorf("Horizon moved on rejected write, got:%d expect:%d", next, h)
+	}
+
+	err = w.AddQuad(simpleGraph[0])
+	if err != nil {
+		t.Fatalf("Could not add quad: %v", err)
+	}
+	if next := horizon(qs); next <= h {
+		t.Errorf("Horizon did not advance on add, got:%d previous:%d", next, h)
+	}
+}
+
+// TestDuplicates checks that duplicate adds and missing deletes are rejected
+// with the right errors, and ignored when the writer is asked to.
+func TestDuplicates(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	missing := quad.Quad{"A", "follows", "G", ""}
+
+	if err := w.AddQuad(simpleGraph[0]); err != graph.ErrQuadExists {
+		t.Errorf("Unexpected error adding duplicate quad, got:%v expect:%v", err, graph.ErrQuadExists)
+	}
+	if err := w.RemoveQuad(missing); err != graph.ErrQuadNotExist {
+		t.Errorf("Unexpected error removing missing quad, got:%v expect:%v", err, graph.ErrQuadNotExist)
+	}
+	if s := qs.Size(); s != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected size after rejected writes, got:%d expect:%d", s, len(simpleGraph))
+	}
+
+	iw := newWriter(t, qs, graph.Options{"ignore_duplicate": true, "ignore_missing": true})
+	defer iw.Close()
+	if err := iw.AddQuadSet(simpleGraph[:2]); err != nil {
+		t.Errorf("Unexpected error adding ignored duplicates: %v", err)
+	}
+	if err := iw.RemoveQuad(missing); err != nil {
+		t.Errorf("Unexpected error removing ignored missing quad: %v", err)
+	}
+	if s := qs.Size(); s != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected size after ignored writes, got:%d expect:%d", s, len(simpleGraph))
+	}
+	got := IteratedQuads(qs, qs.QuadsAllIterator())
+	if expect := sortedQuads(simpleGraph); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after ignored writes, got:%v expect:%v", got, expect)
+	}
+}
+
+// TestHasQuad checks that the quads of a store are found, once each, and that
+// missing or removed ones are not.
+func TestHasQuad(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	w.RemoveQuad(simpleGraph[0])
+	for _, test := range []struct {
+		q      quad.Quad
+		expect int64
+	}{
+		{simpleGraph[0], 0},
+		{simpleGraph[1], 1},
+		{quad.Quad{"A", "follows", "G", ""}, 0},
+		{quad.Quad{"Z", "follows", "A", ""}, 0},
+		{quad.Quad{simpleGraph[1].Subject, simpleGraph[1].Predicate, simpleGraph[1].Object, "other"}, 0},
+	} {
+		n, err := graph.QuadCount(qs, test.q)
+		if err != nil {
+			t.Fatalf("Failed to count %v: %v", test.q, err)
+		}
+		if n != test.expect {
+			t.Errorf("Unexpected count of %v, got:%d expect:%d", test.q, n, test.expect)
+		}
+		if ok, _ := graph.HasQuad(qs, test.q); ok != (test.expect > 0) {
+			t.Errorf("Unexpected presence of %v, got:%t expect:%t", test.q, ok, test.expect > 0)
+		}
+	}
+}
+
+// TestDelete checks that deleted quads are gone from every iterator, and can
+// be added again.
+func TestDelete(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	removed := simpleGraph[0]
+	err := w.RemoveQuad(removed)
+	if err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	rest := simpleGraph[1:]
+
+	if s := qs.Size(); s != int64(len(rest)) {
+		t.Errorf("Unexpected size after delete, got:%d expect:%d", s, len(rest))
+	}
+	got := IteratedQuads(qs, qs.QuadsAllIterator())
+	if expect := sortedQuads(rest); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after delete, got:%v expect:%v", got, expect)
+	}
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object} {
+		name := removed.Get(d)
+		got := IteratedQuads(qs, qs.QuadIterator(d, qs.ValueOf(name)))
+		if expect := matching(rest, d, name); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected quads for %v %q after delete, got:%v expect:%v", d, name, got, expect)
+		}
+	}
+	if err := w.RemoveQuad(removed); err != graph.ErrQuadNotExist {
+		t.Errorf("Unexpected error removing deleted quad, got:%v expect:%v", err, graph.ErrQuadNotExist)
+	}
+
+	err = w.AddQuad(removed)
+	if err != nil {
+		t.Fatalf("Could not add deleted quad again: %v", err)
+	}
+	if s := qs.Size(); s != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected size after re-adding, got:%d expect:%d", s, len(simpleGraph))
+	}
+	got = IteratedQuads(qs, qs.QuadIterator(quad.Subject, qs.ValueOf(removed.Subject)))
+	if expect := matching(simpleGraph, quad.Subject, removed.Subject); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after re-adding, got:%v expect:%v", got, expect)
+	}
+}
+
+// TestQuadsAllIterator checks that the all quads iterator yields each quad
+// exactly once and contains them all.
+func TestQuadsAllIterator(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	got := IteratedQuads(qs, it)
+	if expect := sortedQuads(simpleGraph); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads, got:%v expect:%v", got, expect)
+	}
+	if it.Type() != graph.All {
+		t.Errorf("Unexpected iterator type, got:%v expect:%v", it.Type(), graph.All)
+	}
+
+	it = qs.QuadsAllIterator()
+	defer it.Close()
+	all := qs.QuadIterator(quad.Predicate, qs.ValueOf("follows"))
+	defer all.Close()
+	for graph.Next(all) {
+		if !it.Contains(all.Result()) {
+			t.Errorf("All quads iterator does not contain %v", qs.Quad(all.Result()))
+		}
+	}
+}
+
+// TestNodesAllIterator checks that the all nodes iterator yields every node
+// exactly once.
+func TestNodesAllIterator(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	it := qs.NodesAllIterator()
+	defer it.Close()
+	got := IteratedNames(qs, it)
+	if expect := nodeNames(simpleGraph); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected nodes, got:%v expect:%v", got, expect)
+	}
+	for _, name := range []string{"A", "follows", "status_graph"} {
+		if !it.Contains(qs.ValueOf(name)) {
+			t.Errorf("All nodes iterator does not contain %q", name)
+		}
+	}
+}
+
+// TestQuadIterator checks the quads iterated for every node in every
+// direction, and that the iterators contain exactly those quads.
+func TestQuadIterator(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	for _, name := range nodeNames(simpleGraph) {
+		for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+			expect := matching(simpleGraph, d, name)
+			it := qs.QuadIterator(d, qs.ValueOf(name))
+			got := IteratedQuads(qs, it)
+			if len(got) != 0 || len(expect) != 0 {
+				if !reflect.DeepEqual(got, expect) {
+					t.Errorf("Unexpected quads for %v %q, got:%v expect:%v", d, name, got, expect)
+				}
+			}
+			it.Close()
+
+			it = qs.QuadIterator(d, qs.ValueOf(name))
+			all := qs.QuadsAllIterator()
+			for graph.Next(all) {
+				want := all.Result()
+				q := qs.Quad(want)
+				if in := it.Contains(want); in != (q.Get(d) == name) {
+					t.Errorf("Unexpected Contains(%v) for %v %q, got:%t", q, d, name, in)
+				}
+			}
+			all.Close()
+			it.Close()
+		}
+	}
+}
+
+// TestQuadsAllOn checks the quads found for a node in several directions,
+// including one that has the node twice.
+func TestQuadsAllOn(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	loop := quad.Quad{"G", "follows", "G", ""}
+	data := append(SimpleGraph(), loop)
+	w := loadGraph(t, qs, data)
+	defer w.Close()
+	for _, test := range []struct {
+		dirs   []quad.Direction
+		expect []quad.Quad
+	}{
+		{nil, sortedQuads([]quad.Quad{data[5], data[6], data[10], loop})},
+		{[]quad.Direction{quad.Object}, sortedQuads([]quad.Quad{data[5], data[6], loop})},
+		{[]quad.Direction{quad.Subject, quad.Object}, sortedQuads([]quad.Quad{data[5], data[6], data[10], loop})},
+		{[]quad.Direction{quad.Label}, nil},
+	} {
+		it, err := graph.QuadsAllOn(qs, qs.ValueOf("G"), test.dirs...)
+		if err != nil {
+			t.Fatalf("Failed to find quads on %v: %v", test.dirs, err)
+		}
+		got := IteratedQuads(qs, it)
+		if len(got) != 0 || len(test.expect) != 0 {
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("Unexpected quads on %v, got:%v expect:%v", test.dirs, got, test.expect)
+			}
+		}
+		it.Close()
+	}
+}
+
+// TestMergeNodes checks that merged and renamed nodes leave no quads
+// behind.
+func TestMergeNodes(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	n, err := graph.MergeNodes(qs, w, "D", "B")
+	if err != nil || n != 4 {
+		t.Fatalf("Unexpected result merging nodes, got:%d, %v expect:4", n, err)
+	}
+	if _, err := graph.RenameNode(qs, w, "A", "B"); err != graph.ErrNodeExists {
+		t.Errorf("Unexpected error renaming to a node in use: %v", err)
+	}
+	n, err = graph.RenameNode(qs, w, "G", "H")
+	if err != nil || n != 3 {
+		t.Fatalf("Unexpected result renaming a node, got:%d, %v expect:3", n, err)
+	}
+	expect := sortedQuads([]quad.Quad{
+		{"A", "follows", "B", ""},
+		{"C", "follows", "B", ""},
+		{"B", "follows", "F", ""},
+		{"E", "follows", "F", ""},
+		{"B", "status", "cool", "status_graph"},
+		{"B", "follows", "B", ""},
+		{"B", "follows", "H", ""},
+		{"F", "follows", "H", ""},
+		{"H", "status", "cool", "status_graph"},
+	})
+	if got := IteratedQuads(qs, qs.QuadsAllIterator()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after merge, got:%v expect:%v", got, expect)
+	}
+}
+
+// TestRenamePredicate checks that a predicate renamed in batches leaves no
+// quads behind.
+func TestRenamePredicate(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, append(SimpleGraph(), quad.Quad{"A", "likes", "B", ""}))
+	defer w.Close()
+	var progress []int
+	n, err := graph.RenamePredicate(qs, w, "follows", "likes", 3, func(n int) {
+		progress = append(progress, n)
+	})
+	if err != nil || n != 8 {
+		t.Fatalf("Unexpected result renaming a predicate, got:%d, %v expect:8", n, err)
+	}
+	if expect := []int{3, 6, 8}; !reflect.DeepEqual(progress, expect) {
+		t.Errorf("Unexpected progress, got:%v expect:%v", progress, expect)
+	}
+	var expect []quad.Quad
+	for _, q := range simpleGraph {
+		if q.Predicate == "follows" {
+			q.Predicate = "likes"
+		}
+		expect = append(expect, q)
+	}
+	if got := IteratedQuads(qs, qs.QuadsAllIterator()); !reflect.DeepEqual(got, sortedQuads(expect)) {
+		t.Errorf("Unexpected quads after rename, got:%v expect:%v", got, sortedQuads(expect))
+	}
+}
+
+// TestExtractSubgraph checks the quads found within some hops of seeds.
+func TestExtractSubgraph(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	for _, test := range []struct {
+		seeds  []string
+		via    []string
+		depth  int
+		expect []quad.Quad
+	}{
+		{[]string{"E"}, nil, 0, nil},
+		{[]string{"E"}, nil, 1, []quad.Quad{simpleGraph[7]}},
+		{[]string{"E"}, nil, 2, []quad.Quad{simpleGraph[7], simpleGraph[5]}},
+		{[]string{"E", "A"}, nil, 3, []quad.Quad{
+			simpleGraph[7], simpleGraph[0],
+			simpleGraph[5], simpleGraph[4], simpleGraph[8],
+			simpleGraph[10],
+		}},
+		{[]string{"D"}, []string{"status"}, 5, []quad.Quad{simpleGraph[9]}},
+		{[]string{"nothing"}, nil, 2, nil},
+	} {
+		got, err := graph.ExtractSubgraph(qs, test.seeds, test.via, test.depth)
+		if err != nil {
+			t.Fatalf("Unexpected error extracting a subgraph: %v", err)
+		}
+		if !reflect.DeepEqual(sortedQuads(got), sortedQuads(test.expect)) {
+			t.Errorf("Unexpected subgraph of %v via %v in %d hops, got:%v expect:%v", test.seeds, test.via, test.depth, got, test.expect)
+		}
+	}
+}
+
+// TestIteratorReset checks that a reset iterator, and a clone of a fresh
+// iterator, yield the same results again.
+func TestIteratorReset(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	for _, it := range []graph.Iterator{
+		qs.QuadsAllIterator(),
+		qs.QuadIterator(quad.Object, qs.ValueOf("B")),
+	} {
+		c := it.Clone()
+		first := IteratedQuads(qs, it)
+		it.Reset()
+		if again := IteratedQuads(qs, it); !reflect.DeepEqual(again, first) {
+			t.Errorf("Unexpected quads after Reset, got:%v expect:%v", again, first)
+		}
+		if cloned := IteratedQuads(qs, c); !reflect.DeepEqual(cloned, first) {
+			t.Errorf("Unexpected quads from Clone, got:%v expect:%v", cloned, first)
+		}
+		c.Close()
+		it.Close()
+	}
+}
+
+// TestTransaction checks that a transaction is applied completely, or not at
+// all if one of its changes is rejected.
+func TestTransaction(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	added := quad.Quad{"A", "follows", "G", ""}
+
+	tx := graph.NewTransaction()
+	tx.AddQuad(added)
+	tx.RemoveQuad(simpleGraph[0])
+	tx.AddQuad(quad.Quad{"E", "follows", "A", ""})
+	tx.RemoveQuad(quad.Quad{"E", "follows", "A", ""})
+	if n := len(tx.Deltas); n != 2 {
+		t.Errorf("Unexpected number of changes in transaction, got:%d expect:2", n)
+	}
+	err := w.ApplyTransaction(tx)
+	if err != nil {
+		t.Fatalf("Could not apply transaction: %v", err)
+	}
+	expect := sortedQuads(append(SimpleGraph()[1:], added))
+	got := IteratedQuads(qs, qs.QuadsAllIterator())
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after transaction, got:%v expect:%v", got, expect)
+	}
+
+	h := horizon(qs)
+	tx = graph.NewTransaction()
+	tx.AddQuad(quad.Quad{"G", "follows", "A", ""})
+	tx.RemoveQuad(added)
+	tx.AddQuad(simpleGraph[1])
+	err = w.ApplyTransaction(tx)
+	if err != graph.ErrQuadExists {
+		t.Errorf("Unexpected error applying conflicting transaction, got:%v expect:%v", err, graph.ErrQuadExists)
+	}
+	got = IteratedQuads(qs, qs.QuadsAllIterator())
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after failed transaction, got:%v expect:%v", got, expect)
+	}
+	if s := qs.Size(); s != int64(len(expect)) {
+		t.Errorf("Unexpected size after failed transaction, got:%d expect:%d", s, len(expect))
+	}
+	if next := horizon(qs); next != h {
+		t.Errorf("Horizon moved on failed transaction, got:%d expect:%d", next, h)
+	}
+}
+
+// TestDeleteQuadsMatching checks that deleting by pattern removes exactly the
+// matching quads.
+func TestDeleteQuadsMatching(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	if _, err := w.DeleteQuadsMatching(quad.Quad{}); err == nil {
+		t.Errorf("Expected error deleting with an empty pattern")
+	}
+
+	var rest []quad.Quad
+	for _, q := range simpleGraph {
+		if q.Subject != "D" || q.Predicate != "follows" {
+			rest = append(rest, q)
+		}
+	}
+	n, err := w.DeleteQuadsMatching(quad.Quad{Subject: "D", Predicate: "follows"})
+	if err != nil {
+		t.Fatalf("Could not delete matching quads: %v", err)
+	}
+	if n != len(simpleGraph)-len(rest) {
+		t.Errorf("Unexpected number of deleted quads, got:%d expect:%d", n, len(simpleGraph)-len(rest))
+	}
+	got := IteratedQuads(qs, qs.QuadsAllIterator())
+	if expect := sortedQuads(rest); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after deleting matches, got:%v expect:%v", got, expect)
+	}
+
+	n, err = w.DeleteQuadsMatching(quad.Quad{Label: "status_graph"})
+	if err != nil {
+		t.Fatalf("Could not delete matching quads: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Unexpected number of deleted quads by label, got:%d expect:3", n)
+	}
+	n, err = w.DeleteQuadsMatching(quad.Quad{Subject: "nobody"})
+	if err != nil || n != 0 {
+		t.Errorf("Unexpected result deleting unknown subject, got:%d, %v", n, err)
+	}
+	if s := qs.Size(); s != int64(len(rest)-3) {
+		t.Errorf("Unexpected size after deleting matches, got:%d expect:%d", s, len(rest)-3)
+	}
+}
+
+// TestWatch checks that a Watcher reports the deltas matching a
+// subscription, in the order they were applied. Stores that are not
+// Watchers pass trivially.
+func TestWatch(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	wt, ok := qs.(graph.Watcher)
+	if !ok {
+		return
+	}
+	c := wt.Subscribe(quad.Quad{Predicate: "status"})
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	removed := quad.Quad{"D", "status", "cool", "status_graph"}
+	err := w.RemoveQuad(removed)
+	if err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+
+	expect := []quad.Quad{
+		{"B", "status", "cool", "status_graph"},
+		{"D", "status", "cool", "status_graph"},
+		{"G", "status", "cool", "status_graph"},
+		removed,
+	}
+	for i, q := range expect {
+		action := graph.Add
+		if i == len(expect)-1 {
+			action = graph.Delete
+		}
+		select {
+		case d := <-c:
+			if d.Quad != q || d.Action != action {
+				t.Errorf("Unexpected delta %d, got:%v (%v) expect:%v (%v)", i, d.Quad, d.Action, q, action)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for delta %d", i)
+		}
+	}
+
+	wt.Unsubscribe(c)
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Errorf("Unexpected delta after unsubscribing")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Subscription was not closed")
+	}
+}
+
+// TestWatchIgnored checks that a Watcher does not report the deltas of a
+// write that the ignore options skip. Stores that are not Watchers pass
+// trivially.
+func TestWatchIgnored(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	wt, ok := qs.(graph.Watcher)
+	if !ok {
+		return
+	}
+	c := wt.Subscribe(quad.Quad{})
+	defer wt.Unsubscribe(c)
+	next := func() graph.Delta {
+		select {
+		case d := <-c:
+			return d
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for a delta")
+		}
+		return graph.Delta{}
+	}
+	loadGraph(t, qs, simpleGraph).Close()
+	for range simpleGraph {
+		next()
+	}
+
+	w := newWriter(t, qs, graph.Options{"ignore_duplicate": true, "ignore_missing": true})
+	defer w.Close()
+	added := quad.Quad{"A", "follows", "G", ""}
+	tx := graph.NewTransaction()
+	if !graph.IsMultiset(qs) {
+		tx.AddQuad(simpleGraph[0])
+	}
+	tx.RemoveQuad(quad.Quad{"G", "follows", "A", ""})
+	tx.AddQuad(added)
+	if err := w.ApplyTransaction(tx); err != nil {
+		t.Fatalf("Could not apply transaction: %v", err)
+	}
+	// Removing the quad again marks the end of the deltas of the write.
+	if err := w.RemoveQuad(added); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	expect := []graph.Delta{
+		{Quad: added, Action: graph.Add},
+		{Quad: added, Action: graph.Delete},
+	}
+	for i, e := range expect {
+		d := next()
+		if d.Quad != e.Quad || d.Action != e.Action {
+			t.Errorf("Unexpected delta %d, got:%v (%v) expect:%v (%v)", i, d.Quad, d.Action, e.Quad, e.Action)
+		}
+	}
+}
+
+// TestRevision checks that a Reviser reads the quads that were live at an
+// earlier horizon. Stores that are not Revisers pass trivially.
+func TestRevision(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if _, ok := qs.(graph.Reviser); !ok {
+		return
+	}
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	loaded := horizon(qs)
+
+	removed := quad.Quad{"A", "follows", "B", ""}
+	added := quad.Quad{"A", "follows", "G", ""}
+	if err := w.RemoveQuad(removed); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	if err := w.AddQuad(added); err != nil {
+		t.Fatalf("Could not add quad: %v", err)
+	}
+	if err := w.AddQuad(removed); err != nil {
+		t.Fatalf("Could not add quad again: %v", err)
+	}
+
+	for _, test := range []struct {
+		horizon int64
+		expect  []quad.Quad
+	}{
+		{0, nil},
+		{loaded, sortedQuads(simpleGraph)},
+		{loaded + 1, sortedQuads(simpleGraph[1:])},
+		{loaded + 2, sortedQuads(append(SimpleGraph()[1:], added))},
+		{loaded + 3, sortedQuads(append(SimpleGraph(), added))},
+	} {
+		rev, err := graph.AtRevision(qs, test.horizon)
+		if err != nil {
+			t.Fatalf("Could not get revision %d: %v", test.horizon, err)
+		}
+		got := IteratedQuads(rev, rev.QuadsAllIterator())
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected quads at revision %d, got:%v expect:%v", test.horizon, got, test.expect)
+		}
+		got = IteratedQuads(rev, rev.QuadIterator(quad.Subject, rev.ValueOf("A")))
+		expect := matching(test.expect, quad.Subject, "A")
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected quads for A at revision %d, got:%v expect:%v", test.horizon, got, expect)
+		}
+		if h := horizon(rev); h != test.horizon {
+			t.Errorf("Unexpected horizon at revision %d, got:%d", test.horizon, h)
+		}
+		rev.Close()
+	}
+
+	rev, err := graph.AtRevision(qs, loaded)
+	if err != nil {
+		t.Fatalf("Could not get revision %d: %v", loaded, err)
+	}
+	err = rev.ApplyDeltas([]graph.Delta{{ID: graph.NewSequentialKey(loaded + 4), Quad: added, Action: graph.Delete}}, graph.IgnoreOpts{})
+	if err != graph.ErrRevisionReadOnly {
+		t.Errorf("Unexpected error writing to a revision, got:%v expect:%v", err, graph.ErrRevisionReadOnly)
+	}
+	if _, err := graph.AtRevision(qs, loaded+4); err != graph.ErrUnknownRevision {
+		t.Errorf("Unexpected error for a future revision, got:%v expect:%v", err, graph.ErrUnknownRevision)
+	}
+}
+
+// TestSnapshot checks that an iterator over a snapshot does not see the
+// quads written after it was taken, even while it is being iterated. Stores
+// that are not Revisers pass trivially.
+func TestSnapshot(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if _, ok := qs.(graph.Reviser); !ok {
+		return
+	}
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+
+	snap := graph.Snapshot(qs)
+	defer snap.Close()
+	it := snap.QuadsAllIterator()
+	defer it.Close()
+	if !graph.Next(it) {
+		t.Fatalf("Snapshot is empty")
+	}
+	got := []quad.Quad{snap.Quad(it.Result())}
+	if err := w.AddQuad(quad.Quad{"A", "follows", "G", ""}); err != nil {
+		t.Fatalf("Could not add quad: %v", err)
+	}
+	if err := w.RemoveQuad(simpleGraph[len(simpleGraph)-1]); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	for graph.Next(it) {
+		got = append(got, snap.Quad(it.Result()))
+	}
+	if got, expect := sortedQuads(got), sortedQuads(simpleGraph); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads in snapshot, got:%v expect:%v", got, expect)
+	}
+}
+
+// TestProvenance checks that a ProvenanceKeeper returns the provenance quads
+// were added with, for as long as they are live. Stores that are not
+// ProvenanceKeepers pass trivially.
+func TestProvenance(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if _, ok := qs.(graph.ProvenanceKeeper); !ok {
+		return
+	}
+	w := loadGraph(t, qs, simpleGraph[:2])
+	defer w.Close()
+	added := simpleGraph[2:4]
+	before := time.Now().Add(-time.Second)
+	p := graph.Provenance{Author: "alice", Source: "graph.nq"}
+	if err := w.(graph.ProvenanceWriter).AddQuadSetWithProvenance(added, p); err != nil {
+		t.Fatalf("Could not add quads with provenance: %v", err)
+	}
+
+	provenanceOf := func(q quad.Quad) (graph.Provenance, bool) {
+		it := qs.QuadIterator(quad.Subject, qs.ValueOf(q.Subject))
+		defer it.Close()
+		for graph.Next(it) {
+			if qs.Quad(it.Result()) == q {
+				return graph.ProvenanceOf(qs, it.Result())
+			}
+		}
+		return graph.Provenance{}, false
+	}
+	for _, q := range added {
+		got, ok := provenanceOf(q)
+		if !ok || got.Author != p.Author || got.Source != p.Source || got.Created.Before(before) {
+			t.Errorf("Unexpected provenance of %v, got:%+v, %t expect:%+v", q, got, ok, p)
+		}
+	}
+	if got, ok := provenanceOf(simpleGraph[0]); ok {
+		t.Errorf("Unexpected provenance of %v, got:%+v", simpleGraph[0], got)
+	}
+	if err := w.RemoveQuad(added[0]); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	if err := w.AddQuad(added[0]); err != nil {
+		t.Fatalf("Could not add quad again: %v", err)
+	}
+	if got, ok := provenanceOf(added[0]); ok {
+		t.Errorf("Unexpected provenance of re-added %v, got:%+v", added[0], got)
+	}
+}
+
+// TestPurge checks that a Purger permanently removes the quads deleted
+// before the given time, and no others. Stores that are not Purgers pass
+// trivially.
+func TestPurge(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if _, ok := qs.(graph.Purger); !ok {
+		return
+	}
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	removed, readded := simpleGraph[0], simpleGraph[1]
+	for _, q := range []quad.Quad{removed, readded} {
+		if err := w.RemoveQuad(q); err != nil {
+			t.Fatalf("Could not remove quad: %v", err)
+		}
+	}
+	if err := w.AddQuad(readded); err != nil {
+		t.Fatalf("Could not add quad again: %v", err)
+	}
+
+	if n, err := graph.Purge(qs, time.Hour); err != nil || n != 0 {
+		t.Errorf("Unexpected purge within retention, got:%d, %v expect:0", n, err)
+	}
+	if n, err := graph.Purge(qs, -time.Hour); err != nil || n != 1 {
+		t.Errorf("Unexpected purge, got:%d, %v expect:1", n, err)
+	}
+	expect := sortedQuads(simpleGraph[1:])
+	if got := IteratedQuads(qs, qs.QuadsAllIterator()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after purge, got:%v expect:%v", got, expect)
+	}
+	got := IteratedQuads(qs, qs.QuadIterator(quad.Subject, qs.ValueOf("A")))
+	if expect := matching(expect, quad.Subject, "A"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads for A after purge, got:%v expect:%v", got, expect)
+	}
+	if n, err := graph.Purge(qs, -time.Hour); err != nil || n != 0 {
+		t.Errorf("Unexpected second purge, got:%d, %v expect:0", n, err)
+	}
+
+	if err := w.AddQuad(removed); err != nil {
+		t.Fatalf("Could not add purged quad again: %v", err)
+	}
+	expect = sortedQuads(simpleGraph)
+	if got := IteratedQuads(qs, qs.QuadsAllIterator()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after adding purged quad, got:%v expect:%v", got, expect)
+	}
+}
+
+// TestCollectGarbage checks that a GarbageCollector removes the nodes that
+// only purged quads referenced. Stores that are not both Purgers and
+// GarbageCollectors pass trivially.
+func TestCollectGarbage(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if _, ok := qs.(graph.GarbageCollector); !ok {
+		return
+	}
+	if _, ok := qs.(graph.Purger); !ok {
+		return
+	}
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	kept, removed := simpleGraph[:7], simpleGraph[7:]
+	for _, q := range removed {
+		if err := w.RemoveQuad(q); err != nil {
+			t.Fatalf("Could not remove quad: %v", err)
+		}
+	}
+
+	if stats, err := graph.CollectGarbage(qs); err != nil || stats.Nodes != 0 {
+		t.Errorf("Unexpected collection of nodes of deleted quads, got:%+v, %v expect:0 nodes", stats, err)
+	}
+	if _, err := graph.Purge(qs, -time.Hour); err != nil {
+		t.Fatalf("Could not purge: %v", err)
+	}
+	stats, err := graph.CollectGarbage(qs)
+	if err != nil || stats.Nodes != 4 || stats.Bytes <= 0 {
+		t.Errorf("Unexpected collection, got:%+v, %v expect:4 nodes", stats, err)
+	}
+	if got, expect := IteratedNames(qs, qs.NodesAllIterator()), nodeNames(kept); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected nodes after collection, got:%v expect:%v", got, expect)
+	}
+	if stats, err := graph.CollectGarbage(qs); err != nil || stats.Nodes != 0 {
+		t.Errorf("Unexpected second collection, got:%+v, %v expect:0 nodes", stats, err)
+	}
+
+	if err := w.AddQuadSet(removed); err != nil {
+		t.Fatalf("Could not add collected nodes again: %v", err)
+	}
+	if got, expect := IteratedQuads(qs, qs.QuadsAllIterator()), sortedQuads(simpleGraph); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after adding collected nodes, got:%v expect:%v", got, expect)
+	}
+	if got, expect := IteratedNames(qs, qs.NodesAllIterator()), nodeNames(simpleGraph); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected nodes after adding collected nodes, got:%v expect:%v", got, expect)
+	}
+}
+
+// TestCompact checks that a Compactor purges the deleted quads and removes
+// the nodes only they referenced. Stores that are not Compactors pass
+// trivially.
+func TestCompact(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	if _, ok := qs.(graph.Compactor); !ok {
+		return
+	}
+	w := loadGraph(t, qs, simpleGraph)
+	defer w.Close()
+	kept, removed := simpleGraph[:7], simpleGraph[7:]
+	for _, q := range removed {
+		if err := w.RemoveQuad(q); err != nil {
+			t.Fatalf("Could not remove quad: %v", err)
+		}
+	}
+
+	stats, err := graph.Compact(qs, time.Hour)
+	if err != nil || stats.Quads != 0 || stats.Nodes != 0 {
+		t.Errorf("Unexpected compaction within retention, got:%+v, %v expect:0 quads", stats, err)
+	}
+	stats, err = graph.Compact(qs, -time.Hour)
+	if err != nil || stats.Quads != len(removed) || stats.Nodes != 4 || stats.Values != 0 {
+		t.Errorf("Unexpected compaction, got:%+v, %v expect:%d quads, 4 nodes", stats, err, len(removed))
+	}
+	if got, expect := IteratedQuads(qs, qs.QuadsAllIterator()), sortedQuads(kept); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after compaction, got:%v expect:%v", got, expect)
+	}
+	if got, expect := IteratedNames(qs, qs.NodesAllIterator()), nodeNames(kept); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected nodes after compaction, got:%v expect:%v", got, expect)
+	}
+	if stats, err := graph.Compact(qs, -time.Hour); err != nil || stats.Quads != 0 || stats.Nodes != 0 {
+		t.Errorf("Unexpected second compaction, got:%+v, %v expect:0 quads", stats, err)
+	}
+
+	if err := w.AddQuadSet(removed); err != nil {
+		t.Fatalf("Could not add compacted quads again: %v", err)
+	}
+	if got, expect := IteratedQuads(qs, qs.QuadsAllIterator()), sortedQuads(simpleGraph); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after adding compacted quads, got:%v expect:%v", got, expect)
+	}
+}
+
+// TestNear checks that a GeoIndexer finds the points near a location, as
+// they are added and removed. Stores that are not GeoIndexers pass
+// trivially.
+func TestNear(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	g, ok := qs.(graph.GeoIndexer)
+	if !ok {
+		return
+	}
+	var (
+		eiffel   = quad.GeoPoint{Lat: 48.8584, Lon: 2.2945}
+		louvre   = quad.GeoPoint{Lat: 48.8606, Lon: 2.3376}
+		colosseo = quad.GeoPoint{Lat: 41.8902, Lon: 12.4922}
+	)
+	data := []quad.Quad{
+		{"eiffel", "location", eiffel.String(), ""},
+		{"louvre", "location", louvre.String(), ""},
+		{"louvre", "entrance", louvre.String(), ""},
+		{"colosseo", "location", colosseo.String(), ""},
+	}
+	w := loadGraph(t, qs, data)
+	defer w.Close()
+
+	for _, test := range []struct {
+		radius float64
+		expect []string
+	}{
+		{radius: 100, expect: []string{eiffel.String()}},
+		{radius: 5000, expect: []string{eiffel.String(), louvre.String()}},
+		{radius: 2000e3, expect: []string{eiffel.String(), louvre.String(), colosseo.String()}},
+	} {
+		got := IteratedNames(qs, g.NearIterator(eiffel, test.radius))
+		sort.Strings(test.expect)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected points within %vm, got:%v expect:%v", test.radius, got, test.expect)
+		}
+	}
+
+	if err := w.RemoveQuad(data[1]); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	if got := IteratedNames(qs, g.NearIterator(louvre, 100)); len(got) != 1 {
+		t.Errorf("Unexpected points after removing one of two quads, got:%v", got)
+	}
+	if err := w.RemoveQuad(data[2]); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	if got := IteratedNames(qs, g.NearIterator(louvre, 100)); len(got) != 0 {
+		t.Errorf("Unexpected points after removing both quads, got:%v", got)
+	}
+}
+
+// TestValueRange checks that a ValueRangeIndexer finds the nodes holding
+// values within a range, and forgets those no quad has as its object any more.
+func TestValueRange(t *testing.T, gen DatabaseFunc) {
+	qs, closer := gen(t)
+	defer closer()
+
+	ri, ok := qs.(graph.ValueRangeIndexer)
+	if !ok {
+		return
+	}
+	var (
+		small   = `"-3"^^` + quad.XSDInteger
+		medium  = `"2.5"^^` + quad.XSDDouble
+		large   = "1000"
+		founded = `"1998-09-04"^^` + quad.XSDDate
+		listed  = `"2004-08-19T09:30:00-04:00"^^` + quad.XSDDateTime
+	)
+	data := []quad.Quad{
+		{"a", "size", small, ""},
+		{"b", "size", medium, ""},
+		{"c", "size", large, ""},
+		{"d", "size", medium, ""},
+		{"google", "founded", founded, ""},
+		{"google", "listed", listed, ""},
+		{"google", "name", "Google", ""},
+	}
+	w := loadGraph(t, qs, data)
+	defer w.Close()
+
+	numbers := func(from, to float64) quad.ValueRange {
+		return quad.ValueRange{Kind: quad.NumberValue, From: quad.NumberKey(from), To: quad.NumberKey(to)}
+	}
+	times := func(from, to time.Time) quad.ValueRange {
+		return quad.ValueRange{Kind: quad.TimeValue, From: quad.TimeKey(from), To: quad.TimeKey(to)}
+	}
+	for _, test := range []struct {
+		r      quad.ValueRange
+		expect []string
+	}{
+		{r: numbers(-10, 10), expect: []string{small, medium}},
+		{r: numbers(2.5, 1000), expect: []string{medium, large}},
+		{r: numbers(1001, 2000), expect: nil},
+		{r: times(time.Date(1998, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)), expect: []string{founded}},
+		{r: times(time.Date(2004, 8, 19, 13, 30, 0, 0, time.UTC), time.Date(2004, 8, 19, 13, 30, 0, 0, time.UTC)), expect: []string{listed}},
+	} {
+		got := IteratedNames(qs, ri.ValueRangeIterator(test.r))
+		sort.Strings(test.expect)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected values in %v, got:%v expect:%v", test.r, got, test.expect)
+		}
+	}
+
+	if err := w.RemoveQuad(data[1]); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	if got := IteratedNames(qs, ri.ValueRangeIterator(numbers(2, 3))); len(got) != 1 {
+		t.Errorf("Unexpected values after removing one of two quads, got:%v", got)
+	}
+	if err := w.RemoveQuad(data[3]); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	if got := IteratedNames(qs, ri.ValueRangeIterator(numbers(2, 3))); len(got) != 0 {
+		t.Errorf("Unexpected values after removing both quads, got:%v", got)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Alias iterator, which treats groups of values as one.
+
+import (
+	"github.com/google/cayley/graph"
+)
+
+// Aliases maps each value to the other values it stands for. The relation
+// must be symmetric: if b is an alias of a, a must be an alias of b.
+type Aliases map[interface{}][]graph.Value
+
+// Set sets the aliases of v.
+func (a Aliases) Set(v graph.Value, aliases []graph.Value) {
+	a[valueKey(v)] = aliases
+}
+
+// Of returns the aliases of v.
+func (a Aliases) Of(v graph.Value) []graph.Value {
+	return a[valueKey(v)]
+}
+
+func valueKey(v graph.Value) interface{} {
+	if k, ok := v.(Keyer); ok {
+		return k.Key()
+	}
+	return v
+}
+
+// Alias iterator yields the values of its subiterator, each followed by its
+// aliases, and contains a value if its subiterator contains the value or
+// any of its aliases.
+type Alias struct {
+	uid      uint64
+	tags     graph.Tagger
+	subIt    graph.Iterator
+	aliases  Aliases
+	pending  []graph.Value
+	result   graph.Value
+	runstats graph.IteratorStats
+	err      error
+}
+
+func NewAlias(subIt graph.Iterator, aliases Aliases) *Alias {
+	return &Alias{
+		uid:     NextUID(),
+		subIt:   subIt,
+		aliases: aliases,
+	}
+}
+
+func (it *Alias) UID() uint64 {
+	return it.uid
+}
+
+// Reset resets the internal iterators and the iterator itself.
+func (it *Alias) Reset() {
+	it.result = nil
+	it.pending = nil
+	it.subIt.Reset()
+}
+
+func (it *Alias) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults tags the current result, and leaves the tags of the
+// subiterator's value it was reached from.
+func (it *Alias) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *Alias) Clone() graph.Iterator {
+	alias := NewAlias(it.subIt.Clone(), it.aliases)
+	alias.tags.CopyFrom(it)
+	return alias
+}
+
+func (it *Alias) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Alias) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.subIt = f(it.subIt)
+}
+
+// Next yields the aliases of the last value of the subiterator before
+// advancing it.
+func (it *Alias) Next() bool {
+	graph.NextLogIn(it)
+	it.runstats.Next += 1
+
+	if len(it.pending) > 0 {
+		it.result = it.pending[0]
+		it.pending = it.pending[1:]
+		return graph.NextLogOut(it, it.result, true)
+	}
+	if !graph.Next(it.subIt) {
+		it.err = it.subIt.Err()
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.subIt.Result()
+	it.pending = it.aliases.Of(it.result)
+	return graph.NextLogOut(it, it.result, true)
+}
+
+func (it *Alias) Err() error {
+	return it.err
+}
+
+func (it *Alias) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks the value, then each of its aliases, against the
+// subiterator.
+func (it *Alias) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.runstats.Contains += 1
+	it.result = val
+	if it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, true)
+	}
+	for _, a := range it.aliases.Of(val) {
+		if it.subIt.Contains(a) {
+			return graph.ContainsLogOut(it, val, true)
+		}
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+func (it *Alias) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+func (it *Alias) Close() error {
+	it.pending = nil
+	return it.subIt.Close()
+}
+
+func (it *Alias) Type() graph.Type { return graph.Alias }
+
+func (it *Alias) Optimize() (graph.Iterator, bool) {
+	newIt, optimized := it.subIt.Optimize()
+	if optimized {
+		it.subIt = newIt
+	}
+	return it, false
+}
+
+const aliasFactor = 2
+
+func (it *Alias) Stats() graph.IteratorStats {
+	subStats := it.subIt.Stats()
+	return graph.IteratorStats{
+		NextCost:     subStats.NextCost,
+		ContainsCost: subStats.ContainsCost * aliasFactor,
+		Size:         subStats.Size * aliasFactor,
+		Next:         it.runstats.Next,
+		Contains:     it.runstats.Contains,
+		ContainsNext: it.runstats.ContainsNext,
+	}
+}
+
+func (it *Alias) Size() (int64, bool) {
+	return it.Stats().Size, false
+}
+
+func (it *Alias) Describe() graph.Description {
+	return graph.Description{
+		UID:       it.UID(),
+		Type:      it.Type(),
+		Tags:      it.tags.Tags(),
+		Iterators: []graph.Description{it.subIt.Describe()},
+	}
+}
+
+var _ graph.Nexter = &Alias{}
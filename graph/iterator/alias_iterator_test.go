@@ -0,0 +1,51 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestAliasIteratorBasics(t *testing.T) {
+	fixed := NewFixed(Identity)
+	fixed.Add(1)
+	fixed.Add(4)
+
+	aliases := make(Aliases)
+	aliases.Set(1, []graph.Value{2, 3})
+	aliases.Set(2, []graph.Value{1, 3})
+	aliases.Set(3, []graph.Value{1, 2})
+	a := NewAlias(fixed, aliases)
+
+	expect := []int{1, 2, 3, 4}
+	for i := 0; i < 2; i++ {
+		if got := iterated(a); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Failed to iterate Alias correctly on repeat %d: got:%v expected:%v", i, got, expect)
+		}
+		a.Reset()
+	}
+
+	for _, v := range []int{1, 2, 3, 4} {
+		if !a.Contains(v) {
+			t.Errorf("Failed to find %d in the alias iterator.", v)
+		}
+	}
+	if a.Contains(5) {
+		t.Errorf("Found an unexpected value in the alias iterator.")
+	}
+}
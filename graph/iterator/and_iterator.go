@@ -102,6 +102,16 @@ func (it *And) SubIterators() []graph.Iterator {
 	return iters
 }
 
+func (it *And) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.primaryIt = f(it.primaryIt)
+	for i, sub := range it.internalIterators {
+		it.internalIterators[i] = f(sub)
+	}
+	for i, sub := range it.checkList {
+		it.checkList[i] = f(sub)
+	}
+}
+
 func (it *And) Describe() graph.Description {
 	subIts := make([]graph.Description, len(it.internalIterators))
 	for i, sub := range it.internalIterators {
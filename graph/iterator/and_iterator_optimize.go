@@ -17,8 +17,7 @@ package iterator
 import (
 	"sort"
 
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 )
 
@@ -89,7 +88,7 @@ func (it *And) Optimize() (graph.Iterator, bool) {
 	newAnd.tags.CopyFrom(it)
 
 	newAnd.optimizeContains()
-	glog.V(3).Infoln(it.UID(), "became", newAnd.UID())
+	clog.V(3).Infoln(it.UID(), "became", newAnd.UID())
 
 	// And close ourselves but not our subiterators -- some may still be alive in
 	// the new And (they were unchanged upon calling Optimize() on them, at the
@@ -179,16 +178,16 @@ func (it *And) optimizeOrder(its []graph.Iterator) []graph.Iterator {
 			cost += stats.ContainsCost * (1 + (rootStats.Size / (stats.Size + 1)))
 		}
 		cost *= rootStats.Size
-		if glog.V(3) {
-			glog.V(3).Infoln("And:", it.UID(), "Root:", root.UID(), "Total Cost:", cost, "Best:", bestCost)
+		if clog.V(3) {
+			clog.V(3).Infoln("And:", it.UID(), "Root:", root.UID(), "Total Cost:", cost, "Best:", bestCost)
 		}
 		if cost < bestCost {
 			best = root
 			bestCost = cost
 		}
 	}
-	if glog.V(3) {
-		glog.V(3).Infoln("And:", it.UID(), "Choosing:", best.UID(), "Best:", bestCost)
+	if clog.V(3) {
+		clog.V(3).Infoln("And:", it.UID(), "Choosing:", best.UID(), "Best:", bestCost)
 	}
 
 	// TODO(barakmich): Optimization of order need not stop here. Picking a smart
@@ -247,7 +246,8 @@ func (it *And) getSubTags() map[string]struct{} {
 }
 
 // moveTagsTo() gets the tags for all of the src's subiterators and the
-// src itself, and moves them to dst.
+// src itself, and moves them to dst. The fixed tags go too, so that every
+// intersected branch still contributes its tags to the results.
 func moveTagsTo(dst graph.Iterator, src *And) {
 	tags := src.getSubTags()
 	for _, tag := range dst.Tagger().Tags() {
@@ -259,6 +259,14 @@ func moveTagsTo(dst graph.Iterator, src *And) {
 	for k := range tags {
 		dt.Add(k)
 	}
+	for _, sub := range append(src.SubIterators(), src) {
+		if sub == dst {
+			continue
+		}
+		for k, v := range sub.Tagger().Fixed() {
+			dt.AddFixed(k, v)
+		}
+	}
 }
 
 // optimizeSubIterators(l) takes a list of iterators and calls Optimize() on all
@@ -37,6 +37,7 @@ func TestIteratorPromotion(t *testing.T) {
 	a.AddSubIterator(all)
 	a.AddSubIterator(fixed)
 	all.Tagger().Add("a")
+	all.Tagger().AddFixed("d", 1)
 	fixed.Tagger().Add("b")
 	a.Tagger().Add("c")
 	newIt, changed := a.Optimize()
@@ -46,6 +47,9 @@ func TestIteratorPromotion(t *testing.T) {
 	if newIt.Type() != graph.Fixed {
 		t.Error("Expected fixed iterator")
 	}
+	if got := newIt.Tagger().Fixed(); !reflect.DeepEqual(got, map[string]graph.Value{"d": 1}) {
+		t.Errorf("Fixed tags don't match, got:%v", got)
+	}
 	tagsExpected := []string{"a", "b", "c"}
 	tags := newIt.Tagger().Tags()
 	sort.Strings(tags)
@@ -0,0 +1,105 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the guards that bound the shape of queries, so that pathological
+// ones fail with an explanation instead of consuming the server.
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cayley/graph"
+)
+
+// Guards are the limits of the shape of a query. A limit of zero is
+// unlimited.
+type Guards struct {
+	// MaxDepth is the deepest the iterator tree of a query may be.
+	MaxDepth int
+
+	// MaxExpansion is the most steps a query may expand to as it is built,
+	// counting the steps of a path or morphism it follows once for each
+	// time they are followed, so that morphisms following each other in
+	// turn cannot grow the query exponentially.
+	MaxExpansion int
+
+	// MaxIntermediate is the most values a query may hold before its
+	// results, such as those an iterator sorts or that Gremlin collects
+	// into an array.
+	MaxIntermediate int
+}
+
+var guards struct {
+	sync.Mutex
+	g Guards
+}
+
+// SetGuards sets the guards of the queries started from then on.
+func SetGuards(g Guards) {
+	guards.Lock()
+	guards.g = g
+	guards.Unlock()
+}
+
+// CurrentGuards returns the guards set by SetGuards.
+func CurrentGuards() Guards {
+	guards.Lock()
+	defer guards.Unlock()
+	return guards.g
+}
+
+// GuardError is returned for a query that exceeds one of its guards.
+type GuardError struct {
+	// Guard is the name of the guard exceeded: "depth", "expansion" or
+	// "intermediate".
+	Guard string
+	Limit int
+}
+
+func (e *GuardError) Error() string {
+	switch e.Guard {
+	case "depth":
+		return fmt.Sprintf("query is nested more than %d iterators deep", e.Limit)
+	case "expansion":
+		return fmt.Sprintf("query expands to more than %d steps, such as by following morphisms that follow each other", e.Limit)
+	case "intermediate":
+		return fmt.Sprintf("query holds more than %d intermediate values", e.Limit)
+	}
+	return fmt.Sprintf("query exceeds its %s limit of %d", e.Guard, e.Limit)
+}
+
+// CheckDepth returns a *GuardError if the iterator tree of it is deeper than
+// the MaxDepth guard.
+func CheckDepth(it graph.Iterator) error {
+	max := CurrentGuards().MaxDepth
+	if max <= 0 || depthWithin(it, max) {
+		return nil
+	}
+	return &GuardError{Guard: "depth", Limit: max}
+}
+
+// depthWithin returns whether the tree of it is at most max deep.
+func depthWithin(it graph.Iterator, max int) bool {
+	if max <= 0 {
+		return false
+	}
+	for _, sub := range it.SubIterators() {
+		if !depthWithin(sub, max-1) {
+			return false
+		}
+	}
+	return true
+}
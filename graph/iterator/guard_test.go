@@ -0,0 +1,56 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestCheckDepth(t *testing.T) {
+	defer SetGuards(Guards{})
+
+	and := NewAnd(nil)
+	and.AddSubIterator(NewOr())
+	and.AddSubIterator(NewFixed(Identity))
+
+	SetGuards(Guards{MaxDepth: 2})
+	if err := CheckDepth(and); err != nil {
+		t.Errorf("Unexpected error for a tree 2 deep, got:%v", err)
+	}
+	SetGuards(Guards{MaxDepth: 1})
+	err, ok := CheckDepth(and).(*GuardError)
+	if !ok || err.Guard != "depth" || err.Limit != 1 {
+		t.Errorf("Unexpected error for a tree over its depth, got:%v", err)
+	}
+}
+
+func TestSortIntermediate(t *testing.T) {
+	defer SetGuards(Guards{})
+	SetGuards(Guards{MaxIntermediate: 2})
+
+	fixed := NewFixed(Identity)
+	for _, v := range []int{3, 1, 2} {
+		fixed.Add(v)
+	}
+	it := NewSort(fixed, func(v graph.Value) string { return "" })
+	if graph.Next(it) {
+		t.Errorf("Unexpected result of a sort over its intermediate values")
+	}
+	if err, ok := it.Err().(*GuardError); !ok || err.Guard != "intermediate" {
+		t.Errorf("Unexpected error, got:%v expect:*GuardError", it.Err())
+	}
+}
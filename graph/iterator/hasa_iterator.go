@@ -34,8 +34,7 @@ package iterator
 // Alternatively, can be seen as the dual of the LinksTo iterator.
 
 import (
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/quad"
 )
@@ -75,6 +74,10 @@ func (it *HasA) SubIterators() []graph.Iterator {
 	return []graph.Iterator{it.primaryIt}
 }
 
+func (it *HasA) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.primaryIt = f(it.primaryIt)
+}
+
 func (it *HasA) Reset() {
 	it.primaryIt.Reset()
 	if it.resultIt != nil {
@@ -105,6 +108,15 @@ func (it *HasA) Optimize() (graph.Iterator, bool) {
 			return it.primaryIt, true
 		}
 	}
+	// Ask the graph.QuadStore if we can be replaced. Backends that can
+	// resolve the nodes of a set of quads themselves get the chance here.
+	if it.qs != nil {
+		newReplacement, hasOne := it.qs.OptimizeIterator(it)
+		if hasOne {
+			it.Close()
+			return newReplacement, true
+		}
+	}
 	return it, false
 }
 
@@ -138,8 +150,8 @@ func (it *HasA) Describe() graph.Description {
 func (it *HasA) Contains(val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
 	it.runstats.Contains += 1
-	if glog.V(4) {
-		glog.V(4).Infoln("Id is", it.qs.NameOf(val))
+	if clog.V(4) {
+		clog.V(4).Infoln("Id is", it.qs.NameOf(val))
 	}
 	// TODO(barakmich): Optimize this
 	if it.resultIt != nil {
@@ -160,8 +172,8 @@ func (it *HasA) NextContains() bool {
 	for graph.Next(it.resultIt) {
 		it.runstats.ContainsNext += 1
 		link := it.resultIt.Result()
-		if glog.V(4) {
-			glog.V(4).Infoln("Quad is", it.qs.Quad(link))
+		if clog.V(4) {
+			clog.V(4).Infoln("Quad is", it.qs.Quad(link))
 		}
 		if it.primaryIt.Contains(link) {
 			it.result = it.qs.QuadDirection(link, it.dir)
@@ -180,7 +192,7 @@ func (it *HasA) NextPath() bool {
 	//
 	// The upshot is, the end of NextPath() bubbles up from the bottom of the
 	// iterator tree up, and we need to respect that.
-	glog.V(4).Infoln("HASA", it.UID(), "NextPath")
+	clog.V(4).Infoln("HASA", it.UID(), "NextPath")
 	if it.primaryIt.NextPath() {
 		return true
 	}
@@ -193,7 +205,7 @@ func (it *HasA) NextPath() bool {
 	if it.err != nil {
 		return false
 	}
-	glog.V(4).Infoln("HASA", it.UID(), "NextPath Returns", result, "")
+	clog.V(4).Infoln("HASA", it.UID(), "NextPath Returns", result, "")
 	return result
 }
 
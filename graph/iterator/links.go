@@ -0,0 +1,60 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines TagLinks, which tags the quads a result of an iterator tree was
+// reached through, so that they can be read back with its tags.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+// LinkTagPrefix begins the names of the tags added by TagLinks.
+const LinkTagPrefix = "$link"
+
+// TagLinks tags every LinksTo iterator in the tree rooted at it, so that the
+// tags of each result hold the quads it was reached through. It must be
+// called before the tree is optimized, as optimizing may replace the LinksTo
+// iterators, passing their tags on.
+func TagLinks(it graph.Iterator) {
+	if it.Type() == graph.LinksTo {
+		it.Tagger().Add(fmt.Sprintf("%s%d", LinkTagPrefix, it.UID()))
+	}
+	if o, ok := it.(*Optional); ok {
+		// Its subiterator is hidden from the query shape, but not from
+		// its results.
+		TagLinks(o.subIt)
+		return
+	}
+	for _, sub := range it.SubIterators() {
+		TagLinks(sub)
+	}
+}
+
+// SplitLinks removes the tags added by TagLinks from tags, and returns the
+// quads they held.
+func SplitLinks(tags map[string]graph.Value) []graph.Value {
+	var links []graph.Value
+	for tag, v := range tags {
+		if strings.HasPrefix(tag, LinkTagPrefix) {
+			links = append(links, v)
+			delete(tags, tag)
+		}
+	}
+	return links
+}
@@ -128,6 +128,10 @@ func (it *LinksTo) SubIterators() []graph.Iterator {
 	return []graph.Iterator{it.primaryIt}
 }
 
+func (it *LinksTo) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.primaryIt = f(it.primaryIt)
+}
+
 // Optimize the LinksTo, by replacing it if it can be.
 func (it *LinksTo) Optimize() (graph.Iterator, bool) {
 	newPrimary, changed := it.primaryIt.Optimize()
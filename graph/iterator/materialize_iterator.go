@@ -17,9 +17,9 @@ package iterator
 // A simple iterator that, when first called Contains() or Next() upon, materializes the whole subiterator, stores it locally, and responds. Essentially a cache.
 
 import (
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/memory"
 )
 
 var abortMaterializeAt = 1000
@@ -50,6 +50,8 @@ type Materialize struct {
 	aborted     bool
 	runstats    graph.IteratorStats
 	err         error
+	quota       *memory.Quota
+	held        int64
 }
 
 func NewMaterialize(sub graph.Iterator) *Materialize {
@@ -71,12 +73,35 @@ func (it *Materialize) Reset() {
 }
 
 func (it *Materialize) Close() error {
+	it.release()
 	it.containsMap = nil
 	it.values = nil
 	it.hasRun = false
 	return it.subIt.Close()
 }
 
+// SetQuota accounts for the materialized results against q.
+func (it *Materialize) SetQuota(q *memory.Quota) {
+	it.quota = q
+}
+
+// reserve accounts for a result with tags, or sets the error of the iterator
+// if the quota is exceeded.
+func (it *Materialize) reserve(tags map[string]graph.Value) bool {
+	n := memory.ResultSize(len(tags))
+	if err := it.quota.Reserve(n); err != nil {
+		it.err = err
+		return false
+	}
+	it.held += n
+	return true
+}
+
+func (it *Materialize) release() {
+	it.quota.Release(it.held)
+	it.held = 0
+}
+
 func (it *Materialize) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -106,6 +131,7 @@ func (it *Materialize) TagResults(dst map[string]graph.Value) {
 func (it *Materialize) Clone() graph.Iterator {
 	out := NewMaterialize(it.subIt.Clone())
 	out.tags.CopyFrom(it)
+	out.quota = it.quota
 	if it.hasRun {
 		out.hasRun = true
 		out.aborted = it.aborted
@@ -151,6 +177,10 @@ func (it *Materialize) SubIterators() []graph.Iterator {
 	return []graph.Iterator{it.subIt}
 }
 
+func (it *Materialize) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.subIt = f(it.subIt)
+}
+
 func (it *Materialize) Optimize() (graph.Iterator, bool) {
 	newSub, changed := it.subIt.Optimize()
 	if changed {
@@ -166,10 +196,10 @@ func (it *Materialize) Optimize() (graph.Iterator, bool) {
 // Otherwise, guess based on the size of the subiterator.
 func (it *Materialize) Size() (int64, bool) {
 	if it.hasRun && !it.aborted {
-		glog.V(2).Infoln("returning size", it.actualSize)
+		clog.V(2).Infoln("returning size", it.actualSize)
 		return it.actualSize, true
 	}
-	glog.V(2).Infoln("bailing size", it.actualSize)
+	clog.V(2).Infoln("bailing size", it.actualSize)
 	return it.subIt.Size()
 }
 
@@ -261,7 +291,8 @@ func (it *Materialize) NextPath() bool {
 
 func (it *Materialize) materializeSet() {
 	i := 0
-	for graph.Next(it.subIt) {
+	defer func() { it.hasRun = true }()
+	for it.err == nil && graph.Next(it.subIt) {
 		i++
 		if i > abortMaterializeAt {
 			it.aborted = true
@@ -279,6 +310,9 @@ func (it *Materialize) materializeSet() {
 		index := it.containsMap[val]
 		tags := make(map[string]graph.Value)
 		it.subIt.TagResults(tags)
+		if !it.reserve(tags) {
+			break
+		}
 		it.values[index] = append(it.values[index], result{id: id, tags: tags})
 		it.actualSize += 1
 		for it.subIt.NextPath() {
@@ -289,20 +323,30 @@ func (it *Materialize) materializeSet() {
 			}
 			tags := make(map[string]graph.Value)
 			it.subIt.TagResults(tags)
+			if !it.reserve(tags) {
+				break
+			}
 			it.values[index] = append(it.values[index], result{id: id, tags: tags})
 			it.actualSize += 1
 		}
 	}
+	if it.err != nil {
+		// The quota was exceeded; drop what was materialized so far.
+		it.release()
+		it.values = nil
+		it.containsMap = nil
+		return
+	}
 	it.err = it.subIt.Err()
 	if it.err == nil && it.aborted {
-		if glog.V(2) {
-			glog.V(2).Infoln("Aborting subiterator")
+		if clog.V(2) {
+			clog.V(2).Infoln("Aborting subiterator")
 		}
+		it.release()
 		it.values = nil
 		it.containsMap = nil
 		it.subIt.Reset()
 	}
-	it.hasRun = true
 }
 
 var _ graph.Nexter = &Materialize{}
@@ -17,6 +17,8 @@ package iterator
 import (
 	"errors"
 	"testing"
+
+	"github.com/google/cayley/memory"
 )
 
 func TestMaterializeIteratorError(t *testing.T) {
@@ -68,3 +70,38 @@ func TestMaterializeIteratorErrorAbort(t *testing.T) {
 		t.Errorf("Materialize iterator did not pass through underlying Err")
 	}
 }
+
+func TestMaterializeIteratorQuota(t *testing.T) {
+	q := memory.NewQuotaLimit(10 * memory.ResultSize(0))
+	defer q.Close()
+
+	mIt := NewMaterialize(NewInt64(1, 20))
+	SetQuota(mIt, q)
+
+	if mIt.Next() != false {
+		t.Errorf("Materialize iterator returned a result over its quota")
+	}
+	if _, ok := mIt.Err().(*memory.ExceededError); !ok {
+		t.Errorf("Unexpected error over the quota, got:%v expect:*memory.ExceededError", mIt.Err())
+	}
+	if got := q.Used(); got != 0 {
+		t.Errorf("Materialize iterator kept memory after failing, got:%d expect:0", got)
+	}
+
+	mIt = NewMaterialize(NewInt64(1, 5))
+	SetQuota(mIt, q)
+	n := 0
+	for mIt.Next() {
+		n++
+	}
+	if got := n; got != 5 {
+		t.Errorf("Unexpected number of results within the quota, got:%d expect:5", got)
+	}
+	if got := q.Used(); got != 5*memory.ResultSize(0) {
+		t.Errorf("Unexpected memory accounted, got:%d expect:%d", got, 5*memory.ResultSize(0))
+	}
+	mIt.Close()
+	if got := q.Used(); got != 0 {
+		t.Errorf("Materialize iterator kept memory after Close, got:%d expect:0", got)
+	}
+}
@@ -66,6 +66,11 @@ func (it *Not) SubIterators() []graph.Iterator {
 	return []graph.Iterator{it.primaryIt, it.allIt}
 }
 
+func (it *Not) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.primaryIt = f(it.primaryIt)
+	it.allIt = f(it.allIt)
+}
+
 // Next advances the Not iterator. It returns whether there is another valid
 // new value. It fetches the next value of the all iterator which is not
 // contained by the primary iterator.
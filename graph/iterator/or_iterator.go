@@ -88,6 +88,12 @@ func (it *Or) SubIterators() []graph.Iterator {
 	return it.internalIterators
 }
 
+func (it *Or) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	for i, sub := range it.internalIterators {
+		it.internalIterators[i] = f(sub)
+	}
+}
+
 // Overrides BaseIterator TagResults, as it needs to add it's own results and
 // recurse down it's subiterators.
 func (it *Or) TagResults(dst map[string]graph.Value) {
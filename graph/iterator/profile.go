@@ -0,0 +1,177 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Profile iterator, which counts the calls to the iterator it
+// wraps and times them, so that slow queries can be diagnosed.
+
+import (
+	"time"
+
+	"github.com/google/cayley/graph"
+)
+
+// IteratorProfile is the profile of an iterator of a profiled tree.
+type IteratorProfile struct {
+	UID  uint64     `json:",omitempty"`
+	Type graph.Type `json:",omitempty"`
+
+	// Next, Contains and NextPath count the calls to each.
+	Next     int64
+	Contains int64
+	NextPath int64
+
+	// Time is the time spent in those calls, in nanoseconds, including
+	// the time spent in the subiterators.
+	Time time.Duration
+
+	Iterators []IteratorProfile `json:",omitempty"`
+}
+
+// replacer is implemented by iterators whose subiterators may be replaced
+// once they are optimized. Iterators that are not are profiled as a whole.
+type replacer interface {
+	// replaceSubIterators replaces each subiterator with what f returns
+	// for it. f returns the same iterator each time it is given one.
+	replaceSubIterators(f func(graph.Iterator) graph.Iterator)
+}
+
+// Profile wraps an iterator, recording how often it is called and how long
+// the calls take. It stands in for the iterator: its type, UID and
+// description are those of the wrapped one.
+type Profile struct {
+	it    graph.Iterator
+	stats IteratorProfile
+}
+
+// Profiled wraps every iterator of the optimized tree rooted at it, as far as
+// its subiterators may be replaced, and returns the wrapped root.
+func Profiled(it graph.Iterator) *Profile {
+	wrapped := make(map[graph.Iterator]*Profile)
+	var wrap func(graph.Iterator) graph.Iterator
+	wrap = func(it graph.Iterator) graph.Iterator {
+		if p, ok := it.(*Profile); ok {
+			return p
+		}
+		if p, ok := wrapped[it]; ok {
+			return p
+		}
+		p := &Profile{it: it}
+		wrapped[it] = p
+		if r, ok := it.(replacer); ok {
+			r.replaceSubIterators(wrap)
+		}
+		return p
+	}
+	return wrap(it).(*Profile)
+}
+
+// Profile returns the profile of the tree rooted at the iterator.
+func (it *Profile) Profile() IteratorProfile {
+	p := it.stats
+	p.UID = it.it.UID()
+	p.Type = it.it.Type()
+	p.Iterators = nil
+	for _, sub := range it.it.SubIterators() {
+		if sp, ok := sub.(*Profile); ok {
+			p.Iterators = append(p.Iterators, sp.Profile())
+		}
+	}
+	return p
+}
+
+func (it *Profile) UID() uint64 {
+	return it.it.UID()
+}
+
+func (it *Profile) Tagger() *graph.Tagger {
+	return it.it.Tagger()
+}
+
+func (it *Profile) TagResults(dst map[string]graph.Value) {
+	it.it.TagResults(dst)
+}
+
+func (it *Profile) Result() graph.Value {
+	return it.it.Result()
+}
+
+func (it *Profile) Next() bool {
+	start := time.Now()
+	ok := graph.Next(it.it)
+	it.stats.Time += time.Since(start)
+	it.stats.Next++
+	return ok
+}
+
+func (it *Profile) NextPath() bool {
+	start := time.Now()
+	ok := it.it.NextPath()
+	it.stats.Time += time.Since(start)
+	it.stats.NextPath++
+	return ok
+}
+
+func (it *Profile) Contains(v graph.Value) bool {
+	start := time.Now()
+	ok := it.it.Contains(v)
+	it.stats.Time += time.Since(start)
+	it.stats.Contains++
+	return ok
+}
+
+func (it *Profile) Err() error {
+	return it.it.Err()
+}
+
+func (it *Profile) Reset() {
+	it.it.Reset()
+}
+
+// Clone returns a clone of the wrapped iterator, which is not profiled.
+func (it *Profile) Clone() graph.Iterator {
+	return it.it.Clone()
+}
+
+func (it *Profile) Stats() graph.IteratorStats {
+	return it.it.Stats()
+}
+
+func (it *Profile) Size() (int64, bool) {
+	return it.it.Size()
+}
+
+func (it *Profile) Type() graph.Type {
+	return it.it.Type()
+}
+
+// Optimize does nothing, as the tree is profiled once it is optimized.
+func (it *Profile) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+func (it *Profile) SubIterators() []graph.Iterator {
+	return it.it.SubIterators()
+}
+
+func (it *Profile) Describe() graph.Description {
+	return it.it.Describe()
+}
+
+func (it *Profile) Close() error {
+	return it.it.Close()
+}
+
+var _ graph.Nexter = &Profile{}
@@ -0,0 +1,61 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestProfile(t *testing.T) {
+	fix := NewFixed(Identity)
+	for _, v := range []int{3, 4, 9} {
+		fix.Add(int64(v))
+	}
+	and := NewAnd(nil)
+	and.AddSubIterator(NewInt64(1, 5))
+	and.AddSubIterator(fix)
+
+	it := Profiled(and)
+	var got []int64
+	for graph.Next(it) {
+		got = append(got, it.Result().(int64))
+	}
+	if len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("Unexpected results of the profiled iterator, got:%v expect:[3 4]", got)
+	}
+
+	p := it.Profile()
+	if p.UID != and.UID() || p.Type != graph.And {
+		t.Errorf("Unexpected iterator profiled, got:%d %v expect:%d %v", p.UID, p.Type, and.UID(), graph.And)
+	}
+	if p.Next != 3 {
+		t.Errorf("Unexpected number of calls to Next, got:%d expect:3", p.Next)
+	}
+	if len(p.Iterators) != 2 {
+		t.Fatalf("Unexpected number of subiterators profiled, got:%d expect:2", len(p.Iterators))
+	}
+	var calls int64
+	for _, sub := range p.Iterators {
+		if sub.Time > p.Time {
+			t.Errorf("Subiterator took longer than the iterator, got:%v expect at most:%v", sub.Time, p.Time)
+		}
+		calls += sub.Next + sub.Contains
+	}
+	if calls == 0 {
+		t.Errorf("Subiterators were not profiled: %v", p.Iterators)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/memory"
+)
+
+// Accounted is implemented by iterators that hold results in memory, and
+// account for them against the quota of the query they run in.
+type Accounted interface {
+	SetQuota(q *memory.Quota)
+}
+
+// SetQuota sets the memory quota of every iterator of the tree rooted at it
+// that holds results in memory. Once one exceeds it, it stops, and its Err is
+// a *memory.ExceededError.
+func SetQuota(it graph.Iterator, q *memory.Quota) {
+	if a, ok := it.(Accounted); ok {
+		a.SetQuota(q)
+	}
+	for _, sub := range it.SubIterators() {
+		SetQuota(sub, q)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Retag iterator, which renames or drops the tags of the results
+// of its subiterator, so that paths combined with And or Or can keep their
+// tags apart.
+
+import (
+	"github.com/google/cayley/graph"
+)
+
+// Retag iterator yields the values of its subiterator, renaming the tags its
+// results are given by the subiterator as rename says. Tags renamed to the
+// empty string are dropped; those missing from rename are kept.
+type Retag struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	rename map[string]string
+}
+
+func NewRetag(subIt graph.Iterator, rename map[string]string) *Retag {
+	return &Retag{
+		uid:    NextUID(),
+		subIt:  subIt,
+		rename: rename,
+	}
+}
+
+func (it *Retag) UID() uint64 {
+	return it.uid
+}
+
+func (it *Retag) Reset() {
+	it.subIt.Reset()
+}
+
+func (it *Retag) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults tags the current result, and adds the tags of the subiterator,
+// renamed.
+func (it *Retag) TagResults(dst map[string]graph.Value) {
+	sub := make(map[string]graph.Value)
+	it.subIt.TagResults(sub)
+	for tag, value := range sub {
+		if name, ok := it.rename[tag]; ok {
+			if name == "" {
+				continue
+			}
+			tag = name
+		}
+		dst[tag] = value
+	}
+
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *Retag) Clone() graph.Iterator {
+	out := NewRetag(it.subIt.Clone(), it.rename)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Retag) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Retag) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.subIt = f(it.subIt)
+}
+
+func (it *Retag) Next() bool {
+	return graph.Next(it.subIt)
+}
+
+func (it *Retag) Err() error {
+	return it.subIt.Err()
+}
+
+func (it *Retag) Result() graph.Value {
+	return it.subIt.Result()
+}
+
+func (it *Retag) Contains(val graph.Value) bool {
+	return it.subIt.Contains(val)
+}
+
+func (it *Retag) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+func (it *Retag) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *Retag) Type() graph.Type { return graph.Retag }
+
+// Optimize replaces the subiterator if need be. With nothing to rename, we
+// are replaced by it.
+func (it *Retag) Optimize() (graph.Iterator, bool) {
+	newIt, optimized := it.subIt.Optimize()
+	if optimized {
+		it.subIt = newIt
+	}
+	if len(it.rename) == 0 {
+		out := it.subIt.Clone()
+		out.Tagger().CopyFrom(it)
+		return out, true
+	}
+	return it, false
+}
+
+func (it *Retag) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *Retag) Size() (int64, bool) {
+	return it.subIt.Size()
+}
+
+func (it *Retag) Describe() graph.Description {
+	return graph.Description{
+		UID:       it.UID(),
+		Type:      it.Type(),
+		Tags:      it.tags.Tags(),
+		Iterators: []graph.Description{it.subIt.Describe()},
+	}
+}
+
+var _ graph.Nexter = &Retag{}
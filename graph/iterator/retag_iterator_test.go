@@ -0,0 +1,53 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestRetag(t *testing.T) {
+	fixed := NewFixed(Identity)
+	fixed.Add(1)
+	for _, tag := range []string{"keep", "rename", "drop"} {
+		fixed.Tagger().Add(tag)
+	}
+	fixed.Tagger().AddFixed("fixed", 2)
+
+	it := NewRetag(fixed, map[string]string{"rename": "renamed", "drop": "", "fixed": "moved"})
+	it.Tagger().Add("own")
+	if !graph.Next(it) {
+		t.Fatal("Retag iterator yielded no results")
+	}
+	got := make(map[string]graph.Value)
+	it.TagResults(got)
+	expect := map[string]graph.Value{"keep": 1, "renamed": 1, "moved": 2, "own": 1}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected tags, got:%v expect:%v", got, expect)
+	}
+
+	it = NewRetag(fixed.Clone(), nil)
+	it.Tagger().Add("own")
+	opt, changed := it.Optimize()
+	if !changed || opt.Type() != graph.Fixed {
+		t.Errorf("Retag iterator renaming nothing was not replaced, got:%v", opt.Type())
+	}
+	if tags := opt.Tagger().Tags(); len(tags) != 4 {
+		t.Errorf("Unexpected tags of the replacement, got:%v", tags)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Sort iterator, which yields the values of its subiterator in a
+// given order, so that listing every node or quad of a store is reproducible.
+
+import (
+	"sort"
+
+	"github.com/google/cayley/graph"
+)
+
+// Sort iterator reads every value of its subiterator the first time it is
+// advanced, and then yields them in the order of the keys key gives them.
+// Contains asks the subiterator, without reading it.
+type Sort struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	key    func(graph.Value) string
+	values []graph.Value
+	keys   []string
+	read   bool
+	index  int
+	result graph.Value
+	err    error
+}
+
+func NewSort(subIt graph.Iterator, key func(graph.Value) string) *Sort {
+	return &Sort{
+		uid:   NextUID(),
+		subIt: subIt,
+		key:   key,
+	}
+}
+
+// SortNodes returns a Sort iterator over the nodes of it, in the order of
+// their names.
+func SortNodes(qs graph.QuadStore, it graph.Iterator) *Sort {
+	return NewSort(it, qs.NameOf)
+}
+
+// SortQuads returns a Sort iterator over the quads of it, in the order of
+// their subjects, then predicates, objects and labels.
+func SortQuads(qs graph.QuadStore, it graph.Iterator) *Sort {
+	return NewSort(it, func(v graph.Value) string {
+		q := qs.Quad(v)
+		return q.Subject + "\x00" + q.Predicate + "\x00" + q.Object + "\x00" + q.Label
+	})
+}
+
+func (it *Sort) UID() uint64 {
+	return it.uid
+}
+
+func (it *Sort) Reset() {
+	it.subIt.Reset()
+	it.values, it.keys = nil, nil
+	it.read = false
+	it.index = 0
+	it.result = nil
+	it.err = nil
+}
+
+func (it *Sort) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults tags the current result. The subiterators of a Sort are expected
+// to be those of all the nodes or quads, which have no tags of their own.
+func (it *Sort) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *Sort) Clone() graph.Iterator {
+	out := NewSort(it.subIt.Clone(), it.key)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Sort) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Sort) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.subIt = f(it.subIt)
+}
+
+func (it *Sort) readAll() {
+	it.read = true
+	max := CurrentGuards().MaxIntermediate
+	for graph.Next(it.subIt) {
+		v := it.subIt.Result()
+		if max > 0 && len(it.values) >= max {
+			it.err = &GuardError{Guard: "intermediate", Limit: max}
+			it.values, it.keys = nil, nil
+			return
+		}
+		it.values = append(it.values, v)
+		it.keys = append(it.keys, it.key(v))
+	}
+	if it.err = it.subIt.Err(); it.err != nil {
+		return
+	}
+	sort.Stable(byKey{it.values, it.keys})
+}
+
+func (it *Sort) Next() bool {
+	graph.NextLogIn(it)
+	if !it.read {
+		it.readAll()
+	}
+	if it.err != nil || it.index >= len(it.values) {
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.values[it.index]
+	it.index++
+	return graph.NextLogOut(it, it.result, true)
+}
+
+func (it *Sort) Err() error {
+	return it.err
+}
+
+func (it *Sort) Result() graph.Value {
+	return it.result
+}
+
+func (it *Sort) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if it.subIt.Contains(val) {
+		it.result = val
+		return graph.ContainsLogOut(it, val, true)
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+func (it *Sort) NextPath() bool {
+	return false
+}
+
+func (it *Sort) Close() error {
+	it.values, it.keys = nil, nil
+	return it.subIt.Close()
+}
+
+// Type returns graph.All if the subiterator is one, as the nodes and quads of
+// a store in order are still all of them, and optimizers treat them so.
+func (it *Sort) Type() graph.Type {
+	if it.subIt.Type() == graph.All {
+		return graph.All
+	}
+	return graph.Sort
+}
+
+func (it *Sort) Optimize() (graph.Iterator, bool) {
+	newIt, optimized := it.subIt.Optimize()
+	if optimized {
+		it.subIt = newIt
+	}
+	return it, false
+}
+
+// Stats returns those of the subiterator, with the cost of sorting spread
+// over the values.
+func (it *Sort) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	stats.NextCost *= 2
+	return stats
+}
+
+func (it *Sort) Size() (int64, bool) {
+	if it.read {
+		return int64(len(it.values)), true
+	}
+	return it.subIt.Size()
+}
+
+func (it *Sort) Describe() graph.Description {
+	size, _ := it.Size()
+	return graph.Description{
+		UID:       it.UID(),
+		Type:      it.Type(),
+		Tags:      it.tags.Tags(),
+		Size:      size,
+		Iterators: []graph.Description{it.subIt.Describe()},
+	}
+}
+
+type byKey struct {
+	values []graph.Value
+	keys   []string
+}
+
+func (s byKey) Len() int           { return len(s.values) }
+func (s byKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s byKey) Swap(i, j int) {
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+var _ graph.Nexter = &Sort{}
@@ -0,0 +1,46 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestSort(t *testing.T) {
+	fixed := NewFixed(Identity)
+	for _, v := range []int{3, 10, 1, 2} {
+		fixed.Add(v)
+	}
+	it := NewSort(fixed, func(v graph.Value) string { return fmt.Sprint(v) })
+	var got []graph.Value
+	for graph.Next(it) {
+		got = append(got, it.Result())
+	}
+	if expect := []graph.Value{1, 10, 2, 3}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected order, got:%v expect:%v", got, expect)
+	}
+	if !it.Contains(10) || it.Contains(4) {
+		t.Errorf("Sort iterator contains the wrong values")
+	}
+
+	it.Reset()
+	if !graph.Next(it) || it.Result() != 1 {
+		t.Errorf("Unexpected first result after a reset, got:%v expect:1", it.Result())
+	}
+}
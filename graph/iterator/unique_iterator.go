@@ -2,6 +2,7 @@ package iterator
 
 import (
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/memory"
 )
 
 // Unique iterator removes duplicate values from it's subiterator.
@@ -13,6 +14,7 @@ type Unique struct {
 	runstats graph.IteratorStats
 	err      error
 	seen     map[graph.Value]bool
+	quota    *memory.Quota
 }
 
 func NewUnique(subIt graph.Iterator) *Unique {
@@ -31,9 +33,15 @@ func (it *Unique) UID() uint64 {
 func (it *Unique) Reset() {
 	it.result = nil
 	it.subIt.Reset()
+	it.quota.Release(int64(len(it.seen)) * memory.ValueSize)
 	it.seen = make(map[graph.Value]bool)
 }
 
+// SetQuota accounts for the values seen against q.
+func (it *Unique) SetQuota(q *memory.Quota) {
+	it.quota = q
+}
+
 func (it *Unique) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -55,6 +63,7 @@ func (it *Unique) TagResults(dst map[string]graph.Value) {
 func (it *Unique) Clone() graph.Iterator {
 	uniq := NewUnique(it.subIt.Clone())
 	uniq.tags.CopyFrom(it)
+	uniq.quota = it.quota
 	return uniq
 }
 
@@ -64,6 +73,10 @@ func (it *Unique) SubIterators() []graph.Iterator {
 	return []graph.Iterator{it.subIt}
 }
 
+func (it *Unique) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.subIt = f(it.subIt)
+}
+
 // Next advances the subiterator, continuing until it returns a value which it
 // has not previously seen.
 func (it *Unique) Next() bool {
@@ -73,6 +86,10 @@ func (it *Unique) Next() bool {
 	for graph.Next(it.subIt) {
 		curr := it.subIt.Result()
 		if ok := it.seen[curr]; !ok {
+			if err := it.quota.Reserve(memory.ValueSize); err != nil {
+				it.err = err
+				return graph.NextLogOut(it, nil, false)
+			}
 			it.result = curr
 			it.seen[curr] = true
 			return graph.NextLogOut(it, it.result, true)
@@ -107,6 +124,7 @@ func (it *Unique) NextPath() bool {
 
 // Close closes the primary iterators.
 func (it *Unique) Close() error {
+	it.quota.Release(int64(len(it.seen)) * memory.ValueSize)
 	it.seen = nil
 	return it.subIt.Close()
 }
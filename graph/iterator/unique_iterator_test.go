@@ -3,6 +3,8 @@ package iterator
 import (
 	"reflect"
 	"testing"
+
+	"github.com/google/cayley/memory"
 )
 
 func TestUniqueIteratorBasics(t *testing.T) {
@@ -29,3 +31,26 @@ func TestUniqueIteratorBasics(t *testing.T) {
 		}
 	}
 }
+
+func TestUniqueIteratorQuota(t *testing.T) {
+	q := memory.NewQuotaLimit(2 * memory.ValueSize)
+	defer q.Close()
+
+	allIt := NewFixed(Identity)
+	for _, v := range []int{1, 1, 2, 2, 3} {
+		allIt.Add(v)
+	}
+	u := NewUnique(allIt)
+	SetQuota(u, q)
+
+	if got, expect := iterated(u), []int{1, 2}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected results over the quota, got:%v expect:%v", got, expect)
+	}
+	if _, ok := u.Err().(*memory.ExceededError); !ok {
+		t.Errorf("Unexpected error over the quota, got:%v expect:*memory.ExceededError", u.Err())
+	}
+	u.Close()
+	if got := q.Used(); got != 0 {
+		t.Errorf("Unique iterator kept memory after Close, got:%d expect:0", got)
+	}
+}
@@ -21,24 +21,25 @@ package iterator
 // come up from time to time. At *worst* we're as big as our underlying iterator.
 // At best, we're the null iterator.
 //
-// This is ripe for backend-side optimization. If you can run a value iterator,
-// from a sorted set -- some sort of value index, then go for it.
+// Stores that keep sorted indexes of the values their literals hold, as
+// ValueRangeIndexer, have the range read from them once optimized.
 //
 // In MQL terms, this is the [{"age>=": 21}] concept.
 
 import (
-	"strconv"
+	"math"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
 )
 
 type Operator int
 
 const (
-	compareLT Operator = iota
-	compareLTE
-	compareGT
-	compareGTE
+	CompareLT Operator = iota
+	CompareLTE
+	CompareGT
+	CompareGTE
 	// Why no Equals? Because that's usually an AndIterator.
 )
 
@@ -67,28 +68,54 @@ func (it *Comparison) UID() uint64 {
 	return it.uid
 }
 
+// valueRange returns the range of values our operator accepts, by their sort
+// keys, and whether we compare to a value that has one.
+func (it *Comparison) valueRange() (quad.ValueRange, bool) {
+	var r quad.ValueRange
+	var key uint64
+	r.Kind, key = quad.ValueSortKey(it.val)
+	if r.Kind == quad.NoValue {
+		return r, false
+	}
+	r.From, r.To = 0, math.MaxUint64
+	switch it.op {
+	case CompareLT:
+		if key == 0 {
+			// Nothing sorts before it: an empty range.
+			r.From = 1
+		}
+		r.To = key - 1
+	case CompareLTE:
+		r.To = key
+	case CompareGT:
+		if key == math.MaxUint64 {
+			r.To = 0
+		}
+		r.From = key + 1
+	case CompareGTE:
+		r.From = key
+	}
+	return r, true
+}
+
 // Here's the non-boilerplate part of the ValueComparison iterator. Given a value
-// and our operator, determine whether or not we meet the requirement.
+// and our operator, determine whether or not we meet the requirement. Values
+// of registered types without sort keys are compared by their codecs.
 func (it *Comparison) doComparison(val graph.Value) bool {
 	//TODO(barakmich): Implement string comparison.
-	nodeStr := it.qs.NameOf(val)
-	switch cVal := it.val.(type) {
-	case int:
-		cInt := int64(cVal)
-		intVal, err := strconv.ParseInt(nodeStr, 10, 64)
-		if err != nil {
-			return false
-		}
-		return RunIntOp(intVal, it.op, cInt)
-	case int64:
-		intVal, err := strconv.ParseInt(nodeStr, 10, 64)
-		if err != nil {
-			return false
-		}
-		return RunIntOp(intVal, it.op, cVal)
-	default:
+	r, ok := it.valueRange()
+	if ok {
+		return r.Contains(quad.SortKey(it.qs.NameOf(val)))
+	}
+	v, ok := quad.DecodeLiteral(it.qs.NameOf(val))
+	if !ok {
+		return true
+	}
+	c, ok := quad.CompareValues(v, it.val)
+	if !ok {
 		return true
 	}
+	return RunIntOp(int64(c), it.op, 0)
 }
 
 func (it *Comparison) Close() error {
@@ -97,13 +124,13 @@ func (it *Comparison) Close() error {
 
 func RunIntOp(a int64, op Operator, b int64) bool {
 	switch op {
-	case compareLT:
+	case CompareLT:
 		return a < b
-	case compareLTE:
+	case CompareLTE:
 		return a <= b
-	case compareGT:
+	case CompareGT:
 		return a > b
-	case compareGTE:
+	case CompareGTE:
 		return a >= b
 	default:
 		panic("Unknown operator type")
@@ -164,6 +191,10 @@ func (it *Comparison) SubIterators() []graph.Iterator {
 	return nil
 }
 
+func (it *Comparison) replaceSubIterators(f func(graph.Iterator) graph.Iterator) {
+	it.subIt = f(it.subIt)
+}
+
 func (it *Comparison) Contains(val graph.Value) bool {
 	if !it.doComparison(val) {
 		return false
@@ -201,16 +232,31 @@ func (it *Comparison) Describe() graph.Description {
 	}
 }
 
-// There's nothing to optimize, locally, for a value-comparison iterator.
-// Replace the underlying iterator if need be.
-// potentially replace it.
+// Replace the underlying iterator if need be. If the store keeps range
+// indexes, we become the intersection of the range read from them and the
+// underlying iterator.
 func (it *Comparison) Optimize() (graph.Iterator, bool) {
 	newSub, changed := it.subIt.Optimize()
 	if changed {
 		it.subIt.Close()
 		it.subIt = newSub
 	}
-	return it, false
+	ri, ok := it.qs.(graph.ValueRangeIndexer)
+	if !ok {
+		return it, false
+	}
+	r, ok := it.valueRange()
+	if !ok {
+		return it, false
+	}
+	// We are closed once replaced, closing the underlying iterator with
+	// us, so the intersection takes a clone of it.
+	and := NewAnd(it.qs)
+	and.Tagger().CopyFrom(it)
+	and.AddSubIterator(ri.ValueRangeIterator(r))
+	and.AddSubIterator(it.subIt.Clone())
+	out, _ := and.Optimize()
+	return out, true
 }
 
 // We're only as expensive as our subiterator.
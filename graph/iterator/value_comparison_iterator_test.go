@@ -18,8 +18,10 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
 )
 
 var simpleStore = &store{data: []string{"0", "1", "2", "3", "4", "5"}}
@@ -41,25 +43,25 @@ var comparisonTests = []struct {
 	{
 		message:  "successful int64 less than comparison",
 		operand:  int64(3),
-		operator: compareLT,
+		operator: CompareLT,
 		expect:   []string{"0", "1", "2"},
 	},
 	{
 		message:  "empty int64 less than comparison",
 		operand:  int64(0),
-		operator: compareLT,
+		operator: CompareLT,
 		expect:   nil,
 	},
 	{
 		message:  "successful int64 greater than comparison",
 		operand:  int64(2),
-		operator: compareGT,
+		operator: CompareGT,
 		expect:   []string{"3", "4"},
 	},
 	{
 		message:  "successful int64 greater than or equal comparison",
 		operand:  int64(2),
-		operator: compareGTE,
+		operator: CompareGTE,
 		expect:   []string{"2", "3", "4"},
 	},
 }
@@ -87,25 +89,25 @@ var vciContainsTests = []struct {
 }{
 	{
 		message:  "1 is less than 2",
-		operator: compareGTE,
+		operator: CompareGTE,
 		check:    1,
 		expect:   false,
 	},
 	{
 		message:  "2 is greater than or equal to 2",
-		operator: compareGTE,
+		operator: CompareGTE,
 		check:    2,
 		expect:   true,
 	},
 	{
 		message:  "3 is greater than or equal to 2",
-		operator: compareGTE,
+		operator: CompareGTE,
 		check:    3,
 		expect:   true,
 	},
 	{
 		message:  "5 is absent from iterator",
-		operator: compareGTE,
+		operator: CompareGTE,
 		check:    5,
 		expect:   false,
 	},
@@ -124,7 +126,7 @@ func TestComparisonIteratorErr(t *testing.T) {
 	wantErr := errors.New("unique")
 	errIt := newTestIterator(false, wantErr)
 
-	vc := NewComparison(errIt, compareLT, int64(2), simpleStore)
+	vc := NewComparison(errIt, CompareLT, int64(2), simpleStore)
 
 	if vc.Next() != false {
 		t.Errorf("Comparison iterator did not pass through initial 'false'")
@@ -133,3 +135,149 @@ func TestComparisonIteratorErr(t *testing.T) {
 		t.Errorf("Comparison iterator did not pass through underlying Err")
 	}
 }
+
+var typedStore = &store{data: []string{
+	`"-1.5"^^` + quad.XSDDouble,
+	`"2"^^` + quad.XSDInteger,
+	"10",
+	`"2015-03-01T12:00:00Z"^^` + quad.XSDDateTime,
+	`"2015-06-01"^^` + quad.XSDDate,
+	`"ten"^^` + quad.XSDInteger,
+}}
+
+func typedFixedIterator() *Fixed {
+	f := NewFixed(Identity)
+	for i := range typedStore.data {
+		f.Add(i)
+	}
+	return f
+}
+
+var typedComparisonTests = []struct {
+	message  string
+	operand  interface{}
+	operator Operator
+	expect   []int
+}{
+	{
+		message:  "numbers less than zero",
+		operand:  0.0,
+		operator: CompareLT,
+		expect:   []int{0},
+	},
+	{
+		message:  "numbers of any type at least two",
+		operand:  2,
+		operator: CompareGTE,
+		expect:   []int{1, 2},
+	},
+	{
+		message:  "times after April",
+		operand:  time.Date(2015, 4, 1, 0, 0, 0, 0, time.UTC),
+		operator: CompareGT,
+		expect:   []int{4},
+	},
+	{
+		message:  "times up to noon on the first of March",
+		operand:  time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC),
+		operator: CompareLTE,
+		expect:   []int{3},
+	},
+}
+
+// rangeStore is a store keeping range indexes, which it reads by scanning.
+type rangeStore struct {
+	*store
+	read int
+}
+
+func (qs *rangeStore) ValueRangeIterator(r quad.ValueRange) graph.Iterator {
+	qs.read++
+	f := NewFixed(Identity)
+	for i, name := range qs.data {
+		if r.Contains(quad.SortKey(name)) {
+			f.Add(i)
+		}
+	}
+	return f
+}
+
+func TestTypedComparison(t *testing.T) {
+	for _, test := range typedComparisonTests {
+		vc := NewComparison(typedFixedIterator(), test.operator, test.operand, typedStore)
+		var got []int
+		for vc.Next() {
+			got = append(got, vc.Result().(int))
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to show %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+
+		qs := &rangeStore{store: typedStore}
+		vc = NewComparison(typedFixedIterator(), test.operator, test.operand, qs)
+		vc.Tagger().Add("value")
+		it, changed := vc.Optimize()
+		if !changed || qs.read != 1 {
+			t.Errorf("Failed to read the range index for %s", test.message)
+		}
+		got = nil
+		for graph.Next(it) {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			if tags["value"] != it.Result() {
+				t.Errorf("Failed to tag the results for %s, got:%v", test.message, tags)
+			}
+			got = append(got, it.Result().(int))
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to show %s from the range index, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+}
+
+// semver is a value ordered by its codec, without sort keys.
+type semver string
+
+const semverType = "<http://example.com/semver>"
+
+func init() {
+	quad.RegisterCodec(semverType, quad.Codec{
+		Type:   reflect.TypeOf(semver("")),
+		Encode: func(v interface{}) (string, error) { return string(v.(semver)), nil },
+		Decode: func(s string) (interface{}, error) { return semver(s), nil },
+		Compare: func(a, b interface{}) int {
+			sa, sb := a.(semver), b.(semver)
+			if len(sa) != len(sb) {
+				return len(sa) - len(sb)
+			}
+			if sa < sb {
+				return -1
+			} else if sa > sb {
+				return 1
+			}
+			return 0
+		},
+	})
+}
+
+func TestCodecComparison(t *testing.T) {
+	qs := &store{data: []string{
+		`"1.9"^^` + semverType,
+		`"1.10"^^` + semverType,
+		`"2.0"^^` + semverType,
+		"1.5",
+	}}
+	f := NewFixed(Identity)
+	for i := range qs.data {
+		f.Add(i)
+	}
+	vc := NewComparison(f, CompareGT, semver("1.9"), qs)
+	var got []int
+	for vc.Next() {
+		got = append(got, vc.Result().(int))
+	}
+	// Names holding no value of the type are not filtered.
+	if expect := []int{1, 2, 3}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected comparison of codec values, got:%v expect:%v", got, expect)
+	}
+}
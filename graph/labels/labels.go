@@ -0,0 +1,121 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package labels manages the named graphs of a QuadStore: the sets of quads
+// sharing a label.
+package labels
+
+import (
+	"errors"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// ErrDefaultGraph is returned when dropping the default graph, which has no
+// label.
+var ErrDefaultGraph = errors.New("labels: cannot drop the default graph")
+
+// Counts returns the number of quads in each named graph of qs. Quads in the
+// default graph, which have no label, are not counted.
+func Counts(qs graph.QuadStore) (map[string]int64, error) {
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	counts := make(map[string]int64)
+	for graph.Next(it) {
+		if l := qs.Quad(it.Result()).Label; l != "" {
+			counts[l]++
+		}
+	}
+	return counts, it.Err()
+}
+
+// Drop removes every quad in the named graph, and returns how many were
+// removed.
+func Drop(qw graph.QuadWriter, label string) (int, error) {
+	if label == "" {
+		return 0, ErrDefaultGraph
+	}
+	return qw.DeleteQuadsMatching(quad.Quad{Label: label})
+}
+
+// Restrict returns a view of qs that only holds the quads in the given named
+// graphs, so that queries run against it see nothing else. Its nodes and
+// Size are those of qs. Writes go through to qs.
+func Restrict(qs graph.QuadStore, labels ...string) graph.QuadStore {
+	return &restricted{QuadStore: qs, labels: labels}
+}
+
+type restricted struct {
+	graph.QuadStore
+	labels []string
+}
+
+func (r *restricted) labelsIterator() graph.Iterator {
+	fixed := r.QuadStore.FixedIterator()
+	for _, l := range r.labels {
+		fixed.Add(r.QuadStore.ValueOf(l))
+	}
+	return fixed
+}
+
+func (r *restricted) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	if d == quad.Label {
+		for _, l := range r.labels {
+			if r.QuadStore.NameOf(v) == l {
+				return r.QuadStore.QuadIterator(d, v)
+			}
+		}
+		return iterator.NewNull()
+	}
+	and := iterator.NewAnd(r.QuadStore)
+	and.AddSubIterator(r.QuadStore.QuadIterator(d, v))
+	and.AddSubIterator(iterator.NewLinksTo(r.QuadStore, r.labelsIterator(), quad.Label))
+	return and
+}
+
+func (r *restricted) QuadsAllIterator() graph.Iterator {
+	return iterator.NewLinksTo(r.QuadStore, r.labelsIterator(), quad.Label)
+}
+
+// OptimizeIterator replaces a LinksTo from a single node with a restricted
+// QuadIterator. It does not hand iterators to the store to optimize, since
+// the store would read its unrestricted indexes.
+func (r *restricted) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	if it.Type() != graph.LinksTo {
+		return it, false
+	}
+	lto := it.(*iterator.LinksTo)
+	subs := lto.SubIterators()
+	if len(subs) != 1 || subs[0].Type() != graph.Fixed {
+		return it, false
+	}
+	primary := subs[0]
+	if size, _ := primary.Size(); size != 1 {
+		return it, false
+	}
+	if !graph.Next(primary) {
+		panic("unexpected size during optimize")
+	}
+	val := primary.Result()
+	newIt := r.QuadIterator(lto.Direction(), val)
+	nt := newIt.Tagger()
+	nt.CopyFrom(lto)
+	for _, tag := range primary.Tagger().Tags() {
+		nt.AddFixed(tag, val)
+	}
+	lto.Close()
+	return newIt, true
+}
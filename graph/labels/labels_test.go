@@ -0,0 +1,107 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package labels
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+var labeledGraph = []quad.Quad{
+	{"alice", "follows", "bob", "social"},
+	{"bob", "follows", "carol", "social"},
+	{"alice", "follows", "carol", "work"},
+	{"alice", "status", "cool", ""},
+}
+
+func makeTestStore(t *testing.T) (graph.QuadStore, graph.QuadWriter) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	if err := w.AddQuadSet(labeledGraph); err != nil {
+		t.Fatalf("Could not load quads: %v", err)
+	}
+	return qs, w
+}
+
+func names(qs graph.QuadStore, p *path.Path) []string {
+	var out []string
+	it := p.BuildIterator()
+	it, _ = it.Optimize()
+	for graph.Next(it) {
+		out = append(out, qs.NameOf(it.Result()))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCounts(t *testing.T) {
+	qs, w := makeTestStore(t)
+	counts, err := Counts(qs)
+	if err != nil {
+		t.Fatalf("Could not count labels: %v", err)
+	}
+	if expect := map[string]int64{"social": 2, "work": 1}; !reflect.DeepEqual(counts, expect) {
+		t.Errorf("Unexpected label counts, got:%v expect:%v", counts, expect)
+	}
+
+	if _, err := Drop(w, ""); err != ErrDefaultGraph {
+		t.Errorf("Unexpected error dropping the default graph: %v", err)
+	}
+	n, err := Drop(w, "social")
+	if err != nil || n != 2 {
+		t.Errorf("Unexpected result dropping a label, got:%d, %v", n, err)
+	}
+	counts, _ = Counts(qs)
+	if expect := map[string]int64{"work": 1}; !reflect.DeepEqual(counts, expect) {
+		t.Errorf("Unexpected label counts after drop, got:%v expect:%v", counts, expect)
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	qs, _ := makeTestStore(t)
+	for _, test := range []struct {
+		message string
+		qs      graph.QuadStore
+		expect  []string
+	}{
+		{"follow in any graph", qs, []string{"bob", "carol"}},
+		{"follow in one graph", Restrict(qs, "social"), []string{"bob"}},
+		{"follow in two graphs", Restrict(qs, "social", "work"), []string{"bob", "carol"}},
+		{"follow in an unknown graph", Restrict(qs, "nothing"), nil},
+	} {
+		got := names(test.qs, path.StartPath(test.qs, "alice").Out("follows"))
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+
+	r := Restrict(qs, "work")
+	var quads []quad.Quad
+	it := r.QuadsAllIterator()
+	for graph.Next(it) {
+		quads = append(quads, r.Quad(it.Result()))
+	}
+	if expect := labeledGraph[2:3]; !reflect.DeepEqual(quads, expect) {
+		t.Errorf("Unexpected quads in restricted store, got:%v expect:%v", quads, expect)
+	}
+}
@@ -100,23 +100,27 @@ func (it *AllIterator) Clone() graph.Iterator {
 }
 
 func (it *AllIterator) Next() bool {
-	if !it.open {
-		it.result = nil
-		return false
-	}
-	var out []byte
-	out = make([]byte, len(it.iter.Key()))
-	copy(out, it.iter.Key())
-	it.iter.Next()
-	if !it.iter.Valid() {
-		it.Close()
+	for it.open {
+		var out []byte
+		out = make([]byte, len(it.iter.Key()))
+		copy(out, it.iter.Key())
+		// Deleted quads are kept in the indexes with their history.
+		live := it.dir == quad.Any || it.qs.isLiveValue(it.iter.Value())
+		it.iter.Next()
+		if !it.iter.Valid() {
+			it.Close()
+		}
+		if !bytes.HasPrefix(out, it.prefix) {
+			it.Close()
+			return false
+		}
+		if live {
+			it.result = Token(out)
+			return true
+		}
 	}
-	if !bytes.HasPrefix(out, it.prefix) {
-		it.Close()
-		return false
-	}
-	it.result = Token(out)
-	return true
+	it.result = nil
+	return false
 }
 
 func (it *AllIterator) Err() error {
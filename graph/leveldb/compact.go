@@ -0,0 +1,125 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldb
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/google/cayley/graph"
+)
+
+// Compact purges the quads deleted before the given time, rewrites the node
+// values from the spo index, removing those no quad refers to and recounting
+// the others, then compacts the whole database, so that the tables drop the
+// deleted keys.
+func (qs *QuadStore) Compact(before time.Time) (graph.CompactStats, error) {
+	var stats graph.CompactStats
+	if qs.snapshot {
+		return stats, graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return stats, graph.ErrReadOnly
+	}
+	stats.Before = qs.diskSize()
+	n, err := qs.Purge(before)
+	if err != nil {
+		return stats, err
+	}
+	stats.Quads = n
+	err = qs.rewriteValues(&stats)
+	if err != nil {
+		return stats, err
+	}
+	err = qs.db.CompactRange(util.Range{})
+	if err != nil {
+		return stats, err
+	}
+	stats.After = qs.diskSize()
+	return stats, nil
+}
+
+// rewriteValues removes the node values no spo entry refers to, and rewrites
+// those whose size is not their number of live quads.
+func (qs *QuadStore) rewriteValues(stats *graph.CompactStats) error {
+	// Deleted quads keep their nodes referenced, at size 0.
+	sizes := make(map[string]int64)
+	it := qs.db.NewIterator(util.BytesPrefix(indexPrefix(spo)), qs.readopts)
+	for it.Next() {
+		var entry IndexEntry
+		err := qs.unmarshal(it.Value(), &entry)
+		if err != nil {
+			it.Release()
+			return err
+		}
+		var n int64
+		if _, ok := qs.liveSince(entry.History); ok {
+			n = 1
+		}
+		for _, name := range []string{entry.Quad.Subject, entry.Quad.Predicate, entry.Quad.Object, entry.Quad.Label} {
+			if name != "" {
+				sizes[name] += n
+			}
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+
+	batch := &leveldb.Batch{}
+	it = qs.db.NewIterator(util.BytesPrefix([]byte("z")), qs.readopts)
+	defer it.Release()
+	for it.Next() {
+		var value ValueData
+		err := qs.unmarshal(it.Value(), &value)
+		if err != nil {
+			return err
+		}
+		n, ok := sizes[value.Name]
+		if !ok {
+			batch.Delete(append([]byte(nil), it.Key()...))
+			stats.Nodes++
+		} else if n != value.Size {
+			err = qs.putValue(batch, value.Name, n)
+			if err != nil {
+				return err
+			}
+			stats.Values++
+		}
+	}
+	if err := it.Error(); err != nil || batch.Len() == 0 {
+		return err
+	}
+	return qs.db.Write(batch, qs.writeopts)
+}
+
+// diskSize returns the size of the files of the database.
+func (qs *QuadStore) diskSize() int64 {
+	files, err := ioutil.ReadDir(qs.path)
+	if err != nil {
+		return 0
+	}
+	var n int64
+	for _, f := range files {
+		if f.Mode().IsRegular() {
+			n += f.Size()
+		}
+	}
+	return n
+}
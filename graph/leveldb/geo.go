@@ -0,0 +1,124 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldb
+
+import (
+	"encoding/binary"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// The geohash index is keyed by the geohashes of the nodes that are
+// geographic points, followed by the hashes of their names. The key holding
+// geoIndexBuilt records that the points held before the index was kept have
+// been added to it.
+//
+// Encrypted stores keep no index, as its keys would give away where the
+// points are.
+const (
+	geoPrefix     = 'g'
+	geoIndexBuilt = "__geo"
+)
+
+// geoBatchSize is the number of entries written at once while building the
+// geohash index.
+const geoBatchSize = 10000
+
+func geoKey(geohash uint64) []byte {
+	key := make([]byte, 9, 9+hashSize)
+	key[0] = geoPrefix
+	binary.BigEndian.PutUint64(key[1:], geohash)
+	return key
+}
+
+func createGeoKeyFor(name string, p quad.GeoPoint) []byte {
+	return append(geoKey(p.Geohash()), hashOf(name)...)
+}
+
+// indexGeo updates the geohash index once the deltas have been applied.
+func (qs *QuadStore) indexGeo(deltas []graph.Delta) error {
+	if qs.cipher != nil {
+		return nil
+	}
+	added, removed := graph.GeoChanges(qs, deltas)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	batch := &leveldb.Batch{}
+	for _, name := range added {
+		p, _ := quad.ParseGeoPoint(name)
+		batch.Put(createGeoKeyFor(name, p), nil)
+	}
+	for _, name := range removed {
+		p, _ := quad.ParseGeoPoint(name)
+		batch.Delete(createGeoKeyFor(name, p))
+	}
+	return qs.db.Write(batch, qs.writeopts)
+}
+
+// buildGeoIndex adds the points the store holds to the geohash index, unless
+// it has been done already.
+func (qs *QuadStore) buildGeoIndex() error {
+	if qs.cipher != nil {
+		return nil
+	}
+	_, err := qs.db.Get([]byte(geoIndexBuilt), qs.readopts)
+	if err != leveldb.ErrNotFound {
+		return err
+	}
+	if qs.readOnly {
+		clog.Warningln("The geohash index is not built; queries near points scan the store until it is opened writable")
+		qs.scanNear = true
+		return nil
+	}
+	if qs.size > 0 {
+		clog.Infof("Building the geohash index of %d quads", qs.size)
+	}
+	batch := &leveldb.Batch{}
+	err = graph.GeoObjects(qs, func(name string, p quad.GeoPoint) error {
+		batch.Put(createGeoKeyFor(name, p), nil)
+		if batch.Len() < geoBatchSize {
+			return nil
+		}
+		err := qs.db.Write(batch, qs.writeopts)
+		batch.Reset()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(geoIndexBuilt), nil)
+	return qs.db.Write(batch, qs.writeopts)
+}
+
+func (qs *QuadStore) NearIterator(center quad.GeoPoint, radius float64) graph.Iterator {
+	if qs.cipher != nil || qs.scanNear {
+		return graph.ScanNear(qs, center, radius)
+	}
+	var nodes []graph.Value
+	for _, r := range center.GeohashRanges(radius) {
+		it := qs.db.NewIterator(&util.Range{Start: geoKey(r.From), Limit: geoKey(r.To)}, qs.readopts)
+		for it.Next() {
+			nodes = append(nodes, Token(append([]byte("z"), it.Key()[9:]...)))
+		}
+		it.Release()
+	}
+	return graph.NearIteratorOf(qs, center, radius, nodes)
+}
@@ -16,12 +16,11 @@ package leveldb
 
 import (
 	"bytes"
-	"encoding/json"
 
-	"github.com/barakmich/glog"
 	ldbit "github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
@@ -67,7 +66,7 @@ func NewIterator(prefix string, d quad.Direction, value graph.Value, qs *QuadSto
 	if !ok {
 		it.open = false
 		it.iter.Release()
-		glog.Error("Opening LevelDB iterator couldn't seek to location ", it.nextPrefix)
+		clog.Error("Opening LevelDB iterator couldn't seek to location ", it.nextPrefix)
 	}
 
 	return &it
@@ -117,12 +116,6 @@ func (it *Iterator) Close() error {
 	return nil
 }
 
-func (it *Iterator) isLiveValue(val []byte) bool {
-	var entry IndexEntry
-	json.Unmarshal(val, &entry)
-	return len(entry.History)%2 != 0
-}
-
 func (it *Iterator) Next() bool {
 	if it.iter == nil {
 		it.result = nil
@@ -138,7 +131,8 @@ func (it *Iterator) Next() bool {
 		return false
 	}
 	if bytes.HasPrefix(it.iter.Key(), it.nextPrefix) {
-		if !it.isLiveValue(it.iter.Value()) {
+		if !it.qs.isLiveValue(it.iter.Value()) {
+			it.iter.Next()
 			return it.Next()
 		}
 		out := make([]byte, len(it.iter.Key()))
@@ -194,7 +188,7 @@ func PositionOf(prefix []byte, d quad.Direction, qs *QuadStore) int {
 		case quad.Object:
 			return hashSize + 2
 		case quad.Label:
-			return hashSize + 2
+			return 3*hashSize + 2
 		}
 	}
 	if bytes.Equal(prefix, []byte("os")) {
@@ -240,6 +234,7 @@ func (it *Iterator) Contains(v graph.Value) bool {
 		// However, if it ever starts coming from somewhere else, it'll be more
 		// efficient to change the interface of the graph.Value for LevelDB to a
 		// struct with a flag for isValid, to save another random read.
+		it.result = val
 		return true
 	}
 	return false
@@ -20,8 +20,10 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/graphtest"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
 	"github.com/google/cayley/writer"
@@ -463,4 +465,247 @@ func TestOptimize(t *testing.T) {
 	if !reflect.DeepEqual(newResults, oldResults) {
 		t.Errorf("Discordant tag results, new:%v old:%v", newResults, oldResults)
 	}
+
+	// A quad found by Contains is the result, as it is found by Next.
+	q := oldIt.Result()
+	check := qs.QuadIterator(quad.Object, qs.ValueOf("F"))
+	if !check.Contains(q) || check.Result() == nil {
+		t.Errorf("Unexpected result of Contains, got:%v expect:%v", check.Result(), q)
+	}
+}
+
+func TestBloomFilters(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir(os.TempDir(), "cayley_test")
+	t.Log(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	err := createNewLevelDB(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create working directory")
+	}
+	opts := graph.Options{"bloom_filters": true}
+	qs, err := newQuadStore(tmpDir, opts)
+	if err != nil {
+		t.Fatalf("Failed to create LevelDB QuadStore: %v", err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+
+	for i := 0; i < 2; i++ {
+		if it := qs.QuadIterator(quad.Subject, qs.ValueOf("cool")); it.Type() != graph.Null {
+			t.Errorf("Unexpected iterator for a node never in the direction, got:%v expect:%v", it.Type(), graph.Null)
+		}
+		got := iteratedQuads(qs, qs.QuadIterator(quad.Object, qs.ValueOf("cool")))
+		if len(got) != 3 {
+			t.Errorf("Unexpected quads for a node in the direction, got:%v", got)
+		}
+		// Reopen the store, building the filters from the quads on disk.
+		qs.Close()
+		qs, err = newQuadStore(tmpDir, opts)
+		if err != nil {
+			t.Fatalf("Failed to reopen LevelDB QuadStore: %v", err)
+		}
+	}
+	qs.Close()
+}
+
+func TestReadOnly(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir(os.TempDir(), "cayley_test")
+	t.Log(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	err := createNewLevelDB(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create working directory")
+	}
+	qs, err := newQuadStore(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create LevelDB QuadStore: %v", err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+
+	opts := graph.Options{"read_only": true}
+	if _, err := newQuadStore(tmpDir, opts); err == nil {
+		t.Errorf("Expected opening a database being written to fail")
+	}
+	qs.Close()
+
+	// Readers share the database.
+	var readers []graph.QuadStore
+	for i := 0; i < 2; i++ {
+		r, err := newQuadStore(tmpDir, opts)
+		if err != nil {
+			t.Fatalf("Failed to open LevelDB QuadStore read-only: %v", err)
+		}
+		defer r.Close()
+		readers = append(readers, r)
+	}
+	for _, r := range readers {
+		got := iteratedQuads(r, r.QuadIterator(quad.Object, r.ValueOf("cool")))
+		if len(got) != 3 {
+			t.Errorf("Unexpected quads read-only, got:%v", got)
+		}
+	}
+	err = readers[0].ApplyDeltas([]graph.Delta{{Quad: quad.Quad{"A", "follows", "G", ""}, Action: graph.Add}}, graph.IgnoreOpts{})
+	if err != graph.ErrReadOnly {
+		t.Errorf("Unexpected error writing read-only, got:%v expect:%v", err, graph.ErrReadOnly)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s, closer := makeStore(t)
+	defer closer()
+	qs := s.(*QuadStore)
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+
+	rep, err := qs.Verify(false)
+	if err != nil {
+		t.Fatalf("Failed to verify store: %v", err)
+	}
+	if !rep.OK() || rep.Quads != int64(len(makeQuadSet())) {
+		t.Fatalf("Unexpected report for a sound store: %+v", rep)
+	}
+
+	// Lose an index entry, orphan another and miscount a node.
+	q := quad.Quad{"A", "follows", "B", ""}
+	qs.db.Delete(qs.createKeyFor(pos, q), nil)
+	qs.db.Put(qs.createKeyFor(osp, quad.Quad{"X", "follows", "Y", ""}), []byte("{}"), nil)
+	qs.UpdateValueKeyBy("B", 5, nil)
+
+	rep, err = qs.Verify(false)
+	if err != nil {
+		t.Fatalf("Failed to verify store: %v", err)
+	}
+	if len(rep.Problems) != 3 || rep.Repaired != 0 {
+		t.Fatalf("Unexpected report for a damaged store: %+v", rep)
+	}
+	rep, err = qs.Verify(true)
+	if err != nil || rep.Repaired != 3 {
+		t.Fatalf("Unexpected repair of a damaged store: %+v, %v", rep, err)
+	}
+	rep, err = qs.Verify(false)
+	if err != nil || !rep.OK() {
+		t.Fatalf("Unexpected report for a repaired store: %+v, %v", rep, err)
+	}
+	if got := qs.SizeOf(qs.ValueOf("B")); got != 5 {
+		t.Errorf("Unexpected size of repaired node, got:%d expect:5", got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s, closer := makeStore(t)
+	defer closer()
+	qs := s.(*QuadStore)
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet(makeQuadSet())
+	w.RemoveQuad(quad.Quad{"A", "follows", "B", ""})
+	qs.UpdateValueKeyBy("C", 5, nil)
+
+	stats, err := qs.Compact(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to compact store: %v", err)
+	}
+	if stats.Quads != 1 || stats.Nodes != 1 || stats.Values != 1 || stats.After <= 0 {
+		t.Errorf("Unexpected compaction, got:%+v expect:1 quad, 1 node, 1 value", stats)
+	}
+	if got := qs.SizeOf(qs.ValueOf("C")); got != 2 {
+		t.Errorf("Unexpected size of rewritten node, got:%d expect:2", got)
+	}
+	if rep, err := qs.Verify(false); err != nil || !rep.OK() {
+		t.Errorf("Unexpected report for a compacted store: %+v, %v", rep, err)
+	}
+}
+
+func TestBuildGeoIndex(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	createNewLevelDB(tmpDir, nil)
+	qs, err := newQuadStore(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create LevelDB QuadStore: %v", err)
+	}
+	p := quad.GeoPoint{Lat: 48.8584, Lon: 2.2945}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuad(quad.Quad{"eiffel", "location", p.String(), ""})
+
+	// Forget the index, as a store written before it was kept would.
+	db := qs.(*QuadStore).db
+	db.Delete(createGeoKeyFor(p.String(), p), nil)
+	db.Delete([]byte(geoIndexBuilt), nil)
+	qs.Close()
+
+	qs, err = newQuadStore(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen LevelDB QuadStore: %v", err)
+	}
+	defer qs.Close()
+	it := qs.(*QuadStore).NearIterator(p, 10)
+	if !graph.Next(it) || qs.NameOf(it.Result()) != p.String() {
+		t.Errorf("Point was not indexed when reopening the store")
+	}
+}
+
+func TestBuildRangeIndex(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	createNewLevelDB(tmpDir, nil)
+	qs, err := newQuadStore(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create LevelDB QuadStore: %v", err)
+	}
+	age := `"42"^^` + quad.XSDInteger
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuad(quad.Quad{"alice", "age", age, ""})
+
+	// Forget the index, as a store written before it was kept would.
+	db := qs.(*QuadStore).db
+	db.Delete(createRangeKeyFor(age), nil)
+	db.Delete([]byte(rangeIndexBuilt), nil)
+	qs.Close()
+
+	qs, err = newQuadStore(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen LevelDB QuadStore: %v", err)
+	}
+	defer qs.Close()
+	key := quad.NumberKey(42)
+	it := qs.(*QuadStore).ValueRangeIterator(quad.ValueRange{Kind: quad.NumberValue, From: key, To: key})
+	if !graph.Next(it) || qs.NameOf(it.Result()) != age {
+		t.Errorf("Value was not indexed when reopening the store")
+	}
+}
+
+func makeStore(t testing.TB) (graph.QuadStore, func()) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	err = createNewLevelDB(tmpDir, nil)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatal("Failed to create LevelDB database.", err)
+	}
+	qs, err := newQuadStore(tmpDir, nil)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatal("Failed to create LevelDB QuadStore.", err)
+	}
+	return qs, func() {
+		qs.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	graphtest.TestAll(t, makeStore)
+}
+
+func BenchmarkConformance(b *testing.B) {
+	graphtest.BenchmarkAll(b, makeStore)
 }
@@ -23,14 +23,17 @@ import (
 	"fmt"
 	"hash"
 	"sync"
+	"time"
 
-	"github.com/barakmich/glog"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/internal/crypt"
+	"github.com/google/cayley/internal/lru"
 	"github.com/google/cayley/quad"
 )
 
@@ -66,18 +69,54 @@ type QuadStore struct {
 	horizon   int64
 	writeopts *opt.WriteOptions
 	readopts  *opt.ReadOptions
+	cipher    *crypt.Cipher
+	watch     graph.Notifier
+
+	// names caches the names of node values, which never change as the
+	// values are hashes of them.
+	names *lru.Cache
+
+	// blooms, if set, filters the nodes looked for in each index.
+	blooms *blooms
+
+	// syncs decides which writes are flushed to disk.
+	syncs *graph.SyncBatcher
+
+	// sorted is whether every node and quad is listed in order.
+	sorted bool
+
+	// search is the text index of the store, if it keeps one.
+	search graph.FullTextIndexer
+
+	// readOnly is whether the database was opened with the "read_only"
+	// option, sharing its files with other processes reading them. The
+	// geohash and range indexes cannot be built then, so if they were not
+	// yet, scanNear and scanRanges make queries scan the store instead.
+	readOnly   bool
+	scanNear   bool
+	scanRanges bool
+
+	// If snapshot is set, the store is a read-only view of the quads live
+	// at the given revision.
+	snapshot bool
+	revision int64
 }
 
-func createNewLevelDB(path string, _ graph.Options) error {
+func createNewLevelDB(path string, options graph.Options) error {
+	cipher, err := crypt.FromOptions(options)
+	if err != nil {
+		return err
+	}
 	opts := &opt.Options{}
 	db, err := leveldb.OpenFile(path, opts)
 	if err != nil {
-		glog.Errorf("Error: could not create database: %v", err)
+		clog.Errorf("Error: could not create database: %v", err)
 		return err
 	}
 	defer db.Close()
 	qs := &QuadStore{}
 	qs.db = db
+	qs.cipher = cipher
 	qs.writeopts = &opt.WriteOptions{
 		Sync: true,
 	}
@@ -109,19 +148,61 @@ func newQuadStore(path string, options graph.Options) (graph.QuadStore, error) {
 		writeBufferSize = val
 	}
 	qs.dbOpts.WriteBuffer = writeBufferSize * opt.MiB
+	qs.cipher, err = crypt.FromOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if name, _, _ := options.StringKey("full_text_index"); name != "" && qs.cipher != nil {
+		return nil, crypt.ErrClearText
+	}
+	qs.names, err = lru.NameCacheFromOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	qs.sorted, _, err = options.BoolKey("sorted_iteration")
+	if err != nil {
+		return nil, err
+	}
+	qs.readOnly, _, err = options.BoolKey("read_only")
+	if err != nil {
+		return nil, err
+	}
+	qs.dbOpts.ReadOnly = qs.readOnly
+	qs.syncs, err = graph.NewSyncBatcher(options, graph.SyncNever)
+	if err != nil {
+		return nil, err
+	}
 	qs.writeopts = &opt.WriteOptions{
 		Sync: false,
 	}
 	qs.readopts = &opt.ReadOptions{}
 	db, err := leveldb.OpenFile(qs.path, qs.dbOpts)
 	if err != nil {
-		glog.Errorln("Error, could not open! ", err)
+		clog.Errorln("Error, could not open! ", err)
 		return nil, err
 	}
 	qs.db = db
-	glog.Infoln(qs.GetStats())
+	clog.Infoln(qs.GetStats())
 	err = qs.getMetadata()
 	if err != nil {
+		qs.db.Close()
+		return nil, err
+	}
+	useBlooms, bloomSize, err := bloomsFromOptions(options)
+	if err == nil && useBlooms {
+		err = qs.buildBlooms(bloomSize)
+	}
+	if err == nil {
+		err = qs.buildGeoIndex()
+	}
+	if err == nil {
+		err = qs.buildRangeIndex()
+	}
+	if err == nil {
+		qs.search, err = graph.OpenFullTextIndex(&qs, path, options)
+	}
+	if err != nil {
+		qs.db.Close()
 		return nil, err
 	}
 	return &qs, nil
@@ -141,6 +222,23 @@ func (qs *QuadStore) Size() int64 {
 	return qs.size
 }
 
+// NodeCount counts the node values the store holds, reading their keys.
+func (qs *QuadStore) NodeCount() (int64, error) {
+	it := qs.db.NewIterator(util.BytesPrefix([]byte("z")), qs.readopts)
+	defer it.Release()
+	var n int64
+	for it.Next() {
+		n++
+	}
+	return n, it.Error()
+}
+
+// Tune resizes the cache of node names to the "name_cache_size" option,
+// if it is given. A cache disabled when the store was opened stays disabled.
+func (qs *QuadStore) Tune(options graph.Options) error {
+	return qs.names.ResizeFromOptions(options)
+}
+
 func (qs *QuadStore) Horizon() graph.PrimaryKey {
 	return graph.NewSequentialKey(qs.horizon)
 }
@@ -173,9 +271,155 @@ func (qs *QuadStore) createValueKeyFor(s string) []byte {
 	return key
 }
 
+// createExpiryKeyFor returns the key of the expiry index entry for a quad.
+// Entries sort by expiry time.
+func (qs *QuadStore) createExpiryKeyFor(expires int64, q quad.Quad) []byte {
+	key := make([]byte, 9, 9+(hashSize*4))
+	key[0] = 'x'
+	binary.BigEndian.PutUint64(key[1:], uint64(expires))
+	key = append(key, qs.createKeyFor(spo, q)[2:]...)
+	return key
+}
+
+func (qs *QuadStore) ExpiredQuads(now time.Time) ([]quad.Quad, error) {
+	limit := make([]byte, 9)
+	limit[0] = 'x'
+	binary.BigEndian.PutUint64(limit[1:], uint64(now.UnixNano()+1))
+	it := qs.db.NewIterator(&util.Range{Start: []byte{'x'}, Limit: limit}, qs.readopts)
+	defer it.Release()
+	var quads []quad.Quad
+	for it.Next() {
+		var q quad.Quad
+		err := qs.unmarshal(it.Value(), &q)
+		if err != nil {
+			return nil, err
+		}
+		quads = append(quads, q)
+	}
+	return quads, it.Error()
+}
+
+// Purge permanently removes the quads deleted before the given time, with
+// the deltas that added and deleted them.
+func (qs *QuadStore) Purge(before time.Time) (int, error) {
+	if qs.snapshot {
+		return 0, graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return 0, graph.ErrReadOnly
+	}
+	it := qs.db.NewIterator(util.BytesPrefix([]byte{spo[0].Prefix(), spo[1].Prefix()}), qs.readopts)
+	defer it.Release()
+	batch := &leveldb.Batch{}
+	n := 0
+	for it.Next() {
+		var entry IndexEntry
+		err := qs.unmarshal(it.Value(), &entry)
+		if err != nil {
+			return 0, err
+		}
+		if len(entry.History) == 0 || len(entry.History)%2 == 1 {
+			continue
+		}
+		deleted, err := qs.deltaTime(entry.History[len(entry.History)-1])
+		if err != nil {
+			return 0, err
+		}
+		if !deleted.Before(before) {
+			continue
+		}
+		for _, index := range [][4]quad.Direction{spo, osp, pos, cps} {
+			if index == cps && entry.Quad.Label == "" {
+				continue
+			}
+			batch.Delete(qs.createKeyFor(index, entry.Quad))
+		}
+		for _, id := range entry.History {
+			batch.Delete([]byte(fmt.Sprintf("d%018x", id)))
+		}
+		n++
+	}
+	if err := it.Error(); err != nil || n == 0 {
+		return 0, err
+	}
+	err := qs.db.Write(batch, qs.writeopts)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// deltaTime returns the timestamp of the delta with the given ID, or the
+// zero time if it is not logged.
+func (qs *QuadStore) deltaTime(id int64) (time.Time, error) {
+	b, err := qs.db.Get([]byte(fmt.Sprintf("d%018x", id)), qs.readopts)
+	if err == leveldb.ErrNotFound {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	var d graph.Delta
+	err = qs.unmarshal(b, &d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.Timestamp, nil
+}
+
+// CollectGarbage removes the values of the nodes no index entry refers to.
+func (qs *QuadStore) CollectGarbage() (graph.GCStats, error) {
+	var stats graph.GCStats
+	if qs.snapshot {
+		return stats, graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return stats, graph.ErrReadOnly
+	}
+	it := qs.db.NewIterator(util.BytesPrefix([]byte("z")), qs.readopts)
+	defer it.Release()
+	batch := &leveldb.Batch{}
+	for it.Next() {
+		var value ValueData
+		err := qs.unmarshal(it.Value(), &value)
+		if err != nil {
+			return graph.GCStats{}, err
+		}
+		if value.Size > 0 || qs.isReferenced(value.Name) {
+			continue
+		}
+		batch.Delete(append([]byte(nil), it.Key()...))
+		stats.Nodes++
+		stats.Bytes += int64(len(it.Key()) + len(it.Value()))
+	}
+	if err := it.Error(); err != nil || stats.Nodes == 0 {
+		return graph.GCStats{}, err
+	}
+	err := qs.db.Write(batch, qs.writeopts)
+	if err != nil {
+		return graph.GCStats{}, err
+	}
+	return stats, nil
+}
+
+// isReferenced returns whether any quad, live or deleted, has the named node
+// in any direction.
+func (qs *QuadStore) isReferenced(name string) bool {
+	for _, index := range [][4]quad.Direction{spo, pos, osp, cps} {
+		prefix := append([]byte{index[0].Prefix(), index[1].Prefix()}, hashOf(name)...)
+		it := qs.db.NewIterator(util.BytesPrefix(prefix), qs.readopts)
+		found := it.Next()
+		it.Release()
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
 type IndexEntry struct {
 	quad.Quad
 	History []int64
+	Expires int64 `json:",omitempty"`
 }
 
 // Short hand for direction permutations.
@@ -187,19 +431,97 @@ var (
 )
 
 func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	return qs.ApplyDeltasSync(deltas, ignoreOpts, graph.SyncDefault)
+}
+
+// ApplyDeltasSync applies deltas like ApplyDeltas, flushing them to disk as
+// the given policy says.
+func (qs *QuadStore) ApplyDeltasSync(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts, policy graph.SyncPolicy) error {
+	if qs.snapshot {
+		return graph.ErrRevisionReadOnly
+	}
+	if qs.readOnly {
+		return graph.ErrReadOnly
+	}
+	oldHorizon := qs.horizon
+	deltas, err := qs.applyDeltas(deltas, ignoreOpts, policy)
+	if err != nil {
+		qs.horizon = oldHorizon
+		return err
+	}
+	if qs.search != nil {
+		if err := graph.IndexDeltas(qs, qs.search, deltas); err != nil {
+			clog.Errorf("leveldb: indexing text: %v", err)
+		}
+	}
+	if err := qs.indexGeo(deltas); err != nil {
+		clog.Errorf("leveldb: indexing points: %v", err)
+	}
+	if err := qs.indexValues(deltas); err != nil {
+		clog.Errorf("leveldb: indexing values: %v", err)
+	}
+	qs.watch.Notify(deltas)
+	return nil
+}
+
+// SearchIterator returns an iterator over the nodes whose names match the
+// text query, or over none if the store keeps no text index.
+func (qs *QuadStore) SearchIterator(text string) graph.Iterator {
+	if qs.search == nil {
+		return iterator.NewNull()
+	}
+	return graph.SearchIteratorOf(qs, qs.search, text)
+}
+
+func (qs *QuadStore) Subscribe(pattern quad.Quad) <-chan graph.Delta {
+	return qs.watch.Subscribe(pattern)
+}
+
+func (qs *QuadStore) Unsubscribe(c <-chan graph.Delta) {
+	qs.watch.Unsubscribe(c)
+}
+
+func (qs *QuadStore) AtRevision(horizon int64) (graph.QuadStore, error) {
+	if horizon < 0 || horizon > qs.horizon {
+		return nil, graph.ErrUnknownRevision
+	}
+	return &QuadStore{
+		dbOpts:    qs.dbOpts,
+		db:        qs.db,
+		path:      qs.path,
+		open:      qs.open,
+		size:      qs.size,
+		horizon:   horizon,
+		writeopts: qs.writeopts,
+		readopts:  qs.readopts,
+		cipher:    qs.cipher,
+		names:     qs.names,
+		blooms:    qs.blooms,
+		syncs:     qs.syncs,
+		sorted:    qs.sorted,
+		search:    qs.search,
+		snapshot:  true,
+		revision:  horizon,
+	}, nil
+}
+
+// applyDeltas writes the deltas in one batch, and returns those that changed
+// the store, leaving out those ignored.
+func (qs *QuadStore) applyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts, policy graph.SyncPolicy) ([]graph.Delta, error) {
 	batch := &leveldb.Batch{}
 	resizeMap := make(map[string]int64)
 	sizeChange := int64(0)
+	var applied []graph.Delta
 	for _, d := range deltas {
 		if d.Action != graph.Add && d.Action != graph.Delete {
-			return errors.New("leveldb: invalid action")
+			return nil, errors.New("leveldb: invalid action")
 		}
-		bytes, err := json.Marshal(d)
+		bytes, err := qs.marshal(d)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		batch.Put(keyFor(d), bytes)
-		err = qs.buildQuadWrite(batch, d.Quad, d.ID.Int(), d.Action == graph.Add)
+		err = qs.buildQuadWrite(batch, d.Quad, d.ID.Int(), d.Action == graph.Add, d.Expires)
 		if err != nil {
 			if err == graph.ErrQuadExists && ignoreOpts.IgnoreDup {
 				continue
@@ -207,11 +529,14 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 			if err == graph.ErrQuadNotExist && ignoreOpts.IgnoreMissing {
 				continue
 			}
-			return err
+			return nil, err
 		}
 		delta := int64(1)
 		if d.Action == graph.Delete {
 			delta = int64(-1)
+		} else {
+			// Added before the write, so that no reader misses the quad.
+			qs.addToBlooms(d.Quad)
 		}
 		resizeMap[d.Quad.Subject] += delta
 		resizeMap[d.Quad.Predicate] += delta
@@ -221,22 +546,74 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 		}
 		sizeChange += delta
 		qs.horizon = d.ID.Int()
+		applied = append(applied, d)
 	}
 	for k, v := range resizeMap {
 		if v != 0 {
 			err := qs.UpdateValueKeyBy(k, v, batch)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
-	err := qs.db.Write(batch, qs.writeopts)
+	wo := qs.writeopts
+	if qs.syncs.Sync(policy, len(deltas)) {
+		wo = &opt.WriteOptions{Sync: true}
+	}
+	err := qs.db.Write(batch, wo)
 	if err != nil {
-		glog.Error("could not write to DB for quadset.")
-		return err
+		clog.Error("could not write to DB for quadset.")
+		return nil, err
 	}
 	qs.size += sizeChange
-	return nil
+	return applied, nil
+}
+
+// isLiveValue reports whether an index entry is for a quad that has not been
+// deleted, as of the store's revision if it is a snapshot.
+func (qs *QuadStore) isLiveValue(val []byte) bool {
+	var entry IndexEntry
+	qs.unmarshal(val, &entry)
+	_, ok := qs.liveSince(entry.History)
+	return ok
+}
+
+// liveSince returns the ID of the delta that added the quad with the given
+// history, if it is live as of the store's revision.
+func (qs *QuadStore) liveSince(history []int64) (int64, bool) {
+	n := len(history)
+	if qs.snapshot {
+		// The history alternates additions and removals, in order.
+		n = 0
+		for _, id := range history {
+			if id > qs.revision {
+				break
+			}
+			n++
+		}
+	}
+	if n%2 == 0 {
+		return 0, false
+	}
+	return history[n-1], true
+}
+
+// marshal encodes a value to store, encrypting it if the store has a key.
+func (qs *QuadStore) marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return qs.cipher.Seal(b), nil
+}
+
+// unmarshal decodes a stored value written by marshal.
+func (qs *QuadStore) unmarshal(data []byte, v interface{}) error {
+	b, err := qs.cipher.Open(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
 }
 
 func keyFor(d graph.Delta) []byte {
@@ -246,16 +623,16 @@ func keyFor(d graph.Delta) []byte {
 	return key
 }
 
-func (qs *QuadStore) buildQuadWrite(batch *leveldb.Batch, q quad.Quad, id int64, isAdd bool) error {
+func (qs *QuadStore) buildQuadWrite(batch *leveldb.Batch, q quad.Quad, id int64, isAdd bool, expires time.Time) error {
 	var entry IndexEntry
 	data, err := qs.db.Get(qs.createKeyFor(spo, q), qs.readopts)
 	if err != nil && err != leveldb.ErrNotFound {
-		glog.Error("could not access DB to prepare index: ", err)
+		clog.Error("could not access DB to prepare index: ", err)
 		return err
 	}
 	if err == nil {
 		// We got something.
-		err = json.Unmarshal(data, &entry)
+		err = qs.unmarshal(data, &entry)
 		if err != nil {
 			return err
 		}
@@ -264,19 +641,32 @@ func (qs *QuadStore) buildQuadWrite(batch *leveldb.Batch, q quad.Quad, id int64,
 	}
 
 	if isAdd && len(entry.History)%2 == 1 {
-		glog.Errorf("attempt to add existing quad %v: %#v", entry, q)
+		clog.Errorf("attempt to add existing quad %v: %#v", entry, q)
 		return graph.ErrQuadExists
 	}
 	if !isAdd && len(entry.History)%2 == 0 {
-		glog.Error("attempt to delete non-existent quad %v: %#c", entry, q)
+		clog.Errorf("attempt to delete non-existent quad %v: %v", entry, q)
 		return graph.ErrQuadNotExist
 	}
 
 	entry.History = append(entry.History, id)
 
-	bytes, err := json.Marshal(entry)
+	if entry.Expires != 0 {
+		batch.Delete(qs.createExpiryKeyFor(entry.Expires, q))
+		entry.Expires = 0
+	}
+	if isAdd && !expires.IsZero() {
+		entry.Expires = expires.UnixNano()
+		qbytes, err := qs.marshal(q)
+		if err != nil {
+			return err
+		}
+		batch.Put(qs.createExpiryKeyFor(entry.Expires, q), qbytes)
+	}
+
+	bytes, err := qs.marshal(entry)
 	if err != nil {
-		glog.Errorf("could not write to buffer for entry %#v: %s", entry, err)
+		clog.Errorf("could not write to buffer for entry %#v: %s", entry, err)
 		return err
 	}
 	batch.Put(qs.createKeyFor(spo, q), bytes)
@@ -300,15 +690,15 @@ func (qs *QuadStore) UpdateValueKeyBy(name string, amount int64, batch *leveldb.
 
 	// Error getting the node from the database.
 	if err != nil && err != leveldb.ErrNotFound {
-		glog.Errorf("Error reading Value %s from the DB.", name)
+		clog.Errorf("Error reading Value %s from the DB.", name)
 		return err
 	}
 
 	// Node exists in the database -- unmarshal and update.
 	if b != nil && err != leveldb.ErrNotFound {
-		err = json.Unmarshal(b, value)
+		err = qs.unmarshal(b, value)
 		if err != nil {
-			glog.Errorf("Error: could not reconstruct value: %v", err)
+			clog.Errorf("Error: could not reconstruct value: %v", err)
 			return err
 		}
 		value.Size += amount
@@ -320,9 +710,9 @@ func (qs *QuadStore) UpdateValueKeyBy(name string, amount int64, batch *leveldb.
 	}
 
 	// Repackage and rewrite.
-	bytes, err := json.Marshal(&value)
+	bytes, err := qs.marshal(&value)
 	if err != nil {
-		glog.Errorf("could not write to buffer for value %s: %s", name, err)
+		clog.Errorf("could not write to buffer for value %s: %s", name, err)
 		return err
 	}
 	if batch == nil {
@@ -334,25 +724,38 @@ func (qs *QuadStore) UpdateValueKeyBy(name string, amount int64, batch *leveldb.
 }
 
 func (qs *QuadStore) Close() {
+	if qs.snapshot {
+		// The database belongs to the store the snapshot was taken from.
+		return
+	}
+	qs.watch.Close()
+	if qs.search != nil {
+		qs.search.Close()
+	}
+	if qs.readOnly {
+		qs.db.Close()
+		qs.open = false
+		return
+	}
 	buf := new(bytes.Buffer)
 	err := binary.Write(buf, binary.LittleEndian, qs.size)
 	if err == nil {
-		werr := qs.db.Put([]byte("__size"), buf.Bytes(), qs.writeopts)
+		werr := qs.db.Put([]byte("__size"), qs.cipher.Seal(buf.Bytes()), qs.writeopts)
 		if werr != nil {
-			glog.Error("could not write size before closing!")
+			clog.Error("could not write size before closing!")
 		}
 	} else {
-		glog.Errorf("could not convert size before closing!")
+		clog.Errorf("could not convert size before closing!")
 	}
 	buf.Reset()
 	err = binary.Write(buf, binary.LittleEndian, qs.horizon)
 	if err == nil {
-		werr := qs.db.Put([]byte("__horizon"), buf.Bytes(), qs.writeopts)
+		werr := qs.db.Put([]byte("__horizon"), qs.cipher.Seal(buf.Bytes()), qs.writeopts)
 		if werr != nil {
-			glog.Error("could not write horizon before closing!")
+			clog.Error("could not write horizon before closing!")
 		}
 	} else {
-		glog.Errorf("could not convert horizon before closing!")
+		clog.Errorf("could not convert horizon before closing!")
 	}
 	qs.db.Close()
 	qs.open = false
@@ -362,39 +765,76 @@ func (qs *QuadStore) Quad(k graph.Value) quad.Quad {
 	var q quad.Quad
 	b, err := qs.db.Get(k.(Token), qs.readopts)
 	if err != nil && err != leveldb.ErrNotFound {
-		glog.Error("Error: could not get quad from DB.")
+		clog.Error("Error: could not get quad from DB.")
 		return quad.Quad{}
 	}
 	if err == leveldb.ErrNotFound {
 		// No harm, no foul.
 		return quad.Quad{}
 	}
-	err = json.Unmarshal(b, &q)
+	err = qs.unmarshal(b, &q)
 	if err != nil {
-		glog.Error("Error: could not reconstruct quad.")
+		clog.Error("Error: could not reconstruct quad.")
 		return quad.Quad{}
 	}
 	return q
 }
 
+// Provenance returns the provenance recorded in the delta that added a live
+// quad.
+func (qs *QuadStore) Provenance(k graph.Value) (graph.Provenance, bool) {
+	b, err := qs.db.Get(k.(Token), qs.readopts)
+	if err != nil {
+		if err != leveldb.ErrNotFound {
+			clog.Errorf("Error: could not get quad from DB: %v", err)
+		}
+		return graph.Provenance{}, false
+	}
+	var entry IndexEntry
+	err = qs.unmarshal(b, &entry)
+	if err != nil {
+		clog.Errorf("Error: could not reconstruct quad: %v", err)
+		return graph.Provenance{}, false
+	}
+	id, ok := qs.liveSince(entry.History)
+	if !ok {
+		return graph.Provenance{}, false
+	}
+	b, err = qs.db.Get([]byte(fmt.Sprintf("d%018x", id)), qs.readopts)
+	if err != nil {
+		clog.Errorf("Error: could not get delta %d from DB: %v", id, err)
+		return graph.Provenance{}, false
+	}
+	var d graph.Delta
+	err = qs.unmarshal(b, &d)
+	if err != nil {
+		clog.Errorf("Error: could not reconstruct delta %d: %v", id, err)
+		return graph.Provenance{}, false
+	}
+	if d.Author == "" && d.Source == "" {
+		return graph.Provenance{}, false
+	}
+	return graph.Provenance{Created: d.Timestamp, Author: d.Author, Source: d.Source}, true
+}
+
 func (qs *QuadStore) ValueOf(s string) graph.Value {
 	return Token(qs.createValueKeyFor(s))
 }
 
 func (qs *QuadStore) valueData(key []byte) ValueData {
 	var out ValueData
-	if glog.V(3) {
-		glog.V(3).Infof("%c %v", key[0], key)
+	if clog.V(3) {
+		clog.V(3).Infof("%c %v", key[0], key)
 	}
 	b, err := qs.db.Get(key, qs.readopts)
 	if err != nil && err != leveldb.ErrNotFound {
-		glog.Errorln("Error: could not get value from DB")
+		clog.Errorln("Error: could not get value from DB")
 		return out
 	}
 	if b != nil && err != leveldb.ErrNotFound {
-		err = json.Unmarshal(b, &out)
+		err = qs.unmarshal(b, &out)
 		if err != nil {
-			glog.Errorln("Error: could not reconstruct value")
+			clog.Errorln("Error: could not reconstruct value")
 			return ValueData{}
 		}
 	}
@@ -403,10 +843,18 @@ func (qs *QuadStore) valueData(key []byte) ValueData {
 
 func (qs *QuadStore) NameOf(k graph.Value) string {
 	if k == nil {
-		glog.V(2).Info("k was nil")
+		clog.V(2).Info("k was nil")
 		return ""
 	}
-	return qs.valueData(k.(Token)).Name
+	key := string(k.(Token))
+	if name, ok := qs.names.Get(key); ok {
+		return name.(string)
+	}
+	name := qs.valueData(k.(Token)).Name
+	if name != "" {
+		qs.names.Put(key, name)
+	}
+	return name
 }
 
 func (qs *QuadStore) SizeOf(k graph.Value) int64 {
@@ -420,17 +868,26 @@ func (qs *QuadStore) getInt64ForKey(key string, empty int64) (int64, error) {
 	var out int64
 	b, err := qs.db.Get([]byte(key), qs.readopts)
 	if err != nil && err != leveldb.ErrNotFound {
-		glog.Errorln("could not read " + key + ": " + err.Error())
+		clog.Errorln("could not read " + key + ": " + err.Error())
 		return 0, err
 	}
 	if err == leveldb.ErrNotFound {
 		// Must be a new database. Cool
 		return empty, nil
 	}
+	b, err = qs.cipher.Open(b)
+	if err == nil && len(b) != 8 {
+		// Most likely an encrypted database opened without its key.
+		err = crypt.ErrDecrypt
+	}
+	if err != nil {
+		clog.Errorln("could not read " + key + ": " + err.Error())
+		return 0, err
+	}
 	buf := bytes.NewBuffer(b)
 	err = binary.Read(buf, binary.LittleEndian, &out)
 	if err != nil {
-		glog.Errorln("Error: could not parse", key)
+		clog.Errorln("Error: could not parse", key)
 		return 0, err
 	}
 	return out, nil
@@ -475,15 +932,26 @@ func (qs *QuadStore) QuadIterator(d quad.Direction, val graph.Value) graph.Itera
 	default:
 		panic("unreachable " + d.String())
 	}
+	if !qs.mayHave(d, val.(Token)) {
+		return iterator.NewNull()
+	}
 	return NewIterator(prefix, d, val, qs)
 }
 
 func (qs *QuadStore) NodesAllIterator() graph.Iterator {
-	return NewAllIterator("z", quad.Any, qs)
+	it := NewAllIterator("z", quad.Any, qs)
+	if qs.sorted {
+		return iterator.SortNodes(qs, it)
+	}
+	return it
 }
 
 func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
-	return NewAllIterator("po", quad.Predicate, qs)
+	it := NewAllIterator("po", quad.Predicate, qs)
+	if qs.sorted {
+		return iterator.SortQuads(qs, it)
+	}
+	return it
 }
 
 func (qs *QuadStore) QuadDirection(val graph.Value, d quad.Direction) graph.Value {
@@ -0,0 +1,127 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldb
+
+import (
+	"encoding/binary"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// The range indexes are keyed by the kinds of the values of the nodes that
+// hold numbers or times, their sort keys, and the hashes of their names. The
+// key holding rangeIndexBuilt records that the values held before the
+// indexes were kept have been added to them.
+//
+// Encrypted stores keep no indexes, as their keys would give away the
+// values.
+const (
+	rangePrefix     = 'r'
+	rangeIndexBuilt = "__range"
+)
+
+// rangeBatchSize is the number of entries written at once while building
+// the range indexes.
+const rangeBatchSize = 10000
+
+func rangeKey(kind quad.ValueKind, key uint64) []byte {
+	k := make([]byte, 10, 10+hashSize)
+	k[0] = rangePrefix
+	k[1] = byte(kind)
+	binary.BigEndian.PutUint64(k[2:], key)
+	return k
+}
+
+func createRangeKeyFor(name string) []byte {
+	return append(rangeKey(quad.SortKey(name)), hashOf(name)...)
+}
+
+// indexValues updates the range indexes once the deltas have been applied.
+func (qs *QuadStore) indexValues(deltas []graph.Delta) error {
+	if qs.cipher != nil {
+		return nil
+	}
+	added, removed := graph.ValueChanges(qs, deltas)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	batch := &leveldb.Batch{}
+	for _, name := range added {
+		batch.Put(createRangeKeyFor(name), nil)
+	}
+	for _, name := range removed {
+		batch.Delete(createRangeKeyFor(name))
+	}
+	return qs.db.Write(batch, qs.writeopts)
+}
+
+// buildRangeIndex adds the values the store holds to the range indexes,
+// unless it has been done already.
+func (qs *QuadStore) buildRangeIndex() error {
+	if qs.cipher != nil {
+		return nil
+	}
+	_, err := qs.db.Get([]byte(rangeIndexBuilt), qs.readopts)
+	if err != leveldb.ErrNotFound {
+		return err
+	}
+	if qs.readOnly {
+		clog.Warningln("The range indexes are not built; queries over ranges scan the store until it is opened writable")
+		qs.scanRanges = true
+		return nil
+	}
+	if qs.size > 0 {
+		clog.Infof("Building the range indexes of %d quads", qs.size)
+	}
+	batch := &leveldb.Batch{}
+	err = graph.ValueObjects(qs, func(name string, kind quad.ValueKind, key uint64) error {
+		batch.Put(append(rangeKey(kind, key), hashOf(name)...), nil)
+		if batch.Len() < rangeBatchSize {
+			return nil
+		}
+		err := qs.db.Write(batch, qs.writeopts)
+		batch.Reset()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(rangeIndexBuilt), nil)
+	return qs.db.Write(batch, qs.writeopts)
+}
+
+func (qs *QuadStore) ValueRangeIterator(r quad.ValueRange) graph.Iterator {
+	if qs.cipher != nil || qs.scanRanges {
+		return graph.ScanValueRange(qs, r)
+	}
+	fixed := qs.FixedIterator()
+	if r.From > r.To {
+		return fixed
+	}
+	it := qs.db.NewIterator(util.BytesPrefix(rangeKey(r.Kind, 0)[:2]), qs.readopts)
+	defer it.Release()
+	for ok := it.Seek(rangeKey(r.Kind, r.From)); ok; ok = it.Next() {
+		if binary.BigEndian.Uint64(it.Key()[2:10]) > r.To {
+			break
+		}
+		fixed.Add(Token(append([]byte("z"), it.Key()[10:]...)))
+	}
+	return fixed
+}
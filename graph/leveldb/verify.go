@@ -0,0 +1,223 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// Verify checks the osp, pos and cps indexes and the node values against
+// the spo index, which holds the primary record of each quad, and the size
+// of the store against the number of live quads. With repair, the entries
+// of the secondary indexes are rewritten from their spo entry, orphaned ones
+// are removed, and node sizes are recounted.
+//
+// Entries of the spo index that cannot be decoded, or that do not match the
+// quad they hold, are reported but cannot be repaired.
+func (qs *QuadStore) Verify(repair bool) (graph.VerifyReport, error) {
+	var rep graph.VerifyReport
+	if qs.snapshot {
+		return rep, graph.ErrRevisionReadOnly
+	}
+	if repair && qs.readOnly {
+		return rep, graph.ErrReadOnly
+	}
+	batch := &leveldb.Batch{}
+	problem := func(fixed bool, format string, args ...interface{}) {
+		rep.Problems = append(rep.Problems, fmt.Sprintf(format, args...))
+		if fixed && repair {
+			rep.Repaired++
+		}
+	}
+
+	sizes := make(map[string]int64)
+	var live int64
+	it := qs.db.NewIterator(util.BytesPrefix(indexPrefix(spo)), qs.readopts)
+	for it.Next() {
+		rep.Quads++
+		var entry IndexEntry
+		err := qs.unmarshal(it.Value(), &entry)
+		if err != nil {
+			problem(false, "spo entry %x cannot be decoded: %v", it.Key(), err)
+			continue
+		}
+		if !bytes.Equal(it.Key(), qs.createKeyFor(spo, entry.Quad)) {
+			problem(false, "spo entry %x does not match its quad %v", it.Key(), entry.Quad)
+			continue
+		}
+		for _, index := range [][4]quad.Direction{osp, pos, cps} {
+			if index == cps && entry.Quad.Label == "" {
+				continue
+			}
+			key := qs.createKeyFor(index, entry.Quad)
+			ok, err := qs.hasEntry(key, entry)
+			if err != nil {
+				it.Release()
+				return rep, err
+			}
+			if !ok {
+				problem(true, "%s entry for quad %v is missing or stale", indexName(index), entry.Quad)
+				batch.Put(key, append([]byte(nil), it.Value()...))
+			}
+		}
+		if _, ok := qs.liveSince(entry.History); ok {
+			live++
+			sizes[entry.Quad.Subject]++
+			sizes[entry.Quad.Predicate]++
+			sizes[entry.Quad.Object]++
+			if entry.Quad.Label != "" {
+				sizes[entry.Quad.Label]++
+			}
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return rep, err
+	}
+
+	for _, index := range [][4]quad.Direction{osp, pos, cps} {
+		it := qs.db.NewIterator(util.BytesPrefix(indexPrefix(index)), qs.readopts)
+		for it.Next() {
+			_, err := qs.db.Get(spoKeyOf(index, it.Key()), qs.readopts)
+			if err == leveldb.ErrNotFound {
+				problem(true, "%s entry %x has no spo entry", indexName(index), it.Key())
+				batch.Delete(append([]byte(nil), it.Key()...))
+			} else if err != nil {
+				it.Release()
+				return rep, err
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return rep, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	it = qs.db.NewIterator(util.BytesPrefix([]byte("z")), qs.readopts)
+	for it.Next() {
+		var value ValueData
+		err := qs.unmarshal(it.Value(), &value)
+		if err != nil {
+			problem(false, "node value %x cannot be decoded: %v", it.Key(), err)
+			continue
+		}
+		if !bytes.Equal(it.Key(), qs.createValueKeyFor(value.Name)) {
+			problem(false, "node value %x does not match its name %q", it.Key(), value.Name)
+			continue
+		}
+		seen[value.Name] = true
+		if n := sizes[value.Name]; value.Size != n {
+			problem(true, "node %q has size %d, but %d live quads", value.Name, value.Size, n)
+			err = qs.putValue(batch, value.Name, n)
+			if err != nil {
+				it.Release()
+				return rep, err
+			}
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return rep, err
+	}
+	for name, n := range sizes {
+		if seen[name] {
+			continue
+		}
+		problem(true, "node %q of %d live quads has no value", name, n)
+		err := qs.putValue(batch, name, n)
+		if err != nil {
+			return rep, err
+		}
+	}
+
+	if live != qs.size {
+		problem(true, "store has size %d, but %d live quads", qs.size, live)
+	}
+	if !repair || rep.Repaired == 0 {
+		return rep, nil
+	}
+	err := qs.db.Write(batch, qs.writeopts)
+	if err != nil {
+		return rep, err
+	}
+	// The size is written with the horizon as the store is closed.
+	qs.size = live
+	return rep, nil
+}
+
+// hasEntry returns whether the index entry at key holds the same history as
+// the given spo entry.
+func (qs *QuadStore) hasEntry(key []byte, want IndexEntry) (bool, error) {
+	b, err := qs.db.Get(key, qs.readopts)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var entry IndexEntry
+	if qs.unmarshal(b, &entry) != nil {
+		return false, nil
+	}
+	if entry.Quad != want.Quad || entry.Expires != want.Expires || len(entry.History) != len(want.History) {
+		return false, nil
+	}
+	for i, id := range entry.History {
+		if want.History[i] != id {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// putValue adds the write of a node value of the given size to batch.
+func (qs *QuadStore) putValue(batch *leveldb.Batch, name string, size int64) error {
+	b, err := qs.marshal(&ValueData{Name: name, Size: size})
+	if err != nil {
+		return err
+	}
+	batch.Put(qs.createValueKeyFor(name), b)
+	return nil
+}
+
+func indexPrefix(index [4]quad.Direction) []byte {
+	return []byte{index[0].Prefix(), index[1].Prefix()}
+}
+
+func indexName(index [4]quad.Direction) string {
+	return string([]byte{index[0].Prefix(), index[1].Prefix(), index[2].Prefix()})
+}
+
+// spoKeyOf returns the key of the spo entry for the quad of an entry of
+// another index, by reordering the hashes of its key.
+func spoKeyOf(index [4]quad.Direction, key []byte) []byte {
+	hashes := key[2:]
+	spoKey := indexPrefix(spo)
+	for _, d := range spo {
+		for i, id := range index {
+			if id == d && len(hashes) >= (i+1)*hashSize {
+				spoKey = append(spoKey, hashes[i*hashSize:(i+1)*hashSize]...)
+			}
+		}
+	}
+	return spoKey
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/google/cayley/quad"
+
+// Matches returns whether q is equal to pattern in each of the non-empty
+// fields of pattern.
+func Matches(pattern, q quad.Quad) bool {
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		if v := pattern.Get(d); v != "" && v != q.Get(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchingQuads returns the quads in qs equal to pattern in each of its
+// non-empty fields. The lookup is pushed down to the store if it is a
+// QuadMatcher; otherwise the quads are read from the smallest index for
+// the fields given, or from every quad if pattern is empty.
+func MatchingQuads(qs QuadStore, pattern quad.Quad) ([]quad.Quad, error) {
+	if m, ok := qs.(QuadMatcher); ok {
+		return m.MatchingQuads(pattern)
+	}
+	var quads []quad.Quad
+	err := EachMatchingQuad(qs, pattern, func(q quad.Quad) error {
+		quads = append(quads, q)
+		return nil
+	})
+	return quads, err
+}
+
+// EachMatchingQuad calls fn with each of the quads in qs matching pattern, as
+// MatchingQuads returns them, without holding them all in memory unless the
+// store is a QuadMatcher. It stops at the first error returned by fn.
+func EachMatchingQuad(qs QuadStore, pattern quad.Quad, fn func(quad.Quad) error) error {
+	if m, ok := qs.(QuadMatcher); ok {
+		quads, err := m.MatchingQuads(pattern)
+		if err != nil {
+			return err
+		}
+		for _, q := range quads {
+			if err := fn(q); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var best Iterator
+	var bestSize int64
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		v := pattern.Get(d)
+		if v == "" {
+			continue
+		}
+		val := qs.ValueOf(v)
+		if val == nil {
+			// An unknown node matches nothing.
+			if best != nil {
+				best.Close()
+			}
+			return nil
+		}
+		it := qs.QuadIterator(d, val)
+		size, _ := it.Size()
+		if best == nil || size < bestSize {
+			if best != nil {
+				best.Close()
+			}
+			best, bestSize = it, size
+		} else {
+			it.Close()
+		}
+	}
+	if best == nil {
+		best = qs.QuadsAllIterator()
+	}
+	defer best.Close()
+	for Next(best) {
+		if q := qs.Quad(best.Result()); Matches(pattern, q) {
+			if err := fn(q); err != nil {
+				return err
+			}
+		}
+	}
+	return best.Err()
+}
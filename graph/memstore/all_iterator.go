@@ -19,9 +19,11 @@ import (
 	"github.com/google/cayley/graph/iterator"
 )
 
+// AllIterator lists the nodes or quads of a version of the store, by their
+// IDs.
 type AllIterator struct {
 	iterator.Int64
-	qs *QuadStore
+	v *version
 }
 
 type (
@@ -31,8 +33,8 @@ type (
 
 func newNodesAllIterator(qs *QuadStore) *nodesAllIterator {
 	var out nodesAllIterator
-	out.Int64 = *iterator.NewInt64(1, qs.nextID-1)
-	out.qs = qs
+	out.v = qs.version()
+	out.Int64 = *iterator.NewInt64(1, int64(len(out.v.names))-1)
 	return &out
 }
 
@@ -42,14 +44,12 @@ func (it *nodesAllIterator) SubIterators() []graph.Iterator {
 }
 
 func (it *nodesAllIterator) Next() bool {
-	if !it.Int64.Next() {
-		return false
-	}
-	_, ok := it.qs.revIDMap[it.Int64.Result().(int64)]
-	if !ok {
-		return it.Next()
+	for it.Int64.Next() {
+		if it.v.names[it.Int64.Result().(int64)] != "" {
+			return true
+		}
 	}
-	return true
+	return false
 }
 
 func (it *nodesAllIterator) Err() error {
@@ -58,20 +58,18 @@ func (it *nodesAllIterator) Err() error {
 
 func newQuadsAllIterator(qs *QuadStore) *quadsAllIterator {
 	var out quadsAllIterator
-	out.Int64 = *iterator.NewInt64(1, qs.nextQuadID-1)
-	out.qs = qs
+	out.v = qs.version()
+	out.Int64 = *iterator.NewInt64(1, int64(len(out.v.log))-1)
 	return &out
 }
 
 func (it *quadsAllIterator) Next() bool {
-	out := it.Int64.Next()
-	if out {
-		i64 := it.Int64.Result().(int64)
-		if it.qs.log[i64].DeletedBy != 0 || it.qs.log[i64].Action == graph.Delete {
-			return it.Next()
+	for it.Int64.Next() {
+		if it.v.isLive(it.Int64.Result().(int64)) {
+			return true
 		}
 	}
-	return out
+	return false
 }
 
 var _ graph.Nexter = &nodesAllIterator{}
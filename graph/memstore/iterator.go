@@ -15,39 +15,35 @@
 package memstore
 
 import (
-	"io"
 	"math"
+	"sort"
 
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
-	"github.com/google/cayley/graph/memstore/b"
 )
 
+// Iterator lists the quads of a node in a direction, from the index of a
+// version of the store, so that it is not changed by the writes made while it
+// is read.
 type Iterator struct {
 	uid    uint64
-	qs     *QuadStore
+	v      *version
 	tags   graph.Tagger
-	tree   *b.Tree
-	iter   *b.Enumerator
+	list   []int64
+	offset int
 	data   string
 	result graph.Value
-	err    error
 }
 
 func cmp(a, b int64) int {
 	return int(a - b)
 }
 
-func NewIterator(tree *b.Tree, data string, qs *QuadStore) *Iterator {
-	iter, err := tree.SeekFirst()
-	if err != nil {
-		iter = nil
-	}
+func newIterator(v *version, list []int64, data string) *Iterator {
 	return &Iterator{
 		uid:  iterator.NextUID(),
-		qs:   qs,
-		tree: tree,
-		iter: iter,
+		v:    v,
+		list: list,
 		data: data,
 	}
 }
@@ -57,11 +53,8 @@ func (it *Iterator) UID() uint64 {
 }
 
 func (it *Iterator) Reset() {
-	var err error
-	it.iter, err = it.tree.SeekFirst()
-	if err != nil {
-		it.iter = nil
-	}
+	it.offset = 0
+	it.result = nil
 }
 
 func (it *Iterator) Tagger() *graph.Tagger {
@@ -79,30 +72,10 @@ func (it *Iterator) TagResults(dst map[string]graph.Value) {
 }
 
 func (it *Iterator) Clone() graph.Iterator {
-	var iter *b.Enumerator
-	if it.result != nil {
-		var ok bool
-		iter, ok = it.tree.Seek(it.result.(int64))
-		if !ok {
-			panic("value unexpectedly missing")
-		}
-	} else {
-		var err error
-		iter, err = it.tree.SeekFirst()
-		if err != nil {
-			iter = nil
-		}
-	}
-
-	m := &Iterator{
-		uid:  iterator.NextUID(),
-		qs:   it.qs,
-		tree: it.tree,
-		iter: iter,
-		data: it.data,
-	}
+	m := newIterator(it.v, it.list, it.data)
+	m.offset = it.offset
+	m.result = it.result
 	m.tags.CopyFrom(it)
-
 	return m
 }
 
@@ -110,32 +83,21 @@ func (it *Iterator) Close() error {
 	return nil
 }
 
-func (it *Iterator) checkValid(index int64) bool {
-	return it.qs.log[index].DeletedBy == 0
-}
-
 func (it *Iterator) Next() bool {
 	graph.NextLogIn(it)
-
-	if it.iter == nil {
-		return graph.NextLogOut(it, nil, false)
-	}
-	result, _, err := it.iter.Next()
-	if err != nil {
-		if err != io.EOF {
-			it.err = err
+	for it.offset < len(it.list) {
+		id := it.list[it.offset]
+		it.offset++
+		if it.v.isLive(id) {
+			it.result = id
+			return graph.NextLogOut(it, it.result, true)
 		}
-		return graph.NextLogOut(it, nil, false)
-	}
-	if !it.checkValid(result) {
-		return it.Next()
 	}
-	it.result = result
-	return graph.NextLogOut(it, it.result, true)
+	return graph.NextLogOut(it, nil, false)
 }
 
 func (it *Iterator) Err() error {
-	return it.err
+	return nil
 }
 
 func (it *Iterator) Result() graph.Value {
@@ -152,12 +114,14 @@ func (it *Iterator) SubIterators() []graph.Iterator {
 }
 
 func (it *Iterator) Size() (int64, bool) {
-	return int64(it.tree.Len()), true
+	return int64(len(it.list)), true
 }
 
 func (it *Iterator) Contains(v graph.Value) bool {
 	graph.ContainsLogIn(it, v)
-	if _, ok := it.tree.Get(v.(int64)); ok {
+	id := v.(int64)
+	i := sort.Search(len(it.list), func(i int) bool { return it.list[i] >= id })
+	if i < len(it.list) && it.list[i] == id && it.v.isLive(id) {
 		it.result = v
 		return graph.ContainsLogOut(it, v, true)
 	}
@@ -178,7 +142,7 @@ func (it *Iterator) Describe() graph.Description {
 var memType graph.Type
 
 func init() {
-	memType = graph.RegisterIterator("b+tree")
+	memType = graph.RegisterIterator("memstore")
 }
 
 func Type() graph.Type { return memType }
@@ -192,10 +156,11 @@ func (it *Iterator) Optimize() (graph.Iterator, bool) {
 }
 
 func (it *Iterator) Stats() graph.IteratorStats {
+	size, _ := it.Size()
 	return graph.IteratorStats{
-		ContainsCost: int64(math.Log(float64(it.tree.Len()))) + 1,
+		ContainsCost: int64(math.Log(float64(size))) + 1,
 		NextCost:     1,
-		Size:         int64(it.tree.Len()),
+		Size:         size,
 	}
 }
 
@@ -0,0 +1,204 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memstore
+
+// Defines the limits on the size of the store, and how they are kept.
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+const (
+	// EvictReject rejects the writes that would take the store over its
+	// limits.
+	EvictReject = "reject"
+
+	// EvictLRU deletes the quads of the least recently used labels to
+	// make room for a write.
+	EvictLRU = "lru"
+)
+
+// quadOverhead estimates the memory a quad takes, beside its values: its
+// log entry and its four index entries.
+const quadOverhead = 176
+
+// quadBytes estimates the memory a quad takes.
+func quadBytes(q quad.Quad) int64 {
+	return quadOverhead + int64(len(q.Subject)+len(q.Predicate)+len(q.Object)+len(q.Label))
+}
+
+// limits are the limits on the size of the store. A limit of zero is
+// unlimited.
+type limits struct {
+	maxQuads int64
+	maxBytes int64
+	evict    string
+
+	// labels lists the labels of the quads held, most recently used
+	// first, if quads are evicted by label.
+	mu     sync.Mutex
+	labels *list.List
+	used   map[string]*list.Element
+}
+
+// limitsFromOptions returns the limits given by the "max_quads",
+// "max_memory_mb" and "eviction" options.
+func limitsFromOptions(opts graph.Options) (*limits, error) {
+	l := &limits{evict: EvictReject}
+	n, _, err := opts.IntKey("max_quads")
+	if err != nil {
+		return nil, err
+	}
+	l.maxQuads = int64(n)
+	n, _, err = opts.IntKey("max_memory_mb")
+	if err != nil {
+		return nil, err
+	}
+	l.maxBytes = int64(n) << 20
+	if s, ok, err := opts.StringKey("eviction"); err != nil {
+		return nil, err
+	} else if ok {
+		l.evict = s
+	}
+	switch l.evict {
+	case EvictReject:
+	case EvictLRU:
+		l.labels = list.New()
+		l.used = make(map[string]*list.Element)
+	default:
+		return nil, fmt.Errorf("memstore: unknown eviction policy %q", l.evict)
+	}
+	return l, nil
+}
+
+// within returns whether a version of the store is within the limits.
+func (l *limits) within(v *version) bool {
+	return l.fits(v.size, v.bytes)
+}
+
+// fits returns whether a store of the given size is within the limits.
+func (l *limits) fits(size, bytes int64) bool {
+	return (l.maxQuads <= 0 || size <= l.maxQuads) &&
+		(l.maxBytes <= 0 || bytes <= l.maxBytes)
+}
+
+// use records that a label was used, if quads are evicted by label. Quads
+// without a label are never evicted.
+func (l *limits) use(label string) {
+	if l == nil || l.labels == nil || label == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.used[label]; ok {
+		l.labels.MoveToFront(e)
+		return
+	}
+	l.used[label] = l.labels.PushFront(label)
+}
+
+// victims returns the live quads of the least recently used labels to delete
+// for the deltas to be applied to a version within the limits, but for those
+// of the labels of the deltas. It returns none if the deltas fit, or if
+// deleting all the quads it could does not make room.
+func (l *limits) victims(v *version, deltas []graph.Delta) []quad.Quad {
+	size, bytes := v.size, v.bytes
+	writing := make(map[string]bool)
+	for i := range deltas {
+		d := &deltas[i]
+		writing[d.Quad.Label] = true
+		switch d.Action {
+		case graph.Add:
+			size++
+			bytes += quadBytes(d.Quad)
+		case graph.Delete:
+			size--
+			bytes -= quadBytes(d.Quad)
+		}
+	}
+	if l.fits(size, bytes) {
+		return nil
+	}
+	l.mu.Lock()
+	var labels []string
+	for e := l.labels.Back(); e != nil; e = e.Prev() {
+		if label := e.Value.(string); !writing[label] {
+			labels = append(labels, label)
+		}
+	}
+	l.mu.Unlock()
+
+	var quads []quad.Quad
+	for _, label := range labels {
+		if l.fits(size, bytes) {
+			break
+		}
+		id, ok := v.id(label)
+		if !ok {
+			continue
+		}
+		for _, qid := range v.list(quad.Label, id) {
+			if !v.isLive(qid) {
+				continue
+			}
+			q := v.log[qid].Quad
+			quads = append(quads, q)
+			size--
+			bytes -= quadBytes(q)
+		}
+	}
+	if !l.fits(size, bytes) {
+		return nil
+	}
+	return quads
+}
+
+// forget forgets the labels left without quads by the deletions of deltas,
+// once they are applied to a version.
+func (l *limits) forget(v *version, deltas []graph.Delta) {
+	if l.labels == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range deltas {
+		label := deltas[i].Quad.Label
+		e, ok := l.used[label]
+		if deltas[i].Action != graph.Delete || !ok {
+			continue
+		}
+		if id, ok := v.id(label); ok && hasLive(v, v.list(quad.Label, id)) {
+			continue
+		}
+		l.labels.Remove(e)
+		delete(l.used, label)
+	}
+}
+
+// hasLive returns whether any of the quads at the given indexes is live in a
+// version.
+func hasLive(v *version, list []int64) bool {
+	for _, qid := range list {
+		if v.isLive(qid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memstore
+
+// Defines nameMap, the map of the names of nodes to their IDs that the
+// versions of the store share.
+
+// edit identifies the change that makes a version of the store. The parts of
+// the version it made may be changed in place until it is published, and
+// those of the versions before it are copied as they are first changed.
+type edit struct {
+	_ byte // Pointers to distinct zero-size values may be equal.
+}
+
+// nameMap is a persistent map from the names of nodes to their IDs: a hash
+// array mapped trie, whose nodes are shared between versions.
+type nameMap struct {
+	root *nameNode
+	n    int
+}
+
+const (
+	nameBits = 5
+	nameMask = 1<<nameBits - 1
+)
+
+// nameNode is a node of a nameMap. Its entries are those of the bits of its
+// bitmap, in order, except below the depth at which the hashes are
+// exhausted, where its entries are the names whose hashes collide.
+type nameNode struct {
+	owner   *edit
+	bitmap  uint32
+	entries []nameEntry
+}
+
+// nameEntry is either a name and its ID, or the subtrie of the names sharing
+// the bits of the hash above it.
+type nameEntry struct {
+	sub  *nameNode
+	hash uint64
+	name string
+	id   int64
+}
+
+// hashName returns the 64-bit FNV-1a hash of a name.
+func hashName(name string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(name); i++ {
+		h ^= uint64(name[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func popcount(x uint32) int {
+	x = x - (x>>1)&0x55555555
+	x = x&0x33333333 + (x>>2)&0x33333333
+	return int(((x + x>>4) & 0x0f0f0f0f * 0x01010101) >> 24)
+}
+
+// get returns the ID of a name, and whether the map holds it.
+func (m nameMap) get(name string) (int64, bool) {
+	h := hashName(name)
+	n := m.root
+	for shift := uint(0); n != nil; shift += nameBits {
+		if shift >= 64 {
+			for _, e := range n.entries {
+				if e.name == name {
+					return e.id, true
+				}
+			}
+			return 0, false
+		}
+		bit := uint32(1) << (h >> shift & nameMask)
+		if n.bitmap&bit == 0 {
+			return 0, false
+		}
+		e := &n.entries[popcount(n.bitmap&(bit-1))]
+		if e.sub != nil {
+			n = e.sub
+			continue
+		}
+		if e.name == name {
+			return e.id, true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// set maps a name to an ID, as part of the given edit.
+func (m *nameMap) set(ed *edit, name string, id int64) {
+	var added bool
+	m.root = m.root.set(ed, 0, nameEntry{hash: hashName(name), name: name, id: id}, &added)
+	if added {
+		m.n++
+	}
+}
+
+// delete removes a name, as part of the given edit.
+func (m *nameMap) delete(ed *edit, name string) {
+	var removed bool
+	m.root = m.root.delete(ed, 0, hashName(name), name, &removed)
+	if removed {
+		m.n--
+	}
+}
+
+// own returns the node if the edit owns it, and otherwise a copy it owns.
+func (n *nameNode) own(ed *edit) *nameNode {
+	if n.owner == ed {
+		return n
+	}
+	entries := make([]nameEntry, len(n.entries), len(n.entries)+1)
+	copy(entries, n.entries)
+	return &nameNode{owner: ed, bitmap: n.bitmap, entries: entries}
+}
+
+func (n *nameNode) set(ed *edit, shift uint, e nameEntry, added *bool) *nameNode {
+	if n == nil {
+		n = &nameNode{owner: ed}
+	} else {
+		n = n.own(ed)
+	}
+	if shift >= 64 {
+		for i := range n.entries {
+			if n.entries[i].name == e.name {
+				n.entries[i].id = e.id
+				return n
+			}
+		}
+		n.entries = append(n.entries, e)
+		*added = true
+		return n
+	}
+	bit := uint32(1) << (e.hash >> shift & nameMask)
+	i := popcount(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		n.entries = append(n.entries, nameEntry{})
+		copy(n.entries[i+1:], n.entries[i:])
+		n.entries[i] = e
+		n.bitmap |= bit
+		*added = true
+		return n
+	}
+	cur := &n.entries[i]
+	switch {
+	case cur.sub != nil:
+		cur.sub = cur.sub.set(ed, shift+nameBits, e, added)
+	case cur.name == e.name:
+		cur.id = e.id
+	default:
+		// Both names share the bits so far, so they move down a level.
+		var sub *nameNode
+		sub = sub.set(ed, shift+nameBits, *cur, added)
+		sub = sub.set(ed, shift+nameBits, e, added)
+		*cur = nameEntry{sub: sub}
+	}
+	return n
+}
+
+func (n *nameNode) delete(ed *edit, shift uint, h uint64, name string, removed *bool) *nameNode {
+	if n == nil {
+		return nil
+	}
+	var i int
+	if shift >= 64 {
+		i = -1
+		for j := range n.entries {
+			if n.entries[j].name == name {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return n
+		}
+		*removed = true
+		n = n.own(ed)
+	} else {
+		bit := uint32(1) << (h >> shift & nameMask)
+		if n.bitmap&bit == 0 {
+			return n
+		}
+		i = popcount(n.bitmap & (bit - 1))
+		cur := &n.entries[i]
+		if cur.sub != nil {
+			sub := cur.sub.delete(ed, shift+nameBits, h, name, removed)
+			if sub == cur.sub {
+				return n
+			}
+			n = n.own(ed)
+			if sub != nil {
+				n.entries[i].sub = sub
+				return n
+			}
+		} else if cur.name != name {
+			return n
+		} else {
+			*removed = true
+			n = n.own(ed)
+		}
+		n.bitmap &^= bit
+	}
+	n.entries = append(n.entries[:i], n.entries[i+1:]...)
+	if len(n.entries) == 0 {
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNameMap(t *testing.T) {
+	var m nameMap
+	ed := new(edit)
+	for i := 0; i < 1000; i++ {
+		m.set(ed, fmt.Sprint("node", i), int64(i))
+	}
+	old := m
+	ed = new(edit)
+	for i := 1000; i < 2000; i++ {
+		m.set(ed, fmt.Sprint("node", i), int64(i))
+	}
+	for i := 0; i < 2000; i += 2 {
+		m.delete(ed, fmt.Sprint("node", i))
+	}
+	if m.n != 1000 || old.n != 1000 {
+		t.Errorf("Unexpected number of names, got:%d and %d expect:1000 and 1000", m.n, old.n)
+	}
+	for i := 0; i < 2000; i++ {
+		name := fmt.Sprint("node", i)
+		id, ok := m.get(name)
+		if ok != (i%2 == 1) || ok && id != int64(i) {
+			t.Errorf("Unexpected ID of %q, got:%d,%t", name, id, ok)
+		}
+		id, ok = old.get(name)
+		if ok != (i < 1000) || ok && id != int64(i) {
+			t.Errorf("Unexpected ID of %q in the earlier map, got:%d,%t", name, id, ok)
+		}
+	}
+}
@@ -17,10 +17,11 @@ package memstore
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/graph/memstore/b"
@@ -30,231 +31,514 @@ import (
 const QuadStoreType = "memstore"
 
 func init() {
-	graph.RegisterQuadStore(QuadStoreType, false, func(string, graph.Options) (graph.QuadStore, error) {
-		return newQuadStore(), nil
+	graph.RegisterQuadStore(QuadStoreType, false, func(_ string, opts graph.Options) (graph.QuadStore, error) {
+		qs := newQuadStore()
+		var err error
+		qs.multiset, _, err = opts.BoolKey("multiset")
+		if err != nil {
+			return nil, err
+		}
+		qs.sorted, _, err = opts.BoolKey("sorted_iteration")
+		if err != nil {
+			return nil, err
+		}
+		qs.limits, err = limitsFromOptions(opts)
+		if err != nil {
+			return nil, err
+		}
+		qs.search, err = graph.OpenFullTextIndex(qs, "", opts)
+		if err != nil {
+			return nil, err
+		}
+		return qs, nil
 	}, nil, nil)
 }
 
-type QuadDirectionIndex struct {
-	index [4]map[int64]*b.Tree
-}
-
-func NewQuadDirectionIndex() QuadDirectionIndex {
-	return QuadDirectionIndex{[...]map[int64]*b.Tree{
-		quad.Subject - 1:   make(map[int64]*b.Tree),
-		quad.Predicate - 1: make(map[int64]*b.Tree),
-		quad.Object - 1:    make(map[int64]*b.Tree),
-		quad.Label - 1:     make(map[int64]*b.Tree),
-	}}
-}
-
-func (qdi QuadDirectionIndex) Tree(d quad.Direction, id int64) *b.Tree {
-	if d < quad.Subject || d > quad.Label {
-		panic("illegal direction")
-	}
-	tree, ok := qdi.index[d-1][id]
-	if !ok {
-		tree = b.TreeNew(cmp)
-		qdi.index[d-1][id] = tree
-	}
-	return tree
-}
-
-func (qdi QuadDirectionIndex) Get(d quad.Direction, id int64) (*b.Tree, bool) {
-	if d < quad.Subject || d > quad.Label {
-		panic("illegal direction")
-	}
-	tree, ok := qdi.index[d-1][id]
-	return tree, ok
-}
-
 type LogEntry struct {
 	ID        int64
 	Quad      quad.Quad
 	Action    graph.Procedure
 	Timestamp time.Time
+
+	// DeletedBy is the index of the entry deleting the quad, if it was
+	// deleted. It is set atomically, as versions of the store sharing the
+	// entry may read it.
 	DeletedBy int64
+
+	// Author and Source are the provenance of an added quad.
+	Author string
+	Source string
 }
 
 type QuadStore struct {
-	nextID     int64
-	nextQuadID int64
-	idMap      map[string]int64
-	revIDMap   map[int64]string
-	log        []LogEntry
-	size       int64
-	index      QuadDirectionIndex
-	// vip_index map[string]map[int64]map[string]map[int64]*b.Tree
+	// mu serializes the writers of the store, and guards expiry. Readers
+	// do not take it: they read the version published last, which writers
+	// copy rather than change, so that an iterator reads the store as it
+	// was when the iterator was built, while writes go on.
+	mu      *sync.Mutex
+	current *atomic.Value
+	expiry  map[int64]time.Time
+	watch   graph.Notifier
+
+	// If snap is set, the store is a read-only view of that version.
+	snap *version
+
+	// multiset is whether the store holds a copy of a quad for each time
+	// it is added.
+	multiset bool
+
+	// sorted is whether every node and quad is listed in order.
+	sorted bool
+
+	// limits are the limits on the size of the store, if it has any.
+	limits *limits
+
+	// search is the text index of the store, if it keeps one.
+	search graph.FullTextIndexer
+
+	// geo holds the geohashes of the nodes that are geographic points, and
+	// geoNodes the names of the points with each of them. They are not
+	// versioned, but guarded by geoMu.
+	geoMu    *sync.RWMutex
+	geo      *b.Tree
+	geoNodes map[int64]map[string]struct{}
 }
 
 func newQuadStore() *QuadStore {
-	return &QuadStore{
-		idMap:    make(map[string]int64),
-		revIDMap: make(map[int64]string),
-
-		// Sentinel null entry so indices start at 1
-		log: make([]LogEntry, 1, 200),
+	qs := &QuadStore{
+		mu:       new(sync.Mutex),
+		current:  new(atomic.Value),
+		expiry:   make(map[int64]time.Time),
+		geoMu:    new(sync.RWMutex),
+		geo:      b.TreeNew(cmp),
+		geoNodes: make(map[int64]map[string]struct{}),
+	}
+	qs.current.Store(newVersion())
+	return qs
+}
 
-		index:      NewQuadDirectionIndex(),
-		nextID:     1,
-		nextQuadID: 1,
+// version returns the version of the store that reads see.
+func (qs *QuadStore) version() *version {
+	if qs.snap != nil {
+		return qs.snap
 	}
+	return qs.current.Load().(*version)
 }
 
 func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
-	for _, d := range deltas {
-		var err error
+	if qs.snap != nil {
+		return graph.ErrRevisionReadOnly
+	}
+	deltas, err := qs.applyDeltas(deltas, ignoreOpts)
+	if err != nil {
+		return err
+	}
+	if qs.search != nil {
+		if err := graph.IndexDeltas(qs, qs.search, deltas); err != nil {
+			clog.Errorf("memstore: indexing text: %v", err)
+		}
+	}
+	qs.indexGeo(deltas)
+	qs.watch.Notify(deltas)
+	return nil
+}
+
+// applyDeltas applies the deltas to a new version of the store, and publishes
+// it once they all are, if it is within the limits of the store. It returns
+// the deltas that changed the store, leaving out those ignored.
+func (qs *QuadStore) applyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) ([]graph.Delta, error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	v := qs.version()
+	// Check every delta before applying any, so that a batch is applied
+	// either completely or not at all.
+	copies := make(map[quad.Quad]int64)
+	for i := range deltas {
+		d := &deltas[i]
+		live, ok := copies[d.Quad]
+		if !ok {
+			live = v.quadCount(d.Quad)
+		}
 		switch d.Action {
 		case graph.Add:
-			err = qs.AddDelta(d)
-			if err != nil && ignoreOpts.IgnoreDup {
-				err = nil
+			if qs.multiset {
+				copies[d.Quad] = live + 1
+				break
 			}
+			if live > 0 && !ignoreOpts.IgnoreDup {
+				return nil, graph.ErrQuadExists
+			}
+			copies[d.Quad] = 1
 		case graph.Delete:
-			err = qs.RemoveDelta(d)
-			if err != nil && ignoreOpts.IgnoreMissing {
-				err = nil
+			if live == 0 && !ignoreOpts.IgnoreMissing {
+				return nil, graph.ErrQuadNotExist
+			}
+			if live > 0 {
+				copies[d.Quad] = live - 1
 			}
 		default:
-			err = errors.New("memstore: invalid action")
+			return nil, errors.New("memstore: invalid action")
 		}
-		if err != nil {
-			return err
+	}
+	w, ed := v.change(), new(edit)
+	expires := make(map[int64]time.Time)
+	var (
+		removed []int64
+		applied []graph.Delta
+	)
+	for i := range deltas {
+		d := &deltas[i]
+		switch d.Action {
+		case graph.Add:
+			if _, exists := w.indexOf(d.Quad); exists && !qs.multiset {
+				continue
+			}
+			qid := w.addQuad(ed, d)
+			if !d.Expires.IsZero() {
+				expires[qid] = d.Expires
+			}
+			applied = append(applied, *d)
+		case graph.Delete:
+			if prev, exists := w.indexOf(d.Quad); exists {
+				w.removeQuad(d, prev)
+				removed = append(removed, prev)
+				applied = append(applied, *d)
+			}
 		}
 	}
-	return nil
+	if qs.limits != nil && !qs.limits.within(w) {
+		w.restore(removed)
+		return nil, graph.ErrStoreFull
+	}
+	qs.current.Store(w)
+	for qid, t := range expires {
+		qs.expiry[qid] = t
+	}
+	for _, qid := range removed {
+		delete(qs.expiry, qid)
+	}
+	if qs.limits != nil {
+		qs.limits.forget(w, applied)
+		for i := range applied {
+			if applied[i].Action == graph.Add {
+				qs.limits.use(applied[i].Quad.Label)
+			}
+		}
+	}
+	return applied, nil
 }
 
-const maxInt = int(^uint(0) >> 1)
+// Evictions returns the quads of the least recently used labels to delete
+// to make room for the deltas, if the store evicts quads by label.
+func (qs *QuadStore) Evictions(deltas []graph.Delta) ([]quad.Quad, error) {
+	if qs.limits == nil || qs.limits.labels == nil {
+		return nil, nil
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	return qs.limits.victims(qs.version(), deltas), nil
+}
 
-func (qs *QuadStore) indexOf(t quad.Quad) (int64, bool) {
-	min := maxInt
-	var tree *b.Tree
-	for d := quad.Subject; d <= quad.Label; d++ {
-		sid := t.Get(d)
-		if d == quad.Label && sid == "" {
-			continue
-		}
-		id, ok := qs.idMap[sid]
-		// If we've never heard about a node, it must not exist
-		if !ok {
-			return 0, false
-		}
-		index, ok := qs.index.Get(d, id)
+// SearchIterator returns an iterator over the nodes whose names match the
+// text query, or over none if the store keeps no text index.
+func (qs *QuadStore) SearchIterator(text string) graph.Iterator {
+	if qs.search == nil {
+		return iterator.NewNull()
+	}
+	return graph.SearchIteratorOf(qs, qs.search, text)
+}
+
+// indexGeo updates the geohash index once the deltas have been applied.
+func (qs *QuadStore) indexGeo(deltas []graph.Delta) {
+	added, removed := graph.GeoChanges(qs, deltas)
+	qs.geoMu.Lock()
+	defer qs.geoMu.Unlock()
+	for _, name := range added {
+		p, _ := quad.ParseGeoPoint(name)
+		h := int64(p.Geohash())
+		names, ok := qs.geoNodes[h]
 		if !ok {
-			// If it's never been indexed in this direction, it can't exist.
-			return 0, false
+			names = make(map[string]struct{})
+			qs.geoNodes[h] = names
+			qs.geo.Set(h, struct{}{})
 		}
-		if l := index.Len(); l < min {
-			min, tree = l, index
+		names[name] = struct{}{}
+	}
+	for _, name := range removed {
+		p, _ := quad.ParseGeoPoint(name)
+		h := int64(p.Geohash())
+		names := qs.geoNodes[h]
+		delete(names, name)
+		if len(names) == 0 {
+			delete(qs.geoNodes, h)
+			qs.geo.Delete(h)
 		}
 	}
-	it := NewIterator(tree, "", qs)
+}
 
-	for it.Next() {
-		val := it.Result()
-		if t == qs.log[val.(int64)].Quad {
-			return val.(int64), true
+func (qs *QuadStore) NearIterator(center quad.GeoPoint, radius float64) graph.Iterator {
+	var nodes []graph.Value
+	v := qs.version()
+	qs.geoMu.RLock()
+	for _, r := range center.GeohashRanges(radius) {
+		e, _ := qs.geo.Seek(int64(r.From))
+		for {
+			h, _, err := e.Next()
+			if err != nil || h >= int64(r.To) {
+				break
+			}
+			for name := range qs.geoNodes[h] {
+				if id, ok := v.id(name); ok {
+					nodes = append(nodes, id)
+				}
+			}
 		}
+		e.Close()
+	}
+	qs.geoMu.RUnlock()
+	return graph.NearIteratorOf(qs, center, radius, nodes)
+}
+
+func (qs *QuadStore) Subscribe(pattern quad.Quad) <-chan graph.Delta {
+	return qs.watch.Subscribe(pattern)
+}
+
+func (qs *QuadStore) Unsubscribe(c <-chan graph.Delta) {
+	qs.watch.Unsubscribe(c)
+}
+
+// AtRevision returns a read-only view of the store as it was once the delta
+// with the given ID had been applied. It reads the version of the store that
+// the writes since have copied, so it costs nothing to keep, but the memory
+// of the quads it holds.
+func (qs *QuadStore) AtRevision(horizon int64) (graph.QuadStore, error) {
+	v := qs.version()
+	if horizon < 0 || horizon > v.revision {
+		return nil, graph.ErrUnknownRevision
 	}
-	return 0, false
+	return &QuadStore{
+		mu:       qs.mu,
+		snap:     v.at(horizon),
+		search:   qs.search,
+		geoMu:    qs.geoMu,
+		geo:      qs.geo,
+		geoNodes: qs.geoNodes,
+		multiset: qs.multiset,
+		sorted:   qs.sorted,
+	}, nil
+}
+
+// QuadCount returns the number of live copies of t, which is at most one
+// unless the store is a multiset.
+func (qs *QuadStore) QuadCount(t quad.Quad) int64 {
+	return qs.version().quadCount(t)
 }
 
+// Multiset returns whether the store holds a copy of a quad for each time it
+// is added, as it does if it was opened with the multiset option.
+func (qs *QuadStore) Multiset() bool {
+	return qs.multiset
+}
+
+// AddDelta applies a delta adding a quad, as ApplyDeltas does.
 func (qs *QuadStore) AddDelta(d graph.Delta) error {
-	if _, exists := qs.indexOf(d.Quad); exists {
-		return graph.ErrQuadExists
-	}
-	qid := qs.nextQuadID
-	qs.log = append(qs.log, LogEntry{
-		ID:        d.ID.Int(),
-		Quad:      d.Quad,
-		Action:    d.Action,
-		Timestamp: d.Timestamp})
-	qs.size++
-	qs.nextQuadID++
-
-	for dir := quad.Subject; dir <= quad.Label; dir++ {
-		sid := d.Quad.Get(dir)
-		if dir == quad.Label && sid == "" {
+	return qs.ApplyDeltas([]graph.Delta{d}, graph.IgnoreOpts{})
+}
+
+// RemoveDelta applies a delta deleting a quad, as ApplyDeltas does.
+func (qs *QuadStore) RemoveDelta(d graph.Delta) error {
+	return qs.ApplyDeltas([]graph.Delta{d}, graph.IgnoreOpts{})
+}
+
+func (qs *QuadStore) ExpiredQuads(now time.Time) ([]quad.Quad, error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	v := qs.version()
+	var quads []quad.Quad
+	for id, t := range qs.expiry {
+		// Evicted quads may still be listed.
+		if !t.After(now) && v.isLive(id) {
+			quads = append(quads, v.log[id].Quad)
+		}
+	}
+	return quads, nil
+}
+
+// Purge removes the quads deleted before the given time from the indexes,
+// and clears them from the log entries that added and deleted them. As the
+// versions before share the log, it clears them in a copy of it.
+func (qs *QuadStore) Purge(before time.Time) (int, error) {
+	if qs.snap != nil {
+		return 0, graph.ErrRevisionReadOnly
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	v := qs.version()
+	w, ed := v.change(), new(edit)
+	w.log = append([]LogEntry(nil), v.log...)
+	purged := make(map[quad.Quad]bool)
+	dropped := make(map[int64]bool)
+	touched := make(map[[2]int64]bool)
+	for i := range w.log {
+		e := &w.log[i]
+		if e.Action != graph.Add || e.DeletedBy == 0 || e.Quad == (quad.Quad{}) {
 			continue
 		}
-		if _, ok := qs.idMap[sid]; !ok {
-			qs.idMap[sid] = qs.nextID
-			qs.revIDMap[qs.nextID] = sid
-			qs.nextID++
+		del := &w.log[e.DeletedBy]
+		if !del.Timestamp.Before(before) {
+			continue
 		}
+		for dir := quad.Subject; dir <= quad.Label; dir++ {
+			if dir == quad.Label && e.Quad.Get(dir) == "" {
+				continue
+			}
+			if id, ok := w.id(e.Quad.Get(dir)); ok {
+				touched[[2]int64{int64(dir), id}] = true
+			}
+		}
+		dropped[int64(i)] = true
+		purged[e.Quad] = true
+		e.Quad, e.Author, e.Source = quad.Quad{}, "", ""
+		del.Quad = quad.Quad{}
+	}
+	for k := range touched {
+		dir, id := quad.Direction(k[0]), k[1]
+		var list []int64
+		for _, qid := range w.list(dir, id) {
+			if !dropped[qid] {
+				list = append(list, qid)
+			}
+		}
+		w.index[dir-1].set(ed, id, list)
 	}
+	qs.current.Store(w)
+	// Quads added again since are live, and only lose their history.
+	n := 0
+	for q := range purged {
+		if _, live := w.indexOf(q); !live {
+			n++
+		}
+	}
+	return n, nil
+}
 
-	for dir := quad.Subject; dir <= quad.Label; dir++ {
-		if dir == quad.Label && d.Quad.Get(dir) == "" {
+// CollectGarbage removes the nodes no quad, live or deleted, is indexed by.
+func (qs *QuadStore) CollectGarbage() (graph.GCStats, error) {
+	var stats graph.GCStats
+	if qs.snap != nil {
+		return stats, graph.ErrRevisionReadOnly
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	v := qs.version()
+	w, ed := v.change(), new(edit)
+	w.names = append([]string(nil), v.names...)
+	for id, name := range w.names {
+		if id == 0 || name == "" {
 			continue
 		}
-		id := qs.idMap[d.Quad.Get(dir)]
-		tree := qs.index.Tree(dir, id)
-		tree.Set(qid, struct{}{})
+		referenced := false
+		for d := quad.Subject; d <= quad.Label; d++ {
+			if len(w.list(d, int64(id))) > 0 {
+				referenced = true
+				break
+			}
+		}
+		if referenced {
+			continue
+		}
+		w.ids.delete(ed, name)
+		w.names[id] = ""
+		stats.Nodes++
+		stats.Bytes += int64(len(name))
 	}
-
-	// TODO(barakmich): Add VIP indexing
-	return nil
+	if stats.Nodes > 0 {
+		qs.current.Store(w)
+	}
+	return stats, nil
 }
 
-func (qs *QuadStore) RemoveDelta(d graph.Delta) error {
-	prevQuadID, exists := qs.indexOf(d.Quad)
-	if !exists {
-		return graph.ErrQuadNotExist
-	}
-
-	quadID := qs.nextQuadID
-	qs.log = append(qs.log, LogEntry{
-		ID:        d.ID.Int(),
-		Quad:      d.Quad,
-		Action:    d.Action,
-		Timestamp: d.Timestamp})
-	qs.log[prevQuadID].DeletedBy = quadID
-	qs.size--
-	qs.nextQuadID++
-	return nil
+// Provenance returns the provenance recorded in the log entry of a live quad.
+func (qs *QuadStore) Provenance(index graph.Value) (graph.Provenance, bool) {
+	id := index.(int64)
+	v := qs.version()
+	if !v.isLive(id) {
+		return graph.Provenance{}, false
+	}
+	e := &v.log[id]
+	if e.Author == "" && e.Source == "" {
+		return graph.Provenance{}, false
+	}
+	return graph.Provenance{Created: e.Timestamp, Author: e.Author, Source: e.Source}, true
 }
 
 func (qs *QuadStore) Quad(index graph.Value) quad.Quad {
-	return qs.log[index.(int64)].Quad
+	v := qs.version()
+	i := index.(int64)
+	if i < 0 || i >= int64(len(v.log)) {
+		return quad.Quad{}
+	}
+	return v.log[i].Quad
 }
 
+// QuadIterator returns an iterator over the quads with the node of the given
+// ID in a direction, as they are when it is called.
 func (qs *QuadStore) QuadIterator(d quad.Direction, value graph.Value) graph.Iterator {
-	index, ok := qs.index.Get(d, value.(int64))
-	data := fmt.Sprintf("dir:%s val:%d", d, value.(int64))
-	if ok {
-		return NewIterator(index, data, qs)
+	v := qs.version()
+	list := v.list(d, value.(int64))
+	if len(list) == 0 {
+		return &iterator.Null{}
 	}
-	return &iterator.Null{}
+	if d == quad.Label && qs.snap == nil {
+		qs.limits.use(qs.NameOf(value))
+	}
+	data := fmt.Sprintf("dir:%s val:%d", d, value.(int64))
+	return newIterator(v, list, data)
 }
 
 func (qs *QuadStore) Horizon() graph.PrimaryKey {
-	return graph.NewSequentialKey(qs.log[len(qs.log)-1].ID)
+	return graph.NewSequentialKey(qs.version().revision)
 }
 
 func (qs *QuadStore) Size() int64 {
-	return qs.size
+	return qs.version().size
+}
+
+// NodeCount returns the number of node values the store holds.
+func (qs *QuadStore) NodeCount() (int64, error) {
+	return int64(qs.version().ids.n), nil
 }
 
 func (qs *QuadStore) DebugPrint() {
-	for i, l := range qs.log {
+	// Holding the lock of the writers, as the log entries are copied.
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	for i, l := range qs.version().log {
 		if i == 0 {
 			continue
 		}
-		glog.V(2).Infof("%d: %#v", i, l)
+		clog.V(2).Infof("%d: %#v", i, l)
 	}
 }
 
 func (qs *QuadStore) ValueOf(name string) graph.Value {
-	return qs.idMap[name]
+	id, _ := qs.version().id(name)
+	return id
 }
 
 func (qs *QuadStore) NameOf(id graph.Value) string {
-	return qs.revIDMap[id.(int64)]
+	v := qs.version()
+	i := id.(int64)
+	if i < 0 || i >= int64(len(v.names)) {
+		return ""
+	}
+	return v.names[i]
 }
 
 func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
+	if qs.sorted {
+		return iterator.SortQuads(qs, newQuadsAllIterator(qs))
+	}
 	return newQuadsAllIterator(qs)
 }
 
@@ -263,15 +547,23 @@ func (qs *QuadStore) FixedIterator() graph.FixedIterator {
 }
 
 func (qs *QuadStore) QuadDirection(val graph.Value, d quad.Direction) graph.Value {
-	name := qs.Quad(val).Get(d)
-	return qs.ValueOf(name)
+	id, _ := qs.version().id(qs.Quad(val).Get(d))
+	return id
 }
 
 func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	if qs.sorted {
+		return iterator.SortNodes(qs, newNodesAllIterator(qs))
+	}
 	return newNodesAllIterator(qs)
 }
 
-func (qs *QuadStore) Close() {}
+func (qs *QuadStore) Close() {
+	qs.watch.Close()
+	if qs.search != nil && qs.snap == nil {
+		qs.search.Close()
+	}
+}
 
 func (qs *QuadStore) Type() string {
 	return QuadStoreType
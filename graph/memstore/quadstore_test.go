@@ -15,12 +15,16 @@
 package memstore
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/graphtest"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/graph/path"
 	"github.com/google/cayley/quad"
 	"github.com/google/cayley/writer"
 )
@@ -204,3 +208,437 @@ func TestRemoveQuad(t *testing.T) {
 		t.Error("E should not have any followers.")
 	}
 }
+
+func makeStore(t testing.TB) (graph.QuadStore, func()) {
+	return newQuadStore(), func() {}
+}
+
+func TestConformance(t *testing.T) {
+	graphtest.TestAll(t, makeStore)
+}
+
+func BenchmarkConformance(b *testing.B) {
+	graphtest.BenchmarkAll(b, makeStore)
+}
+
+// duplicatingStore holds a quad twice, as a store without unique constraints
+// may, as long as dup is set.
+type duplicatingStore struct {
+	*QuadStore
+	dup *quad.Quad
+}
+
+func (qs *duplicatingStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	it := qs.QuadStore.QuadIterator(d, v)
+	defer it.Close()
+	fixed := qs.FixedIterator()
+	for graph.Next(it) {
+		fixed.Add(it.Result())
+		if qs.dup != nil && qs.Quad(it.Result()) == *qs.dup {
+			fixed.Add(it.Result())
+		}
+	}
+	return fixed
+}
+
+func TestDedupe(t *testing.T) {
+	mem, w, _ := makeTestStore(simpleGraph)
+	dup := simpleGraph[2]
+	qs := &duplicatingStore{QuadStore: mem, dup: &dup}
+
+	rep, err := graph.Dedupe(qs, w, true)
+	if err != nil {
+		t.Fatalf("Failed to find duplicates: %v", err)
+	}
+	expect := graph.DedupeReport{Quads: int64(len(simpleGraph)) + 1, Duplicated: 1, Copies: 1}
+	if rep != expect {
+		t.Errorf("Unexpected dry run, got:%+v expect:%+v", rep, expect)
+	}
+	horizon := mem.Horizon()
+
+	rep, err = graph.Dedupe(qs, duplicatingWriter{w, qs}, false)
+	if err != nil {
+		t.Fatalf("Failed to remove duplicates: %v", err)
+	}
+	expect.Removed = 1
+	if rep != expect {
+		t.Errorf("Unexpected deduplication, got:%+v expect:%+v", rep, expect)
+	}
+	if got := mem.Horizon(); got.Int() != horizon.Int()+2 {
+		t.Errorf("Unexpected horizon after rewriting the quad, got:%d expect:%d", got.Int(), horizon.Int()+2)
+	}
+	if mem.Size() != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected size after deduplication, got:%d expect:%d", mem.Size(), len(simpleGraph))
+	}
+	if rep, _ = graph.Dedupe(qs, w, true); rep.Duplicated != 0 {
+		t.Errorf("Unexpected duplicates after deduplication: %+v", rep)
+	}
+}
+
+func TestMultiset(t *testing.T) {
+	qs, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"multiset": true})
+	if err != nil {
+		t.Fatalf("Could not open a multiset: %v", err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	q := quad.Quad{"A", "follows", "B", ""}
+	if err := w.AddQuadSet([]quad.Quad{q, q}); err != nil {
+		t.Fatalf("Could not add a quad twice: %v", err)
+	}
+	if err := w.AddQuad(q); err != nil {
+		t.Fatalf("Could not add a quad again: %v", err)
+	}
+	if n, _ := graph.QuadCount(qs, q); n != 3 || qs.Size() != 3 {
+		t.Errorf("Unexpected copies, got:%d (size %d) expect:3", n, qs.Size())
+	}
+	if !graph.IsMultiset(qs) || !graph.Capabilities(qs).Has(graph.CanCountQuads) {
+		t.Errorf("Store should be a multiset")
+	}
+
+	if err := w.RemoveQuad(q); err != nil {
+		t.Fatalf("Could not remove a copy: %v", err)
+	}
+	if n, _ := graph.QuadCount(qs, q); n != 2 {
+		t.Errorf("Unexpected copies after a removal, got:%d expect:2", n)
+	}
+	rep, err := graph.Dedupe(qs, w, false)
+	if err != nil {
+		t.Fatalf("Failed to remove duplicates: %v", err)
+	}
+	if rep.Removed != 1 {
+		t.Errorf("Unexpected deduplication: %+v", rep)
+	}
+	if ok, _ := graph.HasQuad(qs, q); !ok || qs.Size() != 1 {
+		t.Errorf("Unexpected store after deduplication, has quad:%t size:%d", ok, qs.Size())
+	}
+}
+
+func TestSortedIteration(t *testing.T) {
+	qs, _ := graph.NewQuadStore(QuadStoreType, "", graph.Options{"sorted_iteration": true})
+	w, _ := writer.NewSingleReplication(qs, nil)
+	w.AddQuadSet([]quad.Quad{
+		{"C", "follows", "A", ""},
+		{"A", "follows", "C", ""},
+		{"A", "follows", "B", ""},
+	})
+
+	var quads []quad.Quad
+	it := qs.QuadsAllIterator()
+	for graph.Next(it) {
+		quads = append(quads, qs.Quad(it.Result()))
+	}
+	expect := []quad.Quad{
+		{"A", "follows", "B", ""},
+		{"A", "follows", "C", ""},
+		{"C", "follows", "A", ""},
+	}
+	if !reflect.DeepEqual(quads, expect) {
+		t.Errorf("Unexpected order of quads, got:%v expect:%v", quads, expect)
+	}
+
+	var nodes []string
+	it = qs.NodesAllIterator()
+	for graph.Next(it) {
+		nodes = append(nodes, qs.NameOf(it.Result()))
+	}
+	if expect := []string{"A", "B", "C", "follows"}; !reflect.DeepEqual(nodes, expect) {
+		t.Errorf("Unexpected order of nodes, got:%v expect:%v", nodes, expect)
+	}
+}
+
+// duplicatingWriter removes every copy of the quad a duplicatingStore holds
+// twice, as the store is expected to.
+type duplicatingWriter struct {
+	graph.QuadWriter
+	qs *duplicatingStore
+}
+
+func (w duplicatingWriter) RemoveQuad(q quad.Quad) error {
+	if w.qs.dup != nil && q == *w.qs.dup {
+		w.qs.dup = nil
+	}
+	return w.QuadWriter.RemoveQuad(q)
+}
+
+// wordIndex is a FullTextIndexer matching the nodes whose names hold a word.
+type wordIndex map[string]bool
+
+func (idx wordIndex) Index(names []string) error {
+	for _, name := range names {
+		idx[name] = true
+	}
+	return nil
+}
+
+func (idx wordIndex) Remove(names []string) error {
+	for _, name := range names {
+		delete(idx, name)
+	}
+	return nil
+}
+
+func (idx wordIndex) Search(text string) ([]string, error) {
+	var names []string
+	for name := range idx {
+		for _, word := range strings.Fields(name) {
+			if word == text {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+func (idx wordIndex) Count() (uint64, error) { return uint64(len(idx)), nil }
+func (idx wordIndex) Close() error           { return nil }
+
+var searchIndex = wordIndex{}
+
+func init() {
+	graph.RegisterFullTextIndexer("words", func(string, graph.Options) (graph.FullTextIndexer, error) {
+		return searchIndex, nil
+	})
+}
+
+func TestSearch(t *testing.T) {
+	qs, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"full_text_index": "words"})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer qs.Close()
+	w, _ := writer.NewSingleReplication(qs, nil)
+	for _, q := range []quad.Quad{
+		{"alice", "name", "Alice Smith", ""},
+		{"bob", "name", "Bob Smith", ""},
+		{"carol", "name", "Carol Jones", ""},
+		{"carol", "nickname", "Carol Jones", ""},
+	} {
+		w.AddQuad(q)
+	}
+
+	search := func(text string) []string {
+		var got []string
+		it := path.StartPath(qs).Search(text).In("name").BuildIterator()
+		for graph.Next(it) {
+			got = append(got, qs.NameOf(it.Result()))
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got, expect := search("Smith"), []string{"alice", "bob"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected search results, got:%v expect:%v", got, expect)
+	}
+	if len(searchIndex) != 3 {
+		t.Errorf("Unexpected indexed nodes: %v", searchIndex)
+	}
+
+	w.RemoveQuad(quad.Quad{"bob", "name", "Bob Smith", ""})
+	w.RemoveQuad(quad.Quad{"carol", "name", "Carol Jones", ""})
+	if got, expect := search("Smith"), []string{"alice"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected search results after removal, got:%v expect:%v", got, expect)
+	}
+	if searchIndex["Bob Smith"] || !searchIndex["Carol Jones"] {
+		t.Errorf("Unexpected indexed nodes after removal: %v", searchIndex)
+	}
+
+	if it := newQuadStore().SearchIterator("Smith"); graph.Next(it) {
+		t.Error("Unexpected search results without an index.")
+	}
+}
+
+func TestNear(t *testing.T) {
+	qs, w, _ := makeTestStore(nil)
+	eiffel := quad.GeoPoint{Lat: 48.8584, Lon: 2.2945}
+	louvre := quad.GeoPoint{Lat: 48.8606, Lon: 2.3376}
+	w.AddQuadSet([]quad.Quad{
+		{"eiffel", "location", eiffel.String(), ""},
+		{"louvre", "location", louvre.String(), ""},
+		{"louvre", "name", "Louvre", ""},
+	})
+
+	for _, test := range []struct {
+		radius float64
+		expect []string
+	}{
+		{radius: 1000, expect: []string{"eiffel"}},
+		{radius: 5000, expect: []string{"eiffel", "louvre"}},
+	} {
+		for _, near := range []graph.Iterator{
+			path.StartPath(qs).Near(eiffel.Lat, eiffel.Lon, test.radius).In("location").BuildIterator(),
+			// Without the geohash index.
+			path.StartPath(struct{ graph.QuadStore }{qs}).Near(eiffel.Lat, eiffel.Lon, test.radius).In("location").BuildIterator(),
+		} {
+			var got []string
+			for graph.Next(near) {
+				got = append(got, qs.NameOf(near.Result()))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("Unexpected nodes within %vm, got:%v expect:%v", test.radius, got, test.expect)
+			}
+		}
+	}
+}
+
+func TestIteratorsReadTheirVersion(t *testing.T) {
+	qs, w, _ := makeTestStore(simpleGraph)
+	follows := qs.QuadIterator(quad.Predicate, qs.ValueOf("follows"))
+	all := qs.QuadsAllIterator()
+	size := qs.Size()
+
+	w.RemoveQuad(quad.Quad{"A", "follows", "B", ""})
+	w.AddQuad(quad.Quad{"X", "follows", "Y", ""})
+
+	count := func(it graph.Iterator) int {
+		n := 0
+		for graph.Next(it) {
+			if q := qs.Quad(it.Result()); q.Subject == "X" {
+				t.Errorf("Iterator saw a quad added after it was built: %v", q)
+			}
+			n++
+		}
+		return n
+	}
+	if got := count(follows); got != 8 {
+		t.Errorf("Unexpected quads following, got:%d expect:8", got)
+	}
+	if got := count(all); got != int(size) {
+		t.Errorf("Unexpected quads, got:%d expect:%d", got, size)
+	}
+	// The first quad added, A follows B.
+	if !follows.Contains(int64(1)) {
+		t.Error("Iterator lost a quad deleted after it was built")
+	}
+	if qs.QuadIterator(quad.Predicate, qs.ValueOf("follows")).Contains(int64(1)) {
+		t.Error("Iterator holds a deleted quad")
+	}
+}
+
+func TestConcurrentVersions(t *testing.T) {
+	qs, w, _ := makeTestStore(nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			w.AddQuad(quad.Quad{fmt.Sprint("n", i), "next", fmt.Sprint("n", i+1), ""})
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		snap := graph.Snapshot(qs)
+		it := snap.QuadsAllIterator()
+		n := int64(0)
+		for graph.Next(it) {
+			n++
+		}
+		if size := snap.Size(); n != size {
+			t.Fatalf("Snapshot lists %d quads, but holds %d", n, size)
+		}
+	}
+	if size := qs.Size(); size != 200 {
+		t.Errorf("Unexpected size, got:%d expect:200", size)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	qs, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"max_quads": 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	if err := w.AddQuadSet([]quad.Quad{{"a", "b", "c", ""}, {"a", "b", "d", ""}}); err != nil {
+		t.Fatalf("Could not write within the limit: %v", err)
+	}
+	if err := w.AddQuad(quad.Quad{"a", "b", "e", ""}); err != graph.ErrStoreFull {
+		t.Errorf("Unexpected error over the limit, got:%v expect:%v", err, graph.ErrStoreFull)
+	}
+	if size := qs.Size(); size != 2 {
+		t.Errorf("Unexpected size, got:%d expect:2", size)
+	}
+
+	if _, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"eviction": "random"}); err == nil {
+		t.Error("Expected an error for an unknown eviction policy")
+	}
+}
+
+func TestLimitsRejectedDelete(t *testing.T) {
+	qs, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"max_quads": 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	x, y := quad.Quad{"a", "b", "x", ""}, quad.Quad{"a", "b", "y", ""}
+	if err := w.AddQuadSet([]quad.Quad{x, y}); err != nil {
+		t.Fatal(err)
+	}
+	tx := graph.NewTransaction()
+	tx.RemoveQuad(x)
+	tx.AddQuad(quad.Quad{"a", "b", "z", ""})
+	tx.AddQuad(quad.Quad{"a", "b", "w", ""})
+	if err := w.ApplyTransaction(tx); err != graph.ErrStoreFull {
+		t.Fatalf("Unexpected error over the limit, got:%v expect:%v", err, graph.ErrStoreFull)
+	}
+
+	// The next write takes the place in the log of the rejected deletion.
+	if err := w.RemoveQuad(y); err != nil {
+		t.Fatal(err)
+	}
+	var got []quad.Quad
+	it := qs.QuadsAllIterator()
+	for graph.Next(it) {
+		got = append(got, qs.Quad(it.Result()))
+	}
+	if expect := []quad.Quad{x}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected quads after a rejected deletion, got:%v expect:%v", got, expect)
+	}
+	if size := qs.Size(); size != 1 {
+		t.Errorf("Unexpected size, got:%d expect:1", size)
+	}
+	if err := w.RemoveQuad(x); err != nil {
+		t.Errorf("Could not remove a quad after a rejected deletion: %v", err)
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	qs, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"max_quads": 4.0, "eviction": EvictLRU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := writer.NewSingleReplication(qs, nil)
+	labels := func() []string {
+		var got []string
+		it := qs.QuadsAllIterator()
+		for graph.Next(it) {
+			got = append(got, qs.Quad(it.Result()).Label)
+		}
+		sort.Strings(got)
+		return got
+	}
+	w.AddQuadSet([]quad.Quad{{"x", "in", "1", "a"}, {"y", "in", "1", "a"}})
+	w.AddQuadSet([]quad.Quad{{"x", "in", "2", "b"}, {"y", "in", "2", "b"}})
+	if err := w.AddQuad(quad.Quad{"x", "in", "3", "c"}); err != nil {
+		t.Fatalf("Could not write evicting a label: %v", err)
+	}
+	if got, expect := labels(), []string{"b", "b", "c"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected labels after evicting, got:%v expect:%v", got, expect)
+	}
+
+	// Reading b by its label makes c the least recently used.
+	qs.QuadIterator(quad.Label, qs.ValueOf("b"))
+	w.AddQuadSet([]quad.Quad{{"x", "in", "4", "d"}, {"y", "in", "4", "d"}})
+	if got, expect := labels(), []string{"b", "b", "d", "d"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected labels after evicting, got:%v expect:%v", got, expect)
+	}
+
+	if err := w.AddQuadSet([]quad.Quad{{"x", "in", "5", ""}, {"y", "in", "5", ""}, {"z", "in", "5", ""}, {"w", "in", "5", ""}, {"v", "in", "5", ""}}); err != graph.ErrStoreFull {
+		t.Errorf("Unexpected error writing more than the limit, got:%v expect:%v", err, graph.ErrStoreFull)
+	}
+	if size := qs.Size(); size != 4 {
+		t.Errorf("Unexpected size after failing, got:%d expect:4", size)
+	}
+}
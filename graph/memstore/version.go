@@ -0,0 +1,276 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memstore
+
+// Defines the versions of the store, which writers copy on write so that
+// readers never wait for them.
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// version is the store as of a revision. Once published it does not change,
+// but for the DeletedBy of its log entries, which are set atomically as
+// later versions delete their quads, and which it ignores past its log.
+//
+// The log, the names and the index lists only grow at their ends, beyond
+// the lengths earlier versions see, so the versions share them, and the rest
+// of a version is copied as a writer first changes it.
+type version struct {
+	// revision is the ID of the last delta the version holds.
+	revision int64
+
+	// log holds the deltas applied, in order, after a sentinel entry so
+	// that quad IDs, their indexes in it, start at 1.
+	log []LogEntry
+
+	// names holds the name of each node, by its ID, after a sentinel
+	// name. The names of nodes that were collected are empty.
+	names []string
+	ids   nameMap
+
+	// index lists the IDs of the quads of each node, in order, by
+	// direction.
+	index [4]lists
+
+	// size is the number of live quads, and bytes an estimate of the
+	// memory they take.
+	size  int64
+	bytes int64
+}
+
+func newVersion() *version {
+	return &version{
+		log:   make([]LogEntry, 1, 200),
+		names: make([]string, 1, 200),
+	}
+}
+
+// lists is a persistent array of the index lists of the nodes, by their ID,
+// in chunks so that changing a list copies only its chunk.
+type lists struct {
+	chunks []*listChunk
+}
+
+const listChunkSize = 256
+
+type listChunk struct {
+	owner *edit
+	lists [listChunkSize][]int64
+}
+
+func (l lists) get(id int64) []int64 {
+	c := id / listChunkSize
+	if id < 0 || c >= int64(len(l.chunks)) {
+		return nil
+	}
+	return l.chunks[c].lists[id%listChunkSize]
+}
+
+// set sets the list of a node, as part of the given edit. The chunks must
+// have been copied from the version the edit changes.
+func (l *lists) set(ed *edit, id int64, list []int64) {
+	c := int(id / listChunkSize)
+	for len(l.chunks) <= c {
+		l.chunks = append(l.chunks, &listChunk{owner: ed})
+	}
+	ch := l.chunks[c]
+	if ch.owner != ed {
+		cp := *ch
+		cp.owner = ed
+		ch = &cp
+		l.chunks[c] = ch
+	}
+	ch.lists[id%listChunkSize] = list
+}
+
+// list returns the index list of a node in a direction.
+func (v *version) list(d quad.Direction, id int64) []int64 {
+	if d < quad.Subject || d > quad.Label {
+		panic("illegal direction")
+	}
+	return v.index[d-1].get(id)
+}
+
+// isLive returns whether the log entry at index is a quad that the version
+// holds.
+func (v *version) isLive(index int64) bool {
+	if index <= 0 || index >= int64(len(v.log)) {
+		// Added after the version was taken.
+		return false
+	}
+	e := &v.log[index]
+	if e.Action == graph.Delete || e.Quad == (quad.Quad{}) {
+		// A deletion, or a quad since purged.
+		return false
+	}
+	del := atomic.LoadInt64(&e.DeletedBy)
+	return del == 0 || del >= int64(len(v.log))
+}
+
+// at returns the version as of an earlier revision: the part of its log up
+// to the last delta of at most that ID. It keeps the names of the nodes
+// added since, which no quad of it refers to.
+func (v *version) at(revision int64) *version {
+	if revision >= v.revision {
+		old := *v
+		old.revision = revision
+		return &old
+	}
+	n := sort.Search(len(v.log), func(i int) bool {
+		return v.log[i].ID > revision
+	})
+	old := *v
+	old.revision = revision
+	old.log = v.log[:n:n]
+	old.size, old.bytes = 0, 0
+	for i := 1; i < n; i++ {
+		if old.isLive(int64(i)) {
+			old.size++
+			old.bytes += quadBytes(old.log[i].Quad)
+		}
+	}
+	return &old
+}
+
+// ID returns the ID of a node, or false if the version has none of the name.
+func (v *version) id(name string) (int64, bool) {
+	return v.ids.get(name)
+}
+
+// smallestList returns the smallest of the index lists of the nodes of q, or
+// false if q cannot be in the version.
+func (v *version) smallestList(q quad.Quad) ([]int64, bool) {
+	var list []int64
+	found := false
+	for d := quad.Subject; d <= quad.Label; d++ {
+		name := q.Get(d)
+		if d == quad.Label && name == "" {
+			continue
+		}
+		id, ok := v.id(name)
+		// If we've never heard about a node, it must not exist
+		if !ok {
+			return nil, false
+		}
+		l := v.list(d, id)
+		if len(l) == 0 {
+			// If it's never been indexed in this direction, it can't exist.
+			return nil, false
+		}
+		if !found || len(l) < len(list) {
+			list, found = l, true
+		}
+	}
+	return list, found
+}
+
+// indexOf returns the index of a live copy of q in the log.
+func (v *version) indexOf(q quad.Quad) (int64, bool) {
+	list, ok := v.smallestList(q)
+	if !ok {
+		return 0, false
+	}
+	for _, i := range list {
+		if v.isLive(i) && v.log[i].Quad == q {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// quadCount returns the number of live copies of q.
+func (v *version) quadCount(q quad.Quad) int64 {
+	list, ok := v.smallestList(q)
+	if !ok {
+		return 0
+	}
+	var n int64
+	for _, i := range list {
+		if v.isLive(i) && v.log[i].Quad == q {
+			n++
+		}
+	}
+	return n
+}
+
+// change returns a copy of the version for the given edit to change.
+func (v *version) change() *version {
+	w := *v
+	for d := range w.index {
+		w.index[d].chunks = append([]*listChunk(nil), v.index[d].chunks...)
+	}
+	return &w
+}
+
+// addQuad adds a delta adding a quad to a version being changed by the edit,
+// and returns its quad ID.
+func (v *version) addQuad(ed *edit, d *graph.Delta) int64 {
+	qid := int64(len(v.log))
+	v.log = append(v.log, LogEntry{
+		ID:        d.ID.Int(),
+		Quad:      d.Quad,
+		Action:    d.Action,
+		Timestamp: d.Timestamp,
+		Author:    d.Author,
+		Source:    d.Source})
+	v.revision = d.ID.Int()
+	v.size++
+	v.bytes += quadBytes(d.Quad)
+	for dir := quad.Subject; dir <= quad.Label; dir++ {
+		name := d.Quad.Get(dir)
+		if dir == quad.Label && name == "" {
+			continue
+		}
+		id, ok := v.id(name)
+		if !ok {
+			id = int64(len(v.names))
+			v.names = append(v.names, name)
+			v.ids.set(ed, name, id)
+		}
+		// Quad IDs only grow, so the list stays in order.
+		v.index[dir-1].set(ed, id, append(v.list(dir, id), qid))
+	}
+	return qid
+}
+
+// removeQuad adds a delta deleting the live quad at index prev to a version
+// being changed.
+func (v *version) removeQuad(d *graph.Delta, prev int64) {
+	qid := int64(len(v.log))
+	v.log = append(v.log, LogEntry{
+		ID:        d.ID.Int(),
+		Quad:      d.Quad,
+		Action:    d.Action,
+		Timestamp: d.Timestamp})
+	v.revision = d.ID.Int()
+	atomic.StoreInt64(&v.log[prev].DeletedBy, qid)
+	v.size--
+	v.bytes -= quadBytes(d.Quad)
+}
+
+// restore undoes the deletions of the quads at the given indexes by a version
+// being changed that is then dropped. The log entries they marked are shared
+// with the other versions, and the next version published would otherwise
+// take the indexes of the deletions, and see the quads deleted.
+func (v *version) restore(deleted []int64) {
+	for _, prev := range deleted {
+		atomic.StoreInt64(&v.log[prev].DeletedBy, 0)
+	}
+}
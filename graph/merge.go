@@ -0,0 +1,193 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+
+	"github.com/google/cayley/quad"
+)
+
+var (
+	// ErrNodeExists is returned when renaming a node to a name in use.
+	ErrNodeExists = errors.New("node exists")
+
+	// ErrSameNode is returned when merging or renaming a node into itself.
+	ErrSameNode = errors.New("cannot merge a node into itself")
+)
+
+// quadsOn returns the quads with the named node in any direction.
+func quadsOn(qs QuadStore, name string) ([]quad.Quad, error) {
+	v := qs.ValueOf(name)
+	if v == nil {
+		return nil, nil
+	}
+	it, err := QuadsAllOn(qs, v)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var out []quad.Quad
+	for Next(it) {
+		out = append(out, qs.Quad(it.Result()))
+	}
+	return out, it.Err()
+}
+
+func replaceNode(q quad.Quad, from, to string) quad.Quad {
+	for _, d := range AllDirections {
+		if q.Get(d) == from {
+			switch d {
+			case quad.Subject:
+				q.Subject = to
+			case quad.Predicate:
+				q.Predicate = to
+			case quad.Object:
+				q.Object = to
+			case quad.Label:
+				q.Label = to
+			}
+		}
+	}
+	return q
+}
+
+// MergeNodes rewrites every quad of qs referencing the node from, in any
+// direction, to reference the node to instead, and returns the number of
+// quads rewritten. Rewritten quads that to already has are dropped.
+//
+// The quads are rewritten through qw in a single transaction, so the merge
+// is atomic; it suits nodes with a moderate number of quads.
+func MergeNodes(qs QuadStore, qw QuadWriter, from, to string) (int, error) {
+	if from == to {
+		return 0, ErrSameNode
+	}
+	quads, err := quadsOn(qs, from)
+	if err != nil || len(quads) == 0 {
+		return 0, err
+	}
+	existing, err := quadsOn(qs, to)
+	if err != nil {
+		return 0, err
+	}
+	have := make(map[quad.Quad]bool, len(existing))
+	for _, q := range existing {
+		have[q] = true
+	}
+	tx := NewTransaction()
+	for _, q := range quads {
+		tx.RemoveQuad(q)
+		n := replaceNode(q, from, to)
+		if have[n] {
+			continue
+		}
+		have[n] = true
+		tx.AddQuad(n)
+	}
+	err = qw.ApplyTransaction(tx)
+	if err != nil {
+		return 0, err
+	}
+	return len(quads), nil
+}
+
+// RenameNode is like MergeNodes, but fails with ErrNodeExists if any quad
+// already references the node to.
+func RenameNode(qs QuadStore, qw QuadWriter, from, to string) (int, error) {
+	if from == to {
+		return 0, ErrSameNode
+	}
+	existing, err := quadsOn(qs, to)
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) != 0 {
+		return 0, ErrNodeExists
+	}
+	return MergeNodes(qs, qw, from, to)
+}
+
+// hasQuad returns whether qs holds q itself.
+func hasQuad(qs QuadStore, q quad.Quad) (bool, error) {
+	quads, err := MatchingQuads(qs, q)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range quads {
+		if m == q {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RenamePredicate rewrites every quad of qs with the predicate from to use
+// the predicate to instead, and returns the number of quads rewritten.
+// Rewritten quads that already exist are dropped.
+//
+// Unlike MergeNodes, the quads are rewritten through qw in transactions of
+// batchSize quads each, so the store is never locked for long but may be
+// seen half migrated. progress, if not nil, is called after each batch
+// with the number of quads rewritten so far.
+func RenamePredicate(qs QuadStore, qw QuadWriter, from, to string, batchSize int, progress func(int)) (int, error) {
+	if from == to {
+		return 0, ErrSameNode
+	}
+	if batchSize <= 0 {
+		return 0, errors.New("invalid batch size")
+	}
+	v := qs.ValueOf(from)
+	if v == nil {
+		return 0, nil
+	}
+	done := 0
+	for {
+		// Rewritten quads leave the index, so each batch is read from its
+		// start.
+		it := qs.QuadIterator(quad.Predicate, v)
+		var batch []quad.Quad
+		for len(batch) < batchSize && Next(it) {
+			batch = append(batch, qs.Quad(it.Result()))
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return done, err
+		}
+		if len(batch) == 0 {
+			return done, nil
+		}
+		tx := NewTransaction()
+		for _, q := range batch {
+			tx.RemoveQuad(q)
+			q.Predicate = to
+			exists, err := hasQuad(qs, q)
+			if err != nil {
+				return done, err
+			}
+			if !exists {
+				tx.AddQuad(q)
+			}
+		}
+		err = qw.ApplyTransaction(tx)
+		if err != nil {
+			return done, err
+		}
+		done += len(batch)
+		if progress != nil {
+			progress(done)
+		}
+	}
+}
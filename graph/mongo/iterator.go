@@ -17,10 +17,10 @@ package mongo
 import (
 	"fmt"
 
-	"github.com/barakmich/glog"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
@@ -138,7 +138,7 @@ func (it *Iterator) Next() bool {
 		err := it.iter.Err()
 		if err != nil {
 			it.err = err
-			glog.Errorln("Error Nexting Iterator: ", err)
+			clog.Errorln("Error Nexting Iterator: ", err)
 		}
 		return false
 	}
@@ -0,0 +1,126 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/google/cayley/graph"
+)
+
+// readModes maps the read_preference option to the mgo consistency mode
+// used by the session.
+var readModes = map[string]mgo.Mode{
+	"primary":            mgo.Primary,
+	"primaryPreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondaryPreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+}
+
+// DefaultDialTimeout is how long to wait while connecting, unless set by the
+// "dial_timeout_ms" option. It, and the minute sync and socket timeouts, are
+// those of mgo.Dial.
+const DefaultDialTimeout = 10 * time.Second
+
+// dialMongo connects to the MongoDB deployment described by addr, which may
+// be a plain "host:port" list or a full mongodb:// connection string, and
+// applies the connection related options. It returns the session and the
+// write concern that should be restored after unsafe bulk writes.
+func dialMongo(addr string, options graph.Options) (*mgo.Session, *mgo.Safe, error) {
+	info, err := mgo.ParseURL(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	replicaSet, ok, err := options.StringKey("replica_set")
+	if err != nil {
+		return nil, nil, err
+	} else if ok {
+		info.ReplicaSetName = replicaSet
+	}
+	info.Timeout = DefaultDialTimeout
+	timeout, ok, err := options.IntKey("dial_timeout_ms")
+	if err != nil {
+		return nil, nil, err
+	} else if ok {
+		info.Timeout = time.Duration(timeout) * time.Millisecond
+	}
+
+	safe, err := writeConcern(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	pref, hasPref, err := options.StringKey("read_preference")
+	if err != nil {
+		return nil, nil, err
+	}
+	mode, found := readModes[pref]
+	if hasPref && !found {
+		return nil, nil, fmt.Errorf("mongo: unknown read_preference %q", pref)
+	}
+	poolLimit, hasPoolLimit, err := options.IntKey("pool_limit")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := mgo.DialWithInfo(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetSyncTimeout(time.Minute)
+	conn.SetSocketTimeout(time.Minute)
+	conn.SetSafe(safe)
+	if hasPref {
+		conn.SetMode(mode, true)
+	}
+	if hasPoolLimit {
+		conn.SetPoolLimit(poolLimit)
+	}
+	return conn, safe, nil
+}
+
+// writeConcern builds the write concern from the write_concern, journal and
+// write_timeout_ms options. The write_concern option is either a number of
+// acknowledging members or a tag set name such as "majority".
+func writeConcern(options graph.Options) (*mgo.Safe, error) {
+	safe := &mgo.Safe{}
+	w, ok, err := options.StringKey("write_concern")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		if n, err := strconv.Atoi(w); err == nil {
+			safe.W = n
+		} else {
+			safe.WMode = w
+		}
+	}
+	journal, ok, err := options.BoolKey("journal")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		safe.J = journal
+	}
+	wtimeout, ok, err := options.IntKey("write_timeout_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		safe.WTimeout = wtimeout
+	}
+	return safe, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+var _ graph.Nexter = &Pipeline{}
+
+var pipelineType graph.Type
+
+func init() {
+	pipelineType = graph.RegisterIterator("mongo-pipeline")
+}
+
+// Pipeline is an iterator of nodes computed server side by an aggregation
+// pipeline. It stands in for a HasA over a constrained set of quads, such as
+// the one built for a Has() filter or an Out() from a fixed node: rather than
+// streaming every matching quad to Cayley and resolving its direction here,
+// Mongo matches the live quads and groups them by the node in the requested
+// direction, so only the distinct node names cross the wire.
+type Pipeline struct {
+	uid        uint64
+	tags       graph.Tagger
+	qs         *QuadStore
+	dir        quad.Direction
+	constraint bson.M
+	iter       *mgo.Iter
+	size       int64
+	result     graph.Value
+	runstats   graph.IteratorStats
+	err        error
+}
+
+// NewPipeline returns a Pipeline iterator yielding the distinct nodes in
+// direction d of the live quads matching constraint.
+func NewPipeline(qs *QuadStore, constraint bson.M, d quad.Direction) *Pipeline {
+	return &Pipeline{
+		uid:        iterator.NextUID(),
+		qs:         qs,
+		dir:        d,
+		constraint: constraint,
+		size:       -1,
+	}
+}
+
+// liveQuad is the aggregation expression equivalent of the Added/Deleted
+// history check done by the Next methods of the other iterators.
+var liveQuad = bson.M{
+	"$gt": []interface{}{
+		bson.M{"$size": bson.M{"$ifNull": []interface{}{"$Added", []interface{}{}}}},
+		bson.M{"$size": bson.M{"$ifNull": []interface{}{"$Deleted", []interface{}{}}}},
+	},
+}
+
+func (it *Pipeline) pipeline() []bson.M {
+	return []bson.M{
+		{"$match": it.constraint},
+		{"$project": bson.M{
+			"node": "$" + it.dir.String(),
+			"live": liveQuad,
+		}},
+		{"$match": bson.M{"live": true}},
+		{"$group": bson.M{"_id": "$node"}},
+	}
+}
+
+func (it *Pipeline) UID() uint64 {
+	return it.uid
+}
+
+func (it *Pipeline) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Pipeline) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *Pipeline) Reset() {
+	it.Close()
+	it.iter = nil
+}
+
+func (it *Pipeline) Close() error {
+	if it.iter != nil {
+		return it.iter.Close()
+	}
+	return nil
+}
+
+func (it *Pipeline) Clone() graph.Iterator {
+	m := NewPipeline(it.qs, it.constraint, it.dir)
+	m.tags.CopyFrom(it)
+	return m
+}
+
+func (it *Pipeline) Next() bool {
+	var result struct {
+		Name string `bson:"_id"`
+	}
+	graph.NextLogIn(it)
+	it.runstats.Next += 1
+	if it.iter == nil {
+		it.iter = it.qs.db.C("quads").Pipe(it.pipeline()).Iter()
+	}
+	if !it.iter.Next(&result) {
+		err := it.iter.Err()
+		if err != nil {
+			it.err = err
+			clog.Errorln("Error Nexting Pipeline: ", err)
+		}
+		return graph.NextLogOut(it, nil, false)
+	}
+	val := hashOf(result.Name)
+	it.qs.ids.Put(val, result.Name)
+	it.result = val
+	return graph.NextLogOut(it, it.result, true)
+}
+
+func (it *Pipeline) Err() error {
+	return it.err
+}
+
+func (it *Pipeline) Result() graph.Value {
+	return it.result
+}
+
+func (it *Pipeline) NextPath() bool {
+	return false
+}
+
+// SubIterators returns no subiterators for a Pipeline; the whole subtree it
+// replaced is evaluated by Mongo.
+func (it *Pipeline) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *Pipeline) Contains(v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	it.runstats.Contains += 1
+	constraint := bson.M{}
+	for k, c := range it.constraint {
+		constraint[k] = c
+	}
+	constraint[it.dir.String()] = it.qs.NameOf(v)
+	iter := it.qs.db.C("quads").Find(constraint).Iter()
+	defer iter.Close()
+	var result struct {
+		Added   []int64 `bson:"Added"`
+		Deleted []int64 `bson:"Deleted"`
+	}
+	for iter.Next(&result) {
+		if len(result.Added) > len(result.Deleted) {
+			it.result = v
+			return graph.ContainsLogOut(it, v, true)
+		}
+	}
+	it.err = iter.Err()
+	return graph.ContainsLogOut(it, v, false)
+}
+
+// Size returns the number of quads matching the constraint, which bounds the
+// number of distinct nodes from above.
+func (it *Pipeline) Size() (int64, bool) {
+	if it.size == -1 {
+		var err error
+		it.size, err = it.qs.getSize("quads", it.constraint)
+		if err != nil {
+			it.err = err
+		}
+	}
+	return it.size, false
+}
+
+func (it *Pipeline) Type() graph.Type { return pipelineType }
+
+func (it *Pipeline) Sorted() bool { return false }
+
+func (it *Pipeline) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *Pipeline) Describe() graph.Description {
+	size, _ := it.Size()
+	return graph.Description{
+		UID:       it.UID(),
+		Name:      fmt.Sprint(it.constraint),
+		Type:      it.Type(),
+		Tags:      it.tags.Tags(),
+		Size:      size,
+		Direction: it.dir,
+	}
+}
+
+func (it *Pipeline) Stats() graph.IteratorStats {
+	size, _ := it.Size()
+	return graph.IteratorStats{
+		ContainsCost: 1,
+		NextCost:     5,
+		Size:         size,
+		Next:         it.runstats.Next,
+		Contains:     it.runstats.Contains,
+	}
+}
+
+// mergeConstraints combines the constraints of quad iterators that are
+// intersected. It returns false if two of them pin the same direction to
+// different nodes, in which case the intersection is empty.
+func mergeConstraints(its []*Iterator) (bson.M, bool) {
+	constraint := bson.M{}
+	for _, it := range its {
+		for k, v := range it.constraint {
+			if prev, ok := constraint[k]; ok && prev != v {
+				return nil, false
+			}
+			constraint[k] = v
+		}
+	}
+	return constraint, true
+}
@@ -20,13 +20,15 @@ import (
 	"errors"
 	"hash"
 	"sync"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
-	"github.com/barakmich/glog"
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/internal/lru"
 	"github.com/google/cayley/quad"
 )
 
@@ -47,16 +49,18 @@ var (
 type QuadStore struct {
 	session *mgo.Session
 	db      *mgo.Database
-	ids     *cache
-	sizes   *cache
+	safe    *mgo.Safe
+	ids     *lru.Cache
+	sizes   *lru.Cache
+	watch   graph.Notifier
 }
 
 func createNewMongoGraph(addr string, options graph.Options) error {
-	conn, err := mgo.Dial(addr)
+	conn, _, err := dialMongo(addr, options)
 	if err != nil {
 		return err
 	}
-	conn.SetSafe(&mgo.Safe{})
+	defer conn.Close()
 	dbName := DefaultDBName
 	val, ok, err := options.StringKey("database_name")
 	if err != nil {
@@ -79,6 +83,8 @@ func createNewMongoGraph(addr string, options graph.Options) error {
 	db.C("quads").EnsureIndex(indexOpts)
 	indexOpts.Key = []string{"label"}
 	db.C("quads").EnsureIndex(indexOpts)
+	indexOpts.Key = []string{"Expires"}
+	db.C("quads").EnsureIndex(indexOpts)
 	logOpts := mgo.Index{
 		Key:        []string{"LogID"},
 		Unique:     true,
@@ -92,11 +98,10 @@ func createNewMongoGraph(addr string, options graph.Options) error {
 
 func newQuadStore(addr string, options graph.Options) (graph.QuadStore, error) {
 	var qs QuadStore
-	conn, err := mgo.Dial(addr)
+	conn, safe, err := dialMongo(addr, options)
 	if err != nil {
 		return nil, err
 	}
-	conn.SetSafe(&mgo.Safe{})
 	dbName := DefaultDBName
 	val, ok, err := options.StringKey("database_name")
 	if err != nil {
@@ -106,8 +111,12 @@ func newQuadStore(addr string, options graph.Options) (graph.QuadStore, error) {
 	}
 	qs.db = conn.DB(dbName)
 	qs.session = conn
-	qs.ids = newCache(1 << 16)
-	qs.sizes = newCache(1 << 16)
+	qs.safe = safe
+	qs.ids, err = lru.NameCacheFromOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	qs.sizes = lru.New(1 << 16)
 	return &qs, nil
 }
 
@@ -158,12 +167,12 @@ func (qs *QuadStore) updateNodeBy(name string, inc int) error {
 
 	_, err := qs.db.C("nodes").UpsertId(node, upsert)
 	if err != nil {
-		glog.Errorf("Error updating node: %v", err)
+		clog.Errorf("Error updating node: %v", err)
 	}
 	return err
 }
 
-func (qs *QuadStore) updateQuad(q quad.Quad, id int64, proc graph.Procedure) error {
+func (qs *QuadStore) updateQuad(q quad.Quad, id int64, proc graph.Procedure, expires time.Time) error {
 	var setname string
 	if proc == graph.Add {
 		setname = "Added"
@@ -176,9 +185,14 @@ func (qs *QuadStore) updateQuad(q quad.Quad, id int64, proc graph.Procedure) err
 			setname: id,
 		},
 	}
+	if proc == graph.Add && !expires.IsZero() {
+		upsert["$set"] = bson.M{"Expires": expires.UnixNano()}
+	} else {
+		upsert["$unset"] = bson.M{"Expires": ""}
+	}
 	_, err := qs.db.C("quads").UpsertId(qs.getIDForQuad(q), upsert)
 	if err != nil {
-		glog.Errorf("Error: %v", err)
+		clog.Errorf("Error: %v", err)
 	}
 	return err
 }
@@ -193,7 +207,7 @@ func (qs *QuadStore) checkValid(key string) bool {
 		return false
 	}
 	if err != nil {
-		glog.Errorln("Other error checking valid quad: %s %v.", key, err)
+		clog.Errorln("Other error checking valid quad: %s %v.", key, err)
 		return false
 	}
 	if len(indexEntry.Added) <= len(indexEntry.Deleted) {
@@ -217,7 +231,7 @@ func (qs *QuadStore) updateLog(d graph.Delta) error {
 	}
 	err := qs.db.C("log").Insert(entry)
 	if err != nil {
-		glog.Errorf("Error updating log: %v", err)
+		clog.Errorf("Error updating log: %v", err)
 	}
 	return err
 }
@@ -225,7 +239,9 @@ func (qs *QuadStore) updateLog(d graph.Delta) error {
 func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
 	qs.session.SetSafe(nil)
 	ids := make(map[string]int)
-	// Pre-check the existence condition.
+	// Pre-check the existence condition, keeping the deltas that are not
+	// ignored to notify of.
+	var applied []graph.Delta
 	for _, d := range in {
 		if d.Action != graph.Add && d.Action != graph.Delete {
 			return errors.New("mongo: invalid action")
@@ -249,9 +265,10 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 				}
 			}
 		}
+		applied = append(applied, d)
 	}
-	if glog.V(2) {
-		glog.Infoln("Existence verified. Proceeding.")
+	if clog.V(2) {
+		clog.Infoln("Existence verified. Proceeding.")
 	}
 	for _, d := range in {
 		err := qs.updateLog(d)
@@ -260,7 +277,7 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 		}
 	}
 	for _, d := range in {
-		err := qs.updateQuad(d.Quad, d.ID.Int(), d.Action)
+		err := qs.updateQuad(d.Quad, d.ID.Int(), d.Action, d.Expires)
 		if err != nil {
 			return err
 		}
@@ -283,15 +300,78 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 			return err
 		}
 	}
-	qs.session.SetSafe(&mgo.Safe{})
+	qs.session.SetSafe(qs.safe)
+	qs.watch.Notify(applied)
 	return nil
 }
 
+func (qs *QuadStore) Subscribe(pattern quad.Quad) <-chan graph.Delta {
+	return qs.watch.Subscribe(pattern)
+}
+
+func (qs *QuadStore) Unsubscribe(c <-chan graph.Delta) {
+	qs.watch.Unsubscribe(c)
+}
+
+func (qs *QuadStore) ExpiredQuads(now time.Time) ([]quad.Quad, error) {
+	type quadEntry struct {
+		quad.Quad `bson:",inline"`
+		Added     []int64 `bson:"Added"`
+		Deleted   []int64 `bson:"Deleted"`
+	}
+	var quads []quad.Quad
+	iter := qs.db.C("quads").Find(bson.M{"Expires": bson.M{"$lte": now.UnixNano()}}).Iter()
+	for {
+		var doc quadEntry
+		if !iter.Next(&doc) {
+			break
+		}
+		if len(doc.Added) > len(doc.Deleted) {
+			quads = append(quads, doc.Quad)
+		}
+	}
+	err := iter.Close()
+	if err != nil {
+		return nil, err
+	}
+	return quads, nil
+}
+
+func (qs *QuadStore) MatchingQuads(pattern quad.Quad) ([]quad.Quad, error) {
+	type quadEntry struct {
+		quad.Quad `bson:",inline"`
+		Added     []int64 `bson:"Added"`
+		Deleted   []int64 `bson:"Deleted"`
+	}
+	constraint := bson.M{}
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		if v := pattern.Get(d); v != "" {
+			constraint[d.String()] = v
+		}
+	}
+	var quads []quad.Quad
+	iter := qs.db.C("quads").Find(constraint).Iter()
+	for {
+		var doc quadEntry
+		if !iter.Next(&doc) {
+			break
+		}
+		if len(doc.Added) > len(doc.Deleted) {
+			quads = append(quads, doc.Quad)
+		}
+	}
+	err := iter.Close()
+	if err != nil {
+		return nil, err
+	}
+	return quads, nil
+}
+
 func (qs *QuadStore) Quad(val graph.Value) quad.Quad {
 	var q quad.Quad
 	err := qs.db.C("quads").FindId(val.(string)).One(&q)
 	if err != nil {
-		glog.Errorf("Error: Couldn't retrieve quad %s %v", val, err)
+		clog.Errorf("Error: Couldn't retrieve quad %s %v", val, err)
 	}
 	return q
 }
@@ -320,23 +400,128 @@ func (qs *QuadStore) NameOf(v graph.Value) string {
 	var node MongoNode
 	err := qs.db.C("nodes").FindId(v.(string)).One(&node)
 	if err != nil {
-		glog.Errorf("Error: Couldn't retrieve node %s %v", v, err)
+		clog.Errorf("Error: Couldn't retrieve node %s %v", v, err)
 	} else if node.ID != "" && node.Name != "" {
 		qs.ids.Put(v.(string), node.Name)
 	}
 	return node.Name
 }
 
+// ValuesOf returns the value of each name; values are hashes of the names, so
+// this needs no round trip.
+func (qs *QuadStore) ValuesOf(names []string) []graph.Value {
+	out := make([]graph.Value, len(names))
+	for i, name := range names {
+		out[i] = hashOf(name)
+	}
+	return out
+}
+
+// NamesOf returns the name of each value, fetching every one that is not
+// cached in a single query.
+func (qs *QuadStore) NamesOf(values []graph.Value) []string {
+	out := make([]string, len(values))
+	var missing []string
+	for i, v := range values {
+		if name, ok := qs.ids.Get(v.(string)); ok {
+			out[i] = name.(string)
+		} else {
+			missing = append(missing, v.(string))
+		}
+	}
+	if len(missing) == 0 {
+		return out
+	}
+	var nodes []MongoNode
+	err := qs.db.C("nodes").Find(bson.M{"_id": bson.M{"$in": missing}}).All(&nodes)
+	if err != nil {
+		clog.Errorf("Error: Couldn't retrieve nodes %v", err)
+		return out
+	}
+	names := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		if node.ID != "" && node.Name != "" {
+			names[node.ID] = node.Name
+			qs.ids.Put(node.ID, node.Name)
+		}
+	}
+	for i, v := range values {
+		if out[i] == "" {
+			out[i] = names[v.(string)]
+		}
+	}
+	return out
+}
+
+// CollectGarbage removes the nodes with no live quads that no quad, live or
+// deleted, has in any direction.
+func (qs *QuadStore) CollectGarbage() (graph.GCStats, error) {
+	var stats graph.GCStats
+	iter := qs.db.C("nodes").Find(bson.M{"Size": bson.M{"$lte": 0}}).Iter()
+	var node MongoNode
+	for iter.Next(&node) {
+		var refs []bson.M
+		for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+			refs = append(refs, bson.M{d.String(): node.Name})
+		}
+		n, err := qs.db.C("quads").Find(bson.M{"$or": refs}).Limit(1).Count()
+		if err != nil {
+			iter.Close()
+			return graph.GCStats{}, err
+		}
+		if n > 0 {
+			continue
+		}
+		err = qs.db.C("nodes").RemoveId(node.ID)
+		if err != nil && err != mgo.ErrNotFound {
+			iter.Close()
+			return graph.GCStats{}, err
+		}
+		stats.Nodes++
+		stats.Bytes += int64(len(node.ID) + len(node.Name))
+	}
+	return stats, iter.Close()
+}
+
+// SizeOf returns the number of live quads referencing the given node, as
+// tracked in the nodes collection.
+func (qs *QuadStore) SizeOf(v graph.Value) int64 {
+	if v == nil {
+		return 0
+	}
+	var node MongoNode
+	err := qs.db.C("nodes").FindId(v.(string)).One(&node)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			clog.Errorf("Error: Couldn't retrieve node %s %v", v, err)
+		}
+		return 0
+	}
+	return int64(node.Size)
+}
+
 func (qs *QuadStore) Size() int64 {
 	// TODO(barakmich): Make size real; store it in the log, and retrieve it.
 	count, err := qs.db.C("quads").Count()
 	if err != nil {
-		glog.Errorf("Error: %v", err)
+		clog.Errorf("Error: %v", err)
 		return 0
 	}
 	return int64(count)
 }
 
+// NodeCount returns the number of documents in the nodes collection.
+func (qs *QuadStore) NodeCount() (int64, error) {
+	count, err := qs.db.C("nodes").Count()
+	return int64(count), err
+}
+
+// Tune resizes the cache of node names to the "name_cache_size" option,
+// if it is given. A cache disabled when the store was opened stays disabled.
+func (qs *QuadStore) Tune(options graph.Options) error {
+	return qs.ids.ResizeFromOptions(options)
+}
+
 func (qs *QuadStore) Horizon() graph.PrimaryKey {
 	var log MongoLogEntry
 	err := qs.db.C("log").Find(nil).Sort("-LogID").One(&log)
@@ -344,7 +529,7 @@ func (qs *QuadStore) Horizon() graph.PrimaryKey {
 		if err == mgo.ErrNotFound {
 			return graph.NewSequentialKey(0)
 		}
-		glog.Errorf("Could not get Horizon from Mongo: %v", err)
+		clog.Errorf("Could not get Horizon from Mongo: %v", err)
 	}
 	return graph.NewSequentialKey(log.LogID)
 }
@@ -354,6 +539,7 @@ func (qs *QuadStore) FixedIterator() graph.FixedIterator {
 }
 
 func (qs *QuadStore) Close() {
+	qs.watch.Close()
 	qs.db.Session.Close()
 }
 
@@ -384,7 +570,7 @@ func (qs *QuadStore) getSize(collection string, constraint bson.M) (int64, error
 	var size int
 	bytes, err := bson.Marshal(constraint)
 	if err != nil {
-		glog.Errorf("Couldn't marshal internal constraint")
+		clog.Errorf("Couldn't marshal internal constraint")
 		return -1, err
 	}
 	key := collection + string(bytes)
@@ -397,7 +583,7 @@ func (qs *QuadStore) getSize(collection string, constraint bson.M) (int64, error
 		size, err = qs.db.C(collection).Find(constraint).Count()
 	}
 	if err != nil {
-		glog.Errorln("Trouble getting size for iterator! ", err)
+		clog.Errorln("Trouble getting size for iterator! ", err)
 		return -1, err
 	}
 	qs.sizes.Put(key, int64(size))
@@ -15,8 +15,7 @@
 package mongo
 
 import (
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 )
@@ -27,23 +26,24 @@ func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool)
 		return qs.optimizeLinksTo(it.(*iterator.LinksTo))
 	case graph.And:
 		return qs.optimizeAndIterator(it.(*iterator.And))
-
+	case graph.HasA:
+		return qs.optimizeHasA(it.(*iterator.HasA))
 	}
 	return it, false
 }
 
 func (qs *QuadStore) optimizeAndIterator(it *iterator.And) (graph.Iterator, bool) {
 	// Fail fast if nothing can happen
-	glog.V(4).Infoln("Entering optimizeAndIterator", it.UID())
+	clog.V(4).Infoln("Entering optimizeAndIterator", it.UID())
 	found := false
 	for _, it := range it.SubIterators() {
-		glog.V(4).Infoln(it.Type())
+		clog.V(4).Infoln(it.Type())
 		if it.Type() == mongoType {
 			found = true
 		}
 	}
 	if !found {
-		glog.V(4).Infoln("Aborting optimizeAndIterator")
+		clog.V(4).Infoln("Aborting optimizeAndIterator")
 		return it, false
 	}
 
@@ -118,3 +118,50 @@ func (qs *QuadStore) optimizeLinksTo(it *iterator.LinksTo) (graph.Iterator, bool
 	}
 	return it, false
 }
+
+// optimizeHasA pushes a HasA over quads that Mongo can select by itself --
+// a single indexed quad iterator, or the intersection of several -- down into
+// an aggregation pipeline that returns the distinct nodes directly.
+func (qs *QuadStore) optimizeHasA(it *iterator.HasA) (graph.Iterator, bool) {
+	subs := it.SubIterators()
+	if len(subs) != 1 {
+		return it, false
+	}
+	primary := subs[0]
+	var quadIts []*Iterator
+	switch primary.Type() {
+	case mongoType:
+		quadIts = append(quadIts, primary.(*Iterator))
+	case graph.And:
+		if len(primary.Tagger().Tags()) != 0 || len(primary.Tagger().Fixed()) != 0 {
+			return it, false
+		}
+		for _, sub := range primary.SubIterators() {
+			if sub.Type() != mongoType {
+				return it, false
+			}
+			quadIts = append(quadIts, sub.(*Iterator))
+		}
+	default:
+		return it, false
+	}
+	for _, sub := range quadIts {
+		// Tags on quads cannot be recovered from a set of nodes.
+		if sub.collection != "quads" || len(sub.tags.Tags()) != 0 {
+			return it, false
+		}
+	}
+	constraint, ok := mergeConstraints(quadIts)
+	if !ok {
+		return iterator.NewNull(), true
+	}
+	clog.V(4).Infoln("Replacing HasA", it.UID(), "with an aggregation pipeline on", constraint)
+	p := NewPipeline(qs, constraint, it.Direction())
+	p.tags.CopyFrom(it)
+	for _, sub := range quadIts {
+		for tag, val := range sub.tags.Fixed() {
+			p.tags.AddFixed(tag, val)
+		}
+	}
+	return p, true
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/google/cayley/quad"
+
+// HasQuad returns whether qs holds q.
+func HasQuad(qs QuadStore, q quad.Quad) (bool, error) {
+	n, err := QuadCount(qs, q)
+	return n > 0, err
+}
+
+// QuadCount returns the number of copies of q that qs holds, which is at most
+// one unless it is a multiset. Stores that are not QuadCounters are read
+// through the quads of the subject of q.
+func QuadCount(qs QuadStore, q quad.Quad) (int64, error) {
+	if qc, ok := qs.(QuadCounter); ok {
+		return qc.QuadCount(q), nil
+	}
+	v := qs.ValueOf(q.Subject)
+	if v == nil {
+		return 0, nil
+	}
+	it := qs.QuadIterator(quad.Subject, v)
+	defer it.Close()
+	var n int64
+	for Next(it) {
+		if qs.Quad(it.Result()) == q {
+			n++
+		}
+	}
+	return n, it.Err()
+}
+
+// Changes returns the deltas of a write that would change qs, leaving out the
+// additions of quads it holds, unless it is a multiset, and the deletions of
+// quads it does not, which the ignore options skip. It must be called before
+// the write is applied, with other writes held off.
+func Changes(qs QuadStore, deltas []Delta, ignoreOpts IgnoreOpts) ([]Delta, error) {
+	if !ignoreOpts.IgnoreDup && !ignoreOpts.IgnoreMissing {
+		// The write is applied completely or not at all.
+		return deltas, nil
+	}
+	multiset := IsMultiset(qs)
+	counts := make(map[quad.Quad]int64)
+	var changes []Delta
+	for _, d := range deltas {
+		n, ok := counts[d.Quad]
+		if !ok {
+			var err error
+			n, err = QuadCount(qs, d.Quad)
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch d.Action {
+		case Add:
+			if n > 0 && !multiset {
+				counts[d.Quad] = n
+				continue
+			}
+			n++
+		case Delete:
+			if n == 0 {
+				counts[d.Quad] = n
+				continue
+			}
+			n--
+		}
+		counts[d.Quad] = n
+		changes = append(changes, d)
+	}
+	return changes, nil
+}
+
+// IsMultiset returns whether qs holds a copy of a quad for each time it was
+// added.
+func IsMultiset(qs QuadStore) bool {
+	qc, ok := qs.(QuadCounter)
+	return ok && qc.Multiset()
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/google/cayley/quad"
+
+// AllDirections are the directions QuadsAllOn searches by default.
+var AllDirections = []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label}
+
+// QuadsAllOn returns an iterator over the quads that have the node v in any
+// of the given directions, or in any direction if none are given. Each quad
+// is returned once, however many of its directions hold v.
+//
+// The quads are read when QuadsAllOn is called, so it suits nodes with a
+// moderate number of quads.
+func QuadsAllOn(qs QuadStore, v Value, dirs ...quad.Direction) (Iterator, error) {
+	if len(dirs) == 0 {
+		dirs = AllDirections
+	}
+	if len(dirs) == 1 {
+		return qs.QuadIterator(dirs[0], v), nil
+	}
+	name := qs.NameOf(v)
+	fixed := qs.FixedIterator()
+	for i, d := range dirs {
+		it := qs.QuadIterator(d, v)
+	quads:
+		for Next(it) {
+			q := qs.Quad(it.Result())
+			// Quads with v in an earlier direction were already found.
+			for _, prev := range dirs[:i] {
+				if q.Get(prev) == name {
+					continue quads
+				}
+			}
+			fixed.Add(it.Result())
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fixed, nil
+}
+
+// QuadsAllOn returns an iterator over the quads that have the node v in any
+// of the given directions of the handle's store.
+func (h *Handle) QuadsAllOn(v Value, dirs ...quad.Direction) (Iterator, error) {
+	return QuadsAllOn(h.QuadStore, v, dirs...)
+}
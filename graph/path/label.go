@@ -0,0 +1,172 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+// Defines SaveLabel, and the iterator that tags the labels of the quads it
+// passes on.
+
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+var labelType graph.Type
+
+func init() {
+	labelType = graph.RegisterIterator("label")
+}
+
+// SaveLabel makes the following In, Out and Save morphisms of this Path tag
+// the nodes they reach with the label of the quad they followed, so that it
+// is known which named graph an edge came from. Quads without a label leave
+// the tag unset. With an empty tag, labels are no longer tagged.
+//
+// For example:
+//  // Returns the nodes that "A" follows, tagged with the graph saying so.
+//  StartPath(qs, "A").SaveLabel("graph").Out("follows")
+func (p *Path) SaveLabel(tag string) *Path {
+	p.stack = append(p.stack, saveLabelMorphism(tag))
+	return p
+}
+
+func saveLabelMorphism(tag string) morphism {
+	return morphism{
+		"save_label",
+		func() morphism { return saveLabelMorphism(tag) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			out := *ctx
+			out.labelTag = tag
+			return it, &out
+		},
+	}
+}
+
+// labelQuads restricts the quads to be followed to those of the label
+// context, and tags their labels if asked to.
+func labelQuads(qs graph.QuadStore, quads *iterator.And, ctx *context) graph.Iterator {
+	if ctx.labelSet != nil {
+		labels := ctx.labelSet.BuildIteratorOn(qs)
+		quads.AddSubIterator(iterator.NewLinksTo(qs, labels, quad.Label))
+	}
+	if ctx.labelTag == "" {
+		return quads
+	}
+	return newLabelIterator(qs, quads, ctx.labelTag)
+}
+
+// labelIterator passes on the quads of its subiterator, tagging each with its
+// label.
+type labelIterator struct {
+	uid   uint64
+	tags  graph.Tagger
+	qs    graph.QuadStore
+	subIt graph.Iterator
+	tag   string
+
+	result graph.Value
+}
+
+func newLabelIterator(qs graph.QuadStore, subIt graph.Iterator, tag string) *labelIterator {
+	return &labelIterator{
+		uid:   iterator.NextUID(),
+		qs:    qs,
+		subIt: subIt,
+		tag:   tag,
+	}
+}
+
+func (it *labelIterator) UID() uint64 { return it.uid }
+
+func (it *labelIterator) Reset() {
+	it.result = nil
+	it.subIt.Reset()
+}
+
+func (it *labelIterator) Tagger() *graph.Tagger { return &it.tags }
+
+func (it *labelIterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.result
+	}
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+	if it.qs.Quad(it.result).Label != "" {
+		dst[it.tag] = it.qs.QuadDirection(it.result, quad.Label)
+	}
+	it.subIt.TagResults(dst)
+}
+
+func (it *labelIterator) Clone() graph.Iterator {
+	out := newLabelIterator(it.qs, it.subIt.Clone(), it.tag)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *labelIterator) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *labelIterator) Next() bool {
+	graph.NextLogIn(it)
+	if !graph.Next(it.subIt) {
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.subIt.Result()
+	return graph.NextLogOut(it, it.result, true)
+}
+
+func (it *labelIterator) Err() error { return it.subIt.Err() }
+
+func (it *labelIterator) Result() graph.Value { return it.result }
+
+func (it *labelIterator) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *labelIterator) NextPath() bool { return it.subIt.NextPath() }
+
+func (it *labelIterator) Close() error { return it.subIt.Close() }
+
+func (it *labelIterator) Type() graph.Type { return labelType }
+
+func (it *labelIterator) Optimize() (graph.Iterator, bool) {
+	newIt, optimized := it.subIt.Optimize()
+	if optimized {
+		it.subIt = newIt
+	}
+	return it, false
+}
+
+func (it *labelIterator) Stats() graph.IteratorStats { return it.subIt.Stats() }
+
+func (it *labelIterator) Size() (int64, bool) { return it.subIt.Size() }
+
+func (it *labelIterator) Describe() graph.Description {
+	return graph.Description{
+		UID:       it.UID(),
+		Type:      it.Type(),
+		Tags:      it.tags.Tags(),
+		Iterators: []graph.Description{it.subIt.Describe()},
+	}
+}
+
+var _ graph.Nexter = &labelIterator{}
@@ -15,6 +15,10 @@
 package path
 
 import (
+	"errors"
+	"time"
+
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
@@ -23,9 +27,32 @@ import (
 type morphism struct {
 	Name     string
 	Reversal func() morphism
-	Apply    graph.ApplyMorphism
+	Apply    applyMorphism
+}
+
+// applyMorphism is like graph.ApplyMorphism, but also carries the context
+// set by earlier morphisms of the same path on to later ones.
+type applyMorphism func(graph.QuadStore, graph.Iterator, *context) (graph.Iterator, *context)
+
+// context is the state a path's morphisms are applied in.
+type context struct {
+	// labelSet is the path of the labels that the quads followed by In,
+	// Out and the Save morphisms must have. If nil, quads of any label are
+	// followed.
+	labelSet *Path
+
+	// labelTag is the tag given to the labels of the quads followed by In,
+	// Out and Save, if not empty.
+	labelTag string
+
+	// aliases are the nodes In and Out treat as one, linked by the
+	// predicates given to SameAs. If nil, every node stands for itself.
+	aliases iterator.Aliases
 }
 
+// OWLSameAs is the predicate conventionally used with SameAs.
+const OWLSameAs = "<http://www.w3.org/2002/07/owl#sameAs>"
+
 // Path represents either a morphism (a pre-defined path stored for later use),
 // or a concrete path, consisting of a morphism and an underlying QuadStore.
 type Path struct {
@@ -68,19 +95,167 @@ func NewPath(qs graph.QuadStore) *Path {
 }
 
 // Reverse returns a new Path that is the reverse of the current one.
+//
+// The morphisms that set the context of those after them, like LabelContext,
+// SameAs and SaveLabel, are moved so that each reversed morphism is applied
+// in the context it had.
 func (p *Path) Reverse() *Path {
+	// The context morphisms in effect before each morphism, by name.
+	contexts := make([]map[string]int, len(p.stack))
+	active := make(map[string]int)
+	for i, m := range p.stack {
+		if _, ok := resetContext(m.Name); ok {
+			active[m.Name] = i
+			continue
+		}
+		contexts[i] = make(map[string]int, len(active))
+		for name, j := range active {
+			contexts[i][name] = j
+		}
+	}
+
 	newPath := NewPath(p.qs)
+	set := make(map[string]int)
 	for i := len(p.stack) - 1; i >= 0; i-- {
-		newPath.stack = append(newPath.stack, p.stack[i].Reversal())
+		m := p.stack[i]
+		if _, ok := resetContext(m.Name); ok {
+			continue
+		}
+		for name := range set {
+			if _, ok := contexts[i][name]; !ok {
+				reset, _ := resetContext(name)
+				newPath.stack = append(newPath.stack, reset)
+				delete(set, name)
+			}
+		}
+		for name, j := range contexts[i] {
+			if k, ok := set[name]; !ok || k != j {
+				newPath.stack = append(newPath.stack, p.stack[j])
+				set[name] = j
+			}
+		}
+		newPath.stack = append(newPath.stack, m.Reversal())
 	}
 	return newPath
 }
 
+// resetContext returns the morphism clearing the context set by the
+// morphisms of the given name, and whether they set one.
+func resetContext(name string) (morphism, bool) {
+	switch name {
+	case "label_context":
+		return labelContextMorphism(), true
+	case "same_as":
+		return sameAsMorphism(), true
+	case "save_label":
+		return saveLabelMorphism(""), true
+	}
+	return morphism{}, false
+}
+
 func (p *Path) Is(nodes ...string) *Path {
 	p.stack = append(p.stack, isMorphism(nodes...))
 	return p
 }
 
+// LabelContext restricts the following In and Out morphisms of this Path to
+// quads with one of the given labels. The labels may be given like the
+// predicates of Out; with none, quads of any label are followed again.
+//
+// For example:
+//  // Returns the nodes that "A" follows in the "social" graph.
+//  StartPath(qs, "A").LabelContext("social").Out("follows")
+func (p *Path) LabelContext(via ...interface{}) *Path {
+	p.stack = append(p.stack, labelContextMorphism(via...))
+	return p
+}
+
+// SameAs makes the following In and Out morphisms of this Path treat nodes
+// linked, in either direction and through any number of links, by one of
+// the given predicates as a single node that has the edges of all of them.
+// The predicates may be given like those of Out; with none, every node
+// stands for itself again.
+//
+// For example:
+//  // Returns the nodes that "A", or any node the same as "A", follows.
+//  StartPath(qs, "A").SameAs(OWLSameAs).Out("follows")
+func (p *Path) SameAs(via ...interface{}) *Path {
+	p.stack = append(p.stack, sameAsMorphism(via...))
+	return p
+}
+
+// Search updates this Path to represent the nodes among the current ones
+// whose names match the text query, looked up in the text index of the
+// QuadStore. It represents no nodes if the QuadStore keeps no text index.
+//
+// For example:
+//  // Returns the nodes whose name mentions "Smith".
+//  StartPath(qs).Search("smith").In("name")
+func (p *Path) Search(text string) *Path {
+	p.stack = append(p.stack, searchMorphism(text))
+	return p
+}
+
+// Near updates this Path to represent the nodes among the current ones that
+// are geographic points within radius metres of the given latitude and
+// longitude, in degrees.
+//
+// For example:
+//  // Returns the nodes located within a kilometre of the Eiffel Tower.
+//  StartPath(qs).Near(48.8584, 2.2945, 1000).In("location")
+func (p *Path) Near(lat, lon, radius float64) *Path {
+	p.stack = append(p.stack, nearMorphism(quad.GeoPoint{Lat: lat, Lon: lon}, radius))
+	return p
+}
+
+// Before updates this Path to represent the nodes among the current ones that
+// are xsd:dateTime or xsd:date literals of times before t.
+//
+// For example:
+//  // Returns the people born before 1970.
+//  StartPath(qs).Before(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)).In("born")
+func (p *Path) Before(t time.Time) *Path {
+	p.stack = append(p.stack, compareMorphism(iterator.CompareLT, t))
+	return p
+}
+
+// After updates this Path to represent the nodes among the current ones that
+// are xsd:dateTime or xsd:date literals of times after t.
+func (p *Path) After(t time.Time) *Path {
+	p.stack = append(p.stack, compareMorphism(iterator.CompareGT, t))
+	return p
+}
+
+// Between updates this Path to represent the nodes among the current ones
+// that are xsd:dateTime or xsd:date literals of times from a to b, both
+// included.
+func (p *Path) Between(a, b time.Time) *Path {
+	p.stack = append(p.stack,
+		compareMorphism(iterator.CompareGTE, a),
+		compareMorphism(iterator.CompareLTE, b),
+	)
+	return p
+}
+
+// Save tags each of the current nodes with the objects of its quads with the
+// given predicate, following the label context. Nodes without such a quad
+// are dropped.
+//
+// For example:
+//  // Tags "A" with the nodes it follows, as "target".
+//  StartPath(qs, "A").Save("follows", "target")
+func (p *Path) Save(via interface{}, tag string) *Path {
+	p.stack = append(p.stack, saveMorphism(via, tag, false))
+	return p
+}
+
+// SaveReverse is like Save, tagging each of the current nodes with the
+// subjects of the quads with the given predicate it is the object of.
+func (p *Path) SaveReverse(via interface{}, tag string) *Path {
+	p.stack = append(p.stack, saveMorphism(via, tag, true))
+	return p
+}
+
 func (p *Path) Tag(tags ...string) *Path {
 	p.stack = append(p.stack, tagMorphism(tags...))
 	return p
@@ -115,19 +290,46 @@ func (p *Path) In(via ...interface{}) *Path {
 }
 
 // And updates the current Path to represent the nodes that match both the
-// current Path so far, and the given Path.
+// current Path so far, and the given Path. The results have the tags of
+// both; where they share a tag, its value is that of either. RenameTags and
+// DropTags on the given Path keep their tags apart.
 func (p *Path) And(path *Path) *Path {
 	p.stack = append(p.stack, andMorphism(path))
 	return p
 }
 
 // And updates the current Path to represent the nodes that match either the
-// current Path so far, or the given Path.
+// current Path so far, or the given Path. The results have the tags of the
+// Path they match.
 func (p *Path) Or(path *Path) *Path {
 	p.stack = append(p.stack, orMorphism(path))
 	return p
 }
 
+// RenameTags updates the current Path to rename the tags its results have
+// been given so far, as rename says. Tags renamed to the empty string are
+// dropped.
+//
+// For example:
+//  // Returns the nodes A and C both follow, with A tagged "who" and C
+//  // tagged "other".
+//  StartPath(qs, "A").Tag("who").Out("follows").And(
+//  	StartPath(qs, "C").Tag("who").Out("follows").RenameTags(map[string]string{"who": "other"}))
+func (p *Path) RenameTags(rename map[string]string) *Path {
+	p.stack = append(p.stack, retagMorphism(rename))
+	return p
+}
+
+// DropTags updates the current Path to drop the given tags from its results.
+func (p *Path) DropTags(tags ...string) *Path {
+	rename := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		rename[tag] = ""
+	}
+	p.stack = append(p.stack, retagMorphism(rename))
+	return p
+}
+
 // Except updates the current Path to represent the all of the current nodes
 // except those in the supplied Path.
 //
@@ -149,6 +351,23 @@ func (p *Path) FollowReverse(path *Path) *Path {
 	return p
 }
 
+// AtRevision returns a copy of this Path bound to its QuadStore as it was once
+// the delta with the given ID had been applied. It fails for morphisms, and
+// for QuadStores that do not keep revisions.
+func (p *Path) AtRevision(horizon int64) (*Path, error) {
+	if p.IsMorphism() {
+		return nil, errors.New("path: a morphism has no QuadStore to revise")
+	}
+	qs, err := graph.AtRevision(p.qs, horizon)
+	if err != nil {
+		return nil, err
+	}
+	return &Path{
+		stack: append([]morphism(nil), p.stack...),
+		qs:    qs,
+	}, nil
+}
+
 // BuildIterator returns an iterator from this given Path.  Note that you must
 // call this with a full path (not a morphism), since a morphism does not have
 // the ability to fetch the underlying quads.  This function will panic if
@@ -172,8 +391,9 @@ func (p *Path) BuildIteratorOn(qs graph.QuadStore) graph.Iterator {
 func (p *Path) Morphism() graph.ApplyMorphism {
 	return func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
 		i := it.Clone()
+		ctx := &context{}
 		for _, m := range p.stack {
-			i = m.Apply(qs, i)
+			i, ctx = m.Apply(qs, i, ctx)
 		}
 		return i
 	}
@@ -183,21 +403,61 @@ func isMorphism(nodes ...string) morphism {
 	return morphism{
 		"is",
 		func() morphism { return isMorphism(nodes...) },
-		func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			var sub graph.Iterator
 			if len(nodes) == 0 {
 				sub = qs.NodesAllIterator()
 			} else {
-				fixed := qs.FixedIterator()
-				for _, n := range nodes {
-					fixed.Add(qs.ValueOf(n))
-				}
-				sub = fixed
+				sub = graph.FixedIteratorOf(qs, nodes...)
+			}
+			and := iterator.NewAnd(qs)
+			and.AddSubIterator(sub)
+			and.AddSubIterator(it)
+			return and, ctx
+		},
+	}
+}
+
+func searchMorphism(text string) morphism {
+	return morphism{
+		"search",
+		func() morphism { return searchMorphism(text) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			var sub graph.Iterator
+			if s, ok := qs.(graph.FullTextSearcher); ok {
+				sub = s.SearchIterator(text)
+			} else {
+				sub = iterator.NewNull()
 			}
 			and := iterator.NewAnd(qs)
 			and.AddSubIterator(sub)
 			and.AddSubIterator(it)
-			return and
+			return and, ctx
+		},
+	}
+}
+
+// compareMorphism filters the nodes by comparing the values they hold to val,
+// reading them from the range indexes of the store if it keeps them.
+func compareMorphism(op iterator.Operator, val interface{}) morphism {
+	return morphism{
+		"compare",
+		func() morphism { return compareMorphism(op, val) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			return iterator.NewComparison(it, op, val, qs), ctx
+		},
+	}
+}
+
+func nearMorphism(center quad.GeoPoint, radius float64) morphism {
+	return morphism{
+		"near",
+		func() morphism { return nearMorphism(center, radius) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			and := iterator.NewAnd(qs)
+			and.AddSubIterator(graph.NearIterator(qs, center, radius))
+			and.AddSubIterator(it)
+			return and, ctx
 		},
 	}
 }
@@ -206,21 +466,52 @@ func tagMorphism(tags ...string) morphism {
 	return morphism{
 		"tag",
 		func() morphism { return tagMorphism(tags...) },
-		func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			for _, t := range tags {
 				it.Tagger().Add(t)
 			}
-			return it
+			return it, ctx
+		}}
+}
+
+func retagMorphism(rename map[string]string) morphism {
+	return morphism{
+		"retag",
+		func() morphism { return retagMorphism(rename) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			return iterator.NewRetag(it, rename), ctx
 		}}
 }
 
+func saveMorphism(via interface{}, tag string, reverse bool) morphism {
+	return morphism{
+		"save",
+		func() morphism { return saveMorphism(via, tag, reverse) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			from, to := quad.Subject, quad.Object
+			if reverse {
+				from, to = to, from
+			}
+			all := qs.NodesAllIterator()
+			all.Tagger().Add(tag)
+			quads := iterator.NewAnd(qs)
+			quads.AddSubIterator(iterator.NewLinksTo(qs, buildViaPath(qs, via).BuildIterator(), quad.Predicate))
+			quads.AddSubIterator(iterator.NewLinksTo(qs, all, to))
+			and := iterator.NewAnd(qs)
+			and.AddSubIterator(iterator.NewHasA(qs, labelQuads(qs, quads, ctx), from))
+			and.AddSubIterator(it)
+			return and, ctx
+		},
+	}
+}
+
 func outMorphism(via ...interface{}) morphism {
 	return morphism{
 		"out",
 		func() morphism { return inMorphism(via...) },
-		func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			path := buildViaPath(qs, via...)
-			return inOutIterator(path, it, false)
+			return inOutIterator(path, it, false, ctx), ctx
 		},
 	}
 }
@@ -229,9 +520,9 @@ func inMorphism(via ...interface{}) morphism {
 	return morphism{
 		"in",
 		func() morphism { return outMorphism(via...) },
-		func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			path := buildViaPath(qs, via...)
-			return inOutIterator(path, it, true)
+			return inOutIterator(path, it, true, ctx), ctx
 		},
 	}
 }
@@ -240,11 +531,11 @@ func iteratorMorphism(it graph.Iterator) morphism {
 	return morphism{
 		"iterator",
 		func() morphism { return iteratorMorphism(it) },
-		func(qs graph.QuadStore, subIt graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, subIt graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			and := iterator.NewAnd(qs)
 			and.AddSubIterator(it)
 			and.AddSubIterator(subIt)
-			return and
+			return and, ctx
 		},
 	}
 }
@@ -253,12 +544,12 @@ func andMorphism(p *Path) morphism {
 	return morphism{
 		"and",
 		func() morphism { return andMorphism(p) },
-		func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			subIt := p.BuildIteratorOn(qs)
 			and := iterator.NewAnd(qs)
 			and.AddSubIterator(it)
 			and.AddSubIterator(subIt)
-			return and
+			return and, ctx
 		},
 	}
 }
@@ -267,12 +558,12 @@ func orMorphism(p *Path) morphism {
 	return morphism{
 		"or",
 		func() morphism { return orMorphism(p) },
-		func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			subIt := p.BuildIteratorOn(qs)
 			and := iterator.NewOr()
 			and.AddSubIterator(it)
 			and.AddSubIterator(subIt)
-			return and
+			return and, ctx
 		},
 	}
 }
@@ -281,8 +572,8 @@ func followMorphism(p *Path) morphism {
 	return morphism{
 		"follow",
 		func() morphism { return followMorphism(p.Reverse()) },
-		func(qs graph.QuadStore, base graph.Iterator) graph.Iterator {
-			return p.Morphism()(qs, base)
+		func(qs graph.QuadStore, base graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			return p.Morphism()(qs, base), ctx
 		},
 	}
 }
@@ -291,27 +582,130 @@ func exceptMorphism(p *Path) morphism {
 	return morphism{
 		"except",
 		func() morphism { return exceptMorphism(p) },
-		func(qs graph.QuadStore, base graph.Iterator) graph.Iterator {
+		func(qs graph.QuadStore, base graph.Iterator, ctx *context) (graph.Iterator, *context) {
 			subIt := p.BuildIteratorOn(qs)
 			notIt := iterator.NewNot(subIt, qs.NodesAllIterator())
 			and := iterator.NewAnd(qs)
 			and.AddSubIterator(base)
 			and.AddSubIterator(notIt)
-			return and
+			return and, ctx
 		},
 	}
 }
 
-func inOutIterator(viaPath *Path, it graph.Iterator, reverse bool) graph.Iterator {
+func labelContextMorphism(via ...interface{}) morphism {
+	return morphism{
+		"label_context",
+		func() morphism { return labelContextMorphism(via...) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			out := *ctx
+			out.labelSet = nil
+			if len(via) != 0 {
+				out.labelSet = buildViaPath(qs, via...)
+			}
+			return it, &out
+		},
+	}
+}
+
+func sameAsMorphism(via ...interface{}) morphism {
+	return morphism{
+		"same_as",
+		func() morphism { return sameAsMorphism(via...) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			out := *ctx
+			out.aliases = nil
+			if len(via) != 0 {
+				out.aliases = aliases(qs, buildViaPath(qs, via...))
+			}
+			return it, &out
+		},
+	}
+}
+
+// aliases returns the nodes each node is linked to by the predicates of
+// viaPath, directly or not.
+func aliases(qs graph.QuadStore, viaPath *Path) iterator.Aliases {
+	// The linked nodes are grouped with a union-find over their keys.
+	var (
+		parent = make(map[interface{}]interface{})
+		values = make(map[interface{}]graph.Value)
+	)
+	var find func(k interface{}) interface{}
+	find = func(k interface{}) interface{} {
+		p := parent[k]
+		if p == k {
+			return k
+		}
+		root := find(p)
+		parent[k] = root
+		return root
+	}
+	add := func(v graph.Value) interface{} {
+		k := v
+		if h, ok := v.(iterator.Keyer); ok {
+			k = h.Key()
+		}
+		if _, ok := parent[k]; !ok {
+			parent[k] = k
+			values[k] = v
+		}
+		return find(k)
+	}
+
+	preds := viaPath.BuildIteratorOn(qs)
+	defer preds.Close()
+	for graph.Next(preds) {
+		it := qs.QuadIterator(quad.Predicate, preds.Result())
+		for graph.Next(it) {
+			q := it.Result()
+			a := add(qs.QuadDirection(q, quad.Subject))
+			b := add(qs.QuadDirection(q, quad.Object))
+			if a != b {
+				parent[a] = b
+			}
+		}
+		it.Close()
+	}
+
+	groups := make(map[interface{}][]graph.Value)
+	for k, v := range values {
+		root := find(k)
+		groups[root] = append(groups[root], v)
+	}
+	out := make(iterator.Aliases)
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		for i, v := range group {
+			others := make([]graph.Value, 0, len(group)-1)
+			others = append(others, group[:i]...)
+			out.Set(v, append(others, group[i+1:]...))
+		}
+	}
+	return out
+}
+
+func inOutIterator(viaPath *Path, it graph.Iterator, reverse bool, ctx *context) graph.Iterator {
 	in, out := quad.Subject, quad.Object
 	if reverse {
 		in, out = out, in
 	}
+	aliased := len(ctx.aliases) != 0
+	if aliased && it.Type() != graph.Alias {
+		it = iterator.NewAlias(it, ctx.aliases)
+	}
 	lto := iterator.NewLinksTo(viaPath.qs, it, in)
 	and := iterator.NewAnd(viaPath.qs)
 	and.AddSubIterator(iterator.NewLinksTo(viaPath.qs, viaPath.BuildIterator(), quad.Predicate))
 	and.AddSubIterator(lto)
-	return iterator.NewHasA(viaPath.qs, and, out)
+	hasa := iterator.NewHasA(viaPath.qs, labelQuads(viaPath.qs, and, ctx), out)
+	if aliased {
+		// The nodes reached stand for their aliases too.
+		return iterator.NewAlias(hasa, ctx.aliases)
+	}
+	return hasa
 }
 
 func buildViaPath(qs graph.QuadStore, via ...interface{}) *Path {
@@ -323,7 +717,7 @@ func buildViaPath(qs graph.QuadStore, via ...interface{}) *Path {
 		case *Path:
 			return v
 		case string:
-			return StartPath(qs, v)
+			return viaNodes(qs, expandPredicates(qs, v))
 		default:
 			panic("Invalid type passed to buildViaPath.")
 		}
@@ -336,5 +730,24 @@ func buildViaPath(qs graph.QuadStore, via ...interface{}) *Path {
 			panic("Non-string type passed to long Via path")
 		}
 	}
-	return StartPath(qs, strings...)
+	return viaNodes(qs, expandPredicates(qs, strings...))
+}
+
+// viaNodes returns the path of the given predicates, which follows none if
+// there are none, as when no predicate matches a pattern.
+func viaNodes(qs graph.QuadStore, nodes []string) *Path {
+	if len(nodes) == 0 {
+		return PathFromIterator(qs, iterator.NewNull())
+	}
+	return StartPath(qs, nodes...)
+}
+
+// expandPredicates replaces the patterns among the names of predicates by the
+// predicates of qs they match, or by none if they cannot be read.
+func expandPredicates(qs graph.QuadStore, names ...string) []string {
+	out, err := graph.ExpandPredicates(qs, names...)
+	if err != nil {
+		clog.Errorf("path: expanding predicates %q: %v", names, err)
+	}
+	return out
 }
@@ -18,6 +18,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/quad"
@@ -112,6 +113,21 @@ func testSet(qs graph.QuadStore) []test {
 			path:    StartPath(qs, "B").In("follows"),
 			expect:  []string{"A", "C", "D"},
 		},
+		{
+			message: "use out with a predicate pattern",
+			path:    StartPath(qs, "B").Out("fo*"),
+			expect:  []string{"F"},
+		},
+		{
+			message: "use out with predicate patterns and names",
+			path:    StartPath(qs, "B").Out("*s", "are"),
+			expect:  []string{"F", "cool"},
+		},
+		{
+			message: "use in with a predicate pattern matching nothing",
+			path:    StartPath(qs, "B").In("x*"),
+			expect:  nil,
+		},
 		{
 			message: "use path Out",
 			path:    StartPath(qs, "B").Out(StartPath(qs, "predicates").Out("are")),
@@ -179,3 +195,307 @@ func TestMorphisms(t *testing.T) {
 		}
 	}
 }
+
+// runAllTags returns the tags of each result of the path, by name.
+func runAllTags(path *Path) []map[string]string {
+	var out []map[string]string
+	it := path.BuildIterator()
+	it, _ = it.Optimize()
+	for graph.Next(it) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		names := make(map[string]string)
+		for tag, v := range tags {
+			names[tag] = path.qs.NameOf(v)
+		}
+		out = append(out, names)
+	}
+	return out
+}
+
+func TestRetag(t *testing.T) {
+	qs := makeTestStore(simpleGraph)
+	for _, test := range []struct {
+		message string
+		path    *Path
+		expect  []map[string]string
+	}{
+		{
+			message: "keep the tags of both intersected paths",
+			path: StartPath(qs, "A").Tag("a").Out("follows").And(
+				StartPath(qs, "C").Tag("c").Out("follows")).Tag("x"),
+			expect: []map[string]string{{"a": "A", "c": "C", "x": "B"}},
+		},
+		{
+			message: "rename the conflicting tags of an intersected path",
+			path: StartPath(qs, "A").Tag("who").Out("follows").And(
+				StartPath(qs, "C").Tag("who").Out("follows").RenameTags(map[string]string{"who": "other"})),
+			expect: []map[string]string{{"who": "A", "other": "C"}},
+		},
+		{
+			message: "drop the conflicting tags of an intersected path",
+			path: StartPath(qs, "A").Tag("who").Out("follows").And(
+				StartPath(qs, "C").Tag("who").Out("follows").DropTags("who")),
+			expect: []map[string]string{{"who": "A"}},
+		},
+		{
+			message: "rename the tags of a united path",
+			path: StartPath(qs, "A").Tag("who").Out("follows").Or(
+				StartPath(qs, "E").Tag("who").Out("follows").RenameTags(map[string]string{"who": "other"})),
+			expect: []map[string]string{{"who": "A"}, {"other": "E"}},
+		},
+	} {
+		got := runAllTags(test.path)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestTimeMorphisms(t *testing.T) {
+	var (
+		ada    = `"1815-12-10"^^` + quad.XSDDate
+		alan   = `"1912-06-23"^^` + quad.XSDDate
+		grace  = `"1906-12-09T00:00:00-05:00"^^` + quad.XSDDateTime
+		edsger = `"1930-05-11"^^` + quad.XSDDate
+	)
+	qs := makeTestStore([]quad.Quad{
+		{"ada", "born", ada, ""},
+		{"alan", "born", alan, ""},
+		{"grace", "born", grace, ""},
+		{"edsger", "born", edsger, ""},
+		{"edsger", "born_in", "1930", ""},
+	})
+	year := func(y int) time.Time { return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC) }
+	for _, test := range []test{
+		{
+			message: "find times before",
+			path:    StartPath(qs).Before(year(1900)).In("born"),
+			expect:  []string{"ada"},
+		},
+		{
+			message: "find times after",
+			path:    StartPath(qs).After(year(1910)).In("born"),
+			expect:  []string{"alan", "edsger"},
+		},
+		{
+			message: "find times between",
+			path:    StartPath(qs).Between(year(1900), time.Date(1912, 6, 23, 0, 0, 0, 0, time.UTC)).In("born"),
+			expect:  []string{"alan", "grace"},
+		},
+		{
+			message: "ignore numbers when comparing times",
+			path:    StartPath(qs).Out("born_in").Before(year(2000)),
+			expect:  nil,
+		},
+	} {
+		got := runTopLevel(test.path)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestAtRevision(t *testing.T) {
+	qs := makeTestStore(simpleGraph)
+	h := qs.Horizon()
+	horizon := h.Int()
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	w.RemoveQuad(quad.Quad{"A", "follows", "B", ""})
+	w.AddQuad(quad.Quad{"A", "follows", "C", ""})
+
+	p := StartPath(qs, "A").Out("follows")
+	if got := runTopLevel(p); !reflect.DeepEqual(got, []string{"C"}) {
+		t.Errorf("Unexpected current result, got: %v expected: [C]", got)
+	}
+	old, err := p.AtRevision(horizon)
+	if err != nil {
+		t.Fatalf("Failed to get revision %d: %v", horizon, err)
+	}
+	if got := runTopLevel(old); !reflect.DeepEqual(got, []string{"B"}) {
+		t.Errorf("Unexpected result at revision %d, got: %v expected: [B]", horizon, got)
+	}
+	if _, err := StartMorphism().AtRevision(horizon); err == nil {
+		t.Errorf("Expected error revising a morphism")
+	}
+}
+
+func TestLabelContext(t *testing.T) {
+	qs := makeTestStore(simpleGraph)
+	for _, test := range []struct {
+		message string
+		path    *Path
+		expect  []string
+	}{
+		{
+			message: "restrict Out to a label",
+			path:    StartPath(qs, "B", "C").LabelContext("status_graph").Out(),
+			expect:  []string{"cool"},
+		},
+		{
+			message: "restrict In to a label",
+			path:    StartPath(qs, "cool").LabelContext("status_graph").In("status"),
+			expect:  []string{"B", "D", "G"},
+		},
+		{
+			message: "restrict to an unknown label",
+			path:    StartPath(qs, "B").LabelContext("nothing").Out("follows"),
+			expect:  nil,
+		},
+		{
+			message: "clear the label context",
+			path:    StartPath(qs, "A").LabelContext("status_graph").LabelContext().Out("follows"),
+			expect:  []string{"B"},
+		},
+	} {
+		got := runTopLevel(test.path)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestSameAs(t *testing.T) {
+	qs := makeTestStore(append([]quad.Quad{
+		{"B", "sameAs", "B2", ""},
+		{"B3", "sameAs", "B2", ""},
+		{"B3", "follows", "H", ""},
+	}, simpleGraph...))
+	for _, test := range []struct {
+		message string
+		path    *Path
+		expect  []string
+	}{
+		{
+			message: "follow the edges of every alias",
+			path:    StartPath(qs, "B").SameAs("sameAs").Out("follows"),
+			expect:  []string{"F", "H"},
+		},
+		{
+			message: "reach every alias",
+			path:    StartPath(qs, "A").SameAs("sameAs").Out("follows"),
+			expect:  []string{"B", "B2", "B3"},
+		},
+		{
+			message: "follow the edges of a linked alias",
+			path:    StartPath(qs, "B3").SameAs("sameAs").Out("follows"),
+			expect:  []string{"F", "H"},
+		},
+		{
+			message: "follow inbound edges of every alias",
+			path:    StartPath(qs, "B3").SameAs("sameAs").In("follows"),
+			expect:  []string{"A", "C", "D"},
+		},
+		{
+			message: "match an alias as the target",
+			path:    StartPath(qs, "A", "E").SameAs("sameAs").Out("follows").Is("B3"),
+			expect:  []string{"B3"},
+		},
+		{
+			message: "stop aliasing",
+			path:    StartPath(qs, "B").SameAs("sameAs").SameAs().Out("follows"),
+			expect:  []string{"F"},
+		},
+	} {
+		got := runTopLevel(test.path)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestSaveProvenance(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	w.AddQuadSet(simpleGraph[:1])
+	err := w.(graph.ProvenanceWriter).AddQuadSetWithProvenance(simpleGraph[1:3], graph.Provenance{Source: "follows.nq"})
+	if err != nil {
+		t.Fatalf("Could not add quads with provenance: %v", err)
+	}
+
+	it := StartPath(qs, "A", "C", "D").SaveProvenance("follows", "source", "file").BuildIterator()
+	it, _ = it.Optimize()
+	got := make(map[string]string)
+	for graph.Next(it) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		names := graph.NamesOfTags(qs, []map[string]graph.Value{tags})[0]
+		got[qs.NameOf(it.Result())] = names["file"]
+	}
+	if expect := map[string]string{"A": "", "C": "follows.nq"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected saved provenance, got: %v expected: %v", got, expect)
+	}
+}
+
+func TestLabelContextReversal(t *testing.T) {
+	qs := makeTestStore(append([]quad.Quad{
+		{"E", "status", "cool", ""},
+		{"A", "status", "cool", "other_graph"},
+	}, simpleGraph...))
+	status := StartMorphism().LabelContext("status_graph").Out("status")
+	for _, test := range []struct {
+		message string
+		path    *Path
+		expect  []string
+	}{
+		{
+			message: "keep the label context of a reversed morphism",
+			path:    StartPath(qs, "cool").FollowReverse(status),
+			expect:  []string{"B", "D", "G"},
+		},
+		{
+			message: "apply the label context to the morphisms after it once reversed",
+			path: StartPath(qs, "cool").FollowReverse(
+				StartMorphism().Out("follows").LabelContext("status_graph").Out("status")),
+			expect: []string{"A", "C", "C", "D", "D", "F"},
+		},
+		{
+			message: "keep a cleared label context once reversed",
+			path: StartPath(qs, "cool").FollowReverse(
+				StartMorphism().LabelContext("other_graph").Out("status").LabelContext().Is("cool")),
+			expect: []string{"A"},
+		},
+		{
+			message: "restrict Save to a label",
+			path:    StartPath(qs, "A", "B", "E").LabelContext("status_graph").Save("status", "status"),
+			expect:  []string{"B"},
+		},
+	} {
+		got := runTopLevel(test.path)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	qs := makeTestStore(simpleGraph)
+	got := runAllTags(StartPath(qs, "A", "E").Save("follows", "target"))
+	expect := []map[string]string{{"target": "B"}, {"target": "F"}}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected saved nodes, got: %v expected: %v", got, expect)
+	}
+	got = runAllTags(StartPath(qs, "F").SaveReverse("follows", "source"))
+	expect = []map[string]string{{"source": "B"}, {"source": "E"}}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected reverse saved nodes, got: %v expected: %v", got, expect)
+	}
+}
+
+func TestSaveLabel(t *testing.T) {
+	qs := makeTestStore(append([]quad.Quad{
+		{"E", "status", "cool", ""},
+	}, simpleGraph...))
+	var got []string
+	for _, tags := range runAllTags(StartPath(qs, "cool").SaveLabel("graph").In("status")) {
+		got = append(got, tags["graph"])
+	}
+	sort.Strings(got)
+	if expect := []string{"", "status_graph", "status_graph", "status_graph"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected saved labels, got: %q expected: %q", got, expect)
+	}
+}
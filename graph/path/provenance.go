@@ -0,0 +1,169 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+// Defines SaveProvenance, and the iterator that tags the provenance of the
+// quads it passes on.
+
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+var provenanceType graph.Type
+
+func init() {
+	provenanceType = graph.RegisterIterator("provenance")
+}
+
+// SaveProvenance tags each of the current nodes with a field of the
+// provenance of its quad with the given predicate: "created", "author" or
+// "source". Nodes without such a quad are dropped, like with Out; those
+// whose quad has no recorded provenance are kept, but not tagged.
+//
+// For example:
+//  // Tags "A" with the file its "follows" quads were loaded from.
+//  StartPath(qs, "A").SaveProvenance("follows", "source", "file")
+func (p *Path) SaveProvenance(via interface{}, field, tag string) *Path {
+	p.stack = append(p.stack, saveProvenanceMorphism(via, field, tag))
+	return p
+}
+
+func saveProvenanceMorphism(via interface{}, field, tag string) morphism {
+	return morphism{
+		"save_provenance",
+		func() morphism { return saveProvenanceMorphism(via, field, tag) },
+		func(qs graph.QuadStore, it graph.Iterator, ctx *context) (graph.Iterator, *context) {
+			viaPath := buildViaPath(qs, via)
+			quads := iterator.NewAnd(qs)
+			quads.AddSubIterator(iterator.NewLinksTo(qs, viaPath.BuildIterator(), quad.Predicate))
+			quads.AddSubIterator(iterator.NewLinksTo(qs, qs.NodesAllIterator(), quad.Object))
+			tagged := newProvenanceIterator(qs, labelQuads(qs, quads, ctx), field, tag)
+			and := iterator.NewAnd(qs)
+			and.AddSubIterator(iterator.NewHasA(qs, tagged, quad.Subject))
+			and.AddSubIterator(it)
+			return and, ctx
+		},
+	}
+}
+
+// provenanceIterator passes on the quads of its subiterator, tagging each
+// with a field of its provenance.
+type provenanceIterator struct {
+	uid   uint64
+	tags  graph.Tagger
+	qs    graph.QuadStore
+	subIt graph.Iterator
+	field string
+	tag   string
+
+	result graph.Value
+}
+
+func newProvenanceIterator(qs graph.QuadStore, subIt graph.Iterator, field, tag string) *provenanceIterator {
+	return &provenanceIterator{
+		uid:   iterator.NextUID(),
+		qs:    qs,
+		subIt: subIt,
+		field: field,
+		tag:   tag,
+	}
+}
+
+func (it *provenanceIterator) UID() uint64 { return it.uid }
+
+func (it *provenanceIterator) Reset() {
+	it.result = nil
+	it.subIt.Reset()
+}
+
+func (it *provenanceIterator) Tagger() *graph.Tagger { return &it.tags }
+
+func (it *provenanceIterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.result
+	}
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+	if p, ok := graph.ProvenanceOf(it.qs, it.result); ok {
+		if v, ok := p.Get(it.field); ok {
+			dst[it.tag] = graph.Annotation(v)
+		}
+	}
+	it.subIt.TagResults(dst)
+}
+
+func (it *provenanceIterator) Clone() graph.Iterator {
+	out := newProvenanceIterator(it.qs, it.subIt.Clone(), it.field, it.tag)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *provenanceIterator) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *provenanceIterator) Next() bool {
+	graph.NextLogIn(it)
+	if !graph.Next(it.subIt) {
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.subIt.Result()
+	return graph.NextLogOut(it, it.result, true)
+}
+
+func (it *provenanceIterator) Err() error { return it.subIt.Err() }
+
+func (it *provenanceIterator) Result() graph.Value { return it.result }
+
+func (it *provenanceIterator) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *provenanceIterator) NextPath() bool { return it.subIt.NextPath() }
+
+func (it *provenanceIterator) Close() error { return it.subIt.Close() }
+
+func (it *provenanceIterator) Type() graph.Type { return provenanceType }
+
+func (it *provenanceIterator) Optimize() (graph.Iterator, bool) {
+	newIt, optimized := it.subIt.Optimize()
+	if optimized {
+		it.subIt = newIt
+	}
+	return it, false
+}
+
+func (it *provenanceIterator) Stats() graph.IteratorStats { return it.subIt.Stats() }
+
+func (it *provenanceIterator) Size() (int64, bool) { return it.subIt.Size() }
+
+func (it *provenanceIterator) Describe() graph.Description {
+	return graph.Description{
+		UID:       it.UID(),
+		Type:      it.Type(),
+		Tags:      it.tags.Tags(),
+		Iterators: []graph.Description{it.subIt.Describe()},
+	}
+}
+
+var _ graph.Nexter = &provenanceIterator{}
@@ -0,0 +1,94 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strings"
+
+	"github.com/google/cayley/quad"
+)
+
+// IsPredicatePattern returns whether a predicate a query follows is a pattern
+// standing for every predicate it matches, as one with a * is.
+func IsPredicatePattern(s string) bool {
+	return strings.Contains(s, "*")
+}
+
+// MatchPredicatePattern returns whether name matches pattern, in which each *
+// stands for any run of characters, such as "<http://xmlns.com/foaf/0.1/*"
+// or "foaf:*".
+func MatchPredicatePattern(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	last := len(parts) - 1
+	for _, part := range parts[1:last] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return strings.HasSuffix(name, parts[last])
+}
+
+// PredicatesMatching returns the names of the predicates of the live quads of
+// qs that match pattern. The nodes are read once, skipping those whose names
+// do not match before looking for quads with them as predicates.
+func PredicatesMatching(qs QuadStore, pattern string) ([]string, error) {
+	nodes := qs.NodesAllIterator()
+	defer nodes.Close()
+	var out []string
+	for Next(nodes) {
+		name := qs.NameOf(nodes.Result())
+		if !MatchPredicatePattern(pattern, name) {
+			continue
+		}
+		it := qs.QuadIterator(quad.Predicate, nodes.Result())
+		ok := Next(it)
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, name)
+		}
+	}
+	return out, nodes.Err()
+}
+
+// ExpandPredicates replaces the patterns among the names of predicates by the
+// predicates of qs they match.
+func ExpandPredicates(qs QuadStore, names ...string) ([]string, error) {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if !IsPredicatePattern(name) {
+			out = append(out, name)
+			continue
+		}
+		preds, err := PredicatesMatching(qs, name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, preds...)
+	}
+	return out, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "testing"
+
+func TestMatchPredicatePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern, name string
+		expect        bool
+	}{
+		{"foaf:*", "foaf:name", true},
+		{"foaf:*", "foaf:", true},
+		{"foaf:*", "rdf:type", false},
+		{"<http://xmlns.com/foaf/0.1/*>", "<http://xmlns.com/foaf/0.1/knows>", true},
+		{"*name", "foaf:name", true},
+		{"*name", "foaf:names", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "axbyc", true},
+		{"a*b*b", "ab", false},
+		{"name", "name", true},
+		{"name", "names", false},
+	} {
+		if got := MatchPredicatePattern(test.pattern, test.name); got != test.expect {
+			t.Errorf("Unexpected match of %q against %q, got:%t expect:%t", test.name, test.pattern, got, test.expect)
+		}
+	}
+}
@@ -21,7 +21,8 @@ import (
 	"sync"
 
 	"code.google.com/p/go-uuid/uuid"
-	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/clog"
 )
 
 type primaryKeyType uint8
@@ -86,7 +87,7 @@ func (p *PrimaryKey) Int() int64 {
 		return p.sequentialID
 	case unique:
 		msg := "UUID cannot be converted to an int64"
-		glog.Errorln(msg)
+		clog.Errorln(msg)
 		panic(msg)
 	}
 	return -1
@@ -0,0 +1,397 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package propgraph presents a QuadStore as a property graph: labelled
+// vertices and edges, each with a map of properties.
+//
+// Elements map onto quads as follows, in the default graph:
+//
+//  vertex v with label L:        v pg:vertex L
+//  edge e from a to b, label L:  e pg:edge L
+//                                e pg:out a
+//                                e pg:in b
+//                                a L b
+//  property k=x of v or e:       v pg:property:k x
+//
+// The last quad of an edge links its ends directly, so that ordinary path
+// queries, such as Out("L"), traverse it. Since it can only exist once,
+// there is a single edge with a given label between two vertices, and its
+// ID is derived from them.
+package propgraph
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/quad"
+)
+
+// The predicates of the mapping.
+const (
+	VertexPredicate = "pg:vertex"
+	EdgePredicate   = "pg:edge"
+	OutPredicate    = "pg:out"
+	InPredicate     = "pg:in"
+	PropertyPrefix  = "pg:property:"
+)
+
+// DefaultVertexLabel is the label of vertices added without one.
+const DefaultVertexLabel = "vertex"
+
+var (
+	ErrNotFound = errors.New("propgraph: no such element")
+	ErrExists   = errors.New("propgraph: element exists")
+)
+
+// Vertex is a vertex of the graph.
+type Vertex struct {
+	ID         string
+	Label      string
+	Properties map[string]string
+}
+
+// Edge is a labelled edge from the Out vertex to the In vertex.
+type Edge struct {
+	ID         string
+	Out        string
+	Label      string
+	In         string
+	Properties map[string]string
+}
+
+// EdgeID returns the ID of the edge with the given label between two
+// vertices.
+func EdgeID(out, label, in string) string {
+	return fmt.Sprintf("pg:e:%x", sha1.Sum([]byte(out+"\x00"+label+"\x00"+in)))
+}
+
+// Graph reads the property graph in a QuadStore, and writes it through a
+// QuadWriter. Every change is applied as a single transaction.
+type Graph struct {
+	qs graph.QuadStore
+	qw graph.QuadWriter
+}
+
+// New returns the property graph in qs, which qw writes to.
+func New(qs graph.QuadStore, qw graph.QuadWriter) *Graph {
+	return &Graph{qs: qs, qw: qw}
+}
+
+func propertyQuads(id string, props map[string]string) []quad.Quad {
+	var out []quad.Quad
+	for k, v := range props {
+		out = append(out, quad.Quad{Subject: id, Predicate: PropertyPrefix + k, Object: v})
+	}
+	return out
+}
+
+// element returns the quads with id as their subject, in the default graph.
+func (g *Graph) element(id string) ([]quad.Quad, error) {
+	if id == "" {
+		return nil, ErrNotFound
+	}
+	quads, err := graph.MatchingQuads(g.qs, quad.Quad{Subject: id})
+	if err != nil {
+		return nil, err
+	}
+	out := quads[:0]
+	for _, q := range quads {
+		if q.Label == "" {
+			out = append(out, q)
+		}
+	}
+	return out, nil
+}
+
+// AddVertex adds a vertex and its properties.
+func (g *Graph) AddVertex(v Vertex) error {
+	if v.ID == "" {
+		return errors.New("propgraph: vertex without an ID")
+	}
+	if _, err := g.Vertex(v.ID); err == nil {
+		return ErrExists
+	} else if err != ErrNotFound {
+		return err
+	}
+	if v.Label == "" {
+		v.Label = DefaultVertexLabel
+	}
+	tx := graph.NewTransaction()
+	tx.AddQuad(quad.Quad{Subject: v.ID, Predicate: VertexPredicate, Object: v.Label})
+	for _, q := range propertyQuads(v.ID, v.Properties) {
+		tx.AddQuad(q)
+	}
+	return g.qw.ApplyTransaction(tx)
+}
+
+// Vertex returns the vertex with the given ID.
+func (g *Graph) Vertex(id string) (*Vertex, error) {
+	quads, err := g.element(id)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vertex{ID: id, Properties: make(map[string]string)}
+	for _, q := range quads {
+		switch {
+		case q.Predicate == VertexPredicate:
+			v.Label = q.Object
+		case strings.HasPrefix(q.Predicate, PropertyPrefix):
+			v.Properties[strings.TrimPrefix(q.Predicate, PropertyPrefix)] = q.Object
+		}
+	}
+	if v.Label == "" {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+// AddEdge adds an edge between two existing vertices, and returns it with
+// its ID set.
+func (g *Graph) AddEdge(e Edge) (*Edge, error) {
+	if e.Label == "" {
+		return nil, errors.New("propgraph: edge without a label")
+	}
+	for _, id := range []string{e.Out, e.In} {
+		if _, err := g.Vertex(id); err != nil {
+			return nil, err
+		}
+	}
+	e.ID = EdgeID(e.Out, e.Label, e.In)
+	if _, err := g.Edge(e.ID); err == nil {
+		return nil, ErrExists
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+	tx := graph.NewTransaction()
+	tx.AddQuad(quad.Quad{Subject: e.ID, Predicate: EdgePredicate, Object: e.Label})
+	tx.AddQuad(quad.Quad{Subject: e.ID, Predicate: OutPredicate, Object: e.Out})
+	tx.AddQuad(quad.Quad{Subject: e.ID, Predicate: InPredicate, Object: e.In})
+	tx.AddQuad(quad.Quad{Subject: e.Out, Predicate: e.Label, Object: e.In})
+	for _, q := range propertyQuads(e.ID, e.Properties) {
+		tx.AddQuad(q)
+	}
+	err := g.qw.ApplyTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Edge returns the edge with the given ID.
+func (g *Graph) Edge(id string) (*Edge, error) {
+	quads, err := g.element(id)
+	if err != nil {
+		return nil, err
+	}
+	e := &Edge{ID: id, Properties: make(map[string]string)}
+	for _, q := range quads {
+		switch {
+		case q.Predicate == EdgePredicate:
+			e.Label = q.Object
+		case q.Predicate == OutPredicate:
+			e.Out = q.Object
+		case q.Predicate == InPredicate:
+			e.In = q.Object
+		case strings.HasPrefix(q.Predicate, PropertyPrefix):
+			e.Properties[strings.TrimPrefix(q.Predicate, PropertyPrefix)] = q.Object
+		}
+	}
+	if e.Label == "" {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// SetProperty sets a property of a vertex or an edge, replacing any former
+// value.
+func (g *Graph) SetProperty(id, key, value string) error {
+	return g.changeProperty(id, key, &value)
+}
+
+// RemoveProperty removes a property of a vertex or an edge, if it has it.
+func (g *Graph) RemoveProperty(id, key string) error {
+	return g.changeProperty(id, key, nil)
+}
+
+func (g *Graph) changeProperty(id, key string, value *string) error {
+	quads, err := g.element(id)
+	if err != nil {
+		return err
+	}
+	tx := graph.NewTransaction()
+	found := false
+	for _, q := range quads {
+		switch q.Predicate {
+		case VertexPredicate, EdgePredicate:
+			found = true
+		case PropertyPrefix + key:
+			if value != nil && q.Object == *value {
+				return nil
+			}
+			tx.RemoveQuad(q)
+		}
+	}
+	if !found {
+		return ErrNotFound
+	}
+	if value != nil {
+		tx.AddQuad(quad.Quad{Subject: id, Predicate: PropertyPrefix + key, Object: *value})
+	}
+	if len(tx.Deltas) == 0 {
+		return nil
+	}
+	return g.qw.ApplyTransaction(tx)
+}
+
+func (g *Graph) removeEdge(tx *graph.Transaction, e *Edge) error {
+	quads, err := g.element(e.ID)
+	if err != nil {
+		return err
+	}
+	for _, q := range quads {
+		tx.RemoveQuad(q)
+	}
+	tx.RemoveQuad(quad.Quad{Subject: e.Out, Predicate: e.Label, Object: e.In})
+	return nil
+}
+
+// RemoveEdge removes an edge and its properties.
+func (g *Graph) RemoveEdge(id string) error {
+	e, err := g.Edge(id)
+	if err != nil {
+		return err
+	}
+	tx := graph.NewTransaction()
+	err = g.removeEdge(tx, e)
+	if err != nil {
+		return err
+	}
+	return g.qw.ApplyTransaction(tx)
+}
+
+// RemoveVertex removes a vertex, its properties, and its edges.
+func (g *Graph) RemoveVertex(id string) error {
+	if _, err := g.Vertex(id); err != nil {
+		return err
+	}
+	quads, err := g.element(id)
+	if err != nil {
+		return err
+	}
+	tx := graph.NewTransaction()
+	for _, q := range quads {
+		if q.Predicate == VertexPredicate || strings.HasPrefix(q.Predicate, PropertyPrefix) {
+			tx.RemoveQuad(q)
+		}
+	}
+	edges, err := g.edges(id, OutPredicate)
+	if err != nil {
+		return err
+	}
+	in, err := g.edges(id, InPredicate)
+	if err != nil {
+		return err
+	}
+	// A loop is both an outgoing and an incoming edge.
+	seen := make(map[string]bool)
+	for _, e := range append(edges, in...) {
+		if seen[e.ID] {
+			continue
+		}
+		seen[e.ID] = true
+		err = g.removeEdge(tx, e)
+		if err != nil {
+			return err
+		}
+	}
+	return g.qw.ApplyTransaction(tx)
+}
+
+// edges returns the edges with the vertex at the end given by dir, which is
+// OutPredicate or InPredicate.
+func (g *Graph) edges(id, dir string, labels ...string) ([]*Edge, error) {
+	quads, err := graph.MatchingQuads(g.qs, quad.Quad{Predicate: dir, Object: id})
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, q := range quads {
+		if q.Label == "" {
+			ids = append(ids, q.Subject)
+		}
+	}
+	sort.Strings(ids)
+	var out []*Edge
+	for _, eid := range ids {
+		e, err := g.Edge(eid)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if len(labels) == 0 || hasLabel(labels, e.Label) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// OutEdges returns the edges leaving a vertex, with one of the given labels
+// if any are given, in order of ID.
+func (g *Graph) OutEdges(id string, labels ...string) ([]*Edge, error) {
+	return g.edges(id, OutPredicate, labels...)
+}
+
+// InEdges returns the edges reaching a vertex, with one of the given labels
+// if any are given, in order of ID.
+func (g *Graph) InEdges(id string, labels ...string) ([]*Edge, error) {
+	return g.edges(id, InPredicate, labels...)
+}
+
+// Vertices returns the IDs of the vertices with the given label, or of all
+// vertices for an empty label, in order.
+func (g *Graph) Vertices(label string) ([]string, error) {
+	quads, err := graph.MatchingQuads(g.qs, quad.Quad{Predicate: VertexPredicate, Object: label})
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, q := range quads {
+		if q.Label == "" {
+			out = append(out, q.Subject)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// V returns a path starting from the given vertices, from which edges are
+// traversed with Out and In by their labels.
+func (g *Graph) V(ids ...string) *path.Path {
+	return path.StartPath(g.qs, ids...)
+}
@@ -0,0 +1,136 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package propgraph
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+func makeTestGraph(t *testing.T) (graph.QuadStore, *Graph) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	g := New(qs, w)
+	for _, v := range []Vertex{
+		{ID: "alice", Label: "person", Properties: map[string]string{"age": "30"}},
+		{ID: "bob", Label: "person"},
+		{ID: "acme", Label: "company"},
+	} {
+		if err := g.AddVertex(v); err != nil {
+			t.Fatalf("Could not add vertex %q: %v", v.ID, err)
+		}
+	}
+	return qs, g
+}
+
+func names(qs graph.QuadStore, it graph.Iterator) []string {
+	var out []string
+	for graph.Next(it) {
+		out = append(out, qs.NameOf(it.Result()))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestVertices(t *testing.T) {
+	_, g := makeTestGraph(t)
+	if err := g.AddVertex(Vertex{ID: "bob"}); err != ErrExists {
+		t.Errorf("Unexpected error adding an existing vertex: %v", err)
+	}
+	v, err := g.Vertex("alice")
+	if err != nil {
+		t.Fatalf("Could not get vertex: %v", err)
+	}
+	expect := &Vertex{ID: "alice", Label: "person", Properties: map[string]string{"age": "30"}}
+	if !reflect.DeepEqual(v, expect) {
+		t.Errorf("Unexpected vertex, got:%v expect:%v", v, expect)
+	}
+	g.SetProperty("alice", "age", "31")
+	g.SetProperty("alice", "city", "Paris")
+	g.RemoveProperty("alice", "city")
+	v, _ = g.Vertex("alice")
+	if expect := map[string]string{"age": "31"}; !reflect.DeepEqual(v.Properties, expect) {
+		t.Errorf("Unexpected properties, got:%v expect:%v", v.Properties, expect)
+	}
+	if err := g.SetProperty("carol", "age", "1"); err != ErrNotFound {
+		t.Errorf("Unexpected error setting a property of a missing vertex: %v", err)
+	}
+	people, _ := g.Vertices("person")
+	if expect := []string{"alice", "bob"}; !reflect.DeepEqual(people, expect) {
+		t.Errorf("Unexpected vertices, got:%v expect:%v", people, expect)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	qs, g := makeTestGraph(t)
+	knows, err := g.AddEdge(Edge{Out: "alice", Label: "knows", In: "bob", Properties: map[string]string{"since": "2010"}})
+	if err != nil {
+		t.Fatalf("Could not add edge: %v", err)
+	}
+	if knows.ID != EdgeID("alice", "knows", "bob") {
+		t.Errorf("Unexpected edge ID %q", knows.ID)
+	}
+	if _, err := g.AddEdge(Edge{Out: "alice", Label: "knows", In: "bob"}); err != ErrExists {
+		t.Errorf("Unexpected error adding an existing edge: %v", err)
+	}
+	if _, err := g.AddEdge(Edge{Out: "alice", Label: "knows", In: "carol"}); err != ErrNotFound {
+		t.Errorf("Unexpected error adding an edge to a missing vertex: %v", err)
+	}
+	g.AddEdge(Edge{Out: "alice", Label: "works_at", In: "acme"})
+	g.AddEdge(Edge{Out: "bob", Label: "works_at", In: "acme"})
+
+	e, err := g.Edge(knows.ID)
+	if err != nil || !reflect.DeepEqual(e, knows) {
+		t.Errorf("Unexpected edge, got:%v, %v expect:%v", e, err, knows)
+	}
+	out, _ := g.OutEdges("alice", "works_at")
+	if len(out) != 1 || out[0].In != "acme" {
+		t.Errorf("Unexpected out edges: %v", out)
+	}
+	in, _ := g.InEdges("acme")
+	if len(in) != 2 {
+		t.Errorf("Unexpected number of in edges, got:%d expect:2", len(in))
+	}
+	got := names(qs, g.V("alice").Out("knows").Out("works_at").BuildIterator())
+	if expect := []string{"acme"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected traversal, got:%v expect:%v", got, expect)
+	}
+
+	if err := g.RemoveVertex("acme"); err != nil {
+		t.Fatalf("Could not remove vertex: %v", err)
+	}
+	if _, err := g.Vertex("acme"); err != ErrNotFound {
+		t.Errorf("Unexpected error getting a removed vertex: %v", err)
+	}
+	out, _ = g.OutEdges("alice")
+	if len(out) != 1 || out[0].ID != knows.ID {
+		t.Errorf("Unexpected out edges after removing a vertex: %v", out)
+	}
+	if got := names(qs, g.V("bob").Out("works_at").BuildIterator()); got != nil {
+		t.Errorf("Unexpected traversal of a removed edge: %v", got)
+	}
+	if err := g.RemoveEdge(knows.ID); err != nil {
+		t.Errorf("Could not remove edge: %v", err)
+	}
+	if _, err := g.Edge(knows.ID); err != ErrNotFound {
+		t.Errorf("Unexpected error getting a removed edge: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoProvenance is returned when adding quads with provenance to a store
+// that does not keep it.
+var ErrNoProvenance = errors.New("quad store does not support provenance")
+
+// Provenance records where a quad came from.
+type Provenance struct {
+	// Created is when the quad was added.
+	Created time.Time `json:"created"`
+
+	// Author is who added the quad.
+	Author string `json:"author,omitempty"`
+
+	// Source is where the quad was read from, such as the file it was
+	// loaded from.
+	Source string `json:"source,omitempty"`
+}
+
+// IsZero returns whether p records neither an author nor a source.
+func (p Provenance) IsZero() bool {
+	return p.Author == "" && p.Source == ""
+}
+
+// Get returns the named field of p: "created", in RFC 3339 format,
+// "author" or "source".
+func (p Provenance) Get(field string) (string, bool) {
+	switch field {
+	case "created":
+		return p.Created.Format(time.RFC3339Nano), true
+	case "author":
+		return p.Author, true
+	case "source":
+		return p.Source, true
+	}
+	return "", false
+}
+
+// ProvenanceOf returns the provenance of the quad q in qs, and whether one was
+// recorded.
+func ProvenanceOf(qs QuadStore, q Value) (Provenance, bool) {
+	k, ok := qs.(ProvenanceKeeper)
+	if !ok {
+		return Provenance{}, false
+	}
+	return k.Provenance(q)
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoPurge is returned when purging a store that does not keep deleted
+// quads, or cannot remove them.
+var ErrNoPurge = errors.New("quad store does not support purging")
+
+// Purge permanently removes the quads of qs deleted more than retention
+// ago, or ErrNoPurge if qs is not a Purger.
+func Purge(qs QuadStore, retention time.Duration) (int, error) {
+	p, ok := qs.(Purger)
+	if !ok {
+		return 0, ErrNoPurge
+	}
+	return p.Purge(time.Now().Add(-retention))
+}
+
+// Purge permanently removes the quads of the handle's store deleted more
+// than retention ago.
+func (h *Handle) Purge(retention time.Duration) (int, error) {
+	return Purge(h.QuadStore, retention)
+}
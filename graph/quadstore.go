@@ -139,6 +139,90 @@ func (d Options) BoolKey(key string) (bool, bool, error) {
 	return false, false, nil
 }
 
+// StoreConfig describes a QuadStore nested within the options of another
+// QuadStore, such as the shards of a sharded store. It is read from an object
+// with the same "database", "db_path" and "db_options" keys as the main
+// configuration.
+type StoreConfig struct {
+	Type    string
+	Path    string
+	Options Options
+}
+
+func storeConfigFrom(key string, val interface{}) (StoreConfig, error) {
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return StoreConfig{}, fmt.Errorf("Invalid %s parameter type from config: %T", key, val)
+	}
+	opts := Options(m)
+	var (
+		c   StoreConfig
+		err error
+	)
+	c.Type, ok, err = opts.StringKey("database")
+	if err != nil {
+		return StoreConfig{}, err
+	} else if !ok {
+		return StoreConfig{}, fmt.Errorf("Missing database type in %s parameter from config", key)
+	}
+	c.Path, _, err = opts.StringKey("db_path")
+	if err != nil {
+		return StoreConfig{}, err
+	}
+	switch o := m["db_options"].(type) {
+	case nil:
+	case map[string]interface{}:
+		c.Options = Options(o)
+	default:
+		return StoreConfig{}, fmt.Errorf("Invalid db_options parameter type from config: %T", o)
+	}
+	return c, nil
+}
+
+func (d Options) StoreConfigKey(key string) (StoreConfig, bool, error) {
+	if val, ok := d[key]; ok {
+		c, err := storeConfigFrom(key, val)
+		if err != nil {
+			return StoreConfig{}, false, err
+		}
+		return c, true, nil
+	}
+	return StoreConfig{}, false, nil
+}
+
+func (d Options) StoreConfigsKey(key string) ([]StoreConfig, bool, error) {
+	if val, ok := d[key]; ok {
+		list, ok := val.([]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("Invalid %s parameter type from config: %T", key, val)
+		}
+		configs := make([]StoreConfig, 0, len(list))
+		for i, v := range list {
+			c, err := storeConfigFrom(fmt.Sprintf("%s[%d]", key, i), v)
+			if err != nil {
+				return nil, false, err
+			}
+			configs = append(configs, c)
+		}
+		return configs, true, nil
+	}
+	return nil, false, nil
+}
+
+// Open opens the described QuadStore.
+func (c StoreConfig) Open() (QuadStore, error) {
+	return NewQuadStore(c.Type, c.Path, c.Options)
+}
+
+// Init initializes the described QuadStore if it is persistent, and does
+// nothing otherwise.
+func (c StoreConfig) Init() error {
+	if !IsPersistent(c.Type) {
+		return nil
+	}
+	return InitQuadStore(c.Type, c.Path, c.Options)
+}
+
 var ErrCannotBulkLoad = errors.New("quadstore: cannot bulk load")
 
 type BulkLoader interface {
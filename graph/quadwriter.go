@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/google/cayley/quad"
+	"github.com/google/cayley/trace"
 )
 
 type Procedure int8
@@ -42,6 +43,16 @@ type Delta struct {
 	Quad      quad.Quad
 	Action    Procedure
 	Timestamp time.Time
+
+	// Expires is the time after which an added quad should be removed
+	// again. The zero time means never; it is ignored for deletions.
+	Expires time.Time
+
+	// Author and Source record who added a quad and where it was read
+	// from, in stores that keep provenance. They are ignored for
+	// deletions.
+	Author string
+	Source string
 }
 
 type Handle struct {
@@ -61,6 +72,22 @@ func (h *Handle) Close() {
 var (
 	ErrQuadExists   = errors.New("quad exists")
 	ErrQuadNotExist = errors.New("quad does not exist")
+
+	// ErrConflict is returned for a conditional write to a store that has
+	// changed since the horizon the write expected.
+	ErrConflict = errors.New("graph changed since the expected horizon")
+
+	// ErrReadOnly is returned for a write to a store opened with the
+	// "read_only" option.
+	ErrReadOnly = errors.New("database is opened read-only")
+
+	// ErrStoreFull is returned for a write that would take a store opened
+	// with a limit on its size over it.
+	ErrStoreFull = errors.New("quad store is full")
+
+	// ErrNoExpiry is returned for writes of quads that expire, to a
+	// QuadWriter or QuadStore that does not support expiry.
+	ErrNoExpiry = errors.New("quad store does not support expiry")
 )
 
 var (
@@ -79,10 +106,81 @@ type QuadWriter interface {
 	// if it exists. Does nothing otherwise.
 	RemoveQuad(quad.Quad) error
 
+	// Applies all the changes of a transaction to the store, or none of
+	// them if any cannot be applied.
+	ApplyTransaction(*Transaction) error
+
+	// Removes every quad equal to the pattern in each of its non-empty
+	// fields, returning how many were removed.
+	DeleteQuadsMatching(pattern quad.Quad) (int, error)
+
 	// Cleans up replication and closes the writing aspect of the database.
 	Close() error
 }
 
+// ExpiringWriter is implemented by QuadWriters that can add quads which are
+// removed again once they expire.
+type ExpiringWriter interface {
+	// Add a set of quads to the store that expire at the given time.
+	AddQuadSetExpiring(set []quad.Quad, expires time.Time) error
+}
+
+// ProvenanceWriter is implemented by QuadWriters that can record the
+// provenance of the quads they add.
+type ProvenanceWriter interface {
+	// Add a set of quads to the store, recording the author and source of
+	// the provenance. Its creation time is that of the write.
+	AddQuadSetWithProvenance(set []quad.Quad, p Provenance) error
+}
+
+// IgnoringWriter is implemented by QuadWriters whose handling of duplicate
+// additions and missing deletions can be chosen per call.
+type IgnoringWriter interface {
+	// IgnoreOpts returns the options the writer applies by default.
+	IgnoreOpts() IgnoreOpts
+
+	// WithIgnoreOpts returns a QuadWriter that writes through this one but
+	// applies the given options. Closing it has no effect.
+	WithIgnoreOpts(IgnoreOpts) QuadWriter
+}
+
+// AuditingWriter is implemented by QuadWriters that can attribute the writes
+// made through them in an audit log.
+type AuditingWriter interface {
+	// WithAudit returns a QuadWriter that writes through this one, and
+	// records the given user and request ID with its writes. Closing it has
+	// no effect.
+	WithAudit(user, requestID string) QuadWriter
+}
+
+// ConditionalWriter is implemented by QuadWriters that can make writes
+// conditional on the store not having changed, for safe read-modify-write.
+type ConditionalWriter interface {
+	// WithExpectedHorizon returns a QuadWriter that writes through this
+	// one, but fails each write with ErrConflict unless the horizon of the
+	// store is still the given one, as when the data written was read.
+	// Closing it has no effect.
+	WithExpectedHorizon(horizon int64) QuadWriter
+}
+
+// TracedWriter is implemented by QuadWriters that can trace their writes to
+// the store.
+type TracedWriter interface {
+	// WithSpan returns a QuadWriter that writes through this one, and
+	// traces its writes to the store as children of span. Closing it has
+	// no effect.
+	WithSpan(span trace.Span) QuadWriter
+}
+
+// SyncingWriter is implemented by QuadWriters that can choose when their
+// writes are flushed to disk, for stores that are Syncers.
+type SyncingWriter interface {
+	// WithSync returns a QuadWriter that writes through this one, but
+	// flushes its writes to disk as the policy says. Closing it has no
+	// effect.
+	WithSync(policy SyncPolicy) QuadWriter
+}
+
 type NewQuadWriterFunc func(QuadStore, Options) (QuadWriter, error)
 
 var writerRegistry = make(map[string]NewQuadWriterFunc)
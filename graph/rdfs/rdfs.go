@@ -0,0 +1,246 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rdfs materializes the entailments of rdfs:subClassOf and
+// rdfs:subPropertyOf, so that queries such as Out("rdf:type") find the
+// superclasses of a node's classes without rewriting.
+//
+// Entailed quads are written to a label of their own, which is replaced as a
+// whole every time the entailments are materialized. The reasoning reads the
+// whole store, so it suits small and medium sized graphs.
+package rdfs
+
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// The default vocabulary.
+const (
+	Type          = "<http://www.w3.org/1999/02/22-rdf-syntax-ns#type>"
+	SubClassOf    = "<http://www.w3.org/2000/01/rdf-schema#subClassOf>"
+	SubPropertyOf = "<http://www.w3.org/2000/01/rdf-schema#subPropertyOf>"
+
+	// InferredLabel is the default label of entailed quads.
+	InferredLabel = "<http://www.w3.org/2000/01/rdf-schema#inferred>"
+)
+
+// Options names the predicates reasoned about, and the label entailed quads
+// are written to. Empty fields take the default values.
+type Options struct {
+	Type          string
+	SubClassOf    string
+	SubPropertyOf string
+	Label         string
+}
+
+func (o Options) withDefaults() Options {
+	if o.Type == "" {
+		o.Type = Type
+	}
+	if o.SubClassOf == "" {
+		o.SubClassOf = SubClassOf
+	}
+	if o.SubPropertyOf == "" {
+		o.SubPropertyOf = SubPropertyOf
+	}
+	if o.Label == "" {
+		o.Label = InferredLabel
+	}
+	return o
+}
+
+type triple struct {
+	s, p, o string
+}
+
+// hierarchy maps each node to its direct parents.
+type hierarchy map[string][]string
+
+// ancestors returns every node reachable from n, not counting n itself
+// unless it lies on a cycle.
+func (h hierarchy) ancestors(n string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	stack := append([]string(nil), h[n]...)
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		out = append(out, c)
+		stack = append(stack, h[c]...)
+	}
+	return out
+}
+
+// Entailments returns the quads entailed by the ones in qs, other than those
+// already asserted, labelled with the inference label.
+func Entailments(qs graph.QuadStore, opts Options) ([]quad.Quad, error) {
+	opts = opts.withDefaults()
+	var (
+		asserted   = make(map[triple]bool)
+		triples    []triple
+		classes    = make(hierarchy)
+		properties = make(hierarchy)
+	)
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		q := qs.Quad(it.Result())
+		if q.Label == opts.Label {
+			continue
+		}
+		t := triple{q.Subject, q.Predicate, q.Object}
+		if asserted[t] {
+			continue
+		}
+		asserted[t] = true
+		triples = append(triples, t)
+		switch q.Predicate {
+		case opts.SubClassOf:
+			classes[q.Subject] = append(classes[q.Subject], q.Object)
+		case opts.SubPropertyOf:
+			properties[q.Subject] = append(properties[q.Subject], q.Object)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	var out []quad.Quad
+	entailed := make(map[triple]bool)
+	add := func(t triple) {
+		if asserted[t] || entailed[t] {
+			return
+		}
+		entailed[t] = true
+		out = append(out, quad.Quad{Subject: t.s, Predicate: t.p, Object: t.o, Label: opts.Label})
+	}
+
+	// The hierarchies are transitive.
+	for c := range classes {
+		for _, d := range classes.ancestors(c) {
+			add(triple{c, opts.SubClassOf, d})
+		}
+	}
+	for p := range properties {
+		for _, d := range properties.ancestors(p) {
+			add(triple{p, opts.SubPropertyOf, d})
+		}
+	}
+
+	// A statement with a property holds for its superproperties, and a
+	// member of a class is a member of its superclasses. Type statements
+	// entailed by the first rule are subject to the second.
+	var typed []triple
+	for _, t := range triples {
+		if t.p == opts.Type {
+			typed = append(typed, t)
+		}
+		for _, p := range properties.ancestors(t.p) {
+			e := triple{t.s, p, t.o}
+			add(e)
+			if p == opts.Type {
+				typed = append(typed, e)
+			}
+		}
+	}
+	for _, t := range typed {
+		for _, c := range classes.ancestors(t.o) {
+			add(triple{t.s, opts.Type, c})
+		}
+	}
+	return out, nil
+}
+
+// Materialize brings the quads under the inference label up to date with
+// the others in qs, and returns how many it added and removed.
+func Materialize(qs graph.QuadStore, qw graph.QuadWriter, opts Options) (added, removed int, err error) {
+	opts = opts.withDefaults()
+	want, err := Entailments(qs, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	have, err := graph.MatchingQuads(qs, quad.Quad{Label: opts.Label})
+	if err != nil {
+		return 0, 0, err
+	}
+	current := make(map[quad.Quad]bool, len(have))
+	for _, q := range have {
+		current[q] = true
+	}
+	tx := graph.NewTransaction()
+	for _, q := range want {
+		if current[q] {
+			delete(current, q)
+			continue
+		}
+		tx.AddQuad(q)
+		added++
+	}
+	for q := range current {
+		tx.RemoveQuad(q)
+		removed++
+	}
+	err = qw.ApplyTransaction(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return added, removed, nil
+}
+
+// Writer is a QuadWriter that materializes the entailments after every
+// successful write, so the inference label never goes stale.
+type Writer struct {
+	graph.QuadWriter
+	qs   graph.QuadStore
+	opts Options
+}
+
+// NewWriter wraps qw, which writes to qs.
+func NewWriter(qs graph.QuadStore, qw graph.QuadWriter, opts Options) *Writer {
+	return &Writer{QuadWriter: qw, qs: qs, opts: opts}
+}
+
+func (w *Writer) materialize(err error) error {
+	if err != nil {
+		return err
+	}
+	_, _, err = Materialize(w.qs, w.QuadWriter, w.opts)
+	return err
+}
+
+func (w *Writer) AddQuad(q quad.Quad) error {
+	return w.materialize(w.QuadWriter.AddQuad(q))
+}
+
+func (w *Writer) AddQuadSet(set []quad.Quad) error {
+	return w.materialize(w.QuadWriter.AddQuadSet(set))
+}
+
+func (w *Writer) RemoveQuad(q quad.Quad) error {
+	return w.materialize(w.QuadWriter.RemoveQuad(q))
+}
+
+func (w *Writer) ApplyTransaction(t *graph.Transaction) error {
+	return w.materialize(w.QuadWriter.ApplyTransaction(t))
+}
+
+func (w *Writer) DeleteQuadsMatching(pattern quad.Quad) (int, error) {
+	n, err := w.QuadWriter.DeleteQuadsMatching(pattern)
+	return n, w.materialize(err)
+}
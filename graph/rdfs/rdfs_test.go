@@ -0,0 +1,138 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdfs
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+var testOpts = Options{
+	Type:          "type",
+	SubClassOf:    "subClassOf",
+	SubPropertyOf: "subPropertyOf",
+	Label:         "inferred",
+}
+
+var schemaGraph = []quad.Quad{
+	{"cat", "subClassOf", "mammal", ""},
+	{"mammal", "subClassOf", "animal", ""},
+	{"animal", "subClassOf", "thing", ""},
+	{"thing", "subClassOf", "animal", ""},
+	{"hasPet", "subPropertyOf", "knows", ""},
+	{"isA", "subPropertyOf", "type", ""},
+	{"felix", "type", "cat", ""},
+	{"tom", "isA", "mammal", ""},
+	{"alice", "hasPet", "felix", ""},
+	{"alice", "knows", "bob", ""},
+}
+
+func makeTestStore(t *testing.T) (graph.QuadStore, graph.QuadWriter) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	if err := w.AddQuadSet(schemaGraph); err != nil {
+		t.Fatalf("Could not load quads: %v", err)
+	}
+	return qs, w
+}
+
+func names(qs graph.QuadStore, p *path.Path) []string {
+	var out []string
+	it := p.BuildIterator()
+	it, _ = it.Optimize()
+	for graph.Next(it) {
+		out = append(out, qs.NameOf(it.Result()))
+	}
+	sort.Strings(out)
+	return out
+}
+
+var inferenceTests = []struct {
+	message string
+	path    func(graph.QuadStore) *path.Path
+	expect  []string
+}{
+	{
+		message: "find the superclasses of a member",
+		path:    func(qs graph.QuadStore) *path.Path { return path.StartPath(qs, "felix").Out("type") },
+		expect:  []string{"animal", "cat", "mammal", "thing"},
+	},
+	{
+		message: "find the members of a superclass",
+		path:    func(qs graph.QuadStore) *path.Path { return path.StartPath(qs, "animal").In("type") },
+		expect:  []string{"felix", "tom"},
+	},
+	{
+		message: "follow a superproperty",
+		path:    func(qs graph.QuadStore) *path.Path { return path.StartPath(qs, "alice").Out("knows") },
+		expect:  []string{"bob", "felix"},
+	},
+	{
+		message: "close the class hierarchy",
+		path:    func(qs graph.QuadStore) *path.Path { return path.StartPath(qs, "cat").Out("subClassOf") },
+		expect:  []string{"animal", "mammal", "thing"},
+	},
+}
+
+func TestMaterialize(t *testing.T) {
+	qs, w := makeTestStore(t)
+	added, removed, err := Materialize(qs, w, testOpts)
+	if err != nil {
+		t.Fatalf("Failed to materialize: %v", err)
+	}
+	if added == 0 || removed != 0 {
+		t.Errorf("Unexpected changes, got: %d added, %d removed", added, removed)
+	}
+	for _, test := range inferenceTests {
+		got := names(qs, test.path(qs))
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+
+	added, removed, err = Materialize(qs, w, testOpts)
+	if err != nil || added != 0 || removed != 0 {
+		t.Errorf("Unexpected changes on second run, got: %d added, %d removed, %v", added, removed, err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	sw, _ := graph.NewQuadWriter("single", qs, nil)
+	w := NewWriter(qs, sw, testOpts)
+	if err := w.AddQuadSet(schemaGraph); err != nil {
+		t.Fatalf("Could not load quads: %v", err)
+	}
+	got := names(qs, path.StartPath(qs, "felix").Out("type"))
+	if expect := []string{"animal", "cat", "mammal", "thing"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected classes, got:%v expect:%v", got, expect)
+	}
+
+	if err := w.RemoveQuad(quad.Quad{"cat", "subClassOf", "mammal", ""}); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	got = names(qs, path.StartPath(qs, "felix").Out("type"))
+	if expect := []string{"cat"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected classes after removal, got:%v expect:%v", got, expect)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replica implements a QuadStore that sends writes to a primary
+// store and spreads reads across a set of read replicas.
+//
+// Keeping the replicas up to date is left to the backends (for example a
+// Mongo replica set, or stores fed from the primary's log). The values of
+// different stores cannot be mixed within a query, so reads are routed per
+// request: Pick, and the per-request store used by the HTTP server when
+// http_request_context is set, return a view of a single replica. Reads made
+// directly on the QuadStore are served by the primary.
+package replica
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+const QuadStoreType = "replica"
+
+func init() {
+	graph.RegisterQuadStore(QuadStoreType, true, newQuadStore, createNewReplicaGraph, newQuadStoreForRequest)
+}
+
+var ErrNoPrimary = errors.New("replica: no primary configured")
+
+// Routing selects how reads are spread across the replicas.
+type Routing int
+
+const (
+	// RoundRobin uses each replica in turn.
+	RoundRobin Routing = iota
+	// LowestLatency uses the replica that has answered fastest recently.
+	LowestLatency
+)
+
+var routings = map[string]Routing{
+	"round_robin": RoundRobin,
+	"latency":     LowestLatency,
+}
+
+const defaultProbeInterval = time.Second
+
+type replica struct {
+	qs      graph.QuadStore
+	horizon int64
+	latency time.Duration
+}
+
+type QuadStore struct {
+	primary  graph.QuadStore
+	replicas []*replica
+	routing  Routing
+
+	// maxLag is the number of deltas a replica may be behind the primary
+	// and still serve reads. A negative value disables the check.
+	maxLag int64
+
+	probeInterval time.Duration
+
+	mu      sync.Mutex
+	probed  time.Time
+	horizon int64
+	next    int
+
+	watch graph.Notifier
+}
+
+func createNewReplicaGraph(_ string, options graph.Options) error {
+	primary, replicas, err := storeConfigs(options)
+	if err != nil {
+		return err
+	}
+	err = primary.Init()
+	if err != nil {
+		return fmt.Errorf("primary: %v", err)
+	}
+	for i, c := range replicas {
+		err = c.Init()
+		if err != nil {
+			return fmt.Errorf("replica %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func storeConfigs(options graph.Options) (graph.StoreConfig, []graph.StoreConfig, error) {
+	primary, ok, err := options.StoreConfigKey("primary")
+	if err != nil {
+		return graph.StoreConfig{}, nil, err
+	} else if !ok {
+		return graph.StoreConfig{}, nil, ErrNoPrimary
+	}
+	replicas, _, err := options.StoreConfigsKey("replicas")
+	if err != nil {
+		return graph.StoreConfig{}, nil, err
+	}
+	return primary, replicas, nil
+}
+
+func newQuadStore(_ string, options graph.Options) (graph.QuadStore, error) {
+	routing := RoundRobin
+	name, ok, err := options.StringKey("routing")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		routing, ok = routings[name]
+		if !ok {
+			return nil, fmt.Errorf("replica: unknown routing %q", name)
+		}
+	}
+	maxLag := int64(-1)
+	lag, ok, err := options.IntKey("max_lag")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		maxLag = int64(lag)
+	}
+	probeInterval := defaultProbeInterval
+	interval, ok, err := options.IntKey("probe_interval_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		probeInterval = time.Duration(interval) * time.Millisecond
+	}
+
+	pc, rcs, err := storeConfigs(options)
+	if err != nil {
+		return nil, err
+	}
+	primary, err := pc.Open()
+	if err != nil {
+		return nil, fmt.Errorf("primary: %v", err)
+	}
+	var replicas []graph.QuadStore
+	for i, c := range rcs {
+		r, err := c.Open()
+		if err != nil {
+			primary.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %v", i, err)
+		}
+		replicas = append(replicas, r)
+	}
+	qs := New(primary, replicas, routing, maxLag)
+	qs.probeInterval = probeInterval
+	return qs, nil
+}
+
+func newQuadStoreForRequest(qs graph.QuadStore, _ graph.Options) (graph.QuadStore, error) {
+	return qs.(*QuadStore).Pick(), nil
+}
+
+// New returns a QuadStore writing to primary and reading from replicas,
+// which may lag at most maxLag deltas behind the primary. A negative maxLag
+// accepts replicas however stale they are.
+func New(primary graph.QuadStore, replicas []graph.QuadStore, routing Routing, maxLag int64) *QuadStore {
+	qs := &QuadStore{
+		primary:       primary,
+		routing:       routing,
+		maxLag:        maxLag,
+		probeInterval: defaultProbeInterval,
+	}
+	for _, r := range replicas {
+		qs.replicas = append(qs.replicas, &replica{qs: r})
+	}
+	return qs
+}
+
+// probe refreshes the horizons of the primary and the replicas, timing the
+// replicas' answers to estimate their latency. It must be called with qs.mu
+// held.
+func (qs *QuadStore) probe() {
+	if !qs.probed.IsZero() && time.Since(qs.probed) < qs.probeInterval {
+		return
+	}
+	h := qs.primary.Horizon()
+	qs.horizon = h.Int()
+	for _, r := range qs.replicas {
+		start := time.Now()
+		h := r.qs.Horizon()
+		d := time.Since(start)
+		r.horizon = h.Int()
+		if r.latency == 0 {
+			r.latency = d
+		} else {
+			// Exponentially weighted, so a single slow answer does not
+			// take a replica out of rotation.
+			r.latency = (4*r.latency + d) / 5
+		}
+	}
+	qs.probed = time.Now()
+}
+
+func (qs *QuadStore) fresh(r *replica) bool {
+	return qs.maxLag < 0 || qs.horizon-r.horizon <= qs.maxLag
+}
+
+// Pick returns a QuadStore reading from one of the replicas, chosen by the
+// routing policy among those within the staleness bound, or from the primary
+// if there is none. Writes to the returned store go to the primary. The
+// returned store must not be closed.
+func (qs *QuadStore) Pick() graph.QuadStore {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.probe()
+
+	var candidates []*replica
+	for _, r := range qs.replicas {
+		if qs.fresh(r) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(qs.replicas) != 0 {
+			clog.V(2).Infoln("replica: no replica within staleness bound, reading from primary")
+		}
+		return &view{QuadStore: qs.primary, parent: qs}
+	}
+
+	var r *replica
+	switch qs.routing {
+	case LowestLatency:
+		r = candidates[0]
+		for _, c := range candidates[1:] {
+			if c.latency < r.latency {
+				r = c
+			}
+		}
+	default:
+		r = candidates[qs.next%len(candidates)]
+		qs.next++
+	}
+	return &view{QuadStore: r.qs, parent: qs}
+}
+
+func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	changes, err := graph.Changes(qs.primary, deltas, ignoreOpts)
+	if err != nil {
+		return err
+	}
+	err = qs.primary.ApplyDeltas(deltas, ignoreOpts)
+	if err != nil {
+		return err
+	}
+	qs.watch.Notify(changes)
+	return nil
+}
+
+func (qs *QuadStore) Subscribe(pattern quad.Quad) <-chan graph.Delta {
+	return qs.watch.Subscribe(pattern)
+}
+
+func (qs *QuadStore) Unsubscribe(c <-chan graph.Delta) {
+	qs.watch.Unsubscribe(c)
+}
+
+func (qs *QuadStore) Quad(v graph.Value) quad.Quad {
+	return qs.primary.Quad(v)
+}
+
+func (qs *QuadStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	return qs.primary.QuadIterator(d, v)
+}
+
+func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	return qs.primary.NodesAllIterator()
+}
+
+func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
+	return qs.primary.QuadsAllIterator()
+}
+
+func (qs *QuadStore) ValueOf(name string) graph.Value {
+	return qs.primary.ValueOf(name)
+}
+
+func (qs *QuadStore) NameOf(v graph.Value) string {
+	return qs.primary.NameOf(v)
+}
+
+func (qs *QuadStore) Size() int64 {
+	return qs.primary.Size()
+}
+
+func (qs *QuadStore) Horizon() graph.PrimaryKey {
+	return qs.primary.Horizon()
+}
+
+func (qs *QuadStore) FixedIterator() graph.FixedIterator {
+	return qs.primary.FixedIterator()
+}
+
+func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return qs.primary.OptimizeIterator(it)
+}
+
+func (qs *QuadStore) Close() {
+	qs.watch.Close()
+	qs.primary.Close()
+	for _, r := range qs.replicas {
+		r.qs.Close()
+	}
+}
+
+func (qs *QuadStore) QuadDirection(v graph.Value, d quad.Direction) graph.Value {
+	return qs.primary.QuadDirection(v, d)
+}
+
+func (qs *QuadStore) Type() string {
+	return QuadStoreType
+}
+
+// view reads from a single store and writes to the primary.
+type view struct {
+	graph.QuadStore
+	parent *QuadStore
+}
+
+func (v *view) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	return v.parent.ApplyDeltas(deltas, ignoreOpts)
+}
+
+// Horizon returns the horizon of the primary, so that writers opened on the
+// view continue from the primary's last transaction.
+func (v *view) Horizon() graph.PrimaryKey {
+	return v.parent.Horizon()
+}
+
+// Close does nothing; the stores belong to the replica QuadStore.
+func (v *view) Close() {}
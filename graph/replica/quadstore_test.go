@@ -0,0 +1,96 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replica
+
+import (
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+var simpleGraph = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"C", "follows", "B", ""},
+	{"C", "follows", "D", ""},
+}
+
+func newMemStore(t *testing.T) graph.QuadStore {
+	qs, err := graph.NewQuadStore("memstore", "", nil)
+	if err != nil {
+		t.Fatalf("Could not create memstore: %v", err)
+	}
+	return qs
+}
+
+func load(t *testing.T, qs graph.QuadStore, data []quad.Quad) {
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	for _, q := range data {
+		if err := w.AddQuad(q); err != nil {
+			t.Fatalf("Could not add %v: %v", q, err)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	primary := newMemStore(t)
+	r1, r2 := newMemStore(t), newMemStore(t)
+	qs := New(primary, []graph.QuadStore{r1, r2}, RoundRobin, 1)
+	qs.probeInterval = 0
+
+	load(t, qs, simpleGraph)
+	if s := primary.Size(); s != int64(len(simpleGraph)) {
+		t.Fatalf("Unexpected primary size, got:%d expect:%d", s, len(simpleGraph))
+	}
+	if s := r1.Size(); s != 0 {
+		t.Fatalf("Unexpected write to replica, size:%d", s)
+	}
+
+	// Both replicas are too stale.
+	if v := qs.Pick().(*view); v.QuadStore != primary {
+		t.Errorf("Expected read from primary with stale replicas")
+	}
+
+	// Catch up the first replica, and bring the second within bounds.
+	load(t, r1, simpleGraph)
+	load(t, r2, simpleGraph[:2])
+	seen := make(map[graph.QuadStore]int)
+	for i := 0; i < 4; i++ {
+		seen[qs.Pick().(*view).QuadStore]++
+	}
+	if seen[r1] != 2 || seen[r2] != 2 {
+		t.Errorf("Unexpected round robin distribution: %v", seen)
+	}
+
+	// Writes through a view go to the primary.
+	v := qs.Pick()
+	w, _ := graph.NewQuadWriter("single", v, nil)
+	if err := w.AddQuad(quad.Quad{"D", "follows", "B", ""}); err != nil {
+		t.Fatalf("Could not write through view: %v", err)
+	}
+	if s := primary.Size(); s != int64(len(simpleGraph)+1) {
+		t.Errorf("Unexpected primary size after view write, got:%d expect:%d", s, len(simpleGraph)+1)
+	}
+
+	// The second replica is now too far behind.
+	for i := 0; i < 2; i++ {
+		if v := qs.Pick().(*view); v.QuadStore != r1 {
+			t.Errorf("Expected read from up to date replica")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Annotation is a tagged value that is not a node of any store, such as the
+// provenance of a quad saved by a query. Its name is itself.
+type Annotation string
+
+// ValuesOf returns the value of each name in qs, in order, in one call if qs
+// is a BulkResolver.
+func ValuesOf(qs QuadStore, names []string) []Value {
+	if r, ok := qs.(BulkResolver); ok {
+		return r.ValuesOf(names)
+	}
+	out := make([]Value, len(names))
+	for i, n := range names {
+		out[i] = qs.ValueOf(n)
+	}
+	return out
+}
+
+// NamesOf returns the name of each value in qs, in order, in one call if qs
+// is a BulkResolver. Annotations are named without asking qs.
+func NamesOf(qs QuadStore, values []Value) []string {
+	out := make([]string, len(values))
+	var (
+		nodes []Value
+		index []int
+	)
+	for i, v := range values {
+		if a, ok := v.(Annotation); ok {
+			out[i] = string(a)
+		} else {
+			nodes = append(nodes, v)
+			index = append(index, i)
+		}
+	}
+	if len(nodes) == 0 {
+		return out
+	}
+	r, ok := qs.(BulkResolver)
+	if !ok {
+		for _, i := range index {
+			out[i] = qs.NameOf(values[i])
+		}
+		return out
+	}
+	for j, name := range r.NamesOf(nodes) {
+		out[index[j]] = name
+	}
+	return out
+}
+
+// FixedIteratorOf returns a fixed iterator over the values of the names.
+func FixedIteratorOf(qs QuadStore, names ...string) FixedIterator {
+	fixed := qs.FixedIterator()
+	for _, v := range ValuesOf(qs, names) {
+		fixed.Add(v)
+	}
+	return fixed
+}
+
+// NamesOfTags returns the names of the values of each set of tags, resolving
+// all of them at once.
+func NamesOfTags(qs QuadStore, tags []map[string]Value) []map[string]string {
+	var (
+		keys   []string
+		values []Value
+	)
+	for _, m := range tags {
+		for k, v := range m {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+	}
+	names := NamesOf(qs, values)
+	out := make([]map[string]string, len(tags))
+	i := 0
+	for j, m := range tags {
+		out[j] = make(map[string]string, len(m))
+		for n := i + len(m); i < n; i++ {
+			out[j][keys[i]] = names[i]
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// upperStore names each value by its upper case.
+type upperStore struct {
+	QuadStore
+}
+
+func (upperStore) ValueOf(s string) Value { return strings.ToLower(s) }
+func (upperStore) NameOf(v Value) string  { return strings.ToUpper(v.(string)) }
+
+// bulkStore counts the calls made to resolve names.
+type bulkStore struct {
+	upperStore
+	calls int
+}
+
+func (s *bulkStore) ValuesOf(names []string) []Value {
+	s.calls++
+	out := make([]Value, len(names))
+	for i, n := range names {
+		out[i] = s.ValueOf(n)
+	}
+	return out
+}
+
+func (s *bulkStore) NamesOf(values []Value) []string {
+	s.calls++
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = s.NameOf(v)
+	}
+	return out
+}
+
+func TestResolve(t *testing.T) {
+	bulk := &bulkStore{}
+	for _, qs := range []QuadStore{upperStore{}, bulk} {
+		values := ValuesOf(qs, []string{"A", "B"})
+		if expect := []Value{"a", "b"}; !reflect.DeepEqual(values, expect) {
+			t.Errorf("Unexpected values for %T, got:%v expect:%v", qs, values, expect)
+		}
+		names := NamesOf(qs, values)
+		if expect := []string{"A", "B"}; !reflect.DeepEqual(names, expect) {
+			t.Errorf("Unexpected names for %T, got:%v expect:%v", qs, names, expect)
+		}
+		mixed := NamesOf(qs, []Value{"a", Annotation("b")})
+		if expect := []string{"A", "b"}; !reflect.DeepEqual(mixed, expect) {
+			t.Errorf("Unexpected names with an annotation for %T, got:%v expect:%v", qs, mixed, expect)
+		}
+		tags := NamesOfTags(qs, []map[string]Value{
+			{"x": "a", "y": "b"},
+			{},
+			{"x": "c"},
+		})
+		expect := []map[string]string{
+			{"x": "A", "y": "B"},
+			{},
+			{"x": "C"},
+		}
+		if !reflect.DeepEqual(tags, expect) {
+			t.Errorf("Unexpected tag names for %T, got:%v expect:%v", qs, tags, expect)
+		}
+	}
+	if bulk.calls != 4 {
+		t.Errorf("Unexpected number of bulk calls, got:%d expect:4", bulk.calls)
+	}
+	if !Capabilities(bulk).Has(CanResolve) {
+		t.Errorf("Bulk store should have the resolve capability")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "errors"
+
+var (
+	// ErrNoRevisions is returned when reading an earlier revision of a
+	// store that does not keep them.
+	ErrNoRevisions = errors.New("quad store does not support revisions")
+
+	// ErrUnknownRevision is returned when reading a revision before the
+	// first or after the latest delta applied to a store.
+	ErrUnknownRevision = errors.New("unknown revision")
+
+	// ErrRevisionReadOnly is returned when applying deltas to an earlier
+	// revision of a store.
+	ErrRevisionReadOnly = errors.New("cannot write to an earlier revision")
+)
+
+// AtRevision returns a read-only view of qs as it was once the delta with
+// the given ID had been applied, or ErrNoRevisions if qs is not a Reviser.
+func AtRevision(qs QuadStore, horizon int64) (QuadStore, error) {
+	r, ok := qs.(Reviser)
+	if !ok {
+		return nil, ErrNoRevisions
+	}
+	return r.AtRevision(horizon)
+}
+
+// AtRevision returns a read-only view of the handle's store as it was once
+// the delta with the given ID had been applied.
+func (h *Handle) AtRevision(horizon int64) (QuadStore, error) {
+	return AtRevision(h.QuadStore, horizon)
+}
+
+// Snapshot returns a read-only view of qs as of its current horizon, whose
+// iterators do not see the quads added or deleted afterwards, so that long
+// reads stay consistent while writes go on. Stores that do not keep
+// revisions are returned as they are.
+func Snapshot(qs QuadStore) QuadStore {
+	h := qs.Horizon()
+	snap, err := AtRevision(qs, h.Int())
+	if err != nil {
+		return qs
+	}
+	return snap
+}
+
+// Snapshot returns a read-only view of the handle's store as of its current
+// horizon.
+func (h *Handle) Snapshot() QuadStore {
+	return Snapshot(h.QuadStore)
+}
@@ -0,0 +1,173 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"fmt"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+)
+
+var _ graph.Nexter = &Iterator{}
+
+var shardType graph.Type
+
+func init() {
+	shardType = graph.RegisterIterator("shard")
+}
+
+// Iterator wraps an iterator of one of the shards, translating the values of
+// the shard into values of the sharded QuadStore and back.
+type Iterator struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     *QuadStore
+	shard  int
+	subIt  graph.Iterator
+	nodes  bool
+	result graph.Value
+}
+
+// NewIterator wraps sub, an iterator of the shard at index i. If nodes is
+// true, sub is an iterator of nodes, otherwise it is an iterator of quads.
+func NewIterator(qs *QuadStore, i int, sub graph.Iterator, nodes bool) *Iterator {
+	return &Iterator{
+		uid:   iterator.NextUID(),
+		qs:    qs,
+		shard: i,
+		subIt: sub,
+		nodes: nodes,
+	}
+}
+
+func (it *Iterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *Iterator) Reset() {
+	it.result = nil
+	it.subIt.Reset()
+}
+
+func (it *Iterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Iterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *Iterator) Clone() graph.Iterator {
+	m := NewIterator(it.qs, it.shard, it.subIt.Clone(), it.nodes)
+	m.tags.CopyFrom(it)
+	return m
+}
+
+func (it *Iterator) Close() error {
+	return it.subIt.Close()
+}
+
+// fromShard converts a value of the shard into a value of the sharded store.
+func (it *Iterator) fromShard(v graph.Value) graph.Value {
+	if it.nodes {
+		return it.qs.shards[it.shard].NameOf(v)
+	}
+	return quadValue{shard: it.shard, val: v}
+}
+
+func (it *Iterator) Next() bool {
+	graph.NextLogIn(it)
+	if !graph.Next(it.subIt) {
+		it.result = nil
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.fromShard(it.subIt.Result())
+	return graph.NextLogOut(it, it.result, true)
+}
+
+func (it *Iterator) Err() error {
+	return it.subIt.Err()
+}
+
+func (it *Iterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *Iterator) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+func (it *Iterator) Contains(v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	var sv graph.Value
+	if it.nodes {
+		sv = it.qs.shards[it.shard].ValueOf(v.(string))
+	} else {
+		q := v.(quadValue)
+		if q.shard != it.shard {
+			return graph.ContainsLogOut(it, v, false)
+		}
+		sv = q.val
+	}
+	if !it.subIt.Contains(sv) {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	it.result = v
+	return graph.ContainsLogOut(it, v, true)
+}
+
+// SubIterators returns no subiterators; the wrapped iterator belongs to the
+// shard and cannot be combined with iterators of the sharded store.
+func (it *Iterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *Iterator) Size() (int64, bool) {
+	return it.subIt.Size()
+}
+
+func (it *Iterator) Type() graph.Type { return shardType }
+
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+func (it *Iterator) Describe() graph.Description {
+	sub := it.subIt.Describe()
+	size, _ := it.Size()
+	return graph.Description{
+		UID:      it.UID(),
+		Name:     fmt.Sprintf("shard %d", it.shard),
+		Type:     it.Type(),
+		Tags:     it.tags.Tags(),
+		Size:     size,
+		Iterator: &sub,
+	}
+}
+
+func (it *Iterator) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
@@ -0,0 +1,267 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shard implements a QuadStore that hash-partitions quads by subject
+// across a number of child QuadStores, so that a graph too big for a single
+// backend instance can still be served as one.
+//
+// Every quad lives in exactly one shard, chosen by its subject. Nodes, on the
+// other hand, may be referenced from any shard, so node values are the node
+// names themselves and are resolved against each child as needed. Quad values
+// remember the shard they came from.
+//
+// Writes are applied shard by shard and are not atomic across shards: if a
+// shard fails, the deltas already applied to the others stay applied.
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+const QuadStoreType = "shard"
+
+func init() {
+	graph.RegisterQuadStore(QuadStoreType, true, newQuadStore, createNewShardGraph, nil)
+}
+
+var ErrNoShards = errors.New("shard: no shards configured")
+
+// shardConfigs reads the "shards" option, a list of store configurations.
+func shardConfigs(options graph.Options) ([]graph.StoreConfig, error) {
+	configs, ok, err := options.StoreConfigsKey("shards")
+	if err != nil {
+		return nil, err
+	}
+	if !ok || len(configs) == 0 {
+		return nil, ErrNoShards
+	}
+	return configs, nil
+}
+
+func createNewShardGraph(_ string, options graph.Options) error {
+	configs, err := shardConfigs(options)
+	if err != nil {
+		return err
+	}
+	for i, c := range configs {
+		err := c.Init()
+		if err != nil {
+			return fmt.Errorf("shard %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+type QuadStore struct {
+	shards []graph.QuadStore
+	watch  graph.Notifier
+}
+
+func newQuadStore(_ string, options graph.Options) (graph.QuadStore, error) {
+	configs, err := shardConfigs(options)
+	if err != nil {
+		return nil, err
+	}
+	var shards []graph.QuadStore
+	for i, c := range configs {
+		qs, err := c.Open()
+		if err != nil {
+			for _, s := range shards {
+				s.Close()
+			}
+			return nil, fmt.Errorf("shard %d: %v", i, err)
+		}
+		shards = append(shards, qs)
+	}
+	return New(shards...), nil
+}
+
+// New returns a QuadStore partitioning quads across the given stores. The
+// order of the stores is significant: reopening a sharded graph with the
+// stores in a different order, or a different number of them, will not find
+// the existing quads.
+func New(shards ...graph.QuadStore) *QuadStore {
+	return &QuadStore{shards: shards}
+}
+
+// shardOf returns the index of the shard holding the quads with the given
+// subject.
+func (qs *QuadStore) shardOf(subject string) int {
+	h := fnv.New32a()
+	h.Write([]byte(subject))
+	return int(h.Sum32() % uint32(len(qs.shards)))
+}
+
+// quadValue is the value of a quad: the shard it lives in and the value the
+// shard has given it.
+type quadValue struct {
+	shard int
+	val   graph.Value
+}
+
+type quadKey struct {
+	shard int
+	key   interface{}
+}
+
+func (v quadValue) Key() interface{} {
+	return quadKey{v.shard, keyOf(v.val)}
+}
+
+func keyOf(v graph.Value) interface{} {
+	if k, ok := v.(iterator.Keyer); ok {
+		return k.Key()
+	}
+	return v
+}
+
+func equal(a, b graph.Value) bool {
+	return keyOf(a) == keyOf(b)
+}
+
+func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	parts := make([][]graph.Delta, len(qs.shards))
+	for _, d := range deltas {
+		i := qs.shardOf(d.Quad.Subject)
+		parts[i] = append(parts[i], d)
+	}
+	var changes []graph.Delta
+	for i, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		c, err := graph.Changes(qs.shards[i], part, ignoreOpts)
+		if err != nil {
+			return err
+		}
+		err = qs.shards[i].ApplyDeltas(part, ignoreOpts)
+		if err != nil {
+			clog.Errorf("shard %d: could not apply %d deltas: %v", i, len(part), err)
+			return err
+		}
+		changes = append(changes, c...)
+	}
+	qs.watch.Notify(changes)
+	return nil
+}
+
+func (qs *QuadStore) Subscribe(pattern quad.Quad) <-chan graph.Delta {
+	return qs.watch.Subscribe(pattern)
+}
+
+func (qs *QuadStore) Unsubscribe(c <-chan graph.Delta) {
+	qs.watch.Unsubscribe(c)
+}
+
+func (qs *QuadStore) Quad(v graph.Value) quad.Quad {
+	q := v.(quadValue)
+	return qs.shards[q.shard].Quad(q.val)
+}
+
+func (qs *QuadStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	name := v.(string)
+	if d == quad.Subject {
+		i := qs.shardOf(name)
+		s := qs.shards[i]
+		return NewIterator(qs, i, s.QuadIterator(d, s.ValueOf(name)), false)
+	}
+	or := iterator.NewOr()
+	for i, s := range qs.shards {
+		or.AddSubIterator(NewIterator(qs, i, s.QuadIterator(d, s.ValueOf(name)), false))
+	}
+	return or
+}
+
+func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	or := iterator.NewOr()
+	for i, s := range qs.shards {
+		or.AddSubIterator(NewIterator(qs, i, s.NodesAllIterator(), true))
+	}
+	return iterator.NewUnique(or)
+}
+
+func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
+	or := iterator.NewOr()
+	for i, s := range qs.shards {
+		or.AddSubIterator(NewIterator(qs, i, s.QuadsAllIterator(), false))
+	}
+	return or
+}
+
+// ValueOf returns the name itself; it is resolved against each shard when
+// it is used.
+func (qs *QuadStore) ValueOf(name string) graph.Value {
+	return name
+}
+
+func (qs *QuadStore) NameOf(v graph.Value) string {
+	if v == nil {
+		return ""
+	}
+	return v.(string)
+}
+
+func (qs *QuadStore) Size() int64 {
+	var size int64
+	for _, s := range qs.shards {
+		size += s.Size()
+	}
+	return size
+}
+
+// Horizon returns the latest horizon among the shards. Deltas keep the IDs
+// given by the writer when they are distributed, so this is the ID of the
+// last delta applied to any shard.
+func (qs *QuadStore) Horizon() graph.PrimaryKey {
+	var horizon int64
+	for _, s := range qs.shards {
+		h := s.Horizon()
+		if n := h.Int(); n > horizon {
+			horizon = n
+		}
+	}
+	return graph.NewSequentialKey(horizon)
+}
+
+func (qs *QuadStore) FixedIterator() graph.FixedIterator {
+	return iterator.NewFixed(equal)
+}
+
+func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
+
+func (qs *QuadStore) Close() {
+	qs.watch.Close()
+	for _, s := range qs.shards {
+		s.Close()
+	}
+}
+
+func (qs *QuadStore) QuadDirection(v graph.Value, d quad.Direction) graph.Value {
+	q := v.(quadValue)
+	s := qs.shards[q.shard]
+	return s.NameOf(s.QuadDirection(q.val, d))
+}
+
+func (qs *QuadStore) Type() string {
+	return QuadStoreType
+}
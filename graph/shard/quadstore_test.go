@@ -0,0 +1,137 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+var simpleGraph = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"C", "follows", "B", ""},
+	{"C", "follows", "D", ""},
+	{"D", "follows", "B", ""},
+	{"B", "follows", "F", ""},
+	{"F", "follows", "G", ""},
+	{"D", "follows", "G", ""},
+	{"E", "follows", "F", ""},
+	{"B", "status", "cool", "status_graph"},
+	{"D", "status", "cool", "status_graph"},
+	{"G", "status", "cool", "status_graph"},
+}
+
+func makeTestStore(t *testing.T, n int) (graph.QuadStore, graph.QuadWriter) {
+	shards := make([]interface{}, n)
+	for i := range shards {
+		shards[i] = map[string]interface{}{"database": "memstore"}
+	}
+	qs, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"shards": shards})
+	if err != nil {
+		t.Fatalf("Could not create sharded store: %v", err)
+	}
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	for _, q := range simpleGraph {
+		if err := w.AddQuad(q); err != nil {
+			t.Fatalf("Could not add %v: %v", q, err)
+		}
+	}
+	return qs, w
+}
+
+func collect(qs graph.QuadStore, it graph.Iterator) []string {
+	var out []string
+	for graph.Next(it) {
+		out = append(out, qs.NameOf(it.Result()))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestShardedStore(t *testing.T) {
+	qs, w := makeTestStore(t, 3)
+	if s := qs.Size(); s != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected size, got:%d expect:%d", s, len(simpleGraph))
+	}
+	horizon := qs.Horizon()
+	if h := horizon.Int(); h != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected horizon, got:%d expect:%d", h, len(simpleGraph))
+	}
+
+	used := make(map[int]bool)
+	for _, q := range simpleGraph {
+		used[qs.(*QuadStore).shardOf(q.Subject)] = true
+	}
+	if len(used) < 2 {
+		t.Fatalf("Test graph only uses %d shard", len(used))
+	}
+
+	nodes := collect(qs, qs.NodesAllIterator())
+	expect := []string{"A", "B", "C", "D", "E", "F", "G", "cool", "follows", "status", "status_graph"}
+	if !reflect.DeepEqual(nodes, expect) {
+		t.Errorf("Unexpected nodes, got:%v expect:%v", nodes, expect)
+	}
+
+	var count int
+	for it := qs.QuadsAllIterator(); graph.Next(it); count++ {
+	}
+	if count != len(simpleGraph) {
+		t.Errorf("Unexpected number of quads, got:%d expect:%d", count, len(simpleGraph))
+	}
+
+	for _, test := range []struct {
+		message string
+		path    *path.Path
+		expect  []string
+	}{
+		{
+			message: "out from one node",
+			path:    path.StartPath(qs, "C").Out("follows"),
+			expect:  []string{"B", "D"},
+		},
+		{
+			message: "in across shards",
+			path:    path.StartPath(qs, "B").In("follows"),
+			expect:  []string{"A", "C", "D"},
+		},
+		{
+			message: "intersection",
+			path:    path.StartPath(qs, "D").Out("follows").And(path.StartPath(qs, "cool").In("status")),
+			expect:  []string{"B", "G"},
+		},
+	} {
+		it, _ := test.path.BuildIterator().Optimize()
+		got := collect(qs, it)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+
+	if err := w.RemoveQuad(quad.Quad{"C", "follows", "D", ""}); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+	got := collect(qs, path.StartPath(qs, "C").Out("follows").BuildIterator())
+	if expect := []string{"B"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected result after removal, got:%v expect:%v", got, expect)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Stats describes the contents of a store.
+type Stats struct {
+	// Quads is the number of live quads.
+	Quads int64 `json:"quads"`
+
+	// Nodes is the number of nodes. If the store is a NodeCounter, it
+	// includes the nodes that only deleted quads reference, until they
+	// are collected as garbage. Otherwise it is the number of nodes
+	// of the quads read, which is a lower bound if they were sampled.
+	Nodes int64 `json:"nodes"`
+
+	// Predicates is the number of live quads with each predicate,
+	// estimated from the sample if the quads were sampled. Predicates
+	// missing from the sample are left out.
+	Predicates map[string]int64 `json:"predicates"`
+
+	// DiskSize is the number of bytes the store takes up on disk, or
+	// zero if it is not known.
+	DiskSize int64 `json:"disk_size,omitempty"`
+
+	// Horizon is the ID of the last delta applied.
+	Horizon int64 `json:"horizon"`
+
+	// Sampled is the number of quads read to estimate the counts from,
+	// or zero if all of them were read, and the counts are exact.
+	Sampled int64 `json:"sampled,omitempty"`
+}
+
+// ReadStats returns the statistics of qs, counting the quads of each
+// predicate, and the nodes of qs if it is not a NodeCounter, from the first
+// sample quads it reads; all of them if sample is not positive.
+func ReadStats(qs QuadStore, sample int64) (Stats, error) {
+	h := qs.Horizon()
+	st := Stats{
+		Quads:      qs.Size(),
+		Horizon:    h.Int(),
+		Predicates: make(map[string]int64),
+	}
+	nc, counted := qs.(NodeCounter)
+	nodes := make(map[string]struct{})
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	var n int64
+	for ; sample <= 0 || n < sample; n++ {
+		if !Next(it) {
+			break
+		}
+		q := qs.Quad(it.Result())
+		st.Predicates[q.Predicate]++
+		if !counted {
+			nodes[q.Subject] = struct{}{}
+			nodes[q.Predicate] = struct{}{}
+			nodes[q.Object] = struct{}{}
+			if q.Label != "" {
+				nodes[q.Label] = struct{}{}
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return Stats{}, err
+	}
+	if sample > 0 && n == sample && Next(it) {
+		st.Sampled = n
+		for p, c := range st.Predicates {
+			st.Predicates[p] = c * st.Quads / n
+		}
+	}
+	if counted {
+		c, err := nc.NodeCount()
+		if err != nil {
+			return Stats{}, err
+		}
+		st.Nodes = c
+	} else {
+		st.Nodes = int64(len(nodes))
+	}
+	return st, nil
+}
+
+// Stats returns the statistics of the handle's store, as ReadStats does.
+func (h *Handle) Stats(sample int64) (Stats, error) {
+	return ReadStats(h.QuadStore, sample)
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/google/cayley/quad"
+
+// ExtractSubgraph returns the quads reachable from the seed nodes in at most
+// depth hops, each hop following a quad from its subject to its object. If
+// via is not empty, only quads with one of its predicates are followed.
+//
+// Every quad is returned once, in the order it was reached.
+func ExtractSubgraph(qs QuadStore, seeds []string, via []string, depth int) ([]quad.Quad, error) {
+	preds := make(map[string]bool, len(via))
+	for _, p := range via {
+		preds[p] = true
+	}
+	var (
+		out      []quad.Quad
+		seenQuad = make(map[quad.Quad]bool)
+		seenNode = make(map[string]bool)
+		frontier []string
+	)
+	for _, s := range seeds {
+		if !seenNode[s] {
+			seenNode[s] = true
+			frontier = append(frontier, s)
+		}
+	}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		var next []string
+		for _, name := range frontier {
+			v := qs.ValueOf(name)
+			if v == nil {
+				continue
+			}
+			it := qs.QuadIterator(quad.Subject, v)
+			for Next(it) {
+				q := qs.Quad(it.Result())
+				if len(preds) != 0 && !preds[q.Predicate] {
+					continue
+				}
+				if !seenQuad[q] {
+					seenQuad[q] = true
+					out = append(out, q)
+				}
+				if !seenNode[q.Object] {
+					seenNode[q.Object] = true
+					next = append(next, q.Object)
+				}
+			}
+			err := it.Err()
+			it.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		frontier = next
+	}
+	return out, nil
+}
+
+// ExtractSubgraph returns the quads of the handle's store reachable from the
+// seed nodes in at most depth hops.
+func (h *Handle) ExtractSubgraph(seeds []string, via []string, depth int) ([]quad.Quad, error) {
+	return ExtractSubgraph(h.QuadStore, seeds, via, depth)
+}
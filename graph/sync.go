@@ -0,0 +1,141 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SyncPolicy is when a store flushes the writes it applies to disk. Writes
+// that are not flushed are faster, but may be lost if the machine fails.
+type SyncPolicy int
+
+const (
+	// SyncDefault applies the policy the store is configured with.
+	SyncDefault SyncPolicy = iota
+
+	// SyncAlways flushes each write before it returns.
+	SyncAlways
+
+	// SyncBatch flushes a write once a batch of deltas has been written
+	// since the last flush, losing at most a batch.
+	SyncBatch
+
+	// SyncNever leaves flushing writes to the operating system.
+	SyncNever
+)
+
+// DefaultSyncBatchSize is the number of deltas written between flushes under
+// SyncBatch, unless set by the "sync_batch_size" option.
+const DefaultSyncBatchSize = 10000
+
+var syncPolicyNames = []string{"default", "always", "batch", "never"}
+
+func (p SyncPolicy) String() string {
+	if p < 0 || int(p) >= len(syncPolicyNames) {
+		return fmt.Sprintf("SyncPolicy(%d)", int(p))
+	}
+	return syncPolicyNames[p]
+}
+
+// ParseSyncPolicy returns the policy with the given name, one of "always",
+// "batch" or "never". An empty name is SyncDefault.
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	if name == "" {
+		return SyncDefault, nil
+	}
+	for i, n := range syncPolicyNames {
+		if n == name {
+			return SyncPolicy(i), nil
+		}
+	}
+	return SyncDefault, fmt.Errorf("unknown sync policy %q", name)
+}
+
+// Syncer is implemented by stores whose policy for flushing writes can be
+// chosen per write.
+type Syncer interface {
+	// ApplyDeltasSync applies deltas like ApplyDeltas, but flushes them
+	// to disk as the given policy says, rather than as the store is
+	// configured to.
+	ApplyDeltasSync(deltas []Delta, ignoreOpts IgnoreOpts, policy SyncPolicy) error
+}
+
+// SyncBatcher decides which writes a store flushes to disk under its
+// policy. It is safe for concurrent use.
+type SyncBatcher struct {
+	// Policy is the policy the store is configured with.
+	Policy SyncPolicy
+
+	// BatchSize is the number of deltas written between flushes under
+	// SyncBatch.
+	BatchSize int
+
+	mu       sync.Mutex
+	unsynced int
+}
+
+// NewSyncBatcher returns a SyncBatcher for the policy given by the "sync"
+// option, or def if it is not given, and the batch size given by the
+// "sync_batch_size" option, or DefaultSyncBatchSize.
+func NewSyncBatcher(opts Options, def SyncPolicy) (*SyncBatcher, error) {
+	b := &SyncBatcher{Policy: def, BatchSize: DefaultSyncBatchSize}
+	name, ok, err := opts.StringKey("sync")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		p, err := ParseSyncPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		if p != SyncDefault {
+			b.Policy = p
+		}
+	}
+	size, ok, err := opts.IntKey("sync_batch_size")
+	if err != nil {
+		return nil, err
+	} else if ok && size > 0 {
+		b.BatchSize = size
+	}
+	return b, nil
+}
+
+// Sync returns whether a write of n deltas under the given policy, or the
+// configured one for SyncDefault, should be flushed, and counts the deltas
+// towards the next flush if not. Flushing a write flushes those before it.
+func (b *SyncBatcher) Sync(policy SyncPolicy, n int) bool {
+	if policy == SyncDefault {
+		policy = b.Policy
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch policy {
+	case SyncAlways:
+		b.unsynced = 0
+		return true
+	case SyncBatch:
+		b.unsynced += n
+		if b.unsynced >= b.BatchSize {
+			b.unsynced = 0
+			return true
+		}
+		return false
+	default:
+		b.unsynced += n
+		return false
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "testing"
+
+func TestSyncBatcher(t *testing.T) {
+	b, err := NewSyncBatcher(Options{"sync": "batch", "sync_batch_size": 10.0}, SyncAlways)
+	if err != nil {
+		t.Fatalf("Could not create SyncBatcher: %v", err)
+	}
+	var got []bool
+	for _, w := range []struct {
+		policy SyncPolicy
+		n      int
+	}{
+		{SyncDefault, 4},
+		{SyncDefault, 4},
+		{SyncDefault, 4},
+		{SyncDefault, 4},
+		{SyncAlways, 1},
+		{SyncNever, 20},
+		{SyncDefault, 1},
+	} {
+		got = append(got, b.Sync(w.policy, w.n))
+	}
+	expect := []bool{false, false, true, false, true, false, true}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("Unexpected syncs, got:%v expect:%v", got, expect)
+			break
+		}
+	}
+
+	if _, err := NewSyncBatcher(Options{"sync": "sometimes"}, SyncAlways); err == nil {
+		t.Errorf("Expected an error for an unknown sync policy")
+	}
+	b, err = NewSyncBatcher(nil, SyncNever)
+	if err != nil {
+		t.Fatalf("Could not create default SyncBatcher: %v", err)
+	}
+	if b.Policy != SyncNever || b.BatchSize != DefaultSyncBatchSize {
+		t.Errorf("Unexpected defaults, got:%v,%d expect:%v,%d", b.Policy, b.BatchSize, SyncNever, DefaultSyncBatchSize)
+	}
+}
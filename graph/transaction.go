@@ -0,0 +1,64 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/google/cayley/quad"
+
+// Transaction is a set of quad additions and removals to be applied to a
+// QuadStore together, with QuadWriter.ApplyTransaction.
+//
+// A transaction holds at most one change per quad: adding a quad cancels an
+// earlier removal of it in the same transaction, and vice versa.
+type Transaction struct {
+	// Deltas are the changes to apply. Their IDs and timestamps are set by
+	// the QuadWriter when the transaction is applied.
+	Deltas []Delta
+
+	index map[quad.Quad]int
+}
+
+// NewTransaction returns an empty transaction.
+func NewTransaction() *Transaction {
+	return &Transaction{index: make(map[quad.Quad]int)}
+}
+
+func (t *Transaction) add(q quad.Quad, action Procedure) {
+	if i, ok := t.index[q]; ok {
+		if t.Deltas[i].Action == action {
+			return
+		}
+		// The changes cancel out.
+		last := len(t.Deltas) - 1
+		if i != last {
+			t.Deltas[i] = Delta{Quad: t.Deltas[last].Quad, Action: t.Deltas[last].Action}
+			t.index[t.Deltas[i].Quad] = i
+		}
+		t.Deltas = t.Deltas[:last]
+		delete(t.index, q)
+		return
+	}
+	t.index[q] = len(t.Deltas)
+	t.Deltas = append(t.Deltas, Delta{Quad: q, Action: action})
+}
+
+// AddQuad adds a quad to the transaction.
+func (t *Transaction) AddQuad(q quad.Quad) {
+	t.add(q, Add)
+}
+
+// RemoveQuad adds the removal of a quad to the transaction.
+func (t *Transaction) RemoveQuad(q quad.Quad) {
+	t.add(q, Delete)
+}
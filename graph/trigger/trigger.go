@@ -0,0 +1,248 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trigger runs actions when quads matching a pattern are written.
+//
+// Triggers watch the store, so they fire for every write it applies,
+// whichever writer made it, once the write has been committed. Each trigger
+// runs its action on the deltas it matches one at a time, in order, retrying
+// a failed action before moving on.
+//
+// An action that writes quads matching its own trigger's pattern fires it
+// again; patterns should be chosen to avoid loops.
+package trigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+var (
+	ErrNoWatch        = errors.New("trigger: quad store cannot be watched")
+	ErrTriggerExists  = errors.New("trigger: trigger exists")
+	ErrUnknownTrigger = errors.New("trigger: unknown trigger")
+)
+
+// Action is run for each delta matching a trigger. It may write through qw,
+// which writes to the watched store.
+type Action func(qw graph.QuadWriter, d *graph.Delta) error
+
+// Trigger runs an action on the deltas whose quads match a pattern.
+type Trigger struct {
+	Name string
+
+	// Pattern is matched against the quads written; its empty fields match
+	// any value.
+	Pattern quad.Quad
+
+	// On restricts the trigger to additions (graph.Add) or deletions
+	// (graph.Delete). Zero runs it on both.
+	On graph.Procedure
+
+	Action Action
+}
+
+// Options tunes how failed actions are retried. Zero fields take the
+// default values.
+type Options struct {
+	// Retries is how many times a failed action is retried before the delta
+	// is given up on. Defaults to 3; use a negative value for none.
+	Retries int
+
+	// Backoff is the wait before the first retry, doubled for each next
+	// one. Defaults to 100ms.
+	Backoff time.Duration
+}
+
+// Triggers runs the triggers registered on a store.
+type Triggers struct {
+	w    graph.Watcher
+	qw   graph.QuadWriter
+	opts Options
+
+	mu      sync.Mutex
+	running map[string]*running
+}
+
+type running struct {
+	c    <-chan graph.Delta
+	done chan struct{}
+}
+
+// New returns the triggers of qs, which qw writes to.
+func New(qs graph.QuadStore, qw graph.QuadWriter, opts Options) (*Triggers, error) {
+	w, ok := qs.(graph.Watcher)
+	if !ok {
+		return nil, ErrNoWatch
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	} else if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	return &Triggers{w: w, qw: qw, opts: opts, running: make(map[string]*running)}, nil
+}
+
+// Register starts running a trigger on the writes that follow.
+func (t *Triggers) Register(tr Trigger) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.running[tr.Name]; ok {
+		return ErrTriggerExists
+	}
+	r := &running{c: t.w.Subscribe(tr.Pattern), done: make(chan struct{})}
+	t.running[tr.Name] = r
+	go t.run(tr, r)
+	return nil
+}
+
+// Unregister stops a trigger. Deltas it has not run on yet are dropped.
+func (t *Triggers) Unregister(name string) error {
+	t.mu.Lock()
+	r, ok := t.running[name]
+	delete(t.running, name)
+	t.mu.Unlock()
+	if !ok {
+		return ErrUnknownTrigger
+	}
+	t.w.Unsubscribe(r.c)
+	<-r.done
+	return nil
+}
+
+// Close stops every trigger.
+func (t *Triggers) Close() {
+	t.mu.Lock()
+	var names []string
+	for name := range t.running {
+		names = append(names, name)
+	}
+	t.mu.Unlock()
+	for _, name := range names {
+		t.Unregister(name)
+	}
+}
+
+func (t *Triggers) run(tr Trigger, r *running) {
+	defer close(r.done)
+	for d := range r.c {
+		if tr.On != 0 && d.Action != tr.On {
+			continue
+		}
+		backoff := t.opts.Backoff
+		for try := 0; ; try++ {
+			err := tr.Action(t.qw, &d)
+			if err == nil {
+				break
+			}
+			if try == t.opts.Retries {
+				clog.Errorf("trigger %q: giving up on %v: %v", tr.Name, d.Quad, err)
+				break
+			}
+			clog.Warningf("trigger %q: retrying %v: %v", tr.Name, d.Quad, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// Fill returns the template with "$subject", "$predicate", "$object" and
+// "$label" in its fields replaced with those of q.
+func Fill(template, q quad.Quad) quad.Quad {
+	r := strings.NewReplacer(
+		"$subject", q.Subject,
+		"$predicate", q.Predicate,
+		"$object", q.Object,
+		"$label", q.Label,
+	)
+	return quad.Quad{
+		Subject:   r.Replace(template.Subject),
+		Predicate: r.Replace(template.Predicate),
+		Object:    r.Replace(template.Object),
+		Label:     r.Replace(template.Label),
+	}
+}
+
+// Derive returns an action adding the quad made by filling the template
+// with the written quad. A derived quad that already exists is not an
+// error.
+func Derive(template quad.Quad) Action {
+	return func(qw graph.QuadWriter, d *graph.Delta) error {
+		err := qw.AddQuad(Fill(template, d.Quad))
+		if err == graph.ErrQuadExists {
+			return nil
+		}
+		return err
+	}
+}
+
+// Tag returns an action tagging the subject of the written quad, by adding
+// a quad linking it to value through predicate.
+func Tag(predicate, value string) Action {
+	return Derive(quad.Quad{Subject: "$subject", Predicate: predicate, Object: value})
+}
+
+// WebhookTimeout is how long a webhook may take to answer.
+const WebhookTimeout = 10 * time.Second
+
+// WebhookEvent is the JSON body posted by a webhook.
+type WebhookEvent struct {
+	Trigger   string    `json:"trigger"`
+	Action    string    `json:"action"`
+	Quad      quad.Quad `json:"quad"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Webhook returns an action posting a WebhookEvent for the delta to url. An
+// answer other than 2xx is an error, and so is retried.
+func Webhook(name, url string) Action {
+	client := &http.Client{Timeout: WebhookTimeout}
+	return func(_ graph.QuadWriter, d *graph.Delta) error {
+		action := "add"
+		if d.Action == graph.Delete {
+			action = "delete"
+		}
+		body, err := json.Marshal(WebhookEvent{
+			Trigger:   name,
+			Action:    action,
+			Quad:      d.Quad,
+			Timestamp: d.Timestamp,
+		})
+		if err != nil {
+			return err
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		return nil
+	}
+}
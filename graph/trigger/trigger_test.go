@@ -0,0 +1,141 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trigger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// lockedWriter keeps the test from reading the memstore while triggers
+// write to it.
+type lockedWriter struct {
+	graph.QuadWriter
+	sync.Mutex
+}
+
+func (w *lockedWriter) AddQuad(q quad.Quad) error {
+	w.Lock()
+	defer w.Unlock()
+	return w.QuadWriter.AddQuad(q)
+}
+
+func (w *lockedWriter) RemoveQuad(q quad.Quad) error {
+	w.Lock()
+	defer w.Unlock()
+	return w.QuadWriter.RemoveQuad(q)
+}
+
+func (w *lockedWriter) has(qs graph.QuadStore, q quad.Quad) bool {
+	w.Lock()
+	defer w.Unlock()
+	quads, err := graph.MatchingQuads(qs, q)
+	return err == nil && len(quads) != 0
+}
+
+func TestTriggers(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	single, _ := graph.NewQuadWriter("single", qs, nil)
+	qw := &lockedWriter{QuadWriter: single}
+
+	var (
+		mu     sync.Mutex
+		events []WebhookEvent
+		calls  int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			http.Error(w, "not yet", 503)
+			return
+		}
+		var e WebhookEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		events = append(events, e)
+	}))
+	defer server.Close()
+
+	tr, err := New(qs, qw, Options{Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Could not create triggers: %v", err)
+	}
+	defer tr.Close()
+	for _, trig := range []Trigger{
+		{Name: "tag", Pattern: quad.Quad{Predicate: "follows"}, On: graph.Add, Action: Tag("status", "social")},
+		{Name: "derive", Pattern: quad.Quad{Predicate: "follows"}, On: graph.Add,
+			Action: Derive(quad.Quad{Subject: "$object", Predicate: "followed_by", Object: "$subject"})},
+		{Name: "hook", Pattern: quad.Quad{Predicate: "follows"}, Action: Webhook("hook", server.URL)},
+	} {
+		if err := tr.Register(trig); err != nil {
+			t.Fatalf("Could not register trigger %q: %v", trig.Name, err)
+		}
+	}
+	if err := tr.Register(Trigger{Name: "tag"}); err != ErrTriggerExists {
+		t.Errorf("Unexpected error registering a trigger twice: %v", err)
+	}
+
+	qw.AddQuad(quad.Quad{Subject: "alice", Predicate: "follows", Object: "bob"})
+	qw.AddQuad(quad.Quad{Subject: "alice", Predicate: "status", Object: "cool"})
+	qw.RemoveQuad(quad.Quad{Subject: "alice", Predicate: "follows", Object: "bob"})
+
+	waitFor(t, "tag", func() bool {
+		return qw.has(qs, quad.Quad{Subject: "alice", Predicate: "status", Object: "social"})
+	})
+	waitFor(t, "derived quad", func() bool {
+		return qw.has(qs, quad.Quad{Subject: "bob", Predicate: "followed_by", Object: "alice"})
+	})
+	waitFor(t, "webhook", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 2
+	})
+	mu.Lock()
+	if calls != 3 {
+		t.Errorf("Unexpected number of webhook calls, got:%d expect:3", calls)
+	}
+	if events[0].Action != "add" || events[1].Action != "delete" || events[0].Quad.Object != "bob" {
+		t.Errorf("Unexpected webhook events: %+v", events)
+	}
+	mu.Unlock()
+
+	if err := tr.Unregister("tag"); err != nil {
+		t.Errorf("Could not unregister trigger: %v", err)
+	}
+	if err := tr.Unregister("tag"); err != ErrUnknownTrigger {
+		t.Errorf("Unexpected error unregistering a trigger twice: %v", err)
+	}
+}
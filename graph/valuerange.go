@@ -0,0 +1,73 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Defines the helpers QuadStores use to keep the sorted indexes of
+// ValueRangeIndexer.
+
+import (
+	"github.com/google/cayley/quad"
+)
+
+func hasSortKey(name string) bool {
+	kind, _ := quad.SortKey(name)
+	return kind != quad.NoValue
+}
+
+// ValueChanges is like ObjectChanges, for the objects that hold numbers or
+// times: it returns those a store should add to its range indexes once the
+// deltas have been applied, and those it should remove.
+func ValueChanges(qs QuadStore, deltas []Delta) (added, removed []string) {
+	return objectChanges(qs, deltas, hasSortKey)
+}
+
+// ValueObjects calls fn with each number or time qs has as the object of a
+// quad, at least once, for stores to build their range indexes.
+func ValueObjects(qs QuadStore, fn func(name string, kind quad.ValueKind, key uint64) error) error {
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for Next(it) {
+		name := qs.Quad(it.Result()).Object
+		if kind, key := quad.SortKey(name); kind != quad.NoValue {
+			if err := fn(name, kind, key); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Err()
+}
+
+// ValueRangeIterator returns an iterator over the nodes of qs holding values
+// within the range, from the range indexes of qs if it keeps them.
+func ValueRangeIterator(qs QuadStore, r quad.ValueRange) Iterator {
+	if ri, ok := qs.(ValueRangeIndexer); ok {
+		return ri.ValueRangeIterator(r)
+	}
+	return ScanValueRange(qs, r)
+}
+
+// ScanValueRange is ValueRangeIterator for stores without range indexes: it
+// reads the names of all of their nodes.
+func ScanValueRange(qs QuadStore, r quad.ValueRange) Iterator {
+	all := qs.NodesAllIterator()
+	defer all.Close()
+	fixed := qs.FixedIterator()
+	for Next(all) {
+		if r.Contains(quad.SortKey(qs.NameOf(all.Result()))) {
+			fixed.Add(all.Result())
+		}
+	}
+	return fixed
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "errors"
+
+// ErrNoVerify is returned when verifying a store that cannot check its own
+// indexes.
+var ErrNoVerify = errors.New("quad store does not support verification")
+
+// VerifyReport describes what a verification pass found.
+type VerifyReport struct {
+	// Quads is the number of primary quad records checked.
+	Quads int64
+
+	// Problems describes each inconsistency found, one per entry.
+	Problems []string
+
+	// Repaired is the number of problems that were fixed.
+	Repaired int
+}
+
+// OK returns whether no problems were found.
+func (r VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify cross-checks the indexes and node values of qs against its primary
+// quad records, rebuilding the damaged ones if repair is set, or returns
+// ErrNoVerify if qs is not a Verifier.
+//
+// The writer should be paused while a store is verified, as concurrent
+// writes may be reported as inconsistencies, or be undone by a repair.
+func Verify(qs QuadStore, repair bool) (VerifyReport, error) {
+	v, ok := qs.(Verifier)
+	if !ok {
+		return VerifyReport{}, ErrNoVerify
+	}
+	return v.Verify(repair)
+}
+
+// Verify cross-checks the indexes and node values of the handle's store.
+func (h *Handle) Verify(repair bool) (VerifyReport, error) {
+	return Verify(h.QuadStore, repair)
+}
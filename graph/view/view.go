@@ -0,0 +1,248 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package view materializes the results of named paths into the store, and
+// keeps them up to date as quads are written, so that a recurring traversal
+// becomes a lookup.
+//
+// The nodes a view holds are written to a label of their own:
+//
+//  node view:member name view:name
+//
+// so that StartPath(qs, name).In(view.MemberPredicate) lists them too.
+package view
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/quad"
+)
+
+// MemberPredicate links the nodes of a view to its name.
+const MemberPredicate = "view:member"
+
+var (
+	ErrUnknownView = errors.New("view: unknown view")
+	ErrViewExists  = errors.New("view: view exists")
+)
+
+// Label returns the label the nodes of the named view are written to.
+func Label(name string) string {
+	return "view:" + name
+}
+
+// Members returns the nodes of the named view, as last materialized.
+func Members(qs graph.QuadStore, name string) ([]string, error) {
+	quads, err := graph.MatchingQuads(qs, quad.Quad{Predicate: MemberPredicate, Object: name, Label: Label(name)})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(quads))
+	for _, q := range quads {
+		out = append(out, q.Subject)
+	}
+	return out, nil
+}
+
+// Contains returns whether node is in the named view, as last materialized.
+func Contains(qs graph.QuadStore, name, node string) bool {
+	quads, err := graph.MatchingQuads(qs, quad.Quad{Subject: node, Predicate: MemberPredicate, Object: name, Label: Label(name)})
+	return err == nil && len(quads) != 0
+}
+
+type view struct {
+	path       *path.Path
+	predicates map[string]bool
+}
+
+// dependsOn returns whether a delta with the given predicate may change the
+// view. An empty predicate stands for any.
+func (v *view) dependsOn(predicate string) bool {
+	return len(v.predicates) == 0 || predicate == "" || v.predicates[predicate]
+}
+
+// Writer is a QuadWriter that refreshes the views a write may change once it
+// has succeeded.
+type Writer struct {
+	graph.QuadWriter
+	qs graph.QuadStore
+
+	mu    sync.Mutex
+	views map[string]*view
+}
+
+// NewWriter wraps qw, which writes to qs.
+func NewWriter(qs graph.QuadStore, qw graph.QuadWriter) *Writer {
+	return &Writer{QuadWriter: qw, qs: qs, views: make(map[string]*view)}
+}
+
+// Register adds a view holding the results of p, which must be a path on
+// the store, and materializes it.
+//
+// The view is refreshed after writes of quads with one of the given
+// predicates, which should be all those p traverses, or after every write
+// if none are given.
+func (w *Writer) Register(name string, p *path.Path, predicates ...string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.views[name]; ok {
+		return ErrViewExists
+	}
+	v := &view{path: p}
+	if len(predicates) != 0 {
+		v.predicates = make(map[string]bool)
+		for _, pred := range predicates {
+			v.predicates[pred] = true
+		}
+	}
+	if _, _, err := w.refresh(name, v); err != nil {
+		return err
+	}
+	w.views[name] = v
+	return nil
+}
+
+// Unregister stops maintaining the named view, and removes its nodes from
+// the store.
+func (w *Writer) Unregister(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.views[name]; !ok {
+		return ErrUnknownView
+	}
+	delete(w.views, name)
+	_, err := w.QuadWriter.DeleteQuadsMatching(quad.Quad{Predicate: MemberPredicate, Object: name, Label: Label(name)})
+	return err
+}
+
+// Refresh brings the named view up to date, and returns how many nodes
+// entered and left it.
+func (w *Writer) Refresh(name string) (added, removed int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	v, ok := w.views[name]
+	if !ok {
+		return 0, 0, ErrUnknownView
+	}
+	return w.refresh(name, v)
+}
+
+func (w *Writer) refresh(name string, v *view) (added, removed int, err error) {
+	current := make(map[quad.Quad]bool)
+	have, err := graph.MatchingQuads(w.qs, quad.Quad{Predicate: MemberPredicate, Object: name, Label: Label(name)})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, q := range have {
+		current[q] = true
+	}
+	tx := graph.NewTransaction()
+	it := v.path.BuildIterator()
+	defer it.Close()
+	it, _ = it.Optimize()
+	seen := make(map[string]bool)
+	for graph.Next(it) {
+		node := w.qs.NameOf(it.Result())
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		q := quad.Quad{Subject: node, Predicate: MemberPredicate, Object: name, Label: Label(name)}
+		if current[q] {
+			delete(current, q)
+			continue
+		}
+		tx.AddQuad(q)
+		added++
+	}
+	if err = it.Err(); err != nil {
+		return 0, 0, err
+	}
+	for q := range current {
+		tx.RemoveQuad(q)
+		removed++
+	}
+	if len(tx.Deltas) == 0 {
+		return 0, 0, nil
+	}
+	err = w.QuadWriter.ApplyTransaction(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return added, removed, nil
+}
+
+// refreshAfter refreshes the views depending on any of the predicates once a
+// write has succeeded.
+func (w *Writer) refreshAfter(err error, predicates ...string) error {
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for name, v := range w.views {
+		for _, p := range predicates {
+			if v.dependsOn(p) {
+				if _, _, err := w.refresh(name, v); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (w *Writer) AddQuad(q quad.Quad) error {
+	return w.refreshAfter(w.QuadWriter.AddQuad(q), q.Predicate)
+}
+
+func (w *Writer) AddQuadSet(set []quad.Quad) error {
+	return w.refreshAfter(w.QuadWriter.AddQuadSet(set), predicatesOf(set)...)
+}
+
+func (w *Writer) RemoveQuad(q quad.Quad) error {
+	return w.refreshAfter(w.QuadWriter.RemoveQuad(q), q.Predicate)
+}
+
+func (w *Writer) ApplyTransaction(t *graph.Transaction) error {
+	set := make([]quad.Quad, len(t.Deltas))
+	for i := range t.Deltas {
+		set[i] = t.Deltas[i].Quad
+	}
+	return w.refreshAfter(w.QuadWriter.ApplyTransaction(t), predicatesOf(set)...)
+}
+
+func (w *Writer) DeleteQuadsMatching(pattern quad.Quad) (int, error) {
+	n, err := w.QuadWriter.DeleteQuadsMatching(pattern)
+	if n == 0 {
+		return n, err
+	}
+	return n, w.refreshAfter(err, pattern.Predicate)
+}
+
+func predicatesOf(set []quad.Quad) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, q := range set {
+		if !seen[q.Predicate] {
+			seen[q.Predicate] = true
+			out = append(out, q.Predicate)
+		}
+	}
+	return out
+}
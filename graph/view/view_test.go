@@ -0,0 +1,94 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+func members(t *testing.T, qs graph.QuadStore, name string) []string {
+	out, err := Members(qs, name)
+	if err != nil {
+		t.Fatalf("Could not read view %q: %v", name, err)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestViews(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, _ := graph.NewQuadWriter("single", qs, nil)
+	qw.AddQuadSet([]quad.Quad{
+		{Subject: "alice", Predicate: "follows", Object: "bob"},
+		{Subject: "bob", Predicate: "follows", Object: "carol"},
+		{Subject: "bob", Predicate: "status", Object: "cool"},
+	})
+	w := NewWriter(qs, qw)
+
+	// Friends of friends of alice.
+	fof := path.StartPath(qs, "alice").Out("follows").Out("follows")
+	if err := w.Register("fof", fof, "follows"); err != nil {
+		t.Fatalf("Could not register view: %v", err)
+	}
+	if err := w.Register("fof", fof); err != ErrViewExists {
+		t.Errorf("Unexpected error registering a view twice: %v", err)
+	}
+	if got, expect := members(t, qs, "fof"), []string{"carol"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected view, got:%v expect:%v", got, expect)
+	}
+
+	w.AddQuad(quad.Quad{Subject: "bob", Predicate: "follows", Object: "dave"})
+	w.RemoveQuad(quad.Quad{Subject: "bob", Predicate: "follows", Object: "carol"})
+	if got, expect := members(t, qs, "fof"), []string{"dave"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected view after writes, got:%v expect:%v", got, expect)
+	}
+	if !Contains(qs, "fof", "dave") || Contains(qs, "fof", "carol") {
+		t.Error("Unexpected view membership")
+	}
+	got := path.StartPath(qs, "fof").In(MemberPredicate).BuildIterator()
+	if !graph.Next(got) || qs.NameOf(got.Result()) != "dave" {
+		t.Error("Could not traverse to the nodes of the view")
+	}
+
+	// Writes to other predicates, and through the inner writer, leave the
+	// view alone.
+	qw.AddQuad(quad.Quad{Subject: "bob", Predicate: "follows", Object: "erin"})
+	w.AddQuad(quad.Quad{Subject: "alice", Predicate: "status", Object: "cool"})
+	if got, expect := members(t, qs, "fof"), []string{"dave"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected view after unrelated write, got:%v expect:%v", got, expect)
+	}
+	if added, removed, err := w.Refresh("fof"); err != nil || added != 1 || removed != 0 {
+		t.Errorf("Unexpected refresh, got:%d, %d, %v expect:1, 0", added, removed, err)
+	}
+
+	if err := w.Unregister("fof"); err != nil {
+		t.Errorf("Could not unregister view: %v", err)
+	}
+	if got := members(t, qs, "fof"); len(got) != 0 {
+		t.Errorf("Unexpected nodes of an unregistered view: %v", got)
+	}
+	if _, _, err := w.Refresh("fof"); err != ErrUnknownView {
+		t.Errorf("Unexpected error refreshing an unknown view: %v", err)
+	}
+}
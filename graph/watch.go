@@ -0,0 +1,168 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Defines Notifier, the subscription list QuadStores use to implement
+// Watcher.
+
+import (
+	"sync"
+
+	"github.com/google/cayley/quad"
+)
+
+// Notifier keeps the subscriptions of a Watcher and delivers applied deltas
+// to them. The zero value is ready to use.
+//
+// Each subscription has its own unbounded queue, so a slow reader never
+// holds up the writes being reported; deltas are delivered to it in the
+// order they were applied.
+type Notifier struct {
+	mu     sync.Mutex
+	subs   map[<-chan Delta]*subscription
+	closed bool
+}
+
+type subscription struct {
+	pattern quad.Quad
+	out     chan Delta
+
+	mu    sync.Mutex
+	queue []*Delta
+	wake  chan struct{}
+	stop  chan struct{}
+}
+
+// Subscribe returns a channel on which every delta passed to Notify whose
+// quad matches pattern is sent.
+func (n *Notifier) Subscribe(pattern quad.Quad) <-chan Delta {
+	s := &subscription{
+		pattern: pattern,
+		out:     make(chan Delta),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		close(s.out)
+		return s.out
+	}
+	if n.subs == nil {
+		n.subs = make(map[<-chan Delta]*subscription)
+	}
+	n.subs[s.out] = s
+	go s.run()
+	return s.out
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes
+// it. Deltas not yet received are dropped.
+func (n *Notifier) Unsubscribe(c <-chan Delta) {
+	n.mu.Lock()
+	s, ok := n.subs[c]
+	delete(n.subs, c)
+	n.mu.Unlock()
+	if ok {
+		close(s.stop)
+	}
+}
+
+// Notify queues the deltas for every subscription they match. It should be
+// called once the deltas have been applied successfully.
+func (n *Notifier) Notify(deltas []Delta) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, s := range n.subs {
+		var matched []*Delta
+		for i := range deltas {
+			if Matches(s.pattern, deltas[i].Quad) {
+				matched = append(matched, copyDelta(&deltas[i]))
+			}
+		}
+		if len(matched) > 0 {
+			s.push(matched)
+		}
+	}
+}
+
+// Close unsubscribes every subscription. Later subscriptions are closed
+// immediately.
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	subs := n.subs
+	n.subs = nil
+	n.closed = true
+	n.mu.Unlock()
+	for _, s := range subs {
+		close(s.stop)
+	}
+}
+
+func (s *subscription) push(deltas []*Delta) {
+	s.mu.Lock()
+	s.queue = append(s.queue, deltas...)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.stop:
+				return
+			}
+		}
+		d := s.queue[0]
+		s.mu.Unlock()
+		select {
+		case s.out <- *d:
+		case <-s.stop:
+			return
+		}
+		s.mu.Lock()
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+	}
+}
+
+// copyDelta returns a copy of d that is safe to hand to another goroutine.
+func copyDelta(d *Delta) *Delta {
+	d.ID.mut.Lock()
+	defer d.ID.mut.Unlock()
+	return &Delta{
+		ID: PrimaryKey{
+			keyType:      d.ID.keyType,
+			sequentialID: d.ID.sequentialID,
+			uniqueID:     d.ID.uniqueID,
+		},
+		Quad:      d.Quad,
+		Action:    d.Action,
+		Timestamp: d.Timestamp,
+		Expires:   d.Expires,
+		Author:    d.Author,
+		Source:    d.Source,
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cayley/quad"
+)
+
+func TestNotifier(t *testing.T) {
+	var n Notifier
+	all := n.Subscribe(quad.Quad{})
+	alice := n.Subscribe(quad.Quad{Subject: "alice"})
+
+	deltas := []Delta{
+		{ID: NewSequentialKey(1), Quad: quad.Quad{"alice", "follows", "bob", ""}, Action: Add, Author: "carol", Source: "people.nq"},
+		{ID: NewSequentialKey(2), Quad: quad.Quad{"bob", "follows", "alice", ""}, Action: Add},
+		{ID: NewSequentialKey(3), Quad: quad.Quad{"alice", "follows", "bob", ""}, Action: Delete},
+	}
+	// Nothing reads the subscriptions yet; Notify must not block.
+	n.Notify(deltas)
+
+	for _, test := range []struct {
+		c      <-chan Delta
+		expect []int64
+	}{
+		{all, []int64{1, 2, 3}},
+		{alice, []int64{1, 3}},
+	} {
+		for _, id := range test.expect {
+			select {
+			case d := <-test.c:
+				if got := d.ID.Int(); got != id {
+					t.Errorf("Unexpected delta, got:%d expect:%d", got, id)
+				}
+				expect := &deltas[id-1]
+				if d.Author != expect.Author || d.Source != expect.Source {
+					t.Errorf("Unexpected provenance of delta %d, got:%q,%q expect:%q,%q", id, d.Author, d.Source, expect.Author, expect.Source)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for delta %d", id)
+			}
+		}
+	}
+
+	n.Unsubscribe(alice)
+	if _, ok := <-alice; ok {
+		t.Errorf("Unexpected delta after unsubscribing")
+	}
+	n.Close()
+	if _, ok := <-all; ok {
+		t.Errorf("Unexpected delta after closing")
+	}
+	if _, ok := <-n.Subscribe(quad.Quad{}); ok {
+		t.Errorf("Unexpected delta from a closed notifier")
+	}
+}
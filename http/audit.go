@@ -0,0 +1,79 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/writer"
+)
+
+// DefaultAuditLimit is the number of audit log entries served at once,
+// unless fewer are asked for.
+const DefaultAuditLimit = 100
+
+// ServeV1Audit serves the entries of the audit log selected by the "since"
+// and "until" times, in RFC 3339 format, and the "user" and "request_id"
+// query parameters, oldest first. It is only available when the writer keeps
+// an audit log.
+func (api *API) ServeV1Audit(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	path, ok, err := graph.Options(api.conf().ReplicationOptions).StringKey("audit_path")
+	if err != nil || !ok || path == "" {
+		return jsonResponse(w, 404, "Database does not keep an audit log.")
+	}
+	query := r.URL.Query()
+	f := writer.AuditFilter{
+		User:      query.Get("user"),
+		RequestID: query.Get("request_id"),
+		Limit:     DefaultAuditLimit,
+	}
+	for _, bound := range []struct {
+		param string
+		t     *time.Time
+	}{
+		{"since", &f.Since},
+		{"until", &f.Until},
+	} {
+		if s := query.Get(bound.param); s != "" {
+			*bound.t, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				return jsonResponse(w, 400, "Invalid "+bound.param+" time.")
+			}
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		f.Limit, err = strconv.Atoi(s)
+		if err != nil || f.Limit <= 0 {
+			return jsonResponse(w, 400, "Invalid limit.")
+		}
+	}
+
+	entries, err := writer.ReadAuditFile(path, f)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	bytes, err := json.Marshal(map[string]interface{}{"entries": entries})
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Write(bytes)
+	return 200
+}
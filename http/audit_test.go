@@ -0,0 +1,101 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/writer"
+
+	_ "github.com/google/cayley/graph/memstore"
+)
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_audit")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := map[string]interface{}{"audit_path": filepath.Join(dir, "audit")}
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, opts)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer qw.Close()
+	api := &API{
+		config: &config.Config{ReplicationType: "single", ReplicationOptions: opts},
+		handle: &graph.Handle{QuadStore: qs, QuadWriter: qw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, id := range []string{"req-1", ""} {
+		req, _ := http.NewRequest("POST", server.URL+"/api/v1/write", strings.NewReader(`[{"subject":"A","predicate":"follows","object":"B"}]`))
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not write: %v", err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Request-ID"); got == "" || (id != "" && got != id) {
+			t.Errorf("Unexpected request ID, got:%q expect:%q", got, id)
+		}
+	}
+
+	getAudit := func(query string) []writer.AuditEntry {
+		resp, err := http.Get(server.URL + "/api/v1/admin/audit?" + query)
+		if err != nil {
+			t.Fatalf("Could not get audit log: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("Unexpected status getting audit log: %d", resp.StatusCode)
+		}
+		var out struct {
+			Entries []writer.AuditEntry `json:"entries"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("Could not decode audit log: %v", err)
+		}
+		return out.Entries
+	}
+	if entries := getAudit(""); len(entries) != 2 || entries[0].Error != "" || entries[1].Error == "" {
+		t.Errorf("Unexpected audit log: %+v", entries)
+	}
+	entries := getAudit("request_id=req-1")
+	if len(entries) != 1 || entries[0].User == "" || len(entries[0].Deltas) != 1 || entries[0].Deltas[0].Quad.Object != "B" {
+		t.Errorf("Unexpected audit entries for request: %+v", entries)
+	}
+	if entries := getAudit("limit=1&until=2000-01-01T00:00:00Z"); len(entries) != 0 {
+		t.Errorf("Unexpected audit entries before 2000: %+v", entries)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+)
+
+func TestRoles(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer qw.Close()
+	api := NewAPI(&graph.Handle{QuadStore: qs, QuadWriter: qw}, &config.Config{
+		ReplicationType: "single",
+		Timeout:         -1,
+		Credentials: []config.Credential{
+			{Token: "reader", Role: "read"},
+			{Token: "writer", Role: "write"},
+		},
+	})
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	post := func(path, token, body string) int {
+		req, _ := http.NewRequest("POST", server.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not post to %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	const write = `[{"subject":"A","predicate":"follows","object":"B"}]`
+	for _, test := range []struct {
+		path, token string
+		expect      int
+	}{
+		{"/api/v1/write", "", 401},
+		{"/api/v1/write", "unknown", 401},
+		{"/api/v1/write", "reader", 403},
+		{"/api/v1/admin/reload", "writer", 403},
+		{"/api/v1/write", "writer", 200},
+	} {
+		if code := post(test.path, test.token, write); code != test.expect {
+			t.Errorf("Unexpected status of %s with token %q, got:%d expect:%d", test.path, test.token, code, test.expect)
+		}
+	}
+
+	// Queries of the read role cannot write, even from the script.
+	const script = `g.Transaction().Add("B", "follows", "C").Commit()`
+	post("/api/v1/query/gremlin", "reader", script)
+	if n := qs.Size(); n != 1 {
+		t.Errorf("Unexpected size after writing query of the read role, got:%d expect:1", n)
+	}
+	if code := post("/api/v1/query/gremlin", "writer", script); code != 200 {
+		t.Errorf("Unexpected status of writing query of the write role, got:%d expect:200", code)
+	}
+	if n := qs.Size(); n != 2 {
+		t.Errorf("Unexpected size after writing query of the write role, got:%d expect:2", n)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/db"
+	"github.com/google/cayley/graph"
+)
+
+func (api *API) ServeV1Backup(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	if !graph.Capabilities(h.QuadStore).Has(graph.CanRevision) {
+		return jsonResponse(w, 501, graph.ErrNoRevisions)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	horizon, n, err := db.Backup(h.QuadStore, w)
+	if err != nil {
+		// The response has already started.
+		clog.Errorf("Backup at horizon %d failed after %d quads: %v", horizon, n, err)
+		return 500
+	}
+	return 200
+}
+
+func (api *API) ServeV1Restore(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	err = db.Restore(h, api.conf(), r.Body)
+	if err == db.ErrNotEmpty {
+		return jsonResponse(w, 409, err)
+	} else if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully restored %d quads.\"}", h.QuadStore.Size())
+	return 200
+}
@@ -0,0 +1,259 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/memory"
+	"github.com/google/cayley/query"
+)
+
+// runningQuery is a query being run by ServeV1Query.
+type runningQuery struct {
+	ID        int64     `json:"id"`
+	RequestID string    `json:"request_id"`
+	Lang      string    `json:"lang"`
+	Query     string    `json:"query"`
+	Started   time.Time `json:"started"`
+
+	ses query.HTTP
+}
+
+type runningQueries struct {
+	sync.Mutex
+	last    int64
+	running map[int64]*runningQuery
+}
+
+// add records a query as running, until the returned function is called.
+func (q *runningQueries) add(rq *runningQuery) func() {
+	q.Lock()
+	defer q.Unlock()
+	if q.running == nil {
+		q.running = make(map[int64]*runningQuery)
+	}
+	q.last++
+	rq.ID = q.last
+	q.running[rq.ID] = rq
+	return func() {
+		q.Lock()
+		delete(q.running, rq.ID)
+		q.Unlock()
+	}
+}
+
+func (q *runningQueries) list() []*runningQuery {
+	q.Lock()
+	defer q.Unlock()
+	list := make([]*runningQuery, 0, len(q.running))
+	for _, rq := range q.running {
+		list = append(list, rq)
+	}
+	sort.Sort(byID(list))
+	return list
+}
+
+// cancel cancels the running query of the given ID. It returns whether the
+// query runs, and whether it could be cancelled.
+func (q *runningQueries) cancel(id int64) (found, ok bool) {
+	q.Lock()
+	rq, found := q.running[id]
+	q.Unlock()
+	if !found {
+		return false, false
+	}
+	c, ok := rq.ses.(query.Canceller)
+	if ok {
+		c.Cancel()
+	}
+	return true, ok
+}
+
+type byID []*runningQuery
+
+func (l byID) Len() int           { return len(l) }
+func (l byID) Less(i, j int) bool { return l[i].ID < l[j].ID }
+func (l byID) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// debugAllowed returns whether a request may use the debug endpoints: if a
+// debug token is configured, it must be given as a bearer token, and
+// otherwise the request must come from the loopback interface.
+func (api *API) debugAllowed(r *http.Request) bool {
+	if token := api.conf().DebugToken; token != "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return false
+		}
+		given := strings.TrimPrefix(auth, "Bearer ")
+		return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (api *API) debugAuth(handler ResponseHandler) ResponseHandler {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+		if !api.debugAllowed(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cayley"`)
+			return jsonResponse(w, 401, "Unauthorized.")
+		}
+		return handler(w, r, params)
+	}
+}
+
+// Debug adds the debugging endpoints under /debug to r, if they are enabled
+// by the configuration.
+func (api *API) Debug(r *httprouter.Router) {
+	if !api.conf().DebugEndpoints {
+		return
+	}
+	r.GET("/debug/pprof/", LogRequest(api.debugAuth(api.ServeDebugProfiles)))
+	r.GET("/debug/pprof/:profile", LogRequest(api.debugAuth(api.ServeDebugProfile)))
+	r.GET("/debug/vars", LogRequest(api.debugAuth(api.ServeDebugVars)))
+	r.GET("/debug/queries", LogRequest(api.debugAuth(api.ServeDebugQueries)))
+}
+
+// ServeDebugProfiles lists the runtime profiles.
+func (api *API) ServeDebugProfiles(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "profile: CPU profile, for ?seconds=30")
+	for _, p := range pprof.Profiles() {
+		fmt.Fprintf(w, "%s: %d\n", p.Name(), p.Count())
+	}
+	return 200
+}
+
+// ServeDebugProfile serves a runtime profile in the format of go tool pprof,
+// or as text if the debug parameter is positive. The "profile" profile
+// records the CPU for the given number of seconds.
+func (api *API) ServeDebugProfile(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	name := params.ByName("profile")
+	if name == "profile" {
+		sec, _ := strconv.Atoi(r.FormValue("seconds"))
+		if sec <= 0 {
+			sec = 30
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return jsonResponse(w, 500, err)
+		}
+		time.Sleep(time.Duration(sec) * time.Second)
+		pprof.StopCPUProfile()
+		return 200
+	}
+	p := pprof.Lookup(name)
+	if p == nil {
+		return jsonResponse(w, 404, fmt.Sprintf("Unknown profile %q.", name))
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	p.WriteTo(w, debug)
+	return 200
+}
+
+// ServeDebugVars serves the state of the process and of the database as JSON.
+func (api *API) ServeDebugVars(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	vars := map[string]interface{}{
+		"cmdline":         os.Args,
+		"goroutines":      runtime.NumGoroutine(),
+		"memstats":        mem,
+		"quads":           api.handle.QuadStore.Size(),
+		"running_queries": len(api.queries.list()),
+		"query_memory":    memory.Used(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vars)
+	return 200
+}
+
+// ServeDebugQueries lists the queries being run, with how long they have run
+// and the trees of the iterators they have run so far.
+func (api *API) ServeDebugQueries(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	w.Header().Set("Content-Type", "application/json")
+	api.WriteQueries(w)
+	return 200
+}
+
+// ServeV1Queries lists the queries being run, like ServeDebugQueries.
+func (api *API) ServeV1Queries(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	w.Header().Set("Content-Type", "application/json")
+	api.WriteQueries(w)
+	return 200
+}
+
+// ServeV1CancelQuery cancels the running query of the given ID.
+func (api *API) ServeV1CancelQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		return jsonResponse(w, 400, "Invalid query ID.")
+	}
+	found, ok := api.queries.cancel(id)
+	if !found {
+		return jsonResponse(w, 404, "No such query.")
+	}
+	if !ok {
+		return jsonResponse(w, 400, "Query language cannot cancel queries.")
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully cancelled query %d.\"}", id)
+	return 200
+}
+
+// WriteQueries writes the queries being run to w as JSON, as they are served
+// at /debug/queries. The trees of their iterators are only kept if the debug
+// endpoints are enabled.
+func (api *API) WriteQueries(w io.Writer) error {
+	type described struct {
+		*runningQuery
+		Elapsed   string              `json:"elapsed"`
+		Iterators []graph.Description `json:"iterators,omitempty"`
+	}
+	out := struct {
+		Queries []described `json:"queries"`
+	}{Queries: []described{}}
+	for _, rq := range api.queries.list() {
+		d := described{runningQuery: rq, Elapsed: time.Since(rq.Started).String()}
+		if ex, ok := rq.ses.(query.Explainer); ok {
+			d.Iterators = ex.Iterators()
+		}
+		out.Queries = append(out.Queries, d)
+	}
+	return json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,170 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query/gremlin"
+	"github.com/google/cayley/query/mql"
+)
+
+func TestDebug(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	api := &API{
+		config: &config.Config{DebugEndpoints: true, DebugToken: "secret"},
+		handle: &graph.Handle{QuadStore: qs},
+	}
+	r := httprouter.New()
+	api.Debug(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	get := func(path, token string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not get %s: %v", path, err)
+		}
+		return resp
+	}
+	for _, token := range []string{"", "wrong"} {
+		resp := get("/debug/vars", token)
+		resp.Body.Close()
+		if resp.StatusCode != 401 {
+			t.Errorf("Unexpected status with token %q, got:%d expect:401", token, resp.StatusCode)
+		}
+	}
+	resp := get("/debug/pprof/goroutine?debug=1", "secret")
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Unexpected status of goroutine profile, got:%d expect:200", resp.StatusCode)
+	}
+
+	ses := mql.NewSession(qs)
+	ses.Explain(true)
+	c := make(chan interface{})
+	go ses.Execute(`[{"id": null}]`, c, -1)
+	for range c {
+	}
+	done := api.queries.add(&runningQuery{Lang: "mql", Started: time.Now(), ses: ses})
+	resp = get("/debug/queries", "secret")
+	var out struct {
+		Queries []struct {
+			Lang      string
+			Iterators []graph.Description
+		}
+	}
+	err := json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Could not decode queries: %v", err)
+	}
+	if len(out.Queries) != 1 || out.Queries[0].Lang != "mql" || len(out.Queries[0].Iterators) != 1 {
+		t.Errorf("Unexpected running queries: %+v", out)
+	}
+	done()
+	if n := len(api.queries.list()); n != 0 {
+		t.Errorf("Finished query still listed, got %d queries", n)
+	}
+}
+
+func TestCancelQuery(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	api := &API{config: &config.Config{}, handle: &graph.Handle{QuadStore: qs}}
+	r := httprouter.New()
+	r.GET("/api/v1/admin/queries", LogRequest(api.ServeV1Queries))
+	r.DELETE("/api/v1/admin/queries/:id", LogRequest(api.ServeV1CancelQuery))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ses := gremlin.NewSession(qs, -1, false)
+	done := api.queries.add(&runningQuery{Lang: "gremlin", Started: time.Now(), ses: ses})
+	defer done()
+	c := make(chan interface{}, 5)
+	go ses.Execute(`while (true) {}`, c, -1)
+
+	resp, err := http.Get(server.URL + "/api/v1/admin/queries")
+	if err != nil {
+		t.Fatalf("Could not list queries: %v", err)
+	}
+	var out struct {
+		Queries []struct {
+			ID   int64
+			Lang string
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Could not decode queries: %v", err)
+	}
+	if len(out.Queries) != 1 || out.Queries[0].Lang != "gremlin" {
+		t.Fatalf("Unexpected running queries: %+v", out)
+	}
+
+	for _, test := range []struct {
+		id     string
+		expect int
+	}{
+		{"x", 400},
+		{"1000", 404},
+		{strconv.FormatInt(out.Queries[0].ID, 10), 200},
+	} {
+		req, _ := http.NewRequest("DELETE", server.URL+"/api/v1/admin/queries/"+test.id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not cancel query %s: %v", test.id, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.expect {
+			t.Errorf("Unexpected status cancelling query %s, got:%d expect:%d", test.id, resp.StatusCode, test.expect)
+		}
+	}
+	for res := range c {
+		ses.Collate(res)
+	}
+	if _, err := ses.Results(); err != gremlin.ErrKillCancelled {
+		t.Errorf("Unexpected error of the cancelled query, got:%v expect:%v", err, gremlin.ErrKillCancelled)
+	}
+}
+
+func TestDebugLoopback(t *testing.T) {
+	api := &API{config: &config.Config{}}
+	for _, test := range []struct {
+		addr   string
+		expect bool
+	}{
+		{"127.0.0.1:5000", true},
+		{"[::1]:5000", true},
+		{"10.0.0.1:5000", false},
+	} {
+		r := &http.Request{RemoteAddr: test.addr, Header: http.Header{"X-Real-Ip": {"127.0.0.1"}}}
+		if got := api.debugAllowed(r); got != test.expect {
+			t.Errorf("Unexpected access from %s, got:%t expect:%t", test.addr, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+)
+
+// ServeV1Dedupe removes the copies beyond the first of the quads the store
+// holds more than once, or only counts them if the "dry_run" query parameter
+// is true, and serves the report.
+func (api *API) ServeV1Dedupe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if !dryRun && api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	rep, err := graph.Dedupe(h.QuadStore, h.QuadWriter, dryRun)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+	return 200
+}
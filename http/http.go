@@ -15,19 +15,26 @@
 package http
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/barakmich/glog"
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/config"
 	"github.com/google/cayley/db"
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/internal/auth"
+	"github.com/google/cayley/trace"
 )
 
 type ResponseHandler func(http.ResponseWriter, *http.Request, httprouter.Params) int
@@ -49,7 +56,7 @@ func findAssetsPath() string {
 		if hasAssets(*assetsPath) {
 			return *assetsPath
 		}
-		glog.Fatalln("Cannot find assets at", *assetsPath, ".")
+		clog.Fatalln("Cannot find assets at", *assetsPath, ".")
 	}
 
 	if hasAssets(".") {
@@ -64,23 +71,71 @@ func findAssetsPath() string {
 	if hasAssets(gopathPath) {
 		return gopathPath
 	}
-	glog.Fatalln("Cannot find assets in any of the default search paths. Please run in the same directory, in a Go workspace, or set --assets .")
+	clog.Fatalln("Cannot find assets in any of the default search paths. Please run in the same directory, in a Go workspace, or set --assets .")
 	panic("cannot reach")
 }
 
+// remoteAddr returns the address of the client making a request, as told
+// by a proxy in front of the server if there is one.
+func remoteAddr(req *http.Request) string {
+	addr := req.Header.Get("X-Real-IP")
+	if addr == "" {
+		addr = req.Header.Get("X-Forwarded-For")
+		if addr == "" {
+			addr = req.RemoteAddr
+		}
+	}
+	return addr
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// spans holds the span of each request being served, for its handler to
+// trace its steps under.
+var spans = struct {
+	sync.Mutex
+	m map[*http.Request]trace.Span
+}{m: make(map[*http.Request]trace.Span)}
+
+// requestSpan returns the span of a request, or nil if it has none.
+func requestSpan(r *http.Request) trace.Span {
+	spans.Lock()
+	defer spans.Unlock()
+	return spans.m[r]
+}
+
 func LogRequest(handler ResponseHandler) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		start := time.Now()
-		addr := req.Header.Get("X-Real-IP")
-		if addr == "" {
-			addr = req.Header.Get("X-Forwarded-For")
-			if addr == "" {
-				addr = req.RemoteAddr
-			}
+		addr := remoteAddr(req)
+		// Identify the request in the audit log, keeping the ID given by
+		// the client or a proxy in front of the server.
+		id := req.Header.Get("X-Request-ID")
+		if id == "" {
+			id = newRequestID()
+			req.Header.Set("X-Request-ID", id)
 		}
-		glog.Infof("Started %s %s for %s", req.Method, req.URL.Path, addr)
+		w.Header().Set("X-Request-ID", id)
+		span := trace.Start("http", nil)
+		span.SetTag("method", req.Method)
+		span.SetTag("path", req.URL.Path)
+		span.SetTag("request_id", id)
+		spans.Lock()
+		spans.m[req] = span
+		spans.Unlock()
+		log := clog.With(clog.Fields{"request_id": id})
+		log.Infof("Started %s %s for %s", req.Method, req.URL.Path, addr)
 		code := handler(w, req, params)
-		glog.Infof("Completed %v %s %s in %v", code, http.StatusText(code), req.URL.Path, time.Since(start))
+		log.Infof("Completed %v %s %s in %v", code, http.StatusText(code), req.URL.Path, time.Since(start))
+		spans.Lock()
+		delete(spans.m, req)
+		spans.Unlock()
+		span.SetTag("status", code)
+		span.Finish()
 
 	}
 }
@@ -106,13 +161,73 @@ func (h *TemplateRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 }
 
 type API struct {
+	mu     sync.RWMutex
 	config *config.Config
 	handle *graph.Handle
+	txs    transactions
+
+	// reload rereads the configuration, for ServeV1Reload.
+	reload func() error
+
+	// queries are the queries being run.
+	queries runningQueries
+
+	// authz grants roles to the credentials of requests. If the
+	// credentials of the configuration are invalid, authErr is set, and
+	// every request is refused.
+	authz   *auth.Authorizer
+	authErr error
+}
+
+// NewAPI returns the API serving the given database, for adding its routes
+// to a router with APIv1.
+func NewAPI(handle *graph.Handle, cfg *config.Config) *API {
+	api := &API{config: cfg, handle: handle}
+	api.authz, api.authErr = auth.New(cfg)
+	if api.authErr != nil {
+		clog.Errorf("Refusing every request: %v", api.authErr)
+	}
+	return api
 }
 
+// roleOf returns the role the credentials of a request grant.
+func (api *API) roleOf(r *http.Request) (auth.Role, error) {
+	if api.authErr != nil {
+		return auth.None, api.authErr
+	}
+	return api.authz.RoleOf(r.Header.Get("Authorization"))
+}
+
+// allow returns a handler serving the requests whose credentials grant the
+// given role with handler, and refusing the others: with 401 if they have no
+// role, or 403 if theirs is not enough.
+func (api *API) allow(role auth.Role, handler ResponseHandler) ResponseHandler {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+		got, err := api.roleOf(r)
+		if got == auth.None || err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cayley"`)
+			return jsonResponse(w, 401, "Unauthorized.")
+		}
+		if !got.Can(role) {
+			return jsonResponse(w, 403, fmt.Sprintf("Forbidden to the %s role.", got))
+		}
+		return handler(w, r, params)
+	}
+}
+
+// conf returns the configuration the API serves with.
+func (api *API) conf() *config.Config {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.config
+}
+
+// GetHandleForRequest returns the handle to serve a request with. Its writes
+// are attributed in the audit log, if there is one, to the client address
+// and request ID, and traced under the span of the request.
 func (api *API) GetHandleForRequest(r *http.Request) (*graph.Handle, error) {
-	if !api.config.RequiresHTTPRequestContext {
-		return api.handle, nil
+	if !api.conf().RequiresHTTPRequestContext {
+		return requestHandle(api.handle, r), nil
 	}
 
 	opts := make(graph.Options)
@@ -122,34 +237,83 @@ func (api *API) GetHandleForRequest(r *http.Request) (*graph.Handle, error) {
 	if err != nil {
 		return nil, err
 	}
-	qw, err := db.OpenQuadWriter(qs, api.config)
+	qw, err := db.OpenQuadWriter(qs, api.conf())
 	if err != nil {
 		return nil, err
 	}
-	return &graph.Handle{QuadStore: qs, QuadWriter: qw}, nil
+	return requestHandle(&graph.Handle{QuadStore: qs, QuadWriter: qw}, r), nil
+}
+
+func requestHandle(h *graph.Handle, r *http.Request) *graph.Handle {
+	qw := h.QuadWriter
+	if aw, ok := qw.(graph.AuditingWriter); ok {
+		qw = aw.WithAudit(remoteAddr(r), r.Header.Get("X-Request-ID"))
+	}
+	if span := requestSpan(r); span != nil {
+		if tw, ok := qw.(graph.TracedWriter); ok {
+			qw = tw.WithSpan(span)
+		}
+	}
+	if qw == h.QuadWriter {
+		return h
+	}
+	return &graph.Handle{QuadStore: h.QuadStore, QuadWriter: qw}
 }
 
 func (api *API) APIv1(r *httprouter.Router) {
-	r.POST("/api/v1/query/:query_lang", LogRequest(api.ServeV1Query))
-	r.POST("/api/v1/shape/:query_lang", LogRequest(api.ServeV1Shape))
-	r.POST("/api/v1/write", LogRequest(api.ServeV1Write))
-	r.POST("/api/v1/write/file/nquad", LogRequest(api.ServeV1WriteNQuad))
+	r.POST("/api/v1/query", LogRequest(api.allow(auth.Read, api.ServeV1Query)))
+	r.POST("/api/v1/query/:query_lang", LogRequest(api.allow(auth.Read, api.ServeV1Query)))
+	r.POST("/api/v1/shape", LogRequest(api.allow(auth.Read, api.ServeV1Shape)))
+	r.POST("/api/v1/shape/:query_lang", LogRequest(api.allow(auth.Read, api.ServeV1Shape)))
+	r.POST("/api/v1/write", LogRequest(api.allow(auth.Write, api.ServeV1Write)))
+	r.POST("/api/v1/write/file/nquad", LogRequest(api.allow(auth.Write, api.ServeV1WriteNQuad)))
 	//TODO(barakmich): /write/text/nquad, which reads from request.body instead of HTML5 file form?
-	r.POST("/api/v1/delete", LogRequest(api.ServeV1Delete))
+	r.POST("/api/v1/delete", LogRequest(api.allow(auth.Write, api.ServeV1Delete)))
+	r.POST("/api/v1/delete/matching", LogRequest(api.allow(auth.Write, api.ServeV1DeleteMatching)))
+	r.POST("/api/v1/delete/query", LogRequest(api.allow(auth.Write, api.ServeV1DeleteByQuery)))
+	r.GET("/api/v1/quads", LogRequest(api.allow(auth.Read, api.ServeV1Quads)))
+	r.GET("/api/v1/watch", LogRequest(api.allow(auth.Read, api.ServeV1Watch)))
+	r.GET("/api/v1/replication/log", LogRequest(api.allow(auth.Admin, api.ServeV1ReplicationLog)))
+	r.GET("/api/v1/admin/backup", LogRequest(api.allow(auth.Admin, api.ServeV1Backup)))
+	r.POST("/api/v1/admin/restore", LogRequest(api.allow(auth.Admin, api.ServeV1Restore)))
+	r.POST("/api/v1/admin/merge", LogRequest(api.allow(auth.Admin, api.ServeV1MergeNodes)))
+	r.POST("/api/v1/admin/rename", LogRequest(api.allow(auth.Admin, api.ServeV1RenameNode)))
+	r.POST("/api/v1/admin/rename_predicate", LogRequest(api.allow(auth.Admin, api.ServeV1RenamePredicate)))
+	r.GET("/api/v1/admin/audit", LogRequest(api.allow(auth.Admin, api.ServeV1Audit)))
+	r.POST("/api/v1/admin/reload", LogRequest(api.allow(auth.Admin, api.ServeV1Reload)))
+	r.GET("/api/v1/admin/stats", LogRequest(api.allow(auth.Admin, api.ServeV1Stats)))
+	r.POST("/api/v1/admin/dedupe", LogRequest(api.allow(auth.Admin, api.ServeV1Dedupe)))
+	r.GET("/api/v1/admin/queries", LogRequest(api.allow(auth.Admin, api.ServeV1Queries)))
+	r.DELETE("/api/v1/admin/queries/:id", LogRequest(api.allow(auth.Admin, api.ServeV1CancelQuery)))
+	r.GET("/api/v1/saved", LogRequest(api.allow(auth.Read, api.ServeV1SavedQueries)))
+	r.GET("/api/v1/saved/:name", LogRequest(api.allow(auth.Read, api.ServeV1SavedQuery)))
+	r.PUT("/api/v1/saved/:name", LogRequest(api.allow(auth.Write, api.ServeV1SaveQuery)))
+	r.DELETE("/api/v1/saved/:name", LogRequest(api.allow(auth.Write, api.ServeV1DeleteSavedQuery)))
+	r.POST("/api/v1/saved/:name/run", LogRequest(api.allow(auth.Read, api.ServeV1RunSavedQuery)))
+	r.GET("/api/v1/labels", LogRequest(api.allow(auth.Read, api.ServeV1Labels)))
+	r.POST("/api/v1/labels/drop", LogRequest(api.allow(auth.Write, api.ServeV1DropLabel)))
+	r.POST("/api/v1/transaction", LogRequest(api.allow(auth.Write, api.ServeV1Begin)))
+	r.POST("/api/v1/transaction/:id/write", LogRequest(api.allow(auth.Write, api.ServeV1TxWrite)))
+	r.POST("/api/v1/transaction/:id/delete", LogRequest(api.allow(auth.Write, api.ServeV1TxDelete)))
+	r.POST("/api/v1/transaction/:id/commit", LogRequest(api.allow(auth.Write, api.ServeV1Commit)))
+	r.POST("/api/v1/transaction/:id/rollback", LogRequest(api.allow(auth.Write, api.ServeV1Rollback)))
 }
 
-func SetupRoutes(handle *graph.Handle, cfg *config.Config) {
+// SetupRoutes serves the API, UI and documentation on the default mux, and
+// returns the API.
+func SetupRoutes(handle *graph.Handle, cfg *config.Config) *API {
 	r := httprouter.New()
 	assets := findAssetsPath()
-	if glog.V(2) {
-		glog.V(2).Infoln("Found assets at", assets)
+	if clog.V(2) {
+		clog.V(2).Infoln("Found assets at", assets)
 	}
 	var templates = template.Must(template.ParseGlob(fmt.Sprint(assets, "/templates/*.tmpl")))
 	templates.ParseGlob(fmt.Sprint(assets, "/templates/*.html"))
 	root := &TemplateRequestHandler{templates: templates}
 	docs := &DocRequestHandler{assets: assets}
-	api := &API{config: cfg, handle: handle}
+	api := NewAPI(handle, cfg)
 	api.APIv1(r)
+	api.Debug(r)
 
 	//m.Use(martini.Static("static", martini.StaticOptions{Prefix: "/static", SkipLogging: true}))
 	//r.Handler("GET", "/static", http.StripPrefix("/static", http.FileServer(http.Dir("static/"))))
@@ -158,14 +322,52 @@ func SetupRoutes(handle *graph.Handle, cfg *config.Config) {
 	r.GET("/", root.ServeHTTP)
 	http.Handle("/static/", http.StripPrefix("/static", http.FileServer(http.Dir(fmt.Sprint(assets, "/static/")))))
 	http.Handle("/", r)
+	return api
 }
 
 func Serve(handle *graph.Handle, cfg *config.Config) {
 	SetupRoutes(handle, cfg)
-	glog.Infof("Cayley now listening on %s:%s\n", cfg.ListenHost, cfg.ListenPort)
-	fmt.Printf("Cayley now listening on %s:%s\n", cfg.ListenHost, cfg.ListenPort)
-	err := http.ListenAndServe(fmt.Sprintf("%s:%s", cfg.ListenHost, cfg.ListenPort), nil)
+	ListenAndServe(cfg)
+}
+
+// ShutdownTimeout is how long ListenAndServeUntil waits for the requests
+// being served to finish once it is stopped.
+var ShutdownTimeout = 30 * time.Second
+
+// ListenAndServe serves the routes set up by SetupRoutes on the configured
+// host and port.
+func ListenAndServe(cfg *config.Config) {
+	if err := ListenAndServeUntil(cfg, nil); err != nil {
+		clog.Fatal("ListenAndServe: ", err)
+	}
+}
+
+// ListenAndServeUntil serves the routes set up by SetupRoutes on the
+// configured host and port until stop is closed, then stops accepting
+// connections, and waits for at most ShutdownTimeout for the requests being
+// served to finish. It returns nil once it has stopped cleanly.
+func ListenAndServeUntil(cfg *config.Config, stop <-chan struct{}) error {
+	srv := &http.Server{Addr: fmt.Sprintf("%s:%s", cfg.ListenHost, cfg.ListenPort)}
+	ln, err := net.Listen("tcp", srv.Addr)
 	if err != nil {
-		glog.Fatal("ListenAndServe: ", err)
+		return err
+	}
+	clog.Infof("Cayley now listening on %s:%s\n", cfg.ListenHost, cfg.ListenPort)
+	fmt.Printf("Cayley now listening on %s:%s\n", cfg.ListenHost, cfg.ListenPort)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ln)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-stop:
+	}
+	clog.Infof("Shutting down, waiting up to %v for the requests being served", ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("could not finish serving requests: %v", err)
 	}
+	return nil
 }
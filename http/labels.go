@@ -0,0 +1,102 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/labels"
+)
+
+type labelCount struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+type labelCounts []labelCount
+
+func (l labelCounts) Len() int           { return len(l) }
+func (l labelCounts) Less(i, j int) bool { return l[i].Label < l[j].Label }
+func (l labelCounts) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// storeForRequest returns qs, or a view of it restricted to the named graphs
+// given by the "label" query parameters.
+func storeForRequest(qs graph.QuadStore, r *http.Request) graph.QuadStore {
+	if l := r.URL.Query()["label"]; len(l) != 0 {
+		return labels.Restrict(qs, l...)
+	}
+	return qs
+}
+
+func (api *API) ServeV1Labels(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	snap := graph.Snapshot(h.QuadStore)
+	setVersion(w, snap)
+	counts, err := labels.Counts(snap)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	out := make(labelCounts, 0, len(counts))
+	for l, n := range counts {
+		out = append(out, labelCount{Label: l, Count: n})
+	}
+	sort.Sort(out)
+	bytes, err := json.MarshalIndent(map[string]interface{}{"labels": out}, "", " ")
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Write(bytes)
+	return 200
+}
+
+func (api *API) ServeV1DropLabel(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	var req struct {
+		Label string `json:"label"`
+	}
+	err = json.Unmarshal(bodyBytes, &req)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	if req.Label == "" {
+		return jsonResponse(w, 400, labels.ErrDefaultGraph)
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	count, err := labels.Drop(h.QuadWriter, req.Label)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d quads.\"}", count)
+	return 200
+}
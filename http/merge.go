@@ -0,0 +1,78 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+)
+
+type nodeChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (api *API) serveV1NodeChange(w http.ResponseWriter, r *http.Request, change func(graph.QuadStore, graph.QuadWriter, string, string) (int, error)) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	var c nodeChange
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	if c.From == "" || c.To == "" {
+		return jsonResponse(w, 400, "Missing node.")
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	n, err := change(h.QuadStore, h.QuadWriter, c.From, c.To)
+	if err == graph.ErrNodeExists {
+		return jsonResponse(w, 409, err)
+	} else if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully rewrote %d quads.\"}", n)
+	return 200
+}
+
+func (api *API) ServeV1MergeNodes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	return api.serveV1NodeChange(w, r, graph.MergeNodes)
+}
+
+func (api *API) ServeV1RenameNode(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	return api.serveV1NodeChange(w, r, graph.RenameNode)
+}
+
+func (api *API) ServeV1RenamePredicate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	blockSize, err := strconv.Atoi(r.URL.Query().Get("block_size"))
+	if err != nil {
+		blockSize = api.conf().LoadSize
+	}
+	return api.serveV1NodeChange(w, r, func(qs graph.QuadStore, qw graph.QuadWriter, from, to string) (int, error) {
+		return graph.RenamePredicate(qs, qw, from, to, blockSize, func(n int) {
+			clog.V(2).Infof("Renaming predicate %q to %q: rewrote %d quads", from, to, n)
+		})
+	})
+}
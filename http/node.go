@@ -0,0 +1,73 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+var directions = map[string]quad.Direction{
+	"subject":   quad.Subject,
+	"predicate": quad.Predicate,
+	"object":    quad.Object,
+	"label":     quad.Label,
+}
+
+func (api *API) ServeV1Quads(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	node := r.URL.Query().Get("node")
+	if node == "" {
+		return jsonResponse(w, 400, "Missing node.")
+	}
+	var dirs []quad.Direction
+	for _, name := range r.URL.Query()["direction"] {
+		d, ok := directions[name]
+		if !ok {
+			return jsonResponse(w, 400, fmt.Sprintf("Invalid direction %q.", name))
+		}
+		dirs = append(dirs, d)
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	snap := graph.Snapshot(h.QuadStore)
+	setVersion(w, snap)
+	qs := storeForRequest(snap, r)
+	it, err := graph.QuadsAllOn(qs, qs.ValueOf(node), dirs...)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	defer it.Close()
+	quads := []quad.Quad{}
+	for graph.Next(it) {
+		quads = append(quads, qs.Quad(it.Result()))
+	}
+	if err := it.Err(); err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	bytes, err := json.MarshalIndent(map[string]interface{}{"quads": quads}, "", " ")
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Write(bytes)
+	return 200
+}
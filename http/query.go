@@ -17,18 +17,37 @@ package http
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/google/cayley/db"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/internal/auth"
+	"github.com/google/cayley/memory"
+	"github.com/google/cayley/quad"
 	"github.com/google/cayley/query"
 	"github.com/google/cayley/query/gremlin"
 	"github.com/google/cayley/query/mql"
+	"github.com/google/cayley/trace"
 )
 
 type SuccessQueryWrapper struct {
 	Result interface{} `json:"result"`
+
+	// Iterators describes the iterators of the query, if it was asked
+	// to be explained.
+	Iterators []graph.Description `json:"iterators,omitempty"`
+
+	// Profile counts the calls to the iterators of the query and times
+	// them, if it was asked to be profiled.
+	Profile []iterator.IteratorProfile `json:"profile,omitempty"`
 }
 
 type ErrorQueryWrapper struct {
@@ -48,12 +67,27 @@ func WrapResult(result interface{}) ([]byte, error) {
 }
 
 func Run(q string, ses query.HTTP) (interface{}, error) {
+	return runLimit(q, ses, -1)
+}
+
+// runLimit is Run, returning at most limit results if it is not negative.
+// MQL collates several of the results of Execute into one, so its queries
+// are run without the limit, which is applied to the collated results.
+func runLimit(q string, ses query.HTTP, limit int) (interface{}, error) {
+	run := limit
+	if _, ok := ses.(*mql.Session); ok {
+		run = -1
+	}
 	c := make(chan interface{}, 5)
-	go ses.Execute(q, c, 100)
+	go ses.Execute(q, c, run)
 	for res := range c {
 		ses.Collate(res)
 	}
-	return ses.Results()
+	out, err := ses.Results()
+	if list, ok := out.([]interface{}); ok && limit >= 0 && len(list) > limit {
+		out = list[:limit]
+	}
+	return out, err
 }
 
 func GetQueryShape(q string, ses query.HTTP) ([]byte, error) {
@@ -64,37 +98,222 @@ func GetQueryShape(q string, ses query.HTTP) ([]byte, error) {
 	return json.Marshal(s)
 }
 
+// subgraphFormats are the formats, given by the "format" query parameter, in
+// which a query may return the subgraph it matched instead of its results.
+var subgraphFormats = map[string]struct {
+	contentType string
+	write       func(io.Writer, []quad.Quad) error
+}{
+	"nquads": {"application/n-quads", db.WriteNQuads},
+	"turtle": {"text/turtle", db.WriteTurtle},
+}
+
+// queryOptions are the options a query may be given with its request, as
+// query parameters or as headers.
+type queryOptions struct {
+	lang    string
+	timeout time.Duration
+	limit   int
+	explain bool
+	profile bool
+}
+
+// requestOption returns the named option of a request: its query parameter,
+// or else its header, named with X-Cayley- before it.
+func requestOption(r *http.Request, name string) string {
+	if v := r.URL.Query().Get(name); v != "" {
+		return v
+	}
+	return r.Header.Get("X-Cayley-" + name)
+}
+
+// optionsForRequest returns the options of a query request. The language is
+// that of the URL, if it names one. The timeout may shorten the configured
+// one, but not lengthen it.
+func (api *API) optionsForRequest(r *http.Request, params httprouter.Params) (queryOptions, error) {
+	opts := queryOptions{
+		lang:    params.ByName("query_lang"),
+		timeout: api.conf().Timeout,
+		limit:   -1,
+	}
+	if opts.lang == "" {
+		opts.lang = requestOption(r, "lang")
+	}
+	if s := requestOption(r, "timeout"); s != "" {
+		// Like the configured timeout, a number is of seconds.
+		t, err := time.ParseDuration(s)
+		if n, nerr := strconv.Atoi(s); nerr == nil {
+			t, err = time.Duration(n)*time.Second, nil
+		}
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout %q", s)
+		}
+		if t >= 0 && (opts.timeout < 0 || t < opts.timeout) {
+			opts.timeout = t
+		}
+	}
+	if s := requestOption(r, "limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid limit %q", s)
+		}
+		opts.limit = n
+	}
+	if s := requestOption(r, "explain"); s != "" {
+		ok, err := strconv.ParseBool(s)
+		if err != nil {
+			return opts, fmt.Errorf("invalid explain flag %q", s)
+		}
+		opts.explain = ok
+	}
+	if s := requestOption(r, "profile"); s != "" {
+		ok, err := strconv.ParseBool(s)
+		if err != nil {
+			return opts, fmt.Errorf("invalid profile flag %q", s)
+		}
+		opts.profile = ok
+	}
+	return opts, nil
+}
+
+// tagMaps returns the results of a query as maps of their tags, if they all
+// are.
+func tagMaps(output interface{}) ([]map[string]string, bool) {
+	list, ok := output.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	rows := make([]map[string]string, 0, len(list))
+	for _, v := range list {
+		m, ok := v.(map[string]string)
+		if !ok {
+			return nil, false
+		}
+		rows = append(rows, m)
+	}
+	return rows, true
+}
+
 // TODO(barakmich): Turn this into proper middleware.
 func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
 	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	opts, err := api.optionsForRequest(r, params)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	snap := graph.Snapshot(h.QuadStore)
+	setVersion(w, snap)
+	qs := storeForRequest(snap, r)
 	var ses query.HTTP
-	switch params.ByName("query_lang") {
+	switch opts.lang {
 	case "gremlin":
-		ses = gremlin.NewSession(h.QuadStore, api.config.Timeout, false)
+		var gs *gremlin.Session
+		role, _ := api.roleOf(r)
+		if api.conf().ReadOnly || !role.Can(auth.Write) {
+			gs = gremlin.NewSession(qs, opts.timeout, false)
+		} else {
+			// Scripts that write must read their own writes, so they
+			// read the live store rather than the snapshot.
+			gs = gremlin.NewSession(storeForRequest(h.QuadStore, r), opts.timeout, false)
+			gs.SetWriter(h.QuadWriter)
+		}
+		ses = gs
 	case "mql":
-		ses = mql.NewSession(h.QuadStore)
+		ses = mql.NewSession(qs)
 	default:
 		return jsonResponse(w, 400, "Need a query language.")
 	}
+	span := requestSpan(r)
+	if span != nil {
+		span.SetTag("query_lang", opts.lang)
+		if ts, ok := ses.(query.Traced); ok {
+			ts.SetSpan(span)
+		}
+	}
+	if bs, ok := ses.(query.Budgeted); ok {
+		quota := memory.NewQuota()
+		defer quota.Close()
+		bs.SetQuota(quota)
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "tree" {
+		if _, ok := subgraphFormats[format]; !ok {
+			return jsonResponse(w, 400, fmt.Sprintf("Unknown format %q.", format))
+		}
+		sg, ok := ses.(query.Subgrapher)
+		if !ok {
+			return jsonResponse(w, 400, "Query language cannot return subgraphs.")
+		}
+		sg.Subgraph(true)
+	}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return jsonResponse(w, 400, err)
 	}
 	code := string(bodyBytes)
+	parse := trace.Start("parse", span)
 	result, err := ses.Parse(code)
+	parse.Finish()
 	switch result {
 	case query.Parsed:
 		var output interface{}
 		var bytes []byte
 		var err error
-		output, err = Run(code, ses)
+		ex, canExplain := ses.(query.Explainer)
+		if opts.explain && !canExplain {
+			return jsonResponse(w, 400, "Query language cannot explain queries.")
+		}
+		if canExplain && (api.conf().DebugEndpoints || opts.explain) {
+			ex.Explain(true)
+		}
+		pr, canProfile := ses.(query.Profiler)
+		if opts.profile {
+			if !canProfile {
+				return jsonResponse(w, 400, "Query language cannot profile queries.")
+			}
+			pr.Profile(true)
+		}
+		defer api.queries.add(&runningQuery{
+			RequestID: r.Header.Get("X-Request-ID"),
+			Lang:      opts.lang,
+			Query:     code,
+			Started:   time.Now(),
+			ses:       ses,
+		})()
+		output, err = runLimit(code, ses, opts.limit)
 		if err != nil {
 			bytes, err = WrapErrResult(err)
 			http.Error(w, string(bytes), 400)
 			ses = nil
 			return 400
 		}
-		bytes, err = WrapResult(output)
+		if format == "tree" {
+			rows, ok := tagMaps(output)
+			if !ok {
+				return jsonResponse(w, 400, "Query results are not tags.")
+			}
+			var levels []string
+			if s := r.URL.Query().Get("levels"); s != "" {
+				levels = strings.Split(s, ",")
+			}
+			output = query.Tree(rows, levels...)
+		} else if format != "" {
+			f := subgraphFormats[format]
+			w.Header().Set("Content-Type", f.contentType)
+			f.write(w, output.([]quad.Quad))
+			return 200
+		}
+		wrap := SuccessQueryWrapper{Result: output}
+		if opts.explain {
+			wrap.Iterators = ex.Iterators()
+		}
+		if opts.profile {
+			wrap.Profile = pr.Profiles()
+		}
+		bytes, err = json.MarshalIndent(wrap, "", " ")
 		if err != nil {
 			ses = nil
 			return jsonResponse(w, 400, err)
@@ -105,6 +324,9 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 	case query.ParseFail:
 		ses = nil
 		return jsonResponse(w, 400, err)
+	case query.ParseMore:
+		ses = nil
+		return jsonResponse(w, 400, "Incomplete query.")
 	default:
 		ses = nil
 		return jsonResponse(w, 500, "Incomplete data?")
@@ -113,12 +335,20 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 
 func (api *API) ServeV1Shape(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
 	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	opts, err := api.optionsForRequest(r, params)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	qs := storeForRequest(graph.Snapshot(h.QuadStore), r)
 	var ses query.HTTP
-	switch params.ByName("query_lang") {
+	switch opts.lang {
 	case "gremlin":
-		ses = gremlin.NewSession(h.QuadStore, api.config.Timeout, false)
+		ses = gremlin.NewSession(qs, opts.timeout, false)
 	case "mql":
-		ses = mql.NewSession(h.QuadStore)
+		ses = mql.NewSession(qs)
 	default:
 		return jsonResponse(w, 400, "Need a query language.")
 	}
@@ -140,6 +370,8 @@ func (api *API) ServeV1Shape(w http.ResponseWriter, r *http.Request, params http
 		return 200
 	case query.ParseFail:
 		return jsonResponse(w, 400, err)
+	case query.ParseMore:
+		return jsonResponse(w, 400, "Incomplete query.")
 	default:
 		return jsonResponse(w, 500, "Incomplete data?")
 	}
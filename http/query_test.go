@@ -0,0 +1,113 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+func TestQueryOptions(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, _ := graph.NewQuadWriter("single", qs, nil)
+	qw.AddQuadSet([]quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"alice", "follows", "charlie", ""},
+		{"bob", "follows", "charlie", ""},
+		{"charlie", "follows", "alice", ""},
+	})
+	api := &API{
+		config: &config.Config{Timeout: -1},
+		handle: &graph.Handle{QuadStore: qs, QuadWriter: qw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, test := range []struct {
+		path    string
+		header  http.Header
+		body    string
+		status  int
+		results int
+		explain bool
+		profile bool
+	}{
+		{path: "/api/v1/query?lang=mql", body: `[{"id": null}]`, status: 200, results: 4},
+		{path: "/api/v1/query?lang=mql&limit=2", body: `[{"id": null}]`, status: 200, results: 2},
+		{path: "/api/v1/query/mql", header: http.Header{"X-Cayley-Limit": {"1"}}, body: `[{"id": null}]`, status: 200, results: 1},
+		{path: "/api/v1/query?lang=mql", body: `[{"id": null, "follows": []}]`, status: 200, results: 4},
+		{path: "/api/v1/query?lang=mql&limit=2", body: `[{"id": null, "follows": []}]`, status: 200, results: 2},
+		{path: "/api/v1/query", header: http.Header{"X-Cayley-Lang": {"gremlin"}}, body: `g.V().All()`, status: 200, results: 4},
+		{path: "/api/v1/query?lang=gremlin&limit=2&timeout=10s", body: `g.V().All()`, status: 200, results: 2},
+		{path: "/api/v1/query?lang=mql&explain=true", body: `[{"id": null}]`, status: 200, results: 4, explain: true},
+		{path: "/api/v1/query?lang=mql&profile=true", body: `[{"id": null}]`, status: 200, results: 4, profile: true},
+		{path: "/api/v1/query?lang=gremlin", header: http.Header{"X-Cayley-Profile": {"true"}}, body: `g.V().Out("follows").All()`, status: 200, results: 4, profile: true},
+		{path: "/api/v1/query?lang=gremlin&profile=maybe", body: `g.V().All()`, status: 400},
+		{path: "/api/v1/query?lang=gremlin&format=tree&levels=id", body: `g.V().Tag("x").All()`, status: 200, results: 4},
+		{path: "/api/v1/query?lang=mql&format=tree", body: `[{"id": null}]`, status: 400},
+		{path: "/api/v1/query", body: `[{"id": null}]`, status: 400},
+		{path: "/api/v1/query?lang=mql&limit=some", body: `[{"id": null}]`, status: 400},
+		{path: "/api/v1/query?lang=gremlin&timeout=soon", body: `g.V().All()`, status: 400},
+	} {
+		req, _ := http.NewRequest("POST", server.URL+test.path, strings.NewReader(test.body))
+		for k, v := range test.header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not query %s: %v", test.path, err)
+		}
+		var out struct {
+			Result    []interface{}
+			Iterators []graph.Description
+			Profile   []iterator.IteratorProfile
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("Unexpected status of %s, got:%d expect:%d", test.path, resp.StatusCode, test.status)
+			continue
+		}
+		if test.status != 200 {
+			continue
+		}
+		if err != nil {
+			t.Errorf("Could not decode results of %s: %v", test.path, err)
+		}
+		if len(out.Result) != test.results {
+			t.Errorf("Unexpected results of %s, got:%v expect %d", test.path, out.Result, test.results)
+		}
+		if got := len(out.Iterators) != 0; got != test.explain {
+			t.Errorf("Unexpected explanation of %s, got:%v", test.path, out.Iterators)
+		}
+		if got := len(out.Profile) != 0; got != test.profile {
+			t.Errorf("Unexpected profile of %s, got:%v", test.path, out.Profile)
+		} else if got && out.Profile[0].Next == 0 {
+			t.Errorf("Unexpected profile of %s, got no calls to Next: %v", test.path, out.Profile)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+)
+
+// Reload updates the tunable keys of the configuration the API serves with
+// from cfg, and the options of the store that can be changed while it is
+// open, if it is a Tuner.
+func (api *API) Reload(cfg *config.Config) error {
+	if t, ok := api.handle.QuadStore.(graph.Tuner); ok {
+		err := t.Tune(cfg.DatabaseOptions)
+		if err != nil {
+			return err
+		}
+	}
+	api.mu.Lock()
+	api.config = api.config.Reloaded(cfg)
+	api.mu.Unlock()
+	return nil
+}
+
+// SetReloader sets the function rereading the configuration when a reload
+// is requested through the API. It is expected to call Reload.
+func (api *API) SetReloader(fn func() error) {
+	api.reload = fn
+}
+
+// ServeV1Reload rereads the configuration, and applies its tunable keys
+// without restarting the server or reopening the database.
+func (api *API) ServeV1Reload(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	if api.reload == nil {
+		return jsonResponse(w, 501, "Reloading the configuration is not supported.")
+	}
+	if err := api.reload(); err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	fmt.Fprint(w, "{\"result\": \"Successfully reloaded the configuration.\"}")
+	return 200
+}
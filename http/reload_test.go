@@ -0,0 +1,70 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+)
+
+func TestReload(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	api := NewAPI(&graph.Handle{QuadStore: qs}, &config.Config{
+		DatabasePath: "/var/cayley",
+		Timeout:      time.Second,
+	})
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	post := func() int {
+		resp, err := http.Post(server.URL+"/api/v1/admin/reload", "application/json", nil)
+		if err != nil {
+			t.Fatalf("Could not request a reload: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(); code != 501 {
+		t.Errorf("Unexpected status without a reloader, got:%d expect:501", code)
+	}
+
+	next := &config.Config{DatabasePath: "/elsewhere", Timeout: time.Minute, LoadSize: 50}
+	api.SetReloader(func() error { return api.Reload(next) })
+	if code := post(); code != 200 {
+		t.Errorf("Unexpected status of reload, got:%d expect:200", code)
+	}
+	got := api.conf()
+	if got.Timeout != time.Minute || got.LoadSize != 50 {
+		t.Errorf("Tunable keys not reloaded: %+v", got)
+	}
+	if got.DatabasePath != "/var/cayley" {
+		t.Errorf("Unexpected reload of the database path, got:%q", got.DatabasePath)
+	}
+
+	api.SetReloader(func() error { return errors.New("bad config") })
+	if code := post(); code != 500 {
+		t.Errorf("Unexpected status of failed reload, got:%d expect:500", code)
+	}
+}
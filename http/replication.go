@@ -0,0 +1,81 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/writer"
+)
+
+// DefaultReplicationLimit is the number of batches served to a follower at
+// once, unless it asks for fewer.
+const DefaultReplicationLimit = 100
+
+// ServeV1ReplicationLog serves the batches of the write-ahead log from the
+// given offset on, for followers to apply. It is only available when the
+// database is written through the wal writer.
+func (api *API) ServeV1ReplicationLog(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	if api.conf().ReplicationType != "wal" {
+		return jsonResponse(w, 404, "Database does not keep a write-ahead log.")
+	}
+	path, ok, err := graph.Options(api.conf().ReplicationOptions).StringKey("wal_path")
+	if err != nil || !ok {
+		return jsonResponse(w, 500, "Could not find the write-ahead log.")
+	}
+	var offset int64
+	if s := r.URL.Query().Get("offset"); s != "" {
+		offset, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || offset < 0 {
+			return jsonResponse(w, 400, "Invalid offset.")
+		}
+	}
+	limit := DefaultReplicationLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return jsonResponse(w, 400, "Invalid limit.")
+		}
+	}
+
+	lr, err := writer.NewLogReader(path)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	defer lr.Close()
+	lr.SetOffset(offset)
+	out := writer.LogBatches{Batches: []writer.LogBatch{}}
+	for len(out.Batches) < limit {
+		deltas, err := lr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return jsonResponse(w, 400, err)
+		}
+		out.Batches = append(out.Batches, writer.LogBatch{Offset: lr.Offset(), Deltas: deltas})
+	}
+	bytes, err := json.Marshal(out)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Write(bytes)
+	return 200
+}
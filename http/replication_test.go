@@ -0,0 +1,175 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/writer"
+
+	_ "github.com/google/cayley/graph/memstore"
+)
+
+func storedQuads(qs graph.QuadStore) []string {
+	var out []string
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		out = append(out, qs.Quad(it.Result()).String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestReplication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_replication")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := map[string]interface{}{"wal_path": filepath.Join(dir, "wal")}
+	primary, _ := graph.NewQuadStore("memstore", "", nil)
+	pw, err := graph.NewQuadWriter("wal", primary, opts)
+	if err != nil {
+		t.Fatalf("Could not open the wal writer: %v", err)
+	}
+	defer pw.Close()
+	api := &API{
+		config: &config.Config{ReplicationType: "wal", ReplicationOptions: opts},
+		handle: &graph.Handle{QuadStore: primary, QuadWriter: pw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	pw.AddQuadSet([]quad.Quad{
+		{Subject: "A", Predicate: "follows", Object: "B"},
+		{Subject: "B", Predicate: "follows", Object: "C"},
+	})
+	pw.RemoveQuad(quad.Quad{Subject: "A", Predicate: "follows", Object: "B"})
+
+	offsetPath := filepath.Join(dir, "offset")
+	followerOpts := graph.Options{
+		"primary":          server.URL,
+		"offset_path":      offsetPath,
+		"poll_interval_ms": 0.0,
+	}
+	follower, _ := graph.NewQuadStore("memstore", "", nil)
+	fw, err := graph.NewQuadWriter("follower", follower, followerOpts)
+	if err != nil {
+		t.Fatalf("Could not create the follower: %v", err)
+	}
+	f := fw.(*writer.Follower)
+	if n, err := f.Sync(); err != nil || n != 2 {
+		t.Fatalf("Unexpected result of first sync, got:%d, %v expect:2", n, err)
+	}
+	if got, expect := storedQuads(follower), storedQuads(primary); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Follower did not catch up, got:%v expect:%v", got, expect)
+	}
+	fh, ph := follower.Horizon(), primary.Horizon()
+	if got, expect := fh.Int(), ph.Int(); got != expect {
+		t.Errorf("Unexpected follower horizon, got:%d expect:%d", got, expect)
+	}
+	if err := fw.AddQuad(quad.Quad{Subject: "X", Predicate: "is", Object: "Y"}); err != writer.ErrFollower {
+		t.Errorf("Unexpected error writing to a follower: %v", err)
+	}
+	fw.Close()
+
+	// A new follower of the same store resumes from the saved offset.
+	pw.AddQuad(quad.Quad{Subject: "C", Predicate: "follows", Object: "D"})
+	fw, err = graph.NewQuadWriter("follower", follower, followerOpts)
+	if err != nil {
+		t.Fatalf("Could not resume the follower: %v", err)
+	}
+	defer fw.Close()
+	f = fw.(*writer.Follower)
+	if n, err := f.Sync(); err != nil || n != 1 {
+		t.Fatalf("Unexpected result of resumed sync, got:%d, %v expect:1", n, err)
+	}
+	if got, expect := storedQuads(follower), storedQuads(primary); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Follower did not resume, got:%v expect:%v", got, expect)
+	}
+	if n, err := f.Sync(); err != nil || n != 0 {
+		t.Errorf("Unexpected result of sync when caught up, got:%d, %v expect:0", n, err)
+	}
+}
+
+func TestReplicationCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_replication")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := map[string]interface{}{"wal_path": filepath.Join(dir, "wal")}
+	primary, _ := graph.NewQuadStore("memstore", "", nil)
+	pw, err := graph.NewQuadWriter("wal", primary, opts)
+	if err != nil {
+		t.Fatalf("Could not open the wal writer: %v", err)
+	}
+	defer pw.Close()
+	api := NewAPI(&graph.Handle{QuadStore: primary, QuadWriter: pw}, &config.Config{
+		ReplicationType:    "wal",
+		ReplicationOptions: opts,
+		Credentials: []config.Credential{
+			{Token: "replica", Role: "admin"},
+			{User: "replica", Password: "hunter2", Role: "admin"},
+			{Token: "reader", Role: "read"},
+		},
+	})
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	pw.AddQuad(quad.Quad{Subject: "A", Predicate: "follows", Object: "B"})
+
+	for _, test := range []struct {
+		auth   graph.Options
+		synced bool
+	}{
+		{graph.Options{}, false},
+		{graph.Options{"token": "reader"}, false},
+		{graph.Options{"token": "replica"}, true},
+		{graph.Options{"user": "replica", "password": "hunter2"}, true},
+	} {
+		opts := graph.Options{"primary": server.URL, "poll_interval_ms": 0.0}
+		for k, v := range test.auth {
+			opts[k] = v
+		}
+		follower, _ := graph.NewQuadStore("memstore", "", nil)
+		fw, err := graph.NewQuadWriter("follower", follower, opts)
+		if err != nil {
+			t.Fatalf("Could not create the follower: %v", err)
+		}
+		n, err := fw.(*writer.Follower).Sync()
+		if synced := err == nil && n == 1; synced != test.synced {
+			t.Errorf("Unexpected sync with %v, got:%d, %v", test.auth, n, err)
+		}
+		fw.Close()
+	}
+}
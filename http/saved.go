@@ -0,0 +1,142 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+)
+
+// ServeV1SavedQueries lists the saved queries.
+func (api *API) ServeV1SavedQueries(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	list, err := query.SavedQueries(graph.Snapshot(h.QuadStore))
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	bytes, err := json.MarshalIndent(map[string]interface{}{"queries": list}, "", " ")
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Write(bytes)
+	return 200
+}
+
+// ServeV1SavedQuery serves the saved query of the given name.
+func (api *API) ServeV1SavedQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	s, err := query.SavedQuery(graph.Snapshot(h.QuadStore), params.ByName("name"))
+	if err == query.ErrNoSavedQuery {
+		return jsonResponse(w, 404, err)
+	} else if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	bytes, err := json.MarshalIndent(s, "", " ")
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Write(bytes)
+	return 200
+}
+
+// ServeV1SaveQuery saves the query of the body, as JSON giving its language,
+// its text and its default parameters, under the given name.
+func (api *API) ServeV1SaveQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	var s query.Saved
+	err = json.Unmarshal(bodyBytes, &s)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	s.Name = params.ByName("name")
+	if s.Lang == "" || s.Query == "" {
+		return jsonResponse(w, 400, "Need a query language and a query.")
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	err = query.SaveQuery(h.QuadStore, h.QuadWriter, s)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully saved query %q.\"}", s.Name)
+	return 200
+}
+
+// ServeV1DeleteSavedQuery deletes the saved query of the given name.
+func (api *API) ServeV1DeleteSavedQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	name := params.ByName("name")
+	err = query.DeleteSavedQuery(h.QuadStore, h.QuadWriter, name)
+	if err == query.ErrNoSavedQuery {
+		return jsonResponse(w, 404, err)
+	} else if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully deleted query %q.\"}", name)
+	return 200
+}
+
+// ServeV1RunSavedQuery runs the saved query of the given name as
+// ServeV1Query would. Its default parameters are used for the options the
+// request does not give.
+func (api *API) ServeV1RunSavedQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	s, err := query.SavedQuery(graph.Snapshot(h.QuadStore), params.ByName("name"))
+	if err == query.ErrNoSavedQuery {
+		return jsonResponse(w, 404, err)
+	} else if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	values := r.URL.Query()
+	for k, v := range s.Params {
+		if requestOption(r, k) == "" {
+			values.Set(k, v)
+		}
+	}
+	r.URL.RawQuery = values.Encode()
+	r.Body = ioutil.NopCloser(strings.NewReader(s.Query))
+	return api.ServeV1Query(w, r, httprouter.Params{{Key: "query_lang", Value: s.Lang}})
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+)
+
+func TestSavedQueries(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, _ := graph.NewQuadWriter("single", qs, nil)
+	qw.AddQuadSet([]quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"charlie", "follows", "bob", ""},
+	})
+	api := &API{
+		config: &config.Config{Timeout: -1},
+		handle: &graph.Handle{QuadStore: qs, QuadWriter: qw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not %s %s: %v", method, path, err)
+		}
+		return resp
+	}
+	run := func(path string, status, results int) {
+		resp := do("POST", path, "")
+		var out struct {
+			Result []interface{}
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Unexpected status of %s, got:%d expect:%d", path, resp.StatusCode, status)
+		} else if status == 200 && len(out.Result) != results {
+			t.Errorf("Unexpected results of %s, got:%v expect %d", path, out.Result, results)
+		}
+	}
+
+	for i, body := range []string{
+		`{"lang": "gremlin", "query": "g.V().All()"}`,
+		`{"lang": "mql", "query": "[{\"id\": null, \"follows\": \"bob\"}]", "params": {"limit": "1"}}`,
+	} {
+		resp := do("PUT", "/api/v1/saved/followers", body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("Unexpected status of save %d, got:%d expect:200", i, resp.StatusCode)
+		}
+	}
+	resp := do("PUT", "/api/v1/saved/empty", `{"lang": "mql"}`)
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("Unexpected status of saving no query, got:%d expect:400", resp.StatusCode)
+	}
+
+	list, err := query.SavedQueries(qs)
+	if err != nil {
+		t.Fatalf("Could not list saved queries: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "followers" || list[0].Lang != "mql" || list[0].Params["limit"] != "1" {
+		t.Fatalf("Unexpected saved queries: %+v", list)
+	}
+
+	run("/api/v1/saved/followers/run", 200, 1)
+	run("/api/v1/saved/followers/run?limit=5", 200, 2)
+	run("/api/v1/saved/nobody/run", 404, 0)
+
+	resp = do("DELETE", "/api/v1/saved/followers", "")
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Unexpected status of delete, got:%d expect:200", resp.StatusCode)
+	}
+	resp = do("GET", "/api/v1/saved/followers", "")
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("Unexpected status of deleted query, got:%d expect:404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/db"
+)
+
+// ServeV1Stats serves the statistics of the database, counting the quads of
+// each predicate from as many quads as the "sample" query parameter gives.
+func (api *API) ServeV1Stats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	sample := int64(db.DefaultStatsSample)
+	if s := r.URL.Query().Get("sample"); s != "" {
+		var err error
+		sample, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || sample < 0 {
+			return jsonResponse(w, 400, "Invalid sample.")
+		}
+	}
+	st, err := db.Stats(api.handle, api.conf(), sample)
+	if err != nil {
+		return jsonResponse(w, 500, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+	return 200
+}
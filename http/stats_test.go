@@ -0,0 +1,73 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+	_ "github.com/google/cayley/writer"
+)
+
+func TestStats(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, _ := graph.NewQuadWriter("single", qs, nil)
+	qw.AddQuadSet([]quad.Quad{
+		{"A", "follows", "B", ""},
+		{"B", "follows", "C", ""},
+		{"C", "status", "cool", "status_graph"},
+	})
+	api := NewAPI(&graph.Handle{QuadStore: qs, QuadWriter: qw}, &config.Config{DatabaseType: "memstore"})
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/admin/stats")
+	if err != nil {
+		t.Fatalf("Could not request the stats: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("Unexpected status, got:%d expect:200", resp.StatusCode)
+	}
+	var st graph.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		t.Fatalf("Could not decode the stats: %v", err)
+	}
+	if st.Quads != 3 || st.Nodes != 7 || st.Sampled != 0 {
+		t.Errorf("Unexpected stats: %+v", st)
+	}
+	if st.Predicates["follows"] != 2 || st.Predicates["status"] != 1 {
+		t.Errorf("Unexpected predicate counts: %v", st.Predicates)
+	}
+
+	resp, err = http.Get(server.URL + "/api/v1/admin/stats?sample=-1")
+	if err != nil {
+		t.Fatalf("Could not request the stats: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("Unexpected status of a bad sample, got:%d expect:400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// TransactionTimeout is how long a transaction may stay open without being
+// used before it is discarded.
+const TransactionTimeout = 10 * time.Minute
+
+type openTransaction struct {
+	sync.Mutex
+	tx       *graph.Transaction
+	lastUsed time.Time
+}
+
+type transactions struct {
+	sync.Mutex
+	open map[string]*openTransaction
+}
+
+func (t *transactions) begin() string {
+	t.Lock()
+	defer t.Unlock()
+	if t.open == nil {
+		t.open = make(map[string]*openTransaction)
+	}
+	now := time.Now()
+	for id, tx := range t.open {
+		if now.Sub(tx.lastUsed) > TransactionTimeout {
+			delete(t.open, id)
+		}
+	}
+	id := uuid.NewRandom().String()
+	t.open[id] = &openTransaction{tx: graph.NewTransaction(), lastUsed: now}
+	return id
+}
+
+func (t *transactions) get(id string) *openTransaction {
+	t.Lock()
+	defer t.Unlock()
+	tx, ok := t.open[id]
+	if !ok {
+		return nil
+	}
+	if time.Since(tx.lastUsed) > TransactionTimeout {
+		delete(t.open, id)
+		return nil
+	}
+	tx.lastUsed = time.Now()
+	return tx
+}
+
+func (t *transactions) end(id string) *openTransaction {
+	t.Lock()
+	defer t.Unlock()
+	tx, ok := t.open[id]
+	if !ok || time.Since(tx.lastUsed) > TransactionTimeout {
+		return nil
+	}
+	delete(t.open, id)
+	return tx
+}
+
+func (api *API) ServeV1Begin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	fmt.Fprintf(w, "{\"id\": \"%s\"}", api.txs.begin())
+	return 200
+}
+
+func (api *API) serveV1TxChange(w http.ResponseWriter, r *http.Request, params httprouter.Params, change func(*graph.Transaction, quad.Quad)) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	quads, err := ParseJSONToQuadList(bodyBytes)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	tx := api.txs.get(params.ByName("id"))
+	if tx == nil {
+		return jsonResponse(w, 404, "No such transaction.")
+	}
+	tx.Lock()
+	for _, q := range quads {
+		change(tx.tx, q)
+	}
+	tx.Unlock()
+	fmt.Fprintf(w, "{\"result\": \"Successfully added %d changes.\"}", len(quads))
+	return 200
+}
+
+func (api *API) ServeV1TxWrite(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	return api.serveV1TxChange(w, r, params, (*graph.Transaction).AddQuad)
+}
+
+func (api *API) ServeV1TxDelete(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	return api.serveV1TxChange(w, r, params, (*graph.Transaction).RemoveQuad)
+}
+
+func (api *API) ServeV1Commit(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	tx := api.txs.end(params.ByName("id"))
+	if tx == nil {
+		return jsonResponse(w, 404, "No such transaction.")
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	qw, err := writerForRequest(h.QuadWriter, r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	tx.Lock()
+	defer tx.Unlock()
+	err = qw.ApplyTransaction(tx.tx)
+	if err != nil {
+		return jsonResponse(w, 409, err)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully committed %d changes.\"}", len(tx.tx.Deltas))
+	return 200
+}
+
+func (api *API) ServeV1Rollback(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	if api.txs.end(params.ByName("id")) == nil {
+		return jsonResponse(w, 404, "No such transaction.")
+	}
+	fmt.Fprint(w, "{\"result\": \"Transaction rolled back.\"}")
+	return 200
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// ServeV1Watch streams the deltas applied to the quads matching the pattern
+// given by the "subject", "predicate", "object" and "label" query parameters,
+// one JSON object per line, until the client goes away.
+func (api *API) ServeV1Watch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	wr, ok := h.QuadStore.(graph.Watcher)
+	if !ok {
+		return jsonResponse(w, 404, "Database does not support watching.")
+	}
+	query := r.URL.Query()
+	pattern := quad.Quad{
+		Subject:   query.Get("subject"),
+		Predicate: query.Get("predicate"),
+		Object:    query.Get("object"),
+		Label:     query.Get("label"),
+	}
+	var gone <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		gone = cn.CloseNotify()
+	}
+	flusher, _ := w.(http.Flusher)
+
+	c := wr.Subscribe(pattern)
+	defer wr.Unsubscribe(c)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-gone:
+			return 200
+		case d, ok := <-c:
+			if !ok {
+				return 200
+			}
+			if err := enc.Encode(&d); err != nil {
+				return 200
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
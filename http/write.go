@@ -16,18 +16,26 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/barakmich/glog"
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
 	"github.com/google/cayley/internal"
 	"github.com/google/cayley/quad"
 	"github.com/google/cayley/quad/cquads"
+	"github.com/google/cayley/query"
+	"github.com/google/cayley/query/gremlin"
+	"github.com/google/cayley/query/mql"
 )
 
 func ParseJSONToQuadList(jsonBody []byte) ([]quad.Quad, error) {
@@ -44,8 +52,127 @@ func ParseJSONToQuadList(jsonBody []byte) ([]quad.Quad, error) {
 	return quads, nil
 }
 
+// expiryFromRequest returns the expiry time of the quads written by a request,
+// given either as an RFC 3339 time in the "expires" query parameter or as a
+// duration such as "10m" in the "ttl" parameter. It returns the zero time if
+// neither is set.
+func expiryFromRequest(r *http.Request) (time.Time, error) {
+	query := r.URL.Query()
+	if s := query.Get("expires"); s != "" {
+		return time.Parse(time.RFC3339, s)
+	}
+	if s := query.Get("ttl"); s != "" {
+		ttl, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Now().Add(ttl), nil
+	}
+	return time.Time{}, nil
+}
+
+var (
+	errNoIgnore    = errors.New("Writer does not support per-request ignore options.")
+	errNoCondition = errors.New("Writer does not support conditional writes.")
+	errNoSync      = errors.New("Writer does not support per-request sync policies.")
+)
+
+// setVersion sets the ETag of a response to the horizon of qs, the version
+// of the graph a later write may expect by giving it as If-Match.
+func setVersion(w http.ResponseWriter, qs graph.QuadStore) {
+	h := qs.Horizon()
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(h.Int(), 10)))
+}
+
+// conditional returns whether r is a conditional write, which must be
+// applied in one batch as the first batch changes the graph.
+func conditional(r *http.Request) bool {
+	m := r.Header.Get("If-Match")
+	return m != "" && m != "*"
+}
+
+// writerForRequest returns qw, or a view of it that fails with
+// graph.ErrConflict unless the graph is still at the version given by the
+// If-Match header, and that uses the options given by the "sync",
+// "ignore_duplicate" and "ignore_missing" query parameters in place of the
+// configured ones.
+func writerForRequest(qw graph.QuadWriter, r *http.Request) (graph.QuadWriter, error) {
+	if conditional(r) {
+		cw, ok := qw.(graph.ConditionalWriter)
+		if !ok {
+			return nil, errNoCondition
+		}
+		horizon, err := strconv.ParseInt(strings.Trim(r.Header.Get("If-Match"), `"`), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		qw = cw.WithExpectedHorizon(horizon)
+	}
+	query := r.URL.Query()
+	if name := query.Get("sync"); name != "" {
+		policy, err := graph.ParseSyncPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		sw, ok := qw.(graph.SyncingWriter)
+		if !ok {
+			return nil, errNoSync
+		}
+		qw = sw.WithSync(policy)
+	}
+	dup, missing := query.Get("ignore_duplicate"), query.Get("ignore_missing")
+	if dup == "" && missing == "" {
+		return qw, nil
+	}
+	iw, ok := qw.(graph.IgnoringWriter)
+	if !ok {
+		return nil, errNoIgnore
+	}
+	opts := iw.IgnoreOpts()
+	var err error
+	if dup != "" {
+		opts.IgnoreDup, err = strconv.ParseBool(dup)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if missing != "" {
+		opts.IgnoreMissing, err = strconv.ParseBool(missing)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return iw.WithIgnoreOpts(opts), nil
+}
+
+// writeErrorStatus returns the HTTP status for an error from a QuadWriter.
+func writeErrorStatus(err error) int {
+	switch err {
+	case graph.ErrNoExpiry:
+		return 400
+	case graph.ErrQuadExists, graph.ErrQuadNotExist:
+		return 409
+	case graph.ErrConflict:
+		return 412
+	case graph.ErrStoreFull:
+		return 507
+	}
+	return 500
+}
+
+func addQuadSet(qw graph.QuadWriter, quads []quad.Quad, expires time.Time) error {
+	if expires.IsZero() {
+		return qw.AddQuadSet(quads)
+	}
+	ew, ok := qw.(graph.ExpiringWriter)
+	if !ok {
+		return graph.ErrNoExpiry
+	}
+	return ew.AddQuadSetExpiring(quads, expires)
+}
+
 func (api *API) ServeV1Write(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
-	if api.config.ReadOnly {
+	if api.conf().ReadOnly {
 		return jsonResponse(w, 400, "Database is read-only.")
 	}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
@@ -56,31 +183,46 @@ func (api *API) ServeV1Write(w http.ResponseWriter, r *http.Request, _ httproute
 	if err != nil {
 		return jsonResponse(w, 400, err)
 	}
+	expires, err := expiryFromRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
 	h, err := api.GetHandleForRequest(r)
 	if err != nil {
 		return jsonResponse(w, 400, err)
 	}
+	qw, err := writerForRequest(h.QuadWriter, r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
 
-	h.QuadWriter.AddQuadSet(quads)
+	err = addQuadSet(qw, quads, expires)
+	if err != nil {
+		return jsonResponse(w, writeErrorStatus(err), err)
+	}
 	fmt.Fprintf(w, "{\"result\": \"Successfully wrote %d quads.\"}", len(quads))
 	return 200
 }
 
 func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
-	if api.config.ReadOnly {
+	if api.conf().ReadOnly {
 		return jsonResponse(w, 400, "Database is read-only.")
 	}
 
 	formFile, _, err := r.FormFile("NQuadFile")
 	if err != nil {
-		glog.Errorln(err)
+		clog.Errorln(err)
 		return jsonResponse(w, 500, "Couldn't read file: "+err.Error())
 	}
 	defer formFile.Close()
 
 	blockSize, blockErr := strconv.ParseInt(r.URL.Query().Get("block_size"), 10, 64)
 	if blockErr != nil {
-		blockSize = int64(api.config.LoadSize)
+		blockSize = int64(api.conf().LoadSize)
+	}
+	expires, err := expiryFromRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
 	}
 
 	quadReader, err := internal.Decompressor(formFile)
@@ -91,6 +233,10 @@ func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params
 	if err != nil {
 		return jsonResponse(w, 400, err)
 	}
+	qw, err := writerForRequest(h.QuadWriter, r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
 
 	var (
 		n     int
@@ -102,43 +248,243 @@ func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params
 			if err == io.EOF {
 				break
 			}
-			glog.Fatalln("what can do this here?", err) // FIXME(kortschak)
+			clog.Fatalln("what can do this here?", err) // FIXME(kortschak)
 		}
 		block = append(block, t)
 		n++
-		if len(block) == cap(block) {
-			h.QuadWriter.AddQuadSet(block)
+		if len(block) == cap(block) && !conditional(r) {
+			err := addQuadSet(qw, block, expires)
+			if err != nil {
+				return jsonResponse(w, writeErrorStatus(err), err)
+			}
 			block = block[:0]
 		}
 	}
-	h.QuadWriter.AddQuadSet(block)
+	err = addQuadSet(qw, block, expires)
+	if err != nil {
+		return jsonResponse(w, writeErrorStatus(err), err)
+	}
 
 	fmt.Fprintf(w, "{\"result\": \"Successfully wrote %d quads.\"}", n)
 
 	return 200
 }
 
+// mediaFormats are the quad formats of the bodies of these media types.
+// N-Quads are read as the files of /api/v1/write/file/nquad are.
+var mediaFormats = map[string]string{
+	"application/n-quads":   "cquad",
+	"application/n-triples": "cquad",
+	"text/turtle":           "turtle",
+}
+
+// quadsForRequest returns the quads of the body of a request, in the format
+// named by its "format" parameter or by its content type, or else as a JSON
+// array.
+func quadsForRequest(r *http.Request) ([]quad.Quad, error) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		name = mediaFormats[mt]
+	}
+	if name == "" || name == "json" {
+		bodyBytes, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ParseJSONToQuadList(bodyBytes)
+	}
+	f := quad.FormatByName(name)
+	if f == nil || f.Reader == nil {
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+	qr, err := internal.Decompressor(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	dec := f.Reader(qr)
+	var quads []quad.Quad
+	for {
+		q, err := dec.Unmarshal()
+		if err == io.EOF {
+			return quads, nil
+		} else if err != nil {
+			return nil, err
+		}
+		quads = append(quads, q)
+	}
+}
+
 func (api *API) ServeV1Delete(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
-	if api.config.ReadOnly {
+	if api.conf().ReadOnly {
 		return jsonResponse(w, 400, "Database is read-only.")
 	}
-	bodyBytes, err := ioutil.ReadAll(r.Body)
+	quads, err := quadsForRequest(r)
 	if err != nil {
 		return jsonResponse(w, 400, err)
 	}
-	quads, err := ParseJSONToQuadList(bodyBytes)
+	h, err := api.GetHandleForRequest(r)
 	if err != nil {
 		return jsonResponse(w, 400, err)
 	}
-	h, err := api.GetHandleForRequest(r)
+	qw, err := writerForRequest(h.QuadWriter, r)
 	if err != nil {
 		return jsonResponse(w, 400, err)
 	}
+	if conditional(r) {
+		t := graph.NewTransaction()
+		for _, q := range quads {
+			t.RemoveQuad(q)
+		}
+		err := qw.ApplyTransaction(t)
+		if err != nil {
+			return jsonResponse(w, writeErrorStatus(err), err)
+		}
+		fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d quads.\"}", len(quads))
+		return 200
+	}
 	count := 0
 	for _, q := range quads {
-		h.QuadWriter.RemoveQuad(q)
+		err := qw.RemoveQuad(q)
+		if err != nil {
+			return jsonResponse(w, writeErrorStatus(err), err)
+		}
 		count++
 	}
 	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d quads.\"}", count)
 	return 200
 }
+
+func (api *API) ServeV1DeleteMatching(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	if api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	var pattern quad.Quad
+	err = json.Unmarshal(bodyBytes, &pattern)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	if pattern == (quad.Quad{}) {
+		return jsonResponse(w, 400, "Pattern must have at least one field.")
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	qw, err := writerForRequest(h.QuadWriter, r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	count, err := qw.DeleteQuadsMatching(pattern)
+	if err != nil {
+		return jsonResponse(w, writeErrorStatus(err), err)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d quads.\"}", count)
+	return 200
+}
+
+// ServeV1DeleteByQuery deletes the quads matched by the query of the body:
+// those its results were reached through, or with the "mode" "nodes", every
+// quad of the nodes it returned. They are deleted in transactions of
+// "block_size" quads, or in one if the request is conditional, unless
+// "dry_run" is set, in which case they are only counted.
+func (api *API) ServeV1DeleteByQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if !dryRun && api.conf().ReadOnly {
+		return jsonResponse(w, 400, "Database is read-only.")
+	}
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = "quads"
+	case "quads", "nodes":
+	default:
+		return jsonResponse(w, 400, fmt.Sprintf("Unknown mode %q.", mode))
+	}
+	blockSize, err := strconv.Atoi(r.URL.Query().Get("block_size"))
+	if err != nil || blockSize <= 0 {
+		blockSize = api.conf().LoadSize
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	opts, err := api.optionsForRequest(r, params)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	qs := storeForRequest(graph.Snapshot(h.QuadStore), r)
+	var ses query.HTTP
+	switch opts.lang {
+	case "gremlin":
+		ses = gremlin.NewSession(qs, opts.timeout, false)
+	case "mql":
+		ses = mql.NewSession(qs)
+	default:
+		return jsonResponse(w, 400, "Need a query language.")
+	}
+	if mode == "quads" {
+		sg, ok := ses.(query.Subgrapher)
+		if !ok {
+			return jsonResponse(w, 400, "Query language cannot return subgraphs.")
+		}
+		sg.Subgraph(true)
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	code := string(bodyBytes)
+	if result, err := ses.Parse(code); result == query.ParseMore {
+		return jsonResponse(w, 400, "Incomplete query.")
+	} else if result != query.Parsed {
+		return jsonResponse(w, 400, err)
+	}
+	output, err := runLimit(code, ses, opts.limit)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	var quads []quad.Quad
+	if mode == "quads" {
+		quads = output.([]quad.Quad)
+	} else {
+		rows, ok := tagMaps(output)
+		if !ok {
+			return jsonResponse(w, 400, "Query results are not tags.")
+		}
+		var nodes []string
+		for _, row := range rows {
+			if id, ok := row["id"]; ok {
+				nodes = append(nodes, id)
+			}
+		}
+		quads, err = graph.QuadsTouching(qs, nodes)
+		if err != nil {
+			return jsonResponse(w, 500, err)
+		}
+	}
+	if dryRun {
+		fmt.Fprintf(w, "{\"result\": \"Query matches %d quads.\", \"count\": %d}", len(quads), len(quads))
+		return 200
+	}
+	qw, err := writerForRequest(h.QuadWriter, r)
+	if err != nil {
+		return jsonResponse(w, 400, err)
+	}
+	if conditional(r) && len(quads) > 0 {
+		// The expected horizon only holds for the first transaction.
+		blockSize = len(quads)
+	}
+	n, err := graph.DeleteQuads(qw, quads, blockSize, func(n int) {
+		clog.V(2).Infof("Deleting by query: deleted %d of %d quads", n, len(quads))
+	})
+	if err != nil {
+		return jsonResponse(w, writeErrorStatus(err), fmt.Sprintf("Deleted %d quads before failing: %v", n, err))
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d quads.\", \"count\": %d}", n, n)
+	return 200
+}
@@ -0,0 +1,240 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+func TestConditionalWrite(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer qw.Close()
+	api := &API{
+		config: &config.Config{ReplicationType: "single"},
+		handle: &graph.Handle{QuadStore: qs, QuadWriter: qw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/labels")
+	if err != nil {
+		t.Fatalf("Could not read labels: %v", err)
+	}
+	resp.Body.Close()
+	version := resp.Header.Get("ETag")
+	if version == "" {
+		t.Fatalf("Read returned no version")
+	}
+
+	write := func(body string) int {
+		req, _ := http.NewRequest("POST", server.URL+"/api/v1/write", strings.NewReader(body))
+		req.Header.Set("If-Match", version)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not write: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := write(`[{"subject":"A","predicate":"follows","object":"B"}]`); code != 200 {
+		t.Errorf("Unexpected status writing at the read version, got:%d expect:200", code)
+	}
+	if code := write(`[{"subject":"B","predicate":"follows","object":"C"}]`); code != 412 {
+		t.Errorf("Unexpected status writing at a stale version, got:%d expect:412", code)
+	}
+	if n := qs.Size(); n != 1 {
+		t.Errorf("Unexpected size after conflicting write, got:%d expect:1", n)
+	}
+}
+
+func TestDeleteByQuery(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer qw.Close()
+	qw.AddQuadSet([]quad.Quad{
+		{Subject: "A", Predicate: "follows", Object: "B"},
+		{Subject: "A", Predicate: "name", Object: "a"},
+		{Subject: "B", Predicate: "follows", Object: "C"},
+		{Subject: "D", Predicate: "follows", Object: "C"},
+	})
+	api := &API{
+		config: &config.Config{Timeout: -1, LoadSize: 100},
+		handle: &graph.Handle{QuadStore: qs, QuadWriter: qw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, test := range []struct {
+		path   string
+		body   string
+		status int
+		count  int
+		size   int64
+	}{
+		{path: "?lang=mql&dry_run=true", body: `[{"id": null, "follows": "C"}]`, status: 200, count: 2, size: 4},
+		{path: "?lang=gremlin&mode=nodes", body: `g.V().Has("name", "a").All()`, status: 200, count: 2, size: 2},
+		{path: "?lang=mql&block_size=1", body: `[{"id": null, "follows": "C"}]`, status: 200, count: 2, size: 0},
+		{path: "?lang=mql&mode=nodes", body: `[{"id": null}]`, status: 400, size: 0},
+		{path: "?lang=mql&mode=all", body: `[{"id": null}]`, status: 400, size: 0},
+	} {
+		resp, err := http.Post(server.URL+"/api/v1/delete/query"+test.path, "text/plain", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("Could not delete by query %s: %v", test.path, err)
+		}
+		var out struct {
+			Count int
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("Unexpected status of %s, got:%d expect:%d", test.path, resp.StatusCode, test.status)
+		} else if out.Count != test.count {
+			t.Errorf("Unexpected count of %s, got:%d expect:%d", test.path, out.Count, test.count)
+		}
+		if n := qs.Size(); n != test.size {
+			t.Errorf("Unexpected size after %s, got:%d expect:%d", test.path, n, test.size)
+		}
+	}
+}
+
+func TestDeleteFormats(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer qw.Close()
+	qw.AddQuadSet([]quad.Quad{
+		{Subject: "http://example.org/a", Predicate: "http://example.org/follows", Object: "http://example.org/b"},
+		{Subject: "http://example.org/b", Predicate: "http://example.org/follows", Object: "http://example.org/c"},
+		{Subject: "A", Predicate: "follows", Object: "B"},
+	})
+	api := &API{
+		config: &config.Config{ReplicationType: "single"},
+		handle: &graph.Handle{QuadStore: qs, QuadWriter: qw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, test := range []struct {
+		path        string
+		contentType string
+		body        string
+		status      int
+		size        int64
+	}{
+		{
+			contentType: "application/n-quads",
+			body:        "<http://example.org/a> <http://example.org/follows> <http://example.org/b> .\n",
+			status:      200,
+			size:        2,
+		},
+		{
+			contentType: "text/turtle; charset=utf-8",
+			body:        "@prefix ex: <http://example.org/> .\nex:b ex:follows ex:c .\n",
+			status:      200,
+			size:        1,
+		},
+		{
+			path:        "?format=bogus",
+			contentType: "text/plain",
+			body:        "A follows B .\n",
+			status:      400,
+			size:        1,
+		},
+		{
+			path:        "?format=json",
+			contentType: "application/n-quads",
+			body:        `[{"subject":"A","predicate":"follows","object":"B"}]`,
+			status:      200,
+			size:        0,
+		},
+	} {
+		resp, err := http.Post(server.URL+"/api/v1/delete"+test.path, test.contentType, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("Could not delete %s: %v", test.contentType, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("Unexpected status deleting %s%s, got:%d expect:%d", test.contentType, test.path, resp.StatusCode, test.status)
+		}
+		if n := qs.Size(); n != test.size {
+			t.Errorf("Unexpected size after deleting %s%s, got:%d expect:%d", test.contentType, test.path, n, test.size)
+		}
+	}
+}
+
+// plainStore hides the optional interfaces of a QuadStore, such as
+// graph.Expirer.
+type plainStore struct {
+	graph.QuadStore
+}
+
+func TestWriteExpiryUnsupported(t *testing.T) {
+	mem, _ := graph.NewQuadStore("memstore", "", nil)
+	qs := plainStore{mem}
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer qw.Close()
+	api := &API{
+		config: &config.Config{ReplicationType: "single"},
+		handle: &graph.Handle{QuadStore: qs, QuadWriter: qw},
+	}
+	r := httprouter.New()
+	api.APIv1(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	body := `[{"subject":"A","predicate":"follows","object":"B"}]`
+	resp, err := http.Post(server.URL+"/api/v1/write?ttl=1h", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not write: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("Unexpected status writing with a ttl, got:%d expect:400", resp.StatusCode)
+	}
+	if n := qs.Size(); n != 0 {
+		t.Errorf("Unexpected size after refused write, got:%d expect:0", n)
+	}
+}
@@ -1,6 +1,8 @@
 package cayley
 
 import (
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/db"
 	"github.com/google/cayley/graph"
 	_ "github.com/google/cayley/graph/memstore"
 	"github.com/google/cayley/graph/path"
@@ -19,6 +21,8 @@ var StartPath = path.StartPath
 
 var RawNext = graph.Next
 
+var NewTransaction = graph.NewTransaction
+
 type Handle struct {
 	graph.QuadStore
 	graph.QuadWriter
@@ -40,6 +44,14 @@ func NewMemoryGraph() (*Handle, error) {
 	return &Handle{qs, qw}, nil
 }
 
+// Query runs a query in the given language, "gremlin" or "mql", against the
+// graph, and returns its results. Queries may run from several goroutines at
+// once, alongside writes, without locking the handle.
+func (h *Handle) Query(lang, code string) (interface{}, error) {
+	gh := &graph.Handle{QuadStore: h.QuadStore, QuadWriter: h.QuadWriter}
+	return db.Query(gh, lang, code, &config.Config{Timeout: -1})
+}
+
 func (h *Handle) Close() {
 	h.QuadStore.Close()
 	h.QuadWriter.Close()
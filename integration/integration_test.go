@@ -530,7 +530,7 @@ func checkQueries(t *testing.T) {
 			t.Fatalf("Failed to parse benchmark gremlin %s: %v", test.message, err)
 		}
 		c := make(chan interface{}, 5)
-		go ses.Execute(test.query, c, 100)
+		go ses.Execute(test.query, c, -1)
 		var (
 			got      []interface{}
 			timedOut bool
@@ -597,7 +597,7 @@ func runBench(n int, b *testing.B) {
 		// Do the parsing we know works.
 		ses.Parse(benchmarkQueries[n].query)
 		b.StartTimer()
-		go ses.Execute(benchmarkQueries[n].query, c, 100)
+		go ses.Execute(benchmarkQueries[n].query, c, -1)
 		for _ = range c {
 		}
 		b.StopTimer()
@@ -0,0 +1,184 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth decides which endpoints of the HTTP and gRPC APIs a client may
+// use, from the role the credentials it presents are granted by the
+// configuration.
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/config"
+)
+
+// Role is what a client may do. Each role may do what the ones before it
+// may.
+type Role int
+
+const (
+	// None may do nothing.
+	None Role = iota
+
+	// Read may run queries, and read and watch the quads.
+	Read
+
+	// Write may also add and delete quads.
+	Write
+
+	// Admin may also use the administration endpoints, such as backups,
+	// renames and reloads.
+	Admin
+)
+
+var roleNames = []string{"none", "read", "write", "admin"}
+
+func (r Role) String() string {
+	if r < None || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// Can returns whether a client of role r may do what one of role o may.
+func (r Role) Can(o Role) bool {
+	return r >= o
+}
+
+// ParseRole returns the role of the given name. The empty name is None.
+func ParseRole(name string) (Role, error) {
+	if name == "" {
+		return None, nil
+	}
+	for i, n := range roleNames {
+		if n == name {
+			return Role(i), nil
+		}
+	}
+	return None, fmt.Errorf("auth: unknown role %q", name)
+}
+
+// ErrUnknownCredentials is returned for credentials that grant no role, or
+// that cannot be parsed.
+var ErrUnknownCredentials = errors.New("auth: unknown credentials")
+
+type credential struct {
+	token, user, password []byte
+	role                  Role
+}
+
+// Authorizer grants roles to the credentials of the configuration, and to
+// the JWTs of its issuer, if it has one.
+type Authorizer struct {
+	creds     []credential
+	jwt       *jwtVerifier
+	anonymous Role
+}
+
+// New returns the Authorizer of the credentials of cfg, or an error if one
+// of them names an unknown role, or neither a token nor a user, or if the
+// JWT options are invalid. The keys of the JWT issuer are only fetched once
+// a token is given.
+func New(cfg *config.Config) (*Authorizer, error) {
+	a := &Authorizer{}
+	for i, c := range cfg.Credentials {
+		role, err := ParseRole(c.Role)
+		if err != nil {
+			return nil, err
+		}
+		if (c.Token == "") == (c.User == "") {
+			return nil, fmt.Errorf("auth: credential %d must have either a token or a user", i)
+		}
+		a.creds = append(a.creds, credential{
+			token:    []byte(c.Token),
+			user:     []byte(c.User),
+			password: []byte(c.Password),
+			role:     role,
+		})
+	}
+	var err error
+	if cfg.JWTIssuer != "" {
+		if a.jwt, err = newJWTVerifier(cfg); err != nil {
+			return nil, err
+		}
+	}
+	a.anonymous, err = ParseRole(cfg.AnonymousRole)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Enabled returns whether any credentials or a JWT issuer are configured. If
+// not, every client is an Admin, as no client can identify itself.
+func (a *Authorizer) Enabled() bool {
+	return a != nil && (len(a.creds) > 0 || a.jwt != nil)
+}
+
+// RoleOf returns the role granted by the value of an Authorization header:
+// a bearer token, or a user name and password for basic authentication.
+// Bearer tokens that are not configured credentials are validated as JWTs, if
+// a JWT issuer is configured. Clients that give none have the anonymous role
+// of the configuration.
+func (a *Authorizer) RoleOf(authorization string) (Role, error) {
+	if !a.Enabled() {
+		return Admin, nil
+	}
+	if authorization == "" {
+		return a.anonymous, nil
+	}
+	i := strings.IndexByte(authorization, ' ')
+	if i < 0 {
+		return None, ErrUnknownCredentials
+	}
+	scheme, value := authorization[:i], strings.TrimSpace(authorization[i+1:])
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		for _, c := range a.creds {
+			if len(c.token) > 0 && subtle.ConstantTimeCompare(c.token, []byte(value)) == 1 {
+				return c.role, nil
+			}
+		}
+		if a.jwt != nil {
+			return a.jwt.verify(value)
+		}
+	case strings.EqualFold(scheme, "Basic"):
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return None, ErrUnknownCredentials
+		}
+		j := strings.IndexByte(string(b), ':')
+		if j < 0 {
+			return None, ErrUnknownCredentials
+		}
+		user, password := b[:j], b[j+1:]
+		for _, c := range a.creds {
+			if len(c.user) == 0 {
+				continue
+			}
+			// Compare both, so that the time taken does not tell
+			// whether the user exists.
+			u := subtle.ConstantTimeCompare(c.user, user)
+			p := subtle.ConstantTimeCompare(c.password, password)
+			if u&p == 1 {
+				return c.role, nil
+			}
+		}
+	}
+	return None, ErrUnknownCredentials
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/cayley/config"
+)
+
+func basic(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestRoleOf(t *testing.T) {
+	a, err := New(&config.Config{
+		Credentials: []config.Credential{
+			{Token: "reader", Role: "read"},
+			{Token: "writer", Role: "write"},
+			{User: "root", Password: "hunter2", Role: "admin"},
+		},
+		AnonymousRole: "read",
+	})
+	if err != nil {
+		t.Fatalf("Could not create authorizer: %v", err)
+	}
+	for _, test := range []struct {
+		authorization string
+		expect        Role
+		err           error
+	}{
+		{"", Read, nil},
+		{"Bearer reader", Read, nil},
+		{"bearer writer", Write, nil},
+		{basic("root", "hunter2"), Admin, nil},
+		{basic("root", "wrong"), None, ErrUnknownCredentials},
+		{basic("reader", ""), None, ErrUnknownCredentials},
+		{"Bearer unknown", None, ErrUnknownCredentials},
+		{"Basic !!!", None, ErrUnknownCredentials},
+		{"writer", None, ErrUnknownCredentials},
+	} {
+		got, err := a.RoleOf(test.authorization)
+		if got != test.expect || err != test.err {
+			t.Errorf("Unexpected role of %q, got:%v,%v expect:%v,%v", test.authorization, got, err, test.expect, test.err)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	a, err := New(&config.Config{AnonymousRole: "read"})
+	if err != nil {
+		t.Fatalf("Could not create authorizer: %v", err)
+	}
+	if a.Enabled() {
+		t.Error("Authorizer without credentials is enabled")
+	}
+	if got, err := a.RoleOf("Bearer anything"); got != Admin || err != nil {
+		t.Errorf("Unexpected role without credentials, got:%v,%v expect:admin", got, err)
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	for _, cfg := range []config.Config{
+		{Credentials: []config.Credential{{Token: "t", Role: "root"}}},
+		{Credentials: []config.Credential{{Role: "read"}}},
+		{Credentials: []config.Credential{{Token: "t", User: "u", Role: "read"}}},
+		{AnonymousRole: "guest"},
+	} {
+		if _, err := New(&cfg); err == nil {
+			t.Errorf("Expected error for configuration %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cayley/config"
+)
+
+var (
+	// ErrInvalidToken is returned for bearer JWTs that are malformed, or
+	// whose signature cannot be verified.
+	ErrInvalidToken = errors.New("auth: invalid token")
+
+	// ErrExpiredToken is returned for bearer JWTs that have expired, or
+	// are not valid yet.
+	ErrExpiredToken = errors.New("auth: expired token")
+)
+
+const (
+	// DefaultRoleClaim is the claim of JWTs mapped to roles, if the
+	// configuration names none.
+	DefaultRoleClaim = "roles"
+
+	// jwtLeeway is how far the clock of the issuer may be from ours.
+	jwtLeeway = time.Minute
+
+	// jwksRefresh is how long to wait after fetching the keys of the
+	// issuer before fetching them again for a token signed by an unknown
+	// key, as they are rotated.
+	jwksRefresh = time.Minute
+)
+
+// jwtVerifier validates bearer JWTs signed by the keys an OpenID Connect
+// issuer publishes, and grants the roles their claims are mapped to.
+type jwtVerifier struct {
+	issuer   string
+	audience string
+	claim    []string
+
+	// roles maps the values of the claim to roles. If it is empty, the
+	// values are the names of the roles.
+	roles map[string]Role
+
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	keysURL string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newJWTVerifier(cfg *config.Config) (*jwtVerifier, error) {
+	if cfg.JWTAudience == "" {
+		return nil, errors.New("auth: jwt_issuer needs a jwt_audience")
+	}
+	v := &jwtVerifier{
+		issuer:   cfg.JWTIssuer,
+		audience: cfg.JWTAudience,
+		claim:    strings.Split(DefaultRoleClaim, "."),
+		roles:    make(map[string]Role),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+		keysURL:  cfg.JWTKeysURL,
+	}
+	if cfg.JWTRoleClaim != "" {
+		v.claim = strings.Split(cfg.JWTRoleClaim, ".")
+	}
+	for value, name := range cfg.JWTRoles {
+		s, _ := name.(string)
+		role, err := ParseRole(s)
+		if err != nil || role == None {
+			return nil, fmt.Errorf("auth: invalid role %v for claim value %q", name, value)
+		}
+		v.roles[value] = role
+	}
+	return v, nil
+}
+
+// jwtAlgs are the hashes of the signing algorithms of JWTs we verify. Others,
+// such as the HMAC ones, which need a shared secret, and "none", are refused.
+var jwtAlgs = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// verify returns the role granted by a JWT, once its signature, issuer,
+// audience and time of validity are checked.
+func (v *jwtVerifier) verify(token string) (Role, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return None, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return None, ErrInvalidToken
+	}
+	hash, ok := jwtAlgs[header.Alg]
+	if !ok {
+		return None, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return None, ErrInvalidToken
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return None, err
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, hash, h.Sum(nil), sig) {
+		return None, ErrInvalidToken
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return None, ErrInvalidToken
+	}
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return None, ErrInvalidToken
+	}
+	if !hasAudience(claims["aud"], v.audience) {
+		return None, ErrInvalidToken
+	}
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return None, ErrInvalidToken
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return None, ErrExpiredToken
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return None, ErrExpiredToken
+	}
+	return v.roleOf(claims), nil
+}
+
+// roleOf returns the highest role the values of the role claim are mapped to.
+// The claim may be nested in objects, named by a path such as
+// "realm_access.roles", and may be a list of strings, or a string of values
+// separated by spaces, as scopes are.
+func (v *jwtVerifier) roleOf(claims map[string]interface{}) Role {
+	var c interface{} = claims
+	for _, name := range v.claim {
+		m, ok := c.(map[string]interface{})
+		if !ok {
+			return None
+		}
+		c = m[name]
+	}
+	var values []string
+	switch c := c.(type) {
+	case string:
+		values = strings.Fields(c)
+	case []interface{}:
+		for _, s := range c {
+			if s, ok := s.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	role := None
+	for _, s := range values {
+		r, ok := v.roles[s]
+		if len(v.roles) == 0 {
+			r, _ = ParseRole(s)
+		} else if !ok {
+			continue
+		}
+		if r > role {
+			role = r
+		}
+	}
+	return role
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+// key returns the public key of the given ID, fetching the keys of the issuer
+// if it is not known.
+func (v *jwtVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if v.keys != nil && v.now().Sub(v.fetched) < jwksRefresh {
+		return nil, ErrInvalidToken
+	}
+	keys, err := v.fetchKeys()
+	if err != nil {
+		return nil, fmt.Errorf("auth: could not fetch the keys of %s: %v", v.issuer, err)
+	}
+	v.keys, v.fetched = keys, v.now()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+// fetchKeys fetches the JSON Web Key Set of the issuer, from the configured
+// URL, or else from the one its OpenID Connect discovery document gives.
+func (v *jwtVerifier) fetchKeys() (map[string]crypto.PublicKey, error) {
+	if v.keysURL == "" {
+		var doc struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		err := v.getJSON(strings.TrimSuffix(v.issuer, "/")+"/.well-known/openid-configuration", &doc)
+		if err != nil {
+			return nil, err
+		}
+		if doc.JWKSURI == "" {
+			return nil, errors.New("discovery document has no jwks_uri")
+		}
+		v.keysURL = doc.JWKSURI
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(v.keysURL, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of types and curves we do not know are skipped, as
+		// tokens are not signed with them.
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (v *jwtVerifier) getJSON(url string, out interface{}) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jwk is a public key of a JSON Web Key Set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unknown key type %q", k.Kty)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
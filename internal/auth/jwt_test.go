@@ -0,0 +1,171 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/config"
+)
+
+// issuer serves the discovery document and the keys of an OpenID Connect
+// issuer, and signs tokens with them.
+type issuer struct {
+	*httptest.Server
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	rsaKid  string
+	fetches int
+}
+
+func newIssuer(t *testing.T) *issuer {
+	iss := &issuer{rsaKid: "rsa1"}
+	var err error
+	if iss.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatalf("Could not generate RSA key: %v", err)
+	}
+	if iss.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatalf("Could not generate EC key: %v", err)
+	}
+	enc := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": iss.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": iss.rsaKid, "use": "sig", "n": enc(iss.rsa.N.Bytes()), "e": enc(big.NewInt(int64(iss.rsa.E)).Bytes())},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": enc(iss.ec.X.Bytes()), "y": enc(iss.ec.Y.Bytes())},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		}})
+	})
+	iss.Server = httptest.NewServer(mux)
+	return iss
+}
+
+func (iss *issuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	enc := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	data := enc(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + enc(claims)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(data))
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsa, crypto.SHA256, digest.Sum(nil)); err != nil {
+			t.Fatalf("Could not sign token: %v", err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, iss.ec, digest.Sum(nil))
+		if err != nil {
+			t.Fatalf("Could not sign token: %v", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return data + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWT(t *testing.T) {
+	iss := newIssuer(t)
+	defer iss.Close()
+	a, err := New(&config.Config{
+		JWTIssuer:    iss.URL,
+		JWTAudience:  "cayley",
+		JWTRoleClaim: "realm_access.roles",
+		JWTRoles:     map[string]interface{}{"analyst": "read", "editor": "write", "ops": "admin"},
+	})
+	if err != nil {
+		t.Fatalf("Could not create authorizer: %v", err)
+	}
+	now := time.Unix(1500000000, 0)
+	a.jwt.now = func() time.Time { return now }
+	claims := func(aud interface{}, exp time.Time, roles ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":          iss.URL,
+			"aud":          aud,
+			"exp":          exp.Unix(),
+			"realm_access": map[string]interface{}{"roles": roles},
+		}
+	}
+	valid := now.Add(time.Hour)
+	wrongIssuer := claims("cayley", valid, "ops")
+	wrongIssuer["iss"] = "https://elsewhere"
+	for _, test := range []struct {
+		name   string
+		token  string
+		expect Role
+		err    error
+	}{
+		{"rsa", iss.sign(t, "RS256", "rsa1", claims("cayley", valid, "analyst")), Read, nil},
+		{"ec", iss.sign(t, "ES256", "ec1", claims([]string{"other", "cayley"}, valid, "analyst", "editor")), Write, nil},
+		{"unmapped", iss.sign(t, "RS256", "rsa1", claims("cayley", valid, "guest")), None, nil},
+		{"audience", iss.sign(t, "RS256", "rsa1", claims("other", valid, "ops")), None, ErrInvalidToken},
+		{"issuer", iss.sign(t, "RS256", "rsa1", wrongIssuer), None, ErrInvalidToken},
+		{"expired", iss.sign(t, "RS256", "rsa1", claims("cayley", now.Add(-time.Hour), "ops")), None, ErrExpiredToken},
+		{"key", iss.sign(t, "RS256", "ec1", claims("cayley", valid, "ops")), None, ErrInvalidToken},
+		{"none", iss.sign(t, "none", "rsa1", claims("cayley", valid, "ops")), None, ErrInvalidToken},
+		{"malformed", "not.a.token", None, ErrInvalidToken},
+	} {
+		got, err := a.RoleOf("Bearer " + test.token)
+		if got != test.expect || err != test.err {
+			t.Errorf("Unexpected role of %s token, got:%v,%v expect:%v,%v", test.name, got, err, test.expect, test.err)
+		}
+	}
+	if iss.fetches != 1 {
+		t.Errorf("Unexpected fetches of the keys, got:%d expect:1", iss.fetches)
+	}
+
+	// Rotated keys are fetched again, but not more than once a refresh.
+	iss.rsaKid = "rsa2"
+	token := iss.sign(t, "RS256", "rsa2", claims("cayley", valid, "ops"))
+	if got, err := a.RoleOf("Bearer " + token); got != None || err != ErrInvalidToken {
+		t.Errorf("Unexpected role of token of a rotated key before the refresh, got:%v,%v", got, err)
+	}
+	now = now.Add(jwksRefresh)
+	if got, err := a.RoleOf("Bearer " + token); got != Admin || err != nil {
+		t.Errorf("Unexpected role of token of a rotated key, got:%v,%v expect:admin", got, err)
+	}
+	if iss.fetches != 2 {
+		t.Errorf("Unexpected fetches of the keys, got:%d expect:2", iss.fetches)
+	}
+}
+
+func TestInvalidJWTConfig(t *testing.T) {
+	for _, cfg := range []config.Config{
+		{JWTIssuer: "https://issuer"},
+		{JWTIssuer: "https://issuer", JWTAudience: "cayley", JWTRoles: map[string]interface{}{"ops": "root"}},
+	} {
+		if _, err := New(&cfg); err == nil {
+			t.Errorf("Expected error for configuration %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bloom implements the Bloom filters that the key-value backends keep
+// over their indexes, to answer that a node is in none of the quads of an
+// index without reading it.
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Filter is a Bloom filter over byte strings, safe for concurrent use. It
+// never answers that a key added to it is missing, and wrongly answers that
+// a missing key may be present at a rate that grows as keys are added.
+// Keys cannot be removed.
+type Filter struct {
+	mu     sync.RWMutex
+	bits   []uint64
+	hashes uint32
+}
+
+// New returns a filter sized for n keys with the given false positive rate.
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := math.Ceil(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		hashes: uint32(k),
+	}
+}
+
+// locations returns the two hashes that the positions of a key's bits are
+// derived from.
+func locations(key []byte) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write(key)
+	var b [8]byte
+	sum := h.Sum(b[:0])
+	return binary.BigEndian.Uint32(sum[:4]), binary.BigEndian.Uint32(sum[4:])
+}
+
+// Add adds a key to the filter.
+func (f *Filter) Add(key []byte) {
+	a, b := locations(key)
+	n := uint64(len(f.bits)) * 64
+	f.mu.Lock()
+	for i := uint32(0); i < f.hashes; i++ {
+		bit := uint64(a+i*b) % n
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.mu.Unlock()
+}
+
+// MayContain returns whether the key may have been added to the filter. If
+// it returns false, the key certainly was not.
+func (f *Filter) MayContain(key []byte) bool {
+	a, b := locations(key)
+	n := uint64(len(f.bits)) * 64
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i := uint32(0); i < f.hashes; i++ {
+		bit := uint64(a+i*b) % n
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Scalable is a Bloom filter, safe for concurrent use, that grows as keys are
+// added, for when their number is not known in advance. Each time its last
+// filter holds as many keys as it was sized for, it adds one sized for twice
+// as many, with half the false positive rate, so that its rate stays under
+// the one it was made with.
+type Scalable struct {
+	mu      sync.RWMutex
+	filters []*Filter
+	n       int     // the keys the last filter is sized for
+	added   int     // the keys added to the last filter
+	p       float64 // the false positive rate of the last filter
+}
+
+// NewScalable returns a filter sized at first for n keys, with the given
+// false positive rate.
+func NewScalable(n int, p float64) *Scalable {
+	if n < 1 {
+		n = 1
+	}
+	return &Scalable{filters: []*Filter{New(n, p/2)}, n: n, p: p / 2}
+}
+
+// Add adds a key to the filter.
+func (s *Scalable) Add(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.added >= s.n {
+		s.n *= 2
+		s.p /= 2
+		s.added = 0
+		s.filters = append(s.filters, New(s.n, s.p))
+	}
+	s.filters[len(s.filters)-1].Add(key)
+	s.added++
+}
+
+// MayContain returns whether the key may have been added to the filter. If
+// it returns false, the key certainly was not.
+func (s *Scalable) MayContain(key []byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, f := range s.filters {
+		if f.MayContain(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add([]byte(fmt.Sprint("in", i)))
+	}
+	for i := 0; i < n; i++ {
+		if !f.MayContain([]byte(fmt.Sprint("in", i))) {
+			t.Fatalf("Filter lost key %q", fmt.Sprint("in", i))
+		}
+	}
+	var wrong int
+	for i := 0; i < n; i++ {
+		if f.MayContain([]byte(fmt.Sprint("out", i))) {
+			wrong++
+		}
+	}
+	if rate := float64(wrong) / n; rate > 0.03 {
+		t.Errorf("Unexpected false positive rate: got %v, expected about 0.01", rate)
+	}
+}
+
+func TestScalable(t *testing.T) {
+	const n = 10000
+	f := NewScalable(10, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add([]byte(fmt.Sprint("in", i)))
+	}
+	for i := 0; i < n; i++ {
+		if !f.MayContain([]byte(fmt.Sprint("in", i))) {
+			t.Fatalf("Filter lost key %q", fmt.Sprint("in", i))
+		}
+	}
+	var wrong int
+	for i := 0; i < n; i++ {
+		if f.MayContain([]byte(fmt.Sprint("out", i))) {
+			wrong++
+		}
+	}
+	if rate := float64(wrong) / n; rate > 0.03 {
+		t.Errorf("Unexpected false positive rate: got %v, expected under 0.01", rate)
+	}
+}
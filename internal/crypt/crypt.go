@@ -0,0 +1,115 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crypt encrypts the values stored by the embedded key-value
+// backends with AES-GCM.
+//
+// Only values are encrypted. Keys are left as they are so that the stores can
+// still seek and scan them; for the node and quad indexes they are hashes of
+// the node names.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/cayley/graph"
+)
+
+var ErrDecrypt = errors.New("crypt: could not decrypt value; wrong key or unencrypted database")
+
+// ErrClearText is returned when an encrypted database is asked to keep a text
+// index, which would hold the names of its nodes in the clear.
+var ErrClearText = errors.New("crypt: an encrypted database cannot keep a text index")
+
+// Cipher seals and opens stored values. A nil *Cipher stores values in the
+// clear.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// New returns a Cipher using the given AES key, which must be 16, 24 or 32
+// bytes long.
+func New(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// FromOptions returns the Cipher for the hex encoded key given by the
+// "encryption_key" option, or held in the environment variable named by the
+// "encryption_key_env" option. It returns nil if neither option is set.
+func FromOptions(options graph.Options) (*Cipher, error) {
+	key, ok, err := options.StringKey("encryption_key")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		env, ok, err := options.StringKey("encryption_key_env")
+		if err != nil || !ok {
+			return nil, err
+		}
+		key = os.Getenv(env)
+		if key == "" {
+			return nil, fmt.Errorf("crypt: environment variable %s is not set", env)
+		}
+	}
+	b, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: invalid encryption key: %v", err)
+	}
+	return New(b)
+}
+
+// Seal returns the encryption of data, prefixed by a random nonce.
+func (c *Cipher) Seal(data []byte) []byte {
+	if c == nil {
+		return data
+	}
+	size := c.aead.NonceSize()
+	out := make([]byte, size, size+len(data)+c.aead.Overhead())
+	_, err := io.ReadFull(rand.Reader, out)
+	if err != nil {
+		panic("crypt: could not read random nonce: " + err.Error())
+	}
+	return c.aead.Seal(out, out, data, nil)
+}
+
+// Open returns the decryption of data sealed by Seal.
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrDecrypt
+	}
+	out, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return out, nil
+}
@@ -3,30 +3,78 @@ package internal
 import (
 	"fmt"
 	"io"
-	client "net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/config"
 	"github.com/google/cayley/db"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/quad"
-	"github.com/google/cayley/quad/cquads"
-	"github.com/google/cayley/quad/nquads"
 )
 
 // Load loads a graph from the given path and write it to qw.  See
 // DecompressAndLoad for more information.
+// If cfg.LoadAuthor is set, the quads record it and the path as their
+// provenance.
 func Load(qw graph.QuadWriter, cfg *config.Config, path, typ string) error {
+	if cfg.LoadAuthor != "" {
+		source := path
+		if source == "" {
+			source = cfg.DatabasePath
+		}
+		var err error
+		qw, err = db.WithProvenance(qw, graph.Provenance{Author: cfg.LoadAuthor, Source: source})
+		if err != nil {
+			return err
+		}
+	}
 	return DecompressAndLoad(qw, cfg, path, typ, db.Load)
 }
 
+// LoadAll loads the quad files the given paths name, as expanded by
+// ExpandPaths, one after another, or the database path if none are given. Each
+// file is read in the format typ, if given, or else in its own, as told by
+// FormatOf.
+func LoadAll(qw graph.QuadWriter, cfg *config.Config, paths []string, typ string) error {
+	if len(paths) == 0 {
+		if cfg.DatabasePath == "" {
+			return nil
+		}
+		paths = []string{cfg.DatabasePath}
+	}
+	files, err := ExpandPaths(paths)
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		format := typ
+		if format == "" {
+			format = FormatOf(path)
+		}
+		if len(files) > 1 {
+			clog.Infof("Loading %s as %s", path, format)
+		}
+		err := Load(qw, cfg, path, format)
+		if err != nil && len(files) > 1 {
+			return fmt.Errorf("%s: %v", path, err)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // DecompressAndLoad will load or fetch a graph from the given path, decompress
 // it, and then call the given load function to process the decompressed graph.
-// If no loadFn is provided, db.Load is called.
+// If no loadFn is provided, db.Load is called. The progress of the load is
+// logged every ProgressInterval, and summed up once it is done.
 func DecompressAndLoad(qw graph.QuadWriter, cfg *config.Config, path, typ string, loadFn func(graph.QuadWriter, *config.Config, quad.Unmarshaler) error) error {
-	var r io.Reader
+	var (
+		r    io.Reader
+		size int64 = -1
+	)
 
 	if path == "" {
 		path = cfg.DatabasePath
@@ -46,17 +94,22 @@ func DecompressAndLoad(qw graph.QuadWriter, cfg *config.Config, path, typ string
 			return fmt.Errorf("could not open file %q: %v", path, err)
 		}
 		defer f.Close()
+		if fi, err := f.Stat(); err == nil {
+			size = fi.Size()
+		}
 		r = f
 	} else {
-		res, err := client.Get(path)
+		res, err := openRemote(u)
 		if err != nil {
 			return fmt.Errorf("could not get resource <%s>: %v", u, err)
 		}
 		defer res.Body.Close()
+		size = res.ContentLength
 		r = res.Body
 	}
 
-	r, err = Decompressor(r)
+	p := newProgress(size)
+	r, err = Decompressor(p.reader(r))
 	if err != nil {
 		if err == io.EOF {
 			return nil
@@ -64,19 +117,22 @@ func DecompressAndLoad(qw graph.QuadWriter, cfg *config.Config, path, typ string
 		return err
 	}
 
-	var dec quad.Unmarshaler
-	switch typ {
-	case "cquad":
-		dec = cquads.NewDecoder(r)
-	case "nquad":
-		dec = nquads.NewDecoder(r)
-	default:
+	f := quad.FormatByName(typ)
+	if f == nil || f.Reader == nil {
 		return fmt.Errorf("unknown quad format %q", typ)
 	}
+	dec := p.decoder(f.Reader(r))
 
-	if loadFn != nil {
-		return loadFn(qw, cfg, dec)
+	if loadFn == nil {
+		loadFn = db.Load
 	}
-
-	return db.Load(qw, cfg, dec)
+	stop := make(chan struct{})
+	go p.report(stop)
+	err = loadFn(qw, cfg, dec)
+	close(stop)
+	if err != nil {
+		return err
+	}
+	clog.Infoln(p.String())
+	return nil
 }
@@ -0,0 +1,161 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lru implements the LRU caches that the backends keep in front of
+// their lookups, such as of the names of node values.
+package lru
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/google/cayley/graph"
+)
+
+// DefaultNameCacheSize is the number of node names cached by a backend if the
+// "name_cache_size" option is not given.
+const DefaultNameCacheSize = 1 << 16
+
+// Cache is an LRU cache, safe for concurrent use. A nil *Cache caches
+// nothing.
+type Cache struct {
+	mu       sync.Mutex
+	cache    map[string]*list.Element
+	priority *list.List
+	maxSize  int
+}
+
+type kv struct {
+	key   string
+	value interface{}
+}
+
+// New returns a Cache holding up to size entries, or nil if size is not
+// positive.
+func New(size int) *Cache {
+	if size <= 0 {
+		return nil
+	}
+	return &Cache{
+		cache:    make(map[string]*list.Element),
+		priority: list.New(),
+		maxSize:  size,
+	}
+}
+
+// NameCacheFromOptions returns the cache of node names of the size given by
+// the "name_cache_size" option, DefaultNameCacheSize by default. A size of
+// zero disables the cache.
+func NameCacheFromOptions(options graph.Options) (*Cache, error) {
+	size, ok, err := options.IntKey("name_cache_size")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		size = DefaultNameCacheSize
+	}
+	return New(size), nil
+}
+
+// ResizeFromOptions resizes a cache of node names to the size given by the
+// "name_cache_size" option, if it is given.
+func (c *Cache) ResizeFromOptions(options graph.Options) error {
+	size, ok, err := options.IntKey("name_cache_size")
+	if err != nil || !ok {
+		return err
+	}
+	c.Resize(size)
+	return nil
+}
+
+// Put adds a value to the cache, evicting the least recently used one if the
+// cache is full.
+func (c *Cache) Put(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.cache[key]; ok {
+		c.priority.MoveToFront(e)
+		e.Value = kv{key: key, value: value}
+		return
+	}
+	if c.maxSize <= 0 {
+		return
+	}
+	if len(c.cache) == c.maxSize {
+		c.evict()
+	}
+	c.cache[key] = c.priority.PushFront(kv{key: key, value: value})
+}
+
+// evict removes the least recently used value.
+func (c *Cache) evict() {
+	last := c.priority.Remove(c.priority.Back())
+	delete(c.cache, last.(kv).key)
+}
+
+// Resize changes the number of entries the cache holds, evicting the least
+// recently used ones if it holds more. A size that is not positive empties
+// the cache, and disables it until it is resized again. A nil *Cache stays
+// disabled.
+func (c *Cache) Resize(size int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSize = size
+	for len(c.cache) > 0 && len(c.cache) > size {
+		c.evict()
+	}
+}
+
+// Get returns the value cached for a key, if any.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.cache[key]; ok {
+		c.priority.MoveToFront(e)
+		return e.Value.(kv).value, true
+	}
+	return nil, false
+}
+
+// Remove removes the value cached for a key.
+func (c *Cache) Remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.cache[key]; ok {
+		c.priority.Remove(e)
+		delete(c.cache, key)
+	}
+}
+
+// Len returns the number of values cached.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.cache)
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lru
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestCache(t *testing.T) {
+	c := New(2)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Unexpected value of a, got:%v,%t expect:1,true", v, ok)
+	}
+	// b is now the least recently used.
+	c.Put("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Least recently used value not evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("Recently used value %s evicted", k)
+		}
+	}
+	c.Put("a", 4)
+	if v, _ := c.Get("a"); v != 4 || c.Len() != 2 {
+		t.Errorf("Unexpected replaced value, got:%v len:%d expect:4 len:2", v, c.Len())
+	}
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok || c.Len() != 1 {
+		t.Errorf("Removed value still cached")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	c, err := NameCacheFromOptions(graph.Options{"name_cache_size": float64(0)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c != nil {
+		t.Fatalf("Cache of size 0 is not disabled")
+	}
+	c.Put("a", 1)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Disabled cache returned a value")
+	}
+	c, _ = NameCacheFromOptions(nil)
+	for i := 0; i < DefaultNameCacheSize+1; i++ {
+		c.Put(fmt.Sprint(i), i)
+	}
+	if c.Len() != DefaultNameCacheSize {
+		t.Errorf("Unexpected size of default cache, got:%d expect:%d", c.Len(), DefaultNameCacheSize)
+	}
+}
+
+func TestResize(t *testing.T) {
+	c := New(3)
+	for _, k := range []string{"a", "b", "c"} {
+		c.Put(k, k)
+	}
+	c.Get("a")
+	if err := c.ResizeFromOptions(graph.Options{"name_cache_size": float64(2)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := c.Get("b"); ok || c.Len() != 2 {
+		t.Errorf("Least recently used value not evicted, len:%d", c.Len())
+	}
+	c.Resize(0)
+	c.Put("d", 4)
+	if c.Len() != 0 {
+		t.Errorf("Cache resized to 0 still holds %d values", c.Len())
+	}
+	c.Resize(1)
+	c.Put("d", 4)
+	if v, ok := c.Get("d"); !ok || v != 4 {
+		t.Errorf("Unexpected value of d, got:%v,%t expect:4,true", v, ok)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/cayley/quad"
+)
+
+// DefaultFormat is the format of the quad files whose format is neither
+// given nor told by their name.
+const DefaultFormat = "cquad"
+
+// compressedExts are the extensions of compressed files, which the
+// Decompressor reads whatever their names.
+var compressedExts = []string{".gz", ".bz2"}
+
+// ExpandPaths returns the quad files the given paths name, in order. A
+// directory names the files under it, recursively and in lexical order,
+// leaving out those whose names start with a dot; a glob pattern names the
+// files it matches. URLs are kept as they are.
+func ExpandPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if isURL(path) {
+			files = append(files, path)
+			continue
+		}
+		matches := []string{path}
+		if strings.ContainsAny(path, `*?[`) {
+			var err error
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no quad files match %q", path)
+			}
+		}
+		for _, m := range matches {
+			fi, err := os.Stat(m)
+			if err != nil || !fi.IsDir() {
+				// Missing files are reported as they are loaded.
+				files = append(files, m)
+				continue
+			}
+			err = filepath.Walk(m, func(p string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				hidden := p != m && strings.HasPrefix(fi.Name(), ".")
+				switch {
+				case fi.IsDir() && hidden:
+					return filepath.SkipDir
+				case fi.Mode().IsRegular() && !hidden:
+					files = append(files, p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// FormatOf returns the name of the format to read the quad file at path in,
+// which is that of its extension, under any compression extension, if it is
+// readable, or DefaultFormat. N-Quads files are read as cquads, which unwraps
+// their IRIs, so that the nodes loaded do not depend on the name of the file.
+func FormatOf(path string) string {
+	if isURL(path) {
+		if u, err := url.Parse(path); err == nil {
+			path = u.Path
+		}
+	}
+	for _, ext := range compressedExts {
+		if strings.EqualFold(filepath.Ext(path), ext) {
+			path = path[:len(path)-len(ext)]
+			break
+		}
+	}
+	f := quad.FormatByExt(filepath.Ext(path))
+	if f == nil || f.Reader == nil || f.Name == "nquad" {
+		return DefaultFormat
+	}
+	return f.Name
+}
+
+// isURL returns whether path is the URL of a remote resource, rather than a
+// local path.
+func isURL(path string) bool {
+	u, err := url.Parse(path)
+	return err == nil && u.Scheme != "" && u.Scheme != "file" && len(u.Scheme) > 1
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_paths")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.nq", "b.nq.gz", "c.txt", "sub/d.nq", "sub/.e.nq", ".hidden/f.nq"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, nil, 0644)
+	}
+	in := func(names ...string) []string {
+		for i, name := range names {
+			names[i] = filepath.Join(dir, name)
+		}
+		return names
+	}
+
+	for _, test := range []struct {
+		paths  []string
+		expect []string
+	}{
+		{in("c.txt", "a.nq"), in("c.txt", "a.nq")},
+		{in("*.nq*"), in("a.nq", "b.nq.gz")},
+		{in("sub"), in("sub/d.nq")},
+		{append(in("."), "http://example.com/q.nq"), append(in("a.nq", "b.nq.gz", "c.txt", "sub/d.nq"), "http://example.com/q.nq")},
+	} {
+		got, err := ExpandPaths(test.paths)
+		if err != nil {
+			t.Errorf("Failed to expand %v: %v", test.paths, err)
+		} else if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected expansion of %v, got:%v expect:%v", test.paths, got, test.expect)
+		}
+	}
+	if _, err := ExpandPaths(in("*.ttl")); err == nil {
+		t.Error("Expected an error for a pattern matching no files")
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, expect := range map[string]string{
+		"data.nq":                      "cquad",
+		"data.nq.gz":                   "cquad",
+		"data.txt":                     "cquad",
+		"http://example.com/data.nq?x": "cquad",
+	} {
+		if got := FormatOf(path); got != expect {
+			t.Errorf("Unexpected format of %q, got:%q expect:%q", path, got, expect)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/quad"
+)
+
+// ProgressInterval is how often the progress of a load is logged. If zero,
+// only the summary at its end is.
+var ProgressInterval = 10 * time.Second
+
+// progress tracks a load of quads: the bytes read from the file, before
+// decompression, and the quads decoded from it.
+type progress struct {
+	start time.Time
+	size  int64 // The size of the file, or -1 if unknown.
+	bytes int64
+	quads int64
+}
+
+func newProgress(size int64) *progress {
+	return &progress{start: time.Now(), size: size}
+}
+
+// reader counts the bytes read from r.
+func (p *progress) reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, n: &p.bytes}
+}
+
+// decoder counts the quads decoded by dec.
+func (p *progress) decoder(dec quad.Unmarshaler) quad.Unmarshaler {
+	return &countingDecoder{dec: dec, n: &p.quads}
+}
+
+// report logs the progress every ProgressInterval until stop is closed.
+func (p *progress) report(stop <-chan struct{}) {
+	if ProgressInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(ProgressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			clog.Infoln(p.String())
+		}
+	}
+}
+
+// String describes the progress, with the rate of quads and, if the size of
+// the file is known, the estimated time left.
+func (p *progress) String() string {
+	elapsed := time.Since(p.start)
+	quads := atomic.LoadInt64(&p.quads)
+	bytes := atomic.LoadInt64(&p.bytes)
+	s := fmt.Sprintf("Loaded %d quads in %v (%.0f quads/s), read %d bytes", quads, elapsed-elapsed%time.Millisecond, rate(quads, elapsed), bytes)
+	if p.size > 0 {
+		s += fmt.Sprintf(" of %d (%.1f%%)", p.size, 100*float64(bytes)/float64(p.size))
+		if bytes > 0 && bytes < p.size {
+			left := time.Duration(float64(elapsed) * float64(p.size-bytes) / float64(bytes))
+			s += fmt.Sprintf(", ETA %v", left-left%time.Second)
+		}
+	}
+	return s
+}
+
+func rate(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+type countingDecoder struct {
+	dec quad.Unmarshaler
+	n   *int64
+}
+
+func (d *countingDecoder) Unmarshal() (quad.Quad, error) {
+	q, err := d.dec.Unmarshal()
+	if err == nil {
+		atomic.AddInt64(d.n, 1)
+	}
+	return q, err
+}
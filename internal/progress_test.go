@@ -0,0 +1,55 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/cayley/quad/nquads"
+)
+
+func TestProgress(t *testing.T) {
+	data := "<a> <b> <c> .\n<a> <b> <d> .\n"
+	p := newProgress(int64(2 * len(data)))
+	dec := p.decoder(nquads.NewDecoder(p.reader(strings.NewReader(data))))
+	n := 0
+	for {
+		_, err := dec.Unmarshal()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error decoding quads: %v", err)
+		}
+		n++
+	}
+	if n != 2 || p.quads != 2 || p.bytes != int64(len(data)) {
+		t.Errorf("Unexpected progress, got:%d quads, %d bytes expect:2 quads, %d bytes", p.quads, p.bytes, len(data))
+	}
+	s := p.String()
+	for _, want := range []string{"Loaded 2 quads", "of 56 (50.0%)", "ETA"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Progress %q does not contain %q", s, want)
+		}
+	}
+
+	p = newProgress(-1)
+	ioutil.ReadAll(p.reader(strings.NewReader(data)))
+	if s := p.String(); strings.Contains(s, "ETA") {
+		t.Errorf("Unexpected estimate for a file of unknown size: %q", s)
+	}
+}
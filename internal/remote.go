@@ -0,0 +1,198 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	client "net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// unsignedPayload stands for the hash of the body of a request in its S3
+// signature, as the bodies of reads are empty anyway.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// openRemote requests the resource at u, which is either an HTTP(S) URL or
+// an s3://bucket/key URL, and returns the successful response, whose body is
+// read as it arrives.
+func openRemote(u *url.URL) (*client.Response, error) {
+	var req *client.Request
+	var err error
+	switch u.Scheme {
+	case "http", "https":
+		req, err = client.NewRequest("GET", u.String(), nil)
+	case "s3":
+		req, err = newS3Request(u, os.Getenv, time.Now())
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return res, nil
+}
+
+// newS3Request returns a request reading the object of an s3://bucket/key
+// URL. It is configured by the variables the AWS tools read from the
+// environment: the region from AWS_REGION or AWS_DEFAULT_REGION, us-east-1 by
+// default, an endpoint other than Amazon's, such as of a Minio server, from
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, and the credentials from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. Without
+// credentials the request is anonymous, which reads public buckets.
+func newS3Request(u *url.URL, getenv func(string) string, now time.Time) (*client.Request, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("no bucket or key in %q", u)
+	}
+	region := firstEnv(getenv, "AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	var target *url.URL
+	if endpoint := firstEnv(getenv, "AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		e, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint %q: %v", endpoint, err)
+		}
+		target = &url.URL{Scheme: e.Scheme, Host: e.Host, Path: strings.TrimSuffix(e.Path, "/") + "/" + bucket + "/" + key}
+	} else if strings.Contains(bucket, ".") {
+		// The certificate of the virtual host does not cover buckets with
+		// dots in their names.
+		target = &url.URL{Scheme: "https", Host: "s3." + region + ".amazonaws.com", Path: "/" + bucket + "/" + key}
+	} else {
+		target = &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}
+	}
+	// The path is sent escaped as it is signed.
+	target.RawPath = uriEncode(target.Path, false)
+	req, err := client.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	id, secret := getenv("AWS_ACCESS_KEY_ID"), getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return req, nil
+	}
+	if token := getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signS3(req, id, secret, region, unsignedPayload, now)
+	return req, nil
+}
+
+func firstEnv(getenv func(string) string, names ...string) string {
+	for _, name := range names {
+		if v := getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// signS3 signs req for S3 with the AWS Signature Version 4, covering its
+// host and the headers it already has.
+func signS3(req *client.Request, id, secret, region, payloadHash string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical []string
+	for _, name := range names {
+		canonical = append(canonical, name+":"+headers[name]+"\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		strings.Join(canonical, ""),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+id+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	var pairs []string
+	for name, values := range q {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes all but the unreserved characters of s, and its slashes
+// unless encodeSlash is set, as the S3 signature requires.
+func uriEncode(s string, encodeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
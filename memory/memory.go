@@ -0,0 +1,182 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory accounts for the memory that queries hold while they run,
+// such as the results materialized by iterators and collected by the query
+// languages, against a per-query quota and a budget shared by every query.
+//
+// The accounting is an estimate: callers reserve a rough size for each value
+// they keep, so that a query that would exhaust the memory of the process
+// fails with an ExceededError instead.
+package memory
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Estimated sizes of the values held by queries, in bytes.
+const (
+	// ValueSize is the size of a graph.Value kept by an iterator, with the
+	// overhead of the map or slice holding it.
+	ValueSize = 48
+
+	// TagSize is the size of a tag of a result and its value.
+	TagSize = 64
+)
+
+// ResultSize is the estimated size of a result with n tags.
+func ResultSize(n int) int64 {
+	return ValueSize + int64(n)*TagSize
+}
+
+// ExceededError is returned when a query reserves more memory than its quota,
+// or than is left of the budget of all queries.
+type ExceededError struct {
+	Limit  int64
+	Global bool
+}
+
+func (e *ExceededError) Error() string {
+	if e.Global {
+		return fmt.Sprintf("queries exceeded the memory budget of %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("query exceeded its memory quota of %d bytes", e.Limit)
+}
+
+var global struct {
+	sync.Mutex
+	budget int64
+	quota  int64
+	used   int64
+}
+
+// SetLimits sets the budget of memory shared by all queries, and the quota of
+// each query started from then on, in bytes. A limit of zero is unlimited.
+func SetLimits(budget, quota int64) {
+	global.Lock()
+	global.budget = budget
+	global.quota = quota
+	global.Unlock()
+}
+
+// Used returns the memory held by all queries.
+func Used() int64 {
+	global.Lock()
+	defer global.Unlock()
+	return global.used
+}
+
+func reserveGlobal(n int64) error {
+	global.Lock()
+	defer global.Unlock()
+	if global.budget > 0 && global.used+n > global.budget {
+		return &ExceededError{Limit: global.budget, Global: true}
+	}
+	global.used += n
+	return nil
+}
+
+func releaseGlobal(n int64) {
+	global.Lock()
+	global.used -= n
+	global.Unlock()
+}
+
+// Quota accounts for the memory of a query. A nil *Quota accounts for
+// nothing, and never fails.
+type Quota struct {
+	mu     sync.Mutex
+	limit  int64
+	used   int64
+	closed bool
+}
+
+// NewQuota returns the Quota of a new query, limited by the quota set by
+// SetLimits. It must be closed once the query is done.
+func NewQuota() *Quota {
+	global.Lock()
+	defer global.Unlock()
+	return &Quota{limit: global.quota}
+}
+
+// NewQuotaLimit returns a Quota limited to the given number of bytes, which
+// still draws from the budget of all queries.
+func NewQuotaLimit(limit int64) *Quota {
+	return &Quota{limit: limit}
+}
+
+// Reserve accounts for n more bytes held by the query, or returns an
+// *ExceededError if they would exceed its quota or the budget.
+func (q *Quota) Reserve(n int64) error {
+	if q == nil || n <= 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	if q.limit > 0 && q.used+n > q.limit {
+		return &ExceededError{Limit: q.limit}
+	}
+	if err := reserveGlobal(n); err != nil {
+		return err
+	}
+	q.used += n
+	return nil
+}
+
+// Release returns n bytes no longer held by the query.
+func (q *Quota) Release(n int64) {
+	if q == nil || n <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	if n > q.used {
+		n = q.used
+	}
+	q.used -= n
+	releaseGlobal(n)
+}
+
+// Used returns the memory held by the query.
+func (q *Quota) Used() int64 {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.used
+}
+
+// Close returns all the memory held by the query to the budget. Later
+// reservations are not accounted for.
+func (q *Quota) Close() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	releaseGlobal(q.used)
+	q.used = 0
+	q.closed = true
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import "testing"
+
+func TestQuota(t *testing.T) {
+	SetLimits(0, 100)
+	defer SetLimits(0, 0)
+
+	q := NewQuota()
+	if err := q.Reserve(60); err != nil {
+		t.Fatalf("Unexpected error reserving within the quota: %v", err)
+	}
+	err := q.Reserve(60)
+	if e, ok := err.(*ExceededError); !ok || e.Global || e.Limit != 100 {
+		t.Errorf("Unexpected error exceeding the quota, got:%v expect:%v", err, &ExceededError{Limit: 100})
+	}
+	q.Release(20)
+	if err := q.Reserve(60); err != nil {
+		t.Errorf("Unexpected error reserving released memory: %v", err)
+	}
+	if got := Used(); got != 100 {
+		t.Errorf("Unexpected global use, got:%d expect:100", got)
+	}
+	q.Close()
+	q.Close()
+	if got := Used(); got != 0 {
+		t.Errorf("Memory not released on close, got:%d expect:0", got)
+	}
+
+	var nilq *Quota
+	if err := nilq.Reserve(1 << 40); err != nil {
+		t.Errorf("Unexpected error from a nil quota: %v", err)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	SetLimits(100, 0)
+	defer SetLimits(0, 0)
+
+	a, b := NewQuota(), NewQuota()
+	defer a.Close()
+	defer b.Close()
+	if err := a.Reserve(70); err != nil {
+		t.Fatalf("Unexpected error reserving within the budget: %v", err)
+	}
+	err := b.Reserve(70)
+	if e, ok := err.(*ExceededError); !ok || !e.Global {
+		t.Errorf("Unexpected error exceeding the budget, got:%v expect:%v", err, &ExceededError{Limit: 100, Global: true})
+	}
+	if got := b.Used(); got != 0 {
+		t.Errorf("Failed reservation was accounted for, got:%d expect:0", got)
+	}
+	a.Close()
+	if err := b.Reserve(70); err != nil {
+		t.Errorf("Unexpected error reserving memory released by another query: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+// Defines the registry of codecs, through which applications store values of
+// their own types as typed literals that compare and sort as the values do.
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Codec converts the values of a Go type to and from the lexical forms of
+// the literals of a datatype.
+type Codec struct {
+	// Type is the Go type of the values.
+	Type reflect.Type
+
+	// Encode returns the lexical form of a value.
+	Encode func(v interface{}) (string, error)
+
+	// Decode returns the value of a lexical form.
+	Decode func(lexical string) (interface{}, error)
+
+	// Compare returns a negative number, zero or a positive number as a
+	// sorts before, with or after b. It is nil for values without an order.
+	Compare func(a, b interface{}) int
+
+	// Key returns a sort key of a value, ordering values as Compare does.
+	// It is optional; stores keep the values of codecs that have one in
+	// their range indexes.
+	Key func(v interface{}) uint64
+}
+
+type codec struct {
+	Codec
+	datatype string
+	kind     ValueKind
+}
+
+var (
+	codecMu      sync.RWMutex
+	codecs       = make(map[string]*codec)
+	codecsByType = make(map[reflect.Type]*codec)
+	nextKind     = TimeValue + 1
+)
+
+// RegisterCodec registers the codec of the literals of a datatype, written
+// in angle brackets like XSDInteger, and returns the kind of value their
+// sort keys have. Kinds are given in the order codecs are registered, which
+// must not change while stores keep range indexes of them.
+func RegisterCodec(datatype string, c Codec) ValueKind {
+	if c.Type == nil || c.Encode == nil || c.Decode == nil {
+		panic("quad: incomplete codec for " + datatype)
+	}
+	if numberTypes[datatype] || timeLayouts[datatype] != nil || datatype == WKTLiteral {
+		panic("quad: cannot register a codec for builtin datatype " + datatype)
+	}
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	if _, found := codecs[datatype]; found {
+		panic("already registered codec " + datatype)
+	}
+	if _, found := codecsByType[c.Type]; found {
+		panic("already registered codec for " + c.Type.String())
+	}
+	cd := &codec{Codec: c, datatype: datatype}
+	if c.Key != nil {
+		if nextKind == 0 {
+			panic("quad: too many codecs with sort keys")
+		}
+		cd.kind = nextKind
+		nextKind++
+	}
+	codecs[datatype] = cd
+	codecsByType[c.Type] = cd
+	return cd.kind
+}
+
+func codecOf(v interface{}) *codec {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	return codecsByType[reflect.TypeOf(v)]
+}
+
+func codecFor(datatype string) *codec {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	return codecs[datatype]
+}
+
+// Literal returns the node name of a value of a registered type: a literal
+// of its datatype.
+func Literal(v interface{}) (string, error) {
+	c := codecOf(v)
+	if c == nil {
+		return "", fmt.Errorf("quad: no codec for %T", v)
+	}
+	lexical, err := c.Encode(v)
+	if err != nil {
+		return "", err
+	}
+	return `"` + lexical + `"^^` + c.datatype, nil
+}
+
+// DecodeLiteral returns the value a node name holds, if it is a literal of
+// a registered datatype with a valid lexical form.
+func DecodeLiteral(name string) (interface{}, bool) {
+	lexical, datatype, ok := TypedLiteral(name)
+	if !ok {
+		return nil, false
+	}
+	c := codecFor(datatype)
+	if c == nil {
+		return nil, false
+	}
+	v, err := c.Decode(lexical)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// CompareValues compares two values of the same registered type, and
+// returns whether they have an order.
+func CompareValues(a, b interface{}) (int, bool) {
+	c := codecOf(a)
+	if c == nil || c.Compare == nil || reflect.TypeOf(b) != c.Type {
+		return 0, false
+	}
+	return c.Compare(a, b), true
+}
+
+// ValueSortKey is SortKey for Go values: numbers, times, and the values of
+// registered types whose codecs give sort keys.
+func ValueSortKey(v interface{}) (ValueKind, uint64) {
+	switch v := v.(type) {
+	case int:
+		return NumberValue, NumberKey(float64(v))
+	case int64:
+		return NumberValue, NumberKey(float64(v))
+	case float64:
+		return NumberValue, NumberKey(v)
+	case time.Time:
+		return TimeValue, TimeKey(v)
+	}
+	if c := codecOf(v); c != nil && c.Key != nil {
+		return c.kind, c.Key(v)
+	}
+	return NoValue, 0
+}
+
+// codecSortKey is SortKey for the literals of registered datatypes.
+func codecSortKey(lexical, datatype string) (ValueKind, uint64) {
+	c := codecFor(datatype)
+	if c == nil || c.Key == nil {
+		return NoValue, 0
+	}
+	v, err := c.Decode(lexical)
+	if err != nil {
+		return NoValue, 0
+	}
+	return c.kind, c.Key(v)
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// version is a value with an order and sort keys.
+type version struct {
+	Major, Minor uint32
+}
+
+const versionType = "<http://example.com/version>"
+
+var versionKind = RegisterCodec(versionType, Codec{
+	Type: reflect.TypeOf(version{}),
+	Encode: func(v interface{}) (string, error) {
+		ver := v.(version)
+		return fmt.Sprintf("%d.%d", ver.Major, ver.Minor), nil
+	},
+	Decode: func(s string) (interface{}, error) {
+		var ver version
+		_, err := fmt.Sscanf(s, "%d.%d", &ver.Major, &ver.Minor)
+		return ver, err
+	},
+	Compare: func(a, b interface{}) int {
+		ka, kb := versionKey(a), versionKey(b)
+		if ka < kb {
+			return -1
+		} else if ka > kb {
+			return 1
+		}
+		return 0
+	},
+	Key: versionKey,
+})
+
+func versionKey(v interface{}) uint64 {
+	ver := v.(version)
+	return uint64(ver.Major)<<32 | uint64(ver.Minor)
+}
+
+func TestCodecLiteral(t *testing.T) {
+	name, err := Literal(version{1, 12})
+	if err != nil {
+		t.Fatalf("Could not encode version: %v", err)
+	}
+	if expect := `"1.12"^^` + versionType; name != expect {
+		t.Errorf("Unexpected literal, got:%s expect:%s", name, expect)
+	}
+	v, ok := DecodeLiteral(name)
+	if !ok || v != (version{1, 12}) {
+		t.Errorf("Unexpected decoded value, got:%v (%v)", v, ok)
+	}
+	if _, ok := DecodeLiteral(`"one"^^` + versionType); ok {
+		t.Errorf("Decoded an invalid lexical form")
+	}
+	if _, err := Literal(struct{}{}); err == nil {
+		t.Errorf("Encoded a value without a codec")
+	}
+}
+
+func TestCodecOrder(t *testing.T) {
+	if versionKind <= TimeValue {
+		t.Fatalf("Unexpected kind of a codec: %d", versionKind)
+	}
+	versions := []version{{0, 9}, {1, 2}, {1, 12}, {2, 0}}
+	var keys []uint64
+	for _, v := range versions {
+		name, _ := Literal(v)
+		kind, key := SortKey(name)
+		if kind != versionKind {
+			t.Errorf("Unexpected kind of %s, got:%d expect:%d", name, kind, versionKind)
+		}
+		if vk, vkey := ValueSortKey(v); vk != kind || vkey != key {
+			t.Errorf("Sort keys of %v and %s differ", v, name)
+		}
+		keys = append(keys, key)
+	}
+	if !sortedKeys(keys) {
+		t.Errorf("Keys of versions out of order: %v", keys)
+	}
+	if c, ok := CompareValues(version{1, 2}, version{1, 12}); !ok || c >= 0 {
+		t.Errorf("Unexpected comparison of versions, got:%d (%v)", c, ok)
+	}
+	if _, ok := CompareValues(version{1, 2}, 3); ok {
+		t.Errorf("Compared values of different types")
+	}
+}
+
+func TestRegisterCodecTwice(t *testing.T) {
+	for _, datatype := range []string{versionType, XSDInteger} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Registered a second codec for %s", datatype)
+				}
+			}()
+			RegisterCodec(datatype, Codec{
+				Type:   reflect.TypeOf(""),
+				Encode: func(v interface{}) (string, error) { return v.(string), nil },
+				Decode: func(s string) (interface{}, error) { return s, nil },
+			})
+		}()
+	}
+}
+
+func sortedKeys(keys []uint64) bool {
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Writer writes quads in a serialization format.
+type Writer interface {
+	WriteQuad(Quad) error
+
+	// Close writes out any quads still buffered. It does not close the
+	// underlying io.Writer.
+	Close() error
+}
+
+// Format is a serialization format of quads, which may be read, written or
+// both.
+type Format struct {
+	// Name identifies the format, as in the --format flag.
+	Name string
+
+	// Ext are the file extensions of the format, such as ".nq".
+	Ext []string
+
+	// Reader returns a decoder of the format read from r, or is nil
+	// if the format cannot be read.
+	Reader func(r io.Reader) Unmarshaler
+
+	// Writer returns an encoder of the format written to w, or is nil
+	// if the format cannot be written.
+	Writer func(w io.Writer) Writer
+}
+
+var formatRegistry = make(map[string]*Format)
+
+// RegisterFormat registers a format of quads under its name.
+func RegisterFormat(f Format) {
+	if _, found := formatRegistry[f.Name]; found {
+		panic("already registered quad format " + f.Name)
+	}
+	formatRegistry[f.Name] = &f
+}
+
+// FormatByName returns the format registered under name, or nil.
+func FormatByName(name string) *Format {
+	return formatRegistry[name]
+}
+
+// FormatByExt returns the format of a file with the extension ext, such as
+// ".nq", or nil.
+func FormatByExt(ext string) *Format {
+	for _, f := range formatRegistry {
+		for _, e := range f.Ext {
+			if strings.EqualFold(e, ext) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// FormatNames returns the names of the registered formats, in sorted order.
+func FormatNames() []string {
+	var names []string
+	for name := range formatRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
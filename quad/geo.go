@@ -0,0 +1,186 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+// Defines GeoPoint, the geographic points written as literals, and the
+// geohashes stores index them by.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WKTLiteral is the datatype of geographic point literals, written in the
+// Well-Known Text of GeoSPARQL, longitude first:
+//
+//  "POINT(-122.4194 37.7749)"^^<http://www.opengis.net/ont/geosparql#wktLiteral>
+const WKTLiteral = "<http://www.opengis.net/ont/geosparql#wktLiteral>"
+
+// EarthRadius is the mean radius of the Earth, in metres.
+const EarthRadius = 6371008.8
+
+// GeohashBits is the number of bits of the geohashes of GeoPoints, half of
+// them for each axis. They locate a point to within a metre.
+const GeohashBits = 52
+
+// GeoPoint is a point on the Earth, in degrees.
+type GeoPoint struct {
+	Lat, Lon float64
+}
+
+// ParseGeoPoint returns the point a node name is a literal of, and whether it
+// is one.
+func ParseGeoPoint(name string) (GeoPoint, bool) {
+	if !strings.HasSuffix(name, "^^"+WKTLiteral) || !strings.HasPrefix(name, `"`) {
+		return GeoPoint{}, false
+	}
+	wkt := strings.TrimSpace(name[1 : len(name)-len("^^"+WKTLiteral)-1])
+	if len(wkt) < len("POINT()") || !strings.EqualFold(wkt[:len("POINT")], "POINT") {
+		return GeoPoint{}, false
+	}
+	wkt = strings.TrimSpace(wkt[len("POINT"):])
+	if !strings.HasPrefix(wkt, "(") || !strings.HasSuffix(wkt, ")") {
+		return GeoPoint{}, false
+	}
+	coords := strings.Fields(wkt[1 : len(wkt)-1])
+	if len(coords) != 2 {
+		return GeoPoint{}, false
+	}
+	lon, err := strconv.ParseFloat(coords[0], 64)
+	if err != nil {
+		return GeoPoint{}, false
+	}
+	lat, err := strconv.ParseFloat(coords[1], 64)
+	if err != nil {
+		return GeoPoint{}, false
+	}
+	p := GeoPoint{Lat: lat, Lon: lon}
+	if !p.IsValid() {
+		return GeoPoint{}, false
+	}
+	return p, true
+}
+
+// IsValid returns whether the point lies within the ranges of latitudes and
+// longitudes.
+func (p GeoPoint) IsValid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// String returns the point as a literal.
+func (p GeoPoint) String() string {
+	return fmt.Sprintf(`"POINT(%s %s)"^^%s`,
+		strconv.FormatFloat(p.Lon, 'f', -1, 64),
+		strconv.FormatFloat(p.Lat, 'f', -1, 64),
+		WKTLiteral,
+	)
+}
+
+// Distance returns the distance in metres between two points, along the
+// surface of the Earth.
+func (p GeoPoint) Distance(o GeoPoint) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, o.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (o.Lon - p.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// cell returns the indexes of the cells of the given number of bits per axis
+// the point is in.
+func (p GeoPoint) cell(bits uint) (lat, lon uint64) {
+	n := float64(uint64(1) << bits)
+	lat = uint64(math.Min((p.Lat+90)/180*n, n-1))
+	lon = uint64(math.Min((p.Lon+180)/360*n, n-1))
+	return lat, lon
+}
+
+// interleave returns the geohash of a cell of the given number of bits per
+// axis: the bits of both indexes, alternately, longitude first.
+func interleave(lat, lon uint64, bits uint) uint64 {
+	var h uint64
+	for i := int(bits) - 1; i >= 0; i-- {
+		h = h<<2 | (lon>>uint(i)&1)<<1 | lat>>uint(i)&1
+	}
+	return h
+}
+
+// Geohash returns the geohash of the point, of GeohashBits bits. The points
+// of a cell of the grid share the leading bits of their geohashes, so a range
+// of geohashes is an area.
+func (p GeoPoint) Geohash() uint64 {
+	lat, lon := p.cell(GeohashBits / 2)
+	return interleave(lat, lon, GeohashBits/2)
+}
+
+// GeohashRange is a range [From, To) of geohashes.
+type GeohashRange struct {
+	From, To uint64
+}
+
+// GeohashRanges returns ranges of geohashes holding every point within radius
+// metres of p, and few others: the cells of the grid, of at least the size of
+// the circle, that it overlaps.
+func (p GeoPoint) GeohashRanges(radius float64) []GeohashRange {
+	// The extent of the circle: along the meridian, and, at its widest,
+	// along the parallels, unless it holds a pole.
+	d := radius / EarthRadius
+	dLat := d * 180 / math.Pi
+	dLon := 360.0
+	if p.Lat+dLat < 90 && p.Lat-dLat > -90 {
+		if x := math.Sin(d) / math.Cos(p.Lat*math.Pi/180); x < 1 {
+			dLon = math.Asin(x) * 180 / math.Pi
+		}
+	}
+	// The finest grid whose cells are as large as the circle, so that it
+	// overlaps at most two cells along each axis.
+	var bits uint
+	for bits < GeohashBits/2 {
+		n := float64(uint64(1) << (bits + 1))
+		if 180/n < 2*dLat || 360/n < 2*dLon {
+			break
+		}
+		bits++
+	}
+	n := uint64(1) << bits
+	lat0, lon0 := GeoPoint{Lat: math.Max(p.Lat-dLat, -90), Lon: p.Lon - dLon}.wrap().cell(bits)
+	lat1, lon1 := GeoPoint{Lat: math.Min(p.Lat+dLat, 90), Lon: p.Lon + dLon}.wrap().cell(bits)
+	shift := GeohashBits - 2*bits
+	var ranges []GeohashRange
+	for lat := lat0; lat <= lat1; lat++ {
+		for lon := lon0; ; lon = (lon + 1) % n {
+			h := interleave(lat, lon, bits)
+			ranges = append(ranges, GeohashRange{From: h << shift, To: (h + 1) << shift})
+			if lon == lon1 {
+				break
+			}
+		}
+	}
+	return ranges
+}
+
+// wrap returns the point with its longitude brought back within [-180, 180].
+func (p GeoPoint) wrap() GeoPoint {
+	for p.Lon < -180 {
+		p.Lon += 360
+	}
+	for p.Lon > 180 {
+		p.Lon -= 360
+	}
+	return p
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var geoPointTests = []struct {
+	name   string
+	expect GeoPoint
+	ok     bool
+}{
+	{`"POINT(2.2945 48.8584)"^^` + WKTLiteral, GeoPoint{Lat: 48.8584, Lon: 2.2945}, true},
+	{`"point( -122.4194   37.7749 )"^^` + WKTLiteral, GeoPoint{Lat: 37.7749, Lon: -122.4194}, true},
+	{`"POINT(2.2945 48.8584)"`, GeoPoint{}, false},
+	{`"POINT(2.2945)"^^` + WKTLiteral, GeoPoint{}, false},
+	{`"POINT(48.8584 200)"^^` + WKTLiteral, GeoPoint{}, false},
+	{`"LINESTRING(0 0, 1 1)"^^` + WKTLiteral, GeoPoint{}, false},
+	{`<paris>`, GeoPoint{}, false},
+}
+
+func TestParseGeoPoint(t *testing.T) {
+	for _, test := range geoPointTests {
+		p, ok := ParseGeoPoint(test.name)
+		if ok != test.ok || p != test.expect {
+			t.Errorf("Unexpected point for %s, got:%v,%t expect:%v,%t", test.name, p, ok, test.expect, test.ok)
+		}
+		if ok {
+			if got, _ := ParseGeoPoint(p.String()); got != p {
+				t.Errorf("Point %v did not survive being written as %s", p, p.String())
+			}
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	paris := GeoPoint{Lat: 48.8566, Lon: 2.3522}
+	london := GeoPoint{Lat: 51.5074, Lon: -0.1278}
+	if d := paris.Distance(london); math.Abs(d-343.5e3) > 1e3 {
+		t.Errorf("Unexpected distance from Paris to London: %v", d)
+	}
+	if d := paris.Distance(paris); d != 0 {
+		t.Errorf("Unexpected distance from Paris to itself: %v", d)
+	}
+}
+
+func TestGeohashRanges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		center := GeoPoint{Lat: r.Float64()*180 - 90, Lon: r.Float64()*360 - 180}
+		radius := math.Pow(10, r.Float64()*7)
+		ranges := center.GeohashRanges(radius)
+		if len(ranges) > 4 {
+			t.Errorf("Too many ranges around %v for %vm: %d", center, radius, len(ranges))
+		}
+		// Points on the circle, and just within it, must fall in a range.
+		for j := 0; j < 16; j++ {
+			angle := float64(j) / 16 * 2 * math.Pi
+			p := offset(center, 0.999*radius, angle)
+			if center.Distance(p) > radius {
+				continue
+			}
+			h := p.Geohash()
+			found := false
+			for _, r := range ranges {
+				if h >= r.From && h < r.To {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("Point %v, %vm from %v, is in none of %v", p, center.Distance(p), center, ranges)
+			}
+		}
+	}
+}
+
+// offset returns the point at the given distance from p, in the direction of
+// the given bearing.
+func offset(p GeoPoint, distance, bearing float64) GeoPoint {
+	lat1, lon1 := p.Lat*math.Pi/180, p.Lon*math.Pi/180
+	d := distance / EarthRadius
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(bearing))
+	lon2 := lon1 + math.Atan2(math.Sin(bearing)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	return GeoPoint{Lat: lat2 * 180 / math.Pi, Lon: lon2 * 180 / math.Pi}.wrap()
+}
@@ -39,7 +39,7 @@
 		if subject < 0 {
 			panic("unexpected parser state: subject start not set")
 		}
-		q.Subject = unEscape(data[subject:p], isEscaped)
+		q.Subject = t.term(subject, p, isEscaped)
 		isEscaped = false
 	}
 
@@ -47,7 +47,7 @@
 		if predicate < 0 {
 			panic("unexpected parser state: predicate start not set")
 		}
-		q.Predicate = unEscape(data[predicate:p], isEscaped)
+		q.Predicate = t.term(predicate, p, isEscaped)
 		isEscaped = false
 	}
 
@@ -55,7 +55,7 @@
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	}
 
@@ -63,7 +63,7 @@
 		if label < 0 {
 			panic("unexpected parser state: label start not set")
 		}
-		q.Label = unEscape(data[label:p], isEscaped)
+		q.Label = t.term(label, p, isEscaped)
 		isEscaped = false
 	}
 
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/google/cayley/quad"
 )
@@ -35,14 +36,18 @@ import (
 // Decoder implements N-Quad document parsing according to the RDF
 // 1.1 N-Quads specification.
 type Decoder struct {
-	r    *bufio.Reader
-	line []byte
+	r     *bufio.Reader
+	line  []byte
+	terms terms
 }
 
 // NewDecoder returns an N-Quad decoder that takes its input from the
 // provided io.Reader.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: bufio.NewReader(r)}
+	return &Decoder{
+		r:     bufio.NewReader(r),
+		terms: terms{interned: make(map[string]string)},
+	}
 }
 
 // Unmarshal returns the next valid N-Quad as a quad.Quad, or an error.
@@ -65,7 +70,7 @@ func (dec *Decoder) Unmarshal() (quad.Quad, error) {
 		}
 		dec.line = dec.line[:0]
 	}
-	q, err := Parse(string(line))
+	q, err := dec.terms.parse(line)
 	if err != nil {
 		return quad.Quad{}, fmt.Errorf("failed to parse %q: %v", dec.line, err)
 	}
@@ -75,6 +80,80 @@ func (dec *Decoder) Unmarshal() (quad.Quad, error) {
 	return q, nil
 }
 
+// maxInterned is the number of distinct terms a Decoder keeps for reuse before
+// it forgets them and starts over.
+const maxInterned = 1 << 12
+
+// terms holds the buffers a statement is parsed from, which a Decoder reuses
+// from one statement to the next, and the terms it has already read.
+type terms struct {
+	// line is the statement, and runes its decoding. Unless the statement
+	// is ASCII, offsets holds the offset in line of each rune, and the
+	// length of line.
+	line    []byte
+	runes   []rune
+	ascii   bool
+	offsets []int
+
+	// interned maps each recently read term to a single copy of it, so
+	// that repeated terms, such as predicates, are only allocated once.
+	// Terms are not interned if it is nil.
+	interned map[string]string
+}
+
+// decode decodes a statement into runes, for the parser to read.
+func (t *terms) decode(statement []byte) {
+	t.line = statement
+	if cap(t.runes) < len(statement) {
+		t.runes = make([]rune, 0, len(statement))
+	}
+	t.runes = t.runes[:0]
+	t.ascii = true
+	for _, c := range statement {
+		if c >= utf8.RuneSelf {
+			t.ascii = false
+			break
+		}
+		t.runes = append(t.runes, rune(c))
+	}
+	if t.ascii {
+		return
+	}
+	t.runes = t.runes[:0]
+	t.offsets = t.offsets[:0]
+	for i := 0; i < len(statement); {
+		r, n := utf8.DecodeRune(statement[i:])
+		t.runes = append(t.runes, r)
+		t.offsets = append(t.offsets, i)
+		i += n
+	}
+	t.offsets = append(t.offsets, len(statement))
+}
+
+// term returns the term between two runes of the statement. Terms without
+// escapes are sliced from the statement rather than built from the runes.
+func (t *terms) term(start, end int, isEscaped bool) string {
+	if isEscaped {
+		return unEscape(t.runes[start:end], true)
+	}
+	if !t.ascii {
+		start, end = t.offsets[start], t.offsets[end]
+	}
+	b := t.line[start:end]
+	if t.interned == nil {
+		return string(b)
+	}
+	if s, ok := t.interned[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(t.interned) >= maxInterned {
+		t.interned = make(map[string]string)
+	}
+	t.interned[s] = s
+	return s
+}
+
 func unEscape(r []rune, isEscaped bool) string {
 	if !isEscaped {
 		return string(r)
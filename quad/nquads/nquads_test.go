@@ -16,6 +16,7 @@ package nquads
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -600,3 +601,42 @@ func BenchmarkParser(b *testing.B) {
 		result, _ = Parse("<http://example/s> <http://example/p> \"object of some real\\tlength\"@en . # comment")
 	}
 }
+
+func TestDecoderReusesBuffers(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("<a> <follows> <b> .\n<cc> <follows> \"d\\te\" <g> .\n"))
+	first, err := dec.Unmarshal()
+	if err != nil {
+		t.Fatalf("Failed to read first quad: %v", err)
+	}
+	second, err := dec.Unmarshal()
+	if err != nil {
+		t.Fatalf("Failed to read second quad: %v", err)
+	}
+	if want := (quad.Quad{"<a>", "<follows>", "<b>", ""}); first != want {
+		t.Errorf("Unexpected first quad after reading the second, got:%#v expect:%#v", first, want)
+	}
+	if want := (quad.Quad{"<cc>", "<follows>", "\"d\te\"", "<g>"}); second != want {
+		t.Errorf("Unexpected second quad, got:%#v expect:%#v", second, want)
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, "<http://example/s%d> <http://example/p> \"object of some real length\"@en .\n", i)
+	}
+	doc := buf.Bytes()
+	b.SetBytes(int64(len(doc)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		dec := NewDecoder(bytes.NewReader(doc))
+		for {
+			_, err := dec.Unmarshal()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
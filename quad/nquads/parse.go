@@ -41,7 +41,14 @@ const quads_en_statement int = 1
 // handle comments except where the comment placement does not prevent
 // a complete valid quad.Quad from being defined.
 func Parse(statement string) (quad.Quad, error) {
-	data := []rune(statement)
+	var t terms
+	return t.parse([]byte(statement))
+}
+
+// parse parses a statement like Parse, reusing the buffers of t.
+func (t *terms) parse(statement []byte) (quad.Quad, error) {
+	t.decode(statement)
+	data := t.runes
 
 	var (
 		cs, p int
@@ -59,15 +66,15 @@ func Parse(statement string) (quad.Quad, error) {
 	)
 
 	
-// line 63 "parse.go"
+// line 70 "parse.go"
 	{
 	cs = quads_start
 	}
 
-// line 58 "parse.rl"
+// line 65 "parse.rl"
 
 	
-// line 71 "parse.go"
+// line 78 "parse.go"
 	{
 	if p == pe {
 		goto _test_eof
@@ -291,7 +298,7 @@ tr0:
 		return q, quad.ErrIncomplete
 	
 	goto st0
-// line 295 "parse.go"
+// line 302 "parse.go"
 st_case_0:
 	st0:
 		cs = 0
@@ -315,7 +322,7 @@ tr120:
 			goto _test_eof2
 		}
 	st_case_2:
-// line 319 "parse.go"
+// line 326 "parse.go"
 		switch data[p] {
 		case 33:
 			goto st2
@@ -358,7 +365,7 @@ tr121:
 			goto _test_eof3
 		}
 	st_case_3:
-// line 362 "parse.go"
+// line 369 "parse.go"
 		switch data[p] {
 		case 9:
 			goto tr7
@@ -375,7 +382,7 @@ tr7:
 		if subject < 0 {
 			panic("unexpected parser state: subject start not set")
 		}
-		q.Subject = unEscape(data[subject:p], isEscaped)
+		q.Subject = t.term(subject, p, isEscaped)
 		isEscaped = false
 	
 	goto st4
@@ -384,7 +391,7 @@ tr7:
 			goto _test_eof4
 		}
 	st_case_4:
-// line 388 "parse.go"
+// line 395 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st4
@@ -401,7 +408,7 @@ tr8:
 		if subject < 0 {
 			panic("unexpected parser state: subject start not set")
 		}
-		q.Subject = unEscape(data[subject:p], isEscaped)
+		q.Subject = t.term(subject, p, isEscaped)
 		isEscaped = false
 	
 // line 26 "actions.rl"
@@ -429,7 +436,7 @@ tr108:
 			goto _test_eof5
 		}
 	st_case_5:
-// line 433 "parse.go"
+// line 440 "parse.go"
 		switch data[p] {
 		case 33:
 			goto st5
@@ -472,7 +479,7 @@ tr109:
 			goto _test_eof6
 		}
 	st_case_6:
-// line 476 "parse.go"
+// line 483 "parse.go"
 		switch data[p] {
 		case 9:
 			goto tr14
@@ -493,7 +500,7 @@ tr14:
 		if predicate < 0 {
 			panic("unexpected parser state: predicate start not set")
 		}
-		q.Predicate = unEscape(data[predicate:p], isEscaped)
+		q.Predicate = t.term(predicate, p, isEscaped)
 		isEscaped = false
 	
 	goto st7
@@ -502,7 +509,7 @@ tr14:
 			goto _test_eof7
 		}
 	st_case_7:
-// line 506 "parse.go"
+// line 513 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st7
@@ -523,7 +530,7 @@ tr15:
 		if predicate < 0 {
 			panic("unexpected parser state: predicate start not set")
 		}
-		q.Predicate = unEscape(data[predicate:p], isEscaped)
+		q.Predicate = t.term(predicate, p, isEscaped)
 		isEscaped = false
 	
 // line 30 "actions.rl"
@@ -551,7 +558,7 @@ tr79:
 			goto _test_eof8
 		}
 	st_case_8:
-// line 555 "parse.go"
+// line 562 "parse.go"
 		switch data[p] {
 		case 34:
 			goto st9
@@ -583,7 +590,7 @@ tr80:
 			goto _test_eof9
 		}
 	st_case_9:
-// line 587 "parse.go"
+// line 594 "parse.go"
 		switch data[p] {
 		case 9:
 			goto tr25
@@ -608,7 +615,7 @@ tr25:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 	goto st10
@@ -619,7 +626,7 @@ tr96:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 // line 62 "actions.rl"
@@ -628,7 +635,7 @@ tr96:
 		if label < 0 {
 			panic("unexpected parser state: label start not set")
 		}
-		q.Label = unEscape(data[label:p], isEscaped)
+		q.Label = t.term(label, p, isEscaped)
 		isEscaped = false
 	
 	goto st10
@@ -637,7 +644,7 @@ tr96:
 			goto _test_eof10
 		}
 	st_case_10:
-// line 641 "parse.go"
+// line 648 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st10
@@ -658,7 +665,7 @@ tr26:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 	goto st88
@@ -669,7 +676,7 @@ tr39:
 		if label < 0 {
 			panic("unexpected parser state: label start not set")
 		}
-		q.Label = unEscape(data[label:p], isEscaped)
+		q.Label = t.term(label, p, isEscaped)
 		isEscaped = false
 	
 	goto st88
@@ -678,7 +685,7 @@ tr39:
 			goto _test_eof88
 		}
 	st_case_88:
-// line 682 "parse.go"
+// line 689 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st88
@@ -699,7 +706,7 @@ tr127:
 			goto _test_eof89
 		}
 	st_case_89:
-// line 703 "parse.go"
+// line 710 "parse.go"
 		goto st89
 tr27:
 // line 54 "actions.rl"
@@ -708,7 +715,7 @@ tr27:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 // line 34 "actions.rl"
@@ -736,7 +743,7 @@ tr50:
 			goto _test_eof11
 		}
 	st_case_11:
-// line 740 "parse.go"
+// line 747 "parse.go"
 		switch data[p] {
 		case 33:
 			goto st11
@@ -779,7 +786,7 @@ tr51:
 			goto _test_eof12
 		}
 	st_case_12:
-// line 783 "parse.go"
+// line 790 "parse.go"
 		switch data[p] {
 		case 9:
 			goto tr38
@@ -796,7 +803,7 @@ tr38:
 		if label < 0 {
 			panic("unexpected parser state: label start not set")
 		}
-		q.Label = unEscape(data[label:p], isEscaped)
+		q.Label = t.term(label, p, isEscaped)
 		isEscaped = false
 	
 	goto st13
@@ -805,7 +812,7 @@ tr38:
 			goto _test_eof13
 		}
 	st_case_13:
-// line 809 "parse.go"
+// line 816 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st13
@@ -827,7 +834,7 @@ tr52:
 			goto _test_eof14
 		}
 	st_case_14:
-// line 831 "parse.go"
+// line 838 "parse.go"
 		switch data[p] {
 		case 85:
 			goto st15
@@ -1021,7 +1028,7 @@ tr30:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 // line 34 "actions.rl"
@@ -1042,7 +1049,7 @@ tr34:
 			goto _test_eof24
 		}
 	st_case_24:
-// line 1046 "parse.go"
+// line 1053 "parse.go"
 		if data[p] == 58 {
 			goto st25
 		}
@@ -1215,7 +1222,7 @@ tr55:
 		if label < 0 {
 			panic("unexpected parser state: label start not set")
 		}
-		q.Label = unEscape(data[label:p], isEscaped)
+		q.Label = t.term(label, p, isEscaped)
 		isEscaped = false
 	
 	goto st90
@@ -1224,7 +1231,7 @@ tr55:
 			goto _test_eof90
 		}
 	st_case_90:
-// line 1228 "parse.go"
+// line 1235 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st88
@@ -1507,7 +1514,7 @@ tr16:
 		if predicate < 0 {
 			panic("unexpected parser state: predicate start not set")
 		}
-		q.Predicate = unEscape(data[predicate:p], isEscaped)
+		q.Predicate = t.term(predicate, p, isEscaped)
 		isEscaped = false
 	
 // line 30 "actions.rl"
@@ -1535,7 +1542,7 @@ tr73:
 			goto _test_eof34
 		}
 	st_case_34:
-// line 1539 "parse.go"
+// line 1546 "parse.go"
 		switch data[p] {
 		case 33:
 			goto st34
@@ -1578,7 +1585,7 @@ tr74:
 			goto _test_eof35
 		}
 	st_case_35:
-// line 1582 "parse.go"
+// line 1589 "parse.go"
 		switch data[p] {
 		case 9:
 			goto tr25
@@ -1604,7 +1611,7 @@ tr75:
 			goto _test_eof36
 		}
 	st_case_36:
-// line 1608 "parse.go"
+// line 1615 "parse.go"
 		switch data[p] {
 		case 85:
 			goto st37
@@ -1803,7 +1810,7 @@ tr81:
 			goto _test_eof46
 		}
 	st_case_46:
-// line 1807 "parse.go"
+// line 1814 "parse.go"
 		switch data[p] {
 		case 34:
 			goto st47
@@ -2002,7 +2009,7 @@ tr17:
 		if predicate < 0 {
 			panic("unexpected parser state: predicate start not set")
 		}
-		q.Predicate = unEscape(data[predicate:p], isEscaped)
+		q.Predicate = t.term(predicate, p, isEscaped)
 		isEscaped = false
 	
 // line 30 "actions.rl"
@@ -2023,7 +2030,7 @@ tr21:
 			goto _test_eof56
 		}
 	st_case_56:
-// line 2027 "parse.go"
+// line 2034 "parse.go"
 		if data[p] == 58 {
 			goto st57
 		}
@@ -2198,7 +2205,7 @@ tr90:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 	goto st91
@@ -2207,7 +2214,7 @@ tr90:
 			goto _test_eof91
 		}
 	st_case_91:
-// line 2211 "parse.go"
+// line 2218 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st88
@@ -2380,7 +2387,7 @@ tr91:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 // line 34 "actions.rl"
@@ -2394,7 +2401,7 @@ tr91:
 			goto _test_eof60
 		}
 	st_case_60:
-// line 2398 "parse.go"
+// line 2405 "parse.go"
 		switch data[p] {
 		case 9:
 			goto tr25
@@ -2585,7 +2592,7 @@ tr95:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 // line 34 "actions.rl"
@@ -2599,7 +2606,7 @@ tr95:
 			goto _test_eof62
 		}
 	st_case_62:
-// line 2603 "parse.go"
+// line 2610 "parse.go"
 		switch data[p] {
 		case 9:
 			goto tr96
@@ -2690,7 +2697,7 @@ tr97:
 		if object < 0 {
 			panic("unexpected parser state: object start not set")
 		}
-		q.Object = unEscape(data[object:p], isEscaped)
+		q.Object = t.term(object, p, isEscaped)
 		isEscaped = false
 	
 // line 62 "actions.rl"
@@ -2699,7 +2706,7 @@ tr97:
 		if label < 0 {
 			panic("unexpected parser state: label start not set")
 		}
-		q.Label = unEscape(data[label:p], isEscaped)
+		q.Label = t.term(label, p, isEscaped)
 		isEscaped = false
 	
 	goto st92
@@ -2708,7 +2715,7 @@ tr97:
 			goto _test_eof92
 		}
 	st_case_92:
-// line 2712 "parse.go"
+// line 2719 "parse.go"
 		switch data[p] {
 		case 9:
 			goto st88
@@ -2886,7 +2893,7 @@ tr110:
 			goto _test_eof64
 		}
 	st_case_64:
-// line 2890 "parse.go"
+// line 2897 "parse.go"
 		switch data[p] {
 		case 85:
 			goto st65
@@ -3085,7 +3092,7 @@ tr122:
 			goto _test_eof74
 		}
 	st_case_74:
-// line 3089 "parse.go"
+// line 3096 "parse.go"
 		switch data[p] {
 		case 85:
 			goto st75
@@ -3284,7 +3291,7 @@ tr3:
 			goto _test_eof84
 		}
 	st_case_84:
-// line 3288 "parse.go"
+// line 3295 "parse.go"
 		if data[p] == 58 {
 			goto st85
 		}
@@ -3660,14 +3667,14 @@ tr3:
 
 		return q, nil
 	
-// line 3664 "parse.go"
+// line 3671 "parse.go"
 		}
 	}
 
 	_out: {}
 	}
 
-// line 60 "parse.rl"
+// line 67 "parse.rl"
 
 	return quad.Quad{}, quad.ErrInvalid
 }
@@ -37,7 +37,14 @@ import (
 // handle comments except where the comment placement does not prevent
 // a complete valid quad.Quad from being defined.
 func Parse(statement string) (quad.Quad, error) {
-	data := []rune(statement)
+	var t terms
+	return t.parse([]byte(statement))
+}
+
+// parse parses a statement like Parse, reusing the buffers of t.
+func (t *terms) parse(statement []byte) (quad.Quad, error) {
+	t.decode(statement)
+	data := t.runes
 
 	var (
 		cs, p int
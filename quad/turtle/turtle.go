@@ -0,0 +1,605 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package turtle implements parsing the Turtle syntax for RDF graphs, as
+// defined by http://www.w3.org/TR/turtle/.
+//
+// Nodes are named as the cquads decoder names them: IRIs, including those
+// written as prefixed names, by the IRI without its angle brackets, and plain
+// literals by their value. Literals with a datatype or a language keep their
+// N-Quads form, such as "12"^^<http://www.w3.org/2001/XMLSchema#integer>,
+// which numbers and booleans written bare are given too. Turtle has no named
+// graphs, so the quads have no label.
+package turtle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/cayley/quad"
+)
+
+const (
+	rdfNS    = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xsdNS    = "http://www.w3.org/2001/XMLSchema#"
+	rdfType  = rdfNS + "type"
+	rdfFirst = rdfNS + "first"
+	rdfRest  = rdfNS + "rest"
+	rdfNil   = rdfNS + "nil"
+
+	eof = -1
+)
+
+// Decoder implements Turtle document parsing.
+type Decoder struct {
+	r    *bufio.Reader
+	back []rune
+	line int
+
+	base     *url.URL
+	prefixes map[string]string
+	blanks   int
+
+	queue []quad.Quad
+	err   error
+}
+
+// NewDecoder returns a Turtle decoder that takes its input from the provided
+// io.Reader.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:        bufio.NewReader(r),
+		line:     1,
+		prefixes: make(map[string]string),
+	}
+}
+
+// Unmarshal returns the next triple as a quad.Quad, or an error. It returns
+// io.EOF once the whole document has been read.
+func (dec *Decoder) Unmarshal() (quad.Quad, error) {
+	for len(dec.queue) == 0 {
+		if dec.err != nil {
+			return quad.Quad{}, dec.err
+		}
+		dec.err = dec.statement()
+	}
+	q := dec.queue[0]
+	dec.queue = dec.queue[1:]
+	return q, nil
+}
+
+func (dec *Decoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("turtle: line %d: %s", dec.line, fmt.Sprintf(format, args...))
+}
+
+func (dec *Decoder) next() rune {
+	if n := len(dec.back); n > 0 {
+		r := dec.back[n-1]
+		dec.back = dec.back[:n-1]
+		return r
+	}
+	r, _, err := dec.r.ReadRune()
+	if err != nil {
+		return eof
+	}
+	if r == '\n' {
+		dec.line++
+	}
+	return r
+}
+
+// unread pushes runes back, to be read again in the reverse order.
+func (dec *Decoder) unread(runes ...rune) {
+	for _, r := range runes {
+		if r != eof {
+			dec.back = append(dec.back, r)
+		}
+	}
+}
+
+func (dec *Decoder) peek() rune {
+	r := dec.next()
+	dec.unread(r)
+	return r
+}
+
+// skip skips white space and comments, and returns the rune after them.
+func (dec *Decoder) skip() rune {
+	for {
+		r := dec.next()
+		switch {
+		case r == '#':
+			for r != '\n' && r != eof {
+				r = dec.next()
+			}
+		case r == eof || !unicode.IsSpace(r):
+			dec.unread(r)
+			return r
+		}
+	}
+}
+
+func (dec *Decoder) expect(want rune) error {
+	if r := dec.skip(); r != want {
+		return dec.errorf("expected %q, found %s", want, describe(r))
+	}
+	dec.next()
+	return nil
+}
+
+func describe(r rune) string {
+	if r == eof {
+		return "end of input"
+	}
+	return strconv.QuoteRune(r)
+}
+
+func (dec *Decoder) emit(s, p, o string) {
+	dec.queue = append(dec.queue, quad.Quad{Subject: s, Predicate: p, Object: o})
+}
+
+func (dec *Decoder) newBlank() string {
+	dec.blanks++
+	return "_:b" + strconv.Itoa(dec.blanks)
+}
+
+// statement reads a directive, or the triples of a subject.
+func (dec *Decoder) statement() error {
+	r := dec.skip()
+	if r == eof {
+		return io.EOF
+	}
+	if r == '@' {
+		dec.next()
+		word := dec.name()
+		if word != "prefix" && word != "base" {
+			return dec.errorf("unknown directive @%s", word)
+		}
+		if err := dec.directive(word); err != nil {
+			return err
+		}
+		return dec.expect('.')
+	}
+
+	var (
+		subj  string
+		props bool
+		err   error
+	)
+	if isNameStart(r) {
+		name := dec.name()
+		if w := strings.ToLower(name); w == "prefix" || w == "base" {
+			// The SPARQL forms of the directives end without a period.
+			return dec.directive(w)
+		}
+		subj, err = dec.resolveName(name)
+	} else if r == '[' {
+		subj, props, err = dec.blankProperties()
+	} else {
+		subj, err = dec.term()
+	}
+	if err != nil {
+		return err
+	}
+	if !props || dec.skip() != '.' {
+		if err := dec.predicateObjects(subj); err != nil {
+			return err
+		}
+	}
+	return dec.expect('.')
+}
+
+func (dec *Decoder) directive(kind string) error {
+	if kind == "base" {
+		if dec.skip() != '<' {
+			return dec.errorf("expected an IRI for the base")
+		}
+		iri, err := dec.iri()
+		if err != nil {
+			return err
+		}
+		dec.base, err = url.Parse(iri)
+		return err
+	}
+	dec.skip()
+	name := dec.name()
+	if strings.Index(name, ":") != len(name)-1 {
+		return dec.errorf("invalid prefix %q", name)
+	}
+	if dec.skip() != '<' {
+		return dec.errorf("expected an IRI for prefix %q", name)
+	}
+	iri, err := dec.iri()
+	if err != nil {
+		return err
+	}
+	dec.prefixes[strings.TrimSuffix(name, ":")] = iri
+	return nil
+}
+
+// predicateObjects reads the predicates and objects of subj, separated by
+// semicolons and commas.
+func (dec *Decoder) predicateObjects(subj string) error {
+	for {
+		pred, err := dec.verb()
+		if err != nil {
+			return err
+		}
+		for {
+			obj, err := dec.term()
+			if err != nil {
+				return err
+			}
+			dec.emit(subj, pred, obj)
+			if dec.skip() != ',' {
+				break
+			}
+			dec.next()
+		}
+		if dec.skip() != ';' {
+			return nil
+		}
+		for dec.skip() == ';' {
+			dec.next()
+		}
+		if r := dec.skip(); r == '.' || r == ']' || r == eof {
+			return nil
+		}
+	}
+}
+
+func (dec *Decoder) verb() (string, error) {
+	r := dec.skip()
+	if r == '<' {
+		return dec.iri()
+	} else if !isNameStart(r) {
+		return "", dec.errorf("expected a predicate, found %s", describe(r))
+	}
+	name := dec.name()
+	if name == "a" {
+		return rdfType, nil
+	}
+	if !strings.Contains(name, ":") || strings.HasPrefix(name, "_:") {
+		return "", dec.errorf("invalid predicate %q", name)
+	}
+	return dec.resolveName(name)
+}
+
+// term reads a subject or an object.
+func (dec *Decoder) term() (string, error) {
+	r := dec.skip()
+	switch {
+	case r == '<':
+		return dec.iri()
+	case r == '"' || r == '\'':
+		return dec.literal()
+	case r == '[':
+		b, _, err := dec.blankProperties()
+		return b, err
+	case r == '(':
+		return dec.collection()
+	case r == '+' || r == '-' || r == '.' || ('0' <= r && r <= '9'):
+		return dec.number()
+	case isNameStart(r):
+		return dec.resolveName(dec.name())
+	}
+	return "", dec.errorf("unexpected %s", describe(r))
+}
+
+// blankProperties reads a blank node, written as [] or with its properties
+// in brackets, and returns whether it had any.
+func (dec *Decoder) blankProperties() (string, bool, error) {
+	dec.next()
+	b := dec.newBlank()
+	if dec.skip() == ']' {
+		dec.next()
+		return b, false, nil
+	}
+	if err := dec.predicateObjects(b); err != nil {
+		return "", false, err
+	}
+	return b, true, dec.expect(']')
+}
+
+// collection reads a list in parentheses, as the blank nodes of its cells.
+func (dec *Decoder) collection() (string, error) {
+	dec.next()
+	var items []string
+	for dec.skip() != ')' {
+		item, err := dec.term()
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+	dec.next()
+	cells := make([]string, len(items)+1)
+	for i := range items {
+		cells[i] = dec.newBlank()
+	}
+	cells[len(items)] = rdfNil
+	for i := len(items) - 1; i >= 0; i-- {
+		dec.emit(cells[i], rdfFirst, items[i])
+		dec.emit(cells[i], rdfRest, cells[i+1])
+	}
+	return cells[0], nil
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || r == ':' || unicode.IsLetter(r)
+}
+
+func isNameChar(r rune) bool {
+	switch r {
+	case '_', '-', ':', '.', '%', '\\', 0xB7:
+		return true
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// name reads a prefixed name, a blank node label or a keyword. Backslashes
+// escape the characters after them; a final period ends the statement.
+func (dec *Decoder) name() string {
+	var b []rune
+	for {
+		r := dec.next()
+		if r == eof || !isNameChar(r) {
+			dec.unread(r)
+			break
+		}
+		if r == '\\' {
+			if r = dec.next(); r == eof {
+				break
+			}
+		}
+		b = append(b, r)
+	}
+	for len(b) > 0 && b[len(b)-1] == '.' {
+		dec.unread('.')
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
+
+func (dec *Decoder) resolveName(name string) (string, error) {
+	switch {
+	case name == "true" || name == "false":
+		return typed(name, xsdNS+"boolean"), nil
+	case strings.HasPrefix(name, "_:"):
+		return name, nil
+	}
+	i := strings.Index(name, ":")
+	if i < 0 {
+		return "", dec.errorf("unexpected %q", name)
+	}
+	ns, ok := dec.prefixes[name[:i]]
+	if !ok {
+		return "", dec.errorf("undefined prefix %q", name[:i])
+	}
+	return ns + name[i+1:], nil
+}
+
+// iri reads an IRI in angle brackets, resolved against the base.
+func (dec *Decoder) iri() (string, error) {
+	dec.next()
+	var b []rune
+	for {
+		r := dec.next()
+		switch r {
+		case eof, '\n':
+			return "", dec.errorf("unterminated IRI")
+		case '>':
+			return dec.resolve(string(b))
+		case '\\':
+			u, err := dec.unicodeEscape()
+			if err != nil {
+				return "", err
+			}
+			r = u
+		}
+		b = append(b, r)
+	}
+}
+
+func (dec *Decoder) resolve(iri string) (string, error) {
+	if dec.base == nil {
+		return iri, nil
+	}
+	u, err := url.Parse(iri)
+	if err != nil {
+		return "", dec.errorf("invalid IRI %q: %v", iri, err)
+	}
+	if u.IsAbs() {
+		return iri, nil
+	}
+	return dec.base.ResolveReference(u).String(), nil
+}
+
+// unicodeEscape reads the escape after a backslash of the form uXXXX or
+// UXXXXXXXX.
+func (dec *Decoder) unicodeEscape() (rune, error) {
+	n := 0
+	switch dec.next() {
+	case 'u':
+		n = 4
+	case 'U':
+		n = 8
+	default:
+		return 0, dec.errorf("invalid escape")
+	}
+	var hex []rune
+	for i := 0; i < n; i++ {
+		hex = append(hex, dec.next())
+	}
+	v, err := strconv.ParseUint(string(hex), 16, 32)
+	if err != nil {
+		return 0, dec.errorf("invalid escape \\%s", string(hex))
+	}
+	return rune(v), nil
+}
+
+var stringEscapes = map[rune]rune{
+	't': '\t', 'b': '\b', 'n': '\n', 'r': '\r', 'f': '\f',
+	'"': '"', '\'': '\'', '\\': '\\',
+}
+
+// literal reads a string, with its language or datatype if it has one.
+func (dec *Decoder) literal() (string, error) {
+	q := dec.next()
+	long := false
+	if dec.peek() == q {
+		dec.next()
+		if dec.peek() != q {
+			// The empty string.
+			return dec.literalSuffix("")
+		}
+		dec.next()
+		long = true
+	}
+	var b []rune
+	for {
+		r := dec.next()
+		switch {
+		case r == eof:
+			return "", dec.errorf("unterminated string")
+		case (r == '\n' || r == '\r') && !long:
+			return "", dec.errorf("newline in string")
+		case r == '\\':
+			if e, ok := stringEscapes[dec.peek()]; ok {
+				dec.next()
+				r = e
+			} else {
+				u, err := dec.unicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				r = u
+			}
+		case r == q && !long:
+			return dec.literalSuffix(string(b))
+		case r == q:
+			// A long string ends at three quotes; fewer are its own.
+			r2 := dec.next()
+			if r2 != q {
+				dec.unread(r2)
+				break
+			}
+			r3 := dec.next()
+			if r3 == q {
+				return dec.literalSuffix(string(b))
+			}
+			dec.unread(r3)
+			b = append(b, q)
+		}
+		b = append(b, r)
+	}
+}
+
+func (dec *Decoder) literalSuffix(value string) (string, error) {
+	switch dec.peek() {
+	case '@':
+		dec.next()
+		var lang []rune
+		r := dec.next()
+		for ; r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r); r = dec.next() {
+			lang = append(lang, r)
+		}
+		dec.unread(r)
+		return `"` + escape(value) + `"@` + string(lang), nil
+	case '^':
+		dec.next()
+		if dec.next() != '^' {
+			return "", dec.errorf("expected a datatype")
+		}
+		var dt string
+		var err error
+		if dec.peek() == '<' {
+			dt, err = dec.iri()
+		} else {
+			dt, err = dec.resolveName(dec.name())
+		}
+		if err != nil {
+			return "", err
+		}
+		return typed(value, dt), nil
+	}
+	return value, nil
+}
+
+// number reads an integer, decimal or double written bare.
+func (dec *Decoder) number() (string, error) {
+	var b []rune
+	digits := func() int {
+		n := 0
+		r := dec.next()
+		for ; '0' <= r && r <= '9'; r = dec.next() {
+			b = append(b, r)
+			n++
+		}
+		dec.unread(r)
+		return n
+	}
+	if r := dec.next(); r == '+' || r == '-' {
+		b = append(b, r)
+	} else {
+		dec.unread(r)
+	}
+	n := digits()
+	datatype := "integer"
+	if r := dec.next(); r == '.' {
+		// A period not followed by digits ends the statement.
+		if d := dec.peek(); '0' <= d && d <= '9' {
+			b = append(b, r)
+			n += digits()
+			datatype = "decimal"
+		} else {
+			dec.unread(r)
+		}
+	} else {
+		dec.unread(r)
+	}
+	if n == 0 {
+		return "", dec.errorf("invalid number %q", string(b))
+	}
+	if r := dec.next(); r == 'e' || r == 'E' {
+		b = append(b, r)
+		if s := dec.next(); s == '+' || s == '-' {
+			b = append(b, s)
+		} else {
+			dec.unread(s)
+		}
+		if digits() == 0 {
+			return "", dec.errorf("invalid number %q", string(b))
+		}
+		datatype = "double"
+	} else {
+		dec.unread(r)
+	}
+	return typed(string(b), xsdNS+datatype), nil
+}
+
+func typed(value, datatype string) string {
+	return `"` + escape(value) + `"^^<` + datatype + `>`
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
@@ -0,0 +1,156 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turtle
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cayley/quad"
+)
+
+func parse(doc string) ([]quad.Quad, error) {
+	dec := NewDecoder(strings.NewReader(doc))
+	var quads []quad.Quad
+	for {
+		q, err := dec.Unmarshal()
+		if err == io.EOF {
+			return quads, nil
+		} else if err != nil {
+			return quads, err
+		}
+		quads = append(quads, q)
+	}
+}
+
+func triple(s, p, o string) quad.Quad {
+	return quad.Quad{Subject: s, Predicate: p, Object: o}
+}
+
+const ex = "http://example.org/"
+
+var testTurtle = []struct {
+	message string
+	input   string
+	expect  []quad.Quad
+}{
+	{
+		message: "parse a triple of IRIs",
+		input:   `<http://example.org/a> <http://example.org/p> <http://example.org/b> .`,
+		expect:  []quad.Quad{triple(ex+"a", ex+"p", ex+"b")},
+	},
+	{
+		message: "expand prefixed names",
+		input: `@prefix ex: <http://example.org/> .
+PREFIX e2: <http://example.org/2/>
+ex:a e2:p ex:b.`,
+		expect: []quad.Quad{triple(ex+"a", ex+"2/p", ex+"b")},
+	},
+	{
+		message: "resolve relative IRIs against the base",
+		input: `@base <http://example.org/dir/> .
+<a> <../p> <#b> .`,
+		expect: []quad.Quad{triple(ex+"dir/a", ex+"p", ex+"dir/#b")},
+	},
+	{
+		message: "parse predicate and object lists",
+		input: `@prefix : <http://example.org/> .
+# A comment.
+:a a :T ; :p :b, :c ;
+   :q :d ; .`,
+		expect: []quad.Quad{
+			triple(ex+"a", rdfType, ex+"T"),
+			triple(ex+"a", ex+"p", ex+"b"),
+			triple(ex+"a", ex+"p", ex+"c"),
+			triple(ex+"a", ex+"q", ex+"d"),
+		},
+	},
+	{
+		message: "parse literals",
+		input: `@prefix : <http://example.org/> .
+:a :p "plain", 'single', "tab\tquote\"", """long
+"string\"""" ;
+   :q "chat"@fr, "1"^^<http://example.org/t>, "2"^^:t ;
+   :r 12, -1.5, 1e3, true .`,
+		expect: []quad.Quad{
+			triple(ex+"a", ex+"p", "plain"),
+			triple(ex+"a", ex+"p", "single"),
+			triple(ex+"a", ex+"p", "tab\tquote\""),
+			triple(ex+"a", ex+"p", "long\n\"string\""),
+			triple(ex+"a", ex+"q", `"chat"@fr`),
+			triple(ex+"a", ex+"q", `"1"^^<http://example.org/t>`),
+			triple(ex+"a", ex+"q", `"2"^^<http://example.org/t>`),
+			triple(ex+"a", ex+"r", `"12"^^<`+xsdNS+`integer>`),
+			triple(ex+"a", ex+"r", `"-1.5"^^<`+xsdNS+`decimal>`),
+			triple(ex+"a", ex+"r", `"1e3"^^<`+xsdNS+`double>`),
+			triple(ex+"a", ex+"r", `"true"^^<`+xsdNS+`boolean>`),
+		},
+	},
+	{
+		message: "parse blank nodes",
+		input: `@prefix : <http://example.org/> .
+_:x :p [ :q :b ] .
+[ :r :c ] .
+[] :s _:x .`,
+		expect: []quad.Quad{
+			triple("_:b1", ex+"q", ex+"b"),
+			triple("_:x", ex+"p", "_:b1"),
+			triple("_:b2", ex+"r", ex+"c"),
+			triple("_:b3", ex+"s", "_:x"),
+		},
+	},
+	{
+		message: "parse collections",
+		input: `@prefix : <http://example.org/> .
+:a :p (:b "c"), () .`,
+		expect: []quad.Quad{
+			triple("_:b2", rdfFirst, "c"),
+			triple("_:b2", rdfRest, rdfNil),
+			triple("_:b1", rdfFirst, ex+"b"),
+			triple("_:b1", rdfRest, "_:b2"),
+			triple(ex+"a", ex+"p", "_:b1"),
+			triple(ex+"a", ex+"p", rdfNil),
+		},
+	},
+}
+
+func TestDecoder(t *testing.T) {
+	for _, test := range testTurtle {
+		got, err := parse(test.input)
+		if err != nil {
+			t.Errorf("Unexpected error when %s: %v", test.message, err)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%q expect:%q", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	for _, input := range []string{
+		`<a> <p> .`,
+		`<a> <p> <b>`,
+		`ex:a <p> <b> .`,
+		`<a> <p> "unterminated .`,
+		`<a> "p" <b> .`,
+		`@prefix ex <http://example.org/> .`,
+	} {
+		if _, err := parse(input); err == nil {
+			t.Errorf("Expected an error parsing %q", input)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+// Defines the typed literals holding numbers, booleans and times, and the
+// keys stores sort them by in their range indexes.
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XSD is the namespace of the XML Schema datatypes.
+const XSD = "http://www.w3.org/2001/XMLSchema#"
+
+// The datatypes of the literals that hold values with an order.
+const (
+	XSDInteger  = "<" + XSD + "integer>"
+	XSDDecimal  = "<" + XSD + "decimal>"
+	XSDDouble   = "<" + XSD + "double>"
+	XSDDateTime = "<" + XSD + "dateTime>"
+	XSDDate     = "<" + XSD + "date>"
+)
+
+// XSDBoolean is the datatype of the literals holding booleans.
+const XSDBoolean = "<" + XSD + "boolean>"
+
+var numberTypes = map[string]bool{
+	XSDInteger:           true,
+	XSDDecimal:           true,
+	XSDDouble:            true,
+	"<" + XSD + "float>": true,
+	"<" + XSD + "int>":   true,
+	"<" + XSD + "long>":  true,
+	"<" + XSD + "short>": true,
+	"<" + XSD + "byte>":  true,
+}
+
+// integerTypes are the numeric datatypes whose values are integers.
+var integerTypes = map[string]bool{
+	XSDInteger:           true,
+	"<" + XSD + "int>":   true,
+	"<" + XSD + "long>":  true,
+	"<" + XSD + "short>": true,
+	"<" + XSD + "byte>":  true,
+}
+
+// timeLayouts are the lexical forms of xsd:dateTime and xsd:date literals,
+// those without a time zone being in UTC.
+var timeLayouts = map[string][]string{
+	XSDDateTime: {time.RFC3339Nano, "2006-01-02T15:04:05.999999999"},
+	XSDDate:     {"2006-01-02Z07:00", "2006-01-02"},
+}
+
+// TypedLiteral splits the name of a typed literal into its lexical form and
+// its datatype, and returns whether it is one.
+func TypedLiteral(name string) (lexical, datatype string, ok bool) {
+	i := strings.LastIndex(name, `"^^<`)
+	if i < 1 || name[0] != '"' || !strings.HasSuffix(name, ">") {
+		return "", "", false
+	}
+	return name[1:i], name[i+3:], true
+}
+
+// ParseValue returns the value a typed literal holds: an int64 or a float64
+// for the numeric datatypes, a bool for xsd:boolean, a time.Time for
+// xsd:dateTime and xsd:date, or the value of a registered datatype. It
+// returns false for other names, plain ones included, and for literals whose
+// lexical forms are not valid.
+func ParseValue(name string) (interface{}, bool) {
+	lexical, datatype, ok := TypedLiteral(name)
+	if !ok {
+		return nil, false
+	}
+	lexical = strings.TrimSpace(lexical)
+	switch {
+	case integerTypes[datatype]:
+		if n, err := strconv.ParseInt(lexical, 10, 64); err == nil {
+			return n, true
+		}
+		fallthrough
+	case numberTypes[datatype]:
+		f, err := strconv.ParseFloat(lexical, 64)
+		return f, err == nil
+	case datatype == XSDBoolean:
+		switch lexical {
+		case "true", "1":
+			return true, true
+		case "false", "0":
+			return false, true
+		}
+		return nil, false
+	}
+	if layouts, ok := timeLayouts[datatype]; ok {
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, lexical); err == nil {
+				return t, true
+			}
+		}
+		return nil, false
+	}
+	return DecodeLiteral(name)
+}
+
+// ValueKind is a kind of value stores can index ranges of.
+type ValueKind byte
+
+const (
+	NoValue ValueKind = iota
+	NumberValue
+	TimeValue
+)
+
+// SortKey returns the kind of value a node name holds, and a key that sorts
+// as the values do, or NoValue if it holds none. Numbers are typed literals
+// of the numeric XSD datatypes, or names that are plain numbers; times are
+// xsd:dateTime and xsd:date literals. Literals of registered datatypes
+// whose codecs give sort keys have the kinds of their codecs.
+func SortKey(name string) (ValueKind, uint64) {
+	lexical, datatype, ok := TypedLiteral(name)
+	if !ok {
+		lexical = name
+	} else if layouts, ok := timeLayouts[datatype]; ok {
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, lexical); err == nil {
+				return TimeValue, TimeKey(t)
+			}
+		}
+		return NoValue, 0
+	} else if !numberTypes[datatype] {
+		return codecSortKey(lexical, datatype)
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(lexical), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return NoValue, 0
+	}
+	return NumberValue, NumberKey(f)
+}
+
+// NumberKey returns the sort key of a number. Integers beyond 2^53 are
+// rounded to the nearest float64, and so may share their keys.
+func NumberKey(f float64) uint64 {
+	if f == 0 {
+		// Both zeros.
+		return 1 << 63
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
+
+// TimeKey returns the sort key of a time, to the microsecond.
+func TimeKey(t time.Time) uint64 {
+	us := t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+	return uint64(us) ^ 1<<63
+}
+
+// ValueRange is the range of values of a kind whose sort keys lie between
+// From and To, both included.
+type ValueRange struct {
+	Kind     ValueKind
+	From, To uint64
+}
+
+// Contains returns whether a value, given by its kind and sort key, lies in
+// the range.
+func (r ValueRange) Contains(kind ValueKind, key uint64) bool {
+	return kind == r.Kind && kind != NoValue && key >= r.From && key <= r.To
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+var sortKeyTests = []struct {
+	name string
+	kind ValueKind
+}{
+	{`"12"^^` + XSDInteger, NumberValue},
+	{`"1.5e3"^^` + XSDDouble, NumberValue},
+	{`"-0.25"^^<http://www.w3.org/2001/XMLSchema#float>`, NumberValue},
+	{"42", NumberValue},
+	{`"2015-03-01T12:00:00+01:00"^^` + XSDDateTime, TimeValue},
+	{`"2015-03-01T12:00:00.5"^^` + XSDDateTime, TimeValue},
+	{`"2015-03-01"^^` + XSDDate, TimeValue},
+	{`"twelve"^^` + XSDInteger, NoValue},
+	{`"2015-03-01"^^` + XSDDateTime, NoValue},
+	{`"12"^^<http://example.com/type>`, NoValue},
+	{"NaN", NoValue},
+	{"alice", NoValue},
+}
+
+func TestSortKey(t *testing.T) {
+	for _, test := range sortKeyTests {
+		if kind, _ := SortKey(test.name); kind != test.kind {
+			t.Errorf("Unexpected kind of %s, got:%d expect:%d", test.name, kind, test.kind)
+		}
+	}
+}
+
+var parseValueTests = []struct {
+	name  string
+	value interface{}
+	ok    bool
+}{
+	{`"12"^^` + XSDInteger, int64(12), true},
+	{`"12.5"^^` + XSDInteger, 12.5, true},
+	{`"1.5e3"^^` + XSDDouble, 1500.0, true},
+	{`"true"^^` + XSDBoolean, true, true},
+	{`"0"^^` + XSDBoolean, false, true},
+	{`"2015-03-01"^^` + XSDDate, time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC), true},
+	{`"yes"^^` + XSDBoolean, nil, false},
+	{`"12"^^<http://example.com/type>`, nil, false},
+	{"42", nil, false},
+}
+
+func TestParseValue(t *testing.T) {
+	for _, test := range parseValueTests {
+		v, ok := ParseValue(test.name)
+		if ok != test.ok || v != test.value {
+			t.Errorf("Unexpected value of %s, got:%#v, %t expect:%#v, %t", test.name, v, ok, test.value, test.ok)
+		}
+	}
+}
+
+func TestSortKeyOrder(t *testing.T) {
+	numbers := []float64{math.Inf(-1), -1e300, -2, -1.5, -1e-300, 0, 1e-300, 1, 2.5, 1 << 60, math.Inf(1)}
+	var keys []uint64
+	for _, f := range numbers {
+		keys = append(keys, NumberKey(f))
+	}
+	if !sort.IsSorted(uint64s(keys)) {
+		t.Errorf("Keys of numbers out of order: %v", keys)
+	}
+	if NumberKey(math.Copysign(0, -1)) != NumberKey(0) {
+		t.Errorf("Keys of zeros differ")
+	}
+	times := []time.Time{
+		time.Date(1066, 10, 14, 0, 0, 0, 0, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Unix(0, 0),
+		time.Unix(0, 1000),
+		time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	keys = nil
+	for _, tm := range times {
+		keys = append(keys, TimeKey(tm))
+	}
+	if !sort.IsSorted(uint64s(keys)) {
+		t.Errorf("Keys of times out of order: %v", keys)
+	}
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -17,9 +17,9 @@ package gremlin
 import (
 	"strconv"
 
-	"github.com/barakmich/glog"
 	"github.com/robertkrimen/otto"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
@@ -38,9 +38,43 @@ func buildIteratorTree(obj *otto.Object, qs graph.QuadStore) graph.Iterator {
 	if !isVertexChain(obj) {
 		return iterator.NewNull()
 	}
+	if max := iterator.CurrentGuards().MaxExpansion; max > 0 && expansionOf(obj, max) > max {
+		panic(&iterator.GuardError{Guard: "expansion", Limit: max})
+	}
 	return buildIteratorTreeHelper(obj, qs, iterator.NewNull())
 }
 
+// expansionOf returns the number of steps the chain of obj expands to when
+// built, counting the steps of the chains it follows, intersects, unites or
+// excepts each time. It stops counting once past max, as a chain following
+// itself in turn grows exponentially.
+func expansionOf(obj *otto.Object, max int) int {
+	n := 0
+	for n <= max {
+		n++
+		var subs []otto.Value
+		val, _ := obj.Get("_gremlin_type")
+		switch val.String() {
+		case "followr":
+			sub, _ := obj.Get("_gremlin_followr")
+			subs = append(subs, sub)
+		case "follow", "and", "or", "except":
+			subs = argValues(obj)
+		}
+		for _, sub := range subs {
+			if sub.IsObject() && n <= max {
+				n += expansionOf(sub.Object(), max-n)
+			}
+		}
+		prev, _ := obj.Get("_gremlin_prev")
+		if !prev.IsObject() {
+			break
+		}
+		obj = prev.Object()
+	}
+	return n
+}
+
 func stringsFrom(obj *otto.Object) []string {
 	var output []string
 	lengthValue, _ := obj.Get("length")
@@ -69,7 +103,7 @@ func buildIteratorFromValue(val otto.Value, qs graph.QuadStore) graph.Iterator {
 			it.Add(qs.ValueOf(v))
 			return it
 		default:
-			glog.Errorln("Trying to build unknown primitive value.")
+			clog.Errorln("Trying to build unknown primitive value.")
 		}
 	}
 	switch val.Class() {
@@ -77,12 +111,7 @@ func buildIteratorFromValue(val otto.Value, qs graph.QuadStore) graph.Iterator {
 		return buildIteratorTree(val.Object(), qs)
 	case "Array":
 		// Had better be an array of strings
-		strings := stringsFrom(val.Object())
-		it := qs.FixedIterator()
-		for _, x := range strings {
-			it.Add(qs.ValueOf(x))
-		}
-		return it
+		return graph.FixedIteratorOf(qs, stringsFrom(val.Object())...)
 	case "Number":
 		fallthrough
 	case "Boolean":
@@ -94,15 +123,34 @@ func buildIteratorFromValue(val otto.Value, qs graph.QuadStore) graph.Iterator {
 		it.Add(qs.ValueOf(val.String()))
 		return it
 	default:
-		glog.Errorln("Trying to handle unsupported Javascript value.")
+		clog.Errorln("Trying to handle unsupported Javascript value.")
 		return iterator.NewNull()
 	}
 }
 
+// buildPredicateIterator builds the iterator of the predicates given to Out
+// or In, whose names may be patterns, such as "foaf:*", standing for every
+// predicate they match.
+func buildPredicateIterator(val otto.Value, qs graph.QuadStore) graph.Iterator {
+	var names []string
+	if val.IsString() {
+		names = []string{val.String()}
+	} else if val.Class() == "Array" {
+		names = stringsFrom(val.Object())
+	} else {
+		return buildIteratorFromValue(val, qs)
+	}
+	names, err := graph.ExpandPredicates(qs, names...)
+	if err != nil {
+		clog.Errorf("gremlin: expanding predicates: %v", err)
+	}
+	return graph.FixedIteratorOf(qs, names...)
+}
+
 func buildInOutIterator(obj *otto.Object, qs graph.QuadStore, base graph.Iterator, isReverse bool) graph.Iterator {
 	argList, _ := obj.Get("_gremlin_values")
-	if argList.Class() != "GoArray" {
-		glog.Errorln("How is arglist not an array? Return nothing.", argList.Class())
+	if !argList.IsObject() {
+		clog.Errorln("How is arglist not an array? Return nothing.", argList.Class())
 		return iterator.NewNull()
 	}
 	argArray := argList.Object()
@@ -113,7 +161,7 @@ func buildInOutIterator(obj *otto.Object, qs graph.QuadStore, base graph.Iterato
 		predicateNodeIterator = qs.NodesAllIterator()
 	} else {
 		zero, _ := argArray.Get("0")
-		predicateNodeIterator = buildIteratorFromValue(zero, qs)
+		predicateNodeIterator = buildPredicateIterator(zero, qs)
 	}
 	if length >= 2 {
 		var tags []string
@@ -139,6 +187,23 @@ func buildInOutIterator(obj *otto.Object, qs graph.QuadStore, base graph.Iterato
 	return iterator.NewHasA(qs, and, out)
 }
 
+// queriesOf builds the iterators of the queries joined by a step, given as
+// its arguments, and returns whether there are any, and all of them are
+// queries: paths starting from vertices.
+func queriesOf(obj *otto.Object, qs graph.QuadStore) ([]graph.Iterator, bool) {
+	args := argValues(obj)
+	for _, arg := range args {
+		if !arg.IsObject() || !isVertexChain(arg.Object()) {
+			return nil, false
+		}
+	}
+	its := make([]graph.Iterator, 0, len(args))
+	for _, arg := range args {
+		its = append(its, buildIteratorTree(arg.Object(), qs))
+	}
+	return its, len(its) > 0
+}
+
 func buildIteratorTreeHelper(obj *otto.Object, qs graph.QuadStore, base graph.Iterator) graph.Iterator {
 	// TODO: Better error handling
 	var (
@@ -159,17 +224,24 @@ func buildIteratorTreeHelper(obj *otto.Object, qs graph.QuadStore, base graph.It
 		if len(stringArgs) == 0 {
 			it = qs.NodesAllIterator()
 		} else {
-			fixed := qs.FixedIterator()
-			for _, name := range stringArgs {
-				fixed.Add(qs.ValueOf(name))
-			}
-			it = fixed
+			it = graph.FixedIteratorOf(qs, stringArgs...)
 		}
 	case "tag":
 		it = subIt
 		for _, tag := range stringArgs {
 			it.Tagger().Add(tag)
 		}
+	case "renametag":
+		if len(stringArgs) != 2 {
+			return iterator.NewNull()
+		}
+		it = iterator.NewRetag(subIt, map[string]string{stringArgs[0]: stringArgs[1]})
+	case "droptags":
+		rename := make(map[string]string, len(stringArgs))
+		for _, tag := range stringArgs {
+			rename[tag] = ""
+		}
+		it = iterator.NewRetag(subIt, rename)
 	case "save":
 		all := qs.NodesAllIterator()
 		if len(stringArgs) > 2 || len(stringArgs) == 0 {
@@ -211,13 +283,10 @@ func buildIteratorTreeHelper(obj *otto.Object, qs graph.QuadStore, base graph.It
 		and.AddSubIterator(subIt)
 		it = and
 	case "has":
-		fixed := qs.FixedIterator()
-		if len(stringArgs) < 2 {
+		if len(stringArgs) == 0 || len(argValues(obj)) < 2 {
 			return iterator.NewNull()
 		}
-		for _, name := range stringArgs[1:] {
-			fixed.Add(qs.ValueOf(name))
-		}
+		fixed := nodesOf(obj, qs, 1)
 		predFixed := qs.FixedIterator()
 		predFixed.Add(qs.ValueOf(stringArgs[0]))
 		subAnd := iterator.NewAnd(qs)
@@ -228,19 +297,49 @@ func buildIteratorTreeHelper(obj *otto.Object, qs graph.QuadStore, base graph.It
 		and.AddSubIterator(hasa)
 		and.AddSubIterator(subIt)
 		it = and
+	case "search":
+		if len(stringArgs) != 1 {
+			return iterator.NewNull()
+		}
+		var found graph.Iterator
+		if s, ok := qs.(graph.FullTextSearcher); ok {
+			found = s.SearchIterator(stringArgs[0])
+		} else {
+			found = iterator.NewNull()
+		}
+		and := iterator.NewAnd(qs)
+		and.AddSubIterator(found)
+		and.AddSubIterator(subIt)
+		it = and
+	case "filter":
+		it = buildFilterIterator(obj, qs, subIt)
+	case "near":
+		arg, _ := obj.Get("_gremlin_values")
+		var coords [3]float64
+		for i := range coords {
+			v, _ := arg.Object().Get(strconv.Itoa(i))
+			f, err := v.ToFloat()
+			if err != nil || !v.IsNumber() {
+				return iterator.NewNull()
+			}
+			coords[i] = f
+		}
+		and := iterator.NewAnd(qs)
+		and.AddSubIterator(graph.NearIterator(qs, quad.GeoPoint{Lat: coords[0], Lon: coords[1]}, coords[2]))
+		and.AddSubIterator(subIt)
+		it = and
 	case "morphism":
 		it = base
 	case "and":
-		arg, _ := obj.Get("_gremlin_values")
-		firstArg, _ := arg.Object().Get("0")
-		if !isVertexChain(firstArg.Object()) {
+		argIts, ok := queriesOf(obj, qs)
+		if !ok {
 			return iterator.NewNull()
 		}
-		argIt := buildIteratorTree(firstArg.Object(), qs)
-
 		and := iterator.NewAnd(qs)
 		and.AddSubIterator(subIt)
-		and.AddSubIterator(argIt)
+		for _, argIt := range argIts {
+			and.AddSubIterator(argIt)
+		}
 		it = and
 	case "back":
 		arg, _ := obj.Get("_gremlin_back_chain")
@@ -250,25 +349,21 @@ func buildIteratorTreeHelper(obj *otto.Object, qs graph.QuadStore, base graph.It
 		and.AddSubIterator(argIt)
 		it = and
 	case "is":
-		fixed := qs.FixedIterator()
-		for _, name := range stringArgs {
-			fixed.Add(qs.ValueOf(name))
-		}
+		fixed := nodesOf(obj, qs, 0)
 		and := iterator.NewAnd(qs)
 		and.AddSubIterator(fixed)
 		and.AddSubIterator(subIt)
 		it = and
 	case "or":
-		arg, _ := obj.Get("_gremlin_values")
-		firstArg, _ := arg.Object().Get("0")
-		if !isVertexChain(firstArg.Object()) {
+		argIts, ok := queriesOf(obj, qs)
+		if !ok {
 			return iterator.NewNull()
 		}
-		argIt := buildIteratorTree(firstArg.Object(), qs)
-
 		or := iterator.NewOr()
 		or.AddSubIterator(subIt)
-		or.AddSubIterator(argIt)
+		for _, argIt := range argIts {
+			or.AddSubIterator(argIt)
+		}
 		it = or
 	case "both":
 		// Hardly the most efficient pattern, but the most general.
@@ -300,20 +395,28 @@ func buildIteratorTreeHelper(obj *otto.Object, qs graph.QuadStore, base graph.It
 		it = buildIteratorTreeHelper(arg.Object(), qs, subIt)
 	case "in":
 		it = buildInOutIterator(obj, qs, subIt, true)
+	case "gomorphism":
+		name, _ := obj.Get("_gremlin_morphism")
+		p := morphismNamed(name.String())
+		if p == nil {
+			return iterator.NewNull()
+		}
+		if reverse, _ := obj.Get("_gremlin_reverse"); reverse.IsBoolean() {
+			if r, _ := reverse.ToBoolean(); r {
+				p = p.Reverse()
+			}
+		}
+		it = p.Morphism()(qs, subIt)
 	case "except":
-		arg, _ := obj.Get("_gremlin_values")
-		firstArg, _ := arg.Object().Get("0")
-		if !isVertexChain(firstArg.Object()) {
+		argIts, ok := queriesOf(obj, qs)
+		if !ok {
 			return iterator.NewNull()
 		}
-
-		allIt := qs.NodesAllIterator()
-		toComplementIt := buildIteratorTree(firstArg.Object(), qs)
-		notIt := iterator.NewNot(toComplementIt, allIt)
-
 		and := iterator.NewAnd(qs)
 		and.AddSubIterator(subIt)
-		and.AddSubIterator(notIt)
+		for _, toComplementIt := range argIts {
+			and.AddSubIterator(iterator.NewNot(toComplementIt, qs.NodesAllIterator()))
+		}
 		it = and
 	}
 	if it == nil {
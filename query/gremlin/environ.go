@@ -19,14 +19,18 @@ package gremlin
 import (
 	"sync"
 
-	"github.com/barakmich/glog"
 	"github.com/robertkrimen/otto"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/memory"
+	"github.com/google/cayley/trace"
 )
 
 type worker struct {
 	qs  graph.QuadStore
+	qw  graph.QuadWriter
 	env *otto.Otto
 	sync.Mutex
 
@@ -36,7 +40,32 @@ type worker struct {
 	count int
 	limit int
 
+	// sent is the number of results the query has sent, and max the most
+	// it may send, if not negative.
+	sent int
+	max  int
+
+	// links is set if results are tagged with the quads they were
+	// reached through.
+	links bool
+
 	kill <-chan struct{}
+
+	// span is the span that the steps of queries are traced under.
+	span trace.Span
+
+	// If explain is set, the iterators of the current query are
+	// described in iterators, guarded by the mutex.
+	explain   bool
+	iterators []graph.Description
+
+	// If profile is set, the iterators of the current query are
+	// profiled, and their roots kept in profiles.
+	profile  bool
+	profiles []*iterator.Profile
+
+	// quota accounts for the results the query holds.
+	quota *memory.Quota
 }
 
 func newWorker(qs graph.QuadStore) *worker {
@@ -45,6 +74,7 @@ func newWorker(qs graph.QuadStore) *worker {
 		qs:    qs,
 		env:   env,
 		limit: -1,
+		max:   -1,
 	}
 	graph, _ := env.Object("graph = {}")
 	env.Run("g = graph")
@@ -53,7 +83,7 @@ func newWorker(qs graph.QuadStore) *worker {
 		call.Otto.Run("var out = {}")
 		out, err := call.Otto.Object("out")
 		if err != nil {
-			glog.Error(err.Error())
+			clog.Error(err.Error())
 			return otto.TrueValue()
 		}
 		out.Set("_gremlin_type", "vertex")
@@ -75,11 +105,20 @@ func newWorker(qs graph.QuadStore) *worker {
 		return out.Value()
 	})
 	env.Run("graph.M = graph.Morphism")
+	if m, err := env.Object("graph.M"); err == nil {
+		wk.embedMorphisms(env, m)
+	}
+
+	graph.Set("Transaction", wk.transactionFunc)
 
 	graph.Set("Emit", func(call otto.FunctionCall) otto.Value {
 		value := call.Argument(0)
 		if value.IsDefined() {
-			wk.send(&Result{val: &value})
+			r := &Result{val: &value}
+			if value.IsObject() {
+				r.export = exportValue(value)
+			}
+			wk.send(r)
 		}
 		return otto.NullValue()
 	})
@@ -98,10 +137,8 @@ func argsOf(call otto.FunctionCall) []string {
 			out = append(out, arg.String())
 		}
 		if arg.IsObject() && arg.Class() == "Array" {
-			obj, _ := arg.Export()
-			for _, x := range obj.([]interface{}) {
-				out = append(out, x.(string))
-			}
+			// Arrays may hold the values of typed literals too.
+			out = append(out, stringsFrom(arg.Object())...)
 		}
 	}
 	return out
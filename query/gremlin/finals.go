@@ -17,11 +17,13 @@ package gremlin
 import (
 	"encoding/json"
 
-	"github.com/barakmich/glog"
 	"github.com/robertkrimen/otto"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/memory"
+	"github.com/google/cayley/trace"
 )
 
 const TopResultTag = "id"
@@ -71,21 +73,14 @@ func (wk *worker) toArrayFunc(env *otto.Otto, obj *otto.Object, withTags bool) f
 			limitParsed, _ := call.Argument(0).ToInteger()
 			limit = int(limitParsed)
 		}
-		var val otto.Value
-		var err error
 		if !withTags {
-			array := wk.runIteratorToArrayNoTags(it, limit)
-			val, err = call.Otto.ToValue(array)
-		} else {
-			array := wk.runIteratorToArray(it, limit)
-			val, err = call.Otto.ToValue(array)
+			return jsArray(call.Otto, wk.runIteratorToArrayNoTags(it, limit))
 		}
-
-		if err != nil {
-			glog.Error(err)
-			return otto.NullValue()
+		array, _ := call.Otto.Object("([])")
+		for _, tags := range wk.runIteratorToArray(it, limit) {
+			array.Call("push", jsTags(call.Otto, tags))
 		}
-		return val
+		return array.Value()
 	}
 }
 
@@ -94,26 +89,18 @@ func (wk *worker) toValueFunc(env *otto.Otto, obj *otto.Object, withTags bool) f
 		it := buildIteratorTree(obj, wk.qs)
 		it.Tagger().Add(TopResultTag)
 		limit := 1
-		var val otto.Value
-		var err error
 		if !withTags {
 			array := wk.runIteratorToArrayNoTags(it, limit)
 			if len(array) < 1 {
 				return otto.NullValue()
 			}
-			val, err = call.Otto.ToValue(array[0])
-		} else {
-			array := wk.runIteratorToArray(it, limit)
-			if len(array) < 1 {
-				return otto.NullValue()
-			}
-			val, err = call.Otto.ToValue(array[0])
+			return jsValue(call.Otto, array[0])
 		}
-		if err != nil {
-			glog.Error(err)
+		array := wk.runIteratorToArray(it, limit)
+		if len(array) < 1 {
 			return otto.NullValue()
 		}
-		return val
+		return jsTags(call.Otto, array[0])
 	}
 }
 
@@ -136,17 +123,18 @@ func (wk *worker) mapFunc(env *otto.Otto, obj *otto.Object) func(otto.FunctionCa
 }
 
 func (wk *worker) tagsToValueMap(m map[string]graph.Value) map[string]string {
-	outputMap := make(map[string]string)
-	for k, v := range m {
-		outputMap[k] = wk.qs.NameOf(v)
-	}
-	return outputMap
+	return graph.NamesOfTags(wk.qs, []map[string]graph.Value{m})[0]
 }
 
+// runIteratorToArray collects the tags of each result, and resolves the names
+// of all of them at once.
 func (wk *worker) runIteratorToArray(it graph.Iterator, limit int) []map[string]string {
-	output := make([]map[string]string, 0)
+	output := make([]map[string]graph.Value, 0)
 	n := 0
-	it, _ = it.Optimize()
+	it = wk.optimize(it)
+	max := iterator.CurrentGuards().MaxIntermediate
+	span := trace.Start("iterate", wk.span)
+	defer finishIterate(span, &n)
 	for {
 		select {
 		case <-wk.kill:
@@ -158,7 +146,9 @@ func (wk *worker) runIteratorToArray(it graph.Iterator, limit int) []map[string]
 		}
 		tags := make(map[string]graph.Value)
 		it.TagResults(tags)
-		output = append(output, wk.tagsToValueMap(tags))
+		wk.reserve(it, memory.ResultSize(len(tags)))
+		wk.hold(it, len(output)+1, max)
+		output = append(output, tags)
 		n++
 		if limit >= 0 && n >= limit {
 			break
@@ -171,21 +161,29 @@ func (wk *worker) runIteratorToArray(it graph.Iterator, limit int) []map[string]
 			}
 			tags := make(map[string]graph.Value)
 			it.TagResults(tags)
-			output = append(output, wk.tagsToValueMap(tags))
+			wk.reserve(it, memory.ResultSize(len(tags)))
+			wk.hold(it, len(output)+1, max)
+			output = append(output, tags)
 			n++
 			if limit >= 0 && n >= limit {
 				break
 			}
 		}
 	}
+	wk.checkQuota(it)
 	it.Close()
-	return output
+	resolve := trace.Start("resolve", span)
+	defer resolve.Finish()
+	return graph.NamesOfTags(wk.qs, output)
 }
 
 func (wk *worker) runIteratorToArrayNoTags(it graph.Iterator, limit int) []string {
-	output := make([]string, 0)
+	output := make([]graph.Value, 0)
 	n := 0
-	it, _ = it.Optimize()
+	it = wk.optimize(it)
+	max := iterator.CurrentGuards().MaxIntermediate
+	span := trace.Start("iterate", wk.span)
+	defer finishIterate(span, &n)
 	for {
 		select {
 		case <-wk.kill:
@@ -195,25 +193,32 @@ func (wk *worker) runIteratorToArrayNoTags(it graph.Iterator, limit int) []strin
 		if !graph.Next(it) {
 			break
 		}
-		output = append(output, wk.qs.NameOf(it.Result()))
+		wk.reserve(it, memory.ValueSize)
+		wk.hold(it, len(output)+1, max)
+		output = append(output, it.Result())
 		n++
 		if limit >= 0 && n >= limit {
 			break
 		}
 	}
+	wk.checkQuota(it)
 	it.Close()
-	return output
+	resolve := trace.Start("resolve", span)
+	defer resolve.Finish()
+	return graph.NamesOf(wk.qs, output)
 }
 
 func (wk *worker) runIteratorWithCallback(it graph.Iterator, callback otto.Value, this otto.FunctionCall, limit int) {
 	n := 0
-	it, _ = it.Optimize()
-	if glog.V(2) {
+	it = wk.optimize(it)
+	span := trace.Start("iterate", wk.span)
+	defer finishIterate(span, &n)
+	if clog.V(2) {
 		b, err := json.MarshalIndent(it.Describe(), "", "  ")
 		if err != nil {
-			glog.V(2).Infof("failed to format description: %v", err)
+			clog.V(2).Infof("failed to format description: %v", err)
 		} else {
-			glog.V(2).Infof("%s", b)
+			clog.V(2).Infof("%s", b)
 		}
 	}
 	for {
@@ -227,8 +232,7 @@ func (wk *worker) runIteratorWithCallback(it graph.Iterator, callback otto.Value
 		}
 		tags := make(map[string]graph.Value)
 		it.TagResults(tags)
-		val, _ := this.Otto.ToValue(wk.tagsToValueMap(tags))
-		val, _ = callback.Call(this.This, val)
+		callback.Call(this.This, jsTags(this.Otto, wk.tagsToValueMap(tags)))
 		n++
 		if limit >= 0 && n >= limit {
 			break
@@ -241,21 +245,90 @@ func (wk *worker) runIteratorWithCallback(it graph.Iterator, callback otto.Value
 			}
 			tags := make(map[string]graph.Value)
 			it.TagResults(tags)
-			val, _ := this.Otto.ToValue(wk.tagsToValueMap(tags))
-			val, _ = callback.Call(this.This, val)
+			callback.Call(this.This, jsTags(this.Otto, wk.tagsToValueMap(tags)))
 			n++
 			if limit >= 0 && n >= limit {
 				break
 			}
 		}
 	}
+	wk.checkQuota(it)
 	it.Close()
 }
 
+// optimize optimizes an iterator, tracing the time it takes.
+func (wk *worker) optimize(it graph.Iterator) graph.Iterator {
+	span := trace.Start("optimize", wk.span)
+	it, _ = it.Optimize()
+	if err := iterator.CheckDepth(it); err != nil {
+		span.Finish()
+		it.Close()
+		panic(err)
+	}
+	if wk.quota != nil {
+		iterator.SetQuota(it, wk.quota)
+	}
+	span.SetTag("iterator", it.Type())
+	span.Finish()
+	if wk.explain {
+		d := it.Describe()
+		wk.Lock()
+		wk.iterators = append(wk.iterators, d)
+		wk.Unlock()
+	}
+	if wk.profile {
+		p := iterator.Profiled(it)
+		wk.profiles = append(wk.profiles, p)
+		it = p
+	}
+	return it
+}
+
+// reserve accounts for n bytes of results held by the query, and fails the
+// query if that exceeds its quota.
+func (wk *worker) reserve(it graph.Iterator, n int64) {
+	if err := wk.quota.Reserve(n); err != nil {
+		it.Close()
+		panic(err)
+	}
+}
+
+// hold fails the query if holding n values collected into an array is more
+// than max, the MaxIntermediate guard, allows.
+func (wk *worker) hold(it graph.Iterator, n, max int) {
+	if max > 0 && n > max {
+		it.Close()
+		panic(&iterator.GuardError{Guard: "intermediate", Limit: max})
+	}
+}
+
+// checkQuota fails the query if the iterator stopped because it exceeded the
+// quota of the query, or one of its guards.
+func (wk *worker) checkQuota(it graph.Iterator) {
+	switch err := it.Err().(type) {
+	case *memory.ExceededError:
+		it.Close()
+		panic(err)
+	case *iterator.GuardError:
+		it.Close()
+		panic(err)
+	}
+}
+
+// finishIterate finishes the span of a run of an iterator, which found *n
+// results.
+func finishIterate(span trace.Span, n *int) {
+	span.SetTag("results", *n)
+	span.Finish()
+}
+
 func (wk *worker) send(r *Result) bool {
 	if wk.limit >= 0 && wk.limit == wk.count {
 		return false
 	}
+	if wk.max >= 0 && wk.sent >= wk.max {
+		return false
+	}
 	select {
 	case <-wk.kill:
 		return false
@@ -264,9 +337,13 @@ func (wk *worker) send(r *Result) bool {
 	if wk.results != nil {
 		wk.results <- r
 		wk.count++
+		wk.sent++
 		if wk.limit >= 0 && wk.limit == wk.count {
 			return false
 		}
+		if wk.max >= 0 && wk.sent >= wk.max {
+			return false
+		}
 		return true
 	}
 	return false
@@ -277,13 +354,22 @@ func (wk *worker) runIterator(it graph.Iterator) {
 		iterator.OutputQueryShapeForIterator(it, wk.qs, wk.shape)
 		return
 	}
-	it, _ = it.Optimize()
-	if glog.V(2) {
+	if wk.links {
+		iterator.TagLinks(it)
+	}
+	it = wk.optimize(it)
+	span := trace.Start("iterate", wk.span)
+	start := wk.count
+	defer func() {
+		span.SetTag("results", wk.count-start)
+		span.Finish()
+	}()
+	if clog.V(2) {
 		b, err := json.MarshalIndent(it.Describe(), "", "  ")
 		if err != nil {
-			glog.Infof("failed to format description: %v", err)
+			clog.Infof("failed to format description: %v", err)
 		} else {
-			glog.Infof("%s", b)
+			clog.Infof("%s", b)
 		}
 	}
 	for {
@@ -313,9 +399,10 @@ func (wk *worker) runIterator(it graph.Iterator) {
 			}
 		}
 	}
-	if glog.V(2) {
+	if clog.V(2) {
 		bytes, _ := json.MarshalIndent(graph.DumpStats(it), "", "  ")
-		glog.V(2).Infoln(string(bytes))
+		clog.V(2).Infoln(string(bytes))
 	}
+	wk.checkQuota(it)
 	it.Close()
 }
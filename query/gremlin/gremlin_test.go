@@ -20,10 +20,15 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/graph/path"
+	"github.com/google/cayley/memory"
 	"github.com/google/cayley/quad"
 	"github.com/google/cayley/quad/cquads"
+	"github.com/google/cayley/query"
 
 	_ "github.com/google/cayley/graph/memstore"
 	_ "github.com/google/cayley/writer"
@@ -124,6 +129,27 @@ var testQueries = []struct {
 		`,
 		expect: []string{"alice"},
 	},
+	{
+		message: "use Except with several queries",
+		query: `
+			g.V("alice", "bob", "charlie").Except(g.V("bob"), g.V("charlie")).All()
+		`,
+		expect: []string{"alice"},
+	},
+	{
+		message: "use Difference with a morphism",
+		query: `
+			g.V("bob", "dani", "fred").Difference(g.V("charlie").Follow(g.M().Out("follows"))).All()
+		`,
+		expect: []string{"fred"},
+	},
+	{
+		message: "use Except with something else than a query",
+		query: `
+			g.V("alice", "bob").Except("bob").All()
+		`,
+		expect: nil,
+	},
 
 	// Morphism tests.
 	{
@@ -186,6 +212,28 @@ var testQueries = []struct {
 		`,
 		expect: []string{"charlie"},
 	},
+	{
+		message: "show intersection of several queries",
+		query: `
+			function follows(x) { return g.V(x).Out("follows") }
+			follows("dani").Intersect(follows("charlie"), follows("alice")).All()
+		`,
+		expect: []string{"bob"},
+	},
+	{
+		message: "show union of several queries",
+		query: `
+			g.V("alice").Union(g.V("bob"), g.V("charlie")).All()
+		`,
+		expect: []string{"alice", "bob", "charlie"},
+	},
+	{
+		message: "show intersection with a morphism",
+		query: `
+			g.V("bob", "greg").Intersect(g.M().Out("follows")).All()
+		`,
+		expect: nil,
+	},
 
 	// Gremlin Has tests.
 	{
@@ -307,6 +355,73 @@ func TestGremlin(t *testing.T) {
 	}
 }
 
+func TestGoMorphism(t *testing.T) {
+	RegisterMorphism("grandfollows", path.StartMorphism().Out("follows").Out("follows"))
+	data := []quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "follows", "charlie", ""},
+		{"charlie", "status", "cool", ""},
+	}
+	for _, test := range []struct {
+		query  string
+		expect []string
+	}{
+		{`g.V().Has("follows", "bob").Follow(g.M.grandfollows()).All()`, []string{"charlie"}},
+		{`g.V().Has("status", "cool").FollowR(g.M.grandfollows()).All()`, []string{"alice"}},
+		{`g.V().Has("follows", "bob").Follow(g.M.grandfollows().Has("status", "cool")).All()`, []string{"charlie"}},
+		{`g.V().Has("follows", "bob").Follow(g.M.grandfollows().Has("status", "dull")).All()`, nil},
+	} {
+		got := runQueryGetTag(data, test.query, TopResultTag)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected results for %s, got:%v expect:%v", test.query, got, test.expect)
+		}
+	}
+}
+
+func TestRetag(t *testing.T) {
+	data := []quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"alice", "status", "cool", ""},
+		{"charlie", "follows", "bob", ""},
+	}
+	for _, test := range []struct {
+		query  string
+		tag    string
+		expect []string
+	}{
+		{`g.V().Has("follows", "bob").Tag("who").And(g.V().Has("status", "cool").Tag("who").RenameTag("who", "other")).All()`, "other", []string{"alice"}},
+		{`g.V().Has("follows", "bob").Tag("who").DropTags("who").All()`, "who", nil},
+	} {
+		got := runQueryGetTag(data, test.query, test.tag)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected results for %s, got:%v expect:%v", test.query, got, test.expect)
+		}
+	}
+}
+
+func TestNear(t *testing.T) {
+	eiffel := quad.GeoPoint{Lat: 48.8584, Lon: 2.2945}
+	louvre := quad.GeoPoint{Lat: 48.8606, Lon: 2.3376}
+	data := []quad.Quad{
+		{"eiffel", "location", eiffel.String(), ""},
+		{"louvre", "location", louvre.String(), ""},
+	}
+	for _, test := range []struct {
+		query  string
+		expect []string
+	}{
+		{`g.V().Near(48.8584, 2.2945, 1000).All()`, []string{eiffel.String()}},
+		{`g.V().Near(48.8584, 2.2945, 5000).All()`, []string{eiffel.String(), louvre.String()}},
+		{`g.V().Near(48.8584, "2.2945", 5000).All()`, nil},
+	} {
+		got := runQueryGetTag(data, test.query, TopResultTag)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected results for %s, got:%v expect:%v", test.query, got, test.expect)
+		}
+	}
+}
+
 var issue160TestGraph = []quad.Quad{
 	{"alice", "follows", "bob", ""},
 	{"bob", "follows", "alice", ""},
@@ -330,7 +445,7 @@ func TestIssue160(t *testing.T) {
 
 	ses := makeTestSession(issue160TestGraph)
 	c := make(chan interface{}, 5)
-	go ses.Execute(query, c, 100)
+	go ses.Execute(query, c, -1)
 	var got []string
 	for res := range c {
 		func() {
@@ -347,3 +462,222 @@ func TestIssue160(t *testing.T) {
 		t.Errorf("Unexpected result, got: %q expected: %q", got, expect)
 	}
 }
+
+func TestTransaction(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	w.AddQuadSet(issue160TestGraph)
+	ses := NewSession(qs, -1, false)
+	ses.SetWriter(w)
+
+	query := `
+		var tx = g.Transaction()
+		tx.Add("charlie", "follows", "alice").Remove("bob", "follows", "alice")
+		tx.Commit()
+
+		tx = g.Transaction()
+		tx.Add("emily", "follows", "alice")
+		tx.Add("alice", "follows", "bob")
+		try {
+			tx.Commit()
+		} catch (e) {
+			g.Emit(e.message)
+		}
+	`
+	c := make(chan interface{}, 5)
+	go ses.Execute(query, c, -1)
+	var emitted []string
+	for res := range c {
+		data := res.(*Result)
+		if !data.metaresult && data.val != nil {
+			emitted = append(emitted, data.val.String())
+		}
+	}
+	if expect := []string{graph.ErrQuadExists.Error()}; !reflect.DeepEqual(emitted, expect) {
+		t.Errorf("Unexpected emitted errors, got: %v expected: %v", emitted, expect)
+	}
+
+	var got []string
+	it := qs.QuadIterator(quad.Object, qs.ValueOf("alice"))
+	for graph.Next(it) {
+		if q := qs.Quad(it.Result()); q.Predicate == "follows" {
+			got = append(got, q.Subject)
+		}
+	}
+	sort.Strings(got)
+	expect := []string{"charlie", "dani"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected followers after transactions, got: %v expected: %v", got, expect)
+	}
+
+	ses = NewSession(qs, -1, false)
+	c = make(chan interface{}, 5)
+	go ses.Execute(`g.Transaction()`, c, -1)
+	for res := range c {
+		if r, ok := res.(*Result); !ok || r.err == nil {
+			t.Errorf("Expected error starting transaction without a writer, got: %v", res)
+		}
+	}
+}
+
+func TestQuota(t *testing.T) {
+	ses := makeTestSession(loadGraph("../../data/testdata.nq", t))
+	q := memory.NewQuotaLimit(3 * memory.ValueSize)
+	defer q.Close()
+	ses.SetQuota(q)
+
+	c := make(chan interface{}, 5)
+	go ses.Execute(`g.Emit(g.V().ToValue()); g.Emit(g.V().TagArray().length)`, c, -1)
+	var err error
+	for res := range c {
+		if r := res.(*Result); r.metaresult {
+			err = r.err
+		}
+	}
+	if _, ok := err.(*memory.ExceededError); !ok {
+		t.Errorf("Unexpected error over the quota, got:%v expect:*memory.ExceededError", err)
+	}
+	if _, err := ses.Results(); err == nil {
+		t.Errorf("Expected the results of a query over its quota to fail")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ses := makeTestSession(loadGraph("../../data/testdata.nq", t))
+	// Cancelling while no query runs does nothing.
+	ses.Cancel()
+
+	c := make(chan interface{}, 5)
+	go ses.Execute(`while (true) {}`, c, -1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ses.Cancel()
+	}()
+	for res := range c {
+		ses.Collate(res)
+	}
+	if _, err := ses.Results(); err != ErrKillCancelled {
+		t.Errorf("Unexpected error of a cancelled query, got:%v expect:%v", err, ErrKillCancelled)
+	}
+}
+
+func TestParseMore(t *testing.T) {
+	ses := makeTestSession(loadGraph("../../data/testdata.nq", t))
+	for code, want := range map[string]query.ParseResult{
+		`g.V("alice")`:             query.Parsed,
+		`g.V("alice").Out(`:        query.ParseMore,
+		"function f() {\n  return": query.ParseMore,
+		`g.V("alice"))`:            query.ParseFail,
+	} {
+		if got, _ := ses.Parse(code); got != want {
+			t.Errorf("Unexpected parse of %q, got:%v expect:%v", code, got, want)
+		}
+	}
+}
+
+func TestGuards(t *testing.T) {
+	defer iterator.SetGuards(iterator.Guards{})
+
+	for _, test := range []struct {
+		guards iterator.Guards
+		query  string
+		guard  string
+	}{
+		{
+			guards: iterator.Guards{MaxExpansion: 20},
+			query: `var m = g.M().Has("status", "cool_person");
+				for (var i = 0; i < 5; i++) { m = g.M().Follow(m).Follow(m); }
+				g.V().Follow(m).All()`,
+			guard: "expansion",
+		},
+		{
+			guards: iterator.Guards{MaxIntermediate: 2},
+			query:  `g.Emit(g.V().ToArray().length)`,
+			guard:  "intermediate",
+		},
+		{
+			guards: iterator.Guards{MaxDepth: 2},
+			query:  `g.V().Has("status", "cool_person").Has("status", "cool_person").All()`,
+			guard:  "depth",
+		},
+	} {
+		iterator.SetGuards(test.guards)
+		ses := makeTestSession(loadGraph("../../data/testdata.nq", t))
+		c := make(chan interface{}, 5)
+		go ses.Execute(test.query, c, -1)
+		var err error
+		for res := range c {
+			if r := res.(*Result); r.metaresult && r.err != nil {
+				err = r.err
+			}
+		}
+		if gerr, ok := err.(*iterator.GuardError); !ok || gerr.Guard != test.guard {
+			t.Errorf("Unexpected error for %q, got:%v expect:the %s guard", test.query, err, test.guard)
+		}
+	}
+}
+
+var typedTestGraph = []quad.Quad{
+	{"alice", "age", `"30"^^` + quad.XSDInteger, ""},
+	{"bob", "age", `"25"^^` + quad.XSDInteger, ""},
+	{"alice", "cool", `"true"^^` + quad.XSDBoolean, ""},
+	{"alice", "born", `"1985-03-01T00:00:00Z"^^` + quad.XSDDateTime, ""},
+	{"bob", "born", `"1990-06-01T00:00:00Z"^^` + quad.XSDDateTime, ""},
+}
+
+func TestTypedValueArguments(t *testing.T) {
+	for _, test := range []struct {
+		query  string
+		expect []string
+	}{
+		{`g.V().Has("age", 30).All()`, []string{"alice"}},
+		{`g.V().Has("age", [25, 30]).All()`, []string{"alice", "bob"}},
+		{`g.V().Has("cool", true).All()`, []string{"alice"}},
+		{`g.V().Is(25).All()`, []string{`"25"^^` + quad.XSDInteger}},
+		{`g.V().Filter(">", 26).All()`, []string{`"30"^^` + quad.XSDInteger}},
+		{`g.V().Filter("<", new Date(Date.UTC(1988, 0, 1))).All()`, []string{`"1985-03-01T00:00:00Z"^^` + quad.XSDDateTime}},
+		{`g.V().Filter("<=", '"25"^^<http://www.w3.org/2001/XMLSchema#integer>').All()`, []string{`"25"^^` + quad.XSDInteger}},
+		{`g.V().Filter("~", 26).All()`, nil},
+	} {
+		got := runQueryGetTag(typedTestGraph, test.query, TopResultTag)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected results for %s, got:%v expect:%v", test.query, got, test.expect)
+		}
+	}
+}
+
+func TestTypedValueResults(t *testing.T) {
+	born := time.Date(1985, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		query  string
+		expect []interface{}
+	}{
+		{`g.Emit(g.V().Is(30).ToValue() + 1)`, []interface{}{"31"}},
+		{`g.Emit(g.V().Filter("==", true).ToArray()[0] === true)`, []interface{}{"true"}},
+		{`g.Emit(g.V().Filter("<", new Date(Date.UTC(1988, 0, 1))).ToValue().getUTCFullYear())`, []interface{}{"1985"}},
+		{`g.Emit(g.V().Is(25).TagArray()[0].id * 2)`, []interface{}{"50"}},
+		{`g.V().Is(30).ForEach(function(d) { g.Emit(d.id - 1) })`, []interface{}{"29"}},
+		{`g.Emit({born: g.V().Filter("<", new Date(Date.UTC(1988, 0, 1))).ToValue()})`, []interface{}{map[string]interface{}{"born": born}}},
+		// Emitted tags are exported as the names of their nodes, and other
+		// objects with the values they hold.
+		{`g.Emit(g.V("alice").Tag("who").TagValue())`, []interface{}{map[string]string{"who": "alice", "id": "alice"}}},
+		{`g.Emit(g.V("alice").Tag("who").Out("age").TagValue())`, []interface{}{map[string]string{"who": "alice", "id": `"30"^^` + quad.XSDInteger}}},
+		{`g.V("alice").Out("age").ForEach(function(d) { g.Emit(d) })`, []interface{}{map[string]string{"id": `"30"^^` + quad.XSDInteger}}},
+		{`g.Emit({who: "alice"})`, []interface{}{map[string]interface{}{"who": "alice"}}},
+		{`g.Emit(g.V("bob").Tag("who").TagArray())`, []interface{}{[]map[string]string{{"who": "bob", "id": "bob"}}}},
+	} {
+		ses := makeTestSession(typedTestGraph)
+		c := make(chan interface{}, 5)
+		go ses.Execute(test.query, c, -1)
+		for res := range c {
+			ses.Collate(res)
+		}
+		got, err := ses.Results()
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.query, err)
+		} else if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected results for %s, got:%#v expect:%#v", test.query, got, test.expect)
+		}
+	}
+}
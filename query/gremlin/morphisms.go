@@ -0,0 +1,86 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+// Defines the morphisms built in Go that queries can follow.
+
+import (
+	"sync"
+
+	"github.com/robertkrimen/otto"
+
+	"github.com/google/cayley/graph/path"
+)
+
+var (
+	morphismsMu sync.RWMutex
+	morphisms   = make(map[string]*path.Path)
+)
+
+// RegisterMorphism makes a morphism built in Go available to queries as
+// g.M.name(), to be followed, or extended, like those built with g.M():
+//
+//	gremlin.RegisterMorphism("friendGraph", path.StartMorphism().Out("follows").Out("follows"))
+//
+//	g.V("alice").Follow(g.M.friendGraph()).All()
+//
+// It panics if the name is taken, or if p is bound to a QuadStore. Sessions
+// created before it is called do not see the morphism.
+func RegisterMorphism(name string, p *path.Path) {
+	if !p.IsMorphism() {
+		panic("gremlin: registering a path that is not a morphism: " + name)
+	}
+	morphismsMu.Lock()
+	defer morphismsMu.Unlock()
+	if _, found := morphisms[name]; found {
+		panic("gremlin: already registered morphism " + name)
+	}
+	morphisms[name] = p
+}
+
+// morphismNamed returns the registered morphism of the given name, or nil.
+func morphismNamed(name string) *path.Path {
+	morphismsMu.RLock()
+	defer morphismsMu.RUnlock()
+	return morphisms[name]
+}
+
+// embedMorphisms sets the registered morphisms on m, the g.M function.
+func (wk *worker) embedMorphisms(env *otto.Otto, m *otto.Object) {
+	morphismsMu.RLock()
+	defer morphismsMu.RUnlock()
+	for name := range morphisms {
+		m.Set(name, wk.gremlinMorphism(name, false, env))
+	}
+}
+
+// gremlinMorphism returns the function starting a chain with the named
+// morphism, in reverse if reverse is set.
+func (wk *worker) gremlinMorphism(name string, reverse bool, env *otto.Otto) func(otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		out := newGoMorphism(call.Otto, name, reverse)
+		wk.embedTraversals(env, out)
+		return out.Value()
+	}
+}
+
+func newGoMorphism(env *otto.Otto, name string, reverse bool) *otto.Object {
+	env.Run("var out = {}")
+	out, _ := env.Object("out")
+	out.Set("_gremlin_type", "gomorphism")
+	out.Set("_gremlin_morphism", name)
+	out.Set("_gremlin_reverse", reverse)
+	return out
+}
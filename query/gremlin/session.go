@@ -18,6 +18,8 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/robertkrimen/otto"
@@ -25,24 +27,54 @@ import (
 	_ "github.com/robertkrimen/otto/underscore"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/memory"
 	"github.com/google/cayley/query"
+	"github.com/google/cayley/trace"
 )
 
 var ErrKillTimeout = errors.New("query timed out")
 
+// ErrKillCancelled is the error of a query that was cancelled as it ran.
+var ErrKillCancelled = errors.New("query cancelled")
+
 type Session struct {
 	qs graph.QuadStore
 
+	// run serializes the queries of the session, which share its
+	// JavaScript runtime, so that a query started while another runs
+	// waits for it. Queries meant to run at once need sessions of their
+	// own.
+	run sync.Mutex
+
 	wk      *worker
-	script  *otto.Script
 	persist *otto.Otto
 
+	// script is the last query parsed, compiled from source.
+	script *otto.Script
+	source string
+
 	timeout time.Duration
 	kill    chan struct{}
 
+	// running and killErr, guarded by the worker, are whether a query
+	// runs and why it was killed, if it was.
+	running bool
+	killErr error
+
 	debug      bool
 	dataOutput []interface{}
 
+	// links collects the quads the results were reached through, if
+	// the session returns the subgraph of its queries.
+	links *query.LinkSet
+
+	// quota accounts for the results of queries, which are collated
+	// while the query runs, so a collation over the quota is recorded
+	// in collateErr rather than err.
+	quota      *memory.Quota
+	collateErr error
+
 	err error
 }
 
@@ -63,15 +95,75 @@ type Result struct {
 	err           error
 	val           *otto.Value
 	actualResults map[string]graph.Value
+
+	// export is the object emitted, exported as the script emitted it,
+	// since the environment of the script is not to be used as it runs.
+	export interface{}
+}
+
+// SetWriter allows scripts to change the graph through the given writer,
+// using graph.Transaction().
+func (s *Session) SetWriter(qw graph.QuadWriter) {
+	s.wk.qw = qw
+}
+
+// SetSpan sets the span that the steps of queries are traced under.
+func (s *Session) SetSpan(span trace.Span) {
+	s.wk.span = span
+}
+
+// Explain sets whether the session records the iterators of its queries.
+func (s *Session) Explain(ok bool) {
+	s.wk.explain = ok
+}
+
+// Iterators returns the descriptions of the iterators the current query has
+// run so far.
+func (s *Session) Iterators() []graph.Description {
+	s.wk.Lock()
+	defer s.wk.Unlock()
+	return append([]graph.Description(nil), s.wk.iterators...)
+}
+
+// Profile sets whether the session profiles the iterators of its queries.
+func (s *Session) Profile(ok bool) {
+	s.wk.profile = ok
+}
+
+// Profiles returns the profiles of the iterators the last query ran.
+func (s *Session) Profiles() []iterator.IteratorProfile {
+	var profiles []iterator.IteratorProfile
+	for _, p := range s.wk.profiles {
+		profiles = append(profiles, p.Profile())
+	}
+	return profiles
+}
+
+// SetQuota sets the memory quota of the queries of the session.
+func (s *Session) SetQuota(q *memory.Quota) {
+	s.quota = q
+	s.wk.quota = q
 }
 
 func (s *Session) Debug(ok bool) {
 	s.debug = ok
 }
 
+// Subgraph sets whether Results returns the quads the results of a query
+// were reached through. Values emitted by scripts are left out.
+func (s *Session) Subgraph(ok bool) {
+	s.wk.links = ok
+	s.links = nil
+	if ok {
+		s.links = query.NewLinkSet(s.qs)
+	}
+}
+
 func (s *Session) ShapeOf(query string) (interface{}, error) {
 	// TODO(kortschak) It would be nice to be able
 	// to return an error for bad queries here.
+	s.run.Lock()
+	defer s.run.Unlock()
 	s.wk.shape = make(map[string]interface{})
 	s.wk.env.Run(query)
 	out := s.wk.shape
@@ -80,20 +172,39 @@ func (s *Session) ShapeOf(query string) (interface{}, error) {
 }
 
 func (s *Session) Parse(input string) (query.ParseResult, error) {
+	s.run.Lock()
+	defer s.run.Unlock()
 	script, err := s.wk.env.Compile("", input)
 	if err != nil {
+		if strings.Contains(err.Error(), "Unexpected end of input") {
+			// Such as an unclosed block, which is continued on the
+			// next line.
+			return query.ParseMore, nil
+		}
 		return query.ParseFail, err
 	}
-	s.script = script
+	s.script, s.source = script, input
 	return query.Parsed, nil
 }
 
-func (s *Session) runUnsafe(input interface{}) (otto.Value, error) {
+func (s *Session) runUnsafe(input interface{}) (_ otto.Value, err error) {
 	wk := s.wk
 	defer func() {
 		if r := recover(); r != nil {
-			if r == ErrKillTimeout {
-				s.err = ErrKillTimeout
+			if r == ErrKillTimeout || r == ErrKillCancelled {
+				s.err = r.(error)
+				wk.env = s.persist
+				return
+			}
+			if e, ok := r.(*memory.ExceededError); ok {
+				s.err = e
+				err = e
+				wk.env = s.persist
+				return
+			}
+			if e, ok := r.(*iterator.GuardError); ok {
+				s.err = e
+				err = e
 				wk.env = s.persist
 				return
 			}
@@ -101,44 +212,73 @@ func (s *Session) runUnsafe(input interface{}) (otto.Value, error) {
 		}
 	}()
 
+	wk.Lock()
 	// Use buffered chan to prevent blocking.
 	wk.env.Interrupt = make(chan func(), 1)
 	s.kill = make(chan struct{})
 	wk.kill = s.kill
+	s.running, s.killErr = true, nil
+	env := wk.env
+	wk.Unlock()
+	defer func() {
+		wk.Lock()
+		s.running = false
+		wk.Unlock()
+	}()
 
 	done := make(chan struct{})
 	defer close(done)
 	if s.timeout >= 0 {
 		go func() {
-			time.Sleep(s.timeout)
 			select {
 			case <-done:
-			default:
-				close(s.kill)
-				wk.Lock()
-				if wk.env != nil {
-					wk.env.Interrupt <- func() {
-						panic(ErrKillTimeout)
-					}
-				}
-				wk.Unlock()
+			case <-time.After(s.timeout):
+				s.stop(ErrKillTimeout)
 			}
 		}()
 	}
+	return env.Run(input)
+}
 
+// stop kills the query being run, if any, making it fail with err.
+func (s *Session) stop(err error) {
+	wk := s.wk
 	wk.Lock()
-	env := wk.env
-	wk.Unlock()
-	return env.Run(input)
+	defer wk.Unlock()
+	if !s.running || s.killErr != nil {
+		return
+	}
+	s.killErr = err
+	close(s.kill)
+	if wk.env != nil {
+		wk.env.Interrupt <- func() {
+			panic(err)
+		}
+	}
+}
+
+// Cancel kills the query being run, which fails with ErrKillCancelled.
+func (s *Session) Cancel() {
+	s.stop(ErrKillCancelled)
 }
 
-func (s *Session) Execute(input string, out chan interface{}, _ int) {
+// Execute runs a query, sending at most limit results to out if limit is not
+// negative.
+func (s *Session) Execute(input string, out chan interface{}, limit int) {
 	defer close(out)
+	s.run.Lock()
+	defer s.run.Unlock()
 	s.err = nil
+	s.wk.Lock()
+	s.wk.iterators = nil
+	s.wk.Unlock()
+	s.wk.profiles = nil
 	s.wk.results = out
+	s.wk.sent, s.wk.max = 0, limit
 	var err error
 	var value otto.Value
-	if s.script == nil {
+	if s.script == nil || s.source != input {
+		// Not the query parsed last, as when another was parsed since.
 		value, err = s.runUnsafe(input)
 	} else {
 		value, err = s.runUnsafe(s.script)
@@ -149,7 +289,7 @@ func (s *Session) Execute(input string, out chan interface{}, _ int) {
 		val:        &value,
 	}
 	s.wk.results = nil
-	s.script = nil
+	s.script, s.source = nil, ""
 	s.wk.Lock()
 	s.wk.env = s.persist
 	s.wk.Unlock()
@@ -192,8 +332,9 @@ func (s *Session) Format(result interface{}) string {
 		}
 	} else {
 		if data.val.IsObject() {
-			export, _ := data.val.Export()
-			switch export := export.(type) {
+			switch export := data.export.(type) {
+			case time.Time:
+				out += fmt.Sprintf("%s\n", export.Format(time.RFC3339Nano))
 			case map[string]string:
 				for k, v := range export {
 					out += fmt.Sprintf("%s : %s\n", k, v)
@@ -216,6 +357,15 @@ func (s *Session) Format(result interface{}) string {
 // Web stuff
 func (s *Session) Collate(result interface{}) {
 	data := result.(*Result)
+	if s.collateErr != nil {
+		return
+	}
+	if s.links != nil {
+		if !data.metaresult && data.val == nil {
+			s.links.Add(data.actualResults)
+		}
+		return
+	}
 	if !data.metaresult {
 		if data.val == nil {
 			obj := make(map[string]string)
@@ -233,13 +383,12 @@ func (s *Session) Collate(result interface{}) {
 					delete(obj, k)
 				}
 			}
-			if len(obj) != 0 {
+			if len(obj) != 0 && s.reserve(memory.ResultSize(len(obj))) {
 				s.dataOutput = append(s.dataOutput, obj)
 			}
-		} else {
+		} else if s.reserve(memory.ValueSize) {
 			if data.val.IsObject() {
-				export, _ := data.val.Export()
-				s.dataOutput = append(s.dataOutput, export)
+				s.dataOutput = append(s.dataOutput, data.export)
 			} else {
 				strVersion, _ := data.val.ToString()
 				s.dataOutput = append(s.dataOutput, strVersion)
@@ -253,14 +402,91 @@ func (s *Session) Results() (interface{}, error) {
 	if s.err != nil {
 		return nil, s.err
 	}
+	if s.collateErr != nil {
+		return nil, s.collateErr
+	}
 	select {
 	case <-s.kill:
-		return nil, ErrKillTimeout
+		return nil, s.killErr
 	default:
+		if s.links != nil {
+			return s.links.Quads(), nil
+		}
 		return s.dataOutput, nil
 	}
 }
 
+// reserve accounts for n bytes of collated results, and records the error if
+// that exceeds the quota.
+func (s *Session) reserve(n int64) bool {
+	if err := s.quota.Reserve(n); err != nil {
+		s.collateErr = err
+		s.dataOutput = nil
+		return false
+	}
+	return true
+}
+
 func (s *Session) Clear() {
 	s.dataOutput = nil
+	s.collateErr = nil
+	if s.links != nil {
+		s.links = query.NewLinkSet(s.qs)
+	}
+}
+
+// jsGlobals are the JavaScript builtins a query may start with.
+var jsGlobals = []string{
+	"Array", "Boolean", "Date", "JSON", "Math", "Number", "Object", "RegExp",
+	"String", "isNaN", "parseFloat", "parseInt", "undefined",
+}
+
+// Globals returns the names of the JavaScript builtins and of the variables
+// of the session, such as g and those it has defined.
+func (s *Session) Globals() []string {
+	return append(s.keys("Object.keys(this)"), jsGlobals...)
+}
+
+// Members returns the names of the functions of g, and of the steps and
+// finals of paths.
+func (s *Session) Members() []string {
+	var names []string
+	for _, name := range s.keys("Object.keys(g).concat(Object.keys(g.V()), Object.keys(g.M()))") {
+		if !strings.HasPrefix(name, "_") && name != "string_args" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// keys returns the names in the array the given script evaluates to, sorted
+// and without duplicates.
+func (s *Session) keys(script string) []string {
+	v, err := s.wk.env.Run(script)
+	if err != nil {
+		return nil
+	}
+	e, _ := v.Export()
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	switch e := e.(type) {
+	case []string:
+		for _, name := range e {
+			add(name)
+		}
+	case []interface{}:
+		for _, name := range e {
+			if name, ok := name.(string); ok {
+				add(name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
 }
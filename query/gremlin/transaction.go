@@ -0,0 +1,70 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+// Defines graph.Transaction(), which lets a script change the graph.
+
+import (
+	"github.com/robertkrimen/otto"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func (wk *worker) transactionFunc(call otto.FunctionCall) otto.Value {
+	if wk.qw == nil {
+		panic(call.Otto.MakeCustomError("TransactionError", "the database is read-only"))
+	}
+	tx := graph.NewTransaction()
+	done := false
+	change := func(f func(*graph.Transaction, quad.Quad)) func(otto.FunctionCall) otto.Value {
+		return func(call otto.FunctionCall) otto.Value {
+			if done {
+				panic(call.Otto.MakeCustomError("TransactionError", "transaction already finished"))
+			}
+			args := argsOf(call)
+			if len(args) != 3 && len(args) != 4 {
+				panic(call.Otto.MakeTypeError("expected subject, predicate, object and optional label"))
+			}
+			q := quad.Quad{Subject: args[0], Predicate: args[1], Object: args[2]}
+			if len(args) == 4 {
+				q.Label = args[3]
+			}
+			f(tx, q)
+			return call.This
+		}
+	}
+
+	call.Otto.Run("var out = {}")
+	out, _ := call.Otto.Object("out")
+	out.Set("Add", change((*graph.Transaction).AddQuad))
+	out.Set("Remove", change((*graph.Transaction).RemoveQuad))
+	out.Set("Commit", func(call otto.FunctionCall) otto.Value {
+		if done {
+			panic(call.Otto.MakeCustomError("TransactionError", "transaction already finished"))
+		}
+		done = true
+		err := wk.qw.ApplyTransaction(tx)
+		if err != nil {
+			panic(call.Otto.MakeCustomError("TransactionError", err.Error()))
+		}
+		return otto.TrueValue()
+	})
+	out.Set("Rollback", func(call otto.FunctionCall) otto.Value {
+		done = true
+		return otto.TrueValue()
+	})
+	return out.Value()
+}
@@ -17,8 +17,9 @@ package gremlin
 // Adds special traversal functions to JS Gremlin objects. Most of these just build the chain of objects, and won't often need the session.
 
 import (
-	"github.com/barakmich/glog"
 	"github.com/robertkrimen/otto"
+
+	"github.com/google/cayley/clog"
 )
 
 func (wk *worker) embedTraversals(env *otto.Otto, obj *otto.Object) {
@@ -35,7 +36,12 @@ func (wk *worker) embedTraversals(env *otto.Otto, obj *otto.Object) {
 	obj.Set("Back", wk.gremlinBack("back", obj, env))
 	obj.Set("Tag", wk.gremlinFunc("tag", obj, env))
 	obj.Set("As", wk.gremlinFunc("tag", obj, env))
+	obj.Set("RenameTag", wk.gremlinFunc("renametag", obj, env))
+	obj.Set("DropTags", wk.gremlinFunc("droptags", obj, env))
 	obj.Set("Has", wk.gremlinFunc("has", obj, env))
+	obj.Set("Filter", wk.gremlinFunc("filter", obj, env))
+	obj.Set("Search", wk.gremlinFunc("search", obj, env))
+	obj.Set("Near", wk.gremlinFunc("near", obj, env))
 	obj.Set("Save", wk.gremlinFunc("save", obj, env))
 	obj.Set("SaveR", wk.gremlinFunc("saver", obj, env))
 	obj.Set("Except", wk.gremlinFunc("except", obj, env))
@@ -120,7 +126,7 @@ func reverseGremlinChainTo(env *otto.Otto, prev *otto.Object, tag string) (*otto
 	env.Run("var _base_object = {}")
 	base, err := env.Object("_base_object")
 	if err != nil {
-		glog.Error(err)
+		clog.Error(err)
 		return otto.NullValue().Object(), otto.NullValue().Object()
 	}
 	if isVertexChain(prev) {
@@ -149,6 +155,16 @@ func reverseGremlinChainHelper(env *otto.Otto, chain *otto.Object, newBase *otto
 	if kind == "morphism" || kind == "vertex" {
 		return newBase, chain
 	}
+	if kind == "gomorphism" {
+		// Morphisms built in Go start their chains: the reversed chain
+		// ends with the morphism, reversed.
+		name, _ := chain.Get("_gremlin_morphism")
+		reverse, _ := chain.Get("_gremlin_reverse")
+		r, _ := reverse.ToBoolean()
+		out := newGoMorphism(env, name.String(), !r)
+		out.Set("_gremlin_prev", newBase)
+		return out, chain
+	}
 	var newKind string
 	switch kind {
 	case "in":
@@ -174,7 +190,7 @@ func reverseGremlinChainHelper(env *otto.Otto, chain *otto.Object, newBase *otto
 
 func debugChain(obj *otto.Object) bool {
 	val, _ := obj.Get("_gremlin_type")
-	glog.V(2).Infoln(val)
+	clog.V(2).Infoln(val)
 	val, _ = obj.Get("_gremlin_prev")
 	if val.IsObject() {
 		return debugChain(val.Object())
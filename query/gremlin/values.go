@@ -0,0 +1,282 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+// Converts between the values of typed literals and the JavaScript numbers,
+// booleans and dates holding them, for paths to filter by, and for finals to
+// return.
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/robertkrimen/otto"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// goValue returns the Go value of a JavaScript number, boolean or Date.
+func goValue(val otto.Value) (interface{}, bool) {
+	switch {
+	case val.IsNumber():
+		f, err := val.ToFloat()
+		return f, err == nil
+	case val.IsBoolean():
+		b, err := val.ToBoolean()
+		return b, err == nil
+	case val.Class() == "Date":
+		ms, err := val.Object().Call("getTime")
+		if err != nil {
+			return nil, false
+		}
+		n, err := ms.ToInteger()
+		if err != nil {
+			return nil, false
+		}
+		return time.Unix(0, n*int64(time.Millisecond)).UTC(), true
+	}
+	return nil, false
+}
+
+// jsValue returns the value a node holds as a JavaScript number, boolean or
+// Date, if it is a typed literal of one, and else its name.
+func jsValue(env *otto.Otto, name string) otto.Value {
+	v, _ := quad.ParseValue(name)
+	var val otto.Value
+	var err error
+	switch v := v.(type) {
+	case int64, float64, bool:
+		val, err = env.ToValue(v)
+	case time.Time:
+		val, err = env.Call("new Date", nil, v.UnixNano()/int64(time.Millisecond))
+	default:
+		val, err = env.ToValue(name)
+	}
+	if err != nil {
+		clog.Errorf("gremlin: converting %q: %v", name, err)
+		return otto.NullValue()
+	}
+	return val
+}
+
+// jsArray returns the nodes of the given names as a JavaScript array of their
+// values.
+func jsArray(env *otto.Otto, names []string) otto.Value {
+	array, _ := env.Object("([])")
+	for _, name := range names {
+		array.Call("push", jsValue(env, name))
+	}
+	return array.Value()
+}
+
+// tagsProperty is the property, hidden from scripts, holding the names of the
+// nodes a tag object was made from.
+const tagsProperty = "_gremlin_tags"
+
+// jsTags returns the nodes of tags as a JavaScript object of their values.
+// The names of the nodes are kept with it, so that the object is exported as
+// the map[string]string of tags it was made from if it is emitted.
+func jsTags(env *otto.Otto, tags map[string]string) otto.Value {
+	obj, _ := env.Object("({})")
+	for tag, name := range tags {
+		obj.Set(tag, jsValue(env, name))
+	}
+	_, err := env.Call("Object.defineProperty", nil, obj, tagsProperty, map[string]interface{}{"value": tags})
+	if err != nil {
+		clog.Errorf("gremlin: keeping tags: %v", err)
+	}
+	return obj.Value()
+}
+
+// exportValue is val.Export, exporting Dates, in objects and arrays too, as
+// times rather than as empty objects. The tag objects of results, as made by
+// jsTags, are exported as the map[string]string of their tags, and arrays of
+// them as []map[string]string; other objects are map[string]interface{}.
+func exportValue(val otto.Value) interface{} {
+	switch val.Class() {
+	case "Date":
+		t, _ := goValue(val)
+		return t
+	case "Object":
+		obj := val.Object()
+		if t, _ := obj.Get(tagsProperty); t.IsDefined() {
+			if tags, _ := t.Export(); tags != nil {
+				if tags, ok := tags.(map[string]string); ok {
+					return tags
+				}
+			}
+		}
+		m := make(map[string]interface{})
+		for _, key := range obj.Keys() {
+			v, _ := obj.Get(key)
+			if v.IsDefined() {
+				m[key] = exportValue(v)
+			}
+		}
+		return m
+	case "Array":
+		obj := val.Object()
+		lengthVal, _ := obj.Get("length")
+		length, _ := lengthVal.ToInteger()
+		nested := false
+		for i := int64(0); i < length && !nested; i++ {
+			v, _ := obj.Get(strconv.FormatInt(i, 10))
+			nested = v.Class() == "Date" || v.Class() == "Object" || v.Class() == "Array"
+		}
+		if !nested {
+			break
+		}
+		var list []interface{}
+		var tags []map[string]string
+		for i := int64(0); i < length; i++ {
+			v, _ := obj.Get(strconv.FormatInt(i, 10))
+			list = append(list, exportValue(v))
+			if m, ok := list[i].(map[string]string); ok && len(tags) == int(i) {
+				tags = append(tags, m)
+			}
+		}
+		if len(tags) == len(list) {
+			return tags
+		}
+		return list
+	}
+	e, _ := val.Export()
+	return e
+}
+
+// valueIterator returns the iterator of the nodes holding v: those sorting
+// as it does in the range indexes, or the canonical literal of a boolean.
+func valueIterator(qs graph.QuadStore, v interface{}) graph.Iterator {
+	if b, ok := v.(bool); ok {
+		fixed := qs.FixedIterator()
+		name := `"` + strconv.FormatBool(b) + `"^^` + quad.XSDBoolean
+		if val := qs.ValueOf(name); qs.NameOf(val) == name {
+			fixed.Add(val)
+		}
+		return fixed
+	}
+	if kind, _ := quad.ValueSortKey(v); kind == quad.NoValue {
+		return iterator.NewNull()
+	}
+	it := iterator.NewComparison(qs.NodesAllIterator(), iterator.CompareGTE, v, qs)
+	return iterator.NewComparison(it, iterator.CompareLTE, v, qs)
+}
+
+// nodesOf returns the iterator of the nodes given by the arguments of a step,
+// from the first: names, arrays of them, and numbers, booleans and Dates,
+// standing for the nodes that hold them.
+func nodesOf(obj *otto.Object, qs graph.QuadStore, first int) graph.Iterator {
+	var (
+		names  []string
+		values []interface{}
+	)
+	add := func(val otto.Value) {
+		if val.IsString() {
+			names = append(names, val.String())
+		} else if v, ok := goValue(val); ok {
+			values = append(values, v)
+		}
+	}
+	for _, arg := range argValues(obj)[first:] {
+		if arg.Class() != "Array" {
+			add(arg)
+			continue
+		}
+		array := arg.Object()
+		lengthVal, _ := array.Get("length")
+		length, _ := lengthVal.ToInteger()
+		for i := int64(0); i < length; i++ {
+			v, _ := array.Get(strconv.FormatInt(i, 10))
+			add(v)
+		}
+	}
+	fixed := graph.FixedIteratorOf(qs, names...)
+	if len(values) == 0 {
+		return fixed
+	}
+	or := iterator.NewOr()
+	or.AddSubIterator(fixed)
+	for _, v := range values {
+		or.AddSubIterator(valueIterator(qs, v))
+	}
+	return or
+}
+
+// argValues returns the arguments a step was called with.
+func argValues(obj *otto.Object) []otto.Value {
+	argList, _ := obj.Get("_gremlin_values")
+	if !argList.IsObject() {
+		return nil
+	}
+	args := argList.Object()
+	lengthVal, _ := args.Get("length")
+	length, _ := lengthVal.ToInteger()
+	vals := make([]otto.Value, 0, length)
+	for i := int64(0); i < length; i++ {
+		v, _ := args.Get(strconv.FormatInt(i, 10))
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+// filterOperators are the comparisons path.Filter makes.
+var filterOperators = map[string]iterator.Operator{
+	"<":  iterator.CompareLT,
+	"<=": iterator.CompareLTE,
+	">":  iterator.CompareGT,
+	">=": iterator.CompareGTE,
+}
+
+// buildFilterIterator builds the iterator of the nodes of sub holding values
+// that compare to a value as an operator asks, both given as the arguments of
+// obj. The value is a number, a boolean, a Date, or the name of a typed
+// literal; booleans are only equal or not.
+func buildFilterIterator(obj *otto.Object, qs graph.QuadStore, sub graph.Iterator) graph.Iterator {
+	args := argValues(obj)
+	if len(args) != 2 || !args[0].IsString() {
+		return iterator.NewNull()
+	}
+	v, ok := goValue(args[1])
+	if !ok && args[1].IsString() {
+		v, ok = quad.ParseValue(args[1].String())
+	}
+	if !ok {
+		return iterator.NewNull()
+	}
+	switch op := args[0].String(); op {
+	case "==", "===":
+		and := iterator.NewAnd(qs)
+		and.AddSubIterator(valueIterator(qs, v))
+		and.AddSubIterator(sub)
+		return and
+	default:
+		cmp, ok := filterOperators[op]
+		if !ok {
+			return iterator.NewNull()
+		}
+		if _, isBool := v.(bool); isBool {
+			return iterator.NewNull()
+		}
+		if kind, _ := quad.ValueSortKey(v); kind == quad.NoValue {
+			if _, ok := quad.CompareValues(v, v); !ok {
+				return iterator.NewNull()
+			}
+		}
+		return iterator.NewComparison(sub, cmp, v, qs)
+	}
+}
@@ -26,9 +26,7 @@ import (
 )
 
 func (q *Query) buildFixed(s string) graph.Iterator {
-	f := q.ses.qs.FixedIterator()
-	f.Add(q.ses.qs.ValueOf(s))
-	return f
+	return graph.FixedIteratorOf(q.ses.qs, s)
 }
 
 func (q *Query) buildResultIterator(path Path) graph.Iterator {
@@ -60,8 +58,9 @@ func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it grap
 		// Things which are really bool-like are special cases and will be dealt with separately.
 		if t {
 			it = q.buildFixed("true")
+		} else {
+			it = q.buildFixed("false")
 		}
-		it = q.buildFixed("false")
 	case float64:
 		// for JSON numbers
 		// Damn you, Javascript, and your lack of integer values.
@@ -87,12 +86,15 @@ func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it grap
 		}
 	case map[string]interface{}:
 		// for JSON objects
-		it, err = q.buildIteratorTreeMapInternal(t, path)
+		optional, err = optionalOf(t)
+		if err == nil {
+			it, err = q.buildIteratorTreeMapInternal(t, path)
+		}
 	case nil:
 		it = q.buildResultIterator(path)
 		optional = true
 	default:
-		err = fmt.Errorf("Unknown JSON type: %T")
+		err = fmt.Errorf("Unknown JSON type: %T", query)
 	}
 	if err != nil {
 		return nil, false, err
@@ -108,8 +110,16 @@ func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path
 	err = nil
 	outputStructure := make(map[string]interface{})
 	for key, subquery := range query {
+		if key == "optional" {
+			// A directive, not a property.
+			continue
+		}
 		optional := false
 		outputStructure[key] = nil
+		if _, ok := subquery.([]interface{}); ok {
+			// Lists of values the node lacks are empty, not null.
+			outputStructure[key] = []interface{}{}
+		}
 		reverse := false
 		pred := key
 		if strings.HasPrefix(pred, "@") {
@@ -165,6 +175,27 @@ func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path
 	return it, nil
 }
 
+// optionalOf returns whether the object of a query is optional, as its
+// "optional" directive says: true or "optional", or false or "required".
+// The property whose value it is is null for nodes that lack one, or, if it
+// is in a list, the empty list.
+func optionalOf(query map[string]interface{}) (bool, error) {
+	switch v := query["optional"].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case string:
+		switch v {
+		case "optional":
+			return true, nil
+		case "required":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("invalid optional directive: %v", query["optional"])
+}
+
 type byRecordLength []ResultPath
 
 func (p byRecordLength) Len() int {
@@ -22,12 +22,20 @@ import (
 
 func (q *Query) treeifyResult(tags map[string]graph.Value) map[ResultPath]string {
 	// Transform the map into something a little more interesting.
-	results := make(map[Path]string)
+	var (
+		keys   []Path
+		values []graph.Value
+	)
 	for k, v := range tags {
 		if v == nil {
 			continue
 		}
-		results[Path(k)] = q.ses.qs.NameOf(v)
+		keys = append(keys, Path(k))
+		values = append(values, v)
+	}
+	results := make(map[Path]string, len(keys))
+	for i, name := range graph.NamesOf(q.ses.qs, values) {
+		results[keys[i]] = name
 	}
 	resultPaths := make(map[ResultPath]string)
 	for k, v := range results {
@@ -17,11 +17,14 @@ package mql
 import (
 	"encoding/json"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/google/cayley/graph"
 	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/memory"
 	"github.com/google/cayley/quad"
+	"github.com/google/cayley/trace"
 	_ "github.com/google/cayley/writer"
 )
 
@@ -165,6 +168,49 @@ var testQueries = []struct {
 			]
 		`,
 	},
+	{
+		message: "get empty lists for missing values",
+		query:   `[{"id": null, "status": "cool", "follows": []}]`,
+		expect: `
+			[
+				{"id": "B", "status": "cool", "follows": ["F"]},
+				{"id": "D", "status": "cool", "follows": ["B", "G"]},
+				{"id": "G", "status": "cool", "follows": []}
+			]
+		`,
+	},
+	{
+		message: "get optional reverse structs",
+		query:   `[{"id": null, "status": "cool", "!follows": {"id": "A", "optional": true}}]`,
+		expect: `
+			[
+				{"id": "B", "status": "cool", "!follows": {"id": "A"}},
+				{"id": "D", "status": "cool", "!follows": null},
+				{"id": "G", "status": "cool", "!follows": null}
+			]
+		`,
+	},
+	{
+		message: "get nested optional structs",
+		query:   `[{"id": "C", "follows": [{"id": null, "follows": {"id": null, "status": "cool", "optional": "optional"}}]}]`,
+		expect: `
+			[
+				{"id": "C", "follows": [
+					{"id": "B", "follows": null},
+					{"id": "D", "follows": {"id": "G", "status": "cool"}}
+				]}
+			]
+		`,
+	},
+	{
+		message: "require structs that are not optional",
+		query:   `[{"id": null, "status": "cool", "!follows": {"id": "A", "optional": "required"}}]`,
+		expect: `
+			[
+				{"id": "B", "status": "cool", "!follows": {"id": "A"}}
+			]
+		`,
+	},
 }
 
 func runQuery(g []quad.Quad, query string) interface{} {
@@ -192,3 +238,97 @@ func TestMQL(t *testing.T) {
 		}
 	}
 }
+
+func TestSubgraph(t *testing.T) {
+	s := makeTestSession(simpleGraph)
+	s.Subgraph(true)
+	c := make(chan interface{}, 5)
+	go s.Execute(`[{"id": null, "status": "cool", "follows": "G"}]`, c, -1)
+	for result := range c {
+		s.Collate(result)
+	}
+	result, err := s.Results()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := make(map[quad.Quad]bool)
+	for _, q := range result.([]quad.Quad) {
+		got[q] = true
+	}
+	expect := map[quad.Quad]bool{
+		{"D", "follows", "G", ""}:               true,
+		{"D", "status", "cool", "status_graph"}: true,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected subgraph, got:%v expect:%v", got, expect)
+	}
+}
+
+// recorder is a trace.Tracer that records the spans it starts.
+type recorder struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+type span struct {
+	op     string
+	parent *span
+	tags   map[string]interface{}
+}
+
+func (r *recorder) StartSpan(op string, parent trace.Span) trace.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &span{op: op, tags: make(map[string]interface{})}
+	s.parent, _ = parent.(*span)
+	r.spans = append(r.spans, s)
+	return s
+}
+
+func (s *span) SetTag(key string, value interface{}) { s.tags[key] = value }
+func (s *span) Finish()                              {}
+
+func TestTrace(t *testing.T) {
+	s := makeTestSession(simpleGraph)
+	r := &recorder{}
+	trace.Set(r)
+	defer trace.Set(nil)
+
+	root := trace.Start("http", nil)
+	s.SetSpan(root)
+	c := make(chan interface{}, 5)
+	go s.Execute(`[{"id": null, "follows": "B"}]`, c, -1)
+	for result := range c {
+		s.Collate(result)
+	}
+
+	var ops []string
+	for _, s := range r.spans[1:] {
+		if s.parent != r.spans[0] {
+			t.Errorf("Span %s is not a child of the request span", s.op)
+		}
+		ops = append(ops, s.op)
+	}
+	if expect := []string{"build", "optimize", "iterate"}; !reflect.DeepEqual(ops, expect) {
+		t.Errorf("Unexpected spans, got:%v expect:%v", ops, expect)
+	}
+	if n := r.spans[len(r.spans)-1].tags["results"]; n != 3 {
+		t.Errorf("Unexpected number of results traced, got:%v expect:3", n)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	s := makeTestSession(simpleGraph)
+	q := memory.NewQuotaLimit(2 * memory.ResultSize(1))
+	defer q.Close()
+	s.SetQuota(q)
+	c := make(chan interface{}, 5)
+	go s.Execute(`[{"id": null, "status": null}]`, c, -1)
+	for result := range c {
+		s.Collate(result)
+	}
+	_, err := s.Results()
+	if _, ok := err.(*memory.ExceededError); !ok {
+		t.Errorf("Unexpected error over the quota, got:%v expect:*memory.ExceededError", err)
+	}
+}
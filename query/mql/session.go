@@ -18,18 +18,47 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"sync"
 
-	"github.com/barakmich/glog"
-
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/memory"
 	"github.com/google/cayley/query"
+	"github.com/google/cayley/trace"
 )
 
 type Session struct {
-	qs           graph.QuadStore
+	qs graph.QuadStore
+
+	// run serializes the queries of the session, which share its
+	// current query, so that a query started while another runs waits
+	// for it.
+	run          sync.Mutex
 	currentQuery *Query
 	debug        bool
+
+	// links collects the quads the results were reached through, if
+	// the session returns the subgraph of its queries.
+	links *query.LinkSet
+
+	span trace.Span
+
+	// If explain is set, the iterator of the current query is described
+	// in iterators, guarded by mu.
+	explain   bool
+	mu        sync.Mutex
+	iterators []graph.Description
+
+	// If profile is set, the iterator of the current query is profiled,
+	// and its root kept in profiled.
+	profile  bool
+	profiled *iterator.Profile
+
+	// quota accounts for the results of queries; collateErr records
+	// the collation of results over it.
+	quota      *memory.Quota
+	collateErr error
 }
 
 func NewSession(qs graph.QuadStore) *Session {
@@ -38,16 +67,63 @@ func NewSession(qs graph.QuadStore) *Session {
 	return &m
 }
 
+// Explain sets whether the session records the iterators of its queries.
+func (s *Session) Explain(ok bool) {
+	s.explain = ok
+}
+
+// Iterators returns the description of the iterator of the current query,
+// once it is optimized.
+func (s *Session) Iterators() []graph.Description {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]graph.Description(nil), s.iterators...)
+}
+
+// Profile sets whether the session profiles the iterators of its queries.
+func (s *Session) Profile(ok bool) {
+	s.profile = ok
+}
+
+// Profiles returns the profile of the iterator of the last query.
+func (s *Session) Profiles() []iterator.IteratorProfile {
+	if s.profiled == nil {
+		return nil
+	}
+	return []iterator.IteratorProfile{s.profiled.Profile()}
+}
+
 func (s *Session) Debug(ok bool) {
 	s.debug = ok
 }
 
+// SetQuota sets the memory quota of the queries of the session.
+func (s *Session) SetQuota(q *memory.Quota) {
+	s.quota = q
+}
+
+// SetSpan sets the span that the steps of queries are traced under.
+func (s *Session) SetSpan(span trace.Span) {
+	s.span = span
+}
+
+// Subgraph sets whether Results returns the quads the results of a query
+// were reached through.
+func (s *Session) Subgraph(ok bool) {
+	s.links = nil
+	if ok {
+		s.links = query.NewLinkSet(s.qs)
+	}
+}
+
 func (s *Session) ShapeOf(query string) (interface{}, error) {
 	var mqlQuery interface{}
 	err := json.Unmarshal([]byte(query), &mqlQuery)
 	if err != nil {
 		return nil, err
 	}
+	s.run.Lock()
+	defer s.run.Unlock()
 	s.currentQuery = NewQuery(s)
 	s.currentQuery.BuildIteratorTree(mqlQuery)
 	output := make(map[string]interface{})
@@ -70,37 +146,84 @@ func (s *Session) Parse(input string) (query.ParseResult, error) {
 	return query.Parsed, nil
 }
 
-func (s *Session) Execute(input string, c chan interface{}, _ int) {
+// Execute runs a query, sending at most limit results to c if limit is not
+// negative.
+func (s *Session) Execute(input string, c chan interface{}, limit int) {
 	defer close(c)
+	s.run.Lock()
+	defer s.run.Unlock()
+	s.mu.Lock()
+	s.iterators = nil
+	s.mu.Unlock()
+	s.profiled = nil
 	var mqlQuery interface{}
 	err := json.Unmarshal([]byte(input), &mqlQuery)
 	if err != nil {
 		return
 	}
+	span := trace.Start("build", s.span)
 	s.currentQuery = NewQuery(s)
 	s.currentQuery.BuildIteratorTree(mqlQuery)
+	span.Finish()
 	if s.currentQuery.isError() {
 		return
 	}
+	if s.links != nil {
+		iterator.TagLinks(s.currentQuery.it)
+	}
+	span = trace.Start("optimize", s.span)
 	it, _ := s.currentQuery.it.Optimize()
-	if glog.V(2) {
+	if s.quota != nil {
+		iterator.SetQuota(it, s.quota)
+	}
+	span.SetTag("iterator", it.Type())
+	span.Finish()
+	if err := iterator.CheckDepth(it); err != nil {
+		s.currentQuery.err = err
+		it.Close()
+		return
+	}
+	if s.explain {
+		d := it.Describe()
+		s.mu.Lock()
+		s.iterators = []graph.Description{d}
+		s.mu.Unlock()
+	}
+	if s.profile {
+		s.profiled = iterator.Profiled(it)
+		it = s.profiled
+	}
+	if clog.V(2) {
 		b, err := json.MarshalIndent(it.Describe(), "", "  ")
 		if err != nil {
-			glog.Infof("failed to format description: %v", err)
+			clog.Infof("failed to format description: %v", err)
 		} else {
-			glog.Infof("%s", b)
+			clog.Infof("%s", b)
 		}
 	}
-	for graph.Next(it) {
+	span = trace.Start("iterate", s.span)
+	n := 0
+	for (limit < 0 || n < limit) && graph.Next(it) {
 		tags := make(map[string]graph.Value)
 		it.TagResults(tags)
 		c <- tags
-		for it.NextPath() == true {
+		n++
+		for (limit < 0 || n < limit) && it.NextPath() == true {
 			tags := make(map[string]graph.Value)
 			it.TagResults(tags)
 			c <- tags
+			n++
 		}
 	}
+	switch err := it.Err().(type) {
+	case *memory.ExceededError:
+		s.currentQuery.err = err
+	case *iterator.GuardError:
+		s.currentQuery.err = err
+	}
+	it.Close()
+	span.SetTag("results", n)
+	span.Finish()
 }
 
 func (s *Session) Format(result interface{}) string {
@@ -127,14 +250,33 @@ func (s *Session) Format(result interface{}) string {
 }
 
 func (s *Session) Collate(result interface{}) {
-	s.currentQuery.treeifyResult(result.(map[string]graph.Value))
+	if s.links != nil {
+		s.links.Add(result.(map[string]graph.Value))
+		return
+	}
+	if s.collateErr != nil {
+		return
+	}
+	tags := result.(map[string]graph.Value)
+	if err := s.quota.Reserve(memory.ResultSize(len(tags))); err != nil {
+		s.collateErr = err
+		return
+	}
+	s.currentQuery.treeifyResult(tags)
 }
 
 func (s *Session) Results() (interface{}, error) {
+	if err := s.collateErr; err != nil {
+		s.collateErr = nil
+		return nil, err
+	}
 	s.currentQuery.buildResults()
 	if s.currentQuery.isError() {
 		return nil, s.currentQuery.err
 	}
+	if s.links != nil {
+		return s.links.Quads(), nil
+	}
 	return s.currentQuery.results, nil
 }
 
@@ -0,0 +1,181 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+// Keeps named queries in the store they query, so that they may be shared
+// and run by name.
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+const (
+	// SavedLabel is the named graph holding the saved queries, each as a
+	// quad linking its name to its definition as JSON.
+	SavedLabel = "<cayley:saved_queries>"
+
+	savedPredicate = "<cayley:saved_query>"
+	savedPrefix    = "cayley:query:"
+)
+
+var (
+	// ErrNoSavedQuery is returned for a saved query that does not exist.
+	ErrNoSavedQuery = errors.New("no such saved query")
+
+	// ErrSavedName is returned when saving a query without a name.
+	ErrSavedName = errors.New("saved query has no name")
+)
+
+// Saved is a query kept in the store by name.
+type Saved struct {
+	Name  string `json:"name"`
+	Lang  string `json:"lang"`
+	Query string `json:"query"`
+
+	// Params are the options the query is run with unless others are
+	// given, such as its timeout, limit or explain flag.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+func (s Saved) quad() (quad.Quad, error) {
+	def, err := json.Marshal(s)
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	return quad.Quad{
+		Subject:   savedPrefix + s.Name,
+		Predicate: savedPredicate,
+		Object:    string(def),
+		Label:     SavedLabel,
+	}, nil
+}
+
+// savedQuads returns the quads of the saved queries of qs, or of the one of
+// the given name if it is not empty.
+func savedQuads(qs graph.QuadStore, name string) ([]quad.Quad, error) {
+	var it graph.Iterator
+	if name == "" {
+		v := qs.ValueOf(savedPredicate)
+		if v == nil {
+			return nil, nil
+		}
+		it = qs.QuadIterator(quad.Predicate, v)
+	} else {
+		v := qs.ValueOf(savedPrefix + name)
+		if v == nil {
+			return nil, nil
+		}
+		it = qs.QuadIterator(quad.Subject, v)
+	}
+	defer it.Close()
+	var out []quad.Quad
+	for graph.Next(it) {
+		q := qs.Quad(it.Result())
+		if q.Predicate == savedPredicate && q.Label == SavedLabel && strings.HasPrefix(q.Subject, savedPrefix) {
+			out = append(out, q)
+		}
+	}
+	return out, it.Err()
+}
+
+func savedFrom(q quad.Quad) (Saved, error) {
+	var s Saved
+	err := json.Unmarshal([]byte(q.Object), &s)
+	s.Name = strings.TrimPrefix(q.Subject, savedPrefix)
+	return s, err
+}
+
+// SavedQueries returns the saved queries of qs, sorted by name.
+func SavedQueries(qs graph.QuadStore) ([]Saved, error) {
+	quads, err := savedQuads(qs, "")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Saved, 0, len(quads))
+	for _, q := range quads {
+		s, err := savedFrom(q)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	sort.Sort(byName(out))
+	return out, nil
+}
+
+// SavedQuery returns the saved query of the given name, or ErrNoSavedQuery.
+func SavedQuery(qs graph.QuadStore, name string) (Saved, error) {
+	quads, err := savedQuads(qs, name)
+	if err != nil {
+		return Saved{}, err
+	}
+	if len(quads) == 0 {
+		return Saved{}, ErrNoSavedQuery
+	}
+	return savedFrom(quads[0])
+}
+
+// SaveQuery saves s in the store, replacing the query of the same name.
+func SaveQuery(qs graph.QuadStore, qw graph.QuadWriter, s Saved) error {
+	if s.Name == "" {
+		return ErrSavedName
+	}
+	q, err := s.quad()
+	if err != nil {
+		return err
+	}
+	old, err := savedQuads(qs, s.Name)
+	if err != nil {
+		return err
+	}
+	t := graph.NewTransaction()
+	for _, o := range old {
+		if o == q {
+			return nil
+		}
+		t.RemoveQuad(o)
+	}
+	t.AddQuad(q)
+	return qw.ApplyTransaction(t)
+}
+
+// DeleteSavedQuery removes the saved query of the given name, or returns
+// ErrNoSavedQuery.
+func DeleteSavedQuery(qs graph.QuadStore, qw graph.QuadWriter, name string) error {
+	old, err := savedQuads(qs, name)
+	if err != nil {
+		return err
+	}
+	if len(old) == 0 {
+		return ErrNoSavedQuery
+	}
+	t := graph.NewTransaction()
+	for _, o := range old {
+		t.RemoveQuad(o)
+	}
+	return qw.ApplyTransaction(t)
+}
+
+type byName []Saved
+
+func (l byName) Len() int           { return len(l) }
+func (l byName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l byName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
@@ -16,6 +16,13 @@ package query
 
 // Defines the graph session interface general to all query languages.
 
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/memory"
+	"github.com/google/cayley/trace"
+)
+
 type ParseResult int
 
 const (
@@ -42,3 +49,63 @@ type HTTP interface {
 	Results() (interface{}, error)
 	Clear()
 }
+
+// Traced is implemented by sessions that record the steps of their queries,
+// such as optimizing and iterating, as spans.
+type Traced interface {
+	// SetSpan sets the span of the request the session runs queries
+	// for, to start the spans of its steps from.
+	SetSpan(trace.Span)
+}
+
+// Explainer is implemented by sessions that can record the iterator trees of
+// their queries, to show what a running query is doing.
+type Explainer interface {
+	// Explain sets whether the session records the iterators of its
+	// queries.
+	Explain(ok bool)
+
+	// Iterators returns the descriptions of the iterators the current
+	// query has run so far, as they were optimized. It may be called
+	// while the query runs.
+	Iterators() []graph.Description
+}
+
+// Profiler is implemented by sessions that can profile the iterators of their
+// queries, counting the calls to each and timing them.
+type Profiler interface {
+	// Profile sets whether the session profiles its queries.
+	Profile(ok bool)
+
+	// Profiles returns the profiles of the iterator trees the current
+	// query has run. It is to be called once the query has finished.
+	Profiles() []iterator.IteratorProfile
+}
+
+// Canceller is implemented by sessions whose queries may be cancelled while
+// they run.
+type Canceller interface {
+	// Cancel stops the query being run, which then fails. It may be
+	// called from another goroutine, and does nothing if no query runs.
+	Cancel()
+}
+
+// Budgeted is implemented by sessions that account for the memory their
+// queries hold, such as materialized and collected results. A query that
+// exceeds the quota fails with a *memory.ExceededError.
+type Budgeted interface {
+	// SetQuota sets the quota of the queries run by the session.
+	SetQuota(*memory.Quota)
+}
+
+// Completer is implemented by sessions that can list the names a query may
+// use, for completing them as they are typed.
+type Completer interface {
+	// Globals returns the names a query may start with, such as those of
+	// functions and variables.
+	Globals() []string
+
+	// Members returns the names that may follow a dot, such as those of
+	// methods.
+	Members() []string
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// Subgrapher is implemented by sessions that can return the subgraph a query
+// matched in place of its results.
+type Subgrapher interface {
+	// Subgraph sets whether Results returns the quads the results of a
+	// query were reached through, as a []quad.Quad, rather than the
+	// results themselves.
+	Subgraph(ok bool)
+}
+
+// LinkSet collects the quads tagged by iterator.TagLinks in the results of
+// a query, each once, in the order they were first reached.
+type LinkSet struct {
+	qs    graph.QuadStore
+	seen  map[quad.Quad]struct{}
+	quads []quad.Quad
+}
+
+func NewLinkSet(qs graph.QuadStore) *LinkSet {
+	return &LinkSet{
+		qs:    qs,
+		seen:  make(map[quad.Quad]struct{}),
+		quads: []quad.Quad{},
+	}
+}
+
+// Add adds the quads tagged in the tags of a result.
+func (s *LinkSet) Add(tags map[string]graph.Value) {
+	for _, v := range iterator.SplitLinks(tags) {
+		q := s.qs.Quad(v)
+		if _, ok := s.seen[q]; ok {
+			continue
+		}
+		s.seen[q] = struct{}{}
+		s.quads = append(s.quads, q)
+	}
+}
+
+// Quads returns the quads added so far.
+func (s *LinkSet) Quads() []quad.Quad {
+	return s.quads
+}
@@ -0,0 +1,124 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+// Tree groups the results of a query, each a map of its tags to the names of
+// the nodes they tagged, into a tree with a level for each of the given tags.
+// Each node of a level holds its tag and the tags of the results under it that
+// all share a value, and the nodes of the next level under the name of its
+// tag. The tags left at the last level, which differ between its results, hold
+// their distinct values, in the order they were first seen.
+//
+// For example, the results
+//
+//	{"person": "alice", "friend": "bob", "city": "paris"}
+//	{"person": "alice", "friend": "charlie", "city": "paris"}
+//
+// grouped by person and friend give
+//
+//	{"person": "alice", "city": "paris", "friend": [{"friend": "bob"}, {"friend": "charlie"}]}
+func Tree(results []map[string]string, levels ...string) []map[string]interface{} {
+	if len(levels) == 0 {
+		levels = []string{"id"}
+	}
+	done := make(map[string]bool)
+	for _, l := range levels {
+		done[l] = true
+	}
+	return treeLevel(results, levels, done)
+}
+
+// treeLevel groups results by the first of levels, skipping the tags that
+// are done, being levels or held higher in the tree.
+func treeLevel(results []map[string]string, levels []string, done map[string]bool) []map[string]interface{} {
+	tag := levels[0]
+	var (
+		order  []string
+		groups = make(map[string][]map[string]string)
+	)
+	for _, r := range results {
+		v, ok := r[tag]
+		key := "\x00"
+		if ok {
+			key = v
+		}
+		if _, seen := groups[key]; !seen {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	out := make([]map[string]interface{}, 0, len(order))
+	for _, key := range order {
+		group := groups[key]
+		node := make(map[string]interface{})
+		if key != "\x00" {
+			node[tag] = key
+		}
+		held := make(map[string]bool, len(done))
+		for k := range done {
+			held[k] = true
+		}
+		for k, v := range shared(group, done) {
+			node[k] = v
+			held[k] = true
+		}
+		if len(levels) > 1 {
+			node[levels[1]] = treeLevel(group, levels[1:], held)
+			out = append(out, node)
+			continue
+		}
+		for _, r := range group {
+			for k, v := range r {
+				if held[k] {
+					continue
+				}
+				vals, _ := node[k].([]string)
+				if !containsString(vals, v) {
+					node[k] = append(vals, v)
+				}
+			}
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+// shared returns the tags, other than those done, that all results have with
+// the same value.
+func shared(results []map[string]string, done map[string]bool) map[string]string {
+	same := make(map[string]string)
+	for k, v := range results[0] {
+		if !done[k] {
+			same[k] = v
+		}
+	}
+	for _, r := range results[1:] {
+		for k, v := range same {
+			if w, ok := r[k]; !ok || w != v {
+				delete(same, k)
+			}
+		}
+	}
+	return same
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var treeTests = []struct {
+	message string
+	levels  []string
+	expect  string
+}{
+	{
+		message: "group by id",
+		expect:  `[{"friend":["bob","charlie"],"id":"alice","person":"alice"},{"friend":"alice","id":"bob","person":"bob"}]`,
+	},
+	{
+		message: "group by person and friend",
+		levels:  []string{"person", "friend"},
+		expect:  `[{"friend":[{"friend":"bob"},{"friend":"charlie"}],"id":"alice","person":"alice"},{"friend":[{"friend":"alice"}],"id":"bob","person":"bob"}]`,
+	},
+	{
+		message: "group by friend",
+		levels:  []string{"friend"},
+		expect:  `[{"friend":"bob","id":"alice","person":"alice"},{"friend":"charlie","id":"alice","person":"alice"},{"friend":"alice","id":"bob","person":"bob"}]`,
+	},
+}
+
+func TestTree(t *testing.T) {
+	results := []map[string]string{
+		{"id": "alice", "person": "alice", "friend": "bob"},
+		{"id": "alice", "person": "alice", "friend": "charlie"},
+		{"id": "bob", "person": "bob", "friend": "alice"},
+	}
+	for _, test := range treeTests {
+		got, err := json.Marshal(Tree(results, test.levels...))
+		if err != nil {
+			t.Fatalf("Could not marshal tree for %s: %v", test.message, err)
+		}
+		if string(got) != test.expect {
+			t.Errorf("Unexpected tree for %s:\ngot:   %s\nexpect:%s", test.message, got, test.expect)
+		}
+	}
+}
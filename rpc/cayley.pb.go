@@ -0,0 +1,475 @@
+// +build grpc
+
+// Code generated by protoc-gen-go.
+// source: cayley.proto
+// DO NOT EDIT!
+
+/*
+Package rpc is a generated protocol buffer package.
+
+It is generated from these files:
+	cayley.proto
+
+It has these top-level messages:
+	Quad
+	QueryRequest
+	Result
+	WriteRequest
+	WriteResponse
+	WatchRequest
+	Delta
+	DumpRequest
+*/
+package rpc
+
+import proto "github.com/golang/protobuf/proto"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+
+type Delta_Action int32
+
+const (
+	Delta_ADD    Delta_Action = 0
+	Delta_DELETE Delta_Action = 1
+)
+
+var Delta_Action_name = map[int32]string{
+	0: "ADD",
+	1: "DELETE",
+}
+var Delta_Action_value = map[string]int32{
+	"ADD":    0,
+	"DELETE": 1,
+}
+
+func (x Delta_Action) String() string {
+	return proto.EnumName(Delta_Action_name, int32(x))
+}
+
+type Quad struct {
+	Subject   string `protobuf:"bytes,1,opt,name=subject" json:"subject,omitempty"`
+	Predicate string `protobuf:"bytes,2,opt,name=predicate" json:"predicate,omitempty"`
+	Object    string `protobuf:"bytes,3,opt,name=object" json:"object,omitempty"`
+	Label     string `protobuf:"bytes,4,opt,name=label" json:"label,omitempty"`
+}
+
+func (m *Quad) Reset()         { *m = Quad{} }
+func (m *Quad) String() string { return proto.CompactTextString(m) }
+func (*Quad) ProtoMessage()    {}
+
+type QueryRequest struct {
+	// Language is the query language, "gremlin" or "mql".
+	Language string `protobuf:"bytes,1,opt,name=language" json:"language,omitempty"`
+	Query    string `protobuf:"bytes,2,opt,name=query" json:"query,omitempty"`
+	// Limit is the most results to return, if positive.
+	Limit int64 `protobuf:"varint,3,opt,name=limit" json:"limit,omitempty"`
+}
+
+func (m *QueryRequest) Reset()         { *m = QueryRequest{} }
+func (m *QueryRequest) String() string { return proto.CompactTextString(m) }
+func (*QueryRequest) ProtoMessage()    {}
+
+type Result struct {
+	// Tags holds the names of the nodes tagged in a result of a query.
+	Tags map[string]string `protobuf:"bytes,1,rep,name=tags" json:"tags,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Json holds any other result, such as a value emitted by a Gremlin
+	// script or the results of an MQL query, encoded as JSON.
+	Json string `protobuf:"bytes,2,opt,name=json" json:"json,omitempty"`
+}
+
+func (m *Result) Reset()         { *m = Result{} }
+func (m *Result) String() string { return proto.CompactTextString(m) }
+func (*Result) ProtoMessage()    {}
+
+func (m *Result) GetTags() map[string]string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+type WriteRequest struct {
+	Add    []*Quad `protobuf:"bytes,1,rep,name=add" json:"add,omitempty"`
+	Delete []*Quad `protobuf:"bytes,2,rep,name=delete" json:"delete,omitempty"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()    {}
+
+func (m *WriteRequest) GetAdd() []*Quad {
+	if m != nil {
+		return m.Add
+	}
+	return nil
+}
+
+func (m *WriteRequest) GetDelete() []*Quad {
+	if m != nil {
+		return m.Delete
+	}
+	return nil
+}
+
+type WriteResponse struct {
+	Added   int64 `protobuf:"varint,1,opt,name=added" json:"added,omitempty"`
+	Deleted int64 `protobuf:"varint,2,opt,name=deleted" json:"deleted,omitempty"`
+	// Horizon is the horizon of the database after the last batch.
+	Horizon int64 `protobuf:"varint,3,opt,name=horizon" json:"horizon,omitempty"`
+}
+
+func (m *WriteResponse) Reset()         { *m = WriteResponse{} }
+func (m *WriteResponse) String() string { return proto.CompactTextString(m) }
+func (*WriteResponse) ProtoMessage()    {}
+
+type WatchRequest struct {
+	// Pattern selects the quads to watch by the fields it sets; an empty
+	// pattern watches them all.
+	Pattern *Quad `protobuf:"bytes,1,opt,name=pattern" json:"pattern,omitempty"`
+}
+
+func (m *WatchRequest) Reset()         { *m = WatchRequest{} }
+func (m *WatchRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()    {}
+
+func (m *WatchRequest) GetPattern() *Quad {
+	if m != nil {
+		return m.Pattern
+	}
+	return nil
+}
+
+type Delta struct {
+	Id     int64        `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Action Delta_Action `protobuf:"varint,2,opt,name=action,enum=cayley.Delta_Action" json:"action,omitempty"`
+	Quad   *Quad        `protobuf:"bytes,3,opt,name=quad" json:"quad,omitempty"`
+	// Timestamp is when the delta was applied, in nanoseconds since the
+	// Unix epoch.
+	Timestamp int64 `protobuf:"varint,4,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *Delta) Reset()         { *m = Delta{} }
+func (m *Delta) String() string { return proto.CompactTextString(m) }
+func (*Delta) ProtoMessage()    {}
+
+func (m *Delta) GetQuad() *Quad {
+	if m != nil {
+		return m.Quad
+	}
+	return nil
+}
+
+type DumpRequest struct {
+	// Label restricts the dump to the named graphs with these labels, if
+	// any are given.
+	Label []string `protobuf:"bytes,1,rep,name=label" json:"label,omitempty"`
+}
+
+func (m *DumpRequest) Reset()         { *m = DumpRequest{} }
+func (m *DumpRequest) String() string { return proto.CompactTextString(m) }
+func (*DumpRequest) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterEnum("cayley.Delta_Action", Delta_Action_name, Delta_Action_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for Cayley service
+
+type CayleyClient interface {
+	// Query runs a query, streaming its results as they are found.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (Cayley_QueryClient, error)
+	// Write applies each batch of quads sent, in one transaction per
+	// batch, and returns the number of quads added and deleted once the
+	// client closes the stream.
+	Write(ctx context.Context, opts ...grpc.CallOption) (Cayley_WriteClient, error)
+	// Watch streams the deltas applied to the quads matching a pattern,
+	// until the client cancels the call.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Cayley_WatchClient, error)
+	// Dump streams the quads of the database, as of the time of the call.
+	Dump(ctx context.Context, in *DumpRequest, opts ...grpc.CallOption) (Cayley_DumpClient, error)
+}
+
+type cayleyClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCayleyClient(cc *grpc.ClientConn) CayleyClient {
+	return &cayleyClient{cc}
+}
+
+func (c *cayleyClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (Cayley_QueryClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Cayley_serviceDesc.Streams[0], c.cc, "/cayley.Cayley/Query", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cayleyQueryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cayley_QueryClient interface {
+	Recv() (*Result, error)
+	grpc.ClientStream
+}
+
+type cayleyQueryClient struct {
+	grpc.ClientStream
+}
+
+func (x *cayleyQueryClient) Recv() (*Result, error) {
+	m := new(Result)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cayleyClient) Write(ctx context.Context, opts ...grpc.CallOption) (Cayley_WriteClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Cayley_serviceDesc.Streams[1], c.cc, "/cayley.Cayley/Write", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cayleyWriteClient{stream}
+	return x, nil
+}
+
+type Cayley_WriteClient interface {
+	Send(*WriteRequest) error
+	CloseAndRecv() (*WriteResponse, error)
+	grpc.ClientStream
+}
+
+type cayleyWriteClient struct {
+	grpc.ClientStream
+}
+
+func (x *cayleyWriteClient) Send(m *WriteRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *cayleyWriteClient) CloseAndRecv() (*WriteResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cayleyClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Cayley_WatchClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Cayley_serviceDesc.Streams[2], c.cc, "/cayley.Cayley/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cayleyWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cayley_WatchClient interface {
+	Recv() (*Delta, error)
+	grpc.ClientStream
+}
+
+type cayleyWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *cayleyWatchClient) Recv() (*Delta, error) {
+	m := new(Delta)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cayleyClient) Dump(ctx context.Context, in *DumpRequest, opts ...grpc.CallOption) (Cayley_DumpClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Cayley_serviceDesc.Streams[3], c.cc, "/cayley.Cayley/Dump", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cayleyDumpClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cayley_DumpClient interface {
+	Recv() (*Quad, error)
+	grpc.ClientStream
+}
+
+type cayleyDumpClient struct {
+	grpc.ClientStream
+}
+
+func (x *cayleyDumpClient) Recv() (*Quad, error) {
+	m := new(Quad)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Cayley service
+
+type CayleyServer interface {
+	// Query runs a query, streaming its results as they are found.
+	Query(*QueryRequest, Cayley_QueryServer) error
+	// Write applies each batch of quads sent, in one transaction per
+	// batch, and returns the number of quads added and deleted once the
+	// client closes the stream.
+	Write(Cayley_WriteServer) error
+	// Watch streams the deltas applied to the quads matching a pattern,
+	// until the client cancels the call.
+	Watch(*WatchRequest, Cayley_WatchServer) error
+	// Dump streams the quads of the database, as of the time of the call.
+	Dump(*DumpRequest, Cayley_DumpServer) error
+}
+
+func RegisterCayleyServer(s *grpc.Server, srv CayleyServer) {
+	s.RegisterService(&_Cayley_serviceDesc, srv)
+}
+
+func _Cayley_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CayleyServer).Query(m, &cayleyQueryServer{stream})
+}
+
+type Cayley_QueryServer interface {
+	Send(*Result) error
+	grpc.ServerStream
+}
+
+type cayleyQueryServer struct {
+	grpc.ServerStream
+}
+
+func (x *cayleyQueryServer) Send(m *Result) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cayley_Write_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CayleyServer).Write(&cayleyWriteServer{stream})
+}
+
+type Cayley_WriteServer interface {
+	SendAndClose(*WriteResponse) error
+	Recv() (*WriteRequest, error)
+	grpc.ServerStream
+}
+
+type cayleyWriteServer struct {
+	grpc.ServerStream
+}
+
+func (x *cayleyWriteServer) SendAndClose(m *WriteResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *cayleyWriteServer) Recv() (*WriteRequest, error) {
+	m := new(WriteRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Cayley_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CayleyServer).Watch(m, &cayleyWatchServer{stream})
+}
+
+type Cayley_WatchServer interface {
+	Send(*Delta) error
+	grpc.ServerStream
+}
+
+type cayleyWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *cayleyWatchServer) Send(m *Delta) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cayley_Dump_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DumpRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CayleyServer).Dump(m, &cayleyDumpServer{stream})
+}
+
+type Cayley_DumpServer interface {
+	Send(*Quad) error
+	grpc.ServerStream
+}
+
+type cayleyDumpServer struct {
+	grpc.ServerStream
+}
+
+func (x *cayleyDumpServer) Send(m *Quad) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Cayley_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "cayley.Cayley",
+	HandlerType: (*CayleyServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Query",
+			Handler:       _Cayley_Query_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Write",
+			Handler:       _Cayley_Write_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Cayley_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Dump",
+			Handler:       _Cayley_Dump_Handler,
+			ServerStreams: true,
+		},
+	},
+}
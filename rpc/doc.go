@@ -0,0 +1,29 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpc serves the gRPC API of a Cayley database, defined in
+// cayley.proto, for programmatic clients that stream many results or writes.
+//
+// Its dependencies are not among those Cayley tracks, so it is only built
+// with the grpc build tag:
+//
+//  go get google.golang.org/grpc
+//  go build -tags grpc ./cmd/cayley
+//
+// The protocol buffer types in cayley.pb.go are generated with
+//
+//  protoc --go_out=plugins=grpc:. cayley.proto
+//
+// after which the grpc build constraint must be put back at its top.
+package rpc
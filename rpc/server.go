@@ -0,0 +1,284 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build grpc
+
+package rpc
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/labels"
+	"github.com/google/cayley/internal/auth"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+	"github.com/google/cayley/query/gremlin"
+	"github.com/google/cayley/query/mql"
+)
+
+// Server implements the Cayley gRPC service on a database.
+type Server struct {
+	h   *graph.Handle
+	cfg *config.Config
+}
+
+func NewServer(h *graph.Handle, cfg *config.Config) *Server {
+	return &Server{h: h, cfg: cfg}
+}
+
+// Serve serves the Cayley gRPC service on the database on addr, until it
+// fails. Calls are authorized by the credentials of cfg, as HTTP requests
+// are.
+func Serve(h *graph.Handle, cfg *config.Config, addr string) error {
+	authz, err := auth.New(cfg)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer(grpc.StreamInterceptor(Authorize(authz)))
+	RegisterCayleyServer(s, NewServer(h, cfg))
+	clog.Infof("Cayley gRPC now listening on %s", addr)
+	return s.Serve(l)
+}
+
+// methodRoles are the roles needed to call the methods of the service.
+var methodRoles = map[string]auth.Role{
+	"/cayley.Cayley/Query": auth.Read,
+	"/cayley.Cayley/Watch": auth.Read,
+	"/cayley.Cayley/Dump":  auth.Read,
+	"/cayley.Cayley/Write": auth.Write,
+}
+
+// Authorize returns an interceptor refusing the calls whose credentials, given
+// as the "authorization" metadata like the Authorization header of an HTTP
+// request, do not grant the role the method needs. Unknown methods need the
+// Admin role.
+func Authorize(authz *auth.Authorizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var authorization string
+		if md, ok := metadata.FromContext(ss.Context()); ok && len(md["authorization"]) > 0 {
+			authorization = md["authorization"][0]
+		}
+		role, err := authz.RoleOf(authorization)
+		if role == auth.None || err != nil {
+			return grpc.Errorf(codes.Unauthenticated, "unknown credentials")
+		}
+		need, ok := methodRoles[info.FullMethod]
+		if !ok {
+			need = auth.Admin
+		}
+		if !role.Can(need) {
+			return grpc.Errorf(codes.PermissionDenied, "forbidden to the %s role", role)
+		}
+		return handler(srv, ss)
+	}
+}
+
+func fromQuad(q quad.Quad) *Quad {
+	return &Quad{Subject: q.Subject, Predicate: q.Predicate, Object: q.Object, Label: q.Label}
+}
+
+func toQuad(q *Quad) quad.Quad {
+	if q == nil {
+		return quad.Quad{}
+	}
+	return quad.Quad{Subject: q.Subject, Predicate: q.Predicate, Object: q.Object, Label: q.Label}
+}
+
+// writeError returns the gRPC error for an error from a QuadWriter.
+func writeError(err error) error {
+	switch err {
+	case graph.ErrQuadExists:
+		return grpc.Errorf(codes.AlreadyExists, "%v", err)
+	case graph.ErrQuadNotExist:
+		return grpc.Errorf(codes.NotFound, "%v", err)
+	}
+	return grpc.Errorf(codes.Internal, "%v", err)
+}
+
+// Query runs a query on a snapshot of the database. Gremlin results are sent
+// as they are found; MQL results are sent as one once the query is done, as
+// they are a tree built from all the paths found.
+func (s *Server) Query(req *QueryRequest, stream Cayley_QueryServer) error {
+	qs := graph.Snapshot(s.h.QuadStore)
+	var (
+		ses    query.HTTP
+		single bool
+	)
+	switch req.Language {
+	case "gremlin":
+		ses = gremlin.NewSession(qs, s.cfg.Timeout, false)
+	case "mql":
+		ses, single = mql.NewSession(qs), true
+	default:
+		return grpc.Errorf(codes.InvalidArgument, "unknown query language %q", req.Language)
+	}
+	if result, err := ses.Parse(req.Query); result == query.ParseMore {
+		return grpc.Errorf(codes.InvalidArgument, "could not parse query: incomplete query")
+	} else if result != query.Parsed {
+		return grpc.Errorf(codes.InvalidArgument, "could not parse query: %v", err)
+	}
+
+	c := make(chan interface{}, 5)
+	// The limit counts collated results, and MQL collates several of the
+	// results of Execute into one, so it is applied here instead.
+	go ses.Execute(req.Query, c, -1)
+	var (
+		n   int64
+		err error
+	)
+	for res := range c {
+		// Drain the results on error, so that the query finishes.
+		if err != nil || (req.Limit > 0 && n >= req.Limit) {
+			continue
+		}
+		ses.Collate(res)
+		if single {
+			continue
+		}
+		n, err = s.sendResults(ses, stream, n, req.Limit)
+	}
+	if err == nil && single {
+		_, err = s.sendResults(ses, stream, n, req.Limit)
+	}
+	return err
+}
+
+// sendResults sends the results collated by ses, returning the number of
+// results sent so far.
+func (s *Server) sendResults(ses query.HTTP, stream Cayley_QueryServer, n, limit int64) (int64, error) {
+	out, err := ses.Results()
+	if err != nil {
+		return n, grpc.Errorf(codes.Aborted, "%v", err)
+	}
+	results, ok := out.([]interface{})
+	if !ok {
+		results = []interface{}{out}
+	}
+	for _, r := range results {
+		if limit > 0 && n >= limit {
+			break
+		}
+		var msg Result
+		if tags, ok := r.(map[string]string); ok {
+			msg.Tags = tags
+		} else {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return n, grpc.Errorf(codes.Internal, "%v", err)
+			}
+			msg.Json = string(b)
+		}
+		if err := stream.Send(&msg); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Write applies each batch of quads received in one transaction.
+func (s *Server) Write(stream Cayley_WriteServer) error {
+	if s.cfg.ReadOnly {
+		return grpc.Errorf(codes.PermissionDenied, "database is read-only")
+	}
+	var resp WriteResponse
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			h := s.h.QuadStore.Horizon()
+			resp.Horizon = h.Int()
+			return stream.SendAndClose(&resp)
+		} else if err != nil {
+			return err
+		}
+		t := graph.NewTransaction()
+		for _, q := range req.Add {
+			t.AddQuad(toQuad(q))
+		}
+		for _, q := range req.Delete {
+			t.RemoveQuad(toQuad(q))
+		}
+		if err := s.h.QuadWriter.ApplyTransaction(t); err != nil {
+			return writeError(err)
+		}
+		resp.Added += int64(len(req.Add))
+		resp.Deleted += int64(len(req.Delete))
+	}
+}
+
+// Watch sends the deltas applied to the quads matching the pattern, until
+// the call is cancelled.
+func (s *Server) Watch(req *WatchRequest, stream Cayley_WatchServer) error {
+	w, ok := s.h.QuadStore.(graph.Watcher)
+	if !ok {
+		return grpc.Errorf(codes.Unimplemented, "database does not support watching")
+	}
+	c := w.Subscribe(toQuad(req.Pattern))
+	defer w.Unsubscribe(c)
+	done := stream.Context().Done()
+	for {
+		select {
+		case <-done:
+			return nil
+		case d, ok := <-c:
+			if !ok {
+				return nil
+			}
+			msg := &Delta{
+				Id:        d.ID.Int(),
+				Action:    Delta_ADD,
+				Quad:      fromQuad(d.Quad),
+				Timestamp: d.Timestamp.UnixNano(),
+			}
+			if d.Action == graph.Delete {
+				msg.Action = Delta_DELETE
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Dump sends the quads of a snapshot of the database.
+func (s *Server) Dump(req *DumpRequest, stream Cayley_DumpServer) error {
+	qs := graph.Snapshot(s.h.QuadStore)
+	if len(req.Label) != 0 {
+		qs = labels.Restrict(qs, req.Label...)
+	}
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		if err := stream.Send(fromQuad(qs.Quad(it.Result()))); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return grpc.Errorf(codes.Internal, "%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinkerpop
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/path"
+)
+
+// ErrTimeout is returned by a traversal that runs longer than it may.
+var ErrTimeout = errors.New("traversal timed out")
+
+// step is an instruction of the bytecode of a traversal: the name of a step
+// and its arguments.
+type step struct {
+	name string
+	args []interface{}
+}
+
+// The kinds of results a traversal emits.
+const (
+	emitVertices = iota
+	emitNames
+	emitSelected
+)
+
+// traversal is the bytecode of a Gremlin traversal, translated to a path.
+// Its last steps may be modifiers, such as limit, dedup and count, applied
+// to the results of the path in order.
+type traversal struct {
+	qs   graph.QuadStore
+	path *path.Path
+	emit int
+	tags []string // Selected by select.
+	mods []step
+}
+
+// parseBytecode returns the steps of an untyped g:Bytecode.
+func parseBytecode(v interface{}) ([]step, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("traversal is not bytecode")
+	}
+	if src, _ := m["source"].([]interface{}); len(src) != 0 {
+		return nil, errors.New("traversal strategies are not supported")
+	}
+	list, _ := m["step"].([]interface{})
+	steps := make([]step, 0, len(list))
+	for _, s := range list {
+		l, _ := s.([]interface{})
+		if len(l) == 0 {
+			return nil, errors.New("empty step in bytecode")
+		}
+		name, ok := l[0].(string)
+		if !ok {
+			return nil, errors.New("unnamed step in bytecode")
+		}
+		steps = append(steps, step{name: name, args: l[1:]})
+	}
+	return steps, nil
+}
+
+// translate returns the traversal of the steps on qs. Only the steps that
+// are paths of Cayley are supported: V, out, in, both, has with a key and a
+// value, hasId and as; then values, id or select; then limit, dedup and
+// count.
+func translate(qs graph.QuadStore, steps []step) (*traversal, error) {
+	if len(steps) == 0 || steps[0].name != "V" {
+		return nil, errors.New("traversal must start with V")
+	}
+	t := &traversal{qs: qs, emit: emitVertices}
+	for i, s := range steps {
+		if len(t.mods) != 0 {
+			switch s.name {
+			case "limit", "dedup", "count":
+			default:
+				return nil, fmt.Errorf("step %s cannot follow %s", s.name, t.mods[len(t.mods)-1].name)
+			}
+		} else if t.emit != emitVertices {
+			switch s.name {
+			case "limit", "dedup", "count":
+			default:
+				return nil, fmt.Errorf("step %s cannot follow %s", s.name, steps[i-1].name)
+			}
+		}
+		switch s.name {
+		case "V":
+			if i != 0 {
+				return nil, errors.New("step V must come first")
+			}
+			ids, err := stringArgs(s)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				t.path = path.StartPath(qs)
+			} else {
+				t.path = path.PathFromIterator(qs, knownNodes(qs, ids))
+			}
+		case "out", "in", "both", "values":
+			preds, err := stringArgs(s)
+			if err != nil {
+				return nil, err
+			}
+			via := make([]interface{}, len(preds))
+			for j, p := range preds {
+				via[j] = p
+			}
+			switch s.name {
+			case "out":
+				t.path = t.path.Out(via...)
+			case "in":
+				t.path = t.path.In(via...)
+			case "both":
+				// Paths are built in place, so the other direction
+				// is followed from a path built anew.
+				other, err := translate(qs, steps[:i])
+				if err != nil {
+					return nil, err
+				}
+				t.path = t.path.Out(via...).Or(other.path.In(via...))
+			case "values":
+				t.path = t.path.Out(via...)
+				t.emit = emitNames
+			}
+		case "has":
+			if len(s.args) != 2 {
+				return nil, errors.New("step has needs a key and a value")
+			}
+			val, ok := s.args[1].(string)
+			if !ok {
+				return nil, errors.New("step has only supports values that are strings")
+			}
+			switch key := s.args[0].(type) {
+			case token:
+				if key != "id" {
+					return nil, fmt.Errorf("step has does not support T.%s", key)
+				}
+				t.path = t.path.And(path.PathFromIterator(qs, knownNodes(qs, []string{val})))
+			case string:
+				t.path = t.path.And(path.StartPath(qs, val).In(key))
+			default:
+				return nil, errors.New("step has needs a key that is a string")
+			}
+		case "hasId":
+			ids, err := stringArgs(s)
+			if err != nil {
+				return nil, err
+			}
+			t.path = t.path.And(path.PathFromIterator(qs, knownNodes(qs, ids)))
+		case "as":
+			tags, err := stringArgs(s)
+			if err != nil {
+				return nil, err
+			}
+			t.path = t.path.Tag(tags...)
+		case "id":
+			t.emit = emitNames
+		case "select":
+			tags, err := stringArgs(s)
+			if err != nil {
+				return nil, err
+			}
+			if len(tags) == 0 {
+				return nil, errors.New("step select needs tags")
+			}
+			t.emit, t.tags = emitSelected, tags
+		case "limit":
+			if len(s.args) != 1 {
+				return nil, errors.New("step limit needs a number")
+			}
+			if _, ok := s.args[0].(float64); !ok {
+				return nil, errors.New("step limit needs a number")
+			}
+			t.mods = append(t.mods, s)
+		case "dedup", "count":
+			if len(s.args) != 0 {
+				return nil, fmt.Errorf("step %s does not take arguments", s.name)
+			}
+			t.mods = append(t.mods, s)
+		default:
+			return nil, fmt.Errorf("step %s is not supported", s.name)
+		}
+	}
+	return t, nil
+}
+
+// knownNodes returns an iterator of the nodes of the given names that are in
+// qs, as a vertex of an unknown ID matches nothing.
+func knownNodes(qs graph.QuadStore, names []string) graph.Iterator {
+	fixed := qs.FixedIterator()
+	for _, n := range names {
+		if v := qs.ValueOf(n); v != nil && qs.NameOf(v) == n {
+			fixed.Add(v)
+		}
+	}
+	return fixed
+}
+
+func stringArgs(s step) ([]string, error) {
+	out := make([]string, len(s.args))
+	for i, a := range s.args {
+		str, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("step %s only supports arguments that are strings", s.name)
+		}
+		out[i] = str
+	}
+	return out, nil
+}
+
+// Run returns the results of the traversal: vertices, names of nodes, the
+// selected vertices or maps of their tags to them, or a count. It fails with ErrTimeout if it is
+// still running at the deadline, unless that is zero.
+func (t *traversal) Run(deadline time.Time) ([]interface{}, error) {
+	// Only so many results are needed if the first modifier is a limit.
+	max := -1
+	if len(t.mods) != 0 && t.mods[0].name == "limit" {
+		max = int(t.mods[0].args[0].(float64))
+	}
+	it, _ := t.path.BuildIterator().Optimize()
+	defer it.Close()
+	results := []interface{}{}
+	for max < 0 || len(results) < max {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, ErrTimeout
+		}
+		if !graph.Next(it) {
+			break
+		}
+		if t.emit != emitSelected {
+			results = append(results, t.result(it.Result(), nil))
+			continue
+		}
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		results = append(results, t.result(it.Result(), tags))
+		for it.NextPath() && (max < 0 || len(results) < max) {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			results = append(results, t.result(it.Result(), tags))
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	for _, m := range t.mods {
+		switch m.name {
+		case "limit":
+			if n := int(m.args[0].(float64)); n >= 0 && n < len(results) {
+				results = results[:n]
+			}
+		case "dedup":
+			results = dedup(results)
+		case "count":
+			results = []interface{}{int64(len(results))}
+		}
+	}
+	return results, nil
+}
+
+func (t *traversal) result(v graph.Value, tags map[string]graph.Value) interface{} {
+	switch t.emit {
+	case emitNames:
+		return t.qs.NameOf(v)
+	case emitSelected:
+		if len(t.tags) == 1 {
+			return vertex(t.qs.NameOf(tags[t.tags[0]]))
+		}
+		out := make(map[string]interface{}, len(t.tags))
+		for _, tag := range t.tags {
+			if tv, ok := tags[tag]; ok {
+				out[tag] = vertex(t.qs.NameOf(tv))
+			}
+		}
+		return out
+	}
+	return vertex(t.qs.NameOf(v))
+}
+
+// dedup returns the results without those equal to earlier ones.
+func dedup(results []interface{}) []interface{} {
+	seen := make(map[string]bool)
+	out := results[:0]
+	for _, r := range results {
+		key := fmt.Sprintf("%T %v", r, r)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinkerpop
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
+	_ "github.com/google/cayley/writer"
+)
+
+func makeTestStore(t *testing.T) graph.QuadStore {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	qw, _ := graph.NewQuadWriter("single", qs, nil)
+	err := qw.AddQuadSet([]quad.Quad{
+		{Subject: "alice", Predicate: "follows", Object: "bob"},
+		{Subject: "alice", Predicate: "follows", Object: "charlie"},
+		{Subject: "bob", Predicate: "follows", Object: "charlie"},
+		{Subject: "bob", Predicate: "name", Object: "Bob"},
+		{Subject: "charlie", Predicate: "name", Object: "Charlie"},
+	})
+	if err != nil {
+		t.Fatalf("Could not write quads: %v", err)
+	}
+	return qs
+}
+
+var bytecodeTests = []struct {
+	message  string
+	bytecode string
+	expect   []interface{}
+	err      bool
+}{
+	{
+		message:  "follow out",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V", "alice"], ["out", "follows"]]}}`,
+		expect:   []interface{}{vertex("bob"), vertex("charlie")},
+	},
+	{
+		message:  "follow in and take names",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V", "charlie"], ["in", "follows"], ["values", "name"]]}}`,
+		expect:   []interface{}{"Bob"},
+	},
+	{
+		message:  "follow both",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V", "bob"], ["both", "follows"], ["id"]]}}`,
+		expect:   []interface{}{"charlie", "alice"},
+	},
+	{
+		message:  "filter by property",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V"], ["has", "name", "Charlie"], ["id"]]}}`,
+		expect:   []interface{}{"charlie"},
+	},
+	{
+		message:  "filter by id",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V"], ["has", {"@type": "g:T", "@value": "id"}, "bob"]]}}`,
+		expect:   []interface{}{vertex("bob")},
+	},
+	{
+		message:  "select tags",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V", "bob"], ["as", "a"], ["out", "follows"], ["as", "b"], ["select", "a", "b"]]}}`,
+		expect:   []interface{}{map[string]interface{}{"a": vertex("bob"), "b": vertex("charlie")}},
+	},
+	{
+		message:  "count",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V"], ["out", "follows"], ["dedup"], ["count"]]}}`,
+		expect:   []interface{}{int64(2)},
+	},
+	{
+		message:  "limit",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V", "alice"], ["out", "follows"], ["limit", {"@type": "g:Int32", "@value": 1}]]}}`,
+		expect:   []interface{}{vertex("bob")},
+	},
+	{
+		message:  "refuse unknown steps",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V"], ["addV", "person"]]}}`,
+		err:      true,
+	},
+	{
+		message:  "refuse steps after count",
+		bytecode: `{"@type": "g:Bytecode", "@value": {"step": [["V"], ["count"], ["out"]]}}`,
+		err:      true,
+	},
+}
+
+func TestBytecode(t *testing.T) {
+	qs := makeTestStore(t)
+	for _, test := range bytecodeTests {
+		var raw interface{}
+		if err := json.Unmarshal([]byte(test.bytecode), &raw); err != nil {
+			t.Fatalf("Could not decode bytecode for %s: %v", test.message, err)
+		}
+		steps, err := parseBytecode(untype(raw))
+		if err != nil {
+			t.Fatalf("Could not parse bytecode for %s: %v", test.message, err)
+		}
+		tr, err := translate(qs, steps)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected error for %s", test.message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Could not translate %s: %v", test.message, err)
+			continue
+		}
+		got, err := tr.Run(time.Now().Add(time.Minute))
+		if err != nil {
+			t.Errorf("Could not run %s: %v", test.message, err)
+		} else if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected results for %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tinkerpop serves a Cayley database over the WebSocket protocol of
+// the TinkerPop Gremlin Server, so that the TinkerPop client libraries, such
+// as those for Java and Python, can run traversals on it.
+//
+// Requests are read at /gremlin, serialized as GraphSON 2 or 3. Only
+// traversals sent as bytecode are run, not scripts, and only those whose
+// steps are paths of Cayley:
+//
+//  g.V(ids...)  out(preds...)  in(preds...)  both(preds...)
+//  has(key, value)  has(T.id, id)  hasId(ids...)  as(tags...)
+//
+// followed by any of values(preds...), id() or select(tags...), and then
+// limit(n), dedup() and count(). The properties of vertices are the nodes
+// their predicates lead to; vertices have the label "vertex".
+package tinkerpop
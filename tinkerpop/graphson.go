@@ -0,0 +1,122 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinkerpop
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	mimeGraphSON2 = "application/vnd.gremlin-v2.0+json"
+	mimeGraphSON3 = "application/vnd.gremlin-v3.0+json"
+)
+
+// vertex is a node of the graph, by its name, serialized as a g:Vertex.
+type vertex string
+
+// token is a value of an enumeration of TinkerPop, such as the "id" of T.id.
+type token string
+
+// typed is a typed GraphSON value.
+type typed struct {
+	Type  string      `json:"@type"`
+	Value interface{} `json:"@value"`
+}
+
+// untype returns the plain value of a decoded GraphSON value, without the
+// types of the values within it: numbers are float64s, lists and sets are
+// []interface{}, maps are map[string]interface{} and enumerations are
+// tokens.
+func untype(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = untype(e)
+		}
+		return out
+	case map[string]interface{}:
+		t, ok := v["@type"].(string)
+		val, hasValue := v["@value"]
+		if !ok || !hasValue {
+			out := make(map[string]interface{}, len(v))
+			for k, e := range v {
+				out[k] = untype(e)
+			}
+			return out
+		}
+		switch t {
+		case "g:Map":
+			// A list of keys and values, in turn.
+			l, _ := val.([]interface{})
+			out := make(map[string]interface{}, len(l)/2)
+			for i := 0; i+1 < len(l); i += 2 {
+				out[fmt.Sprint(untype(l[i]))] = untype(l[i+1])
+			}
+			return out
+		case "g:T", "g:Direction", "g:Order", "g:Cardinality", "g:Column", "g:Pop", "g:Scope":
+			return token(fmt.Sprint(val))
+		}
+		return untype(val)
+	}
+	return v
+}
+
+// serializer writes results as GraphSON of a version.
+type serializer struct {
+	mime string
+}
+
+func (s serializer) v3() bool { return s.mime == mimeGraphSON3 }
+
+// encode returns the GraphSON form of a result: a vertex, a string, an int64,
+// a []interface{} or a map[string]interface{} of them.
+func (s serializer) encode(v interface{}) interface{} {
+	switch v := v.(type) {
+	case vertex:
+		return typed{"g:Vertex", map[string]interface{}{"id": string(v), "label": "vertex"}}
+	case int64:
+		return typed{"g:Int64", v}
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = s.encode(e)
+		}
+		if s.v3() {
+			return typed{"g:List", out}
+		}
+		return out
+	case map[string]interface{}:
+		if !s.v3() {
+			out := make(map[string]interface{}, len(v))
+			for k, e := range v {
+				out[k] = s.encode(e)
+			}
+			return out
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, 0, 2*len(v))
+		for _, k := range keys {
+			out = append(out, k, s.encode(v[k]))
+		}
+		return typed{"g:Map", out}
+	}
+	return v
+}
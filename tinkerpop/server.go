@@ -0,0 +1,199 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinkerpop
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/internal/auth"
+)
+
+// defaultBatchSize is the number of results sent in each response, unless a
+// request gives another.
+const defaultBatchSize = 64
+
+// The status codes of responses.
+const (
+	statusSuccess         = 200
+	statusNoContent       = 204
+	statusPartialContent  = 206
+	statusMalformed       = 498
+	statusInvalidArgs     = 499
+	statusServerError     = 500
+	statusServerTimeout   = 598
+	statusSerializeFailed = 599
+)
+
+// Server serves the Gremlin Server protocol on a database.
+type Server struct {
+	h   *graph.Handle
+	cfg *config.Config
+
+	// authz grants roles to the credentials of connections, unless the
+	// credentials of the configuration are invalid and authErr is set.
+	authz   *auth.Authorizer
+	authErr error
+}
+
+func NewServer(h *graph.Handle, cfg *config.Config) *Server {
+	s := &Server{h: h, cfg: cfg}
+	s.authz, s.authErr = auth.New(cfg)
+	return s
+}
+
+// Serve serves the Gremlin Server protocol on the database on addr, until
+// it fails.
+func Serve(h *graph.Handle, cfg *config.Config, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/gremlin", NewServer(h, cfg))
+	clog.Infof("Gremlin Server protocol now listening on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// ServeHTTP takes over a WebSocket connection, and answers the requests
+// sent on it in turn until it is closed. The connection must be opened with
+// credentials granting the read role, if credentials are configured.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.authErr != nil {
+		http.Error(w, "Unauthorized.", 401)
+		return
+	}
+	if role, err := s.authz.RoleOf(r.Header.Get("Authorization")); err != nil || !role.Can(auth.Read) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="cayley"`)
+		http.Error(w, "Unauthorized.", 401)
+		return
+	}
+	c, err := upgrade(w, r)
+	if err != nil {
+		clog.Errorf("Could not upgrade Gremlin Server connection: %v", err)
+		return
+	}
+	defer c.Close()
+	for {
+		op, msg, err := c.ReadMessage()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			clog.Errorf("Could not read Gremlin Server request: %v", err)
+			return
+		}
+		if err := s.serve(c, op, msg); err != nil {
+			clog.Errorf("Could not write Gremlin Server response: %v", err)
+			return
+		}
+	}
+}
+
+// serve answers a request. Binary requests start with the MIME type of
+// their serialization, after its length in a byte; text requests are in
+// GraphSON 3.
+func (s *Server) serve(c *wsConn, op byte, msg []byte) error {
+	ser := serializer{mime: mimeGraphSON3}
+	if op == opBinary {
+		if len(msg) == 0 || len(msg) < 1+int(msg[0]) {
+			return s.respond(c, ser, "", statusMalformed, "request has no MIME type", nil)
+		}
+		ser.mime, msg = string(msg[1:1+int(msg[0])]), msg[1+int(msg[0]):]
+	}
+	var raw interface{}
+	if err := json.Unmarshal(msg, &raw); err != nil {
+		return s.respond(c, serializer{mime: mimeGraphSON3}, "", statusMalformed, err.Error(), nil)
+	}
+	req, _ := untype(raw).(map[string]interface{})
+	id, _ := req["requestId"].(string)
+	switch ser.mime {
+	case mimeGraphSON2, mimeGraphSON3:
+	default:
+		mime := ser.mime
+		ser.mime = mimeGraphSON3
+		return s.respond(c, ser, id, statusMalformed, fmt.Sprintf("serializer %q is not supported", mime), nil)
+	}
+	args, _ := req["args"].(map[string]interface{})
+	switch req["op"] {
+	case "bytecode":
+	case "eval":
+		return s.respond(c, ser, id, statusInvalidArgs, "scripts are not supported, only traversals sent as bytecode", nil)
+	default:
+		return s.respond(c, ser, id, statusInvalidArgs, fmt.Sprintf("operation %v is not supported", req["op"]), nil)
+	}
+	steps, err := parseBytecode(args["gremlin"])
+	if err != nil {
+		return s.respond(c, ser, id, statusInvalidArgs, err.Error(), nil)
+	}
+	t, err := translate(graph.Snapshot(s.h.QuadStore), steps)
+	if err != nil {
+		return s.respond(c, ser, id, statusInvalidArgs, err.Error(), nil)
+	}
+	var deadline time.Time
+	if s.cfg.Timeout > 0 {
+		deadline = time.Now().Add(s.cfg.Timeout)
+	}
+	results, err := t.Run(deadline)
+	if err == ErrTimeout {
+		return s.respond(c, ser, id, statusServerTimeout, err.Error(), nil)
+	} else if err != nil {
+		return s.respond(c, ser, id, statusServerError, err.Error(), nil)
+	}
+	if len(results) == 0 {
+		return s.respond(c, ser, id, statusNoContent, "", nil)
+	}
+	batch := defaultBatchSize
+	if n, ok := args["batchSize"].(float64); ok && n > 0 {
+		batch = int(n)
+	}
+	for len(results) > batch {
+		if err := s.respond(c, ser, id, statusPartialContent, "", results[:batch]); err != nil {
+			return err
+		}
+		results = results[batch:]
+	}
+	return s.respond(c, ser, id, statusSuccess, "", results)
+}
+
+// respond sends a response to the request of the given ID, with results if
+// they are not nil.
+func (s *Server) respond(c *wsConn, ser serializer, id string, code int, message string, results []interface{}) error {
+	var data interface{}
+	if results != nil {
+		data = ser.encode(results)
+	}
+	empty := ser.encode(map[string]interface{}{})
+	b, err := json.Marshal(map[string]interface{}{
+		"requestId": id,
+		"status": map[string]interface{}{
+			"code":       code,
+			"message":    message,
+			"attributes": empty,
+		},
+		"result": map[string]interface{}{
+			"data": data,
+			"meta": empty,
+		},
+	})
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"requestId": id,
+			"status":    map[string]interface{}{"code": statusSerializeFailed, "message": err.Error()},
+		})
+	}
+	return c.WriteMessage(b)
+}
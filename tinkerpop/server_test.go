@@ -0,0 +1,156 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinkerpop
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+)
+
+// dial opens a WebSocket connection to the server, whose messages are read
+// with wsConn, as a client's are unmasked alike.
+func dial(t *testing.T, url string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("Could not dial: %v", err)
+	}
+	req, _ := http.NewRequest("GET", url+"/gremlin", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Write(conn)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatalf("Could not read handshake: %v", err)
+	}
+	if resp.StatusCode != 101 || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected handshake: %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, r
+}
+
+// send sends a masked binary message to the server.
+func send(conn net.Conn, msg []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opBinary, 0x80 | 126, byte(len(msg) >> 8), byte(len(msg))}
+	frame = append(frame, mask...)
+	for i, b := range msg {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+// receive reads an unmasked text message from the server.
+func receive(t *testing.T, r *bufio.Reader) map[string]interface{} {
+	head := make([]byte, 2)
+	r.Read(head)
+	n := int(head[1])
+	if n == 126 {
+		b := make([]byte, 2)
+		r.Read(b)
+		n = int(b[0])<<8 | int(b[1])
+	}
+	msg := make([]byte, n)
+	if _, err := readFull(r, msg); err != nil {
+		t.Fatalf("Could not read response: %v", err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(msg, &out); err != nil {
+		t.Fatalf("Could not decode response %q: %v", msg, err)
+	}
+	return out
+}
+
+func readFull(r *bufio.Reader, b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		m, err := r.Read(b[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func TestServer(t *testing.T) {
+	qs := makeTestStore(t)
+	s := NewServer(&graph.Handle{QuadStore: qs}, &config.Config{})
+	mux := http.NewServeMux()
+	mux.Handle("/gremlin", s)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	conn, r := dial(t, server.URL)
+	defer conn.Close()
+
+	for _, test := range []struct {
+		mime    string
+		request string
+		code    float64
+		data    string
+	}{
+		{
+			mime:    mimeGraphSON3,
+			request: `{"requestId": {"@type": "g:UUID", "@value": "41d2e28a-20a4-4ab0-b379-d810dede3786"}, "op": "bytecode", "processor": "traversal", "args": {"gremlin": {"@type": "g:Bytecode", "@value": {"step": [["V", "alice"], ["out", "follows"], ["count"]]}}, "aliases": {"g": "g"}}}`,
+			code:    200,
+			data:    `{"@type":"g:List","@value":[{"@type":"g:Int64","@value":2}]}`,
+		},
+		{
+			mime:    mimeGraphSON2,
+			request: `{"requestId": "41d2e28a-20a4-4ab0-b379-d810dede3786", "op": "bytecode", "processor": "traversal", "args": {"gremlin": {"@type": "g:Bytecode", "@value": {"step": [["V", "bob"], ["out", "follows"]]}}}}`,
+			code:    200,
+			data:    `[{"@type":"g:Vertex","@value":{"id":"charlie","label":"vertex"}}]`,
+		},
+		{
+			mime:    mimeGraphSON3,
+			request: `{"requestId": "41d2e28a-20a4-4ab0-b379-d810dede3786", "op": "bytecode", "processor": "traversal", "args": {"gremlin": {"@type": "g:Bytecode", "@value": {"step": [["V", "nobody"]]}}}}`,
+			code:    204,
+			data:    `null`,
+		},
+		{
+			mime:    mimeGraphSON3,
+			request: `{"requestId": "41d2e28a-20a4-4ab0-b379-d810dede3786", "op": "eval", "processor": "", "args": {"gremlin": "g.V()"}}`,
+			code:    499,
+			data:    `null`,
+		},
+	} {
+		send(conn, append([]byte{byte(len(test.mime))}, append([]byte(test.mime), test.request...)...))
+		resp := receive(t, r)
+		if resp["requestId"] != "41d2e28a-20a4-4ab0-b379-d810dede3786" {
+			t.Errorf("Unexpected request ID: %v", resp["requestId"])
+		}
+		status, _ := resp["status"].(map[string]interface{})
+		if status["code"] != test.code {
+			t.Errorf("Unexpected status for %s, got:%v expect:%v", test.request, status, test.code)
+			continue
+		}
+		result, _ := resp["result"].(map[string]interface{})
+		data, _ := json.Marshal(result["data"])
+		if string(data) != test.data {
+			t.Errorf("Unexpected data for %s, got:%s expect:%s", test.request, data, test.data)
+		}
+	}
+}
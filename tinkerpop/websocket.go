@@ -0,0 +1,216 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinkerpop
+
+// A WebSocket server, as described by RFC 6455, enough for the Gremlin Server
+// protocol: whole messages are read and written, and pings are answered.
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+
+	// maxMessageSize is the size of the largest message read.
+	maxMessageSize = 64 << 20
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	errNotWebSocket  = errors.New("not a websocket handshake")
+	errMessageSize   = errors.New("websocket message too large")
+	errUnmasked      = errors.New("websocket frame from client is not masked")
+	errBadFragmented = errors.New("websocket message badly fragmented")
+)
+
+// wsConn is the server end of a WebSocket connection.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex // Guards writes, which may come from several requests.
+}
+
+// upgrade answers a WebSocket handshake, and takes over its connection.
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" || key == "" ||
+		!strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!headerContains(r.Header, "Connection", "upgrade") {
+		http.Error(w, "Not a WebSocket handshake.", http.StatusBadRequest)
+		return nil, errNotWebSocket
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Cannot upgrade connection.", http.StatusInternalServerError)
+		return nil, errNotWebSocket
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering the pings
+// and skipping the pongs before it. It returns io.EOF once the client closes
+// the connection.
+func (c *wsConn) ReadMessage() (op byte, msg []byte, err error) {
+	for {
+		fin, fop, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch fop {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return 0, nil, io.EOF
+		case opContinuation:
+			if op == 0 {
+				return 0, nil, errBadFragmented
+			}
+		case opText, opBinary:
+			if op != 0 {
+				return 0, nil, errBadFragmented
+			}
+			op = fop
+		default:
+			return 0, nil, errBadFragmented
+		}
+		if len(msg)+len(payload) > maxMessageSize {
+			return 0, nil, errMessageSize
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return op, msg, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0f
+	if head[1]&0x80 == 0 {
+		return fin, op, nil, errUnmasked
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.r, b[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.r, b[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if n > maxMessageSize {
+		return fin, op, nil, errMessageSize
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage writes a whole text message.
+func (c *wsConn) WriteMessage(msg []byte) error {
+	return c.writeFrame(opText, msg)
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	head := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		head[1] = byte(n)
+	case n <= 0xffff:
+		head[1] = 126
+		head = append(head, byte(n>>8), byte(n))
+	default:
+		head[1] = 127
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		head = append(head, b[:]...)
+	}
+	if _, err := c.conn.Write(head); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
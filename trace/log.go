@@ -0,0 +1,90 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/cayley/clog"
+)
+
+func init() {
+	RegisterTracer("log", newLogTracer)
+}
+
+// logTracer logs each span, with its trace, its parent and its tags, when it
+// finishes after at least min.
+type logTracer struct {
+	min  time.Duration
+	last uint64
+}
+
+func newLogTracer(opts map[string]interface{}) (Tracer, error) {
+	t := &logTracer{}
+	if v, ok := opts["min_duration_ms"]; ok {
+		ms, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("trace: invalid min_duration_ms %v", v)
+		}
+		t.min = time.Duration(ms * float64(time.Millisecond))
+	}
+	return t, nil
+}
+
+func (t *logTracer) StartSpan(op string, parent Span) Span {
+	s := &logSpan{
+		t:     t,
+		op:    op,
+		id:    atomic.AddUint64(&t.last, 1),
+		start: time.Now(),
+	}
+	if p, ok := parent.(*logSpan); ok {
+		s.trace = p.trace
+		s.parent = p.id
+	} else {
+		s.trace = s.id
+	}
+	return s
+}
+
+type logSpan struct {
+	t     *logTracer
+	op    string
+	start time.Time
+
+	trace, id, parent uint64
+
+	mu   sync.Mutex
+	tags bytes.Buffer
+}
+
+func (s *logSpan) SetTag(key string, value interface{}) {
+	s.mu.Lock()
+	fmt.Fprintf(&s.tags, " %s=%v", key, value)
+	s.mu.Unlock()
+}
+
+func (s *logSpan) Finish() {
+	d := time.Since(s.start)
+	if d < s.t.min {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clog.Infof("trace %d: span %d (parent %d) %s took %v%s", s.trace, s.id, s.parent, s.op, d, s.tags.String())
+}
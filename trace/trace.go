@@ -0,0 +1,114 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package trace records spans, the timed steps of a request such as parsing,
+// optimizing and running a query or writing to the backend, so that operators
+// can see where a slow request spends its time.
+//
+// Spans are sent to the Tracer chosen by the "tracer" configuration option
+// among those registered with RegisterTracer. The "log" tracer logs the spans
+// that take longer than a threshold. Adapters to tracing systems such as
+// OpenTracing register their own Tracer, in a package linked into the
+// binary:
+//
+//  func init() {
+//  	trace.RegisterTracer("opentracing", func(map[string]interface{}) (trace.Tracer, error) {
+//  		return adapter{opentracing.GlobalTracer()}, nil
+//  	})
+//  }
+package trace
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Span is a step of a request, timed from its start to Finish.
+type Span interface {
+	// SetTag annotates the span, for instance with the number of results
+	// of a query.
+	SetTag(key string, value interface{})
+
+	// Finish ends the span.
+	Finish()
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// StartSpan starts a span for the operation op, as a child of
+	// parent, or as the root of a new trace if parent is nil.
+	StartSpan(op string, parent Span) Span
+}
+
+// NewTracerFunc returns a Tracer configured by the "tracer_options" of the
+// configuration.
+type NewTracerFunc func(opts map[string]interface{}) (Tracer, error)
+
+var (
+	tracerRegistry = make(map[string]NewTracerFunc)
+
+	// tracer receives the spans; if nil, they are discarded.
+	tracer Tracer
+)
+
+func RegisterTracer(name string, newFunc NewTracerFunc) {
+	if _, found := tracerRegistry[name]; found {
+		panic("already registered Tracer " + name)
+	}
+	tracerRegistry[name] = newFunc
+}
+
+func TracerTypes() []string {
+	t := make([]string, 0, len(tracerRegistry))
+	for n := range tracerRegistry {
+		t = append(t, n)
+	}
+	sort.Strings(t)
+	return t
+}
+
+// Open sets the tracer to the registered Tracer with the given name. It must
+// be called before the database serves requests.
+func Open(name string, opts map[string]interface{}) error {
+	newFunc, ok := tracerRegistry[name]
+	if !ok {
+		return fmt.Errorf("trace: unknown tracer %q, expected one of %v", name, TracerTypes())
+	}
+	t, err := newFunc(opts)
+	if err != nil {
+		return err
+	}
+	tracer = t
+	return nil
+}
+
+// Set sets the tracer to t, or discards spans if t is nil. Like Open, it must
+// be called before the database serves requests.
+func Set(t Tracer) {
+	tracer = t
+}
+
+// Start starts a span for the operation op with the tracer, as a child of
+// parent if it is not nil. Without a tracer it returns a span that does
+// nothing, so that code need not check whether tracing is enabled.
+func Start(op string, parent Span) Span {
+	if tracer == nil {
+		return nopSpan{}
+	}
+	return tracer.StartSpan(op, parent)
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetTag(string, interface{}) {}
+func (nopSpan) Finish()                    {}
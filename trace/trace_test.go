@@ -0,0 +1,56 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import "testing"
+
+func TestStartWithoutTracer(t *testing.T) {
+	Set(nil)
+	s := Start("query", nil)
+	if _, ok := s.(nopSpan); !ok {
+		t.Errorf("Unexpected span without a tracer, got:%T expect:nopSpan", s)
+	}
+	s.SetTag("results", 1)
+	s.Finish()
+}
+
+func TestLogTracer(t *testing.T) {
+	if err := Open("log", map[string]interface{}{"min_duration_ms": "fast"}); err == nil {
+		t.Errorf("Expected an error for an invalid min_duration_ms")
+	}
+	if err := Open("nosuch", nil); err == nil {
+		t.Errorf("Expected an error for an unknown tracer")
+	}
+	if err := Open("log", map[string]interface{}{"min_duration_ms": float64(1000)}); err != nil {
+		t.Fatalf("Could not open the log tracer: %v", err)
+	}
+	defer Set(nil)
+
+	root := Start("http", nil).(*logSpan)
+	child := Start("optimize", root).(*logSpan)
+	other := Start("http", nil).(*logSpan)
+	if child.trace != root.id || child.parent != root.id {
+		t.Errorf("Child span not in the trace of its parent, got:%d/%d expect:%d/%d", child.trace, child.parent, root.id, root.id)
+	}
+	if other.trace == root.trace {
+		t.Errorf("Root spans share trace %d", root.trace)
+	}
+	child.SetTag("iterator", "and")
+	if got := child.tags.String(); got != " iterator=and" {
+		t.Errorf("Unexpected tags, got:%q expect:%q", got, " iterator=and")
+	}
+	child.Finish()
+	root.Finish()
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+// Defines the audit log, an append-only file to which a writer given the
+// "audit_path" option records every batch of deltas it applies, one JSON
+// encoded AuditEntry per line.
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/cayley/graph"
+)
+
+// AuditEntry records a batch of deltas applied by a writer.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+
+	// User and RequestID are who the batch was written for, and the
+	// request that wrote it, if the write was attributed to them.
+	User      string `json:"user,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+
+	Deltas []graph.Delta `json:"deltas"`
+
+	// Error is why the QuadStore rejected the batch, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditFilter selects entries of an audit log. Its zero value selects all
+// of them.
+type AuditFilter struct {
+	// Since and Until bound the time of the entries, if not zero.
+	Since, Until time.Time
+
+	// User and RequestID select the entries with the given attribution,
+	// if not empty.
+	User      string
+	RequestID string
+
+	// Limit is the most entries to select, if positive.
+	Limit int
+}
+
+// Match returns whether the filter selects e, regardless of its Limit.
+func (f AuditFilter) Match(e *AuditEntry) bool {
+	switch {
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.User != "" && e.User != f.User:
+		return false
+	case f.RequestID != "" && e.RequestID != f.RequestID:
+		return false
+	}
+	return true
+}
+
+// ReadAudit returns the entries of the audit log read from r that the filter
+// selects, oldest first.
+func ReadAudit(r io.Reader, f AuditFilter) ([]AuditEntry, error) {
+	dec := json.NewDecoder(r)
+	out := []AuditEntry{}
+	for f.Limit <= 0 || len(out) < f.Limit {
+		var e AuditEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if f.Match(&e) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// ReadAuditFile is like ReadAudit, reading the audit log at path.
+func ReadAuditFile(path string, f AuditFilter) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadAudit(file, f)
+}
+
+// attribution is who a write is made for, and by which request.
+type attribution struct {
+	user, requestID string
+}
+
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f}, nil
+}
+
+// record appends an entry for a batch of deltas, and the error applying it.
+func (l *auditLog) record(deltas []graph.Delta, a attribution, applyErr error) error {
+	e := AuditEntry{
+		Time:      time.Now(),
+		User:      a.user,
+		RequestID: a.requestID,
+		Deltas:    deltas,
+	}
+	if applyErr != nil {
+		e.Error = applyErr.Error()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(append(b, '\n'))
+	return err
+}
+
+func (l *auditLog) close() error {
+	return l.f.Close()
+}
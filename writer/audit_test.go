@@ -0,0 +1,105 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+)
+
+func TestAudit(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "audit")
+
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, err := NewSingleReplication(qs, graph.Options{"audit_path": path})
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	start := time.Now()
+	q := quad.Quad{"A", "follows", "B", ""}
+	if err := w.AddQuad(q); err != nil {
+		t.Fatalf("Could not add quad: %v", err)
+	}
+	aw, ok := w.(graph.AuditingWriter)
+	if !ok {
+		t.Fatalf("Single is not an AuditingWriter")
+	}
+	bob := aw.WithAudit("bob", "req-1")
+	if err := bob.AddQuad(q); err != graph.ErrQuadExists {
+		t.Errorf("Unexpected error adding duplicate quad: %v", err)
+	}
+	if _, err := bob.DeleteQuadsMatching(quad.Quad{Subject: "A"}); err != nil {
+		t.Errorf("Could not delete quads: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Could not close writer: %v", err)
+	}
+
+	all, err := ReadAuditFile(path, AuditFilter{})
+	if err != nil {
+		t.Fatalf("Could not read audit log: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Unexpected number of audit entries, got:%d expect:3", len(all))
+	}
+	for i, expect := range []struct {
+		user   string
+		action graph.Procedure
+		failed bool
+	}{
+		{"", graph.Add, false},
+		{"bob", graph.Add, true},
+		{"bob", graph.Delete, false},
+	} {
+		e := &all[i]
+		if e.User != expect.user || len(e.Deltas) != 1 || e.Deltas[0].Action != expect.action || e.Deltas[0].Quad != q || (e.Error != "") != expect.failed {
+			t.Errorf("Unexpected audit entry %d: %+v", i, e)
+		}
+		if e.Time.Before(start) {
+			t.Errorf("Unexpected time of audit entry %d: %v", i, e.Time)
+		}
+	}
+
+	for _, test := range []struct {
+		filter AuditFilter
+		expect int
+	}{
+		{AuditFilter{User: "bob"}, 2},
+		{AuditFilter{RequestID: "req-1", Limit: 1}, 1},
+		{AuditFilter{RequestID: "req-2"}, 0},
+		{AuditFilter{Since: time.Now()}, 0},
+		{AuditFilter{Until: start}, 0},
+	} {
+		got, err := ReadAuditFile(path, test.filter)
+		if err != nil {
+			t.Fatalf("Could not read audit log: %v", err)
+		}
+		if len(got) != test.expect {
+			t.Errorf("Unexpected number of entries for %+v, got:%d expect:%d", test.filter, len(got), test.expect)
+		}
+	}
+}
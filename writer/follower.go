@@ -0,0 +1,261 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+// Defines the "follower" writer, which keeps a QuadStore up to date with the
+// write-ahead log of a primary, fetched over HTTP.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func init() {
+	graph.RegisterWriter("follower", NewFollower)
+}
+
+// ErrFollower is returned for writes made to a follower.
+var ErrFollower = errors.New("writer: a follower only applies the writes of its primary")
+
+// DefaultFollowInterval is how often a follower that has caught up asks its
+// primary for new batches, unless set by the "poll_interval_ms" option.
+const DefaultFollowInterval = time.Second
+
+// LogBatch is a committed batch of a primary's log, as served to followers.
+type LogBatch struct {
+	// Offset is the position in the log just after the batch, from which
+	// the next one is read.
+	Offset int64         `json:"offset"`
+	Deltas []graph.Delta `json:"deltas"`
+}
+
+// LogBatches is the response of the primary's replication log endpoint.
+type LogBatches struct {
+	Batches []LogBatch `json:"batches"`
+}
+
+// Follower is a QuadWriter that applies the batches logged by a primary's
+// wal writer to its QuadStore, and refuses any other write.
+//
+// The deltas keep the IDs given by the primary, so the follower's horizon
+// tells how far it has caught up. The offset reached in the primary's log
+// is saved to the file named by the "offset_path" option, if given, so that
+// a restarted follower of a persistent store resumes where it stopped.
+//
+// If the primary is configured with credentials, the follower presents the
+// "token" option as a bearer token, or else the "user" and "password"
+// options for basic authentication; they must grant the admin role.
+type Follower struct {
+	qs         graph.QuadStore
+	logURL     string
+	offsetPath string
+	client     *http.Client
+	auth       PrimaryAuth
+
+	mu     sync.Mutex
+	offset int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewFollower returns a Follower of the primary at the URL given by the
+// "primary" option, such as "http://primary:64210". It polls the primary every
+// "poll_interval_ms" milliseconds once it has caught up; with an interval of
+// zero or less it only follows when Sync is called.
+func NewFollower(qs graph.QuadStore, opts graph.Options) (graph.QuadWriter, error) {
+	primary, ok, err := opts.StringKey("primary")
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("follower: missing primary option")
+	}
+	offsetPath, _, err := opts.StringKey("offset_path")
+	if err != nil {
+		return nil, err
+	}
+	auth, err := PrimaryAuthOf(opts)
+	if err != nil {
+		return nil, err
+	}
+	interval := DefaultFollowInterval
+	ms, ok, err := opts.IntKey("poll_interval_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		interval = time.Duration(ms) * time.Millisecond
+	}
+
+	f := &Follower{
+		qs:         qs,
+		logURL:     strings.TrimSuffix(primary, "/") + "/api/v1/replication/log",
+		offsetPath: offsetPath,
+		client:     &http.Client{Timeout: time.Minute},
+		auth:       auth,
+		done:       make(chan struct{}),
+	}
+	if offsetPath != "" {
+		b, err := ioutil.ReadFile(offsetPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			f.offset, err = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("follower: invalid offset in %s: %v", offsetPath, err)
+			}
+		}
+	}
+	if interval > 0 {
+		go f.follow(interval)
+	}
+	return f, nil
+}
+
+// PrimaryAuth is what the readers of a primary's replication log present to
+// it, if it is configured with credentials: a bearer token, or else a user
+// name and password for basic authentication.
+type PrimaryAuth struct {
+	Token, User, Password string
+}
+
+// PrimaryAuthOf returns the PrimaryAuth given by the "token", "user" and
+// "password" options.
+func PrimaryAuthOf(opts graph.Options) (PrimaryAuth, error) {
+	var a PrimaryAuth
+	var err error
+	for key, p := range map[string]*string{"token": &a.Token, "user": &a.User, "password": &a.Password} {
+		*p, _, err = opts.StringKey(key)
+		if err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// Set sets the Authorization header of a request to the primary.
+func (a PrimaryAuth) Set(req *http.Request) {
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	} else if a.User != "" {
+		req.SetBasicAuth(a.User, a.Password)
+	}
+}
+
+func (f *Follower) follow(interval time.Duration) {
+	for {
+		n, err := f.Sync()
+		if err != nil {
+			clog.Errorf("follower: could not follow %s: %v", f.logURL, err)
+		}
+		if n > 0 && err == nil {
+			// There may be more batches waiting.
+			select {
+			case <-f.done:
+				return
+			default:
+			}
+			continue
+		}
+		select {
+		case <-f.done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Sync fetches the batches the primary has logged since the last one
+// applied, applies them, and returns how many there were.
+func (f *Follower) Sync() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	req, err := http.NewRequest("GET", f.logURL+"?offset="+url.QueryEscape(strconv.FormatInt(f.offset, 10)), nil)
+	if err != nil {
+		return 0, err
+	}
+	f.auth.Set(req)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return 0, fmt.Errorf("primary returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var log LogBatches
+	err = json.NewDecoder(resp.Body).Decode(&log)
+	if err != nil {
+		return 0, err
+	}
+	for i, b := range log.Batches {
+		// Replaying a batch that was applied before the offset was saved
+		// must not fail.
+		err = f.qs.ApplyDeltas(b.Deltas, graph.IgnoreOpts{IgnoreDup: true, IgnoreMissing: true})
+		if err != nil {
+			return i, err
+		}
+		f.offset = b.Offset
+		err = f.saveOffset()
+		if err != nil {
+			return i + 1, err
+		}
+	}
+	return len(log.Batches), nil
+}
+
+func (f *Follower) saveOffset() error {
+	if f.offsetPath == "" {
+		return nil
+	}
+	tmp := f.offsetPath + ".tmp"
+	err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(f.offset, 10)), 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.offsetPath)
+}
+
+// Offset returns the position reached in the primary's log.
+func (f *Follower) Offset() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.offset
+}
+
+func (f *Follower) AddQuad(quad.Quad) error                    { return ErrFollower }
+func (f *Follower) AddQuadSet([]quad.Quad) error               { return ErrFollower }
+func (f *Follower) RemoveQuad(quad.Quad) error                 { return ErrFollower }
+func (f *Follower) ApplyTransaction(*graph.Transaction) error  { return ErrFollower }
+func (f *Follower) DeleteQuadsMatching(quad.Quad) (int, error) { return 0, ErrFollower }
+
+// Close stops following the primary.
+func (f *Follower) Close() error {
+	f.closeOnce.Do(func() { close(f.done) })
+	return nil
+}
@@ -15,20 +15,38 @@
 package writer
 
 import (
+	"errors"
+	"sync"
 	"time"
 
+	"github.com/google/cayley/clog"
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/quad"
+	"github.com/google/cayley/trace"
 )
 
 func init() {
 	graph.RegisterWriter("single", NewSingleReplication)
 }
 
+var (
+	ErrEmptyPattern = errors.New("writer: refusing to delete with an empty pattern")
+)
+
+// DefaultSweepInterval is how often expired quads are removed from stores
+// that support expiry, unless set by the "sweep_interval_ms" option.
+const DefaultSweepInterval = time.Minute
+
 type Single struct {
 	currentID  graph.PrimaryKey
 	qs         graph.QuadStore
 	ignoreOpts graph.IgnoreOpts
+	audit      *auditLog
+
+	// mu serializes the writes of the sweeper with the others.
+	mu        sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
 }
 
 func NewSingleReplication(qs graph.QuadStore, opts graph.Options) (graph.QuadWriter, error) {
@@ -56,53 +74,498 @@ func NewSingleReplication(qs graph.QuadStore, opts graph.Options) (graph.QuadWri
 		}
 	}
 
-	return &Single{
+	sweepInterval := DefaultSweepInterval
+	interval, ok, err := opts.IntKey("sweep_interval_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		sweepInterval = time.Duration(interval) * time.Millisecond
+	}
+
+	var gcInterval time.Duration
+	interval, ok, err = opts.IntKey("gc_interval_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		gcInterval = time.Duration(interval) * time.Millisecond
+	}
+
+	var compactInterval, compactRetention time.Duration
+	interval, ok, err = opts.IntKey("compact_interval_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		compactInterval = time.Duration(interval) * time.Millisecond
+	}
+	interval, ok, err = opts.IntKey("compact_retention_ms")
+	if err != nil {
+		return nil, err
+	} else if ok {
+		compactRetention = time.Duration(interval) * time.Millisecond
+	}
+
+	var audit *auditLog
+	auditPath, ok, err := opts.StringKey("audit_path")
+	if err != nil {
+		return nil, err
+	} else if ok && auditPath != "" {
+		audit, err = openAuditLog(auditPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Single{
 		currentID: qs.Horizon(),
 		qs:        qs,
 		ignoreOpts: graph.IgnoreOpts{
 			IgnoreDup:     ignoreDuplicate,
 			IgnoreMissing: ignoreMissing,
 		},
-	}, nil
+		audit: audit,
+		done:  make(chan struct{}),
+	}
+	if _, ok := qs.(graph.Expirer); ok && sweepInterval > 0 {
+		go s.sweep(sweepInterval)
+	}
+	if _, ok := qs.(graph.GarbageCollector); ok && gcInterval > 0 {
+		go s.collect(gcInterval)
+	}
+	if _, ok := qs.(graph.Compactor); ok && compactInterval > 0 {
+		go s.compact(compactInterval, compactRetention)
+	}
+	return s, nil
 }
 
-func (s *Single) AddQuad(q quad.Quad) error {
-	deltas := make([]graph.Delta, 1)
-	deltas[0] = graph.Delta{
-		ID:        s.currentID.Next(),
-		Quad:      q,
-		Action:    graph.Add,
-		Timestamp: time.Now(),
+// writeOpts are the options of a single write.
+type writeOpts struct {
+	ignore graph.IgnoreOpts
+	a      attribution
+
+	// If conditional is set, the write fails with graph.ErrConflict
+	// unless the horizon of the QuadStore is still horizon.
+	conditional bool
+	horizon     int64
+
+	// span is the span that writes to the QuadStore are traced under.
+	span trace.Span
+
+	// sync is when writes are flushed to disk, for a graph.Syncer.
+	sync graph.SyncPolicy
+}
+
+func (s *Single) defaultOpts() writeOpts {
+	return writeOpts{ignore: s.ignoreOpts}
+}
+
+func (s *Single) applyDeltas(deltas []graph.Delta, opts writeOpts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applyDeltasLocked(deltas, opts)
+}
+
+// applyDeltasLocked gives deltas their IDs and applies them to the QuadStore,
+// along with the deletions of the quads it evicts to make room for them, if
+// its horizon is the expected one, and records them in the audit log, if
+// there is one. s.mu must be held, so that concurrent writes are applied in
+// the order of their IDs, and the horizon never goes back.
+func (s *Single) applyDeltasLocked(deltas []graph.Delta, opts writeOpts) error {
+	if opts.conditional {
+		if h := s.qs.Horizon(); h.Int() != opts.horizon {
+			return graph.ErrConflict
+		}
 	}
-	return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
+	for i := range deltas {
+		deltas[i].ID = s.currentID.Next()
+	}
+	if e, ok := s.qs.(graph.Evicter); ok {
+		quads, err := e.Evictions(deltas)
+		if err != nil {
+			return err
+		}
+		// The quads evicted to make room are deleted by the same write,
+		// so that they are logged, audited and replicated with it.
+		deltas = deltas[:len(deltas):len(deltas)]
+		now := time.Now()
+		for _, q := range quads {
+			deltas = append(deltas, graph.Delta{
+				ID:        s.currentID.Next(),
+				Quad:      q,
+				Action:    graph.Delete,
+				Timestamp: now,
+			})
+		}
+	}
+	span := trace.Start("apply_deltas", opts.span)
+	span.SetTag("deltas", len(deltas))
+	var err error
+	if sq, ok := s.qs.(graph.Syncer); ok && opts.sync != graph.SyncDefault {
+		err = sq.ApplyDeltasSync(deltas, opts.ignore, opts.sync)
+	} else {
+		err = s.qs.ApplyDeltas(deltas, opts.ignore)
+	}
+	if err != nil {
+		span.SetTag("error", err)
+	}
+	span.Finish()
+	if s.audit != nil {
+		if aerr := s.audit.record(deltas, opts.a, err); aerr != nil {
+			clog.Errorf("could not write to the audit log: %v", aerr)
+		}
+	}
+	return err
+}
+
+func (s *Single) sweep(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			n, err := s.RemoveExpired()
+			if err == graph.ErrReadOnly {
+				// Expired quads stay until the store is opened
+				// writable.
+				return
+			}
+			if err != nil {
+				clog.Errorf("could not remove expired quads: %v", err)
+			} else if n > 0 {
+				clog.V(2).Infof("removed %d expired quads", n)
+			}
+		}
+	}
+}
+
+func (s *Single) collect(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			stats, err := s.CollectGarbage()
+			if err == graph.ErrReadOnly {
+				return
+			}
+			if err != nil {
+				clog.Errorf("could not collect garbage: %v", err)
+			} else if stats.Nodes > 0 {
+				clog.V(2).Infof("collected %d unreferenced nodes, reclaiming %d bytes", stats.Nodes, stats.Bytes)
+			}
+		}
+	}
+}
+
+// CollectGarbage removes the values of the nodes no quad references, if the
+// QuadStore supports it. It holds off writes while it runs, and is called
+// periodically by the writer if the "gc_interval_ms" option is set.
+func (s *Single) CollectGarbage() (graph.GCStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return graph.CollectGarbage(s.qs)
+}
+
+func (s *Single) compact(interval, retention time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			stats, err := s.Compact(retention)
+			if err == graph.ErrReadOnly {
+				return
+			}
+			if err != nil {
+				clog.Errorf("could not compact: %v", err)
+			} else if stats.Quads > 0 || stats.Nodes > 0 {
+				clog.V(2).Infof("compacted %d deleted quads and %d unreferenced nodes, from %d to %d bytes", stats.Quads, stats.Nodes, stats.Before, stats.After)
+			}
+		}
+	}
+}
+
+// Compact purges the quads deleted more than retention ago and reclaims the
+// space they took up, if the QuadStore supports it. It holds off writes while
+// it runs, and is called periodically by the writer if the
+// "compact_interval_ms" option is set, with the "compact_retention_ms" one.
+func (s *Single) Compact(retention time.Duration) (graph.CompactStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return graph.Compact(s.qs, retention)
+}
+
+// RemoveExpired removes the quads that have expired, if the QuadStore supports
+// expiry, and returns how many were removed. It is called periodically by
+// the writer.
+func (s *Single) RemoveExpired() (int, error) {
+	e, ok := s.qs.(graph.Expirer)
+	if !ok {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quads, err := e.ExpiredQuads(time.Now())
+	if err != nil || len(quads) == 0 {
+		return 0, err
+	}
+	deltas := make([]graph.Delta, len(quads))
+	for i, q := range quads {
+		deltas[i] = graph.Delta{
+			Quad:      q,
+			Action:    graph.Delete,
+			Timestamp: time.Now(),
+		}
+	}
+	err = s.applyDeltasLocked(deltas, writeOpts{ignore: graph.IgnoreOpts{IgnoreMissing: true}})
+	if err != nil {
+		return 0, err
+	}
+	return len(quads), nil
+}
+
+func (s *Single) AddQuad(q quad.Quad) error {
+	return s.addQuadSet([]quad.Quad{q}, time.Time{}, graph.Provenance{}, s.defaultOpts())
 }
 
 func (s *Single) AddQuadSet(set []quad.Quad) error {
+	return s.addQuadSet(set, time.Time{}, graph.Provenance{}, s.defaultOpts())
+}
+
+// AddQuadSetExpiring adds a set of quads that are removed again once the
+// expiry time has passed. It requires a QuadStore that supports expiry.
+func (s *Single) AddQuadSetExpiring(set []quad.Quad, expires time.Time) error {
+	return s.addQuadSet(set, expires, graph.Provenance{}, s.defaultOpts())
+}
+
+// AddQuadSetWithProvenance adds a set of quads recording the author and source
+// of p. It requires a QuadStore that keeps provenance.
+func (s *Single) AddQuadSetWithProvenance(set []quad.Quad, p graph.Provenance) error {
+	return s.addQuadSet(set, time.Time{}, p, s.defaultOpts())
+}
+
+func (s *Single) addQuadSet(set []quad.Quad, expires time.Time, p graph.Provenance, opts writeOpts) error {
+	if _, ok := s.qs.(graph.Expirer); !ok && !expires.IsZero() {
+		return graph.ErrNoExpiry
+	}
+	if _, ok := s.qs.(graph.ProvenanceKeeper); !ok && !p.IsZero() {
+		return graph.ErrNoProvenance
+	}
 	deltas := make([]graph.Delta, len(set))
 	for i, q := range set {
 		deltas[i] = graph.Delta{
-			ID:        s.currentID.Next(),
 			Quad:      q,
 			Action:    graph.Add,
 			Timestamp: time.Now(),
+			Expires:   expires,
+			Author:    p.Author,
+			Source:    p.Source,
 		}
 	}
 
-	return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
+	return s.applyDeltas(deltas, opts)
 }
 
 func (s *Single) RemoveQuad(q quad.Quad) error {
+	return s.removeQuad(q, s.defaultOpts())
+}
+
+func (s *Single) removeQuad(q quad.Quad, opts writeOpts) error {
 	deltas := make([]graph.Delta, 1)
 	deltas[0] = graph.Delta{
-		ID:        s.currentID.Next(),
 		Quad:      q,
 		Action:    graph.Delete,
 		Timestamp: time.Now(),
 	}
-	return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
+	return s.applyDeltas(deltas, opts)
+}
+
+func (s *Single) ApplyTransaction(t *graph.Transaction) error {
+	return s.applyTransaction(t, s.defaultOpts())
+}
+
+func (s *Single) applyTransaction(t *graph.Transaction, opts writeOpts) error {
+	if len(t.Deltas) == 0 {
+		return nil
+	}
+	ts := time.Now()
+	deltas := make([]graph.Delta, len(t.Deltas))
+	for i := range t.Deltas {
+		deltas[i] = graph.Delta{
+			Quad:      t.Deltas[i].Quad,
+			Action:    t.Deltas[i].Action,
+			Timestamp: ts,
+			Expires:   t.Deltas[i].Expires,
+			Author:    t.Deltas[i].Author,
+			Source:    t.Deltas[i].Source,
+		}
+	}
+	return s.applyDeltas(deltas, opts)
+}
+
+func (s *Single) DeleteQuadsMatching(pattern quad.Quad) (int, error) {
+	return s.deleteQuadsMatching(pattern, s.defaultOpts())
+}
+
+func (s *Single) deleteQuadsMatching(pattern quad.Quad, opts writeOpts) (int, error) {
+	if pattern == (quad.Quad{}) {
+		return 0, ErrEmptyPattern
+	}
+	// Hold the lock across the lookup so that the matches are still live
+	// when they are removed.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quads, err := graph.MatchingQuads(s.qs, pattern)
+	if err != nil || len(quads) == 0 {
+		return 0, err
+	}
+	ts := time.Now()
+	deltas := make([]graph.Delta, len(quads))
+	for i, q := range quads {
+		deltas[i] = graph.Delta{
+			Quad:      q,
+			Action:    graph.Delete,
+			Timestamp: ts,
+		}
+	}
+	opts.ignore = graph.IgnoreOpts{IgnoreMissing: true}
+	err = s.applyDeltasLocked(deltas, opts)
+	if err != nil {
+		return 0, err
+	}
+	return len(quads), nil
 }
 
 func (s *Single) Close() error {
-	// Nothing to clean up locally.
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.audit != nil {
+			// Wait for a sweep in progress to record its deletions.
+			s.mu.Lock()
+			err = s.audit.close()
+			s.audit = nil
+			s.mu.Unlock()
+		}
+	})
+	return err
+}
+
+// IgnoreOpts returns the options the writer was configured with.
+func (s *Single) IgnoreOpts() graph.IgnoreOpts {
+	return s.ignoreOpts
+}
+
+// WithIgnoreOpts returns a QuadWriter that writes through s, but applies the
+// given options instead of those s was configured with.
+func (s *Single) WithIgnoreOpts(ignoreOpts graph.IgnoreOpts) graph.QuadWriter {
+	v := &view{s: s, opts: s.defaultOpts()}
+	return v.WithIgnoreOpts(ignoreOpts)
+}
+
+// WithAudit returns a QuadWriter that writes through s, attributing its
+// writes in the audit log to the given user and request.
+func (s *Single) WithAudit(user, requestID string) graph.QuadWriter {
+	v := &view{s: s, opts: s.defaultOpts()}
+	return v.WithAudit(user, requestID)
+}
+
+// WithExpectedHorizon returns a QuadWriter that writes through s, but fails
+// with graph.ErrConflict unless the horizon of the QuadStore is still the
+// given one.
+func (s *Single) WithExpectedHorizon(horizon int64) graph.QuadWriter {
+	v := &view{s: s, opts: s.defaultOpts()}
+	return v.WithExpectedHorizon(horizon)
+}
+
+// WithSpan returns a QuadWriter that writes through s, tracing its writes to
+// the QuadStore as children of span.
+func (s *Single) WithSpan(span trace.Span) graph.QuadWriter {
+	v := &view{s: s, opts: s.defaultOpts()}
+	return v.WithSpan(span)
+}
+
+// WithSync returns a QuadWriter that writes through s, flushing its writes
+// to disk as the policy says, if the QuadStore is a graph.Syncer.
+func (s *Single) WithSync(policy graph.SyncPolicy) graph.QuadWriter {
+	v := &view{s: s, opts: s.defaultOpts()}
+	return v.WithSync(policy)
+}
+
+// view is a Single with its own write options.
+type view struct {
+	s    *Single
+	opts writeOpts
+}
+
+func (w *view) AddQuad(q quad.Quad) error {
+	return w.s.addQuadSet([]quad.Quad{q}, time.Time{}, graph.Provenance{}, w.opts)
+}
+
+func (w *view) AddQuadSet(set []quad.Quad) error {
+	return w.s.addQuadSet(set, time.Time{}, graph.Provenance{}, w.opts)
+}
+
+func (w *view) AddQuadSetExpiring(set []quad.Quad, expires time.Time) error {
+	return w.s.addQuadSet(set, expires, graph.Provenance{}, w.opts)
+}
+
+func (w *view) AddQuadSetWithProvenance(set []quad.Quad, p graph.Provenance) error {
+	return w.s.addQuadSet(set, time.Time{}, p, w.opts)
+}
+
+func (w *view) RemoveQuad(q quad.Quad) error {
+	return w.s.removeQuad(q, w.opts)
+}
+
+func (w *view) ApplyTransaction(t *graph.Transaction) error {
+	return w.s.applyTransaction(t, w.opts)
+}
+
+func (w *view) DeleteQuadsMatching(pattern quad.Quad) (int, error) {
+	return w.s.deleteQuadsMatching(pattern, w.opts)
+}
+
+func (w *view) IgnoreOpts() graph.IgnoreOpts {
+	return w.opts.ignore
+}
+
+func (w *view) WithIgnoreOpts(ignoreOpts graph.IgnoreOpts) graph.QuadWriter {
+	v := *w
+	v.opts.ignore = ignoreOpts
+	return &v
+}
+
+func (w *view) WithAudit(user, requestID string) graph.QuadWriter {
+	v := *w
+	v.opts.a = attribution{user: user, requestID: requestID}
+	return &v
+}
+
+func (w *view) WithExpectedHorizon(horizon int64) graph.QuadWriter {
+	v := *w
+	v.opts.conditional, v.opts.horizon = true, horizon
+	return &v
+}
+
+func (w *view) WithSpan(span trace.Span) graph.QuadWriter {
+	v := *w
+	v.opts.span = span
+	return &v
+}
+
+func (w *view) WithSync(policy graph.SyncPolicy) graph.QuadWriter {
+	v := *w
+	v.opts.sync = policy
+	return &v
+}
+
+// Close does nothing; the underlying writer is closed by its owner.
+func (w *view) Close() error {
 	return nil
 }
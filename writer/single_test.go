@@ -0,0 +1,161 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+)
+
+func TestWithIgnoreOpts(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, err := NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer w.Close()
+	iw, ok := w.(graph.IgnoringWriter)
+	if !ok {
+		t.Fatalf("Single is not an IgnoringWriter")
+	}
+	if opts := iw.IgnoreOpts(); opts != (graph.IgnoreOpts{}) {
+		t.Errorf("Unexpected default options: %+v", opts)
+	}
+
+	q := quad.Quad{"A", "follows", "B", ""}
+	if err := w.AddQuad(q); err != nil {
+		t.Fatalf("Could not add quad: %v", err)
+	}
+	if err := w.AddQuad(q); err != graph.ErrQuadExists {
+		t.Errorf("Unexpected error adding duplicate quad: %v", err)
+	}
+	lenient := iw.WithIgnoreOpts(graph.IgnoreOpts{IgnoreDup: true, IgnoreMissing: true})
+	if err := lenient.AddQuadSet([]quad.Quad{q, {"B", "follows", "C", ""}}); err != nil {
+		t.Errorf("Unexpected error adding duplicate quad while ignoring duplicates: %v", err)
+	}
+	if s := qs.Size(); s != 2 {
+		t.Errorf("Unexpected size, got:%d expect:2", s)
+	}
+	if err := lenient.RemoveQuad(quad.Quad{"C", "follows", "A", ""}); err != nil {
+		t.Errorf("Unexpected error removing missing quad while ignoring missing: %v", err)
+	}
+	lenient.Close()
+	if err := w.RemoveQuad(quad.Quad{"C", "follows", "A", ""}); err != graph.ErrQuadNotExist {
+		t.Errorf("Unexpected error removing missing quad: %v", err)
+	}
+	if err := w.AddQuad(quad.Quad{"C", "follows", "A", ""}); err != nil {
+		t.Errorf("Could not add quad after closing the view: %v", err)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, err := NewSingleReplication(qs, graph.Options{"gc_interval_ms": 1.0})
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer w.Close()
+	s := w.(*Single)
+	q := quad.Quad{"A", "follows", "B", ""}
+	s.AddQuad(q)
+	s.RemoveQuad(q)
+	s.mu.Lock()
+	_, err = graph.Purge(qs, -time.Hour)
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatalf("Could not purge: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		it := qs.NodesAllIterator()
+		found := graph.Next(it)
+		it.Close()
+		s.mu.Unlock()
+		if !found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Unreferenced nodes were not collected in the background")
+}
+
+func TestWithExpectedHorizon(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, err := NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer w.Close()
+	cw, ok := w.(graph.ConditionalWriter)
+	if !ok {
+		t.Fatalf("Single is not a ConditionalWriter")
+	}
+	h := qs.Horizon()
+	read := h.Int()
+	if err := cw.WithExpectedHorizon(read).AddQuad(quad.Quad{"A", "follows", "B", ""}); err != nil {
+		t.Errorf("Unexpected error writing at the current horizon: %v", err)
+	}
+	stale := cw.WithExpectedHorizon(read)
+	if err := stale.AddQuad(quad.Quad{"B", "follows", "C", ""}); err != graph.ErrConflict {
+		t.Errorf("Unexpected error writing at a stale horizon, got:%v expect:%v", err, graph.ErrConflict)
+	}
+	if _, err := stale.DeleteQuadsMatching(quad.Quad{Subject: "A"}); err != graph.ErrConflict {
+		t.Errorf("Unexpected error deleting at a stale horizon, got:%v expect:%v", err, graph.ErrConflict)
+	}
+	if n := qs.Size(); n != 1 {
+		t.Errorf("Unexpected size after conflicting writes, got:%d expect:1", n)
+	}
+}
+
+// syncingStore records the sync policies it is asked to apply deltas with.
+type syncingStore struct {
+	graph.QuadStore
+	policies []graph.SyncPolicy
+}
+
+func (qs *syncingStore) ApplyDeltasSync(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts, policy graph.SyncPolicy) error {
+	qs.policies = append(qs.policies, policy)
+	return qs.QuadStore.ApplyDeltas(deltas, ignoreOpts)
+}
+
+func TestWithSync(t *testing.T) {
+	mem, _ := graph.NewQuadStore("memstore", "", nil)
+	qs := &syncingStore{QuadStore: mem}
+	w, err := NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatalf("Could not create writer: %v", err)
+	}
+	defer w.Close()
+	sw, ok := w.(graph.SyncingWriter)
+	if !ok {
+		t.Fatalf("Single is not a SyncingWriter")
+	}
+	if err := w.AddQuad(quad.Quad{"A", "follows", "B", ""}); err != nil {
+		t.Fatalf("Could not add quad: %v", err)
+	}
+	if err := sw.WithSync(graph.SyncNever).AddQuad(quad.Quad{"B", "follows", "C", ""}); err != nil {
+		t.Fatalf("Could not add quad without syncing: %v", err)
+	}
+	if len(qs.policies) != 1 || qs.policies[0] != graph.SyncNever {
+		t.Errorf("Unexpected sync policies, got:%v expect:[never]", qs.policies)
+	}
+	if s := qs.Size(); s != 2 {
+		t.Errorf("Unexpected size, got:%d expect:2", s)
+	}
+}
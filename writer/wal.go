@@ -0,0 +1,425 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+// Defines the "wal" writer, which appends every batch of deltas to a
+// write-ahead log file before handing it to the QuadStore.
+//
+// The log is a sequence of records, each an 8 byte header holding the
+// little endian length and CRC-32 (IEEE) of the payload, followed by the
+// payload. A payload is either a batch of deltas or a commit marker for the
+// batch before it. A batch is written, and optionally synced, before it is
+// applied; the commit marker is written once the QuadStore has accepted it.
+// A batch the QuadStore rejects is truncated away again, and a batch left
+// without a commit marker by a crash is replayed into the QuadStore the next
+// time the log is opened.
+//
+// Committed batches can be read back, and followed as they are written, with
+// a LogReader.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/cayley/clog"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func init() {
+	graph.RegisterWriter("wal", NewWAL)
+}
+
+var ErrCorruptLog = errors.New("wal: corrupt log")
+
+const (
+	recordBatch  byte = 'B'
+	recordCommit byte = 'C'
+
+	headerLen = 8
+)
+
+// WAL is a QuadWriter that logs every batch of deltas before applying it.
+type WAL struct {
+	*Single
+	log *loggedStore
+}
+
+// NewWAL returns a QuadWriter logging to the file named by the "wal_path"
+// option. Unless the "wal_sync" option is false, each batch is synced to disk
+// before it is applied. Other options are as for the single writer.
+func NewWAL(qs graph.QuadStore, opts graph.Options) (graph.QuadWriter, error) {
+	path, ok, err := opts.StringKey("wal_path")
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("wal: missing wal_path option")
+	}
+	syncWrites, ok, err := opts.BoolKey("wal_sync")
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		syncWrites = true
+	}
+	ls, err := openLoggedStore(qs, path, syncWrites)
+	if err != nil {
+		return nil, err
+	}
+	var store graph.QuadStore = ls
+	_, expiring := qs.(graph.Expirer)
+	_, provenance := qs.(graph.ProvenanceKeeper)
+	switch {
+	case expiring && provenance:
+		store = expiringProvenanceLoggedStore{expiringLoggedStore{ls}}
+	case expiring:
+		store = expiringLoggedStore{ls}
+	case provenance:
+		store = provenanceLoggedStore{ls}
+	}
+	w, err := NewSingleReplication(store, opts)
+	if err != nil {
+		ls.close()
+		return nil, err
+	}
+	return &WAL{Single: w.(*Single), log: ls}, nil
+}
+
+func (w *WAL) Close() error {
+	w.Single.Close()
+	return w.log.close()
+}
+
+// loggedStore sits between the writer and the QuadStore, logging each batch
+// passed to ApplyDeltas.
+type loggedStore struct {
+	graph.QuadStore
+	mu   sync.Mutex
+	f    *os.File
+	off  int64
+	sync bool
+}
+
+func openLoggedStore(qs graph.QuadStore, path string, syncWrites bool) (*loggedStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	ls := &loggedStore{QuadStore: qs, f: f, sync: syncWrites}
+	err = ls.recover()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return ls, nil
+}
+
+// recover finds the end of the valid part of the log, truncating anything
+// after it, and applies the last batch if it was never committed.
+func (ls *loggedStore) recover() error {
+	var (
+		off     int64
+		pending []graph.Delta
+	)
+	for {
+		kind, deltas, n, err := readRecord(ls.f, off)
+		if err == io.EOF || err == ErrCorruptLog {
+			break
+		} else if err != nil {
+			return err
+		}
+		switch kind {
+		case recordBatch:
+			pending = deltas
+		case recordCommit:
+			pending = nil
+		}
+		off += n
+	}
+	err := ls.f.Truncate(off)
+	if err != nil {
+		return err
+	}
+	ls.off = off
+	if pending == nil {
+		return nil
+	}
+	clog.Infof("wal: replaying %d uncommitted deltas", len(pending))
+	err = ls.QuadStore.ApplyDeltas(pending, graph.IgnoreOpts{IgnoreDup: true, IgnoreMissing: true})
+	if err != nil {
+		return err
+	}
+	return ls.append(encodeCommit())
+}
+
+func (ls *loggedStore) append(payload []byte) error {
+	var buf bytes.Buffer
+	buf.Grow(headerLen + len(payload))
+	var header [headerLen]byte
+	binary.LittleEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	buf.Write(header[:])
+	buf.Write(payload)
+	n, err := ls.f.WriteAt(buf.Bytes(), ls.off)
+	if err != nil {
+		return err
+	}
+	ls.off += int64(n)
+	return nil
+}
+
+func (ls *loggedStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	payload, err := encodeBatch(deltas)
+	if err != nil {
+		return err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	start := ls.off
+	err = ls.append(payload)
+	if err == nil && ls.sync {
+		err = ls.f.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("wal: could not log batch: %v", err)
+	}
+	err = ls.QuadStore.ApplyDeltas(deltas, ignoreOpts)
+	if err != nil {
+		// The batch never happened as far as the log is concerned.
+		if terr := ls.f.Truncate(start); terr != nil {
+			clog.Errorf("wal: could not truncate rejected batch: %v", terr)
+		}
+		ls.off = start
+		return err
+	}
+	return ls.append(encodeCommit())
+}
+
+// Evictions returns the quads the QuadStore evicts to make room for the
+// deltas, if it does, so that the writer logs their deletion with the batch.
+func (ls *loggedStore) Evictions(deltas []graph.Delta) ([]quad.Quad, error) {
+	if e, ok := ls.QuadStore.(graph.Evicter); ok {
+		return e.Evictions(deltas)
+	}
+	return nil, nil
+}
+
+// expiringLoggedStore is a loggedStore over a QuadStore that supports
+// expiry, so that the writer can sweep expired quads and log their removal.
+type expiringLoggedStore struct {
+	*loggedStore
+}
+
+func (ls expiringLoggedStore) ExpiredQuads(now time.Time) ([]quad.Quad, error) {
+	return ls.QuadStore.(graph.Expirer).ExpiredQuads(now)
+}
+
+// provenanceLoggedStore is a loggedStore over a QuadStore that keeps
+// provenance, so that the writer accepts quads with one.
+type provenanceLoggedStore struct {
+	*loggedStore
+}
+
+func (ls provenanceLoggedStore) Provenance(q graph.Value) (graph.Provenance, bool) {
+	return ls.QuadStore.(graph.ProvenanceKeeper).Provenance(q)
+}
+
+type expiringProvenanceLoggedStore struct {
+	expiringLoggedStore
+}
+
+func (ls expiringProvenanceLoggedStore) Provenance(q graph.Value) (graph.Provenance, bool) {
+	return ls.QuadStore.(graph.ProvenanceKeeper).Provenance(q)
+}
+
+func (ls *loggedStore) close() error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	err := ls.f.Sync()
+	if cerr := ls.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func encodeCommit() []byte {
+	return []byte{recordCommit}
+}
+
+func encodeBatch(deltas []graph.Delta) ([]byte, error) {
+	var buf bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+	putString := func(s string) {
+		putUvarint(uint64(len(s)))
+		buf.WriteString(s)
+	}
+	buf.WriteByte(recordBatch)
+	putUvarint(uint64(len(deltas)))
+	for i := range deltas {
+		d := &deltas[i]
+		id, err := d.ID.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		putString(string(id))
+		buf.WriteByte(byte(d.Action))
+		buf.Write(tmp[:binary.PutVarint(tmp[:], d.Timestamp.UnixNano())])
+		var expires int64
+		if !d.Expires.IsZero() {
+			expires = d.Expires.UnixNano()
+		}
+		buf.Write(tmp[:binary.PutVarint(tmp[:], expires)])
+		putString(d.Quad.Subject)
+		putString(d.Quad.Predicate)
+		putString(d.Quad.Object)
+		putString(d.Quad.Label)
+	}
+	// Provenance follows the deltas, so that batches without any read the
+	// same as before it was logged.
+	provenance := false
+	for i := range deltas {
+		if deltas[i].Author != "" || deltas[i].Source != "" {
+			provenance = true
+			break
+		}
+	}
+	if provenance {
+		for i := range deltas {
+			putString(deltas[i].Author)
+			putString(deltas[i].Source)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeBatch(payload []byte) ([]graph.Delta, error) {
+	r := bytes.NewReader(payload[1:])
+	getString := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		if n > uint64(r.Len()) {
+			return "", ErrCorruptLog
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return string(b), err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrCorruptLog
+	}
+	if n > uint64(r.Len()) {
+		return nil, ErrCorruptLog
+	}
+	deltas := make([]graph.Delta, n)
+	for i := range deltas {
+		d := &deltas[i]
+		id, err := getString()
+		if err != nil {
+			return nil, ErrCorruptLog
+		}
+		err = d.ID.UnmarshalJSON([]byte(id))
+		if err != nil {
+			return nil, ErrCorruptLog
+		}
+		action, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrCorruptLog
+		}
+		d.Action = graph.Procedure(int8(action))
+		ts, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, ErrCorruptLog
+		}
+		d.Timestamp = time.Unix(0, ts)
+		expires, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, ErrCorruptLog
+		}
+		if expires != 0 {
+			d.Expires = time.Unix(0, expires)
+		}
+		var q quad.Quad
+		for _, s := range []*string{&q.Subject, &q.Predicate, &q.Object, &q.Label} {
+			*s, err = getString()
+			if err != nil {
+				return nil, ErrCorruptLog
+			}
+		}
+		d.Quad = q
+	}
+	if r.Len() == 0 {
+		return deltas, nil
+	}
+	for i := range deltas {
+		d := &deltas[i]
+		for _, s := range []*string{&d.Author, &d.Source} {
+			*s, err = getString()
+			if err != nil {
+				return nil, ErrCorruptLog
+			}
+		}
+	}
+	if r.Len() != 0 {
+		return nil, ErrCorruptLog
+	}
+	return deltas, nil
+}
+
+// readRecord reads the record at off, returning its kind, its deltas if it is
+// a batch, and its length including the header. It returns io.EOF if the
+// record has not been completely written yet.
+func readRecord(r io.ReaderAt, off int64) (byte, []graph.Delta, int64, error) {
+	var header [headerLen]byte
+	_, err := r.ReadAt(header[:], off)
+	if err == io.EOF {
+		return 0, nil, 0, io.EOF
+	} else if err != nil {
+		return 0, nil, 0, err
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(header[:4]))
+	_, err = r.ReadAt(payload, off+headerLen)
+	if err == io.EOF {
+		return 0, nil, 0, io.EOF
+	} else if err != nil {
+		return 0, nil, 0, err
+	}
+	if len(payload) == 0 || crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+		return 0, nil, 0, ErrCorruptLog
+	}
+	n := int64(headerLen + len(payload))
+	switch payload[0] {
+	case recordCommit:
+		return recordCommit, nil, n, nil
+	case recordBatch:
+		deltas, err := decodeBatch(payload)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		return recordBatch, deltas, n, nil
+	}
+	return 0, nil, 0, ErrCorruptLog
+}
@@ -0,0 +1,121 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/cayley/graph"
+)
+
+// LogReader reads the committed batches of a write-ahead log written by the
+// wal writer. It may be used while the log is being written, in which case
+// it serves as a change feed of the QuadStore.
+type LogReader struct {
+	f   *os.File
+	off int64
+	err error
+}
+
+// NewLogReader opens the log at path for reading from its beginning.
+func NewLogReader(path string) (*LogReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &LogReader{f: f}, nil
+}
+
+// Next returns the next committed batch of deltas. It returns io.EOF when it
+// has caught up with the writer; Next may be called again later to pick up
+// batches written since.
+func (r *LogReader) Next() ([]graph.Delta, error) {
+	for {
+		kind, deltas, n, err := readRecord(r.f, r.off)
+		if err != nil {
+			return nil, err
+		}
+		if kind == recordCommit {
+			// A commit without a batch is left by crash recovery.
+			r.off += n
+			continue
+		}
+		next, _, m, err := readRecord(r.f, r.off+n)
+		if err != nil {
+			// The batch may still be rejected and truncated away, so it is
+			// not consumed until its commit marker is seen.
+			return nil, err
+		}
+		if next != recordCommit {
+			return nil, ErrCorruptLog
+		}
+		r.off += n + m
+		return deltas, nil
+	}
+}
+
+// Follow calls Next until done is closed, sending every batch on the
+// returned channel and polling for new ones at the given interval once it
+// has caught up. The channel is closed when done is closed or on a read
+// error, which is then available from Err.
+func (r *LogReader) Follow(poll time.Duration, done <-chan struct{}) <-chan []graph.Delta {
+	c := make(chan []graph.Delta)
+	go func() {
+		defer close(c)
+		for {
+			deltas, err := r.Next()
+			if err == io.EOF {
+				select {
+				case <-done:
+					return
+				case <-time.After(poll):
+				}
+				continue
+			} else if err != nil {
+				r.err = err
+				return
+			}
+			select {
+			case c <- deltas:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// Err returns the error that stopped Follow, if any.
+func (r *LogReader) Err() error {
+	return r.err
+}
+
+// Offset returns the position in the log up to which batches have been
+// read. A reader can be resumed from there with SetOffset.
+func (r *LogReader) Offset() int64 {
+	return r.off
+}
+
+// SetOffset sets the position in the log from which to read, which must have
+// been returned by Offset.
+func (r *LogReader) SetOffset(off int64) {
+	r.off = off
+}
+
+func (r *LogReader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+)
+
+func TestWAL(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "wal")
+	opts := graph.Options{"wal_path": path}
+
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, err := NewWAL(qs, opts)
+	if err != nil {
+		t.Fatalf("Could not open WAL: %v", err)
+	}
+	r, err := NewLogReader(path)
+	if err != nil {
+		t.Fatalf("Could not open log reader: %v", err)
+	}
+	defer r.Close()
+
+	set := []quad.Quad{
+		{"A", "follows", "B", ""},
+		{"B", "follows", "C", ""},
+	}
+	if err := w.AddQuadSet(set); err != nil {
+		t.Fatalf("Could not add quads: %v", err)
+	}
+	if err := w.AddQuad(set[0]); err != graph.ErrQuadExists {
+		t.Fatalf("Unexpected error adding duplicate quad: %v", err)
+	}
+	if err := w.RemoveQuad(set[1]); err != nil {
+		t.Fatalf("Could not remove quad: %v", err)
+	}
+
+	var got [][]quad.Quad
+	var actions []graph.Procedure
+	for {
+		deltas, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error reading log: %v", err)
+		}
+		var quads []quad.Quad
+		for i := range deltas {
+			quads = append(quads, deltas[i].Quad)
+			actions = append(actions, deltas[i].Action)
+		}
+		got = append(got, quads)
+	}
+	expect := [][]quad.Quad{set, set[1:]}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected logged batches, got:%v expect:%v", got, expect)
+	}
+	if !reflect.DeepEqual(actions, []graph.Procedure{graph.Add, graph.Add, graph.Delete}) {
+		t.Errorf("Unexpected logged actions: %v", actions)
+	}
+
+	// Simulate a crash between logging a batch and applying it.
+	if err := w.Close(); err != nil {
+		t.Fatalf("Could not close WAL: %v", err)
+	}
+	ls, err := openLoggedStore(qs, path, false)
+	if err != nil {
+		t.Fatalf("Could not reopen log: %v", err)
+	}
+	lost := quad.Quad{"C", "follows", "A", ""}
+	horizon := qs.Horizon()
+	batch, _ := encodeBatch([]graph.Delta{{
+		ID:        graph.NewSequentialKey(horizon.Int() + 1),
+		Quad:      lost,
+		Action:    graph.Add,
+		Timestamp: time.Now(),
+	}})
+	if err := ls.append(batch); err != nil {
+		t.Fatalf("Could not write batch: %v", err)
+	}
+	ls.close()
+
+	done := make(chan struct{})
+	defer close(done)
+	feed := r.Follow(time.Millisecond, done)
+
+	w, err = NewWAL(qs, opts)
+	if err != nil {
+		t.Fatalf("Could not recover WAL: %v", err)
+	}
+	defer w.Close()
+	if s := qs.Size(); s != 2 {
+		t.Errorf("Unexpected size after recovery, got:%d expect:2", s)
+	}
+	select {
+	case deltas := <-feed:
+		if len(deltas) != 1 || deltas[0].Quad != lost {
+			t.Errorf("Unexpected recovered batch in feed: %v", deltas)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Recovered batch did not appear in feed")
+	}
+}
+
+func TestBatchProvenance(t *testing.T) {
+	q := quad.Quad{"A", "follows", "B", ""}
+	for _, author := range []string{"", "alice"} {
+		payload, err := encodeBatch([]graph.Delta{{
+			ID:        graph.NewSequentialKey(1),
+			Quad:      q,
+			Action:    graph.Add,
+			Timestamp: time.Now(),
+			Author:    author,
+			Source:    "graph.nq",
+		}, {
+			ID:        graph.NewSequentialKey(2),
+			Quad:      q,
+			Action:    graph.Delete,
+			Timestamp: time.Now(),
+		}})
+		if err != nil {
+			t.Fatalf("Could not encode batch: %v", err)
+		}
+		deltas, err := decodeBatch(payload)
+		if err != nil {
+			t.Fatalf("Could not decode batch: %v", err)
+		}
+		if len(deltas) != 2 || deltas[0].Author != author || deltas[0].Source != "graph.nq" ||
+			deltas[1].Author != "" || deltas[1].Source != "" {
+			t.Errorf("Unexpected provenance after decoding, got:%+v", deltas)
+		}
+	}
+}
+
+func TestWALEviction(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test")
+	if err != nil {
+		t.Fatalf("Could not create working directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "wal")
+
+	qs, _ := graph.NewQuadStore("memstore", "", graph.Options{"max_quads": 2.0, "eviction": "lru"})
+	w, err := NewWAL(qs, graph.Options{"wal_path": path})
+	if err != nil {
+		t.Fatalf("Could not open WAL: %v", err)
+	}
+	defer w.Close()
+	old := []quad.Quad{{"A", "follows", "B", "old"}, {"B", "follows", "C", "old"}}
+	if err := w.AddQuadSet(old); err != nil {
+		t.Fatalf("Could not add quads: %v", err)
+	}
+	added := quad.Quad{"C", "follows", "A", "new"}
+	if err := w.AddQuad(added); err != nil {
+		t.Fatalf("Could not add a quad evicting others: %v", err)
+	}
+
+	r, err := NewLogReader(path)
+	if err != nil {
+		t.Fatalf("Could not open log reader: %v", err)
+	}
+	defer r.Close()
+	r.Next()
+	deltas, err := r.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error reading log: %v", err)
+	}
+	type logged struct {
+		ID     int64
+		Quad   quad.Quad
+		Action graph.Procedure
+	}
+	var got []logged
+	for i := range deltas {
+		got = append(got, logged{deltas[i].ID.Int(), deltas[i].Quad, deltas[i].Action})
+	}
+	expect := []logged{
+		{3, added, graph.Add},
+		{4, old[0], graph.Delete},
+		{5, old[1], graph.Delete},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected logged batch, got:%v expect:%v", got, expect)
+	}
+	if h := qs.Horizon(); h.Int() != 5 {
+		t.Errorf("Unexpected horizon, got:%d expect:5", h.Int())
+	}
+}